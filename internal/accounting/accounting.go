@@ -0,0 +1,318 @@
+// Package accounting keeps per-caller scan usage by calendar month, for
+// chargeback of the shared scanning service, and enforces monthly quotas.
+package accounting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// periodFormat names a calendar month (UTC), e.g. "2026-10"
+const periodFormat = "2006-01"
+
+// keptPeriods bounds the months of usage kept, the current one included
+const keptPeriods = 13
+
+// flushInterval is how often changed usage is written to the usage file
+const flushInterval = 10 * time.Second
+
+// Usage is one caller's scanning in one month
+type Usage struct {
+	Caller string `json:"caller"`
+	Period string `json:"period"`
+	Scans  int64  `json:"scans"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Quota limits each caller's scanning per calendar month; 0 is unlimited
+type Quota struct {
+	Scans int64 `json:"scans,omitempty"`
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+// QuotaError is returned when a scan would take a caller past its monthly
+// quota
+type QuotaError struct {
+	Caller  string
+	Limit   string // "scans" or "bytes"
+	ResetAt time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("monthly %s quota exceeded", e.Limit)
+}
+
+// Ledger counts each caller's scans and bytes per month. With a file path,
+// usage is written there periodically and on Close, and reloaded on Open, so
+// a restart does not lose the month's counts; otherwise it lasts until
+// restart.
+type Ledger struct {
+	mu      sync.Mutex
+	quota   Quota
+	periods map[string]map[string]*Usage // period -> caller -> usage
+	path    string
+	logger  *slog.Logger
+	dirty   bool
+	now     func() time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Open loads usage from path, if it exists, and starts writing changes
+// back to it. An empty path keeps usage in memory only.
+func Open(path string, quota Quota, logger *slog.Logger) (*Ledger, error) {
+	l := &Ledger{
+		quota:   quota,
+		periods: make(map[string]map[string]*Usage),
+		path:    path,
+		logger:  logger,
+		now:     time.Now,
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+	if len(data) > 0 {
+		var usage []Usage
+		if err := json.Unmarshal(data, &usage); err != nil {
+			return nil, fmt.Errorf("failed to parse usage file: %w", err)
+		}
+		for _, u := range usage {
+			l.usageLocked(u.Caller, u.Period).add(u.Scans, u.Bytes)
+		}
+	}
+
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.flushLoop()
+	return l, nil
+}
+
+// Charge counts a scan of size bytes against the caller's current month,
+// or returns a *QuotaError, counting nothing, if the scan would exceed the
+// quota. Scans are charged when admitted, so ones that later fail count too.
+func (l *Ledger) Charge(caller string, size int64) error {
+	now := l.now().UTC()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	usage := l.usageLocked(caller, now.Format(periodFormat))
+
+	limit := ""
+	switch {
+	case l.quota.Scans > 0 && usage.Scans+1 > l.quota.Scans:
+		limit = "scans"
+	case l.quota.Bytes > 0 && usage.Bytes+size > l.quota.Bytes:
+		limit = "bytes"
+	}
+	if limit != "" {
+		return &QuotaError{Caller: caller, Limit: limit, ResetAt: nextPeriod(now)}
+	}
+	usage.add(1, size)
+	l.dirty = true
+	return nil
+}
+
+// Refund takes back a Charge for a scan that was refused after all, e.g.
+// by the scanner's own throttling
+func (l *Ledger) Refund(caller string, size int64) {
+	period := l.CurrentPeriod()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	usage, ok := l.periods[period][caller]
+	if !ok {
+		return
+	}
+	usage.Scans = max(usage.Scans-1, 0)
+	usage.Bytes = max(usage.Bytes-size, 0)
+	l.dirty = true
+}
+
+// Usage returns a caller's usage in a period ("" for the current month)
+func (l *Ledger) Usage(caller, period string) Usage {
+	if period == "" {
+		period = l.CurrentPeriod()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if usage, ok := l.periods[period][caller]; ok {
+		return *usage
+	}
+	return Usage{Caller: caller, Period: period}
+}
+
+// List returns every caller's usage in a period ("" for the current month),
+// busiest first
+func (l *Ledger) List(period string) []Usage {
+	if period == "" {
+		period = l.CurrentPeriod()
+	}
+	l.mu.Lock()
+	result := make([]Usage, 0, len(l.periods[period]))
+	for _, usage := range l.periods[period] {
+		result = append(result, *usage)
+	}
+	l.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].Caller < result[j].Caller
+	})
+	return result
+}
+
+// Quota returns the monthly quota every caller has
+func (l *Ledger) Quota() Quota {
+	return l.quota
+}
+
+// CurrentPeriod names the current month
+func (l *Ledger) CurrentPeriod() string {
+	return l.now().UTC().Format(periodFormat)
+}
+
+// ResetAt is when the current month's quotas reset
+func (l *Ledger) ResetAt() time.Time {
+	return nextPeriod(l.now().UTC())
+}
+
+// ValidPeriod reports whether period names a month, e.g. "2026-10"
+func ValidPeriod(period string) bool {
+	_, err := time.Parse(periodFormat, period)
+	return err == nil
+}
+
+// Close writes pending usage to the usage file and stops writing
+func (l *Ledger) Close() error {
+	if l.stop == nil {
+		return nil
+	}
+	close(l.stop)
+	<-l.done
+	return l.flush()
+}
+
+// usageLocked returns the caller's usage record for a period, creating it
+// and dropping periods beyond keptPeriods; callers hold l.mu
+func (l *Ledger) usageLocked(caller, period string) *Usage {
+	callers, ok := l.periods[period]
+	if !ok {
+		callers = make(map[string]*Usage)
+		l.periods[period] = callers
+		l.pruneLocked()
+	}
+	usage, ok := callers[caller]
+	if !ok {
+		usage = &Usage{Caller: caller, Period: period}
+		callers[caller] = usage
+	}
+	return usage
+}
+
+// pruneLocked drops the oldest periods beyond keptPeriods; callers hold l.mu
+func (l *Ledger) pruneLocked() {
+	if len(l.periods) <= keptPeriods {
+		return
+	}
+	periods := make([]string, 0, len(l.periods))
+	for period := range l.periods {
+		periods = append(periods, period)
+	}
+	sort.Strings(periods)
+	for _, period := range periods[:len(periods)-keptPeriods] {
+		delete(l.periods, period)
+	}
+}
+
+func (l *Ledger) flushLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.flush(); err != nil {
+				l.logger.Error("Failed to save usage", "error", err)
+			}
+		}
+	}
+}
+
+// flush writes all usage to the usage file if it changed, replacing the
+// file atomically so a crash mid-write keeps the previous counts
+func (l *Ledger) flush() error {
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	var usage []Usage
+	for _, callers := range l.periods {
+		for _, u := range callers {
+			usage = append(usage, *u)
+		}
+	}
+	l.dirty = false
+	l.mu.Unlock()
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Period != usage[j].Period {
+			return usage[i].Period < usage[j].Period
+		}
+		return usage[i].Caller < usage[j].Caller
+	})
+	data, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".usage-*")
+	if err != nil {
+		return l.flushFailed(err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return l.flushFailed(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return l.flushFailed(err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		os.Remove(tmp.Name())
+		return l.flushFailed(err)
+	}
+	return nil
+}
+
+// flushFailed marks usage for another write attempt
+func (l *Ledger) flushFailed(err error) error {
+	l.mu.Lock()
+	l.dirty = true
+	l.mu.Unlock()
+	return fmt.Errorf("failed to write usage file: %w", err)
+}
+
+func (u *Usage) add(scans, bytes int64) {
+	u.Scans += scans
+	u.Bytes += bytes
+}
+
+// nextPeriod is the start of the month after t's
+func nextPeriod(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
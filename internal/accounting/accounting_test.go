@@ -0,0 +1,115 @@
+package accounting
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestLedger_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	l, err := Open(path, Quota{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, size := range []int64{100, 250} {
+		if err := l.Charge("prod/loans/intake", size); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := l.Charge("prod/kyc/docs", 5000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	l, err = Open(path, Quota{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+	if u := l.Usage("prod/loans/intake", ""); u.Scans != 2 || u.Bytes != 350 {
+		t.Errorf("unexpected usage after reload: %+v", u)
+	}
+	list := l.List("")
+	if len(list) != 2 || list[0].Caller != "prod/kyc/docs" {
+		t.Errorf("expected the busiest caller first, got %+v", list)
+	}
+}
+
+func TestLedger_Quota(t *testing.T) {
+	l, err := Open("", Quota{Scans: 2, Bytes: 1000}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.now = func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) }
+
+	var quotaErr *QuotaError
+	if err := l.Charge("a", 600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.Charge("a", 600); !errors.As(err, &quotaErr) || quotaErr.Limit != "bytes" {
+		t.Fatalf("expected a bytes quota error, got %v", err)
+	}
+	if !quotaErr.ResetAt.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the quota to reset next month, got %v", quotaErr.ResetAt)
+	}
+	if err := l.Charge("a", 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.Charge("a", 1); !errors.As(err, &quotaErr) || quotaErr.Limit != "scans" {
+		t.Fatalf("expected a scans quota error, got %v", err)
+	}
+	if u := l.Usage("a", ""); u.Scans != 2 || u.Bytes != 700 {
+		t.Errorf("expected refused scans not to count, got %+v", u)
+	}
+	if err := l.Charge("b", 100); err != nil {
+		t.Errorf("expected each caller to have its own quota, got %v", err)
+	}
+
+	// A refund makes room again, and a new month starts afresh
+	l.Refund("a", 100)
+	if err := l.Charge("a", 100); err != nil {
+		t.Errorf("expected a refunded scan to free quota, got %v", err)
+	}
+	l.now = func() time.Time { return time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC) }
+	if err := l.Charge("a", 600); err != nil {
+		t.Errorf("expected the quota to reset, got %v", err)
+	}
+	if u := l.Usage("a", "2026-10"); u.Scans != 2 {
+		t.Errorf("expected last month's usage to be kept, got %+v", u)
+	}
+}
+
+func TestLedger_PrunesOldPeriods(t *testing.T) {
+	l, err := Open("", Quota{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	for i := range keptPeriods + 2 {
+		l.now = func() time.Time { return start.AddDate(0, i, 0) }
+		l.Charge("a", 1)
+	}
+	if len(l.periods) != keptPeriods {
+		t.Errorf("expected %d periods kept, got %d", keptPeriods, len(l.periods))
+	}
+	if _, ok := l.periods["2025-01"]; ok {
+		t.Error("expected the oldest period to be dropped")
+	}
+}
+
+func TestValidPeriod(t *testing.T) {
+	for period, want := range map[string]bool{"2026-10": true, "2026-13": false, "2026-1": false, "october": false} {
+		if got := ValidPeriod(period); got != want {
+			t.Errorf("ValidPeriod(%q) = %v, want %v", period, got, want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+const (
+	// maxTrackedAbusers bounds detection tracking; new callers are not
+	// tracked while it is full of active entries
+	maxTrackedAbusers = 10000
+	// abuseSignatures is how many distinct recent signatures a flag lists
+	abuseSignatures = 5
+)
+
+// AbuseFlag is a caller that submitted ABUSE_THRESHOLD infected files within
+// ABUSE_WINDOW
+type AbuseFlag struct {
+	Caller       string     `json:"caller"`
+	Detections   int        `json:"detections"`
+	Signatures   []string   `json:"signatures,omitempty"`
+	FlaggedAt    time.Time  `json:"flaggedAt"`
+	BlockedUntil *time.Time `json:"blockedUntil,omitempty"`
+}
+
+type abuser struct {
+	detections   int
+	windowStart  time.Time
+	signatures   []string // newest first
+	flaggedAt    time.Time
+	blockedUntil time.Time
+}
+
+// abuseTracker counts infected submissions per caller, so a compromised
+// upstream spraying malware is noticed rather than just answered
+type abuseTracker struct {
+	mu            sync.Mutex
+	threshold     int
+	window        time.Duration
+	block         bool
+	blockDuration time.Duration
+	callers       map[string]*abuser
+}
+
+// newAbuseTracker returns a tracker for ABUSE_*, or nil when disabled
+func newAbuseTracker(cfg *config.Config) *abuseTracker {
+	if cfg.AbuseThreshold == 0 {
+		return nil
+	}
+	return &abuseTracker{
+		threshold:     cfg.AbuseThreshold,
+		window:        time.Duration(cfg.AbuseWindow) * time.Millisecond,
+		block:         cfg.AbuseAction == config.AbuseBlock,
+		blockDuration: time.Duration(cfg.AbuseBlockDuration) * time.Millisecond,
+		callers:       make(map[string]*abuser),
+	}
+}
+
+// record counts an infected submission and returns the caller's flag when it
+// reaches the threshold; a caller is flagged at most once per window.
+// Anonymous callers are never blocked, since without authentication that
+// would block everyone.
+func (t *abuseTracker) record(caller, signature string) *AbuseFlag {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.callers[caller]
+	if !ok {
+		if len(t.callers) >= maxTrackedAbusers {
+			t.prune(now)
+			if len(t.callers) >= maxTrackedAbusers {
+				return nil
+			}
+		}
+		a = &abuser{windowStart: now}
+		t.callers[caller] = a
+	}
+	if now.Sub(a.windowStart) > t.window {
+		a.detections = 0
+		a.windowStart = now
+	}
+	a.detections++
+	if signature != "" && !slices.Contains(a.signatures, signature) {
+		a.signatures = append([]string{signature}, a.signatures...)
+		if len(a.signatures) > abuseSignatures {
+			a.signatures = a.signatures[:abuseSignatures]
+		}
+	}
+	if a.detections != t.threshold {
+		return nil
+	}
+	a.flaggedAt = now
+	if t.block && caller != anonymousCaller {
+		a.blockedUntil = now.Add(t.blockDuration)
+	}
+	return a.flag(caller, now)
+}
+
+func (a *abuser) flag(caller string, now time.Time) *AbuseFlag {
+	flag := &AbuseFlag{
+		Caller:     caller,
+		Detections: a.detections,
+		Signatures: slices.Clone(a.signatures),
+		FlaggedAt:  a.flaggedAt,
+	}
+	if now.Before(a.blockedUntil) {
+		until := a.blockedUntil
+		flag.BlockedUntil = &until
+	}
+	return flag
+}
+
+// blocked returns how long caller's scans remain refused, or 0
+func (t *abuseTracker) blocked(caller string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.callers[caller]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(a.blockedUntil), 0)
+}
+
+// list returns callers flagged within the window or still blocked, most
+// recently flagged first
+func (t *abuseTracker) list() []AbuseFlag {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	flags := []AbuseFlag{}
+	for caller, a := range t.callers {
+		if !a.flaggedAt.IsZero() && (now.Sub(a.flaggedAt) <= t.window || now.Before(a.blockedUntil)) {
+			flags = append(flags, *a.flag(caller, now))
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].FlaggedAt.After(flags[j].FlaggedAt)
+	})
+	return flags
+}
+
+// clear forgets a caller's detections and lifts its block. It reports
+// whether the caller was flagged.
+func (t *abuseTracker) clear(caller string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.callers[caller]
+	if !ok {
+		return false
+	}
+	delete(t.callers, caller)
+	return !a.flaggedAt.IsZero()
+}
+
+// prune drops callers that are neither blocked nor within their window;
+// callers hold t.mu
+func (t *abuseTracker) prune(now time.Time) {
+	for caller, a := range t.callers {
+		if !now.Before(a.blockedUntil) && now.Sub(a.windowStart) > t.window {
+			delete(t.callers, caller)
+		}
+	}
+}
+
+// recordAbuse counts an infected upload against its caller and reports the
+// caller once it crosses ABUSE_THRESHOLD
+func (a *API) recordAbuse(u *upload, result *scanner.ScanResponse) {
+	flag := a.abuse.record(u.origin.Caller, result.Signature)
+	if flag == nil {
+		return
+	}
+	action := config.AbuseAlert
+	if flag.BlockedUntil != nil {
+		action = config.AbuseBlock
+	}
+	metrics.RecordAbuseFlag(flag.Caller, string(action))
+	a.logger.Warn("Caller flagged for repeated infected submissions",
+		"caller", flag.Caller,
+		"detections", flag.Detections,
+		"signatures", flag.Signatures,
+		"action", action,
+		"blockedUntil", flag.BlockedUntil,
+	)
+	if a.config.AbuseAlertURL != "" {
+		go a.sendAbuseAlert(flag, action)
+	}
+}
+
+// sendAbuseAlert posts a flag to ABUSE_ALERT_URL
+func (a *API) sendAbuseAlert(flag *AbuseFlag, action config.AbuseAction) {
+	body, _ := json.Marshal(struct {
+		*AbuseFlag
+		Action config.AbuseAction `json:"action"`
+	}{flag, action})
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(a.config.AbuseAlertURL, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("alert target returned %s", resp.Status)
+		}
+	}
+	if err != nil {
+		a.logger.Error("Failed to send abuse alert", "caller", flag.Caller, "error", err)
+	}
+}
+
+// rejectAbuser returns true (after writing a 429) if the caller is blocked
+// for abuse
+func (a *API) rejectAbuser(w http.ResponseWriter, r *http.Request) bool {
+	caller := callerName(r)
+	remaining := a.abuse.blocked(caller)
+	if remaining == 0 {
+		return false
+	}
+	metrics.RecordAbuseRefusal(caller)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+	a.jsonError(w, "too many infected submissions", http.StatusTooManyRequests)
+	return true
+}
+
+// handleListAbuse lists callers flagged for repeated infected submissions
+// (GET /api/v1/admin/abuse)
+func (a *API) handleListAbuse(w http.ResponseWriter, r *http.Request) {
+	if a.abuse == nil {
+		a.jsonError(w, "Abuse detection is disabled", http.StatusNotImplemented)
+		return
+	}
+	a.jsonResponse(w, map[string]interface{}{"callers": a.abuse.list()}, http.StatusOK)
+}
+
+// handleClearAbuse forgets a caller's detections and lifts its block early
+// (DELETE /api/v1/admin/abuse/cluster/team/uploader)
+func (a *API) handleClearAbuse(w http.ResponseWriter, r *http.Request) {
+	if a.abuse == nil {
+		a.jsonError(w, "Abuse detection is disabled", http.StatusNotImplemented)
+		return
+	}
+	caller := r.PathValue("caller")
+	if !a.abuse.clear(caller) {
+		a.jsonError(w, "Caller is not flagged: "+caller, http.StatusNotFound)
+		return
+	}
+
+	a.logger.Warn("Abuse flag cleared", "flaggedCaller", caller, "caller", callerName(r))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestAPI_AbuseDetection(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	alerts := make(chan map[string]interface{}, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]interface{}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &alert)
+		alerts <- alert
+	}))
+	defer target.Close()
+
+	api.config.AbuseThreshold = 2
+	api.config.AbuseWindow = 60000
+	api.config.AbuseAction = config.AbuseBlock
+	api.config.AbuseBlockDuration = 60000
+	api.config.AbuseAlertURL = target.URL
+	api.abuse = newAbuseTracker(api.config)
+
+	ctx := auth.WithCallerIdentity(context.Background(), &auth.CallerIdentity{
+		Cluster: "prod", Namespace: "uploads", ServiceAccount: "ingest",
+	})
+	scan := func(content string) *httptest.ResponseRecorder {
+		body, contentType := createMultipartFile(t, "file", "upload.bin", []byte(content))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body).WithContext(ctx)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.handleScan(rr, req)
+		return rr
+	}
+
+	if rr := scan(drivers.EICARPattern()); rr.Code != http.StatusOK {
+		t.Fatalf("scan failed: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := scan("clean"); rr.Code != http.StatusOK {
+		t.Fatalf("expected clean scans not to count, got %d", rr.Code)
+	}
+	if rr := scan(drivers.EICARPattern()); rr.Code != http.StatusOK {
+		t.Fatalf("expected the flagging scan itself to be answered, got %d", rr.Code)
+	}
+
+	select {
+	case alert := <-alerts:
+		if alert["caller"] != "prod/uploads/ingest" || alert["action"] != "block" || alert["detections"] != float64(2) {
+			t.Errorf("unexpected alert: %v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an alert to be posted")
+	}
+
+	rr := scan("clean")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a blocked caller to get 429 with Retry-After, got %d", rr.Code)
+	}
+	if err := api.grpcRejectAbuser(ctx); err == nil {
+		t.Error("expected gRPC scans to be refused too")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/abuse", nil)
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	var listed struct {
+		Callers []AbuseFlag `json:"callers"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &listed)
+	if len(listed.Callers) != 1 || listed.Callers[0].BlockedUntil == nil || len(listed.Callers[0].Signatures) != 1 {
+		t.Errorf("expected one blocked caller, got %s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/admin/abuse/prod/uploads/ingest", nil)
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected status 204 clearing the flag, got %d", rr.Code)
+	}
+	if rr := scan("clean"); rr.Code != http.StatusOK {
+		t.Errorf("expected scans to resume once cleared, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/abuse/prod/uploads/ingest", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unflagged caller, got %d", rr.Code)
+	}
+}
+
+func TestAbuseTracker(t *testing.T) {
+	tracker := newAbuseTracker(&config.Config{
+		AbuseThreshold: 2, AbuseWindow: 60000, AbuseAction: config.AbuseBlock, AbuseBlockDuration: 60000,
+	})
+
+	// Anonymous callers are flagged but never blocked
+	tracker.record(anonymousCaller, "Sig-A")
+	if flag := tracker.record(anonymousCaller, "Sig-B"); flag == nil || flag.BlockedUntil != nil {
+		t.Errorf("expected an unblocked flag for anonymous callers, got %+v", flag)
+	}
+	if tracker.blocked(anonymousCaller) != 0 {
+		t.Error("expected anonymous callers not to be blocked")
+	}
+	// Flagged once per window
+	if flag := tracker.record(anonymousCaller, "Sig-C"); flag != nil {
+		t.Errorf("expected no second flag within the window, got %+v", flag)
+	}
+
+	if newAbuseTracker(&config.Config{}) != nil {
+		t.Error("expected no tracker with ABUSE_THRESHOLD=0")
+	}
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/version"
+)
+
+// defaultRetryAfter is the Retry-After hint (seconds) when maintenance mode
+// is enabled without one
+const defaultRetryAfter = 60
+
+// maintenance pauses scan intake, e.g. during signature updates or engine
+// restarts. Health endpoints keep working; readiness reports not ready.
+type maintenance struct {
+	mu         sync.RWMutex
+	enabled    bool
+	reason     string
+	retryAfter int
+	since      time.Time
+}
+
+type maintenanceStatus struct {
+	Enabled    bool       `json:"enabled"`
+	Reason     string     `json:"reason,omitempty"`
+	RetryAfter int        `json:"retryAfter,omitempty"` // seconds
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+func (m *maintenance) status() maintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.enabled {
+		return maintenanceStatus{}
+	}
+	since := m.since
+	return maintenanceStatus{
+		Enabled:    true,
+		Reason:     m.reason,
+		RetryAfter: m.retryAfter,
+		Since:      &since,
+	}
+}
+
+// message is the error returned to scans refused while enabled
+func (s maintenanceStatus) message() string {
+	if s.Reason != "" {
+		return "Service is in maintenance mode: " + s.Reason
+	}
+	return "Service is in maintenance mode"
+}
+
+func (m *maintenance) set(enabled bool, reason string, retryAfter int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if enabled && !m.enabled {
+		m.since = time.Now()
+	}
+	m.enabled = enabled
+	m.reason = reason
+	m.retryAfter = retryAfter
+}
+
+// requireAdmin restricts a handler to admins listed in the allowlist. Without
+// authentication every caller is trusted, as for the other endpoints.
+func (a *API) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.isAdmin(r) {
+			a.jsonError(w, "forbidden: admin access required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether the caller may use admin endpoints
+func (a *API) isAdmin(r *http.Request) bool {
+	if a.authMiddleware == nil {
+		return true
+	}
+	identity := auth.GetCallerIdentity(r.Context())
+	return identity != nil && a.allowlist.IsAdmin(identity.Cluster, identity.Namespace, identity.ServiceAccount)
+}
+
+// rejectDuringMaintenance returns true (after writing a 503) if scans are paused
+func (a *API) rejectDuringMaintenance(w http.ResponseWriter) bool {
+	status := a.maintenance.status()
+	if !status.Enabled {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(status.RetryAfter))
+	a.jsonError(w, status.message(), http.StatusServiceUnavailable)
+	return true
+}
+
+// Paused returns why scan intake is paused, or nil, for the listeners that
+// share the scanner but not the API's handlers (ICAP and clamd)
+func (a *API) Paused() error {
+	if status := a.maintenance.status(); status.Enabled {
+		return errors.New(status.message())
+	}
+	return nil
+}
+
+func (a *API) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	a.jsonResponse(w, a.maintenance.status(), http.StatusOK)
+}
+
+func (a *API) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled    bool   `json:"enabled"`
+		Reason     string `json:"reason"`
+		RetryAfter int    `json:"retryAfter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RetryAfter < 0 {
+		a.jsonError(w, "retryAfter must not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.RetryAfter == 0 {
+		req.RetryAfter = defaultRetryAfter
+	}
+
+	a.maintenance.set(req.Enabled, req.Reason, req.RetryAfter)
+
+	a.logger.Warn("Maintenance mode changed",
+		"enabled", req.Enabled,
+		"reason", req.Reason,
+		"retryAfter", req.RetryAfter,
+		"caller", callerName(r),
+	)
+
+	a.jsonResponse(w, a.maintenance.status(), http.StatusOK)
+}
+
+func (a *API) handleListCache(w http.ResponseWriter, r *http.Request) {
+	detectionCache := a.scanner.DetectionCache()
+	ttl := detectionCache.TTL()
+	now := time.Now()
+
+	detections := detectionCache.List()
+	entries := make([]map[string]interface{}, 0, len(detections))
+	for _, d := range detections {
+		age := now.Sub(d.Timestamp)
+		entry := map[string]interface{}{
+			"path":      d.FilePath,
+			"status":    d.Status,
+			"timestamp": d.Timestamp,
+			"age":       age.Milliseconds(),
+			"expiresIn": max(ttl-age, 0).Milliseconds(),
+		}
+		if d.Signature != "" {
+			entry["signature"] = d.Signature
+		}
+		if d.Raw != "" {
+			entry["logEntry"] = d.Raw
+		}
+		entries = append(entries, entry)
+	}
+
+	a.jsonResponse(w, map[string]interface{}{
+		"count":   len(entries),
+		"ttl":     ttl.Milliseconds(),
+		"entries": entries,
+	}, http.StatusOK)
+}
+
+// handleDeleteCache removes the detection for an absolute path, given without
+// its leading slash (DELETE /api/v1/admin/cache/tmp/av-scanner/file.txt)
+func (a *API) handleDeleteCache(w http.ResponseWriter, r *http.Request) {
+	path := filepath.Clean("/" + r.PathValue("path"))
+
+	if !a.scanner.DetectionCache().Delete(path) {
+		a.jsonError(w, "No cached detection for "+path, http.StatusNotFound)
+		return
+	}
+
+	a.logger.Warn("Cached detection removed", "path", path, "caller", callerName(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDefinitionsUpdated is called by signature update tooling once new
+// definitions are in place. The body is optional.
+func (a *API) handleDefinitionsUpdated(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.logger.Warn("Definitions update received", "version", req.Version, "caller", callerName(r))
+
+	a.jsonResponse(w, a.scanner.DefinitionsUpdated(req.Version), http.StatusOK)
+}
+
+// handleCapacity reports scan load in a flat schema that autoscalers such as
+// the KEDA metrics-api scaler can read directly (e.g. valueLocation: inFlight)
+func (a *API) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	a.jsonResponse(w, a.scanner.Capacity(), http.StatusOK)
+}
+
+// handleConfig reports the configuration the instance is running with,
+// secrets redacted, so support can check what it actually loaded. The active
+// engine is the current one, which may have been switched since startup.
+func (a *API) handleConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := a.config.Redacted()
+	cfg.ActiveEngine = a.scanner.ActiveEngine()
+	a.jsonResponse(w, map[string]interface{}{
+		"version": version.Version,
+		"config":  cfg,
+	}, http.StatusOK)
+}
+
+// authBans returns the auth failure ban tracker, or nil if auth or bans are
+// disabled
+func (a *API) authBans() *auth.Bans {
+	if a.authMiddleware == nil {
+		return nil
+	}
+	return a.authMiddleware.Bans()
+}
+
+func (a *API) handleListBans(w http.ResponseWriter, r *http.Request) {
+	bans := a.authBans()
+	if bans == nil {
+		a.jsonError(w, "Auth failure bans are disabled", http.StatusNotImplemented)
+		return
+	}
+	a.jsonResponse(w, map[string]interface{}{"bans": bans.List()}, http.StatusOK)
+}
+
+// handleClearBan lifts a ban early (DELETE /api/v1/admin/auth/bans/10.0.0.7)
+func (a *API) handleClearBan(w http.ResponseWriter, r *http.Request) {
+	bans := a.authBans()
+	if bans == nil {
+		a.jsonError(w, "Auth failure bans are disabled", http.StatusNotImplemented)
+		return
+	}
+	source := r.PathValue("source")
+	if !bans.Clear(source) {
+		a.jsonError(w, "No active ban for "+source, http.StatusNotFound)
+		return
+	}
+
+	a.logger.Warn("Auth failure ban cleared", "source", source, "caller", callerName(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// anonymousCaller names every caller when authentication is disabled
+const anonymousCaller = "anonymous"
+
+// callerName identifies the authenticated caller for audit logs
+func callerName(r *http.Request) string {
+	return contextCallerName(r.Context())
+}
+
+// contextCallerName is callerName for front ends without an *http.Request
+func contextCallerName(ctx context.Context) string {
+	if identity := auth.GetCallerIdentity(ctx); identity != nil {
+		return identity.Cluster + "/" + identity.Namespace + "/" + identity.ServiceAccount
+	}
+	return anonymousCaller
+}
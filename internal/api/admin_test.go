@@ -0,0 +1,282 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func setMaintenance(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/maintenance", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPI_Maintenance(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	handler := api.Routes()
+
+	rr := setMaintenance(t, handler, `{"enabled": true, "reason": "signature update", "retryAfter": 120}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Scans are rejected with Retry-After
+	body, contentType := createMultipartFile(t, "file", "clean.txt", []byte("clean"))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 for scan, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "120" {
+		t.Errorf("expected Retry-After 120, got %q", rr.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rr.Body.String(), "signature update") {
+		t.Errorf("expected reason in error, got %s", rr.Body.String())
+	}
+
+	// Readiness reflects maintenance; liveness and health keep working
+	for path, expected := range map[string]int{
+		"/api/v1/ready":  http.StatusServiceUnavailable,
+		"/api/v1/live":   http.StatusOK,
+		"/api/v1/health": http.StatusOK,
+	} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/maintenance", nil))
+	var status maintenanceStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if !status.Enabled || status.Reason != "signature update" || status.Since == nil {
+		t.Errorf("unexpected maintenance status: %+v", status)
+	}
+
+	// Disabling resumes scans
+	setMaintenance(t, handler, `{"enabled": false}`)
+	body, contentType = createMultipartFile(t, "file", "clean.txt", []byte("clean"))
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 after maintenance, got %d", rr.Code)
+	}
+}
+
+func TestAPI_Maintenance_DefaultRetryAfter(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	rr := setMaintenance(t, api.Routes(), `{"enabled": true}`)
+	var status maintenanceStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if status.RetryAfter != defaultRetryAfter {
+		t.Errorf("expected retryAfter %d, got %d", defaultRetryAfter, status.RetryAfter)
+	}
+}
+
+func TestAPI_Maintenance_InvalidBody(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	for _, body := range []string{`not json`, `{"enabled": true, "retryAfter": -1}`} {
+		if rr := setMaintenance(t, api.Routes(), body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestAPI_AdminCache(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	handler := api.Routes()
+
+	detectionCache := api.scanner.DetectionCache()
+	detectionCache.Add("/tmp/av-scanner/a.txt", &cache.Detection{Status: "infected", Signature: "Virus-A", Raw: "log line"})
+	detectionCache.Add("/tmp/av-scanner/b.txt", &cache.Detection{Status: "clean"})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var resp struct {
+		Count   int                      `json:"count"`
+		Entries []map[string]interface{} `json:"entries"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Count != 2 || resp.Entries[0]["path"] != "/tmp/av-scanner/a.txt" || resp.Entries[0]["signature"] != "Virus-A" {
+		t.Errorf("unexpected cache listing: %s", rr.Body.String())
+	}
+	if _, ok := resp.Entries[0]["age"]; !ok {
+		t.Error("expected entry age")
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/cache/tmp/av-scanner/a.txt", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, found := detectionCache.Peek("/tmp/av-scanner/a.txt"); found {
+		t.Error("expected entry to be deleted")
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/cache/tmp/av-scanner/a.txt", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for missing entry, got %d", rr.Code)
+	}
+}
+
+func TestAPI_DefinitionsUpdated(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	handler := api.Routes()
+
+	api.scanner.DetectionCache().Add("/tmp/av-scanner/a.txt", &cache.Detection{Status: "infected"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/definitions", strings.NewReader(`{"version":"27412"}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var update scanner.DefinitionsUpdate
+	if err := json.Unmarshal(rr.Body.Bytes(), &update); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if update.Version != "27412" || update.CacheCleared != 1 || !update.EngineHealthy {
+		t.Errorf("unexpected update: %+v", update)
+	}
+	if update.SelfTest == nil || !update.SelfTest.Passed {
+		t.Errorf("expected self-test to pass, got %+v", update.SelfTest)
+	}
+
+	// Health reports the latest update
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+	var health struct {
+		Definitions *scanner.DefinitionsUpdate `json:"definitions"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("failed to parse health: %v", err)
+	}
+	if health.Definitions == nil || health.Definitions.Version != "27412" {
+		t.Errorf("expected definitions in health, got %+v", health.Definitions)
+	}
+
+	// The body is optional
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/admin/definitions", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 without body, got %d", rr.Code)
+	}
+}
+
+func TestAPI_Capacity(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	handler := api.Routes()
+
+	for i := 0; i < 3; i++ {
+		body, contentType := createMultipartFile(t, "file", "clean.txt", []byte("clean"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/capacity", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var capacity scanner.Capacity
+	if err := json.Unmarshal(rr.Body.Bytes(), &capacity); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if capacity.Scans != 3 || capacity.InFlight != 0 || capacity.Queued != 0 || capacity.WindowSeconds != 300 {
+		t.Errorf("unexpected capacity: %+v", capacity)
+	}
+}
+
+func TestAPI_Config(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.AbuseAlertURL = "https://hooks.example.com/services/T000/B000/XXXX"
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/config", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "XXXX") {
+		t.Errorf("expected the webhook secret to be redacted: %s", rr.Body.String())
+	}
+
+	var resp struct {
+		Config config.Config `json:"config"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Config.UploadDir != tmpDir || resp.Config.ActiveEngine != config.EngineMock || resp.Config.AbuseAlertURL != "https://hooks.example.com/REDACTED" {
+		t.Errorf("unexpected config: %+v", resp.Config)
+	}
+	if api.config.AbuseAlertURL != "https://hooks.example.com/services/T000/B000/XXXX" {
+		t.Error("expected the running configuration to be unchanged")
+	}
+}
+
+func TestAPI_AdminPort(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.AdminPort = 9090
+
+	scanRoutes := api.Routes()
+	adminRoutes := api.AdminRoutes()
+
+	for _, path := range []string{"/api/v1/admin/maintenance", "/metrics"} {
+		rr := httptest.NewRecorder()
+		scanRoutes.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s on scan listener: expected status 404, got %d", path, rr.Code)
+		}
+
+		rr = httptest.NewRecorder()
+		adminRoutes.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s on admin listener: expected status 200, got %d", path, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	adminRoutes.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("health on admin listener: expected status 404, got %d", rr.Code)
+	}
+}
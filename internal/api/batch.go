@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// Batch verdicts. A batch is clean when every member may be released. With
+// atomic=true a single rejected member blocks the whole batch; otherwise
+// the batch is partial and only the rejected members are withheld.
+const (
+	batchClean   = "clean"
+	batchPartial = "partial"
+	batchBlocked = "blocked"
+)
+
+// handleScanBatch scans several files from one multipart upload under the
+// same options and tags (POST /api/v1/scan/batch). Each file part sent
+// under an UPLOAD_FIELD_NAMES field is a member. atomic=true gives all-or-nothing semantics for bundles that must
+// be accepted as a whole.
+func (a *API) handleScanBatch(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+	if a.config.ScanBatchMaxFiles == 0 {
+		a.jsonError(w, "Batch scans are disabled", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	tags, err := parseScanTags(query["tag"], a.config.ScanTagKeys)
+	if err != nil {
+		a.jsonError(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	engines, err := a.scanEngines(r.Context(), query["engine"])
+	if err != nil {
+		a.jsonError(w, err.Error(), engineErrorStatus(err))
+		return
+	}
+	profile, err := a.scanProfile(r)
+	if err != nil {
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		a.jsonError(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	uploads, ok := a.receiveBatch(w, r, mr, tags, engines, profile)
+	if !ok {
+		return
+	}
+	a.scanBatch(w, uploads, query.Get("atomic") == "true", acceptsNDJSON(r.Header.Get("Accept")))
+}
+
+// receiveBatch saves every file part to the upload directory. On failure
+// it removes the files saved so far, writes the error response and returns
+// false.
+func (a *API) receiveBatch(w http.ResponseWriter, r *http.Request, mr *multipart.Reader, tags map[string]string, engines []config.EngineType, profile config.ScanProfile) ([]*upload, bool) {
+	var uploads []*upload
+	fail := func(message string, status int) ([]*upload, bool) {
+		a.discardUploads(uploads)
+		a.jsonError(w, message, status)
+		return nil, false
+	}
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail("Invalid multipart body", http.StatusBadRequest)
+		}
+		if !slices.Contains(a.uploadFieldNames(), part.FormName()) || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		if len(uploads) == a.config.ScanBatchMaxFiles {
+			part.Close()
+			return fail(fmt.Sprintf("Too many files: at most %d per batch", a.config.ScanBatchMaxFiles), http.StatusBadRequest)
+		}
+
+		u, err := a.saveUpload(&limitedReader{r: part, n: a.profileMaxSize(profile)}, part.FileName(), a.requestOrigin(r), tags, scanner.ScanOptions{
+			MimeType: part.Header.Get("Content-Type"),
+			DryRun:   dryRun,
+			Engines:  engines,
+			Profile:  profile,
+			Trace:    requestTrace(r),
+		})
+		part.Close()
+		if err == nil {
+			u.noCache = noCacheRequested(r)
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fail(a.tooLargeMessage(profile, tooLarge.Limit)+": "+part.FileName(), http.StatusRequestEntityTooLarge)
+		}
+		if err != nil {
+			return fail("Failed to save uploaded file", http.StatusInternalServerError)
+		}
+		uploads = append(uploads, u)
+	}
+
+	if len(uploads) == 0 {
+		return fail("No files provided. Please upload files using the 'file' field", http.StatusBadRequest)
+	}
+	return uploads, true
+}
+
+// scanBatch scans each member in upload order and writes the batch verdict.
+// When streaming, each member is written as an NDJSON line as soon as it is
+// scanned and the verdict follows as a final summary line.
+func (a *API) scanBatch(w http.ResponseWriter, uploads []*upload, atomic, stream bool) {
+	var largest int64
+	caller := ""
+	for _, u := range uploads {
+		largest = max(largest, u.size)
+		caller = u.origin.Caller
+	}
+
+	var enc *json.Encoder
+	if stream {
+		a.setLimitWarnings(w, caller, largest)
+		w.Header().Set("Content-Type", contentTypeNDJSON)
+		w.WriteHeader(http.StatusOK)
+		flush(w)
+		enc = json.NewEncoder(w)
+	}
+
+	catalog := catalogFor(w)
+	files := make([]map[string]interface{}, 0, len(uploads))
+	rejected := 0
+	for i, u := range uploads {
+		result, err := a.scanUpload(u)
+		var throttled *scanner.ThrottledError
+		if errors.As(err, &throttled) {
+			a.discardUploads(uploads[i+1:])
+			if stream {
+				// Too late for a status code; earlier lines stay valid
+				enc.Encode(map[string]interface{}{"type": "error", "error": err.Error()})
+				return
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			a.jsonError(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		a.finishScan(u, result, err)
+
+		var member map[string]interface{}
+		if err != nil {
+			message := "Scan failed: " + err.Error()
+			member = map[string]interface{}{
+				"fileId":   u.fileID,
+				"fileName": u.fileName,
+				"status":   drivers.StatusError,
+				"error":    message,
+			}
+			addErrorCategory(member, err)
+			addErrorMessage(catalog, member, message)
+		} else {
+			member = scanResultJSON(u.fileName, result)
+			addVerdictMessage(catalog, member, result.Status)
+		}
+		// Scan errors are withheld: an unscanned file cannot be vouched for
+		released := err == nil && (result.Status == drivers.StatusClean || result.Status == drivers.StatusSkipped)
+		if !released {
+			rejected++
+		}
+		member["released"] = released
+		files = append(files, member)
+
+		// Release is only final once the whole atomic batch is scanned
+		if stream {
+			line := map[string]interface{}{"type": "result"}
+			for k, v := range member {
+				line[k] = v
+			}
+			if atomic {
+				delete(line, "released")
+			}
+			enc.Encode(line)
+			flush(w)
+		}
+	}
+
+	status := batchClean
+	switch {
+	case rejected > 0 && atomic:
+		status = batchBlocked
+		for _, member := range files {
+			member["released"] = false
+		}
+	case rejected > 0:
+		status = batchPartial
+	}
+
+	a.logger.Info("Batch scan completed",
+		"files", len(files),
+		"rejected", rejected,
+		"atomic", atomic,
+		"status", status,
+	)
+	if stream {
+		released := []string{}
+		for _, member := range files {
+			if member["released"] == true {
+				released = append(released, member["fileId"].(string))
+			}
+		}
+		enc.Encode(map[string]interface{}{
+			"type":     "summary",
+			"status":   status,
+			"atomic":   atomic,
+			"files":    len(files),
+			"released": released,
+		})
+		return
+	}
+	a.setLimitWarnings(w, caller, largest)
+	a.jsonResponse(w, map[string]interface{}{
+		"status": status,
+		"atomic": atomic,
+		"files":  files,
+	}, http.StatusOK)
+}
+
+// acceptsNDJSON reports whether the client asked for streamed NDJSON
+// results
+func acceptsNDJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && (mediaType == contentTypeNDJSON || mediaType == "application/ndjson") {
+			return true
+		}
+	}
+	return false
+}
+
+// flush sends buffered response data to the client
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// discardUploads removes uploads that will not be scanned
+func (a *API) discardUploads(uploads []*upload) {
+	for _, u := range uploads {
+		if err := a.scanner.DiscardUpload(u.path, u.fileID); err != nil {
+			a.logger.Warn("Failed to remove upload", "fileId", u.fileID, "error", err)
+		}
+	}
+}
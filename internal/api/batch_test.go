@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+type batchResponse struct {
+	Status string `json:"status"`
+	Atomic bool   `json:"atomic"`
+	Files  []struct {
+		FileName string `json:"fileName"`
+		Status   string `json:"status"`
+		Released bool   `json:"released"`
+	} `json:"files"`
+}
+
+func postBatch(t *testing.T, api *API, query string, files map[string]string) (*httptest.ResponseRecorder, batchResponse) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, name := range []string{"a.txt", "eicar.com", "b.txt"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("failed to create form file: %v", err)
+		}
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan/batch"+query, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	var resp batchResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+	}
+	return rr, resp
+}
+
+func TestAPI_HandleScanBatch(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanBatchMaxFiles = 5
+
+	files := map[string]string{"a.txt": "hello", "eicar.com": drivers.EICARPattern(), "b.txt": "world"}
+	rr, resp := postBatch(t, api, "", files)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if resp.Status != batchPartial || len(resp.Files) != 3 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if !resp.Files[0].Released || resp.Files[1].Released || resp.Files[1].Status != "infected" || !resp.Files[2].Released {
+		t.Errorf("unexpected members: %+v", resp.Files)
+	}
+
+	// All or nothing: clean members are withheld too
+	_, resp = postBatch(t, api, "?atomic=true", files)
+	if resp.Status != batchBlocked || !resp.Atomic {
+		t.Fatalf("expected blocked batch, got %+v", resp)
+	}
+	for _, f := range resp.Files {
+		if f.Released {
+			t.Errorf("expected %s to be withheld", f.FileName)
+		}
+	}
+
+	_, resp = postBatch(t, api, "?atomic=true", map[string]string{"a.txt": "hello", "b.txt": "world"})
+	if resp.Status != batchClean || !resp.Files[0].Released || !resp.Files[1].Released {
+		t.Errorf("expected clean batch, got %+v", resp)
+	}
+}
+
+func TestAPI_HandleScanBatch_Limits(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{"a.txt": "hello", "b.txt": "world"}
+	if rr, _ := postBatch(t, api, "", files); rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 when disabled, got %d", rr.Code)
+	}
+
+	api.config.ScanBatchMaxFiles = 1
+	if rr, _ := postBatch(t, api, "", files); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too many files, got %d", rr.Code)
+	}
+
+	api.config.ScanBatchMaxFiles = 5
+	api.config.MaxFileSize = 4
+	if rr, _ := postBatch(t, api, "", files); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rr.Code)
+	}
+
+	// Rejected batches leave nothing behind
+	entries, _ := os.ReadDir(tmpDir)
+	for _, e := range entries {
+		if !e.IsDir() {
+			t.Errorf("unexpected upload left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestAPI_HandleScanBatch_NDJSON(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanBatchMaxFiles = 5
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range map[string]string{"a.txt": "hello", "eicar.com": drivers.EICARPattern()} {
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+	}
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan/batch?atomic=true", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != contentTypeNDJSON {
+		t.Fatalf("unexpected response %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected two results and a summary, got %q", lines)
+	}
+	for _, raw := range lines[:2] {
+		var result map[string]interface{}
+		json.Unmarshal([]byte(raw), &result)
+		if _, ok := result["released"]; result["type"] != "result" || ok {
+			t.Errorf("unexpected result line: %s", raw)
+		}
+	}
+	var summary map[string]interface{}
+	json.Unmarshal([]byte(lines[2]), &summary)
+	if summary["type"] != "summary" || summary["status"] != batchBlocked || len(summary["released"].([]interface{})) != 0 {
+		t.Errorf("unexpected summary: %s", lines[2])
+	}
+}
+
+func TestAPI_HandleScanBatch_UploadFieldNames(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanBatchMaxFiles = 5
+	api.config.UploadFieldNames = []string{"file", "files[]"}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, field := range []string{"file", "files[]", "ignored"} {
+		part, _ := writer.CreateFormFile(field, field+".txt")
+		part.Write([]byte("clean"))
+	}
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan/batch", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	var resp batchResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || len(resp.Files) != 2 {
+		t.Errorf("expected the file and files[] parts as members, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/inspect"
+	"github.com/rophy/av-scanner/internal/policy"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// blocklistRule names the policy decision of blocklisted uploads
+const blocklistRule = "blocklist"
+
+// newBlocklist builds the BLOCKED_EXTENSIONS and BLOCKED_MIME_TYPES rules, or
+// returns nil when both are empty. MIME types are matched against the type
+// sniffed from the content, so renaming a file does not get it past them.
+func newBlocklist(cfg *config.Config) (*policy.Policy, error) {
+	var rules []policy.Rule
+	if len(cfg.BlockedExtensions) > 0 {
+		rules = append(rules, policy.Rule{Name: blocklistRule, Extensions: cfg.BlockedExtensions, Action: policy.ActionBlock})
+	}
+	if len(cfg.BlockedMimeTypes) > 0 {
+		rules = append(rules, policy.Rule{Name: blocklistRule, FileTypes: cfg.BlockedMimeTypes, Action: policy.ActionBlock})
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return policy.New(rules)
+}
+
+// blocklisted returns the blocked verdict for an upload the blocklist
+// rejects, or nil. It runs before the upload reaches the scanner, so
+// blocklisted files take no engine capacity.
+func (a *API) blocklisted(u *upload) *scanner.ScanResponse {
+	if a.blocklist == nil {
+		return nil
+	}
+
+	var fileType inspect.FileType
+	if u.data != nil {
+		fileType = inspect.DetectTypeBytes(u.data)
+	} else {
+		var err error
+		if fileType, err = inspect.DetectType(u.path); err != nil {
+			a.logger.Warn("Failed to detect file type", "fileId", u.fileID, "error", err)
+		}
+	}
+
+	decision := a.blocklist.Evaluate(u.fileName, "", u.size, fileType)
+	if decision.Action != policy.ActionBlock {
+		return nil
+	}
+	a.logger.Info("Upload blocklisted", "fileId", u.fileID, "fileName", u.fileName, "mimeType", fileType.MimeType)
+	result := &scanner.ScanResponse{
+		FileID: u.fileID,
+		Status: drivers.StatusBlocked,
+		Engine: a.scanner.ActiveEngine(),
+		Policy: &decision,
+	}
+	if fileType.MimeType != "" {
+		result.FileType = &fileType
+	}
+	if u.options.DryRun {
+		result.DryRun = &scanner.DryRunResult{Action: policy.ActionBlock}
+		health, err := a.scanner.GetActiveEngineHealth()
+		switch {
+		case err != nil:
+			result.DryRun.EngineError = err.Error()
+		case health != nil:
+			result.DryRun.EngineHealthy = health.Healthy
+			result.DryRun.EngineError = health.Error
+		}
+	}
+	return result
+}
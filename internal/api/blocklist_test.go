@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func TestAPI_HandleScan_Blocklist(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.BlockedExtensions = []string{".exe", "vbs"}
+	api.config.BlockedMimeTypes = []string{"application/x-executable"}
+	blocklist, err := newBlocklist(api.config)
+	if err != nil {
+		t.Fatalf("failed to create blocklist: %v", err)
+	}
+	api.blocklist = blocklist
+
+	tests := []struct {
+		fileName string
+		content  string
+		status   drivers.ScanStatus
+	}{
+		// EICAR content proves the engine was not invoked
+		{"setup.EXE", drivers.EICARPattern(), drivers.StatusBlocked},
+		{"macro.vbs", drivers.EICARPattern(), drivers.StatusBlocked},
+		// Blocked by the sniffed type whatever its name
+		{"notes.txt", "\x7fELF\x02\x01\x01\x00", drivers.StatusBlocked},
+		{"notes.txt", "hello world", drivers.StatusClean},
+	}
+	for _, tt := range tests {
+		body, contentType := createMultipartFile(t, "file", tt.fileName, []byte(tt.content))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.fileName, rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Status drivers.ScanStatus `json:"status"`
+			Policy *struct {
+				Action string `json:"action"`
+				Rule   string `json:"rule"`
+			} `json:"policy"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.Status != tt.status {
+			t.Errorf("%s: expected status %s, got %s", tt.fileName, tt.status, resp.Status)
+		}
+		if tt.status == drivers.StatusBlocked && (resp.Policy == nil || resp.Policy.Rule != blocklistRule) {
+			t.Errorf("%s: expected blocklist policy, got %s", tt.fileName, rr.Body.String())
+		}
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 0 {
+		t.Errorf("expected blocked uploads to be removed, found %d files", len(entries))
+	}
+}
+
+func TestAPI_HandleScanAsync_Blocklist(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.AsyncWorkers = 1
+	api.config.AsyncQueueSize = 10
+	api.config.BlockedExtensions = []string{".js"}
+	api.scanner = scanner.New(api.config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer api.scanner.Stop()
+	blocklist, err := newBlocklist(api.config)
+	if err != nil {
+		t.Fatalf("failed to create blocklist: %v", err)
+	}
+	api.blocklist = blocklist
+
+	body, contentType := createMultipartFile(t, "file", "payload.js", []byte("alert(1)"))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan/async", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The verdict is known without queueing a scan
+	var accepted scanner.Job
+	json.Unmarshal(rr.Body.Bytes(), &accepted)
+	job, ok := api.scanner.GetJob(accepted.ID)
+	if !ok || job.Status != scanner.JobCompleted || job.Result.Status != drivers.StatusBlocked {
+		t.Errorf("expected completed blocked job, got %+v", job)
+	}
+}
+
+func TestNewBlocklist_Empty(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	blocklist, err := newBlocklist(api.config)
+	if err != nil || blocklist != nil {
+		t.Errorf("expected no blocklist without configuration, got %v, %v", blocklist, err)
+	}
+}
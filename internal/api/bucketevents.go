@@ -0,0 +1,48 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/rophy/av-scanner/internal/bucketscan"
+)
+
+// SetBucketScan enables the S3 event notification webhook; nil disables it
+func (a *API) SetBucketScan(w *bucketscan.Worker) {
+	a.bucketScan = w
+}
+
+// handleBucketEvents queues the objects announced by an S3 event
+// notification, e.g. from a MinIO webhook target (POST /api/v1/bucket-events).
+// It authenticates with BUCKET_SCAN_WEBHOOK_TOKEN_FILE rather than caller
+// tokens, and answers before the objects are scanned.
+func (a *API) handleBucketEvents(w http.ResponseWriter, r *http.Request) {
+	if a.bucketScan == nil || a.config.BucketScanWebhookTokenFile == "" {
+		a.jsonError(w, "Bucket event webhook is disabled", http.StatusNotImplemented)
+		return
+	}
+	if !a.bucketScan.Authorized(r.Header.Get("Authorization")) {
+		a.jsonError(w, "Invalid webhook token", http.StatusUnauthorized)
+		return
+	}
+	if a.rejectDuringMaintenance(w) {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*1024))
+	if err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := bucketscan.ParseNotification(body)
+	if err != nil {
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) > 0 && !a.bucketScan.Enqueue(events) {
+		// The sender retries
+		a.jsonError(w, "Bucket scan queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	a.jsonResponse(w, map[string]int{"queued": len(events)}, http.StatusAccepted)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/bucketscan"
+)
+
+func TestAPI_HandleBucketEvents(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	post := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/bucket-events", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+	notification := `{"Records":[{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"uploads"},"object":{"key":"a.txt"}}}]}`
+
+	if rr := post("s3cret", notification); rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501 while disabled, got %d", rr.Code)
+	}
+
+	credentials := filepath.Join(tmpDir, "credentials")
+	os.WriteFile(credentials, []byte("[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n"), 0600)
+	token := filepath.Join(tmpDir, "token")
+	os.WriteFile(token, []byte("s3cret"), 0600)
+	api.config.ObjectStoreEndpoints = []string{"http://minio.invalid:9000"}
+	api.config.ObjectStoreCredentialsFile = credentials
+	api.config.BucketScanWebhookTokenFile = token
+	api.config.BucketScanWorkers = 1
+	worker, err := bucketscan.New(api.config, api.scanner, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("bucketscan.New failed: %v", err)
+	}
+	// The worker is not started, so events stay queued
+	api.SetBucketScan(worker)
+
+	for _, tc := range []struct {
+		token, body string
+		want        int
+	}{
+		{"", notification, http.StatusUnauthorized},
+		{"wrong", notification, http.StatusUnauthorized},
+		{"s3cret", "not json", http.StatusBadRequest},
+		{"s3cret", notification, http.StatusAccepted},
+	} {
+		if rr := post(tc.token, tc.body); rr.Code != tc.want {
+			t.Errorf("token %q, body %.20q: expected status %d, got %d: %s", tc.token, tc.body, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+}
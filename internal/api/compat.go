@@ -0,0 +1,266 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// registerCompatRoutes serves the COMPAT_APIS other scanning services' APIs,
+// so their client libraries can be pointed at this service while migrating.
+// Scans run through the same pipeline as /api/v1/scan.
+func (a *API) registerCompatRoutes(mux *http.ServeMux) {
+	if slices.Contains(a.config.CompatAPIs, config.CompatClamAVRest) {
+		mux.HandleFunc("POST /scan", a.withCompatErrors(clamavRestError, a.handleClamAVRestScan))
+	}
+	if slices.Contains(a.config.CompatAPIs, config.CompatVirusTotal) {
+		mux.HandleFunc("POST /api/v3/files", a.withCompatErrors(virusTotalError, a.handleVirusTotalUpload))
+		mux.HandleFunc("GET /api/v3/analyses/{id}", a.withCompatErrors(virusTotalError, a.handleVirusTotalAnalysis))
+	}
+}
+
+// handleClamAVRestScan answers POST /scan as clamav-rest does: 200 with
+// {"Status": "OK"} for a clean file, 406 with {"Status": "FOUND"} and the
+// signature in Description otherwise
+func (a *API) handleClamAVRestScan(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+
+	u, ok := a.receiveUpload(w, r)
+	if !ok {
+		return
+	}
+	result, err := a.scanUpload(u)
+	var throttled *scanner.ThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		a.jsonError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	a.finishScan(u, result, err)
+	if err != nil {
+		a.scanFailed(w, err)
+		return
+	}
+
+	switch result.Status {
+	case drivers.StatusClean, drivers.StatusSkipped:
+		a.jsonResponse(w, map[string]string{"Status": "OK", "Description": ""}, http.StatusOK)
+	default:
+		a.jsonResponse(w, map[string]string{"Status": "FOUND", "Description": verdictDescription(result)}, http.StatusNotAcceptable)
+	}
+}
+
+func clamavRestError(message string, status int) interface{} {
+	return map[string]string{"Status": "ERROR", "Description": message}
+}
+
+// handleVirusTotalUpload answers POST /api/v3/files as VirusTotal does,
+// queueing the upload and returning the analysis to poll. It needs the
+// background scan workers (ASYNC_WORKERS).
+func (a *API) handleVirusTotalUpload(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+
+	u, ok := a.receiveUpload(w, r)
+	if !ok {
+		return
+	}
+	job, ok := a.submitUpload(w, u)
+	if !ok {
+		return
+	}
+
+	a.jsonResponse(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":  "analysis",
+			"id":    job.ID,
+			"links": map[string]string{"self": "/api/v3/analyses/" + job.ID},
+		},
+	}, http.StatusOK)
+}
+
+// handleVirusTotalAnalysis answers GET /api/v3/analyses/{id} with the scan
+// job as a VirusTotal analysis object
+func (a *API) handleVirusTotalAnalysis(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.getJob(r, r.PathValue("id"))
+	if !ok {
+		a.jsonError(w, "Unknown or expired analysis", http.StatusNotFound)
+		return
+	}
+
+	stats := map[string]int{}
+	for _, category := range virusTotalCategories {
+		stats[category] = 0
+	}
+	results := map[string]interface{}{}
+	addResult := func(engine config.EngineType, status drivers.ScanStatus, signature string) {
+		category := virusTotalCategory(status)
+		stats[category]++
+		entry := map[string]interface{}{
+			"category":    category,
+			"engine_name": engine,
+			"method":      "blacklist",
+			"result":      nil,
+		}
+		if signature != "" {
+			entry["result"] = signature
+		}
+		results[string(engine)] = entry
+	}
+
+	status := "queued"
+	switch job.Status {
+	case scanner.JobRunning:
+		status = "in-progress"
+	case scanner.JobFailed:
+		status = "completed"
+		addResult(a.scanner.ActiveEngine(), drivers.StatusError, "")
+	case scanner.JobCompleted:
+		status = "completed"
+		if len(job.Result.Engines) == 0 {
+			addResult(job.Result.Engine, job.Result.Status, verdictDescription(job.Result))
+		}
+		for _, v := range job.Result.Engines {
+			addResult(v.Engine, v.Status, v.Signature)
+		}
+		// Policy and content checks are not an engine's verdict but still
+		// decide the file's fate, so clients reading the stats see them
+		if job.Result.Status != drivers.StatusClean && stats[virusTotalCategory(job.Result.Status)] == 0 {
+			addResult("av-scanner", job.Result.Status, verdictDescription(job.Result))
+		}
+	}
+
+	a.jsonResponse(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"type": "analysis",
+			"id":   job.ID,
+			"attributes": map[string]interface{}{
+				"date":    job.CreatedAt.Unix(),
+				"status":  status,
+				"stats":   stats,
+				"results": results,
+			},
+			"links": map[string]string{"self": "/api/v3/analyses/" + job.ID},
+		},
+		"meta": map[string]interface{}{
+			"file_info": map[string]string{"sha256": job.SHA256},
+		},
+	}, http.StatusOK)
+}
+
+// virusTotalCategories are the analysis stats VirusTotal reports
+var virusTotalCategories = []string{
+	"harmless", "type-unsupported", "suspicious", "confirmed-timeout",
+	"timeout", "failure", "malicious", "undetected",
+}
+
+func virusTotalCategory(status drivers.ScanStatus) string {
+	switch status {
+	case drivers.StatusInfected, drivers.StatusBlocked:
+		return "malicious"
+	case drivers.StatusSuspicious:
+		return "suspicious"
+	case drivers.StatusSkipped:
+		return "type-unsupported"
+	case drivers.StatusError:
+		return "failure"
+	}
+	return "undetected"
+}
+
+// virusTotalError is VirusTotal's error object, with the code its clients
+// map to exceptions
+func virusTotalError(message string, status int) interface{} {
+	code := "BadRequestError"
+	switch {
+	case status == http.StatusNotFound:
+		code = "NotFoundError"
+	case status == http.StatusForbidden:
+		code = "ForbiddenError"
+	case status == http.StatusTooManyRequests:
+		code = "QuotaExceededError"
+	case status == http.StatusRequestEntityTooLarge:
+		code = "UnsupportedContentError"
+	case status >= 500:
+		code = "TransientError"
+	}
+	return map[string]interface{}{"error": map[string]string{"code": code, "message": message}}
+}
+
+// verdictDescription names what made a file not clean: the signature, the
+// policy rule that blocked it or the content checks' findings
+func verdictDescription(result *scanner.ScanResponse) string {
+	switch {
+	case result.Signature != "":
+		return result.Signature
+	case result.Status == drivers.StatusBlocked && result.Policy != nil:
+		return "policy:" + result.Policy.Rule
+	case len(result.Findings) > 0:
+		return strings.Join(result.Findings, ",")
+	}
+	return string(result.Status)
+}
+
+// withCompatErrors rewrites the handler's error responses into the format
+// clients of the imitated API expect
+func (a *API) withCompatErrors(format func(message string, status int) interface{}, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&compatErrorWriter{ResponseWriter: w, format: format}, r)
+	}
+}
+
+// compatErrorWriter reformats the {"error": message} body of responses with
+// an error status
+type compatErrorWriter struct {
+	http.ResponseWriter
+	format func(message string, status int) interface{}
+	status int
+}
+
+func (cw *compatErrorWriter) WriteHeader(status int) {
+	cw.status = status
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compatErrorWriter) Write(p []byte) (int, error) {
+	if cw.status < http.StatusBadRequest {
+		return cw.ResponseWriter.Write(p)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(p, &body); err != nil || body.Error == "" {
+		return cw.ResponseWriter.Write(p)
+	}
+	if err := json.NewEncoder(cw.ResponseWriter).Encode(cw.format(body.Error, cw.status)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compatErrorWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// withAPIKeyHeader accepts the token in VirusTotal's x-apikey header when
+// the request has no Authorization header
+func withAPIKeyHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("X-Apikey"); key != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
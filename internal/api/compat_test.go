@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func TestAPI_ClamAVRestScan(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.CompatAPIs = []config.CompatAPI{config.CompatClamAVRest}
+
+	tests := []struct {
+		name        string
+		content     string
+		status      int
+		body        string
+		description string
+	}{
+		{"clean.txt", "hello world", http.StatusOK, "OK", ""},
+		{"eicar.com", drivers.EICARPattern(), http.StatusNotAcceptable, "FOUND", drivers.EICARSignature},
+	}
+	for _, tt := range tests {
+		body, contentType := createMultipartFile(t, "file", tt.name, []byte(tt.content))
+		req := httptest.NewRequest(http.MethodPost, "/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", tt.name, tt.status, rr.Code, rr.Body.String())
+		}
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp["Status"] != tt.body || resp["Description"] != tt.description {
+			t.Errorf("%s: unexpected response %v", tt.name, resp)
+		}
+	}
+
+	// Errors use clamav-rest's format too
+	body, contentType := createMultipartFile(t, "upload", "clean.txt", []byte("hello"))
+	req := httptest.NewRequest(http.MethodPost, "/scan", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	var resp map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusBadRequest || resp["Status"] != "ERROR" || resp["Description"] != msgNoFile {
+		t.Errorf("expected clamav-rest error, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAPI_CompatDisabled(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	body, contentType := createMultipartFile(t, "file", "clean.txt", []byte("hello"))
+	req := httptest.NewRequest(http.MethodPost, "/scan", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 without COMPAT_APIS, got %d", rr.Code)
+	}
+}
+
+func TestAPI_VirusTotalFiles(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.CompatAPIs = []config.CompatAPI{config.CompatVirusTotal}
+	api.config.AsyncWorkers = 1
+	api.config.AsyncQueueSize = 10
+	api.scanner = scanner.New(api.config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer api.scanner.Stop()
+
+	body, contentType := createMultipartFile(t, "file", "eicar.com", []byte(drivers.EICARPattern()))
+	req := httptest.NewRequest(http.MethodPost, "/api/v3/files", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var upload struct {
+		Data struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &upload)
+	if upload.Data.Type != "analysis" || upload.Data.ID == "" {
+		t.Fatalf("unexpected response: %s", rr.Body.String())
+	}
+
+	var analysis struct {
+		Data struct {
+			Attributes struct {
+				Status  string         `json:"status"`
+				Stats   map[string]int `json:"stats"`
+				Results map[string]struct {
+					Category string `json:"category"`
+					Result   string `json:"result"`
+				} `json:"results"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for analysis.Data.Attributes.Status != "completed" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v3/analyses/"+upload.Data.ID, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		json.Unmarshal(rr.Body.Bytes(), &analysis)
+	}
+	attrs := analysis.Data.Attributes
+	if attrs.Status != "completed" || attrs.Stats["malicious"] != 1 || attrs.Stats["undetected"] != 0 {
+		t.Errorf("unexpected analysis: %s", rr.Body.String())
+	}
+	if result := attrs.Results[string(config.EngineMock)]; result.Category != "malicious" || result.Result != drivers.EICARSignature {
+		t.Errorf("unexpected engine result: %+v", result)
+	}
+
+	// Errors use VirusTotal's format
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v3/analyses/unknown", nil))
+	var vtErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &vtErr)
+	if rr.Code != http.StatusNotFound || vtErr.Error.Code != "NotFoundError" {
+		t.Errorf("expected NotFoundError, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWithAPIKeyHeader(t *testing.T) {
+	var authorization string
+	handler := withAPIKeyHeader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v3/analyses/x", nil)
+	req.Header.Set("x-apikey", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if authorization != "Bearer secret" {
+		t.Errorf("expected x-apikey as bearer token, got %q", authorization)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v3/analyses/x", nil)
+	req.Header.Set("x-apikey", "secret")
+	req.Header.Set("Authorization", "Bearer other")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if authorization != "Bearer other" {
+		t.Errorf("expected Authorization header to win, got %q", authorization)
+	}
+}
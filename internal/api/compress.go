@@ -0,0 +1,146 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Responses are compressed with zstd or gzip when the client asks for it in
+// Accept-Encoding. Handlers that encode their own body (e.g. /metrics) set
+// Content-Encoding themselves and are passed through.
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+)
+
+// negotiateCompression picks the accepted content coding with the highest
+// quality, preferring zstd on ties; "" means identity
+func negotiateCompression(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		switch coding {
+		case "zstd":
+			if q >= bestQ {
+				best, bestQ = "zstd", q
+			}
+		case "gzip", "x-gzip":
+			if q > bestQ {
+				best, bestQ = "gzip", q
+			}
+		}
+	}
+	return best
+}
+
+func (a *API) withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateCompression(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter decides on the first header write whether to compress, so
+// empty and pre-encoded responses are left alone
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	wroteHeader bool
+	gzip        *gzip.Writer
+	zstd        *zstd.Encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		switch cw.encoding {
+		case "zstd":
+			cw.zstd = zstdWriters.Get().(*zstd.Encoder)
+			cw.zstd.Reset(cw.ResponseWriter)
+		case "gzip":
+			cw.gzip = gzipWriters.Get().(*gzip.Writer)
+			cw.gzip.Reset(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case cw.zstd != nil:
+		return cw.zstd.Write(b)
+	case cw.gzip != nil:
+		return cw.gzip.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush pushes compressed data to the client, for streamed responses
+func (cw *compressWriter) Flush() {
+	switch {
+	case cw.zstd != nil:
+		cw.zstd.Flush()
+	case cw.gzip != nil:
+		cw.gzip.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	switch {
+	case cw.zstd != nil:
+		cw.zstd.Close()
+		cw.zstd.Reset(io.Discard)
+		zstdWriters.Put(cw.zstd)
+	case cw.gzip != nil:
+		cw.gzip.Close()
+		gzipWriters.Put(cw.gzip)
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateCompression(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "gzip"},
+		{"gzip, zstd", "zstd"},
+		{"zstd;q=0.5, gzip", "gzip"},
+		{"zstd;q=0, gzip;q=0", ""},
+		{"br", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateCompression(tt.acceptEncoding); got != tt.expected {
+			t.Errorf("negotiateCompression(%q) = %q, expected %q", tt.acceptEncoding, got, tt.expected)
+		}
+	}
+}
+
+func TestAPI_Compression(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	for encoding, decode := range decoders {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/engines", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", encoding, rr.Code)
+		}
+		if rr.Header().Get("Content-Encoding") != encoding {
+			t.Errorf("%s: expected Content-Encoding %s, got %q", encoding, encoding, rr.Header().Get("Content-Encoding"))
+		}
+
+		body, err := decode(rr.Body)
+		if err != nil {
+			t.Fatalf("%s: failed to open body: %v", encoding, err)
+		}
+		var resp map[string]interface{}
+		if err := json.NewDecoder(body).Decode(&resp); err != nil {
+			t.Fatalf("%s: failed to decode body: %v", encoding, err)
+		}
+		if resp["activeEngine"] != "mock" {
+			t.Errorf("%s: expected activeEngine mock, got %v", encoding, resp["activeEngine"])
+		}
+	}
+
+	// Without Accept-Encoding the body is plain JSON
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/engines", nil))
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected no Content-Encoding, got %q", rr.Header().Get("Content-Encoding"))
+	}
+	if !json.Valid(rr.Body.Bytes()) {
+		t.Errorf("expected plain JSON body, got %q", rr.Body.String())
+	}
+}
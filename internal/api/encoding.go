@@ -0,0 +1,422 @@
+package api
+
+import (
+	"encoding/binary"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/inspect"
+	"github.com/rophy/av-scanner/internal/policy"
+	"github.com/rophy/av-scanner/internal/scanner"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Binary encodings of the scan result for high-throughput callers. The
+// protobuf schema is in docs/scan.proto; MessagePack uses the same field
+// names as the JSON response. Error responses are always JSON.
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeMsgpack  = "application/x-msgpack"
+	contentTypeNDJSON   = "application/x-ndjson"
+)
+
+// negotiateEncoding picks the first supported media type in the Accept
+// header, falling back to JSON
+func negotiateEncoding(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		switch mediaType {
+		case contentTypeProtobuf, "application/protobuf":
+			return contentTypeProtobuf
+		case contentTypeMsgpack, "application/msgpack", "application/vnd.msgpack":
+			return contentTypeMsgpack
+		case contentTypeJSON, "application/*", "*/*":
+			return contentTypeJSON
+		}
+	}
+	return contentTypeJSON
+}
+
+// Protocol Buffers
+
+func encodeScanProtobuf(fileName string, r *scanner.ScanResponse) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, r.FileID)
+	b = appendProtoString(b, 2, fileName)
+	b = appendProtoString(b, 3, string(r.Status))
+	b = appendProtoString(b, 4, string(r.Engine))
+	b = appendProtoString(b, 5, r.Signature)
+	if r.Policy != nil {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodePolicyProtobuf(r.Policy))
+	}
+	for _, finding := range r.Findings {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendString(b, finding)
+	}
+	for _, child := range r.Children {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeMemberProtobuf(child))
+	}
+	if r.TotalDuration != 0 {
+		b = protowire.AppendTag(b, 9, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.TotalDuration))
+	}
+	if r.Entropy != nil {
+		b = protowire.AppendTag(b, 10, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*r.Entropy))
+	}
+	if r.DryRun != nil {
+		b = protowire.AppendTag(b, 11, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeDryRunProtobuf(r.DryRun))
+	}
+	for _, v := range r.Engines {
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeEngineVerdictProtobuf(v))
+	}
+	if r.FileType != nil {
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeFileTypeProtobuf(r.FileType))
+	}
+	if r.Timings != nil {
+		b = protowire.AppendTag(b, 14, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeTimingsProtobuf(r.Timings))
+	}
+	if r.Cached {
+		b = protowire.AppendTag(b, 15, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	if r.Hashes != nil {
+		b = protowire.AppendTag(b, 16, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeHashesProtobuf(r.Hashes))
+	}
+	return b
+}
+
+func encodeHashesProtobuf(h *scanner.Hashes) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, h.MD5)
+	b = appendProtoString(b, 2, h.SHA1)
+	b = appendProtoString(b, 3, h.SHA256)
+	return b
+}
+
+func encodeTimingsProtobuf(t *scanner.Timings) []byte {
+	var b []byte
+	for i, ms := range []int64{t.SaveMs, t.ManualScanMs, t.RTSWaitMs, t.TotalMs} {
+		if ms != 0 {
+			b = protowire.AppendTag(b, protowire.Number(i+1), protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(ms))
+		}
+	}
+	return b
+}
+
+func encodeFileTypeProtobuf(t *inspect.FileType) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, t.MimeType)
+	b = appendProtoString(b, 2, t.Category)
+	return b
+}
+
+func encodeEngineVerdictProtobuf(v *scanner.EngineVerdict) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, string(v.Engine))
+	b = appendProtoString(b, 2, string(v.Status))
+	b = appendProtoString(b, 3, v.Signature)
+	b = appendProtoString(b, 4, v.Error)
+	if v.Duration != 0 {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v.Duration))
+	}
+	return b
+}
+
+func encodeDryRunProtobuf(d *scanner.DryRunResult) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, string(d.Action))
+	if d.EngineHealthy {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	b = appendProtoString(b, 3, d.EngineError)
+	b = appendProtoString(b, 4, d.SHA256)
+	return b
+}
+
+func encodePolicyProtobuf(d *policy.Decision) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, string(d.Action))
+	b = appendProtoString(b, 2, d.Rule)
+	return b
+}
+
+func encodeMemberProtobuf(m *scanner.MemberResult) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, m.FileName)
+	b = appendProtoString(b, 2, string(m.Status))
+	b = appendProtoString(b, 3, m.Signature)
+	for _, finding := range m.Findings {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, finding)
+	}
+	b = appendProtoString(b, 5, m.Error)
+	for _, child := range m.Children {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeMemberProtobuf(child))
+	}
+	return b
+}
+
+// appendProtoString appends a singular string field, omitting the default value
+func appendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// MessagePack
+
+func encodeScanMsgpack(fileName string, r *scanner.ScanResponse) []byte {
+	n := 5
+	if r.Signature != "" {
+		n++
+	}
+	if r.Policy != nil {
+		n++
+	}
+	if len(r.Findings) > 0 {
+		n++
+	}
+	if len(r.Children) > 0 {
+		n++
+	}
+	if r.Entropy != nil {
+		n++
+	}
+	if r.DryRun != nil {
+		n++
+	}
+	if len(r.Engines) > 0 {
+		n++
+	}
+	if r.FileType != nil {
+		n++
+	}
+	if r.Timings != nil {
+		n++
+	}
+	if r.Cached {
+		n++
+	}
+	if r.Hashes != nil {
+		n++
+	}
+
+	b := appendMsgpackMapHeader(nil, n)
+	b = appendMsgpackString(appendMsgpackString(b, "fileId"), r.FileID)
+	b = appendMsgpackString(appendMsgpackString(b, "fileName"), fileName)
+	b = appendMsgpackString(appendMsgpackString(b, "status"), string(r.Status))
+	b = appendMsgpackString(appendMsgpackString(b, "engine"), string(r.Engine))
+	b = appendMsgpackInt(appendMsgpackString(b, "duration"), r.TotalDuration)
+	if r.Signature != "" {
+		b = appendMsgpackString(appendMsgpackString(b, "signature"), r.Signature)
+	}
+	if r.Policy != nil {
+		b = appendMsgpackString(b, "policy")
+		if r.Policy.Rule != "" {
+			b = appendMsgpackMapHeader(b, 2)
+		} else {
+			b = appendMsgpackMapHeader(b, 1)
+		}
+		b = appendMsgpackString(appendMsgpackString(b, "action"), string(r.Policy.Action))
+		if r.Policy.Rule != "" {
+			b = appendMsgpackString(appendMsgpackString(b, "rule"), r.Policy.Rule)
+		}
+	}
+	if len(r.Findings) > 0 {
+		b = appendMsgpackStrings(appendMsgpackString(b, "findings"), r.Findings)
+	}
+	if len(r.Children) > 0 {
+		b = appendMsgpackMembers(appendMsgpackString(b, "children"), r.Children)
+	}
+	if r.Entropy != nil {
+		b = appendMsgpackFloat(appendMsgpackString(b, "entropy"), *r.Entropy)
+	}
+	if r.DryRun != nil {
+		b = appendMsgpackDryRun(appendMsgpackString(b, "dryRun"), r.DryRun)
+	}
+	if len(r.Engines) > 0 {
+		b = appendMsgpackEngines(appendMsgpackString(b, "engines"), r.Engines)
+	}
+	if r.FileType != nil {
+		b = appendMsgpackMapHeader(appendMsgpackString(b, "fileType"), 2)
+		b = appendMsgpackString(appendMsgpackString(b, "mimeType"), r.FileType.MimeType)
+		b = appendMsgpackString(appendMsgpackString(b, "category"), r.FileType.Category)
+	}
+	if r.Timings != nil {
+		b = appendMsgpackMapHeader(appendMsgpackString(b, "timings"), 4)
+		b = appendMsgpackInt(appendMsgpackString(b, "saveMs"), r.Timings.SaveMs)
+		b = appendMsgpackInt(appendMsgpackString(b, "manualScanMs"), r.Timings.ManualScanMs)
+		b = appendMsgpackInt(appendMsgpackString(b, "rtsWaitMs"), r.Timings.RTSWaitMs)
+		b = appendMsgpackInt(appendMsgpackString(b, "totalMs"), r.Timings.TotalMs)
+	}
+	if r.Cached {
+		b = appendMsgpackBool(appendMsgpackString(b, "cached"), true)
+	}
+	if r.Hashes != nil {
+		b = appendMsgpackMapHeader(appendMsgpackString(b, "hashes"), 3)
+		b = appendMsgpackString(appendMsgpackString(b, "md5"), r.Hashes.MD5)
+		b = appendMsgpackString(appendMsgpackString(b, "sha1"), r.Hashes.SHA1)
+		b = appendMsgpackString(appendMsgpackString(b, "sha256"), r.Hashes.SHA256)
+	}
+	return b
+}
+
+func appendMsgpackEngines(b []byte, verdicts []*scanner.EngineVerdict) []byte {
+	b = appendMsgpackArrayHeader(b, len(verdicts))
+	for _, v := range verdicts {
+		n := 3
+		for _, present := range []bool{v.Signature != "", v.Error != ""} {
+			if present {
+				n++
+			}
+		}
+		b = appendMsgpackMapHeader(b, n)
+		b = appendMsgpackString(appendMsgpackString(b, "engine"), string(v.Engine))
+		b = appendMsgpackString(appendMsgpackString(b, "status"), string(v.Status))
+		if v.Signature != "" {
+			b = appendMsgpackString(appendMsgpackString(b, "signature"), v.Signature)
+		}
+		if v.Error != "" {
+			b = appendMsgpackString(appendMsgpackString(b, "error"), v.Error)
+		}
+		b = appendMsgpackInt(appendMsgpackString(b, "duration"), v.Duration)
+	}
+	return b
+}
+
+func appendMsgpackDryRun(b []byte, d *scanner.DryRunResult) []byte {
+	n := 2
+	for _, present := range []bool{d.EngineError != "", d.SHA256 != ""} {
+		if present {
+			n++
+		}
+	}
+	b = appendMsgpackMapHeader(b, n)
+	b = appendMsgpackString(appendMsgpackString(b, "action"), string(d.Action))
+	b = appendMsgpackBool(appendMsgpackString(b, "engineHealthy"), d.EngineHealthy)
+	if d.EngineError != "" {
+		b = appendMsgpackString(appendMsgpackString(b, "engineError"), d.EngineError)
+	}
+	if d.SHA256 != "" {
+		b = appendMsgpackString(appendMsgpackString(b, "sha256"), d.SHA256)
+	}
+	return b
+}
+
+func appendMsgpackMembers(b []byte, members []*scanner.MemberResult) []byte {
+	b = appendMsgpackArrayHeader(b, len(members))
+	for _, m := range members {
+		n := 2
+		for _, present := range []bool{m.Signature != "", len(m.Findings) > 0, m.Error != "", len(m.Children) > 0} {
+			if present {
+				n++
+			}
+		}
+		b = appendMsgpackMapHeader(b, n)
+		b = appendMsgpackString(appendMsgpackString(b, "fileName"), m.FileName)
+		b = appendMsgpackString(appendMsgpackString(b, "status"), string(m.Status))
+		if m.Signature != "" {
+			b = appendMsgpackString(appendMsgpackString(b, "signature"), m.Signature)
+		}
+		if len(m.Findings) > 0 {
+			b = appendMsgpackStrings(appendMsgpackString(b, "findings"), m.Findings)
+		}
+		if m.Error != "" {
+			b = appendMsgpackString(appendMsgpackString(b, "error"), m.Error)
+		}
+		if len(m.Children) > 0 {
+			b = appendMsgpackMembers(appendMsgpackString(b, "children"), m.Children)
+		}
+	}
+	return b
+}
+
+func appendMsgpackStrings(b []byte, values []string) []byte {
+	b = appendMsgpackArrayHeader(b, len(values))
+	for _, v := range values {
+		b = appendMsgpackString(b, v)
+	}
+	return b
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendMsgpackFloat(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v < 128:
+		return append(b, byte(v))
+	case v < 0 && v >= -32:
+		return append(b, byte(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+	}
+}
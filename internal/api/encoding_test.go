@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/policy"
+	"github.com/rophy/av-scanner/internal/scanner"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", contentTypeJSON},
+		{"application/json", contentTypeJSON},
+		{"application/x-protobuf", contentTypeProtobuf},
+		{"application/msgpack", contentTypeMsgpack},
+		{"text/html, application/x-msgpack;q=0.9", contentTypeMsgpack},
+		{"application/x-protobuf;q=0, application/json", contentTypeJSON},
+		{"*/*", contentTypeJSON},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.accept); got != tt.expected {
+			t.Errorf("negotiateEncoding(%q) = %q, expected %q", tt.accept, got, tt.expected)
+		}
+	}
+}
+
+func testScanResponse() *scanner.ScanResponse {
+	entropy := 7.25
+	return &scanner.ScanResponse{
+		FileID:        "id-1",
+		Status:        drivers.StatusInfected,
+		Engine:        "mock",
+		Signature:     drivers.EICARSignature,
+		Policy:        &policy.Decision{Action: policy.ActionDeep, Rule: "archives"},
+		Findings:      []string{"polyglot:jpeg+zip"},
+		Entropy:       &entropy,
+		TotalDuration: 250,
+		Children: []*scanner.MemberResult{
+			{FileName: "a.txt", Status: drivers.StatusClean},
+			{FileName: "b.eml", Status: drivers.StatusInfected, Signature: drivers.EICARSignature, Children: []*scanner.MemberResult{
+				{FileName: "c.com", Status: drivers.StatusInfected, Signature: drivers.EICARSignature},
+			}},
+		},
+	}
+}
+
+func TestEncodeScanProtobuf(t *testing.T) {
+	b := encodeScanProtobuf("mail.eml", testScanResponse())
+
+	fields := make(map[protowire.Number][][]byte)
+	var duration, entropy uint64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatalf("invalid bytes field %d", num)
+			}
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				t.Fatalf("invalid varint field %d", num)
+			}
+			duration = v
+			b = b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				t.Fatalf("invalid fixed64 field %d", num)
+			}
+			entropy = v
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d for field %d", typ, num)
+		}
+	}
+
+	if string(fields[1][0]) != "id-1" || string(fields[2][0]) != "mail.eml" || string(fields[3][0]) != "infected" {
+		t.Errorf("unexpected scalar fields: %q %q %q", fields[1], fields[2], fields[3])
+	}
+	if len(fields[8]) != 2 {
+		t.Errorf("expected 2 children, got %d", len(fields[8]))
+	}
+	if duration != 250 {
+		t.Errorf("expected duration 250, got %d", duration)
+	}
+	if math.Float64frombits(entropy) != 7.25 {
+		t.Errorf("expected entropy 7.25, got %v", math.Float64frombits(entropy))
+	}
+}
+
+func TestEncodeScanMsgpack(t *testing.T) {
+	decoded, rest, err := decodeMsgpack(encodeScanMsgpack("mail.eml", testScanResponse()))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("unexpected trailing bytes: %d", len(rest))
+	}
+
+	expected := map[string]interface{}{
+		"fileId":    "id-1",
+		"fileName":  "mail.eml",
+		"status":    "infected",
+		"engine":    "mock",
+		"duration":  int64(250),
+		"signature": drivers.EICARSignature,
+		"policy":    map[string]interface{}{"action": "deep", "rule": "archives"},
+		"findings":  []interface{}{"polyglot:jpeg+zip"},
+		"entropy":   7.25,
+		"children": []interface{}{
+			map[string]interface{}{"fileName": "a.txt", "status": "clean"},
+			map[string]interface{}{"fileName": "b.eml", "status": "infected", "signature": drivers.EICARSignature, "children": []interface{}{
+				map[string]interface{}{"fileName": "c.com", "status": "infected", "signature": drivers.EICARSignature},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("unexpected decoded value:\n%#v\nexpected:\n%#v", decoded, expected)
+	}
+}
+
+func TestEncodeScanMsgpack_DryRun(t *testing.T) {
+	r := &scanner.ScanResponse{
+		FileID: "id-2",
+		Status: drivers.StatusSkipped,
+		Engine: "mock",
+		DryRun: &scanner.DryRunResult{Action: policy.ActionScan, EngineHealthy: true, SHA256: "abc"},
+	}
+	decoded, _, err := decodeMsgpack(encodeScanMsgpack("a.txt", r))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+
+	expected := map[string]interface{}{"action": "scan", "engineHealthy": true, "sha256": "abc"}
+	if got := decoded.(map[string]interface{})["dryRun"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected dryRun: %#v", got)
+	}
+}
+
+func TestAPI_HandleScan_BinaryEncodings(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	for _, accept := range []string{contentTypeProtobuf, contentTypeMsgpack} {
+		body, contentType := createMultipartFile(t, "file", "clean.txt", []byte("clean"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", accept)
+
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", accept, rr.Code)
+		}
+		if rr.Header().Get("Content-Type") != accept {
+			t.Errorf("expected Content-Type %s, got %s", accept, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// decodeMsgpack decodes the subset of MessagePack produced by the encoder
+func decodeMsgpack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of input")
+	}
+	c := b[0]
+	switch {
+	case c < 0x80:
+		return int64(c), b[1:], nil
+	case c&0xf0 == 0x80:
+		return decodeMsgpackMap(b[1:], int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return decodeMsgpackArray(b[1:], int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		n := int(c & 0x1f)
+		return string(b[1 : 1+n]), b[1+n:], nil
+	case c == 0xc2:
+		return false, b[1:], nil
+	case c == 0xc3:
+		return true, b[1:], nil
+	case c == 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), b[9:], nil
+	case c == 0xd3:
+		return int64(binary.BigEndian.Uint64(b[1:])), b[9:], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported type byte 0x%02x", c)
+}
+
+func decodeMsgpackMap(b []byte, n int) (interface{}, []byte, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, rest, err := decodeMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, rest, err := decodeMsgpack(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[k.(string)] = v
+		b = rest
+	}
+	return m, b, nil
+}
+
+func decodeMsgpackArray(b []byte, n int) (interface{}, []byte, error) {
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, rest, err := decodeMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		a = append(a, v)
+		b = rest
+	}
+	return a, b, nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// Errors returned by scanEngines
+var (
+	errEngineNotConfigured = errors.New("engine is not in AV_ENGINES")
+	errEngineForbidden     = errors.New("forbidden: engine not granted")
+)
+
+// scanEngines resolves the engines a scan runs with besides the active one.
+// Callers may name engines with the repeatable "engine" parameter; each must
+// be in AV_ENGINES, and engines reserved in the allowlist may only be named
+// by the identities granted them and admins. A scan that names no engines
+// skips the reserved engines the caller may not use. Returns nil when every
+// engine applies.
+func (a *API) scanEngines(ctx context.Context, requested []string) ([]config.EngineType, error) {
+	configured := a.scanner.Engines()
+	mayUse := func(engine config.EngineType) bool {
+		if a.authMiddleware == nil || engine == configured[0] {
+			return true
+		}
+		identity := auth.GetCallerIdentity(ctx)
+		return identity != nil && a.allowlist.MayUseEngine(identity.Cluster, identity.Namespace, identity.ServiceAccount, string(engine))
+	}
+
+	if len(requested) == 0 {
+		others := configured[1:]
+		granted := slices.DeleteFunc(slices.Clone(others), func(engine config.EngineType) bool { return !mayUse(engine) })
+		if len(granted) == len(others) {
+			return nil, nil
+		}
+		return granted, nil
+	}
+
+	engines := make([]config.EngineType, 0, len(requested))
+	for _, name := range requested {
+		engine := config.EngineType(name)
+		if !slices.Contains(configured, engine) {
+			return nil, fmt.Errorf("%w: %s", errEngineNotConfigured, name)
+		}
+		if !mayUse(engine) {
+			return nil, fmt.Errorf("%w: %s", errEngineForbidden, name)
+		}
+		engines = append(engines, engine)
+	}
+	return engines, nil
+}
+
+// engineErrorStatus maps a scanEngines error to an HTTP status
+func engineErrorStatus(err error) int {
+	if errors.Is(err, errEngineForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// newMultiEngineAPI returns a test API whose uploads are also scanned by
+// trendmicro, which cannot scan in tests
+func newMultiEngineAPI(t *testing.T) (*API, string) {
+	t.Helper()
+	api, tmpDir := newTestAPI(t)
+	api.config.Engines = []config.EngineType{config.EngineMock, config.EngineTrendMicro}
+	api.scanner = scanner.New(api.config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return api, tmpDir
+}
+
+func TestAPI_ScanEngines(t *testing.T) {
+	api, tmpDir := newMultiEngineAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	allowlistFile := filepath.Join(tmpDir, "allowlist.yaml")
+	content := `allowlist:
+  - prod/ns1/sa1
+  - prod/ns2/sa2
+admins:
+  - prod/ops/operator
+engines:
+  trendmicro:
+    - prod/ns2/sa2
+`
+	if err := os.WriteFile(allowlistFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write allowlist: %v", err)
+	}
+	allowlist, err := auth.NewAllowlist(allowlistFile, logger)
+	if err != nil {
+		t.Fatalf("failed to create allowlist: %v", err)
+	}
+	api.allowlist = allowlist
+	api.authMiddleware = auth.NewMiddleware(nil, allowlist, logger, nil)
+
+	caller := func(namespace, serviceAccount string) context.Context {
+		return auth.WithCallerIdentity(context.Background(), &auth.CallerIdentity{
+			Cluster: "prod", Namespace: namespace, ServiceAccount: serviceAccount,
+		})
+	}
+
+	// Without a selection, reserved engines are skipped for other callers
+	if engines, err := api.scanEngines(caller("ns1", "sa1"), nil); err != nil || engines == nil || len(engines) != 0 {
+		t.Errorf("expected trendmicro to be skipped, got %v (%v)", engines, err)
+	}
+	for _, ctx := range []context.Context{caller("ns2", "sa2"), caller("ops", "operator")} {
+		if engines, err := api.scanEngines(ctx, nil); err != nil || engines != nil {
+			t.Errorf("expected every engine, got %v (%v)", engines, err)
+		}
+	}
+
+	if _, err := api.scanEngines(caller("ns1", "sa1"), []string{"trendmicro"}); !errors.Is(err, errEngineForbidden) {
+		t.Errorf("expected errEngineForbidden, got %v", err)
+	}
+	if engines, err := api.scanEngines(caller("ns1", "sa1"), []string{"mock"}); err != nil || len(engines) != 1 {
+		t.Errorf("expected the active engine to be allowed, got %v (%v)", engines, err)
+	}
+	if engines, err := api.scanEngines(caller("ns2", "sa2"), []string{"trendmicro"}); err != nil || len(engines) != 1 {
+		t.Errorf("expected trendmicro to be granted, got %v (%v)", engines, err)
+	}
+	if _, err := api.scanEngines(caller("ops", "operator"), []string{"clamav"}); !errors.Is(err, errEngineNotConfigured) {
+		t.Errorf("expected errEngineNotConfigured, got %v", err)
+	}
+}
+
+func TestAPI_HandleScan_EngineSelection(t *testing.T) {
+	api, tmpDir := newMultiEngineAPI(t)
+	defer os.RemoveAll(tmpDir)
+	handler := api.Routes()
+
+	scan := func(query string) (int, map[string]interface{}) {
+		body, contentType := createMultipartFile(t, "file", "clean.txt", []byte("clean"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	code, resp := scan("")
+	if engines, _ := resp["engines"].([]interface{}); code != http.StatusOK || len(engines) != 2 {
+		t.Errorf("expected both engines, got %d: %v", code, resp)
+	}
+	code, resp = scan("?engine=mock")
+	if _, ok := resp["engines"]; code != http.StatusOK || ok {
+		t.Errorf("expected the active engine alone, got %d: %v", code, resp)
+	}
+	if code, _ = scan("?engine=clamav"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an engine outside AV_ENGINES, got %d", code)
+	}
+}
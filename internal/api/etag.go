@@ -0,0 +1,34 @@
+package api
+
+import "strings"
+
+// verdictETag identifies a verdict by content hash and the signatures it was
+// reached with. It is weak because the body may be compressed in transit.
+func verdictETag(sha256Hex, definitionsVersion string) string {
+	tag := sha256Hex
+	if definitionsVersion != "" {
+		// ETag characters exclude '"' and control characters
+		version := strings.Map(func(r rune) rune {
+			if r <= 0x20 || r == '"' || r >= 0x7f {
+				return '_'
+			}
+			return r
+		}, definitionsVersion)
+		tag += "-" + version
+	}
+	return `W/"` + tag + `"`
+}
+
+// etagMatches implements the weak comparison of If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
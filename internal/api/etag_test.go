@@ -0,0 +1,29 @@
+package api
+
+import "testing"
+
+func TestVerdictETag(t *testing.T) {
+	if got := verdictETag("abc", ""); got != `W/"abc"` {
+		t.Errorf("unexpected ETag: %s", got)
+	}
+	if got := verdictETag("abc", `0.103.11 "daily" 27400`); got != `W/"abc-0.103.11__daily__27400"` {
+		t.Errorf("unexpected ETag: %s", got)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `W/"abc-1"`
+	tests := map[string]bool{
+		"":                   false,
+		`W/"abc-1"`:          true,
+		`"abc-1"`:            true,
+		`"other", W/"abc-1"`: true,
+		"*":                  true,
+		`"abc-2"`:            false,
+	}
+	for header, want := range tests {
+		if got := etagMatches(header, etag); got != want {
+			t.Errorf("If-None-Match %q: expected %v, got %v", header, want, got)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+const (
+	// eventPollInterval is how often an event stream checks for progress
+	eventPollInterval = 250 * time.Millisecond
+	// eventKeepAlive is the idle time after which a comment is sent, so
+	// proxies do not close a quiet stream
+	eventKeepAlive = 15 * time.Second
+)
+
+// Event names. progress carries a snapshot whenever it changes; done carries
+// the final state and ends the stream.
+const (
+	eventProgress = "progress"
+	eventDone     = "done"
+)
+
+// streamEvents writes Server-Sent Events until poll reports done or the
+// client goes away. poll returns the next snapshot, or nil when nothing
+// changed since the last one.
+func (a *API) streamEvents(w http.ResponseWriter, r *http.Request, poll func() (data any, done bool)) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would hold events back
+	// Streams outlive the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		a.logger.Warn("Failed to lift write deadline for event stream", "error", err)
+	}
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	for {
+		data, done := poll()
+		switch {
+		case data != nil:
+			event := eventProgress
+			if done {
+				event = eventDone
+			}
+			payload, err := json.Marshal(data)
+			if err != nil {
+				a.logger.Error("Failed to encode event", "error", err)
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+			flush(w)
+			lastWrite = time.Now()
+		case time.Since(lastWrite) >= eventKeepAlive:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flush(w)
+			lastWrite = time.Now()
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleScanJobEvents streams an async job's status changes as Server-Sent
+// Events (GET /api/v1/scan/jobs/{id}/events), ending with the result
+func (a *API) handleScanJobEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := a.getJob(r, id); !ok {
+		a.jsonError(w, "Unknown or expired job", http.StatusNotFound)
+		return
+	}
+
+	var last scanner.JobStatus
+	a.streamEvents(w, r, func() (any, bool) {
+		job, ok := a.scanner.GetJob(id)
+		if !ok {
+			// Expired while the client was listening
+			return nil, true
+		}
+		done := job.Status == scanner.JobCompleted || job.Status == scanner.JobFailed
+		if job.Status == last {
+			return nil, false
+		}
+		last = job.Status
+		return scanJobJSON(job, catalogFor(w)), done
+	})
+}
+
+// pathScanProgress is what a progress event for a directory scan reports
+// has changed
+type pathScanProgress struct {
+	status                                                string
+	found, scanned, infected, suspicious, errors, skipped int
+}
+
+// handlePathScanEvents streams a directory scan's progress as Server-Sent
+// Events (GET /api/v1/scan/path/{id}/events)
+func (a *API) handlePathScanEvents(w http.ResponseWriter, r *http.Request) {
+	if a.pathScans == nil {
+		a.jsonError(w, "Directory scans are disabled", http.StatusNotImplemented)
+		return
+	}
+	id := r.PathValue("id")
+	if _, ok := a.pathScans.Get(id); !ok {
+		a.jsonError(w, "Unknown or expired directory scan", http.StatusNotFound)
+		return
+	}
+
+	var last pathScanProgress
+	a.streamEvents(w, r, func() (any, bool) {
+		scan, ok := a.pathScans.Get(id)
+		if !ok {
+			return nil, true
+		}
+		progress := pathScanProgress{scan.Status, scan.Found, scan.Scanned, scan.Infected, scan.Suspicious, scan.Errors, scan.Skipped}
+		if progress == last {
+			return nil, false
+		}
+		last = progress
+		return scan, scan.Status != bulkscan.PathScanRunning
+	})
+}
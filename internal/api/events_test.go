@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// readEvents parses a Server-Sent Events body, ignoring comments
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event.name = name
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				if err := json.Unmarshal([]byte(data), &event.data); err != nil {
+					t.Fatalf("invalid event data %q: %v", data, err)
+				}
+			}
+		}
+		if event.name != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestAPI_HandleScanJobEvents(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.AsyncWorkers = 1
+	api.config.AsyncQueueSize = 10
+	api.scanner = scanner.New(api.config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer api.scanner.Stop()
+	handler := api.Routes()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/scan/jobs/unknown/events", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+
+	body, contentType := createMultipartFile(t, "file", "eicar.com", []byte(drivers.EICARPattern()))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan/async", body)
+	req.Header.Set("Content-Type", contentType)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	location := rr.Header().Get("Location")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, location+"/events", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	events := readEvents(t, rr.Body.String())
+	last := events[len(events)-1]
+	if last.name != eventDone || last.data["status"] != string(scanner.JobCompleted) {
+		t.Fatalf("expected the stream to end with the completed job, got %+v", events)
+	}
+	if result, _ := last.data["result"].(map[string]interface{}); result["status"] != "infected" {
+		t.Errorf("expected the infected verdict in the final event, got %+v", last.data)
+	}
+	for _, event := range events[:len(events)-1] {
+		if event.name != eventProgress {
+			t.Errorf("expected progress events before the end, got %q", event.name)
+		}
+	}
+}
+
+func TestAPI_HandlePathScanEvents(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(root, "eicar.com"), []byte(drivers.EICARPattern()), 0644)
+	api.config.ScanPathRoots = []string{root}
+	api.config.ScanPathWorkers = 1
+	api.config.ScanPathMaxRuns = 1
+	pathScans := bulkscan.NewPathScans(api.config, api.scanner, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer pathScans.Stop()
+	api.SetPathScans(pathScans)
+
+	scan, err := pathScans.Submit(root, "test")
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/scan/path/"+scan.ID+"/events", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	events := readEvents(t, rr.Body.String())
+	last := events[len(events)-1]
+	if last.name != eventDone || last.data["status"] != bulkscan.PathScanCompleted || last.data["scanned"] != 2.0 || last.data["infected"] != 1.0 {
+		t.Errorf("expected the stream to end with the completed scan, got %+v", events)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/feedback"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+const (
+	// feedbackSignature is reported for flagged hashes without a family name
+	feedbackSignature    = "Feedback.Reported"
+	maxFeedbackSignature = 128
+	maxFeedbackComment   = 1024
+)
+
+// handleFeedback records a file that was later found to be malicious. Future
+// uploads with the same hash are reported infected. Samples are not retained,
+// so submitting them to the vendor is up to the reporter.
+func (a *API) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SHA256    string `json:"sha256"`
+		FileID    string `json:"fileId"`
+		Signature string `json:"signature"`
+		Comment   string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if decoded, err := hex.DecodeString(req.SHA256); err != nil || len(decoded) != 32 {
+		a.jsonError(w, "sha256 must be a hex-encoded SHA-256 hash", http.StatusBadRequest)
+		return
+	}
+	if len(req.Signature) > maxFeedbackSignature {
+		a.jsonError(w, "signature must be at most 128 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Comment) > maxFeedbackComment {
+		a.jsonError(w, "comment must be at most 1024 characters", http.StatusBadRequest)
+		return
+	}
+
+	report, err := a.feedback.Add(feedback.Report{
+		SHA256:     req.SHA256,
+		FileID:     req.FileID,
+		Signature:  req.Signature,
+		Comment:    req.Comment,
+		ReportedBy: callerName(r),
+	})
+	if err != nil {
+		a.logger.Error("Failed to record feedback", "error", err)
+		a.jsonError(w, "Failed to record feedback", http.StatusInternalServerError)
+		return
+	}
+	metrics.RecordFeedbackReport()
+
+	a.logger.Warn("False negative reported",
+		"sha256", report.SHA256,
+		"fileId", report.FileID,
+		"signature", report.Signature,
+		"caller", report.ReportedBy,
+	)
+
+	a.jsonResponse(w, report, http.StatusCreated)
+}
+
+// applyFeedback marks a scan infected if its hash was reported malicious
+func (a *API) applyFeedback(result *scanner.ScanResponse, sha256Hex string) {
+	report := a.feedback.Lookup(sha256Hex)
+	if report == nil || result.Status == drivers.StatusInfected {
+		return
+	}
+	result.Status = drivers.StatusInfected
+	result.Signature = report.Signature
+	if result.Signature == "" {
+		result.Signature = feedbackSignature
+	}
+	result.Findings = append(result.Findings, "feedback:reported")
+	a.logger.Warn("Upload matches reported hash", "fileId", result.FileID, "sha256", sha256Hex, "reportId", report.ID)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAPI_HandleFeedback(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	content := []byte("later found malicious")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/feedback",
+		strings.NewReader(`{"sha256":"`+strings.ToUpper(hash)+`","signature":"Trojan.Example"}`))
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	body, contentType := createMultipartFile(t, "file", "report.txt", content)
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp["status"] != "infected" || resp["signature"] != "Trojan.Example" {
+		t.Errorf("expected reported hash to scan infected, got %v", resp)
+	}
+}
+
+func TestAPI_HandleFeedback_Invalid(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	for _, body := range []string{
+		`not json`,
+		`{"sha256":"abc"}`,
+		`{"sha256":"` + strings.Repeat("zz", 32) + `"}`,
+	} {
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/feedback", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/scanner"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The gRPC front end serves avscanner.v1.ScanService from docs/scan.proto.
+// Messages are encoded by hand with protowire, like the HTTP protobuf
+// responses, so no generated code is needed.
+const grpcServiceName = "avscanner.v1.ScanService"
+
+// grpcMessageOverhead is allowed on top of MAX_FILE_SIZE for the other
+// fields of a Scan request
+const grpcMessageOverhead = 64 * 1024
+
+// GRPCServer returns a gRPC server with ScanService registered. It applies
+// the same authentication, maintenance mode and size limit as the HTTP API.
+func (a *API) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(wireCodec{}),
+		grpc.MaxRecvMsgSize(int(a.config.MaxFileSize+grpcMessageOverhead)),
+		grpc.UnaryInterceptor(a.grpcUnaryInterceptor),
+		grpc.StreamInterceptor(a.grpcStreamInterceptor),
+	)
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: grpcServiceName,
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			unaryMethod("Scan", a.grpcScan),
+			unaryMethod("Health", a.grpcHealth),
+			unaryMethod("Engines", a.grpcEngines),
+		},
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "ScanStream",
+			Handler:       func(_ any, stream grpc.ServerStream) error { return a.grpcScanStream(stream) },
+			ClientStreams: true,
+		}},
+		Metadata: "scan.proto",
+	}, a)
+	return srv
+}
+
+func unaryMethod[Req any](name string, handle func(context.Context, *Req) (rawMessage, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			call := func(ctx context.Context, req any) (any, error) {
+				resp, err := handle(ctx, req.(*Req))
+				if err != nil {
+					return nil, err
+				}
+				return resp, nil
+			}
+			if interceptor == nil {
+				return call(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/" + name}
+			return interceptor(ctx, req, info, call)
+		},
+	}
+}
+
+func (a *API) grpcScan(ctx context.Context, req *scanChunk) (rawMessage, error) {
+	if err := a.grpcRejectDuringMaintenance(); err != nil {
+		return nil, err
+	}
+	if err := a.grpcRejectAbuser(ctx); err != nil {
+		return nil, err
+	}
+	if int64(len(req.data)) > a.config.MaxFileSize {
+		return nil, status.Error(codes.ResourceExhausted, "File too large")
+	}
+	u, err := a.grpcReceive(ctx, req, bytes.NewReader(req.data))
+	if err != nil {
+		return nil, err
+	}
+	return a.grpcScanUpload(u)
+}
+
+// grpcScanStream scans a file sent as a stream of chunks. The first chunk
+// carries the file name, MIME type and tags.
+func (a *API) grpcScanStream(stream grpc.ServerStream) error {
+	if err := a.grpcRejectDuringMaintenance(); err != nil {
+		return err
+	}
+	if err := a.grpcRejectAbuser(stream.Context()); err != nil {
+		return err
+	}
+	first := new(scanChunk)
+	if err := stream.RecvMsg(first); err != nil {
+		if err == io.EOF {
+			return status.Error(codes.InvalidArgument, "No chunks received")
+		}
+		return err
+	}
+	src := &chunkReader{stream: stream, data: first.data}
+	u, err := a.grpcReceive(stream.Context(), first, &limitedReader{r: src, n: a.config.MaxFileSize})
+	if err != nil {
+		return err
+	}
+	resp, err := a.grpcScanUpload(u)
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(resp)
+}
+
+// grpcReceive validates request fields and saves src to the upload directory
+func (a *API) grpcReceive(ctx context.Context, req *scanChunk, src io.Reader) (*upload, error) {
+	tags, err := parseScanTags(req.tags, a.config.ScanTagKeys)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid tag: "+err.Error())
+	}
+	// Engine selection is HTTP-only; reserved engines are still skipped
+	engines, err := a.scanEngines(ctx, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	fileName := req.fileName
+	if fileName == "" {
+		fileName = "upload"
+	}
+
+	u, err := a.saveUpload(src, fileName, a.grpcOrigin(ctx), tags, scanner.ScanOptions{
+		MimeType: req.mimeType,
+		DryRun:   req.dryRun,
+		Engines:  engines,
+		Trace:    grpcTrace(ctx),
+	})
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, status.Error(codes.ResourceExhausted, "File too large")
+	}
+	if _, ok := status.FromError(err); ok && err != nil {
+		// The stream failed, e.g. the client cancelled
+		return nil, err
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to save uploaded file")
+	}
+	u.noCache = req.noCache
+	return u, nil
+}
+
+func (a *API) grpcScanUpload(u *upload) (rawMessage, error) {
+	result, err := a.scanUpload(u)
+	var throttled *scanner.ThrottledError
+	if errors.As(err, &throttled) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	a.finishScan(u, result, err)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Scan failed: "+err.Error())
+	}
+	return encodeScanProtobuf(u.fileName, result), nil
+}
+
+func (a *API) grpcHealth(ctx context.Context, _ *rawMessage) (rawMessage, error) {
+	activeEngine := a.scanner.ActiveEngine()
+	statusText := "unhealthy"
+	var engines []byte
+	for _, h := range a.scanner.CheckHealth() {
+		if h.Engine == activeEngine && h.Healthy {
+			statusText = "healthy"
+		}
+		engines = protowire.AppendTag(engines, 3, protowire.BytesType)
+		engines = protowire.AppendBytes(engines, encodeEngineHealthProtobuf(h))
+	}
+
+	var b []byte
+	b = appendProtoString(b, 1, statusText)
+	b = appendProtoString(b, 2, string(activeEngine))
+	b = append(b, engines...)
+	if a.maintenance.status().Enabled {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	return b, nil
+}
+
+func (a *API) grpcEngines(ctx context.Context, _ *rawMessage) (rawMessage, error) {
+	activeEngine := a.scanner.ActiveEngine()
+	var b []byte
+	b = appendProtoString(b, 1, string(activeEngine))
+	for _, e := range a.scanner.GetEngineInfo() {
+		var engine []byte
+		engine = appendProtoString(engine, 1, string(e.Engine))
+		engine = appendProtoBool(engine, 2, e.Available)
+		engine = appendProtoBool(engine, 3, e.RTSEnabled)
+		engine = appendProtoBool(engine, 4, e.ManualScanAvailable)
+		engine = appendProtoBool(engine, 5, slices.Contains(a.scanner.Engines(), e.Engine))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, engine)
+	}
+	return b, nil
+}
+
+func encodeEngineHealthProtobuf(h *drivers.EngineHealth) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, string(h.Engine))
+	b = appendProtoBool(b, 2, h.Healthy)
+	b = appendProtoString(b, 3, h.Version)
+	b = appendProtoString(b, 4, h.Error)
+	if !h.LastCheck.IsZero() {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(h.LastCheck.UnixMilli()))
+	}
+	return b
+}
+
+func appendProtoBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func (a *API) grpcRejectDuringMaintenance() error {
+	maintenance := a.maintenance.status()
+	if !maintenance.Enabled {
+		return nil
+	}
+	return status.Error(codes.Unavailable, maintenance.message())
+}
+
+func (a *API) grpcRejectAbuser(ctx context.Context) error {
+	caller := contextCallerName(ctx)
+	if a.abuse.blocked(caller) == 0 {
+		return nil
+	}
+	metrics.RecordAbuseRefusal(caller)
+	return status.Error(codes.ResourceExhausted, "too many infected submissions")
+}
+
+// Interceptors
+
+func (a *API) grpcUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx, err := a.grpcAuthenticate(ctx, info.FullMethod)
+	if err == nil {
+		err = a.grpcRateLimit(ctx)
+	}
+	var resp any
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	a.logGRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (a *API) grpcStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, err := a.grpcAuthenticate(stream.Context(), info.FullMethod)
+	if err == nil {
+		err = a.grpcRateLimit(ctx)
+	}
+	if err == nil {
+		err = handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+	a.logGRPC(info.FullMethod, start, err)
+	return err
+}
+
+// grpcAuthenticate checks the authorization metadata when authentication
+// is enabled and adds the caller identity to ctx
+func (a *API) grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	if a.authMiddleware == nil {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	source := ""
+	if bans := a.authMiddleware.Bans(); bans != nil {
+		remoteAddr := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			remoteAddr = p.Addr.String()
+		}
+		source = bans.SourceOf(remoteAddr, header)
+	}
+
+	identity, err := a.authMiddleware.Authenticate(ctx, header("authorization"), source, "POST", method)
+	if err != nil {
+		code := codes.Unauthenticated
+		var authErr *auth.AuthError
+		if errors.As(err, &authErr) {
+			switch authErr.Status {
+			case http.StatusForbidden:
+				code = codes.PermissionDenied
+			case http.StatusTooManyRequests:
+				code = codes.ResourceExhausted
+			}
+		}
+		return nil, status.Error(code, err.Error())
+	}
+	return auth.WithCallerIdentity(ctx, identity), nil
+}
+
+func (a *API) logGRPC(method string, start time.Time, err error) {
+	a.logger.Info("gRPC request completed",
+		"method", method,
+		"code", status.Code(err).String(),
+		"duration", time.Since(start).Milliseconds(),
+	)
+}
+
+// authenticatedStream replaces the stream context with one carrying the
+// caller identity
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// Messages
+
+type protoMarshaler interface {
+	marshalProto() []byte
+}
+
+type protoUnmarshaler interface {
+	unmarshalProto(b []byte) error
+}
+
+// wireCodec encodes the hand-written messages below. It is registered
+// under the name "proto" so standard clients interoperate.
+type wireCodec struct{}
+
+func (wireCodec) Name() string { return "proto" }
+
+func (wireCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(protoMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return m.marshalProto(), nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(protoUnmarshaler)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	return m.unmarshalProto(data)
+}
+
+// rawMessage is an already encoded message. Requests without fields are
+// decoded into it and ignored.
+type rawMessage []byte
+
+func (m rawMessage) marshalProto() []byte { return m }
+
+func (m *rawMessage) unmarshalProto(b []byte) error {
+	*m = slices.Clone(b)
+	return nil
+}
+
+// scanChunk decodes ScanRequest and ScanChunk, which share field numbers
+type scanChunk struct {
+	fileName string
+	mimeType string
+	dryRun   bool
+	noCache  bool
+	tags     []string
+	data     []byte
+}
+
+func (c *scanChunk) unmarshalProto(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			switch num {
+			case 1:
+				c.fileName = string(v)
+			case 2:
+				c.mimeType = string(v)
+			case 4:
+				c.tags = append(c.tags, string(v))
+			case 5:
+				// The codec's buffer is reused after Unmarshal returns
+				c.data = slices.Clone(v)
+			}
+		case typ == protowire.VarintType && (num == 3 || num == 6):
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			if num == 3 {
+				c.dryRun = v != 0
+			} else {
+				c.noCache = v != 0
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// chunkReader reads the data of successive ScanChunk messages
+type chunkReader struct {
+	stream grpc.ServerStream
+	data   []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		chunk := new(scanChunk)
+		if err := r.stream.RecvMsg(chunk); err != nil {
+			return 0, err
+		}
+		r.data = chunk.data
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// limitedReader fails with *http.MaxBytesError once more than n bytes are
+// read, matching the HTTP upload limit
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	total int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.total += int64(n)
+	if l.total > l.n {
+		return n, &http.MaxBytesError{Limit: l.n}
+	}
+	return n, err
+}
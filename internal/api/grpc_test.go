@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func newTestGRPCClient(t *testing.T, a *API) *grpc.ClientConn {
+	t.Helper()
+	l := bufconn.Listen(1024 * 1024)
+	srv := a.GRPCServer()
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(wireCodec{})),
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// protoStrings returns the length-delimited fields of a message by number
+func protoStrings(t *testing.T, b []byte) map[protowire.Number][]string {
+	t.Helper()
+	fields := make(map[protowire.Number][]string)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(b)
+			fields[num] = append(fields[num], string(v))
+			n = m
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return fields
+}
+
+func scanRequest(fileName string, data []byte, tags ...string) rawMessage {
+	var b []byte
+	b = appendProtoString(b, 1, fileName)
+	for _, tag := range tags {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+	if data != nil {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, data)
+	}
+	return b
+}
+
+func TestGRPC_Scan(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	conn := newTestGRPCClient(t, api)
+
+	for name, want := range map[string]string{
+		drivers.EICARPattern(): "infected",
+		"hello world":          "clean",
+	} {
+		var resp rawMessage
+		err := conn.Invoke(context.Background(), "/avscanner.v1.ScanService/Scan", scanRequest("test.txt", []byte(name)), &resp)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		fields := protoStrings(t, resp)
+		if fields[2][0] != "test.txt" || fields[3][0] != want {
+			t.Errorf("expected %s test.txt, got %q %q", want, fields[2], fields[3])
+		}
+	}
+}
+
+func TestGRPC_ScanInvalidTag(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	conn := newTestGRPCClient(t, api)
+
+	var resp rawMessage
+	err := conn.Invoke(context.Background(), "/avscanner.v1.ScanService/Scan", scanRequest("a.txt", []byte("a"), "no-equals"), &resp)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestGRPC_ScanStream(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	conn := newTestGRPCClient(t, api)
+
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true}, "/avscanner.v1.ScanService/ScanStream")
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	eicar := []byte(drivers.EICARPattern())
+	chunks := []rawMessage{scanRequest("eicar.com", eicar[:10]), scanRequest("", eicar[10:40]), scanRequest("", eicar[40:])}
+	for _, chunk := range chunks {
+		if err := stream.SendMsg(chunk); err != nil {
+			t.Fatalf("failed to send chunk: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("failed to close stream: %v", err)
+	}
+	var resp rawMessage
+	if err := stream.RecvMsg(&resp); err != nil {
+		t.Fatalf("ScanStream failed: %v", err)
+	}
+	fields := protoStrings(t, resp)
+	if fields[2][0] != "eicar.com" || fields[3][0] != "infected" {
+		t.Errorf("unexpected result: %q %q", fields[2], fields[3])
+	}
+}
+
+func TestGRPC_ScanStreamTooLarge(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.MaxFileSize = 16
+	conn := newTestGRPCClient(t, api)
+
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ClientStreams: true}, "/avscanner.v1.ScanService/ScanStream")
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		stream.SendMsg(scanRequest("big.bin", []byte(strings.Repeat("a", 10))))
+	}
+	stream.CloseSend()
+	var resp rawMessage
+	if err := stream.RecvMsg(&resp); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+}
+
+func TestGRPC_Maintenance(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.maintenance.set(true, "signature update", 0)
+	conn := newTestGRPCClient(t, api)
+
+	var resp rawMessage
+	err := conn.Invoke(context.Background(), "/avscanner.v1.ScanService/Scan", scanRequest("a.txt", []byte("a")), &resp)
+	if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), "signature update") {
+		t.Errorf("expected Unavailable, got %v", err)
+	}
+}
+
+func TestGRPC_HealthAndEngines(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	conn := newTestGRPCClient(t, api)
+
+	var health rawMessage
+	if err := conn.Invoke(context.Background(), "/avscanner.v1.ScanService/Health", rawMessage{}, &health); err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	fields := protoStrings(t, health)
+	if fields[1][0] != "healthy" || fields[2][0] != "mock" || len(fields[3]) == 0 {
+		t.Errorf("unexpected health: %q", fields)
+	}
+
+	var engines rawMessage
+	if err := conn.Invoke(context.Background(), "/avscanner.v1.ScanService/Engines", rawMessage{}, &engines); err != nil {
+		t.Fatalf("Engines failed: %v", err)
+	}
+	if fields := protoStrings(t, engines); fields[1][0] != "mock" || len(fields[2]) == 0 {
+		t.Errorf("unexpected engines: %q", fields)
+	}
+}
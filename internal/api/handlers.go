@@ -1,18 +1,34 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
+	"math"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/rophy/av-scanner/internal/accounting"
 	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/bucketscan"
+	"github.com/rophy/av-scanner/internal/bulkscan"
 	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/feedback"
+	"github.com/rophy/av-scanner/internal/locale"
 	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/objectstore"
+	"github.com/rophy/av-scanner/internal/policy"
 	"github.com/rophy/av-scanner/internal/scanner"
+	"github.com/rophy/av-scanner/internal/schedule"
+	"github.com/rophy/av-scanner/internal/tracing"
 	"github.com/rophy/av-scanner/internal/version"
 )
 
@@ -22,14 +38,47 @@ type API struct {
 	logger         *slog.Logger
 	authMiddleware *auth.Middleware
 	allowlist      *auth.Allowlist
+	maintenance    maintenance
+	tagStats       *tagStats
+	history        *scanHistory
+	abuse          *abuseTracker
+	rateLimits     *rateLimiter   // nil without RATE_LIMIT
+	verdicts       *verdictCache  // nil without VERDICT_CACHE_TTL
+	blocklist      *policy.Policy // nil without BLOCKED_EXTENSIONS and BLOCKED_MIME_TYPES
+	sessions       *sessionStore
+	feedback       *feedback.Store
+	usage          *accounting.Ledger
+	objects        objectstore.Client
+	bucketScan     *bucketscan.Worker
+	pathScans      *bulkscan.PathScans
+	scheduler      *schedule.Scheduler
+	catalogs       *locale.Catalogs
 }
 
 func New(s *scanner.Scanner, cfg *config.Config, logger *slog.Logger) (*API, error) {
 	api := &API{
-		scanner: s,
-		config:  cfg,
-		logger:  logger,
+		scanner:  s,
+		config:   cfg,
+		logger:   logger,
+		tagStats: newTagStats(),
+		history:  newScanHistory(cfg.ScanHistorySize),
+		abuse:    newAbuseTracker(cfg),
+		sessions: newSessionStore(time.Duration(cfg.SessionTTL) * time.Millisecond),
 	}
+	api.rateLimits = newRateLimiter(cfg.RateLimit, cfg.RateLimitBurst)
+	api.verdicts = newVerdictCache(time.Duration(cfg.VerdictCacheTTL)*time.Millisecond, cfg.VerdictCacheSize)
+
+	usage, err := accounting.Open(cfg.UsageFile, accounting.Quota{Scans: cfg.QuotaMonthlyScans, Bytes: cfg.QuotaMonthlyBytes}, logger)
+	if err != nil {
+		return nil, err
+	}
+	api.usage = usage
+
+	blocklist, err := newBlocklist(cfg)
+	if err != nil {
+		return nil, err
+	}
+	api.blocklist = blocklist
 
 	// Initialize auth middleware if enabled
 	if cfg.Auth.Enabled {
@@ -40,6 +89,9 @@ func New(s *scanner.Scanner, cfg *config.Config, logger *slog.Logger) (*API, err
 			time.Duration(cfg.Auth.Timeout)*time.Millisecond,
 			logger,
 		)
+		if cfg.Auth.CacheTTL > 0 {
+			authClient.EnableCache(time.Duration(cfg.Auth.CacheTTL) * time.Millisecond)
+		}
 
 		// Load allowlist
 		allowlist, err := auth.NewAllowlist(cfg.Auth.AllowlistFile, logger)
@@ -53,11 +105,25 @@ func New(s *scanner.Scanner, cfg *config.Config, logger *slog.Logger) (*API, err
 		}
 
 		api.allowlist = allowlist
-		api.authMiddleware = auth.NewMiddleware(authClient, allowlist, logger, []string{
+		skipPaths := []string{
 			"/api/v1/live",
 			"/api/v1/ready",
 			"/metrics",
-		})
+		}
+		if cfg.BucketScanWebhookTokenFile != "" {
+			// Object stores send the webhook token instead
+			skipPaths = append(skipPaths, "/api/v1/bucket-events")
+		}
+		api.authMiddleware = auth.NewMiddleware(authClient, allowlist, logger, skipPaths)
+		if cfg.Auth.BanThreshold > 0 {
+			api.authMiddleware.EnableBans(auth.NewBans(
+				cfg.Auth.BanThreshold,
+				time.Duration(cfg.Auth.BanWindow)*time.Millisecond,
+				time.Duration(cfg.Auth.BanDuration)*time.Millisecond,
+				cfg.Auth.BanSourceHeader,
+				cfg.Auth.BanTrustedProxies,
+			))
+		}
 
 		logger.Info("Authentication enabled",
 			"serviceURL", cfg.Auth.ServiceURL,
@@ -66,31 +132,137 @@ func New(s *scanner.Scanner, cfg *config.Config, logger *slog.Logger) (*API, err
 		)
 	}
 
+	// Load hashes reported as malicious
+	feedbackStore, err := feedback.Open(cfg.FeedbackFile)
+	if err != nil {
+		return nil, err
+	}
+	api.feedback = feedbackStore
+
+	objects, err := objectstore.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	api.objects = objects
+
+	if cfg.MessageCatalogDir != "" {
+		catalogs, err := locale.Load(cfg.MessageCatalogDir)
+		if err != nil {
+			return nil, err
+		}
+		api.catalogs = catalogs
+		logger.Info("Message catalogs loaded", "languages", catalogs.Languages())
+	}
+
 	return api, nil
 }
 
+// Routes returns the scan API. Admin and metrics endpoints are included
+// unless ADMIN_PORT moves them to AdminRoutes.
 func (a *API) Routes() http.Handler {
 	mux := http.NewServeMux()
 
 	// API v1 routes
 	mux.HandleFunc("POST /api/v1/scan", a.handleScan)
+	mux.HandleFunc("POST /api/v1/scan/async", a.handleScanAsync)
+	mux.HandleFunc("PUT /api/v1/scan/stream", a.handleScanStream)
+	mux.HandleFunc("POST /api/v1/scan/url", a.handleScanURL)
+	mux.HandleFunc("POST /api/v1/scan/object", a.handleScanObject)
+	mux.HandleFunc("POST /api/v1/scan/batch", a.handleScanBatch)
+	mux.HandleFunc("GET /api/v1/scan/jobs/{id}", a.handleGetScanJob)
+	mux.HandleFunc("GET /api/v1/scan/jobs/{id}/events", a.handleScanJobEvents)
+	mux.HandleFunc("POST /api/v1/scan/path", a.requireAdmin(a.handleScanPath))
+	mux.HandleFunc("GET /api/v1/scan/path/{id}", a.requireAdmin(a.handleGetPathScan))
+	mux.HandleFunc("DELETE /api/v1/scan/path/{id}", a.requireAdmin(a.handleCancelPathScan))
+	mux.HandleFunc("GET /api/v1/scan/path/{id}/events", a.requireAdmin(a.handlePathScanEvents))
+	mux.HandleFunc("GET /api/v1/schedules", a.requireAdmin(a.handleListSchedules))
+	mux.HandleFunc("GET /api/v1/schedules/{name}", a.requireAdmin(a.handleGetSchedule))
 	mux.HandleFunc("GET /api/v1/health", a.handleHealth)
 	mux.HandleFunc("GET /api/v1/engines", a.handleEngines)
+	mux.HandleFunc("PUT /api/v1/engines/active", a.requireAdmin(a.handleSetActiveEngine))
+	mux.HandleFunc("POST /api/v1/engines/{engine}/update", a.requireAdmin(a.handleStartEngineUpdate))
+	mux.HandleFunc("GET /api/v1/engines/{engine}/update", a.requireAdmin(a.handleGetEngineUpdate))
+	mux.HandleFunc("GET /api/v1/engines/{engine}/definitions", a.requireAdmin(a.handleGetDefinitionSets))
+	mux.HandleFunc("PUT /api/v1/engines/{engine}/definitions", a.requireAdmin(a.handleSwitchDefinitionSet))
 	mux.HandleFunc("GET /api/v1/ready", a.handleReady)
 	mux.HandleFunc("GET /api/v1/live", a.handleLive)
 	mux.HandleFunc("GET /api/v1/version", a.handleVersion)
+	mux.HandleFunc("GET /api/v1/testvectors", a.handleTestVectors)
+	mux.HandleFunc("POST /api/v1/rts/watch", a.handleRTSWatch)
+	mux.HandleFunc("POST /api/v1/feedback", a.handleFeedback)
+	mux.HandleFunc("GET /api/v1/my/results", a.handleMyResults)
+	mux.HandleFunc("GET /api/v1/usage", a.handleUsage)
+	mux.HandleFunc("POST /api/v1/bucket-events", a.handleBucketEvents)
+	mux.HandleFunc("GET /api/v1/quarantine", a.handleListQuarantine)
+	mux.HandleFunc("GET /api/v1/quarantine/{id}", a.handleGetQuarantine)
+	mux.HandleFunc("GET /api/v1/quarantine/{id}/content", a.requireAdmin(a.handleDownloadQuarantine))
+	mux.HandleFunc("DELETE /api/v1/quarantine/{id}", a.requireAdmin(a.handleDeleteQuarantine))
+	mux.HandleFunc("DELETE /api/v1/quarantine", a.requireAdmin(a.handlePurgeQuarantine))
+	mux.HandleFunc("POST /api/v1/sessions", a.handleCreateSession)
+	mux.HandleFunc("GET /api/v1/sessions/{id}", a.handleGetSession)
+	mux.HandleFunc("POST /api/v1/sessions/{id}/files", a.handleAddSessionFile)
+	mux.HandleFunc("POST /api/v1/sessions/{id}/finalize", a.handleFinalizeSession)
+	a.registerCompatRoutes(mux)
+
+	if a.config.AdminPort == 0 {
+		a.registerAdminRoutes(mux)
+	}
+
+	return a.withMiddleware(mux)
+}
+
+// AdminRoutes returns the admin and metrics endpoints for the dedicated
+// admin listener
+func (a *API) AdminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	a.registerAdminRoutes(mux)
+	return a.withMiddleware(mux)
+}
+
+func (a *API) registerAdminRoutes(mux *http.ServeMux) {
+	// Admin routes
+	mux.HandleFunc("GET /api/v1/admin/maintenance", a.requireAdmin(a.handleGetMaintenance))
+	mux.HandleFunc("PUT /api/v1/admin/maintenance", a.requireAdmin(a.handleSetMaintenance))
+	mux.HandleFunc("GET /api/v1/admin/cache", a.requireAdmin(a.handleListCache))
+	mux.HandleFunc("DELETE /api/v1/admin/cache/{path...}", a.requireAdmin(a.handleDeleteCache))
+	mux.HandleFunc("POST /api/v1/admin/definitions", a.requireAdmin(a.handleDefinitionsUpdated))
+	mux.HandleFunc("GET /api/v1/admin/capacity", a.requireAdmin(a.handleCapacity))
+	mux.HandleFunc("GET /api/v1/admin/config", a.requireAdmin(a.handleConfig))
+	mux.HandleFunc("GET /api/v1/admin/stats/tags/{key}", a.requireAdmin(a.handleTagStats))
+	mux.HandleFunc("GET /api/v1/admin/auth/bans", a.requireAdmin(a.handleListBans))
+	mux.HandleFunc("DELETE /api/v1/admin/auth/bans/{source}", a.requireAdmin(a.handleClearBan))
+	mux.HandleFunc("GET /api/v1/admin/abuse", a.requireAdmin(a.handleListAbuse))
+	mux.HandleFunc("DELETE /api/v1/admin/abuse/{caller...}", a.requireAdmin(a.handleClearAbuse))
+	mux.HandleFunc("GET /api/v1/admin/usage", a.requireAdmin(a.handleListUsage))
 
 	// Prometheus metrics endpoint
 	mux.Handle("GET /metrics", metrics.Handler())
+}
 
+func (a *API) withMiddleware(mux *http.ServeMux) http.Handler {
 	// Build middleware chain
 	var handler http.Handler = mux
 
+	// Limit each caller's request rate, once auth has identified the caller
+	handler = a.withRateLimit(handler)
+
 	// Apply auth middleware if enabled (innermost - runs first)
 	if a.authMiddleware != nil {
 		handler = a.authMiddleware.Handler(handler)
+		if slices.Contains(a.config.CompatAPIs, config.CompatVirusTotal) {
+			handler = withAPIKeyHeader(handler)
+		}
 	}
 
+	// Turn handler panics into a 500 for that request
+	handler = a.withRecovery(handler)
+
+	// Negotiate the language of response messages
+	handler = a.withLocale(handler)
+
+	// Compress responses the client accepts compressed
+	handler = a.withCompression(handler)
+
 	// Apply logging middleware
 	handler = a.withLogging(handler)
 
@@ -102,6 +274,14 @@ func (a *API) Routes() http.Handler {
 
 // Close cleans up API resources
 func (a *API) Close() error {
+	if a.feedback != nil {
+		a.feedback.Close()
+	}
+	if a.usage != nil {
+		if err := a.usage.Close(); err != nil {
+			a.logger.Error("Failed to save usage", "error", err)
+		}
+	}
 	if a.allowlist != nil {
 		return a.allowlist.Close()
 	}
@@ -109,60 +289,327 @@ func (a *API) Close() error {
 }
 
 func (a *API) handleScan(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+
+	u, ok := a.receiveUpload(w, r)
+	if !ok {
+		return
+	}
+	a.scanAndRespond(w, r, u)
+}
+
+// scanAndRespond scans a received upload and writes the result in the
+// encoding the client accepts
+func (a *API) scanAndRespond(w http.ResponseWriter, r *http.Request, u *upload) {
+	// Perform scan
+	result, err := a.scanUpload(u)
+	var throttled *scanner.ThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		a.jsonError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	a.finishScan(u, result, err)
+	if err != nil {
+		a.scanFailed(w, err)
+		return
+	}
+	a.setLimitWarnings(w, u.origin.Caller, u.size)
+
+	// Return response
+	switch negotiateEncoding(r.Header.Get("Accept")) {
+	case contentTypeProtobuf:
+		a.binaryResponse(w, contentTypeProtobuf, encodeScanProtobuf(u.fileName, result))
+		return
+	case contentTypeMsgpack:
+		a.binaryResponse(w, contentTypeMsgpack, encodeScanMsgpack(u.fileName, result))
+		return
+	}
+
+	body := scanResultJSON(u.fileName, result)
+	addVerdictMessage(catalogFor(w), body, result.Status)
+	if r.URL.Query().Get("detail") == "true" {
+		addScanDetail(body, result, a.isAdmin(r))
+	}
+	a.jsonResponse(w, body, http.StatusOK)
+}
+
+// upload is a received file waiting to be scanned
+type upload struct {
+	fileID   string
+	fileName string
+	path     string
+	data     []byte // content of an upload scanned in memory, which has no path
+	size     int64
+	hashes   scanner.Hashes
+	tags     map[string]string
+	origin   Origin
+	options  scanner.ScanOptions
+	saved    time.Duration // receiving and storing the upload
+	noCache  bool          // scan even if the verdict is cached
+}
+
+// receiveUpload saves the multipart upload to the upload directory. On
+// failure it writes the error response and returns false.
+func (a *API) receiveUpload(w http.ResponseWriter, r *http.Request) (*upload, bool) {
+	start := time.Now()
+
 	// Parse multipart form (max file size)
 	if err := r.ParseMultipartForm(a.config.MaxFileSize); err != nil {
 		a.jsonError(w, "File too large or invalid form", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
-	file, header, err := r.FormFile("file")
+	header, ok := a.uploadPart(w, r)
+	if !ok {
+		return nil, false
+	}
+	file, err := header.Open()
 	if err != nil {
-		a.jsonError(w, "No file provided. Please upload a file using the 'file' field", http.StatusBadRequest)
-		return
+		a.jsonError(w, "Failed to read uploaded file", http.StatusBadRequest)
+		return nil, false
 	}
 	defer file.Close()
 
-	// Generate file ID and path
+	// Tags may be sent as form fields or query parameters
+	tags, err := parseScanTags(r.Form["tag"], a.config.ScanTagKeys)
+	if err != nil {
+		a.jsonError(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	u, ok := a.storeUpload(w, r, file, header.Filename, header.Header.Get("Content-Type"), tags)
+	if ok {
+		// The form, read before storeUpload, is most of the upload
+		u.saved = time.Since(start)
+	}
+	return u, ok
+}
+
+// uploadPart returns the file sent under one of the UPLOAD_FIELD_NAMES
+// fields. More than one file is refused rather than scanning only the first.
+// On failure it writes the error response and returns false.
+func (a *API) uploadPart(w http.ResponseWriter, r *http.Request) (*multipart.FileHeader, bool) {
+	var headers []*multipart.FileHeader
+	for _, name := range a.uploadFieldNames() {
+		headers = append(headers, r.MultipartForm.File[name]...)
+	}
+	switch len(headers) {
+	case 0:
+		a.jsonError(w, msgNoFile, http.StatusBadRequest)
+		return nil, false
+	case 1:
+		return headers[0], true
+	}
+	a.jsonError(w, "One file per scan; send several files to /api/v1/scan/batch", http.StatusBadRequest)
+	return nil, false
+}
+
+// uploadFieldNames returns the multipart fields uploads are read from
+func (a *API) uploadFieldNames() []string {
+	if len(a.config.UploadFieldNames) == 0 {
+		return []string{"file"}
+	}
+	return a.config.UploadFieldNames
+}
+
+// storeUpload writes an upload body to the upload directory. On failure it
+// writes the error response and returns false.
+func (a *API) storeUpload(w http.ResponseWriter, r *http.Request, src io.Reader, fileName, mimeType string, tags map[string]string) (*upload, bool) {
+	engines, err := a.scanEngines(r.Context(), r.URL.Query()["engine"])
+	if err != nil {
+		a.jsonError(w, err.Error(), engineErrorStatus(err))
+		return nil, false
+	}
+	profile, err := a.scanProfile(r)
+	if err != nil {
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if limit := a.profileMaxSize(profile); limit < a.config.MaxFileSize {
+		src = &limitedReader{r: src, n: limit}
+	}
+
+	// Archive passwords come from the multipart form only, never the URL
+	u, err := a.saveUpload(src, fileName, a.requestOrigin(r), tags, scanner.ScanOptions{
+		MimeType:  mimeType,
+		DryRun:    r.URL.Query().Get("dryRun") == "true",
+		Engines:   engines,
+		Passwords: r.PostForm["password"],
+		Profile:   profile,
+		Trace:     requestTrace(r),
+	})
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		a.jsonError(w, a.tooLargeMessage(profile, tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		a.jsonError(w, "Failed to save uploaded file", http.StatusInternalServerError)
+		return nil, false
+	}
+	u.noCache = noCacheRequested(r)
+	return u, true
+}
+
+// saveUpload writes src to the upload directory, or keeps it in memory when
+// it can be scanned there (MEMORY_SCAN_MAX_SIZE). An error wrapping
+// *http.MaxBytesError means src exceeded its size limit; other errors are
+// logged.
+func (a *API) saveUpload(src io.Reader, fileName string, origin Origin, tags map[string]string, options scanner.ScanOptions) (*upload, error) {
+	options.Caller = origin.Caller
+	start := time.Now()
+
 	fileID := a.scanner.GenerateFileID()
-	filePath := a.scanner.GetUploadPath(fileID, header.Filename)
+	u := &upload{
+		fileID:   fileID,
+		fileName: fileName,
+		tags:     tags,
+		origin:   origin,
+		options:  options,
+	}
+
+	// Small uploads may be scanned without touching the upload directory
+	var head []byte
+	if limit := a.config.MemoryScanMaxSize; limit > 0 {
+		var err error
+		head, err = io.ReadAll(io.LimitReader(src, limit+1))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if !errors.As(err, &tooLarge) {
+				a.logger.Error("Failed to read upload", "error", err)
+			}
+			return nil, err
+		}
+		if size := int64(len(head)); size <= limit && a.scanner.CanScanInMemory(size, fileName, options) {
+			u.data, u.size, u.hashes = head, size, hashContent(head)
+			u.saved = time.Since(start)
+			a.logReceived(u)
+			return u, nil
+		}
+	}
 
 	// Save uploaded file
-	dst, err := os.Create(filePath)
+	dst, filePath, err := a.scanner.CreateUpload(fileID, fileName)
 	if err != nil {
 		a.logger.Error("Failed to create file", "error", err)
-		a.jsonError(w, "Failed to save uploaded file", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	written, err := io.Copy(dst, file)
+	// Hashed while written, so the content is read only once
+	hasher := newContentHasher()
+	written, err := io.Copy(io.MultiWriter(dst, hasher), io.MultiReader(bytes.NewReader(head), src))
 	dst.Close()
 	if err != nil {
-		os.Remove(filePath)
-		a.logger.Error("Failed to write file", "error", err)
-		a.jsonError(w, "Failed to save uploaded file", http.StatusInternalServerError)
-		return
+		a.scanner.DiscardUpload(filePath, fileID)
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			a.logger.Error("Failed to write file", "error", err)
+		}
+		return nil, err
 	}
+	u.hashes = hasher.sum()
+	u.path = a.scanner.FinalizeUploadPath(filePath, fileName, u.hashes.SHA256)
+	u.size = written
+	u.saved = time.Since(start)
+	a.logReceived(u)
+	return u, nil
+}
 
+// logReceived logs a saved upload
+func (a *API) logReceived(u *upload) {
 	a.logger.Info("Received scan request",
-		"fileId", fileID,
-		"originalName", header.Filename,
-		"size", written,
-		"mimeType", header.Header.Get("Content-Type"),
+		"fileId", u.fileID,
+		"originalName", u.fileName,
+		"size", u.size,
+		"mimeType", u.options.MimeType,
+		"tags", u.tags,
+		"caller", u.origin.Caller,
+		"sourceIp", u.origin.IP,
+		"userAgent", u.origin.UserAgent,
+		"inMemory", u.data != nil,
 	)
+}
 
-	// Perform scan
-	result, err := a.scanner.Scan(filePath, fileID, header.Filename, written)
+// scanUpload scans an upload from memory or from the upload directory,
+// charging it to the caller's usage
+func (a *API) scanUpload(u *upload) (*scanner.ScanResponse, error) {
+	if err := a.chargeUsage(u); err != nil {
+		a.scanner.DiscardUpload(u.path, u.fileID)
+		return nil, err
+	}
+	result := a.blocklisted(u)
+	if result == nil {
+		result = a.cachedVerdict(u)
+	}
+	if result != nil {
+		a.scanner.DiscardUpload(u.path, u.fileID)
+		a.scanner.PublishResult(result, u.fileName, u.size, u.options)
+		return result, nil
+	}
+	var err error
+	if u.data != nil {
+		result, err = a.scanner.ScanInMemory(u.data, u.fileID, u.fileName, u.options)
+	} else {
+		result, err = a.scanner.ScanWithOptions(u.path, u.fileID, u.fileName, u.size, u.options)
+	}
+	var throttled *scanner.ThrottledError
+	if errors.As(err, &throttled) {
+		a.refundUsage(u)
+	}
+	return result, err
+}
+
+// finishScan applies caller feedback to a scan result and records it in
+// stats and metrics
+func (a *API) finishScan(u *upload, result *scanner.ScanResponse, err error) {
+	if result != nil {
+		addSaveTiming(result, u.saved)
+		if u.hashes.SHA256 != "" {
+			hashes := u.hashes
+			result.Hashes = &hashes
+		}
+	}
 	if err != nil {
-		a.logger.Error("Scan failed", "error", err, "fileId", fileID)
-		metrics.RecordScan(string(a.config.ActiveEngine), "error")
-		a.jsonError(w, "Scan failed: "+err.Error(), http.StatusInternalServerError)
+		a.logger.Error("Scan failed", "error", err, "fileId", u.fileID)
+		metrics.RecordScan(string(a.scanner.ActiveEngine()), "error")
+		a.tagStats.record(u.tags, u.size, drivers.StatusError)
+		a.recordUploadMetrics(u.origin.Caller, u.fileName, u.size, drivers.StatusError)
+		a.recordHistory(u, nil, err)
 		return
 	}
+	if result.DryRun != nil {
+		result.DryRun.SHA256 = u.hashes.SHA256
+		return
+	}
+	a.cacheVerdict(u, result)
+	a.applyFeedback(result, u.hashes.SHA256)
+	a.tagStats.record(u.tags, u.size, result.Status)
+	a.recordUploadMetrics(u.origin.Caller, u.fileName, u.size, result.Status)
+	a.recordHistory(u, result, nil)
+	if a.abuse != nil && result.Status == drivers.StatusInfected {
+		a.recordAbuse(u, result)
+	}
+}
 
-	// Return response
+// addSaveTiming adds the time taken to receive an upload to its result's
+// timings
+func addSaveTiming(result *scanner.ScanResponse, saved time.Duration) {
+	if result.Timings == nil {
+		// Resolved without the engine, e.g. by policy or the blocklist
+		result.Timings = &scanner.Timings{TotalMs: result.TotalDuration}
+	}
+	result.Timings.SaveMs = saved.Milliseconds()
+	result.Timings.TotalMs += result.Timings.SaveMs
+}
+
+// scanResultJSON builds the JSON scan response
+func scanResultJSON(fileName string, result *scanner.ScanResponse) map[string]interface{} {
 	response := map[string]interface{}{
 		"fileId":   result.FileID,
-		"fileName": header.Filename,
+		"fileName": fileName,
 		"status":   result.Status,
 		"engine":   result.Engine,
 		"duration": result.TotalDuration,
@@ -171,8 +618,71 @@ func (a *API) handleScan(w http.ResponseWriter, r *http.Request) {
 	if result.Signature != "" {
 		response["signature"] = result.Signature
 	}
+	if len(result.Engines) > 0 {
+		response["engines"] = result.Engines
+	}
+	if result.Policy != nil {
+		response["policy"] = result.Policy
+	}
+	if len(result.Children) > 0 {
+		response["children"] = result.Children
+	}
+	if len(result.Findings) > 0 {
+		response["findings"] = result.Findings
+	}
+	if result.Entropy != nil {
+		response["entropy"] = *result.Entropy
+	}
+	if result.FileType != nil {
+		response["fileType"] = result.FileType
+	}
+	if result.DryRun != nil {
+		response["dryRun"] = result.DryRun
+	}
+	if result.Profile != "" {
+		response["profile"] = result.Profile
+	}
+	if result.Timings != nil {
+		response["timings"] = result.Timings
+	}
+	if result.Cached {
+		response["cached"] = true
+	}
+	if result.Hashes != nil {
+		response["hashes"] = result.Hashes
+	}
+	return response
+}
 
-	a.jsonResponse(w, response, http.StatusOK)
+// addScanDetail adds the engine's own result to a scan response, for
+// ?detail=true: which phase decided the verdict and when, the engine's
+// resource usage and, with raw, its output, which may name server paths
+func addScanDetail(body map[string]interface{}, result *scanner.ScanResponse, raw bool) {
+	engineResult := result.ScanResult
+	if engineResult == nil {
+		// Decided without the engine, e.g. by policy or the verdict cache
+		return
+	}
+	detail := map[string]interface{}{
+		"status":    engineResult.Status,
+		"engine":    engineResult.Engine,
+		"phase":     engineResult.Phase,
+		"timestamp": engineResult.Timestamp,
+		"duration":  engineResult.Duration,
+	}
+	if engineResult.Signature != "" {
+		detail["signature"] = engineResult.Signature
+	}
+	if engineResult.ErrorCategory != "" {
+		detail["errorCategory"] = engineResult.ErrorCategory
+	}
+	if engineResult.Usage != nil {
+		detail["usage"] = engineResult.Usage
+	}
+	if raw && engineResult.Raw != nil {
+		detail["raw"] = engineResult.Raw
+	}
+	body["scanResult"] = detail
 }
 
 func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -187,12 +697,16 @@ func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	crashLooping := false
 	engines := make([]map[string]interface{}, 0, len(healthResults))
 	for _, h := range healthResults {
+		stability := a.scanner.EngineStability(h.Engine)
+		crashLooping = crashLooping || stability.CrashLooping
 		engine := map[string]interface{}{
 			"engine":    h.Engine,
 			"healthy":   h.Healthy,
 			"lastCheck": h.LastCheck,
+			"stability": stability,
 		}
 		if h.Version != "" {
 			engine["version"] = h.Version
@@ -200,21 +714,40 @@ func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
 		if h.Error != "" {
 			engine["error"] = h.Error
 		}
+		if h.License != nil {
+			engine["license"] = h.License
+		}
+		if h.Signatures != nil {
+			engine["signatures"] = h.Signatures
+		}
 		engines = append(engines, engine)
 	}
 
+	// A crash-looping engine degrades the service without failing the
+	// health check, since restarting the scanner would not help
 	status := http.StatusOK
 	statusText := "healthy"
 	if !activeHealthy {
 		status = http.StatusServiceUnavailable
 		statusText = "unhealthy"
+	} else if crashLooping {
+		statusText = "degraded"
 	}
 
-	a.jsonResponse(w, map[string]interface{}{
+	response := map[string]interface{}{
 		"status":       statusText,
 		"activeEngine": activeEngine,
 		"engines":      engines,
-	}, status)
+		"maintenance":  a.maintenance.status().Enabled,
+	}
+	if uploadVolume := a.scanner.UploadVolume(); uploadVolume != nil {
+		response["uploadVolume"] = uploadVolume
+	}
+	if definitions := a.scanner.LastDefinitionsUpdate(); definitions != nil {
+		response["definitions"] = definitions
+	}
+
+	a.jsonResponse(w, response, status)
 }
 
 func (a *API) handleEngines(w http.ResponseWriter, r *http.Request) {
@@ -228,7 +761,7 @@ func (a *API) handleEngines(w http.ResponseWriter, r *http.Request) {
 			"available":           e.Available,
 			"rtsEnabled":          e.RTSEnabled,
 			"manualScanAvailable": e.ManualScanAvailable,
-			"active":              e.Engine == activeEngine,
+			"active":              slices.Contains(a.scanner.Engines(), e.Engine),
 		})
 	}
 
@@ -238,7 +771,55 @@ func (a *API) handleEngines(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusOK)
 }
 
+// handleSetActiveEngine switches the active engine without a restart
+func (a *API) handleSetActiveEngine(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Engine config.EngineType `json:"engine"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	previous := a.scanner.ActiveEngine()
+	err := a.scanner.SetActiveEngine(req.Engine)
+	switch {
+	case errors.Is(err, scanner.ErrUnknownEngine):
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, scanner.ErrEngineSwitchRefused):
+		a.jsonError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		a.logger.Error("Failed to switch active engine", "engine", req.Engine, "error", err)
+		a.jsonError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	a.logger.Warn("Active engine changed",
+		"previous", previous,
+		"engine", req.Engine,
+		"caller", callerName(r),
+	)
+	a.handleEngines(w, r)
+}
+
 func (a *API) handleReady(w http.ResponseWriter, r *http.Request) {
+	if a.maintenance.status().Enabled {
+		a.jsonResponse(w, map[string]interface{}{
+			"ready": false,
+			"error": "maintenance mode",
+		}, http.StatusServiceUnavailable)
+		return
+	}
+	if !a.scanner.WarmedUp() {
+		a.jsonResponse(w, map[string]interface{}{
+			"ready": false,
+			"error": "warming up",
+		}, http.StatusServiceUnavailable)
+		return
+	}
+
 	health, err := a.scanner.GetActiveEngineHealth()
 	if err != nil || !health.Healthy {
 		errMsg := "Unknown error"
@@ -275,8 +856,66 @@ func (a *API) jsonResponse(w http.ResponseWriter, data interface{}, status int)
 	json.NewEncoder(w).Encode(data)
 }
 
+func (a *API) binaryResponse(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
 func (a *API) jsonError(w http.ResponseWriter, message string, status int) {
-	a.jsonResponse(w, map[string]string{"error": message}, status)
+	body := map[string]interface{}{"error": message}
+	addErrorMessage(catalogFor(w), body, message)
+	a.jsonResponse(w, body, status)
+}
+
+// scanFailed answers 500 for a failed scan, saying why the engine failed
+// when its output told
+func (a *API) scanFailed(w http.ResponseWriter, err error) {
+	message := "Scan failed: " + err.Error()
+	body := map[string]interface{}{"error": message}
+	addErrorCategory(body, err)
+	addErrorMessage(catalogFor(w), body, message)
+	a.jsonResponse(w, body, http.StatusInternalServerError)
+}
+
+// addErrorCategory adds the engine error category of a failed scan to body
+func addErrorCategory(body map[string]interface{}, err error) {
+	var engineErr *scanner.EngineError
+	if errors.As(err, &engineErr) {
+		body["errorCategory"] = engineErr.Category
+	}
+}
+
+// withRecovery answers 500 when a handler panics, logging the panic with its
+// stack, instead of letting net/http drop the connection. Scanner panics are
+// already recovered per scan; this covers the handlers themselves.
+func (a *API) withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// Deliberate abort of the response
+				panic(v)
+			}
+			metrics.RecordPanic("http")
+			trace, _ := tracing.FromContext(r.Context())
+			a.logger.Error("Recovered from panic",
+				"component", "http",
+				"panic", v,
+				"stack", string(debug.Stack()),
+				"method", r.Method,
+				"path", filepath.Clean(r.URL.Path),
+				"requestId", trace.RequestID,
+			)
+			// Headers may already be sent, in which case the client sees a
+			// truncated response
+			a.jsonError(w, "Internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (a *API) withLogging(next http.Handler) http.Handler {
@@ -284,6 +923,11 @@ func (a *API) withLogging(next http.Handler) http.Handler {
 		start := time.Now()
 		wrapped := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 
+		// Echo the request ID so callers can correlate logs and notifications
+		trace := tracing.FromRequest(r)
+		w.Header().Set(tracing.HeaderRequestID, trace.RequestID)
+		r = r.WithContext(tracing.NewContext(r.Context(), trace))
+
 		next.ServeHTTP(wrapped, r)
 
 		a.logger.Info("Request completed",
@@ -291,6 +935,8 @@ func (a *API) withLogging(next http.Handler) http.Handler {
 			"path", filepath.Clean(r.URL.Path),
 			"status", wrapped.status,
 			"duration", time.Since(start).Milliseconds(),
+			"requestId", trace.RequestID,
+			"traceId", trace.TraceID(),
 		)
 	})
 }
@@ -304,3 +950,15 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift the
+// write deadline for event streams
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -3,17 +3,21 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/rophy/av-scanner/internal/config"
 	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/policy"
 	"github.com/rophy/av-scanner/internal/scanner"
+	"github.com/rophy/av-scanner/internal/volume"
 )
 
 func newTestAPI(t *testing.T) (*API, string) {
@@ -25,11 +29,12 @@ func newTestAPI(t *testing.T) (*API, string) {
 	}
 
 	cfg := &config.Config{
-		Port:         3000,
-		UploadDir:    tmpDir,
-		MaxFileSize:  10 * 1024 * 1024,
-		ActiveEngine: config.EngineMock,
-		LogLevel:     "error",
+		Port:            3000,
+		UploadDir:       tmpDir,
+		MaxFileSize:     10 * 1024 * 1024,
+		ActiveEngine:    config.EngineMock,
+		LogLevel:        "error",
+		MaxNestingDepth: 3,
 		Drivers: map[config.EngineType]config.DriverConfig{
 			config.EngineClamAV:     {Engine: config.EngineClamAV},
 			config.EngineTrendMicro: {Engine: config.EngineTrendMicro},
@@ -132,6 +137,37 @@ func TestAPI_HandleScan_InfectedFile(t *testing.T) {
 	}
 }
 
+// diskFullStore refuses every upload, so only memory scans succeed
+type diskFullStore struct{}
+
+func (diskFullStore) Create(string) (io.WriteCloser, error) { return nil, errors.New("disk full") }
+func (diskFullStore) Link(string, string) error             { return errors.New("disk full") }
+func (diskFullStore) Remove(string) error                   { return nil }
+
+func TestAPI_HandleScan_InMemory(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.MemoryScanMaxSize = 1024
+	api.scanner.SetUploadStore(diskFullStore{})
+
+	scan := func(content []byte) *httptest.ResponseRecorder {
+		body, contentType := createMultipartFile(t, "file", "upload.txt", content)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := scan([]byte(drivers.EICARPattern()))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"status":"infected"`) {
+		t.Errorf("expected a small upload to be scanned in memory, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := scan(bytes.Repeat([]byte("a"), 2048)); rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected a large upload to be written to disk, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestAPI_HandleScan_NoFile(t *testing.T) {
 	api, tmpDir := newTestAPI(t)
 	defer os.RemoveAll(tmpDir)
@@ -169,6 +205,37 @@ func TestAPI_HandleScan_WrongFieldName(t *testing.T) {
 	}
 }
 
+func TestAPI_HandleScan_UploadFieldNames(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.UploadFieldNames = []string{"file", "files[]"}
+
+	scan := func(fields ...string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for _, field := range fields {
+			part, _ := writer.CreateFormFile(field, "test.txt")
+			part.Write([]byte("content"))
+		}
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := scan("files[]"); rr.Code != http.StatusOK {
+		t.Errorf("expected files[] to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := scan("files"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a field not in UPLOAD_FIELD_NAMES, got %d", rr.Code)
+	}
+	if rr := scan("file", "files[]"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for several files, got %d", rr.Code)
+	}
+}
+
 func TestAPI_HandleHealth(t *testing.T) {
 	api, tmpDir := newTestAPI(t)
 	defer os.RemoveAll(tmpDir)
@@ -200,6 +267,38 @@ func TestAPI_HandleHealth(t *testing.T) {
 	}
 }
 
+func TestAPI_HandleHealth_UploadVolume(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	api.scanner.SetUploadVolume(&volume.Report{
+		UploadDir:      tmpDir,
+		Filesystem:     "nfs",
+		WatchSupported: false,
+		Warnings:       []string{"upload directory is on nfs"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	rr := httptest.NewRecorder()
+
+	api.Routes().ServeHTTP(rr, req)
+
+	// Misplacement is reported but does not make the service unhealthy
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		UploadVolume *volume.Report `json:"uploadVolume"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.UploadVolume == nil || resp.UploadVolume.Filesystem != "nfs" || len(resp.UploadVolume.Warnings) != 1 {
+		t.Errorf("expected upload volume warnings in health, got %+v", resp.UploadVolume)
+	}
+}
+
 func TestAPI_HandleEngines(t *testing.T) {
 	api, tmpDir := newTestAPI(t)
 	defer os.RemoveAll(tmpDir)
@@ -228,6 +327,34 @@ func TestAPI_HandleEngines(t *testing.T) {
 	}
 }
 
+func TestAPI_HandleSetActiveEngine(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/engines/active", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := put(`{"engine":"bogus"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rr.Code)
+	}
+
+	rr := put(`{"engine":"clamav"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp["activeEngine"] != "clamav" {
+		t.Errorf("expected activeEngine clamav, got %v", resp["activeEngine"])
+	}
+}
+
 func TestAPI_HandleReady(t *testing.T) {
 	api, tmpDir := newTestAPI(t)
 	defer os.RemoveAll(tmpDir)
@@ -251,6 +378,29 @@ func TestAPI_HandleReady(t *testing.T) {
 	}
 }
 
+func TestAPI_HandleReady_WarmingUp(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	cfg := *api.config
+	cfg.WarmUpScan = true
+	api.scanner = scanner.New(&cfg, api.logger)
+	defer api.scanner.Stop()
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ready", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 while warming up, got %d", rr.Code)
+	}
+
+	api.scanner.WarmUp()
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ready", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 once warmed up, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestAPI_HandleLive(t *testing.T) {
 	api, tmpDir := newTestAPI(t)
 	defer os.RemoveAll(tmpDir)
@@ -303,3 +453,300 @@ func TestAPI_NotFound(t *testing.T) {
 		t.Errorf("expected status 404, got %d", rr.Code)
 	}
 }
+
+func TestAPI_HandleScan_OriginalNaming(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.UploadNaming = config.UploadNamingOriginal
+
+	body, contentType := createMultipartFile(t, "file", "../report.txt", []byte("clean report"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 0 {
+		t.Errorf("expected upload dir to be empty after scan, got %d entries", len(entries))
+	}
+}
+
+func TestAPI_HandleScan_PolicyBlocked(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	p, err := policy.New([]policy.Rule{
+		{Name: "block-scr", Extensions: []string{".scr"}, Action: policy.ActionBlock},
+	})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	api.scanner.SetPolicy(p)
+
+	body, contentType := createMultipartFile(t, "file", "evil.scr", []byte("content"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if resp["status"] != "blocked" {
+		t.Errorf("expected status blocked, got %v", resp["status"])
+	}
+	policyResp, ok := resp["policy"].(map[string]interface{})
+	if !ok || policyResp["rule"] != "block-scr" {
+		t.Errorf("expected policy rule block-scr, got %v", resp["policy"])
+	}
+}
+
+func TestAPI_HandleScan_Entropy(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.EntropyCheck = true
+
+	body, contentType := createMultipartFile(t, "file", "notes.txt", []byte("aaaabbbb"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp["entropy"] != 1.0 {
+		t.Errorf("expected entropy 1, got %v", resp["entropy"])
+	}
+}
+
+func TestAPI_HandleScan_DryRun(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	body, contentType := createMultipartFile(t, "file", "eicar.com", []byte(drivers.EICARPattern()))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan?dryRun=true", body)
+	req.Header.Set("Content-Type", contentType)
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Status string                `json:"status"`
+		DryRun *scanner.DryRunResult `json:"dryRun"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Status != "skipped" {
+		t.Errorf("expected status skipped, got %s", resp.Status)
+	}
+	if resp.DryRun == nil || !resp.DryRun.EngineHealthy || len(resp.DryRun.SHA256) != 64 {
+		t.Errorf("unexpected dry run result: %+v", resp.DryRun)
+	}
+}
+
+func TestAPI_HandleScan_Throttled(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	api.config.ThroughputLimit = 10
+	api.config.ThroughputBurst = 10
+	api.config.ThroughputMode = config.ThroughputReject
+	api.scanner = scanner.New(api.config, api.logger)
+	handler := api.Routes()
+
+	scan := func() *httptest.ResponseRecorder {
+		body, contentType := createMultipartFile(t, "file", "clean.txt", []byte("clean file"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := scan(); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr := scan()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", rr.Header().Get("Retry-After"))
+	}
+}
+
+func TestAPI_RequestIDEcho(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if got := rr.Header().Get("X-Request-ID"); got != "req-123" {
+		t.Errorf("expected X-Request-ID req-123, got %q", got)
+	}
+
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Error("expected a generated X-Request-ID")
+	}
+}
+
+func TestAPI_WithRecovery(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	handler := api.withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler bug")
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "handler bug") {
+		t.Errorf("expected the panic value not to be returned, got %s", rr.Body.String())
+	}
+}
+
+func TestAPI_HandleScan_Timings(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	body, contentType := createMultipartFile(t, "file", "report.pdf", []byte("report"))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Duration int64            `json:"duration"`
+		Timings  *scanner.Timings `json:"timings"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Timings == nil {
+		t.Fatal("expected timings in the response")
+	}
+	if resp.Timings.TotalMs != resp.Duration+resp.Timings.SaveMs || resp.Timings.RTSWaitMs != 0 {
+		t.Errorf("unexpected timings for a %dms scan: %+v", resp.Duration, resp.Timings)
+	}
+}
+
+func TestAPI_HandleScan_Detail(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	scan := func(query string) map[string]interface{} {
+		body, contentType := createMultipartFile(t, "file", "hello.txt", []byte("hello world\n"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	if resp := scan(""); resp["scanResult"] != nil {
+		t.Errorf("expected no scanResult without ?detail=true, got %v", resp["scanResult"])
+	}
+	detail, _ := scan("?detail=true")["scanResult"].(map[string]interface{})
+	if detail["phase"] != "manual" || detail["status"] != "clean" || detail["engine"] != "mock" || detail["timestamp"] == nil {
+		t.Errorf("expected the engine's result under scanResult, got %v", detail)
+	}
+}
+
+func TestAddScanDetail(t *testing.T) {
+	result := &scanner.ScanResponse{
+		Status: drivers.StatusInfected,
+		ScanResult: &drivers.ScanResult{
+			Status:    drivers.StatusInfected,
+			Signature: "Test.Signature",
+			Phase:     drivers.PhaseManual,
+			Raw:       map[string]interface{}{"exitCode": 1},
+		},
+	}
+	body := map[string]interface{}{}
+	addScanDetail(body, result, false)
+	detail := body["scanResult"].(map[string]interface{})
+	if detail["signature"] != "Test.Signature" || detail["raw"] != nil {
+		t.Errorf("expected the signature and no raw output for non-admins, got %v", detail)
+	}
+	addScanDetail(body, result, true)
+	if detail := body["scanResult"].(map[string]interface{}); detail["raw"] == nil {
+		t.Errorf("expected raw output for admins, got %v", detail)
+	}
+
+	body = map[string]interface{}{}
+	addScanDetail(body, &scanner.ScanResponse{Status: drivers.StatusBlocked}, true)
+	if _, ok := body["scanResult"]; ok {
+		t.Errorf("expected no scanResult for a verdict reached without the engine, got %v", body)
+	}
+}
+
+func TestAPI_HandleScan_Hashes(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	want := scanner.Hashes{
+		MD5:    "6f5902ac237024bdd0c176cb93063dc4",
+		SHA1:   "22596363b3de40b06f981fb85d82312e8c0ed511",
+		SHA256: "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447",
+	}
+	// Saved to the upload directory, then scanned in memory
+	for _, memoryLimit := range []int64{0, 1024} {
+		api.config.MemoryScanMaxSize = memoryLimit
+		body, contentType := createMultipartFile(t, "file", "hello.txt", []byte("hello world\n"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var resp struct {
+			Hashes *scanner.Hashes `json:"hashes"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if resp.Hashes == nil || *resp.Hashes != want {
+			t.Errorf("memory limit %d: expected hashes %+v, got %+v", memoryLimit, want, resp.Hashes)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// contentHasher computes an upload's MD5, SHA-1 and SHA-256 as it is
+// written
+type contentHasher struct {
+	md5, sha1, sha256 hash.Hash
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{md5: md5.New(), sha1: sha1.New(), sha256: sha256.New()}
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	h.md5.Write(p)
+	h.sha1.Write(p)
+	h.sha256.Write(p)
+	return len(p), nil
+}
+
+func (h *contentHasher) sum() scanner.Hashes {
+	return scanner.Hashes{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA1:   hex.EncodeToString(h.sha1.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
+
+// hashContent hashes an upload held in memory
+func hashContent(data []byte) scanner.Hashes {
+	h := newContentHasher()
+	h.Write(data)
+	return h.sum()
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// maxHistoryCallers bounds the callers whose results are kept; the least
+// recently active caller's history is dropped to make room
+const maxHistoryCallers = 1000
+
+// HistoryEntry is one scan in a caller's history
+type HistoryEntry struct {
+	FileID    string             `json:"fileId"`
+	FileName  string             `json:"fileName"`
+	Size      int64              `json:"size"`
+	SHA256    string             `json:"sha256,omitempty"`
+	Status    drivers.ScanStatus `json:"status"`
+	Engine    config.EngineType  `json:"engine,omitempty"`
+	Signature string             `json:"signature,omitempty"`
+	Findings  []string           `json:"findings,omitempty"`
+	Tags      map[string]string  `json:"tags,omitempty"`
+	Origin    Origin             `json:"origin"`
+	Error     string             `json:"error,omitempty"`
+	Duration  int64              `json:"duration"`
+	ScannedAt time.Time          `json:"scannedAt"`
+
+	ErrorCategory drivers.ErrorCategory `json:"errorCategory,omitempty"`
+}
+
+// scanHistory keeps each caller's most recent API scan results in memory,
+// so callers can look up their own scans (GET /api/v1/my/results)
+type scanHistory struct {
+	mu       sync.Mutex
+	size     int
+	byCaller map[string][]HistoryEntry // newest first, up to size
+	lastSeen map[string]time.Time
+}
+
+func newScanHistory(size int) *scanHistory {
+	return &scanHistory{
+		size:     size,
+		byCaller: make(map[string][]HistoryEntry),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+func (h *scanHistory) record(caller string, entry HistoryEntry) {
+	if h.size == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.byCaller[caller]; !ok && len(h.byCaller) >= maxHistoryCallers {
+		h.evictLocked()
+	}
+	entries := append([]HistoryEntry{entry}, h.byCaller[caller]...)
+	if len(entries) > h.size {
+		entries = entries[:h.size]
+	}
+	h.byCaller[caller] = entries
+	h.lastSeen[caller] = entry.ScannedAt
+}
+
+// evictLocked drops the least recently active caller
+func (h *scanHistory) evictLocked() {
+	var oldest string
+	for caller, seen := range h.lastSeen {
+		if oldest == "" || seen.Before(h.lastSeen[oldest]) {
+			oldest = caller
+		}
+	}
+	delete(h.byCaller, oldest)
+	delete(h.lastSeen, oldest)
+}
+
+// results returns up to limit of caller's entries with the given status
+// ("" for any), newest first
+func (h *scanHistory) results(caller string, status drivers.ScanStatus, limit int) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]HistoryEntry, 0)
+	for _, entry := range h.byCaller[caller] {
+		if len(result) == limit {
+			break
+		}
+		if status == "" || entry.Status == status {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// recordHistory adds a finished upload scan to its caller's history
+func (a *API) recordHistory(u *upload, result *scanner.ScanResponse, scanErr error) {
+	entry := HistoryEntry{
+		FileID:    u.fileID,
+		FileName:  u.fileName,
+		Size:      u.size,
+		SHA256:    u.hashes.SHA256,
+		Tags:      u.tags,
+		Origin:    u.origin,
+		ScannedAt: time.Now(),
+	}
+	if scanErr != nil {
+		entry.Status = drivers.StatusError
+		entry.Error = "Scan failed: " + scanErr.Error()
+		var engineErr *scanner.EngineError
+		if errors.As(scanErr, &engineErr) {
+			entry.ErrorCategory = engineErr.Category
+		}
+	} else {
+		entry.Status = result.Status
+		entry.Engine = result.Engine
+		entry.Signature = result.Signature
+		entry.Findings = result.Findings
+		entry.Duration = result.TotalDuration
+	}
+	a.history.record(u.origin.Caller, entry)
+}
+
+// handleMyResults lists the calling service account's recent scan results
+// (GET /api/v1/my/results?status=infected&limit=10)
+func (a *API) handleMyResults(w http.ResponseWriter, r *http.Request) {
+	if a.config.ScanHistorySize == 0 {
+		a.jsonError(w, "Scan history is disabled", http.StatusNotImplemented)
+		return
+	}
+	limit := a.config.ScanHistorySize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			a.jsonError(w, "Invalid limit: "+value, http.StatusBadRequest)
+			return
+		}
+		limit = min(n, limit)
+	}
+	status := drivers.ScanStatus(r.URL.Query().Get("status"))
+
+	caller := callerName(r)
+	a.jsonResponse(w, map[string]interface{}{
+		"caller":  caller,
+		"results": a.history.results(caller, status, limit),
+	}, http.StatusOK)
+}
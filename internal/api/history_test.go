@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestAPI_HandleMyResults(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	get := func(query string) (*httptest.ResponseRecorder, []HistoryEntry) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/my/results"+query, nil)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		var response struct {
+			Caller  string         `json:"caller"`
+			Results []HistoryEntry `json:"results"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response.Results
+	}
+
+	if rr, _ := get(""); rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501 while disabled, got %d", rr.Code)
+	}
+
+	api.config.ScanHistorySize = 2
+	api.history = newScanHistory(2)
+	for i, content := range []string{drivers.EICARPattern(), "one", "two"} {
+		body, contentType := createMultipartFile(t, "file", fmt.Sprintf("file%d.txt", i), []byte(content))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("scan failed: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	// Another caller's scans are not listed
+	api.history.record("cluster/team/other", HistoryEntry{FileName: "theirs.txt", Status: drivers.StatusClean, ScannedAt: time.Now()})
+
+	rr, results := get("")
+	if rr.Code != http.StatusOK || len(results) != 2 || results[0].FileName != "file2.txt" || results[1].FileName != "file1.txt" {
+		t.Errorf("expected the two most recent scans, newest first, got %d: %+v", rr.Code, results)
+	}
+	if _, results := get("?limit=1"); len(results) != 1 {
+		t.Errorf("expected one result with limit=1, got %+v", results)
+	}
+	if _, results := get("?status=infected"); len(results) != 0 {
+		t.Errorf("expected the infected scan to have been pushed out, got %+v", results)
+	}
+	if rr, _ := get("?limit=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for limit=0, got %d", rr.Code)
+	}
+}
+
+func TestScanHistory_Eviction(t *testing.T) {
+	h := newScanHistory(5)
+	start := time.Now()
+	for i := range maxHistoryCallers + 1 {
+		h.record(fmt.Sprintf("caller-%d", i), HistoryEntry{ScannedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+	if len(h.byCaller) != maxHistoryCallers {
+		t.Errorf("expected %d callers, got %d", maxHistoryCallers, len(h.byCaller))
+	}
+	if len(h.results("caller-0", "", 5)) != 0 || len(h.results(fmt.Sprintf("caller-%d", maxHistoryCallers), "", 5)) != 1 {
+		t.Error("expected the least recently active caller to be evicted")
+	}
+}
+
+func TestAPI_HandleMyResults_Origin(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanHistorySize = 5
+	api.history = newScanHistory(5)
+
+	scan := func(forwardedFor string) Origin {
+		t.Helper()
+		body, contentType := createMultipartFile(t, "file", "report.pdf", []byte("report"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("User-Agent", "payments-uploader/2.1")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = "10.0.0.7:51234"
+		api.Routes().ServeHTTP(httptest.NewRecorder(), req)
+		return api.history.results(anonymousCaller, "", 1)[0].Origin
+	}
+
+	// The forwarded address is only trusted when configured
+	origin := scan("203.0.113.9")
+	if origin.IP != "10.0.0.7" || origin.UserAgent != "payments-uploader/2.1" || origin.Caller != anonymousCaller || origin.ReceivedAt.IsZero() {
+		t.Errorf("unexpected origin: %+v", origin)
+	}
+	api.config.Auth.BanSourceHeader = "X-Forwarded-For"
+	if origin := scan("198.51.100.1, 203.0.113.9"); origin.IP != "203.0.113.9" {
+		t.Errorf("expected the forwarded address, got %+v", origin)
+	}
+}
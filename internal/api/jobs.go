@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/locale"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// jobQueueRetryAfter is the Retry-After hint (seconds) when the async queue is full
+const jobQueueRetryAfter = "5"
+
+// handleScanAsync accepts an upload and scans it in the background, so
+// clients behind short load balancer timeouts are not held for the scan.
+// The result is polled from GET /api/v1/scan/jobs/{id}.
+func (a *API) handleScanAsync(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+
+	u, ok := a.receiveUpload(w, r)
+	if !ok {
+		return
+	}
+	job, ok := a.submitUpload(w, u)
+	if !ok {
+		return
+	}
+
+	a.setLimitWarnings(w, u.origin.Caller, u.size)
+	w.Header().Set("Location", "/api/v1/scan/jobs/"+job.ID)
+	a.jsonResponse(w, job, http.StatusAccepted)
+}
+
+// submitUpload queues a received upload for a background scan. On failure it
+// writes the error response and returns false.
+func (a *API) submitUpload(w http.ResponseWriter, u *upload) (*scanner.Job, bool) {
+	var throttled *scanner.ThrottledError
+	if err := a.chargeUsage(u); errors.As(err, &throttled) {
+		a.scanner.DiscardUpload(u.path, u.fileID)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		a.jsonError(w, err.Error(), http.StatusTooManyRequests)
+		return nil, false
+	}
+	result := a.blocklisted(u)
+	if result == nil {
+		result = a.cachedVerdict(u)
+	}
+	job, err := a.scanner.SubmitJob(scanner.JobRequest{
+		FilePath:     u.path,
+		Data:         u.data,
+		FileID:       u.fileID,
+		OriginalName: u.fileName,
+		Size:         u.size,
+		SHA256:       u.hashes.SHA256,
+		Caller:       u.origin.Caller,
+		Options:      u.options,
+		Result:       result,
+		Done: func(result *scanner.ScanResponse, err error) {
+			a.finishScan(u, result, err)
+		},
+	})
+	if err != nil {
+		a.refundUsage(u)
+	}
+	switch {
+	case errors.Is(err, scanner.ErrAsyncDisabled):
+		a.jsonError(w, err.Error(), http.StatusNotImplemented)
+		return nil, false
+	case errors.Is(err, scanner.ErrJobQueueFull):
+		w.Header().Set("Retry-After", jobQueueRetryAfter)
+		a.jsonError(w, err.Error(), http.StatusTooManyRequests)
+		return nil, false
+	case err != nil:
+		a.jsonError(w, "Failed to queue scan: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return job, true
+}
+
+// handleGetScanJob reports a job's status, with the scan result once it has
+// completed. Finished jobs expire after ASYNC_JOB_TTL.
+func (a *API) handleGetScanJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.getJob(r, r.PathValue("id"))
+	if !ok {
+		a.jsonError(w, "Unknown or expired job", http.StatusNotFound)
+		return
+	}
+
+	// A completed verdict never changes, so caches may keep it until the job
+	// expires. Pending and failed jobs must be refetched.
+	if job.Status == scanner.JobCompleted {
+		etag := verdictETag(job.SHA256, job.DefinitionsVersion)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(time.Until(*job.ExpiresAt).Seconds())))
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	a.jsonResponse(w, scanJobJSON(job, catalogFor(w)), http.StatusOK)
+}
+
+// getJob returns a job if the caller submitted it or is an admin. Other
+// callers are told it does not exist, as for sessions.
+func (a *API) getJob(r *http.Request, id string) (*scanner.Job, bool) {
+	job, ok := a.scanner.GetJob(id)
+	if !ok || (job.Caller != callerName(r) && !a.isAdmin(r)) {
+		return nil, false
+	}
+	return job, true
+}
+
+// scanJobJSON is a job's status, with the scan result once it has completed
+// and its messages in catalog's language
+func scanJobJSON(job *scanner.Job, catalog *locale.Catalog) map[string]interface{} {
+	response := map[string]interface{}{
+		"jobId":     job.ID,
+		"status":    job.Status,
+		"fileName":  job.FileName,
+		"createdAt": job.CreatedAt,
+	}
+	if job.StartedAt != nil {
+		response["startedAt"] = job.StartedAt
+	}
+	if job.CompletedAt != nil {
+		response["completedAt"] = job.CompletedAt
+		response["expiresAt"] = job.ExpiresAt
+	}
+	if job.Result != nil {
+		result := scanResultJSON(job.FileName, job.Result)
+		addVerdictMessage(catalog, result, job.Result.Status)
+		response["result"] = result
+	}
+	if job.Error != nil {
+		message := "Scan failed: " + job.Error.Error()
+		response["error"] = message
+		addErrorCategory(response, job.Error)
+		addErrorMessage(catalog, response, message)
+	}
+	return response
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func TestAPI_HandleScanAsync(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.AsyncWorkers = 1
+	api.config.AsyncQueueSize = 10
+	api.scanner = scanner.New(api.config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer api.scanner.Stop()
+
+	body, contentType := createMultipartFile(t, "file", "eicar.com", []byte(drivers.EICARPattern()))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan/async", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var accepted scanner.Job
+	if err := json.Unmarshal(rr.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if rr.Header().Get("Location") != "/api/v1/scan/jobs/"+accepted.ID {
+		t.Errorf("unexpected Location: %s", rr.Header().Get("Location"))
+	}
+
+	var job struct {
+		Status scanner.JobStatus      `json:"status"`
+		Result map[string]interface{} `json:"result"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != scanner.JobCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/scan/jobs/"+accepted.ID, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		json.Unmarshal(rr.Body.Bytes(), &job)
+	}
+	if job.Status != scanner.JobCompleted || job.Result["status"] != "infected" {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	etag := rr.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) || !strings.HasPrefix(rr.Header().Get("Cache-Control"), "max-age=") {
+		t.Errorf("expected caching headers, got ETag %q and Cache-Control %q", etag, rr.Header().Get("Cache-Control"))
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/scan/jobs/"+accepted.ID, nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected status 304, got %d", rr.Code)
+	}
+}
+
+func TestAPI_HandleGetScanJob_NotFound(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/scan/jobs/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestAPI_HandleGetScanJob_OtherCaller(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.AsyncWorkers = 1
+	api.config.AsyncQueueSize = 10
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	api.scanner = scanner.New(api.config, logger)
+	defer api.scanner.Stop()
+
+	allowlistFile := filepath.Join(tmpDir, "allowlist.yaml")
+	content := `allowlist:
+  - prod/ns1/sa1
+  - prod/ns2/sa2
+admins:
+  - prod/ops/operator
+`
+	if err := os.WriteFile(allowlistFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write allowlist: %v", err)
+	}
+	allowlist, err := auth.NewAllowlist(allowlistFile, logger)
+	if err != nil {
+		t.Fatalf("failed to create allowlist: %v", err)
+	}
+	api.allowlist = allowlist
+	api.authMiddleware = auth.NewMiddleware(nil, allowlist, logger, nil)
+
+	job, err := api.scanner.SubmitJob(scanner.JobRequest{
+		FileID:       "job-1",
+		OriginalName: "secret.pdf",
+		Caller:       "prod/ns1/sa1",
+		Result:       &scanner.ScanResponse{FileID: "job-1", Status: drivers.StatusClean},
+	})
+	if err != nil {
+		t.Fatalf("failed to submit job: %v", err)
+	}
+
+	get := func(namespace, serviceAccount string) int {
+		ctx := auth.WithCallerIdentity(context.Background(), &auth.CallerIdentity{
+			Cluster: "prod", Namespace: namespace, ServiceAccount: serviceAccount,
+		})
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/scan/jobs/"+job.ID, nil).WithContext(ctx)
+		req.SetPathValue("id", job.ID)
+		rr := httptest.NewRecorder()
+		api.handleGetScanJob(rr, req)
+		return rr.Code
+	}
+	if code := get("ns1", "sa1"); code != http.StatusOK {
+		t.Errorf("expected the submitter to get 200, got %d", code)
+	}
+	if code := get("ns2", "sa2"); code != http.StatusNotFound {
+		t.Errorf("expected another caller to get 404, got %d", code)
+	}
+	if code := get("ops", "operator"); code != http.StatusOK {
+		t.Errorf("expected an admin to get 200, got %d", code)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// headerWarning carries soft limit warnings on successful responses
+const headerWarning = "X-AV-Warning"
+
+// setLimitWarnings adds an X-AV-Warning value, e.g. "file-size; usage=92%",
+// for each limit at least SOFT_LIMIT_PERCENT used, so clients can slow down
+// or split files before they are rejected. size is the largest file in the
+// request, charged to caller's monthly quota.
+func (a *API) setLimitWarnings(w http.ResponseWriter, caller string, size int64) {
+	if a.config.SoftLimitPercent == 0 {
+		return
+	}
+	usage := a.scanner.LimitUsage()
+	for _, limit := range []struct {
+		name string
+		used float64
+	}{
+		{"file-size", float64(size) / float64(a.config.MaxFileSize)},
+		{"throughput", usage.Throughput},
+		{"async-queue", usage.AsyncQueue},
+		{"scan-queue", usage.ScanQueue},
+		{"quota", a.quotaUsage(caller)},
+	} {
+		if percent := int(math.Round(limit.used * 100)); percent >= a.config.SoftLimitPercent {
+			w.Header().Add(headerWarning, fmt.Sprintf("%s; usage=%d%%", limit.name, percent))
+		}
+	}
+}
+
+// quotaUsage is the share of its monthly quota the caller has used, scans or
+// bytes whichever is further along, or 0 without a quota
+func (a *API) quotaUsage(caller string) float64 {
+	if a.usage == nil {
+		return 0
+	}
+	quota := a.usage.Quota()
+	usage := a.usage.Usage(caller, "")
+	used := 0.0
+	if quota.Scans > 0 {
+		used = float64(usage.Scans) / float64(quota.Scans)
+	}
+	if quota.Bytes > 0 {
+		used = max(used, float64(usage.Bytes)/float64(quota.Bytes))
+	}
+	return used
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/accounting"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func TestAPI_LimitWarnings(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	api.config.MaxFileSize = 1000
+	api.config.ThroughputLimit = 1
+	api.config.ThroughputBurst = 1000
+	api.config.SoftLimitPercent = 80
+	api.scanner = scanner.New(api.config, api.logger)
+	handler := api.Routes()
+
+	scan := func(size int) *httptest.ResponseRecorder {
+		body, contentType := createMultipartFile(t, "file", "clean.txt", bytes.Repeat([]byte("a"), size))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	if warnings := scan(100).Header().Values(headerWarning); len(warnings) != 0 {
+		t.Errorf("expected no warnings below the threshold, got %q", warnings)
+	}
+	want := []string{"file-size; usage=85%", "throughput; usage=95%"}
+	if warnings := scan(850).Header().Values(headerWarning); !reflect.DeepEqual(warnings, want) {
+		t.Errorf("expected %q, got %q", want, warnings)
+	}
+
+	api.config.SoftLimitPercent = 0
+	if warnings := scan(10).Header().Values(headerWarning); len(warnings) != 0 {
+		t.Errorf("expected no warnings when disabled, got %q", warnings)
+	}
+}
+
+func TestAPI_LimitWarnings_Quota(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	api.config.SoftLimitPercent = 80
+	usage, err := accounting.Open("", accounting.Quota{Scans: 10, Bytes: 1 << 20}, api.logger)
+	if err != nil {
+		t.Fatalf("failed to open ledger: %v", err)
+	}
+	api.usage = usage
+	handler := api.Routes()
+
+	scan := func() []string {
+		body, contentType := createMultipartFile(t, "file", "clean.txt", []byte("clean"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Values(headerWarning)
+	}
+
+	for range 7 {
+		if warnings := scan(); len(warnings) != 0 {
+			t.Fatalf("expected no warnings below the threshold, got %q", warnings)
+		}
+	}
+	// The eighth scan uses 80% of the scans quota, far more than of bytes
+	if want, warnings := []string{"quota; usage=80%"}, scan(); !reflect.DeepEqual(warnings, want) {
+		t.Errorf("expected %q, got %q", want, warnings)
+	}
+}
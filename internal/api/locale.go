@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/locale"
+)
+
+// With MESSAGE_CATALOG_DIR, JSON responses to clients that send a matching
+// Accept-Language carry a translated "message" next to the fields clients
+// act on: errors keep their English "error" and scan results their
+// "status", so integrations that match on them are unaffected.
+
+// localeWriter carries the catalog negotiated for the request down to
+// jsonError and the scan result writers
+type localeWriter struct {
+	http.ResponseWriter
+	catalog *locale.Catalog
+}
+
+// Flush lets batch streaming flush through the wrapper
+func (lw *localeWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (lw *localeWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+func (a *API) withLocale(next http.Handler) http.Handler {
+	if a.catalogs == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Language")
+		catalog := a.catalogs.Negotiate(r.Header.Get("Accept-Language"))
+		if catalog == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Language", catalog.Language)
+		next.ServeHTTP(&localeWriter{ResponseWriter: w, catalog: catalog}, r)
+	})
+}
+
+// catalogFor returns the catalog negotiated for the response, or nil
+func catalogFor(w http.ResponseWriter) *locale.Catalog {
+	for {
+		switch rw := w.(type) {
+		case *localeWriter:
+			return rw.catalog
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// addVerdictMessage describes status in the catalog's language; a nil
+// catalog leaves body as is
+func addVerdictMessage(catalog *locale.Catalog, body map[string]interface{}, status drivers.ScanStatus) {
+	if catalog != nil {
+		body["message"] = catalog.Verdict(string(status))
+	}
+}
+
+// addErrorMessage translates an error reported in body
+func addErrorMessage(catalog *locale.Catalog, body map[string]interface{}, message string) {
+	if catalog != nil {
+		body["message"] = catalog.Translate(message)
+	}
+}
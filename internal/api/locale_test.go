@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/locale"
+)
+
+func TestAPI_LocalizedMessages(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	dir := filepath.Join(tmpDir, "catalogs")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{
+		"File too large or invalid form": "Datei zu groß oder ungültiges Formular",
+		"verdict.infected": "Schadsoftware gefunden"
+	}`), 0644)
+	catalogs, err := locale.Load(dir)
+	if err != nil {
+		t.Fatalf("locale.Load failed: %v", err)
+	}
+	api.catalogs = catalogs
+
+	request := func(language string, content []byte) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", nil)
+		if content != nil {
+			body, contentType := createMultipartFile(t, "file", "upload.txt", content)
+			req = httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+			req.Header.Set("Content-Type", contentType)
+		}
+		if language != "" {
+			req.Header.Set("Accept-Language", language)
+		}
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response
+	}
+
+	rr, response := request("de-DE, en;q=0.5", nil)
+	if response["error"] != "File too large or invalid form" || response["message"] != "Datei zu groß oder ungültiges Formular" {
+		t.Errorf("expected the English error with a German message, got %v", response)
+	}
+	if rr.Header().Get("Content-Language") != "de" {
+		t.Errorf("expected Content-Language de, got %q", rr.Header().Get("Content-Language"))
+	}
+
+	_, response = request("de", []byte(drivers.EICARPattern()))
+	if response["status"] != "infected" || response["message"] != "Schadsoftware gefunden" {
+		t.Errorf("expected a German verdict, got %v", response)
+	}
+	// Untranslated verdicts fall back to English
+	if _, response = request("de", []byte("hello")); response["message"] != "No threats found" {
+		t.Errorf("expected the English verdict, got %v", response)
+	}
+
+	rr, response = request("fr", nil)
+	if _, ok := response["message"]; ok {
+		t.Errorf("expected no message without a matching catalog, got %v", response)
+	}
+	if rr.Header().Get("Content-Language") != "" || !slices.Contains(rr.Header().Values("Vary"), "Accept-Language") {
+		t.Errorf("unexpected headers: %v", rr.Header())
+	}
+}
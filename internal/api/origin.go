@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/tracing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// maxUserAgentLength bounds the user agent kept with each result
+const maxUserAgentLength = 256
+
+// Origin is where an upload came from. It is kept with the upload's result
+// and logged, to answer which service sent a sample, from where and when.
+type Origin struct {
+	Caller     string    `json:"caller"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// requestOrigin is the origin of an HTTP upload. The address is taken from
+// AUTH_BAN_SOURCE_HEADER when set, as for auth failure bans.
+func (a *API) requestOrigin(r *http.Request) Origin {
+	return newOrigin(callerName(r), auth.SourceAddress(r.RemoteAddr, a.config.Auth.BanSourceHeader, a.config.Auth.BanTrustedProxies, r.Header.Get), r.UserAgent())
+}
+
+// grpcOrigin is requestOrigin for gRPC uploads
+func (a *API) grpcOrigin(ctx context.Context) Origin {
+	remoteAddr, header := grpcPeer(ctx)
+	return newOrigin(contextCallerName(ctx), auth.SourceAddress(remoteAddr, a.config.Auth.BanSourceHeader, a.config.Auth.BanTrustedProxies, header), header("user-agent"))
+}
+
+// grpcPeer returns a gRPC call's peer address and a lookup of its metadata,
+// the counterparts of an HTTP request's RemoteAddr and headers
+func grpcPeer(ctx context.Context) (remoteAddr string, header func(name string) string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header = func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	return remoteAddr, header
+}
+
+// requestTrace returns the request ID and trace context the middleware read
+func requestTrace(r *http.Request) tracing.Context {
+	if trace, ok := tracing.FromContext(r.Context()); ok {
+		return trace
+	}
+	return tracing.FromRequest(r)
+}
+
+// grpcTrace reads a gRPC call's request ID and trace context from its
+// metadata
+func grpcTrace(ctx context.Context) tracing.Context {
+	_, header := grpcPeer(ctx)
+	return tracing.FromHeader(header)
+}
+
+func newOrigin(caller, ip, userAgent string) Origin {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return Origin{Caller: caller, IP: ip, UserAgent: userAgent, ReceivedAt: time.Now()}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// scanProfile returns the scan profile requested with ?profile=, empty when
+// none was. standard is always allowed; fast and thorough only when listed
+// in SCAN_PROFILES.
+func (a *API) scanProfile(r *http.Request) (config.ScanProfile, error) {
+	profile := config.ScanProfile(r.URL.Query().Get("profile"))
+	switch profile {
+	case "", config.ProfileStandard:
+		return profile, nil
+	case config.ProfileFast, config.ProfileThorough:
+		if !slices.Contains(a.config.ScanProfiles, profile) {
+			return "", fmt.Errorf("scan profile not in SCAN_PROFILES: %s", profile)
+		}
+		return profile, nil
+	}
+	return "", fmt.Errorf("unknown scan profile: %s", profile)
+}
+
+// profileMaxSize is the largest upload accepted under a profile
+func (a *API) profileMaxSize(profile config.ScanProfile) int64 {
+	if profile == config.ProfileFast && a.config.ScanProfileFastMaxSize > 0 {
+		return min(a.config.ScanProfileFastMaxSize, a.config.MaxFileSize)
+	}
+	return a.config.MaxFileSize
+}
+
+// tooLargeMessage explains a *http.MaxBytesError for an upload under profile
+func (a *API) tooLargeMessage(profile config.ScanProfile, limit int64) string {
+	if profile == config.ProfileFast && limit < a.config.MaxFileSize {
+		return fmt.Sprintf("File too large for the fast profile (at most %d bytes)", limit)
+	}
+	return "File too large"
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestAPI_ScanProfiles(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanProfiles = []config.ScanProfile{config.ProfileFast}
+	api.config.ScanProfileFastMaxSize = 16
+
+	scan := func(query string, content []byte) *httptest.ResponseRecorder {
+		body, contentType := createMultipartFile(t, "file", "test.txt", content)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := scan("?profile=fast", []byte("small"))
+	var result map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if rr.Code != http.StatusOK || result["profile"] != "fast" {
+		t.Errorf("expected a fast scan, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := scan("?profile=fast", bytes.Repeat([]byte("a"), 17)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 over the fast size cap, got %d", rr.Code)
+	}
+	if rr := scan("?profile=standard", bytes.Repeat([]byte("a"), 17)); rr.Code != http.StatusOK {
+		t.Errorf("expected standard to be allowed without a cap, got %d", rr.Code)
+	}
+	if rr := scan("?profile=thorough", []byte("small")); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a profile not in SCAN_PROFILES, got %d", rr.Code)
+	}
+	if rr := scan("?profile=ludicrous", []byte("small")); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown profile, got %d", rr.Code)
+	}
+}
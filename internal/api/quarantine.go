@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rophy/av-scanner/internal/quarantine"
+)
+
+// quarantineStore returns the quarantine store, or writes 501 if quarantine
+// is not configured
+func (a *API) quarantineStore(w http.ResponseWriter) *quarantine.Store {
+	store := a.scanner.Quarantine()
+	if store == nil {
+		a.jsonError(w, "Quarantine is not enabled", http.StatusNotImplemented)
+	}
+	return store
+}
+
+// mayViewQuarantined reports whether the caller may see an entry. Admins see
+// every entry, other callers only their own uploads.
+func (a *API) mayViewQuarantined(r *http.Request, entry quarantine.Entry) bool {
+	return a.isAdmin(r) || entry.Caller == callerName(r)
+}
+
+// handleListQuarantine lists quarantined files visible to the caller
+func (a *API) handleListQuarantine(w http.ResponseWriter, r *http.Request) {
+	store := a.quarantineStore(w)
+	if store == nil {
+		return
+	}
+
+	entries, err := store.List()
+	if err != nil {
+		a.logger.Error("Failed to list quarantine", "error", err)
+		a.jsonError(w, "Failed to list quarantine", http.StatusInternalServerError)
+		return
+	}
+	visible := make([]quarantine.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if a.mayViewQuarantined(r, entry) {
+			visible = append(visible, entry)
+		}
+	}
+
+	a.jsonResponse(w, map[string]interface{}{"entries": visible}, http.StatusOK)
+}
+
+// handleGetQuarantine returns a quarantined file's metadata
+func (a *API) handleGetQuarantine(w http.ResponseWriter, r *http.Request) {
+	store := a.quarantineStore(w)
+	if store == nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	entry, err := store.Get(id)
+	if errors.Is(err, quarantine.ErrNotFound) || (err == nil && !a.mayViewQuarantined(r, *entry)) {
+		a.jsonError(w, "Quarantine entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to read quarantine entry", "id", id, "error", err)
+		a.jsonError(w, "Failed to read quarantine entry", http.StatusInternalServerError)
+		return
+	}
+
+	a.jsonResponse(w, entry, http.StatusOK)
+}
+
+// handleDownloadQuarantine returns a quarantined file, decrypted. Every
+// download is logged, since the content is live malware.
+func (a *API) handleDownloadQuarantine(w http.ResponseWriter, r *http.Request) {
+	store := a.quarantineStore(w)
+	if store == nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	entry, err := store.Get(id)
+	var data []byte
+	if err == nil {
+		data, err = store.Content(id)
+	}
+	if errors.Is(err, quarantine.ErrNotFound) {
+		a.jsonError(w, "Quarantined content not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to read quarantined file", "id", id, "error", err)
+		a.jsonError(w, "Failed to read quarantined file", http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.Warn("Quarantined file downloaded",
+		"id", id,
+		"fileName", entry.FileName,
+		"sha256", entry.SHA256,
+		"caller", callerName(r),
+	)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(entry.FileName))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleDeleteQuarantine removes a quarantined file
+func (a *API) handleDeleteQuarantine(w http.ResponseWriter, r *http.Request) {
+	store := a.quarantineStore(w)
+	if store == nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := store.Delete(id); errors.Is(err, quarantine.ErrNotFound) {
+		a.jsonError(w, "Quarantine entry not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		a.logger.Error("Failed to delete quarantine entry", "id", id, "error", err)
+		a.jsonError(w, "Failed to delete quarantine entry", http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.Warn("Quarantine entry deleted", "id", id, "caller", callerName(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePurgeQuarantine removes every quarantined file
+func (a *API) handlePurgeQuarantine(w http.ResponseWriter, r *http.Request) {
+	store := a.quarantineStore(w)
+	if store == nil {
+		return
+	}
+
+	purged, err := store.Purge()
+	if err != nil {
+		a.logger.Error("Failed to purge quarantine", "purged", purged, "error", err)
+		a.jsonError(w, "Failed to purge quarantine", http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.Warn("Quarantine purged", "purged", purged, "caller", callerName(r))
+	a.jsonResponse(w, map[string]int{"purged": purged}, http.StatusOK)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/quarantine"
+)
+
+func TestAPI_Quarantine(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	handler := api.Routes()
+
+	// Disabled by default
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/quarantine", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status 501 without quarantine, got %d", rr.Code)
+	}
+
+	keyFile := filepath.Join(tmpDir, "quarantine.key")
+	os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))), 0600)
+	store, err := quarantine.Open(filepath.Join(tmpDir, "quarantine"), keyFile)
+	if err != nil {
+		t.Fatalf("failed to open quarantine: %v", err)
+	}
+	api.scanner.SetQuarantine(store)
+
+	body, contentType := createMultipartFile(t, "file", "eicar.com", []byte(drivers.EICARPattern()))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+	req.Header.Set("Content-Type", contentType)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("scan failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/quarantine", nil))
+	var list struct {
+		Entries []quarantine.Entry `json:"entries"`
+	}
+	json.NewDecoder(rr.Body).Decode(&list)
+	if rr.Code != http.StatusOK || len(list.Entries) != 1 {
+		t.Fatalf("expected one quarantined file, got %d %+v", rr.Code, list.Entries)
+	}
+	entry := list.Entries[0]
+	if entry.FileName != "eicar.com" || entry.Signature == "" || entry.Caller != "anonymous" || !entry.HasContent {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/quarantine/"+entry.ID+"/content", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != drivers.EICARPattern() {
+		t.Errorf("expected the original content, got %d", rr.Code)
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); !strings.Contains(disposition, "eicar.com") {
+		t.Errorf("unexpected Content-Disposition: %q", disposition)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/quarantine/"+entry.ID, nil))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/quarantine/"+entry.ID, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after delete, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/quarantine", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"purged":0`) {
+		t.Errorf("unexpected purge response: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAPI_MayViewQuarantined(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	allowlistFile := filepath.Join(tmpDir, "allowlist.yaml")
+	content := `allowlist:
+  - prod/ns1/sa1
+  - prod/ns2/sa2
+admins:
+  - prod/ops/operator
+`
+	if err := os.WriteFile(allowlistFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write allowlist: %v", err)
+	}
+	allowlist, err := auth.NewAllowlist(allowlistFile, logger)
+	if err != nil {
+		t.Fatalf("failed to create allowlist: %v", err)
+	}
+	api.allowlist = allowlist
+	api.authMiddleware = auth.NewMiddleware(nil, allowlist, logger, nil)
+
+	request := func(namespace, serviceAccount string) *http.Request {
+		ctx := auth.WithCallerIdentity(context.Background(), &auth.CallerIdentity{
+			Cluster: "prod", Namespace: namespace, ServiceAccount: serviceAccount,
+		})
+		return httptest.NewRequest(http.MethodGet, "/api/v1/quarantine", nil).WithContext(ctx)
+	}
+
+	entry := quarantine.Entry{Caller: "prod/ns1/sa1"}
+	if !api.mayViewQuarantined(request("ns1", "sa1"), entry) {
+		t.Error("expected the uploader to see their entry")
+	}
+	if api.mayViewQuarantined(request("ns2", "sa2"), entry) {
+		t.Error("expected another caller not to see the entry")
+	}
+	if !api.mayViewQuarantined(request("ops", "operator"), entry) {
+		t.Error("expected an admin to see every entry")
+	}
+}
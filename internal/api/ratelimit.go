@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/throttle"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRateLimitKeys bounds the callers and client IPs whose request rate is
+// tracked; idle ones are forgotten first
+const maxRateLimitKeys = 10000
+
+// Rate limit headers on every limited response
+const (
+	headerRateLimitLimit     = "X-RateLimit-Limit"
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRateLimitReset     = "X-RateLimit-Reset"
+)
+
+// rateLimitExempt are the probe and scrape paths, which are never limited
+var rateLimitExempt = map[string]bool{
+	"/api/v1/live":  true,
+	"/api/v1/ready": true,
+	"/metrics":      true,
+}
+
+// rateLimiter gives each caller its own token bucket of requests (RATE_LIMIT
+// per second, RATE_LIMIT_BURST at once), so one busy tenant cannot starve
+// the others
+type rateLimiter struct {
+	rate    int
+	burst   int
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	bucket   *throttle.Bucket
+	lastSeen time.Time
+}
+
+// rateLimitDecision is the outcome of one request against its bucket
+type rateLimitDecision struct {
+	allowed    bool
+	remaining  int           // requests left in the burst
+	reset      time.Duration // until the burst is full again
+	retryAfter time.Duration // until a refused request would be allowed
+}
+
+// newRateLimiter returns nil when rate is 0
+func newRateLimiter(rate, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, burst: max(burst, rate), buckets: make(map[string]*rateBucket)}
+}
+
+// allow takes one request from key's bucket
+func (l *rateLimiter) allow(key string) rateLimitDecision {
+	now := time.Now()
+	l.mu.Lock()
+	entry, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitKeys {
+			l.evictLocked(now)
+		}
+		entry = &rateBucket{bucket: throttle.NewBucket(int64(l.rate), int64(l.burst))}
+		l.buckets[key] = entry
+	}
+	entry.lastSeen = now
+	l.mu.Unlock()
+
+	wait, allowed := entry.bucket.Reserve(1, 0)
+	used := entry.bucket.Usage() * float64(l.burst)
+	return rateLimitDecision{
+		allowed:    allowed,
+		remaining:  max(int(math.Floor(float64(l.burst)-used)), 0),
+		reset:      time.Duration(used / float64(l.rate) * float64(time.Second)),
+		retryAfter: wait,
+	}
+}
+
+// evictLocked forgets the buckets that have refilled since their last
+// request, or else the least recently used one; callers hold l.mu
+func (l *rateLimiter) evictLocked(now time.Time) {
+	refill := time.Duration(float64(l.burst) / float64(l.rate) * float64(time.Second))
+	var oldest string
+	for key, entry := range l.buckets {
+		if now.Sub(entry.lastSeen) > refill {
+			delete(l.buckets, key)
+			continue
+		}
+		if oldest == "" || entry.lastSeen.Before(l.buckets[oldest].lastSeen) {
+			oldest = key
+		}
+	}
+	if len(l.buckets) >= maxRateLimitKeys {
+		delete(l.buckets, oldest)
+	}
+}
+
+// rateLimitKey identifies whose bucket a request draws from: the
+// authenticated caller, or else the client IP. caller labels metrics.
+func (a *API) rateLimitKey(ctx context.Context, remoteAddr string, header func(name string) string) (key, caller string) {
+	if identity := auth.GetCallerIdentity(ctx); identity != nil {
+		caller = contextCallerName(ctx)
+		return "caller:" + caller, caller
+	}
+	return "ip:" + auth.SourceAddress(remoteAddr, a.config.Auth.BanSourceHeader, a.config.Auth.BanTrustedProxies, header), anonymousCaller
+}
+
+// withRateLimit refuses requests beyond the caller's RATE_LIMIT with 429. It
+// runs after authentication, which identifies the caller.
+func (a *API) withRateLimit(next http.Handler) http.Handler {
+	if a.rateLimits == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimitExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, caller := a.rateLimitKey(r.Context(), r.RemoteAddr, r.Header.Get)
+		decision := a.rateLimits.allow(key)
+		w.Header().Set(headerRateLimitLimit, strconv.Itoa(a.rateLimits.burst))
+		w.Header().Set(headerRateLimitRemaining, strconv.Itoa(decision.remaining))
+		w.Header().Set(headerRateLimitReset, strconv.Itoa(int(math.Ceil(decision.reset.Seconds()))))
+		if !decision.allowed {
+			metrics.RecordRateLimited(caller)
+			a.logger.Debug("Request rate limited", "caller", caller, "key", key, "path", r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.retryAfter.Seconds()))))
+			a.jsonError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// grpcRateLimit is withRateLimit for gRPC calls
+func (a *API) grpcRateLimit(ctx context.Context) error {
+	if a.rateLimits == nil {
+		return nil
+	}
+	remoteAddr, header := grpcPeer(ctx)
+	key, caller := a.rateLimitKey(ctx, remoteAddr, header)
+	if a.rateLimits.allow(key).allowed {
+		return nil
+	}
+	metrics.RecordRateLimited(caller)
+	return status.Error(codes.ResourceExhausted, "Rate limit exceeded")
+}
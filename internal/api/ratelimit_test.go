@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/auth"
+)
+
+func TestAPI_RateLimit(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.rateLimits = newRateLimiter(1, 2)
+	handler := api.Routes()
+
+	get := func(ctx context.Context, path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	ctx := context.Background()
+
+	for i, remaining := range []string{"1", "0"} {
+		rr := get(ctx, "/api/v1/health", "10.0.0.7:5000")
+		if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "2" || rr.Header().Get("X-RateLimit-Remaining") != remaining {
+			t.Errorf("request %d: expected 200 with %s remaining, got %d %v", i, remaining, rr.Code, rr.Header())
+		}
+	}
+	rr := get(ctx, "/api/v1/health", "10.0.0.7:5001")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 429 with Retry-After 1 beyond the burst, got %d %v", rr.Code, rr.Header())
+	}
+
+	// Probes are never limited, and other clients have their own bucket
+	if rr := get(ctx, "/api/v1/live", "10.0.0.7:5000"); rr.Code != http.StatusOK {
+		t.Errorf("expected probes to be exempt, got %d", rr.Code)
+	}
+	if rr := get(ctx, "/api/v1/health", "10.0.0.8:5000"); rr.Code != http.StatusOK {
+		t.Errorf("expected another client IP to be allowed, got %d", rr.Code)
+	}
+
+	// Authenticated callers are limited by identity, wherever they connect from
+	caller := auth.WithCallerIdentity(ctx, &auth.CallerIdentity{Cluster: "prod", Namespace: "loans", ServiceAccount: "intake"})
+	for i, code := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if rr := get(caller, "/api/v1/health", fmt.Sprintf("10.0.1.%d:5000", i)); rr.Code != code {
+			t.Errorf("caller request %d: expected %d, got %d", i, code, rr.Code)
+		}
+	}
+}
+
+func TestRateLimiter_Eviction(t *testing.T) {
+	l := newRateLimiter(10, 10)
+	for i := range maxRateLimitKeys {
+		l.allow(fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256))
+	}
+	// Buckets that have refilled are forgotten to make room
+	for _, entry := range l.buckets {
+		entry.lastSeen = entry.lastSeen.Add(-2 * time.Second)
+	}
+	l.buckets["ip:10.0.0.0"].lastSeen = time.Now()
+	l.allow("caller:prod/loans/intake")
+	if len(l.buckets) != 2 {
+		t.Errorf("expected idle buckets to be evicted, %d left", len(l.buckets))
+	}
+}
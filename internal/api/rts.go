@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRTSWatchTimeout = 5 * time.Second
+	maxRTSWatchTimeout     = 60 * time.Second
+)
+
+// handleRTSWatch long-polls for the on-access verdict of a file another
+// process wrote, e.g. a sidecar sharing the scan volume. If the engine reports
+// nothing before the timeout the file is considered clean, as in the scan flow.
+func (a *API) handleRTSWatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path    string `json:"path"`
+		Timeout int    `json:"timeout"` // milliseconds
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" || !filepath.IsAbs(req.Path) {
+		a.jsonError(w, "path must be an absolute file path", http.StatusBadRequest)
+		return
+	}
+	path := filepath.Clean(req.Path)
+	if !a.isRTSWatchable(path) {
+		a.jsonError(w, "path is outside the watched directories", http.StatusForbidden)
+		return
+	}
+
+	timeout := defaultRTSWatchTimeout
+	if req.Timeout < 0 || time.Duration(req.Timeout)*time.Millisecond > maxRTSWatchTimeout {
+		a.jsonError(w, "timeout must be between 0 and 60000 ms", http.StatusBadRequest)
+		return
+	}
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Millisecond
+	}
+
+	result, err := a.scanner.WatchRTS(path, timeout)
+	if err != nil {
+		a.logger.Error("RTS watch failed", "error", err, "path", path)
+		a.jsonError(w, "RTS watch failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	timedOut := false
+	if raw, ok := result.Raw.(map[string]bool); ok {
+		timedOut = raw["timeout"]
+	}
+
+	response := map[string]interface{}{
+		"path":     path,
+		"status":   result.Status,
+		"engine":   result.Engine,
+		"timedOut": timedOut,
+		"duration": result.Duration,
+	}
+	if result.Signature != "" {
+		response["signature"] = result.Signature
+	}
+	a.jsonResponse(w, response, http.StatusOK)
+}
+
+// isRTSWatchable reports whether path is inside one of the configured roots
+func (a *API) isRTSWatchable(path string) bool {
+	for _, root := range a.config.RTSWatchRoots {
+		rel, err := filepath.Rel(filepath.Clean(root), path)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
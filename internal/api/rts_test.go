@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func postRTSWatch(t *testing.T, api *API, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/rts/watch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPI_RTSWatch(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.RTSWatchRoots = []string{tmpDir}
+
+	filePath := filepath.Join(tmpDir, "shared", "eicar.com")
+	os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err := os.WriteFile(filePath, []byte(drivers.EICARPattern()), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	rr := postRTSWatch(t, api, `{"path": "`+filePath+`", "timeout": 1000}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp["status"] != "infected" || resp["signature"] != drivers.EICARSignature {
+		t.Errorf("unexpected response: %v", resp)
+	}
+	if resp["timedOut"] != false {
+		t.Errorf("expected timedOut false, got %v", resp["timedOut"])
+	}
+
+	// The watched file belongs to the caller and must be left alone
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("expected watched file to remain: %v", err)
+	}
+}
+
+func TestAPI_RTSWatch_InvalidRequests(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.RTSWatchRoots = []string{tmpDir}
+
+	tests := []struct {
+		body     string
+		expected int
+	}{
+		{`not json`, http.StatusBadRequest},
+		{`{"path": ""}`, http.StatusBadRequest},
+		{`{"path": "relative/file"}`, http.StatusBadRequest},
+		{`{"path": "` + tmpDir + `/f", "timeout": -1}`, http.StatusBadRequest},
+		{`{"path": "` + tmpDir + `/f", "timeout": 600000}`, http.StatusBadRequest},
+		{`{"path": "/etc/passwd"}`, http.StatusForbidden},
+		{`{"path": "` + tmpDir + `/../escape"}`, http.StatusForbidden},
+		{`{"path": "` + tmpDir + `"}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		if rr := postRTSWatch(t, api, tt.body); rr.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.body, tt.expected, rr.Code)
+		}
+	}
+}
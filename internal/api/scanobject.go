@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/objectstore"
+)
+
+type scanObjectRequest struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	Endpoint string `json:"endpoint,omitempty"` // defaults to the first OBJECT_STORE_ENDPOINTS entry
+	FileName string `json:"fileName,omitempty"` // defaults to the last key segment
+}
+
+// handleScanObject downloads an object from an allowed object store and
+// scans it (POST /api/v1/scan/object)
+func (a *API) handleScanObject(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+	if a.objects == nil || len(a.config.ObjectStoreEndpoints) == 0 {
+		a.jsonError(w, "Scan by reference is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req scanObjectRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := objectstore.CheckRef(req.Bucket, req.Key); err != nil {
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endpoint, ok := a.objectEndpoint(req.Endpoint)
+	if !ok {
+		a.jsonError(w, fmt.Sprintf("Endpoint %q is not allowed", req.Endpoint), http.StatusForbidden)
+		return
+	}
+	tags, err := parseScanTags(r.URL.Query()["tag"], a.config.ScanTagKeys)
+	if err != nil {
+		a.jsonError(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	obj, err := a.objects.Get(r.Context(), endpoint, req.Bucket, req.Key)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		a.jsonError(w, "Object not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		// As for scan-by-URL, the error is only logged
+		a.logger.Warn("Object download failed", "endpoint", endpoint, "bucket", req.Bucket, "key", req.Key, "error", err)
+		a.jsonError(w, "Download failed", http.StatusBadGateway)
+		return
+	}
+	defer obj.Body.Close()
+
+	maxSize := a.config.ObjectStoreMaxSize
+	if maxSize == 0 {
+		maxSize = a.config.MaxFileSize
+	}
+	if obj.Size > maxSize {
+		a.jsonError(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	fileName := req.FileName
+	if fileName == "" {
+		fileName = path.Base(req.Key)
+	}
+	if fileName == "" || fileName == "/" || fileName == "." {
+		fileName = "object"
+	}
+
+	u, ok := a.storeUpload(w, r, http.MaxBytesReader(nil, obj.Body, maxSize), fileName, obj.ContentType, tags)
+	if !ok {
+		return
+	}
+	a.scanAndRespond(w, r, u)
+}
+
+// objectEndpoint resolves a requested endpoint against OBJECT_STORE_ENDPOINTS;
+// only listed endpoints may be downloaded from
+func (a *API) objectEndpoint(requested string) (string, bool) {
+	if requested == "" {
+		return a.config.ObjectStoreEndpoints[0], true
+	}
+	requested = strings.TrimSuffix(requested, "/")
+	ok := slices.ContainsFunc(a.config.ObjectStoreEndpoints, func(endpoint string) bool {
+		return strings.TrimSuffix(endpoint, "/") == requested
+	})
+	return requested, ok
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/objectstore"
+)
+
+func TestAPI_HandleScanObject(t *testing.T) {
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/uploads/incoming/eicar.com":
+			w.Write([]byte(drivers.EICARPattern()))
+		case "/uploads/big.iso":
+			w.Header().Set("Content-Length", "1000000000")
+			w.WriteHeader(http.StatusOK)
+		case "/uploads/private":
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer store.Close()
+
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ObjectStoreEndpoints = []string{store.URL}
+	api.objects = objectstore.NewS3("us-east-1", nil, 5*time.Second)
+
+	scanObject := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/scan/object", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := scanObject(`{"bucket":"uploads","key":"incoming/eicar.com"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp["status"] != "infected" || resp["fileName"] != "eicar.com" {
+		t.Errorf("unexpected response: %v", resp)
+	}
+
+	for body, want := range map[string]int{
+		`{"bucket":"uploads","key":"incoming/eicar.com","endpoint":"` + store.URL + `/"}`: http.StatusOK,
+		`{"bucket":"uploads","key":"missing"}`:                                            http.StatusNotFound,
+		`{"bucket":"uploads","key":"private"}`:                                            http.StatusBadGateway,
+		`{"bucket":"uploads","key":"big.iso"}`:                                            http.StatusRequestEntityTooLarge,
+		`{"bucket":"uploads","key":"x","endpoint":"http://169.254.169.254"}`:              http.StatusForbidden,
+		`{"bucket":"Uploads!","key":"x"}`:                                                 http.StatusBadRequest,
+		`{"bucket":"uploads"}`:                                                            http.StatusBadRequest,
+	} {
+		if rr := scanObject(body); rr.Code != want {
+			t.Errorf("%s: expected status %d, got %d: %s", body, want, rr.Code, rr.Body.String())
+		}
+	}
+	// The store's error is logged but not returned
+	if rr := scanObject(`{"bucket":"uploads","key":"private"}`); strings.Contains(rr.Body.String(), "403") || strings.Contains(rr.Body.String(), store.URL) {
+		t.Errorf("expected a generic error, got %s", rr.Body.String())
+	}
+}
+
+func TestAPI_HandleScanObject_Disabled(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/scan/object", strings.NewReader(`{"bucket":"uploads","key":"a"}`)))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501, got %d", rr.Code)
+	}
+}
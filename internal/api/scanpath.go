@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+)
+
+type scanPathRequest struct {
+	Path string `json:"path"`
+}
+
+// SetPathScans enables directory scans; nil disables them
+func (a *API) SetPathScans(p *bulkscan.PathScans) {
+	a.pathScans = p
+}
+
+// handleScanPath starts scanning a directory under SCAN_PATH_ROOTS in the
+// background (POST /api/v1/scan/path). Progress is polled from
+// GET /api/v1/scan/path/{id}.
+func (a *API) handleScanPath(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) {
+		return
+	}
+	if a.pathScans == nil {
+		a.jsonError(w, "Directory scans are disabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req scanPathRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	scan, err := a.pathScans.Submit(req.Path, callerName(r))
+	switch {
+	case errors.Is(err, bulkscan.ErrPathNotAllowed):
+		a.jsonError(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, fs.ErrNotExist):
+		a.jsonError(w, "Path not found", http.StatusNotFound)
+		return
+	case errors.Is(err, bulkscan.ErrTooManyScans):
+		w.Header().Set("Retry-After", jobQueueRetryAfter)
+		a.jsonError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/scan/path/"+scan.ID)
+	a.jsonResponse(w, scan, http.StatusAccepted)
+}
+
+// handleGetPathScan reports a directory scan's progress. Finished scans
+// are kept for a day.
+func (a *API) handleGetPathScan(w http.ResponseWriter, r *http.Request) {
+	if a.pathScans == nil {
+		a.jsonError(w, "Directory scans are disabled", http.StatusNotImplemented)
+		return
+	}
+	scan, ok := a.pathScans.Get(r.PathValue("id"))
+	if !ok {
+		a.jsonError(w, "Unknown or expired directory scan", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	a.jsonResponse(w, scan, http.StatusOK)
+}
+
+// handleCancelPathScan stops a running directory scan; files being scanned
+// are finished first
+func (a *API) handleCancelPathScan(w http.ResponseWriter, r *http.Request) {
+	if a.pathScans == nil {
+		a.jsonError(w, "Directory scans are disabled", http.StatusNotImplemented)
+		return
+	}
+	if !a.pathScans.Cancel(r.PathValue("id")) {
+		a.jsonError(w, "Unknown or expired directory scan", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+)
+
+func TestAPI_HandleScanPath(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodPost, "/api/v1/scan/path", `{"path":"/mnt"}`); rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501 while disabled, got %d", rr.Code)
+	}
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644)
+	api.config.ScanPathRoots = []string{root}
+	api.config.ScanPathWorkers = 2
+	api.config.ScanPathMaxRuns = 1
+	pathScans := bulkscan.NewPathScans(api.config, api.scanner, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer pathScans.Stop()
+	api.SetPathScans(pathScans)
+
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{"not json", http.StatusBadRequest},
+		{`{"path":"relative"}`, http.StatusBadRequest},
+		{`{"path":"` + t.TempDir() + `"}`, http.StatusForbidden},
+		{`{"path":"` + filepath.Join(root, "missing") + `"}`, http.StatusNotFound},
+	} {
+		if rr := do(http.MethodPost, "/api/v1/scan/path", tc.body); rr.Code != tc.want {
+			t.Errorf("body %.40q: expected status %d, got %d: %s", tc.body, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := do(http.MethodPost, "/api/v1/scan/path", `{"path":"`+root+`"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var scan bulkscan.PathScan
+	json.Unmarshal(rr.Body.Bytes(), &scan)
+	if rr.Header().Get("Location") != "/api/v1/scan/path/"+scan.ID {
+		t.Errorf("unexpected Location %q", rr.Header().Get("Location"))
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); scan.Status == bulkscan.PathScanRunning; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("directory scan did not finish")
+		}
+		rr = do(http.MethodGet, "/api/v1/scan/path/"+scan.ID, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+		json.Unmarshal(rr.Body.Bytes(), &scan)
+	}
+	if scan.Status != bulkscan.PathScanCompleted || scan.Scanned != 1 || scan.Infected != 0 {
+		t.Errorf("unexpected progress: %+v", scan)
+	}
+
+	if rr := do(http.MethodGet, "/api/v1/scan/path/unknown", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown scan, got %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/api/v1/scan/path/"+scan.ID, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status 204 on cancel, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/fetch"
+)
+
+type scanURLRequest struct {
+	URL      string `json:"url"`
+	FileName string `json:"fileName,omitempty"` // defaults to the last URL path segment
+}
+
+// handleScanURL downloads a file from an allowed host and scans it
+// (POST /api/v1/scan/url)
+func (a *API) handleScanURL(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+	if len(a.config.ScanURLAllowedHosts) == 0 {
+		a.jsonError(w, "Scan by URL is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req scanURLRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || target.Host == "" {
+		a.jsonError(w, "Invalid url", http.StatusBadRequest)
+		return
+	}
+	if err := a.urlPolicy().Check(target); err != nil {
+		a.jsonError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	tags, err := parseScanTags(r.URL.Query()["tag"], a.config.ScanTagKeys)
+	if err != nil {
+		a.jsonError(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maxSize := a.config.ScanURLMaxSize
+	if maxSize == 0 {
+		maxSize = a.config.MaxFileSize
+	}
+	client := a.urlPolicy().Client(time.Duration(a.config.ScanURLTimeout) * time.Millisecond)
+	download, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		a.jsonError(w, "Invalid url", http.StatusBadRequest)
+		return
+	}
+	resp, err := client.Do(download)
+	if err != nil {
+		// The error can describe internal hosts and TLS setup, so it is
+		// only logged
+		a.logger.Warn("Scan URL download failed", "url", target.Redacted(), "error", err)
+		a.jsonError(w, "Download failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.jsonError(w, fmt.Sprintf("Download failed: status %d", resp.StatusCode), http.StatusBadGateway)
+		return
+	}
+	if resp.ContentLength > maxSize {
+		a.jsonError(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	fileName := req.FileName
+	if fileName == "" {
+		fileName = path.Base(resp.Request.URL.Path)
+	}
+	if fileName == "" || fileName == "/" || fileName == "." {
+		fileName = "download"
+	}
+
+	// The limit is on the download, not the client's request, so it must
+	// not close the client's connection
+	u, ok := a.storeUpload(w, r, http.MaxBytesReader(nil, resp.Body, maxSize), fileName, resp.Header.Get("Content-Type"), tags)
+	if !ok {
+		return
+	}
+	a.scanAndRespond(w, r, u)
+}
+
+// urlPolicy is the set of URLs scan-by-URL may download
+func (a *API) urlPolicy() fetch.Policy {
+	return fetch.Policy{AllowedHosts: a.config.ScanURLAllowedHosts, Schemes: a.config.ScanURLSchemes}
+}
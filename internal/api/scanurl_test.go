@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestAPI_HandleScanURL(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files/eicar.com":
+			w.Write([]byte(drivers.EICARPattern()))
+		case "/moved":
+			http.Redirect(w, r, "http://elsewhere.example/eicar.com", http.StatusFound)
+		case "/large":
+			// Flushed, so sent chunked with no Content-Length to check up front
+			w.Write(bytes.Repeat([]byte("a"), 2048))
+			w.(http.Flusher).Flush()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer remote.Close()
+	remoteURL, _ := url.Parse(remote.URL)
+
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanURLSchemes = []string{"http"}
+	api.config.ScanURLAllowedHosts = []string{remoteURL.Hostname()}
+	api.config.ScanURLMaxSize = 1024
+
+	scanURL := func(target string) *httptest.ResponseRecorder {
+		body := `{"url":"` + target + `"}`
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/scan/url", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := scanURL(remote.URL + "/files/eicar.com")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp["status"] != "infected" || resp["fileName"] != "eicar.com" {
+		t.Errorf("unexpected response: %v", resp)
+	}
+
+	for target, want := range map[string]int{
+		remote.URL + "/missing":            http.StatusBadGateway,
+		remote.URL + "/moved":              http.StatusBadGateway, // redirect leaves the allowlist
+		remote.URL + "/large":              http.StatusRequestEntityTooLarge,
+		"http://other.example/x":           http.StatusForbidden,
+		"ftp://" + remoteURL.Host:          http.StatusForbidden,
+		"http://user:pw@" + remoteURL.Host: http.StatusForbidden,
+	} {
+		if rr := scanURL(target); rr.Code != want {
+			t.Errorf("%s: expected status %d, got %d: %s", target, want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestAPI_HandleScanURL_DownloadError(t *testing.T) {
+	// Nothing listens on a closed server's port
+	remote := httptest.NewServer(http.NotFoundHandler())
+	remote.Close()
+	remoteURL, _ := url.Parse(remote.URL)
+
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanURLSchemes = []string{"http"}
+	api.config.ScanURLAllowedHosts = []string{remoteURL.Hostname()}
+
+	rr := httptest.NewRecorder()
+	body := `{"url":"` + remote.URL + `/eicar.com"}`
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/scan/url", strings.NewReader(body)))
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// The dial error, naming the address, is logged but not returned
+	if strings.Contains(rr.Body.String(), remoteURL.Host) || strings.Contains(rr.Body.String(), "refused") {
+		t.Errorf("expected a generic error, got %s", rr.Body.String())
+	}
+}
+
+func TestAPI_HandleScanURL_Disabled(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/scan/url", strings.NewReader(`{"url":"https://example.com/a"}`)))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/rophy/av-scanner/internal/schedule"
+)
+
+// SetScheduler exposes the scheduled scans through GET /api/v1/schedules
+func (a *API) SetScheduler(s *schedule.Scheduler) {
+	a.scheduler = s
+}
+
+// handleListSchedules lists scheduled scans with their next activation and
+// the reports of their recent runs (GET /api/v1/schedules)
+func (a *API) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules := []schedule.JobStatus{}
+	if a.scheduler != nil {
+		schedules = a.scheduler.Status()
+	}
+	a.jsonResponse(w, map[string]interface{}{"schedules": schedules}, http.StatusOK)
+}
+
+// handleGetSchedule reports one scheduled scan (GET /api/v1/schedules/{name})
+func (a *API) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	if a.scheduler != nil {
+		for _, status := range a.scheduler.Status() {
+			if status.Name == r.PathValue("name") {
+				a.jsonResponse(w, status, http.StatusOK)
+				return
+			}
+		}
+	}
+	a.jsonError(w, "Unknown schedule", http.StatusNotFound)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/schedule"
+)
+
+func TestAPI_HandleSchedules(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/api/v1/schedules")
+	if rr.Code != http.StatusOK || rr.Body.String() != "{\"schedules\":[]}\n" {
+		t.Errorf("expected an empty list without a scheduler, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	scheduleFile := filepath.Join(t.TempDir(), "schedule.yaml")
+	os.WriteFile(scheduleFile, []byte("jobs:\n  - name: inbox\n    cron: \"@hourly\"\n    path: "+tmpDir+"\n"), 0600)
+	jobs, err := schedule.Load(scheduleFile)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	scheduler := schedule.New(jobs, api.scanner, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	scheduler.Run(jobs[0])
+	api.SetScheduler(scheduler)
+
+	rr = get("/api/v1/schedules/inbox")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var status schedule.JobStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if status.Path != tmpDir || len(status.Runs) != 1 || status.Runs[0].Job != "inbox" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if rr := get("/api/v1/schedules/unknown"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+}
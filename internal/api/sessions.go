@@ -0,0 +1,315 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// maxSessionsPerCaller bounds one caller's sessions, so a single client
+// cannot use up maxSessions for everyone; creating one beyond it gets 429
+// until the caller's sessions expire
+const maxSessionsPerCaller = 100
+
+// maxSessions bounds the sessions kept in memory across all callers, as a
+// backstop when many callers are at their limit
+const maxSessions = 10000
+
+// defaultSessionTTL applies when SessionTTL is unset
+const defaultSessionTTL = time.Hour
+
+// maxSessionNameLength bounds the caller's label for a session
+const maxSessionNameLength = 128
+
+// Session states. Files are added while a session is open; finalizing it
+// fixes its decision.
+const (
+	sessionOpen      = "open"
+	sessionFinalized = "finalized"
+)
+
+// scanSession groups the uploads of one workflow, e.g. a loan application's
+// documents, so they are accepted or rejected together
+type scanSession struct {
+	ID          string
+	Name        string
+	Caller      string
+	Status      string
+	CreatedAt   time.Time
+	FinalizedAt *time.Time
+	ExpiresAt   time.Time
+	Files       []map[string]interface{} // scan results, with "released" set
+	Decision    string                   // set once finalized
+	Rejected    int                      // files that may not be released
+}
+
+// sessionStore keeps scan sessions in memory until they expire
+type sessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*scanSession
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	return &sessionStore{ttl: ttl, sessions: make(map[string]*scanSession)}
+}
+
+// get returns the caller's session; other callers' sessions are not found.
+// Callers hold s.mu.
+func (s *sessionStore) get(id, caller string) (*scanSession, bool) {
+	s.expire(time.Now())
+	session, ok := s.sessions[id]
+	if !ok || session.Caller != caller {
+		return nil, false
+	}
+	return session, true
+}
+
+// count returns how many sessions caller has; callers hold s.mu
+func (s *sessionStore) count(caller string) int {
+	n := 0
+	for _, session := range s.sessions {
+		if session.Caller == caller {
+			n++
+		}
+	}
+	return n
+}
+
+// expire drops sessions past their expiry; callers hold s.mu
+func (s *sessionStore) expire(now time.Time) {
+	for id, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// handleCreateSession opens a scan session (POST /api/v1/sessions). The
+// optional JSON body names it: {"name": "loan-4711"}.
+func (a *API) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	if a.config.SessionMaxFiles == 0 {
+		a.jsonError(w, "Scan sessions are disabled", http.StatusNotImplemented)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.jsonError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Name) > maxSessionNameLength {
+		a.jsonError(w, fmt.Sprintf("Session name longer than %d characters", maxSessionNameLength), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	caller := callerName(r)
+	a.sessions.mu.Lock()
+	defer a.sessions.mu.Unlock()
+	a.sessions.expire(now)
+	if a.sessions.count(caller) >= maxSessionsPerCaller || len(a.sessions.sessions) >= maxSessions {
+		w.Header().Set("Retry-After", strconv.Itoa(int(a.sessions.ttl.Seconds())))
+		a.jsonError(w, "Too many open scan sessions", http.StatusTooManyRequests)
+		return
+	}
+	session := &scanSession{
+		ID:        a.scanner.GenerateFileID(),
+		Name:      req.Name,
+		Caller:    caller,
+		Status:    sessionOpen,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.sessions.ttl),
+		Files:     []map[string]interface{}{},
+	}
+	a.sessions.sessions[session.ID] = session
+
+	a.logger.Info("Scan session created", "sessionId", session.ID, "name", session.Name, "caller", session.Caller)
+	w.Header().Set("Location", "/api/v1/sessions/"+session.ID)
+	a.jsonResponse(w, session.json(), http.StatusCreated)
+}
+
+// handleGetSession reports a session's files so far, and its decision once
+// finalized (GET /api/v1/sessions/{id})
+func (a *API) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	a.sessions.mu.Lock()
+	defer a.sessions.mu.Unlock()
+	session, ok := a.sessions.get(r.PathValue("id"), callerName(r))
+	if !ok {
+		a.jsonError(w, "Unknown or expired session", http.StatusNotFound)
+		return
+	}
+	a.jsonResponse(w, session.json(), http.StatusOK)
+}
+
+// handleAddSessionFile scans an upload and adds its result to an open
+// session (POST /api/v1/sessions/{id}/files). The upload is sent and scanned
+// as with POST /api/v1/scan, and the response is its scan result.
+func (a *API) handleAddSessionFile(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+	id, caller := r.PathValue("id"), callerName(r)
+	if !a.checkSessionOpen(w, id, caller) {
+		return
+	}
+
+	u, ok := a.receiveUpload(w, r)
+	if !ok {
+		return
+	}
+	result, err := a.scanUpload(u)
+	var throttled *scanner.ThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		a.jsonError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	a.finishScan(u, result, err)
+
+	catalog := catalogFor(w)
+	var member map[string]interface{}
+	if err != nil {
+		message := "Scan failed: " + err.Error()
+		member = map[string]interface{}{
+			"fileId":   u.fileID,
+			"fileName": u.fileName,
+			"status":   drivers.StatusError,
+			"error":    message,
+		}
+		addErrorCategory(member, err)
+		addErrorMessage(catalog, member, message)
+	} else {
+		member = scanResultJSON(u.fileName, result)
+		addVerdictMessage(catalog, member, result.Status)
+	}
+	// As in batches, an unscanned file cannot be vouched for
+	member["released"] = err == nil && (result.Status == drivers.StatusClean || result.Status == drivers.StatusSkipped)
+	response := map[string]interface{}{"sessionId": id}
+	for k, v := range member {
+		response[k] = v
+	}
+
+	// The session may have been finalized or filled while the file was
+	// scanned
+	a.sessions.mu.Lock()
+	session, ok := a.sessions.get(id, caller)
+	added := ok && session.Status == sessionOpen && len(session.Files) < a.config.SessionMaxFiles
+	if added {
+		session.Files = append(session.Files, member)
+	}
+	a.sessions.mu.Unlock()
+	if !added {
+		a.jsonError(w, "Session closed while the file was scanned", http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		a.jsonResponse(w, response, http.StatusInternalServerError)
+		return
+	}
+	a.setLimitWarnings(w, u.origin.Caller, u.size)
+	a.jsonResponse(w, response, http.StatusOK)
+}
+
+// checkSessionOpen checks that files can be added to the session before the
+// upload is read. On failure it writes the error response and returns false.
+func (a *API) checkSessionOpen(w http.ResponseWriter, id, caller string) bool {
+	a.sessions.mu.Lock()
+	defer a.sessions.mu.Unlock()
+	session, ok := a.sessions.get(id, caller)
+	switch {
+	case !ok:
+		a.jsonError(w, "Unknown or expired session", http.StatusNotFound)
+		return false
+	case session.Status != sessionOpen:
+		a.jsonError(w, "Session is finalized", http.StatusConflict)
+		return false
+	case len(session.Files) >= a.config.SessionMaxFiles:
+		a.jsonError(w, fmt.Sprintf("Too many files: at most %d per session", a.config.SessionMaxFiles), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// handleFinalizeSession closes a session to new files and returns its
+// combined decision (POST /api/v1/sessions/{id}/finalize). Finalizing again
+// returns the same decision.
+func (a *API) handleFinalizeSession(w http.ResponseWriter, r *http.Request) {
+	a.sessions.mu.Lock()
+	defer a.sessions.mu.Unlock()
+	session, ok := a.sessions.get(r.PathValue("id"), callerName(r))
+	if !ok {
+		a.jsonError(w, "Unknown or expired session", http.StatusNotFound)
+		return
+	}
+	if session.Status == sessionOpen {
+		if len(session.Files) == 0 {
+			a.jsonError(w, "Session has no files", http.StatusBadRequest)
+			return
+		}
+		session.finalize(a.sessions.ttl)
+		a.logger.Info("Scan session finalized",
+			"sessionId", session.ID,
+			"files", len(session.Files),
+			"rejected", session.Rejected,
+			"decision", session.Decision,
+		)
+	}
+	a.jsonResponse(w, session.json(), http.StatusOK)
+}
+
+// finalize fixes the session's combined decision. As in an atomic batch, one
+// rejected file blocks the whole session and nothing in it is released.
+func (s *scanSession) finalize(ttl time.Duration) {
+	now := time.Now()
+	s.Status = sessionFinalized
+	s.FinalizedAt = &now
+	s.ExpiresAt = now.Add(ttl)
+	for _, file := range s.Files {
+		if file["released"] != true {
+			s.Rejected++
+		}
+	}
+	s.Decision = batchClean
+	if s.Rejected > 0 {
+		s.Decision = batchBlocked
+		for _, file := range s.Files {
+			file["released"] = false
+		}
+	}
+}
+
+// json is the session as returned by the API; the decision is only
+// reported once finalized
+func (s *scanSession) json() map[string]interface{} {
+	response := map[string]interface{}{
+		"sessionId": s.ID,
+		"status":    s.Status,
+		"createdAt": s.CreatedAt,
+		"expiresAt": s.ExpiresAt,
+		"files":     s.Files,
+	}
+	if s.Name != "" {
+		response["name"] = s.Name
+	}
+	if s.FinalizedAt != nil {
+		response["finalizedAt"] = s.FinalizedAt
+		response["decision"] = s.Decision
+		response["rejected"] = s.Rejected
+	}
+	return response
+}
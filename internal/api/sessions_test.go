@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/auth"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+type sessionResponse struct {
+	SessionID string `json:"sessionId"`
+	Status    string `json:"status"`
+	Decision  string `json:"decision"`
+	Rejected  int    `json:"rejected"`
+	Files     []struct {
+		FileName string             `json:"fileName"`
+		Status   drivers.ScanStatus `json:"status"`
+		Released bool               `json:"released"`
+	} `json:"files"`
+}
+
+func sessionRequest(t *testing.T, api *API, ctx context.Context, method, path, fileName, content string) (*httptest.ResponseRecorder, sessionResponse) {
+	t.Helper()
+	var req *http.Request
+	if fileName != "" {
+		body, contentType := createMultipartFile(t, "file", fileName, []byte(content))
+		req = httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", contentType)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(content))
+	}
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req.WithContext(ctx))
+	var resp sessionResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return rr, resp
+}
+
+func TestAPI_Sessions(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.SessionMaxFiles = 5
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		decision string
+		rejected int
+	}{
+		{"clean", map[string]string{"payslip.pdf": "payslip", "id.png": "id card"}, batchClean, 0},
+		{"infected", map[string]string{"payslip.pdf": "payslip", "statement.pdf": drivers.EICARPattern()}, batchBlocked, 1},
+	}
+	for _, tt := range tests {
+		rr, session := sessionRequest(t, api, ctx, http.MethodPost, "/api/v1/sessions", "", `{"name": "loan-4711"}`)
+		if rr.Code != http.StatusCreated || session.Status != sessionOpen {
+			t.Fatalf("%s: expected open session, got %d: %s", tt.name, rr.Code, rr.Body.String())
+		}
+		base := "/api/v1/sessions/" + session.SessionID
+
+		for fileName, content := range tt.files {
+			if rr, _ := sessionRequest(t, api, ctx, http.MethodPost, base+"/files", fileName, content); rr.Code != http.StatusOK {
+				t.Fatalf("%s: failed to add %s: %d %s", tt.name, fileName, rr.Code, rr.Body.String())
+			}
+		}
+		if _, open := sessionRequest(t, api, ctx, http.MethodGet, base, "", ""); len(open.Files) != len(tt.files) || open.Decision != "" {
+			t.Errorf("%s: expected %d files and no decision before finalizing, got %+v", tt.name, len(tt.files), open)
+		}
+
+		rr, final := sessionRequest(t, api, ctx, http.MethodPost, base+"/finalize", "", "")
+		if rr.Code != http.StatusOK || final.Status != sessionFinalized {
+			t.Fatalf("%s: expected finalized session, got %d: %s", tt.name, rr.Code, rr.Body.String())
+		}
+		if final.Decision != tt.decision || final.Rejected != tt.rejected {
+			t.Errorf("%s: expected decision %s with %d rejected, got %s with %d", tt.name, tt.decision, tt.rejected, final.Decision, final.Rejected)
+		}
+		for _, file := range final.Files {
+			if file.Released != (tt.decision == batchClean) {
+				t.Errorf("%s: unexpected release of %s: %v", tt.name, file.FileName, file.Released)
+			}
+		}
+
+		if rr, _ := sessionRequest(t, api, ctx, http.MethodPost, base+"/files", "late.txt", "late"); rr.Code != http.StatusConflict {
+			t.Errorf("%s: expected 409 adding to a finalized session, got %d", tt.name, rr.Code)
+		}
+	}
+}
+
+func TestAPI_Sessions_Errors(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	ctx := context.Background()
+
+	if rr, _ := sessionRequest(t, api, ctx, http.MethodPost, "/api/v1/sessions", "", ""); rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 with sessions disabled, got %d", rr.Code)
+	}
+
+	api.config.SessionMaxFiles = 1
+	_, session := sessionRequest(t, api, ctx, http.MethodPost, "/api/v1/sessions", "", "")
+	base := "/api/v1/sessions/" + session.SessionID
+
+	if rr, _ := sessionRequest(t, api, ctx, http.MethodPost, base+"/finalize", "", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 finalizing an empty session, got %d", rr.Code)
+	}
+	sessionRequest(t, api, ctx, http.MethodPost, base+"/files", "a.txt", "a")
+	if rr, _ := sessionRequest(t, api, ctx, http.MethodPost, base+"/files", "b.txt", "b"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 beyond SESSION_MAX_FILES, got %d", rr.Code)
+	}
+
+	// Sessions belong to their caller
+	other := auth.WithCallerIdentity(ctx, &auth.CallerIdentity{Cluster: "prod", Namespace: "loans", ServiceAccount: "intake"})
+	if rr, _ := sessionRequest(t, api, other, http.MethodGet, base, "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another caller's session, got %d", rr.Code)
+	}
+	if rr, _ := sessionRequest(t, api, ctx, http.MethodGet, "/api/v1/sessions/unknown", "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %d", rr.Code)
+	}
+}
+
+func TestAPI_Sessions_PerCallerLimit(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.SessionMaxFiles = 1
+	ctx := context.Background()
+
+	for i := range maxSessionsPerCaller {
+		if rr, _ := sessionRequest(t, api, ctx, http.MethodPost, "/api/v1/sessions", "", ""); rr.Code != http.StatusCreated {
+			t.Fatalf("session %d: expected 201, got %d", i, rr.Code)
+		}
+	}
+	rr, _ := sessionRequest(t, api, ctx, http.MethodPost, "/api/v1/sessions", "", "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After beyond the per-caller limit, got %d", rr.Code)
+	}
+
+	// Other callers still get sessions
+	other := auth.WithCallerIdentity(ctx, &auth.CallerIdentity{Cluster: "prod", Namespace: "loans", ServiceAccount: "intake"})
+	if rr, _ := sessionRequest(t, api, other, http.MethodPost, "/api/v1/sessions", "", ""); rr.Code != http.StatusCreated {
+		t.Errorf("expected 201 for another caller, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+)
+
+// handleScanStream scans a raw request body, for clients that find multipart
+// awkward (curl --data-binary, pipes). The file name comes from the name
+// query parameter or a Content-Disposition filename; the body is limited to
+// MAX_FILE_SIZE.
+func (a *API) handleScanStream(w http.ResponseWriter, r *http.Request) {
+	if a.rejectDuringMaintenance(w) || a.rejectAbuser(w, r) {
+		return
+	}
+
+	u, ok := a.receiveStream(w, r)
+	if !ok {
+		return
+	}
+	a.scanAndRespond(w, r, u)
+}
+
+func (a *API) receiveStream(w http.ResponseWriter, r *http.Request) (*upload, bool) {
+	if r.ContentLength > a.config.MaxFileSize {
+		a.jsonError(w, "File too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+
+	query := r.URL.Query()
+	tags, err := parseScanTags(query["tag"], a.config.ScanTagKeys)
+	if err != nil {
+		a.jsonError(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	fileName := query.Get("name")
+	if fileName == "" {
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			fileName = params["filename"]
+		}
+	}
+	if fileName == "" {
+		fileName = "upload"
+	}
+
+	// application/octet-stream only says the body is raw bytes
+	mimeType := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil && mediaType == "application/octet-stream" {
+		mimeType = ""
+	}
+
+	body := http.MaxBytesReader(w, r.Body, a.config.MaxFileSize)
+	return a.storeUpload(w, r, body, fileName, mimeType, tags)
+}
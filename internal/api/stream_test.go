@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestAPI_HandleScanStream(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/scan/stream", strings.NewReader(drivers.EICARPattern()))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Disposition", `attachment; filename="eicar.com"`)
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp["status"] != "infected" || resp["fileName"] != "eicar.com" {
+		t.Errorf("unexpected response: %v", resp)
+	}
+}
+
+func TestAPI_HandleScanStream_TooLarge(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.MaxFileSize = 4
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/scan/stream?name=big.bin", strings.NewReader("too large"))
+	// Unknown length, so the limit is enforced while reading
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+const (
+	// maxTagValueLength bounds caller-supplied tag values
+	maxTagValueLength = 64
+	// maxTagValues bounds distinct values tracked per key; the rest are
+	// counted under otherTagValue
+	maxTagValues  = 1000
+	otherTagValue = "_other"
+)
+
+// parseScanTags validates "key=value" tags against the allowed keys. Each key
+// may be given once.
+func parseScanTags(raw []string, allowedKeys []string) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(raw))
+	for _, tag := range raw {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			return nil, fmt.Errorf("tag %q must be key=value", tag)
+		}
+		if !slices.Contains(allowedKeys, key) {
+			return nil, fmt.Errorf("tag key %q is not allowed", key)
+		}
+		if _, dup := tags[key]; dup {
+			return nil, fmt.Errorf("tag key %q given more than once", key)
+		}
+		if !validTagValue(value) {
+			return nil, fmt.Errorf("tag %q: value must be 1-%d letters, digits or '_.:/-'", key, maxTagValueLength)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+func validTagValue(value string) bool {
+	if value == "" || len(value) > maxTagValueLength {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_.:/-", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// TagValueStats aggregates scans carrying one tag value
+type TagValueStats struct {
+	Value    string                       `json:"value"`
+	Scans    int64                        `json:"scans"`
+	Bytes    int64                        `json:"bytes"`
+	Statuses map[drivers.ScanStatus]int64 `json:"statuses"`
+}
+
+// tagStats counts scan volume per tag value since startup
+type tagStats struct {
+	mu     sync.Mutex
+	since  time.Time
+	values map[string]map[string]*TagValueStats // key -> value -> stats
+}
+
+func newTagStats() *tagStats {
+	return &tagStats{
+		since:  time.Now(),
+		values: make(map[string]map[string]*TagValueStats),
+	}
+}
+
+func (t *tagStats) record(tags map[string]string, size int64, status drivers.ScanStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, value := range tags {
+		byValue := t.values[key]
+		if byValue == nil {
+			byValue = make(map[string]*TagValueStats)
+			t.values[key] = byValue
+		}
+		stats := byValue[value]
+		if stats == nil {
+			if len(byValue) >= maxTagValues {
+				value = otherTagValue
+				stats = byValue[value]
+			}
+			if stats == nil {
+				stats = &TagValueStats{Value: value, Statuses: make(map[drivers.ScanStatus]int64)}
+				byValue[value] = stats
+			}
+		}
+		stats.Scans++
+		stats.Bytes += size
+		stats.Statuses[status]++
+	}
+}
+
+// snapshot returns the values seen for key, busiest first
+func (t *tagStats) snapshot(key string) []TagValueStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]TagValueStats, 0, len(t.values[key]))
+	for _, stats := range t.values[key] {
+		copied := *stats
+		copied.Statuses = make(map[drivers.ScanStatus]int64, len(stats.Statuses))
+		for status, n := range stats.Statuses {
+			copied.Statuses[status] = n
+		}
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Scans != result[j].Scans {
+			return result[i].Scans > result[j].Scans
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+// handleTagStats reports scan volume per value of one tag key
+// (GET /api/v1/admin/stats/tags/app)
+func (a *API) handleTagStats(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !slices.Contains(a.config.ScanTagKeys, key) {
+		a.jsonError(w, "Unknown tag key: "+key, http.StatusNotFound)
+		return
+	}
+
+	a.jsonResponse(w, map[string]interface{}{
+		"key":    key,
+		"since":  a.tagStats.since,
+		"values": a.tagStats.snapshot(key),
+	}, http.StatusOK)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestParseScanTags(t *testing.T) {
+	allowed := []string{"app", "team"}
+
+	tags, err := parseScanTags([]string{"app=billing", "team=payments/core"}, allowed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tags["app"] != "billing" || tags["team"] != "payments/core" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	for _, raw := range [][]string{
+		{"app"},
+		{"env=prod"},
+		{"app=billing", "app=search"},
+		{"app="},
+		{"app=has space"},
+	} {
+		if _, err := parseScanTags(raw, allowed); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestTagStats_ValueLimit(t *testing.T) {
+	stats := newTagStats()
+	for i := 0; i < maxTagValues+5; i++ {
+		stats.record(map[string]string{"app": fmt.Sprintf("app-%d", i)}, 10, drivers.StatusClean)
+	}
+
+	values := stats.snapshot("app")
+	if len(values) != maxTagValues+1 {
+		t.Fatalf("expected %d values, got %d", maxTagValues+1, len(values))
+	}
+	if values[0].Value != otherTagValue || values[0].Scans != 5 || values[0].Bytes != 50 {
+		t.Errorf("expected overflow bucket first, got %+v", values[0])
+	}
+}
+
+func TestAPI_HandleScan_Tags(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.ScanTagKeys = []string{"app"}
+
+	scan := func(query string) int {
+		body, contentType := createMultipartFile(t, "file", "eicar.com", []byte(drivers.EICARPattern()))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := scan("?tag=app=billing"); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if code := scan("?tag=team=payments"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a key outside the allowlist, got %d", code)
+	}
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats/tags/app", nil))
+	var resp struct {
+		Values []TagValueStats `json:"values"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(resp.Values) != 1 || resp.Values[0].Value != "billing" || resp.Values[0].Statuses[drivers.StatusInfected] != 1 {
+		t.Errorf("unexpected tag stats: %+v", resp.Values)
+	}
+}
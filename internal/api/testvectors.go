@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"slices"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/inspect"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// msgNoFile is the error for a scan request without a file part
+const msgNoFile = "No file provided. Please upload a file using the 'file' field"
+
+// testVectorVolatileFields differ on every scan and are left out of the
+// expected responses
+var testVectorVolatileFields = []string{"fileId", "duration", "timings"}
+
+type testVector struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Request     testVectorRequest  `json:"request"`
+	Response    testVectorResponse `json:"response"`
+}
+
+// testVectorRequest is a multipart POST with the content in the "file"
+// field; without a fileName no file part is sent. Content is base64 so test
+// files (EICAR) are not stored in SDK repositories as-is.
+type testVectorRequest struct {
+	Method        string `json:"method"`
+	Path          string `json:"path"`
+	FileName      string `json:"fileName,omitempty"`
+	ContentType   string `json:"contentType,omitempty"`
+	ContentBase64 string `json:"contentBase64,omitempty"`
+}
+
+type testVectorResponse struct {
+	Status int                    `json:"status"`
+	Body   map[string]interface{} `json:"body"`
+}
+
+// handleTestVectors returns canonical scan requests and the responses this
+// instance gives them (GET /api/v1/testvectors), so client SDKs can run
+// conformance tests against it. Verdicts are only deterministic with the
+// mock engine, so other engines do not serve them.
+func (a *API) handleTestVectors(w http.ResponseWriter, r *http.Request) {
+	if !slices.Equal(a.scanner.Engines(), []config.EngineType{config.EngineMock}) {
+		a.jsonError(w, "Test vectors are only served by the mock engine", http.StatusNotImplemented)
+		return
+	}
+
+	a.jsonResponse(w, map[string]interface{}{
+		"engine":         config.EngineMock,
+		"volatileFields": testVectorVolatileFields,
+		"vectors":        a.testVectors(),
+	}, http.StatusOK)
+}
+
+func (a *API) testVectors() []testVector {
+	scanVector := func(name, description, fileName, contentType, content string, result *scanner.ScanResponse) testVector {
+		result.Engine = config.EngineMock
+		fileType := inspect.DetectTypeBytes([]byte(content))
+		result.FileType = &fileType
+		hashes := hashContent([]byte(content))
+		result.Hashes = &hashes
+		body := scanResultJSON(fileName, result)
+		for _, field := range testVectorVolatileFields {
+			delete(body, field)
+		}
+		return testVector{
+			Name:        name,
+			Description: description,
+			Request: testVectorRequest{
+				Method:        http.MethodPost,
+				Path:          "/api/v1/scan",
+				FileName:      fileName,
+				ContentType:   contentType,
+				ContentBase64: base64.StdEncoding.EncodeToString([]byte(content)),
+			},
+			Response: testVectorResponse{Status: http.StatusOK, Body: body},
+		}
+	}
+
+	vectors := []testVector{
+		scanVector("clean", "A plain text file", "hello.txt", "text/plain", "hello world\n",
+			&scanner.ScanResponse{Status: drivers.StatusClean}),
+		scanVector("infected", "The EICAR test file", "eicar.com", "application/octet-stream", drivers.EICARPattern(),
+			&scanner.ScanResponse{Status: drivers.StatusInfected, Signature: drivers.EICARSignature}),
+	}
+	if a.config.PolyglotCheck {
+		vectors = append(vectors, scanVector("suspicious", "A GIF image that also carries HTML markup", "image.gif", "image/gif", "GIF89a<script>alert(1)</script>",
+			&scanner.ScanResponse{Status: drivers.StatusSuspicious, Findings: []string{"polyglot:gif+html"}}))
+	}
+	return append(vectors, testVector{
+		Name:        "error",
+		Description: "A scan request without a file",
+		Request:     testVectorRequest{Method: http.MethodPost, Path: "/api/v1/scan"},
+		Response: testVectorResponse{
+			Status: http.StatusBadRequest,
+			Body:   map[string]interface{}{"error": msgNoFile},
+		},
+	})
+}
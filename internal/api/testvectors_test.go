@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+type testVectorsResponse struct {
+	VolatileFields []string `json:"volatileFields"`
+	Vectors        []struct {
+		Name     string            `json:"name"`
+		Request  testVectorRequest `json:"request"`
+		Response struct {
+			Status int                    `json:"status"`
+			Body   map[string]interface{} `json:"body"`
+		} `json:"response"`
+	} `json:"vectors"`
+}
+
+// TestAPI_TestVectors replays every vector against the API, as an SDK
+// conformance suite would
+func TestAPI_TestVectors(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.config.PolyglotCheck = true
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/testvectors", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var resp testVectorsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(resp.Vectors) != 4 {
+		t.Fatalf("expected 4 vectors, got %d", len(resp.Vectors))
+	}
+
+	for _, v := range resp.Vectors {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		if v.Request.FileName != "" {
+			content, _ := base64.StdEncoding.DecodeString(v.Request.ContentBase64)
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", `form-data; name="file"; filename="`+v.Request.FileName+`"`)
+			header.Set("Content-Type", v.Request.ContentType)
+			part, _ := writer.CreatePart(header)
+			part.Write(content)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(v.Request.Method, v.Request.Path, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+
+		if rr.Code != v.Response.Status {
+			t.Errorf("%s: expected status %d, got %d", v.Name, v.Response.Status, rr.Code)
+			continue
+		}
+		var actual map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &actual)
+		for _, field := range resp.VolatileFields {
+			delete(actual, field)
+		}
+		if !reflect.DeepEqual(actual, v.Response.Body) {
+			t.Errorf("%s: expected %v, got %v", v.Name, v.Response.Body, actual)
+		}
+	}
+}
+
+func TestAPI_TestVectors_RealEngine(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	if err := api.scanner.SetActiveEngine(config.EngineClamAV); err != nil {
+		t.Fatalf("failed to switch engine: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	api.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/testvectors", nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// handleStartEngineUpdate runs the engine's signature update command, e.g.
+// freshclam, in the background. Poll GET on the same path for progress.
+func (a *API) handleStartEngineUpdate(w http.ResponseWriter, r *http.Request) {
+	engine := config.EngineType(r.PathValue("engine"))
+	update, err := a.scanner.StartEngineUpdate(engine)
+	switch {
+	case errors.Is(err, scanner.ErrUnknownEngine):
+		a.jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, scanner.ErrUpdateUnsupported), errors.Is(err, scanner.ErrDefinitionSetsUnsupported):
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, scanner.ErrUpdateRunning):
+		a.jsonError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		a.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.Warn("Engine update requested", "engine", engine, "caller", callerName(r))
+
+	w.Header().Set("Location", r.URL.Path)
+	a.jsonResponse(w, update, http.StatusAccepted)
+}
+
+// handleGetEngineUpdate reports the engine's latest requested update
+func (a *API) handleGetEngineUpdate(w http.ResponseWriter, r *http.Request) {
+	engine := config.EngineType(r.PathValue("engine"))
+	update := a.scanner.EngineUpdateStatus(engine)
+	if update == nil {
+		a.jsonError(w, "No update requested for engine: "+string(engine), http.StatusNotFound)
+		return
+	}
+	a.jsonResponse(w, update, http.StatusOK)
+}
+
+// handleGetDefinitionSets reports the engine's blue/green definition sets
+// and which one it loads
+func (a *API) handleGetDefinitionSets(w http.ResponseWriter, r *http.Request) {
+	engine := config.EngineType(r.PathValue("engine"))
+	sets, err := a.scanner.EngineDefinitionSets(engine)
+	switch {
+	case errors.Is(err, scanner.ErrUnknownEngine):
+		a.jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, scanner.ErrDefinitionSetsUnsupported):
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		a.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.jsonResponse(w, sets, http.StatusOK)
+}
+
+// handleSwitchDefinitionSet points the engine at another definition set, to
+// roll out or roll back signatures
+func (a *API) handleSwitchDefinitionSet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Set string `json:"set"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	engine := config.EngineType(r.PathValue("engine"))
+	sets, err := a.scanner.SwitchDefinitionSet(engine, req.Set)
+	switch {
+	case errors.Is(err, scanner.ErrUnknownEngine):
+		a.jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, scanner.ErrDefinitionSetsUnsupported), errors.Is(err, scanner.ErrUnknownDefinitionSet):
+		a.jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, scanner.ErrUpdateRunning):
+		a.jsonError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		a.jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.Warn("Definition set switched", "engine", engine, "set", sets.Active, "caller", callerName(r))
+	a.jsonResponse(w, sets, http.StatusOK)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestAPI_EngineUpdate(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	updater := filepath.Join(tmpDir, "freshclam")
+	os.WriteFile(updater, []byte("#!/bin/sh\necho 'daily.cvd updated'\n"), 0755)
+	api.config.Drivers[config.EngineClamAV] = config.DriverConfig{
+		Engine:        config.EngineClamAV,
+		UpdateCommand: []string{updater},
+		UpdateTimeout: 5000,
+	}
+
+	request := func(method, engine string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/engines/"+engine+"/update", nil)
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request(http.MethodGet, "clamav"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 before any update, got %d", rr.Code)
+	}
+	if rr := request(http.MethodPost, "clamav"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var update map[string]interface{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rr := request(http.MethodGet, "clamav")
+		json.Unmarshal(rr.Body.Bytes(), &update)
+		if update["status"] != "running" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if update["status"] != "succeeded" {
+		t.Errorf("expected the update to succeed, got %v", update)
+	}
+	if output, _ := update["output"].([]interface{}); len(output) != 1 || output[0] != "daily.cvd updated" {
+		t.Errorf("expected the updater output as progress, got %v", update["output"])
+	}
+
+	if rr := request(http.MethodPost, "trendmicro"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without an update command, got %d", rr.Code)
+	}
+	if rr := request(http.MethodPost, "bogus"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown engine, got %d", rr.Code)
+	}
+}
+
+func TestAPI_DefinitionSets(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	blue, green := filepath.Join(tmpDir, "blue"), filepath.Join(tmpDir, "green")
+	os.Mkdir(blue, 0755)
+	os.Mkdir(green, 0755)
+	link := filepath.Join(tmpDir, "clamav")
+	os.Symlink(blue, link)
+	api.config.Drivers[config.EngineClamAV] = config.DriverConfig{
+		Engine:          config.EngineClamAV,
+		DefinitionsLink: link,
+		DefinitionSets:  []string{blue, green},
+	}
+
+	request := func(method, engine, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/engines/"+engine+"/definitions", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		api.Routes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	var sets map[string]interface{}
+	rr := request(http.MethodGet, "clamav", "")
+	json.Unmarshal(rr.Body.Bytes(), &sets)
+	if rr.Code != http.StatusOK || sets["active"] != "blue" {
+		t.Errorf("expected blue active, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = request(http.MethodPut, "clamav", `{"set":"green"}`)
+	json.Unmarshal(rr.Body.Bytes(), &sets)
+	if rr.Code != http.StatusOK || sets["active"] != "green" {
+		t.Errorf("expected green active after the switch, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if target, _ := os.Readlink(link); target != green {
+		t.Errorf("expected the link to point at green, got %q", target)
+	}
+
+	if rr := request(http.MethodPut, "clamav", `{"set":"red"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown set, got %d", rr.Code)
+	}
+	if rr := request(http.MethodGet, "trendmicro", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without definition sets, got %d", rr.Code)
+	}
+	if rr := request(http.MethodGet, "bogus", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown engine, got %d", rr.Code)
+	}
+}
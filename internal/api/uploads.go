@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// largeUploadPercent is how close to MAX_FILE_SIZE an upload must be to be
+// counted per caller
+const largeUploadPercent = 90
+
+// recordUploadMetrics records an upload's size by verdict and type, and
+// counts uploads near the size limit per caller to spot abuse
+func (a *API) recordUploadMetrics(caller, fileName string, size int64, status drivers.ScanStatus) {
+	metrics.RecordScanSize(string(status), metrics.FileType(fileName), size)
+	if size*100 >= a.config.MaxFileSize*largeUploadPercent {
+		metrics.RecordLargeUpload(caller)
+	}
+}
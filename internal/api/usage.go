@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/accounting"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// chargeUsage charges an upload to its caller's monthly usage before it is
+// scanned. A used-up quota is returned as a *scanner.ThrottledError, retried
+// after the quota resets, so it gets 429 wherever throttling does. Dry runs
+// are free.
+func (a *API) chargeUsage(u *upload) error {
+	if a.usage == nil || u.options.DryRun {
+		return nil
+	}
+	caller := u.origin.Caller
+	err := a.usage.Charge(caller, u.size)
+	var quotaErr *accounting.QuotaError
+	if errors.As(err, &quotaErr) {
+		metrics.RecordQuotaExceeded(caller, quotaErr.Limit)
+		a.logger.Warn("Scan refused, monthly quota exceeded", "fileId", u.fileID, "caller", caller, "limit", quotaErr.Limit)
+		return &scanner.ThrottledError{RetryAfter: time.Until(quotaErr.ResetAt), Reason: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	metrics.RecordCallerUsage(caller, u.size)
+	return nil
+}
+
+// refundUsage takes back chargeUsage for an upload the scanner refused
+func (a *API) refundUsage(u *upload) {
+	if a.usage == nil || u.options.DryRun {
+		return
+	}
+	a.usage.Refund(u.origin.Caller, u.size)
+}
+
+// handleUsage reports the calling service account's usage and quota for a
+// month (GET /api/v1/usage?period=2026-10, default the current month)
+func (a *API) handleUsage(w http.ResponseWriter, r *http.Request) {
+	period, ok := a.usagePeriod(w, r)
+	if !ok {
+		return
+	}
+	usage := a.usage.Usage(callerName(r), period)
+	response := map[string]interface{}{
+		"caller": usage.Caller,
+		"period": usage.Period,
+		"scans":  usage.Scans,
+		"bytes":  usage.Bytes,
+	}
+	if quota := a.usage.Quota(); quota != (accounting.Quota{}) && usage.Period == a.usage.CurrentPeriod() {
+		response["quota"] = quota
+		response["resetAt"] = a.usage.ResetAt()
+	}
+	a.jsonResponse(w, response, http.StatusOK)
+}
+
+// handleListUsage reports every caller's usage for a month, busiest first,
+// for chargeback (GET /api/v1/admin/usage?period=2026-10)
+func (a *API) handleListUsage(w http.ResponseWriter, r *http.Request) {
+	period, ok := a.usagePeriod(w, r)
+	if !ok {
+		return
+	}
+	if period == "" {
+		period = a.usage.CurrentPeriod()
+	}
+	a.jsonResponse(w, map[string]interface{}{
+		"period":  period,
+		"callers": a.usage.List(period),
+	}, http.StatusOK)
+}
+
+// usagePeriod returns the requested month, "" for the current one. On
+// failure it writes the error response and returns false.
+func (a *API) usagePeriod(w http.ResponseWriter, r *http.Request) (string, bool) {
+	period := r.URL.Query().Get("period")
+	if period != "" && !accounting.ValidPeriod(period) {
+		a.jsonError(w, "Invalid period, expected YYYY-MM: "+period, http.StatusBadRequest)
+		return "", false
+	}
+	return period, true
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/accounting"
+)
+
+func TestAPI_Usage_Quota(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	usage, err := accounting.Open("", accounting.Quota{Scans: 2}, api.logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	api.usage = usage
+	handler := api.Routes()
+
+	scan := func() *httptest.ResponseRecorder {
+		body, contentType := createMultipartFile(t, "file", "report.pdf", []byte("report"))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	for i := range 2 {
+		if rr := scan(); rr.Code != http.StatusOK {
+			t.Fatalf("scan %d: expected 200, got %d: %s", i, rr.Code, rr.Body.String())
+		}
+	}
+	rr := scan()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 beyond the quota, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retryAfter <= 0 {
+		t.Errorf("expected Retry-After until the quota resets, got %q", rr.Header().Get("Retry-After"))
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("expected the refused upload to be removed, found %d files", len(entries))
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/usage", nil))
+	var mine struct {
+		Caller  string           `json:"caller"`
+		Scans   int64            `json:"scans"`
+		Bytes   int64            `json:"bytes"`
+		Quota   accounting.Quota `json:"quota"`
+		ResetAt string           `json:"resetAt"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &mine); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if mine.Caller != anonymousCaller || mine.Scans != 2 || mine.Bytes != 12 || mine.Quota.Scans != 2 || mine.ResetAt == "" {
+		t.Errorf("unexpected usage: %+v", mine)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/usage", nil))
+	var all struct {
+		Callers []accounting.Usage `json:"callers"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &all); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(all.Callers) != 1 || all.Callers[0].Scans != 2 {
+		t.Errorf("unexpected caller usage: %+v", all.Callers)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/usage?period=last-month", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid period, got %d", rr.Code)
+	}
+}
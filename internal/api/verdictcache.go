@@ -0,0 +1,160 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// verdictCache keeps recent verdicts by content, so identical uploads, e.g.
+// from clients that retry, are answered without invoking the engine
+type verdictCache struct {
+	ttl     time.Duration
+	size    int
+	mu      sync.Mutex
+	entries map[string]*verdictEntry
+}
+
+type verdictEntry struct {
+	result  scanner.ScanResponse
+	expires time.Time
+}
+
+// newVerdictCache returns nil when ttl or size is 0
+func newVerdictCache(ttl time.Duration, size int) *verdictCache {
+	if ttl <= 0 || size <= 0 {
+		return nil
+	}
+	return &verdictCache{ttl: ttl, size: size, entries: make(map[string]*verdictEntry)}
+}
+
+func (c *verdictCache) get(key string) (scanner.ScanResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return scanner.ScanResponse{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return scanner.ScanResponse{}, false
+	}
+	return entry.result, true
+}
+
+func (c *verdictCache) put(key string, result scanner.ScanResponse) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evictLocked(now)
+	}
+	c.entries[key] = &verdictEntry{result: result, expires: now.Add(c.ttl)}
+}
+
+// evictLocked drops expired verdicts, or else the one closest to expiring;
+// callers hold c.mu
+func (c *verdictCache) evictLocked(now time.Time) {
+	var oldest string
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.entries) >= c.size {
+		delete(c.entries, oldest)
+	}
+}
+
+// noCacheRequested reports whether the client asked for a fresh scan, with
+// ?noCache=true or Cache-Control: no-cache
+func noCacheRequested(r *http.Request) bool {
+	return r.URL.Query().Get("noCache") == "true" || strings.Contains(r.Header.Get("Cache-Control"), "no-cache")
+}
+
+// verdictKey identifies what an upload's verdict depends on: its content,
+// the engines and their definitions, the profile, and the name and MIME
+// type that policy rules match. Verdicts are kept per caller, so a hit does
+// not reveal that another tenant uploaded the same content. It is "" for
+// uploads whose verdict is not cached: dry runs and archives opened with
+// passwords.
+func (a *API) verdictKey(u *upload) string {
+	if u.hashes.SHA256 == "" || u.options.DryRun || len(u.options.Passwords) > 0 {
+		return ""
+	}
+	return strings.Join([]string{
+		u.origin.Caller,
+		u.hashes.SHA256,
+		string(a.scanner.ActiveEngine()),
+		fmt.Sprint(u.options.Engines),
+		a.scanner.DefinitionsVersion(),
+		string(u.options.Profile),
+		strings.ToLower(filepath.Ext(u.fileName)),
+		u.options.MimeType,
+	}, "|")
+}
+
+// cachedVerdict returns an earlier verdict for the upload's content, or nil
+// to scan it
+func (a *API) cachedVerdict(u *upload) *scanner.ScanResponse {
+	if a.verdicts == nil {
+		return nil
+	}
+	key := a.verdictKey(u)
+	if key == "" {
+		return nil
+	}
+	if u.noCache {
+		metrics.RecordVerdictCache("bypass")
+		return nil
+	}
+	cached, ok := a.verdicts.get(key)
+	if !ok {
+		metrics.RecordVerdictCache("miss")
+		return nil
+	}
+	metrics.RecordVerdictCache("hit")
+	a.logger.Info("Verdict reused from cache", "fileId", u.fileID, "sha256", u.hashes.SHA256, "status", cached.Status, "cachedFileId", cached.FileID)
+
+	result := cached
+	result.FileID = u.fileID
+	result.ScanResult = nil
+	result.TotalDuration = 0
+	result.Timings = nil
+	result.Cached = true
+	return &result
+}
+
+// cacheVerdict keeps a scan's verdict for reuse. Only verdicts the engines
+// reached are kept, before caller feedback is applied.
+func (a *API) cacheVerdict(u *upload, result *scanner.ScanResponse) {
+	if a.verdicts == nil || result.Cached {
+		return
+	}
+	switch result.Status {
+	case drivers.StatusClean, drivers.StatusInfected, drivers.StatusSuspicious:
+	default:
+		return
+	}
+	key := a.verdictKey(u)
+	if key == "" {
+		return
+	}
+	cached := *result
+	cached.Timings = nil
+	// Appending to a reused result must not write to the cached one
+	cached.Findings = slices.Clip(cached.Findings)
+	a.verdicts.put(key, cached)
+}
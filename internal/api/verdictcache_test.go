@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func TestAPI_VerdictCache(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+	api.verdicts = newVerdictCache(time.Minute, 10)
+	handler := api.Routes()
+
+	scan := func(content, query, cacheControl string) map[string]interface{} {
+		t.Helper()
+		body, contentType := createMultipartFile(t, "file", "report.pdf", []byte(content))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scan"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Cache-Control", cacheControl)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	first := scan("report", "", "")
+	if first["cached"] != nil {
+		t.Fatalf("expected the first scan to run, got %v", first)
+	}
+	second := scan("report", "", "")
+	if second["cached"] != true || second["status"] != first["status"] || second["fileId"] == first["fileId"] {
+		t.Errorf("expected the verdict to be reused under a new fileId, got %v after %v", second, first)
+	}
+
+	// Clients may insist on a fresh scan, and other content is scanned
+	if resp := scan("report", "?noCache=true", ""); resp["cached"] != nil {
+		t.Errorf("expected noCache=true to bypass the cache, got %v", resp)
+	}
+	if resp := scan("report", "", "no-cache"); resp["cached"] != nil {
+		t.Errorf("expected Cache-Control: no-cache to bypass the cache, got %v", resp)
+	}
+	if resp := scan("other report", "", ""); resp["cached"] != nil {
+		t.Errorf("expected other content to be scanned, got %v", resp)
+	}
+	if resp := scan("report", "?dryRun=true", ""); resp["cached"] != nil {
+		t.Errorf("expected dry runs not to use the cache, got %v", resp)
+	}
+}
+
+func TestVerdictCache_Expiry(t *testing.T) {
+	c := newVerdictCache(time.Minute, 2)
+	c.put("a", scanner.ScanResponse{FileID: "a"})
+	c.put("b", scanner.ScanResponse{FileID: "b"})
+	c.entries["a"].expires = time.Now().Add(-time.Second)
+	if _, ok := c.get("a"); ok {
+		t.Error("expected an expired verdict to be dropped")
+	}
+
+	// A full cache drops the verdict closest to expiring
+	c.put("a", scanner.ScanResponse{FileID: "a"})
+	c.put("c", scanner.ScanResponse{FileID: "c"})
+	if _, ok := c.get("b"); ok || len(c.entries) != 2 {
+		t.Errorf("expected the oldest verdict to be evicted, have %d", len(c.entries))
+	}
+	if newVerdictCache(0, 10) != nil {
+		t.Error("expected a zero TTL to disable the cache")
+	}
+}
+
+func TestAPI_VerdictKeyPerCaller(t *testing.T) {
+	api, tmpDir := newTestAPI(t)
+	defer os.RemoveAll(tmpDir)
+
+	upload := func(caller string) *upload {
+		return &upload{fileName: "report.pdf", hashes: scanner.Hashes{SHA256: "abc"}, origin: Origin{Caller: caller}}
+	}
+	if api.verdictKey(upload("prod/ns1/sa1")) == api.verdictKey(upload("prod/ns2/sa2")) {
+		t.Error("expected callers not to share cached verdicts")
+	}
+	if api.verdictKey(upload("prod/ns1/sa1")) != api.verdictKey(upload("prod/ns1/sa1")) {
+		t.Error("expected a caller's repeated uploads to share a key")
+	}
+}
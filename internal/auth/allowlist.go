@@ -13,12 +13,18 @@ import (
 // AllowlistConfig represents the YAML structure of the allowlist file
 type AllowlistConfig struct {
 	Allowlist []string `yaml:"allowlist"`
+	Admins    []string `yaml:"admins"` // may also call admin endpoints; implicitly allowed
+	// Engines reserves scan engines for the listed identities and admins.
+	// Engines not listed may be requested by every allowed caller.
+	Engines map[string][]string `yaml:"engines"`
 }
 
 // Allowlist manages a thread-safe set of allowed service accounts
 type Allowlist struct {
 	mu       sync.RWMutex
 	entries  map[string]bool
+	admins   map[string]bool
+	engines  map[string]map[string]bool // engine -> identities granted it
 	filePath string
 	logger   *slog.Logger
 	watcher  *fsnotify.Watcher
@@ -29,6 +35,8 @@ type Allowlist struct {
 func NewAllowlist(filePath string, logger *slog.Logger) (*Allowlist, error) {
 	a := &Allowlist{
 		entries:  make(map[string]bool),
+		admins:   make(map[string]bool),
+		engines:  make(map[string]map[string]bool),
 		filePath: filePath,
 		logger:   logger,
 		stopCh:   make(chan struct{}),
@@ -57,12 +65,25 @@ func (a *Allowlist) load() error {
 	for _, entry := range config.Allowlist {
 		entries[entry] = true
 	}
+	admins := make(map[string]bool)
+	for _, entry := range config.Admins {
+		admins[entry] = true
+	}
+	engines := make(map[string]map[string]bool)
+	for engine, granted := range config.Engines {
+		engines[engine] = make(map[string]bool)
+		for _, entry := range granted {
+			engines[engine][entry] = true
+		}
+	}
 
 	a.mu.Lock()
 	a.entries = entries
+	a.admins = admins
+	a.engines = engines
 	a.mu.Unlock()
 
-	a.logger.Info("Allowlist loaded", "entries", len(entries))
+	a.logger.Info("Allowlist loaded", "entries", len(entries), "admins", len(admins), "restrictedEngines", len(engines))
 	return nil
 }
 
@@ -71,7 +92,25 @@ func (a *Allowlist) IsAllowed(cluster, namespace, serviceAccount string) bool {
 	key := fmt.Sprintf("%s/%s/%s", cluster, namespace, serviceAccount)
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	return a.entries[key]
+	return a.entries[key] || a.admins[key]
+}
+
+// IsAdmin checks if the given cluster/namespace/serviceAccount may call admin endpoints
+func (a *Allowlist) IsAdmin(cluster, namespace, serviceAccount string) bool {
+	key := fmt.Sprintf("%s/%s/%s", cluster, namespace, serviceAccount)
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.admins[key]
+}
+
+// MayUseEngine checks if the given cluster/namespace/serviceAccount may request
+// a scan engine. Admins may request every engine.
+func (a *Allowlist) MayUseEngine(cluster, namespace, serviceAccount, engine string) bool {
+	key := fmt.Sprintf("%s/%s/%s", cluster, namespace, serviceAccount)
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	granted, restricted := a.engines[engine]
+	return !restricted || granted[key] || a.admins[key]
 }
 
 // Watch starts watching the allowlist file for changes and reloads on modification
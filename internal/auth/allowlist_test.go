@@ -49,6 +49,78 @@ func TestAllowlist_LoadAndCheck(t *testing.T) {
 	}
 }
 
+func TestAllowlist_Admins(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "allowlist.yaml")
+
+	content := `allowlist:
+  - prod/ns1/sa1
+admins:
+  - prod/ops/operator
+`
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+
+	allowlist, err := NewAllowlist(tmpFile, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create allowlist: %v", err)
+	}
+
+	if allowlist.IsAdmin("prod", "ns1", "sa1") {
+		t.Error("expected prod/ns1/sa1 not to be admin")
+	}
+	if !allowlist.IsAdmin("prod", "ops", "operator") {
+		t.Error("expected prod/ops/operator to be admin")
+	}
+	if !allowlist.IsAllowed("prod", "ops", "operator") {
+		t.Error("expected admin to be implicitly allowed")
+	}
+}
+
+func TestAllowlist_Engines(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "allowlist.yaml")
+
+	content := `allowlist:
+  - prod/ns1/sa1
+  - prod/ns2/sa2
+admins:
+  - prod/ops/operator
+engines:
+  trendmicro:
+    - prod/ns2/sa2
+  clamav: []
+`
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+
+	allowlist, err := NewAllowlist(tmpFile, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create allowlist: %v", err)
+	}
+
+	tests := []struct {
+		namespace      string
+		serviceAccount string
+		engine         string
+		expected       bool
+	}{
+		{"ns1", "sa1", "mock", true},
+		{"ns1", "sa1", "trendmicro", false},
+		{"ns2", "sa2", "trendmicro", true},
+		{"ns2", "sa2", "clamav", false},
+		{"ops", "operator", "clamav", true},
+	}
+
+	for _, tt := range tests {
+		result := allowlist.MayUseEngine("prod", tt.namespace, tt.serviceAccount, tt.engine)
+		if result != tt.expected {
+			t.Errorf("MayUseEngine(prod, %s, %s, %s) = %v, expected %v",
+				tt.namespace, tt.serviceAccount, tt.engine, result, tt.expected)
+		}
+	}
+}
+
 func TestAllowlist_EmptyFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	tmpFile := filepath.Join(tmpDir, "allowlist.yaml")
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// maxTrackedSources bounds failure tracking; when it is full the source
+// whose window started first and that is not banned is forgotten
+const maxTrackedSources = 10000
+
+// Ban is a source currently refused because of repeated auth failures
+type Ban struct {
+	Source      string    `json:"source"`
+	Failures    int       `json:"failures"`
+	BannedUntil time.Time `json:"bannedUntil"`
+}
+
+type offender struct {
+	failures    int
+	windowStart time.Time
+	bannedUntil time.Time
+}
+
+// Bans counts authentication failures per source and bans sources with
+// threshold failures within window for duration, so token guessing and
+// misconfigured clients stop reaching the auth service
+type Bans struct {
+	mu             sync.Mutex
+	threshold      int
+	window         time.Duration
+	duration       time.Duration
+	sourceHeader   string
+	trustedProxies int
+	sources        map[string]*offender
+}
+
+// NewBans creates a ban tracker. sourceHeader, if set, names a header such
+// as X-Forwarded-For that identifies the source instead of the peer
+// address; see SourceAddress for trustedProxies.
+func NewBans(threshold int, window, duration time.Duration, sourceHeader string, trustedProxies int) *Bans {
+	return &Bans{
+		threshold:      threshold,
+		window:         window,
+		duration:       duration,
+		sourceHeader:   sourceHeader,
+		trustedProxies: trustedProxies,
+		sources:        make(map[string]*offender),
+	}
+}
+
+// Source identifies where a request came from
+func (b *Bans) Source(r *http.Request) string {
+	return b.SourceOf(r.RemoteAddr, r.Header.Get)
+}
+
+// SourceOf identifies a source from its peer address and a header lookup
+func (b *Bans) SourceOf(remoteAddr string, header func(name string) string) string {
+	return SourceAddress(remoteAddr, b.sourceHeader, b.trustedProxies, header)
+}
+
+// SourceAddress is the address in the sourceHeader header, if set and
+// present, or else the host of the peer address. Clients can put anything
+// at the start of the header and each proxy appends the address it saw, so
+// the source is the trustedProxies-th address from the right: the one the
+// outermost of trustedProxies proxies in front of the service appended.
+// Values below 1 mean a single proxy.
+func SourceAddress(remoteAddr, sourceHeader string, trustedProxies int, header func(name string) string) string {
+	if sourceHeader != "" {
+		if value := header(sourceHeader); value != "" {
+			addresses := strings.Split(value, ",")
+			i := max(len(addresses)-max(trustedProxies, 1), 0)
+			return strings.TrimSpace(addresses[i])
+		}
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// Banned returns how long source remains banned, or 0
+func (b *Bans) Banned(source string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.sources[source]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(o.bannedUntil), 0)
+}
+
+// RecordFailure counts a failed authentication and reports whether it
+// banned the source
+func (b *Bans) RecordFailure(source string) bool {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.sources[source]
+	if !ok {
+		if len(b.sources) >= maxTrackedSources {
+			b.prune(now)
+		}
+		if len(b.sources) >= maxTrackedSources {
+			b.evictOldest(now)
+		}
+		o = &offender{windowStart: now}
+		b.sources[source] = o
+	}
+	if now.Sub(o.windowStart) > b.window {
+		o.failures = 0
+		o.windowStart = now
+	}
+	o.failures++
+	if o.failures < b.threshold || now.Before(o.bannedUntil) {
+		return false
+	}
+	o.bannedUntil = now.Add(b.duration)
+	metrics.RecordAuthBan()
+	return true
+}
+
+// List returns active bans, longest remaining first
+func (b *Bans) List() []Ban {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bans := []Ban{}
+	for source, o := range b.sources {
+		if now.Before(o.bannedUntil) {
+			bans = append(bans, Ban{Source: source, Failures: o.failures, BannedUntil: o.bannedUntil})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].BannedUntil.After(bans[j].BannedUntil)
+	})
+	return bans
+}
+
+// Clear lifts a ban and forgets the source's failures. It reports whether
+// the source was banned.
+func (b *Bans) Clear(source string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.sources[source]
+	if !ok {
+		return false
+	}
+	delete(b.sources, source)
+	return time.Now().Before(o.bannedUntil)
+}
+
+// evictOldest forgets the unbanned source whose failure window started
+// first, so a flood of new sources cannot stop failures being counted;
+// callers hold b.mu
+func (b *Bans) evictOldest(now time.Time) {
+	var oldest string
+	var oldestStart time.Time
+	for source, o := range b.sources {
+		if now.Before(o.bannedUntil) {
+			continue
+		}
+		if oldest == "" || o.windowStart.Before(oldestStart) {
+			oldest, oldestStart = source, o.windowStart
+		}
+	}
+	if oldest != "" {
+		delete(b.sources, oldest)
+	}
+}
+
+// prune drops sources that are neither banned nor within their failure
+// window; callers hold b.mu
+func (b *Bans) prune(now time.Time) {
+	for source, o := range b.sources {
+		if !now.Before(o.bannedUntil) && now.Sub(o.windowStart) > b.window {
+			delete(b.sources, source)
+		}
+	}
+}
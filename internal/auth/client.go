@@ -4,13 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
 	"net/http"
 	"time"
 )
 
+const (
+	// authRetries is how many times a transient auth service failure is
+	// retried before the caller is rejected
+	authRetries = 2
+	// authRetryBaseDelay doubles after each attempt; the actual delay is
+	// jittered between half and all of it
+	authRetryBaseDelay = 100 * time.Millisecond
+)
+
 // ValidateRequest is the request body for kube-federated-auth /validate endpoint
 type ValidateRequest struct {
 	Token   string `json:"token"`
@@ -51,26 +62,84 @@ type CallerIdentity struct {
 
 // Client handles authentication with kube-federated-auth service
 type Client struct {
-	baseURL    string
-	cluster    string
-	httpClient *http.Client
-	logger     *slog.Logger
+	baseURL     string
+	cluster     string
+	httpClient  *http.Client
+	logger      *slog.Logger
+	validations *tokenValidations
+	retryDelay  time.Duration
+}
+
+// retryableError marks auth service failures that may succeed when repeated
+type retryableError struct {
+	err error
 }
 
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
 // NewClient creates a new auth client
 func NewClient(baseURL, cluster string, timeout time.Duration, logger *slog.Logger) *Client {
+	// Bursts from one workload arrive together; keep enough idle
+	// connections to the auth service to serve them without new handshakes
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32
+	transport.IdleConnTimeout = 90 * time.Second
+
 	return &Client{
 		baseURL: baseURL,
 		cluster: cluster,
 		httpClient: &http.Client{
-			Timeout: timeout,
+			Timeout:   timeout,
+			Transport: transport,
 		},
-		logger: logger,
+		logger:      logger,
+		validations: newTokenValidations(),
+		retryDelay:  authRetryBaseDelay,
 	}
 }
 
-// Validate validates a token against kube-federated-auth
+// EnableCache remembers successful validations for ttl, trading revocation
+// latency for fewer auth service calls. Failures are never cached.
+func (c *Client) EnableCache(ttl time.Duration) {
+	c.validations.mu.Lock()
+	defer c.validations.mu.Unlock()
+	c.validations.ttl = ttl
+}
+
+// Validate validates a token against kube-federated-auth. Concurrent calls
+// with the same token share one request.
 func (c *Client) Validate(ctx context.Context, token string) (*CallerIdentity, error) {
+	return c.validations.do(ctx, token, func() (*CallerIdentity, error) {
+		// The shared request must not fail because the first caller went away
+		return c.validateWithRetry(context.WithoutCancel(ctx), token)
+	})
+}
+
+// validateWithRetry retries connection failures and 502/503/504 responses
+// with jittered exponential backoff. Rejected tokens fail immediately.
+func (c *Client) validateWithRetry(ctx context.Context, token string) (*CallerIdentity, error) {
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		identity, err := c.validate(ctx, token)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt == authRetries {
+			return identity, err
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		c.logger.Warn("auth service unavailable, retrying",
+			"attempt", attempt+1,
+			"delay", wait,
+			"error", err,
+		)
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+func (c *Client) validate(ctx context.Context, token string) (*CallerIdentity, error) {
 	reqBody := ValidateRequest{
 		Token:   token,
 		Cluster: c.cluster,
@@ -89,9 +158,13 @@ func (c *Client) Validate(ctx context.Context, token string) (*CallerIdentity, e
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call auth service: %w", err)
+		return nil, &retryableError{fmt.Errorf("failed to call auth service: %w", err)}
 	}
-	defer resp.Body.Close()
+	defer func() {
+		// Drain so the connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
 
 	switch resp.StatusCode {
 	case http.StatusOK:
@@ -120,6 +193,8 @@ func (c *Client) Validate(ctx context.Context, token string) (*CallerIdentity, e
 			return nil, fmt.Errorf("auth failed: status %d", resp.StatusCode)
 		}
 		return nil, fmt.Errorf("%s: %s", errResp.Error, errResp.Message)
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return nil, &retryableError{fmt.Errorf("auth service unavailable: status %d", resp.StatusCode)}
 	default:
 		body, _ := io.ReadAll(resp.Body)
 		c.logger.Error("auth service error",
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -161,3 +163,148 @@ func TestClient_Validate_NetworkError(t *testing.T) {
 		t.Fatal("expected error, got nil")
 	}
 }
+
+// validatingServer accepts every token and counts calls; release unblocks them
+func validatingServer(calls *atomic.Int32, release <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if release != nil {
+			<-release
+		}
+		json.NewEncoder(w).Encode(ValidateResponse{
+			KubernetesIO: &KubernetesMetadata{
+				Namespace:      "test-ns",
+				ServiceAccount: &ServiceAccountInfo{Name: "test-sa"},
+			},
+		})
+	}))
+}
+
+func TestClient_Validate_Singleflight(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := validatingServer(&calls, release)
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-cluster", 5*time.Second, testLogger())
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Validate(context.Background(), "test-token")
+			errs <- err
+		}()
+	}
+	// Let the callers pile up behind the first request
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 auth service call, got %d", n)
+	}
+
+	// Without a cache, later calls validate again
+	client.Validate(context.Background(), "test-token")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 auth service calls, got %d", n)
+	}
+}
+
+func TestClient_Validate_Cache(t *testing.T) {
+	var calls atomic.Int32
+	server := validatingServer(&calls, nil)
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-cluster", 5*time.Second, testLogger())
+	client.EnableCache(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, err := client.Validate(context.Background(), "test-token"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 auth service call, got %d", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	client.Validate(context.Background(), "test-token")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected expired entry to be revalidated, got %d calls", n)
+	}
+}
+
+func TestClient_Validate_RetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(ValidateResponse{
+			KubernetesIO: &KubernetesMetadata{
+				Namespace:      "test-ns",
+				ServiceAccount: &ServiceAccountInfo{Name: "test-sa"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-cluster", 5*time.Second, testLogger())
+	client.retryDelay = time.Millisecond
+	if _, err := client.Validate(context.Background(), "test-token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestClient_Validate_RetriesBounded(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-cluster", 5*time.Second, testLogger())
+	client.retryDelay = time.Millisecond
+	_, err := client.Validate(context.Background(), "test-token")
+	if err == nil || err.Error() != "auth service unavailable: status 502" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := calls.Load(); n != authRetries+1 {
+		t.Errorf("expected %d attempts, got %d", authRetries+1, n)
+	}
+}
+
+func TestClient_Validate_RejectionNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid_token", Message: "token expired"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-cluster", 5*time.Second, testLogger())
+	client.retryDelay = time.Millisecond
+	if _, err := client.Validate(context.Background(), "test-token"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 attempt, got %d", n)
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// maxCachedTokens bounds the validation cache; new tokens are not cached
+// while it is full of unexpired entries
+const maxCachedTokens = 10000
+
+// validation is an in-flight or cached token validation
+type validation struct {
+	done     chan struct{}
+	identity *CallerIdentity
+	err      error
+	expires  time.Time
+}
+
+// tokenValidations collapses concurrent validations of the same token into
+// one auth service call and optionally remembers successful ones. Tokens are
+// keyed by hash so they are not kept in memory.
+type tokenValidations struct {
+	mu       sync.Mutex
+	inflight map[[sha256.Size]byte]*validation
+	cache    map[[sha256.Size]byte]*validation
+	ttl      time.Duration
+}
+
+func newTokenValidations() *tokenValidations {
+	return &tokenValidations{
+		inflight: make(map[[sha256.Size]byte]*validation),
+		cache:    make(map[[sha256.Size]byte]*validation),
+	}
+}
+
+// do returns the cached or in-flight result for token, or runs validate.
+// Callers waiting on another's validation give up when ctx is done.
+func (v *tokenValidations) do(ctx context.Context, token string, validate func() (*CallerIdentity, error)) (*CallerIdentity, error) {
+	key := sha256.Sum256([]byte(token))
+
+	v.mu.Lock()
+	if cached, ok := v.cache[key]; ok {
+		if time.Now().Before(cached.expires) {
+			v.mu.Unlock()
+			return cached.identity, nil
+		}
+		delete(v.cache, key)
+	}
+	if call, ok := v.inflight[key]; ok {
+		v.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.identity, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &validation{done: make(chan struct{})}
+	v.inflight[key] = call
+	v.mu.Unlock()
+
+	call.identity, call.err = validate()
+
+	v.mu.Lock()
+	delete(v.inflight, key)
+	if call.err == nil && v.ttl > 0 {
+		call.expires = time.Now().Add(v.ttl)
+		v.store(key, call)
+	}
+	v.mu.Unlock()
+	close(call.done)
+	return call.identity, call.err
+}
+
+// store caches a successful validation; callers hold v.mu
+func (v *tokenValidations) store(key [sha256.Size]byte, call *validation) {
+	if len(v.cache) >= maxCachedTokens {
+		now := time.Now()
+		for k, cached := range v.cache {
+			if !now.Before(cached.expires) {
+				delete(v.cache, k)
+			}
+		}
+		if len(v.cache) >= maxCachedTokens {
+			return
+		}
+	}
+	v.cache[key] = call
+}
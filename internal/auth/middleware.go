@@ -3,10 +3,16 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/metrics"
 )
 
 type contextKey string
@@ -19,6 +25,7 @@ type Middleware struct {
 	allowlist *Allowlist
 	logger    *slog.Logger
 	skipPaths map[string]bool
+	bans      *Bans
 }
 
 // NewMiddleware creates a new auth middleware
@@ -35,6 +42,27 @@ func NewMiddleware(client *Client, allowlist *Allowlist, logger *slog.Logger, sk
 	}
 }
 
+// EnableBans refuses requests from sources with repeated auth failures
+// until their ban expires
+func (m *Middleware) EnableBans(bans *Bans) {
+	m.bans = bans
+}
+
+// Bans returns the ban tracker, or nil if bans are disabled
+func (m *Middleware) Bans() *Bans {
+	return m.bans
+}
+
+// AuthError is an authentication or authorization failure. Status is the
+// HTTP status it maps to; RetryAfter is set for banned sources.
+type AuthError struct {
+	Status     int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *AuthError) Error() string { return e.Message }
+
 // Handler wraps an http.Handler with authentication and authorization
 func (m *Middleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -44,58 +72,108 @@ func (m *Middleware) Handler(next http.Handler) http.Handler {
 			return
 		}
 
-		// Extract token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			m.jsonError(w, "missing Authorization header", http.StatusUnauthorized)
-			return
+		source := ""
+		if m.bans != nil {
+			source = m.bans.Source(r)
 		}
-
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == authHeader {
-			m.jsonError(w, "invalid Authorization header format, expected 'Bearer <token>'", http.StatusUnauthorized)
+		identity, err := m.Authenticate(r.Context(), r.Header.Get("Authorization"), source, r.Method, r.URL.Path)
+		if err != nil {
+			var authErr *AuthError
+			if !errors.As(err, &authErr) {
+				authErr = &AuthError{Status: http.StatusUnauthorized, Message: err.Error()}
+			}
+			if authErr.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(authErr.RetryAfter.Seconds()))))
+			}
+			m.jsonError(w, authErr.Message, authErr.Status)
 			return
 		}
 
-		// Validate token
-		identity, err := m.client.Validate(r.Context(), token)
-		if err != nil {
-			m.logger.Warn("Authentication failed",
-				"error", err,
-				"path", r.URL.Path,
-				"method", r.Method,
-			)
-			m.jsonError(w, "authentication failed: "+err.Error(), http.StatusUnauthorized)
-			return
+		// Add identity to context
+		next.ServeHTTP(w, r.WithContext(WithCallerIdentity(r.Context(), identity)))
+	})
+}
+
+// Authenticate checks an Authorization header value: bans for source, the
+// bearer token and the allowlist. It serves front ends other than HTTP,
+// such as gRPC; method and path are only logged. Failures are *AuthError.
+func (m *Middleware) Authenticate(ctx context.Context, authHeader, source, method, path string) (*CallerIdentity, error) {
+	// Refuse banned sources without calling the auth service
+	if m.bans != nil {
+		if remaining := m.bans.Banned(source); remaining > 0 {
+			metrics.RecordBannedRequest()
+			return nil, &AuthError{Status: http.StatusTooManyRequests, Message: "too many authentication failures", RetryAfter: remaining}
 		}
+	}
 
-		// Check allowlist authorization
-		if !m.allowlist.IsAllowed(identity.Cluster, identity.Namespace, identity.ServiceAccount) {
-			m.logger.Warn("Authorization failed: not in allowlist",
-				"cluster", identity.Cluster,
-				"namespace", identity.Namespace,
-				"serviceAccount", identity.ServiceAccount,
-				"path", r.URL.Path,
-				"method", r.Method,
-			)
-			m.jsonError(w, fmt.Sprintf("forbidden: %s/%s/%s not in allowlist",
-				identity.Cluster, identity.Namespace, identity.ServiceAccount), http.StatusForbidden)
-			return
+	// Extract token from Authorization header
+	if authHeader == "" {
+		return nil, m.unauthorized(source, "missing Authorization header")
+	}
+
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == authHeader {
+		return nil, m.unauthorized(source, "invalid Authorization header format, expected 'Bearer <token>'")
+	}
+
+	// Validate token
+	identity, err := m.client.Validate(ctx, token)
+	if err != nil {
+		m.logger.Warn("Authentication failed",
+			"error", err,
+			"path", path,
+			"method", method,
+		)
+		// An unreachable auth service is not the caller's fault
+		var unavailable *retryableError
+		if errors.As(err, &unavailable) {
+			return nil, &AuthError{Status: http.StatusUnauthorized, Message: "authentication failed: " + err.Error()}
 		}
+		return nil, m.unauthorized(source, "authentication failed: "+err.Error())
+	}
 
-		// Log successful authentication
-		m.logger.Info("Request authenticated",
+	// Check allowlist authorization
+	if !m.allowlist.IsAllowed(identity.Cluster, identity.Namespace, identity.ServiceAccount) {
+		m.logger.Warn("Authorization failed: not in allowlist",
 			"cluster", identity.Cluster,
 			"namespace", identity.Namespace,
 			"serviceAccount", identity.ServiceAccount,
-			"path", r.URL.Path,
-			"method", r.Method,
+			"path", path,
+			"method", method,
 		)
+		return nil, &AuthError{Status: http.StatusForbidden, Message: fmt.Sprintf("forbidden: %s/%s/%s not in allowlist",
+			identity.Cluster, identity.Namespace, identity.ServiceAccount)}
+	}
 
-		// Add identity to context
-		ctx := context.WithValue(r.Context(), CallerIdentityKey, identity)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	// Log successful authentication
+	m.logger.Info("Request authenticated",
+		"cluster", identity.Cluster,
+		"namespace", identity.Namespace,
+		"serviceAccount", identity.ServiceAccount,
+		"path", path,
+		"method", method,
+	)
+	return identity, nil
+}
+
+// unauthorized returns a 401 error and counts the failure against source
+func (m *Middleware) unauthorized(source, message string) error {
+	metrics.RecordAuthFailure()
+	if m.bans != nil {
+		if m.bans.RecordFailure(source) {
+			m.logger.Warn("Source banned after repeated authentication failures",
+				"source", source,
+				"duration", m.bans.duration,
+			)
+		}
+	}
+	return &AuthError{Status: http.StatusUnauthorized, Message: message}
+}
+
+// WithCallerIdentity returns a context carrying identity, for front ends
+// that authenticate with Authenticate
+func WithCallerIdentity(ctx context.Context, identity *CallerIdentity) context.Context {
+	return context.WithValue(ctx, CallerIdentityKey, identity)
 }
 
 func (m *Middleware) jsonError(w http.ResponseWriter, message string, status int) {
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -238,3 +239,133 @@ func TestGetCallerIdentity_NoIdentity(t *testing.T) {
 		t.Error("expected nil identity for empty context")
 	}
 }
+
+func TestMiddleware_BansRepeatedFailures(t *testing.T) {
+	calls := 0
+	middleware, _, cleanup := setupTestMiddleware(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid_token", Message: "bad token"})
+	})
+	defer cleanup()
+	middleware.EnableBans(NewBans(3, time.Minute, time.Minute, "", 1))
+
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/scan", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer guess")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := request("10.0.0.7:1234"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+	rec := request("10.0.0.7:5678")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d", rec.Code)
+	}
+	if calls != 3 {
+		t.Errorf("expected banned request not to reach the auth service, got %d calls", calls)
+	}
+	if rec := request("10.0.0.8:1234"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected other sources to be unaffected, got %d", rec.Code)
+	}
+
+	bans := middleware.Bans().List()
+	if len(bans) != 1 || bans[0].Source != "10.0.0.7" || bans[0].Failures != 3 {
+		t.Errorf("unexpected bans: %+v", bans)
+	}
+	if !middleware.Bans().Clear("10.0.0.7") {
+		t.Error("expected Clear to lift the ban")
+	}
+	if rec := request("10.0.0.7:1234"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after the ban was cleared, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_OutageDoesNotBan(t *testing.T) {
+	middleware, _, cleanup := setupTestMiddleware(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer cleanup()
+	middleware.client.retryDelay = time.Millisecond
+	middleware.EnableBans(NewBans(1, time.Minute, time.Minute, "", 1))
+
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/scan", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("attempt %d: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+	if len(middleware.Bans().List()) != 0 {
+		t.Error("expected no bans for auth service outages")
+	}
+}
+
+func TestBans_Source(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+
+	if got := NewBans(1, time.Minute, time.Minute, "", 1).Source(req); got != "10.0.0.1" {
+		t.Errorf("expected peer address, got %q", got)
+	}
+	if got := NewBans(1, time.Minute, time.Minute, "X-Forwarded-For", 1).Source(req); got != "10.0.0.1" {
+		t.Errorf("expected the right-most forwarded address, got %q", got)
+	}
+	if got := NewBans(1, time.Minute, time.Minute, "X-Forwarded-For", 2).Source(req); got != "203.0.113.9" {
+		t.Errorf("expected the address two proxies out, got %q", got)
+	}
+	if got := NewBans(1, time.Minute, time.Minute, "X-Forwarded-For", 3).Source(req); got != "203.0.113.9" {
+		t.Errorf("expected the left-most address when there are fewer than trusted proxies, got %q", got)
+	}
+}
+
+func TestBans_SpoofedForwardedFor(t *testing.T) {
+	bans := NewBans(3, time.Minute, time.Minute, "X-Forwarded-For", 1)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d, 203.0.113.9", i))
+		bans.RecordFailure(bans.Source(req))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.99, 203.0.113.9")
+	if bans.Banned(bans.Source(req)) == 0 {
+		t.Error("expected a new left-most address not to escape the ban")
+	}
+}
+
+func TestBans_EvictsWhenFull(t *testing.T) {
+	bans := NewBans(2, time.Minute, time.Minute, "", 1)
+	bans.RecordFailure("banned")
+	bans.RecordFailure("banned")
+	for i := 0; i < maxTrackedSources; i++ {
+		bans.RecordFailure(fmt.Sprintf("filler-%d", i))
+	}
+
+	// The oldest unbanned source makes room; banned ones are kept
+	if bans.Banned("banned") == 0 {
+		t.Error("expected the ban to survive a flood of new sources")
+	}
+	if _, ok := bans.sources["filler-0"]; ok {
+		t.Error("expected the oldest unbanned source to be evicted")
+	}
+
+	// Failures keep being counted once the tracker is full
+	bans.RecordFailure("guesser")
+	if !bans.RecordFailure("guesser") {
+		t.Error("expected a new source to be banned while the tracker is full")
+	}
+}
@@ -0,0 +1,330 @@
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// Options describes the synthetic corpus and how it is scanned
+type Options struct {
+	Engines     []config.EngineType
+	Files       int
+	Sizes       []int64  // bytes; files cycle through the sizes
+	Types       []string // txt, pdf, zip, png, bin
+	EICARRatio  float64  // fraction of files that are the EICAR test file
+	Concurrency int
+	Seed        int64
+}
+
+// File is one generated corpus file
+type File struct {
+	Path     string
+	Size     int64
+	Infected bool
+}
+
+// Result summarizes one engine's run over the corpus
+type Result struct {
+	Engine         config.EngineType
+	Files          int
+	Bytes          int64
+	Errors         int
+	Missed         int // infected files not reported infected
+	FalsePositives int // clean files reported infected
+	Elapsed        time.Duration
+	Latencies      []time.Duration // sorted
+	Concurrency    int
+}
+
+// Run parses bench flags, generates the corpus and prints a comparison table.
+// It returns 0 on success, 1 if any engine had errors and 2 on invalid usage.
+func Run(args []string, cfg *config.Config, logger *slog.Logger, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	engines := flags.String("engines", string(cfg.ActiveEngine), "comma-separated engines to benchmark")
+	files := flags.Int("files", 100, "number of corpus files")
+	sizes := flags.String("sizes", "1KB,64KB,1MB", "comma-separated file sizes (B, KB, MB suffixes)")
+	types := flags.String("types", "txt,pdf,zip,png,bin", "comma-separated file types")
+	eicarRatio := flags.Float64("eicar-ratio", 0.1, "fraction of files that are the EICAR test file")
+	concurrency := flags.Int("concurrency", 4, "parallel scans per engine")
+	seed := flags.Int64("seed", 1, "corpus random seed")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: av-scanner bench [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := Options{
+		Files:       *files,
+		Types:       splitList(*types),
+		EICARRatio:  *eicarRatio,
+		Concurrency: *concurrency,
+		Seed:        *seed,
+	}
+	for _, engine := range splitList(*engines) {
+		opts.Engines = append(opts.Engines, config.EngineType(engine))
+	}
+	for _, s := range splitList(*sizes) {
+		size, err := ParseSize(s)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid size %q: %v\n", s, err)
+			return 2
+		}
+		opts.Sizes = append(opts.Sizes, size)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	corpusDir, err := os.MkdirTemp("", "av-scanner-bench-*")
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to create corpus directory: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(corpusDir)
+
+	corpus, err := Generate(corpusDir, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to generate corpus: %v\n", err)
+		return 1
+	}
+
+	var results []*Result
+	for _, engine := range opts.Engines {
+		result, err := Scan(engine, cfg, logger, corpus, opts.Concurrency)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", engine, err)
+			return 1
+		}
+		results = append(results, result)
+	}
+
+	Print(stdout, results)
+	for _, r := range results {
+		if r.Errors > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (o Options) validate() error {
+	if len(o.Engines) == 0 {
+		return fmt.Errorf("at least one engine is required")
+	}
+	for _, engine := range o.Engines {
+		switch engine {
+		case config.EngineClamAV, config.EngineTrendMicro, config.EngineDefender, config.EngineSophos, config.EngineMock:
+		default:
+			return fmt.Errorf("unknown engine: %s", engine)
+		}
+	}
+	if o.Files < 1 {
+		return fmt.Errorf("files must be positive")
+	}
+	if len(o.Sizes) == 0 {
+		return fmt.Errorf("at least one size is required")
+	}
+	if len(o.Types) == 0 {
+		return fmt.Errorf("at least one file type is required")
+	}
+	for _, t := range o.Types {
+		if _, ok := fileHeaders[t]; !ok {
+			return fmt.Errorf("unknown file type: %s", t)
+		}
+	}
+	if o.EICARRatio < 0 || o.EICARRatio > 1 {
+		return fmt.Errorf("eicar-ratio must be between 0 and 1")
+	}
+	if o.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be positive")
+	}
+	return nil
+}
+
+// fileHeaders are the leading bytes that make each type recognizable
+var fileHeaders = map[string][]byte{
+	"txt": nil,
+	"pdf": []byte("%PDF-1.4\n"),
+	"zip": []byte("PK\x03\x04"),
+	"png": []byte("\x89PNG\r\n\x1a\n"),
+	"bin": {0x7F, 'E', 'L', 'F'},
+}
+
+// Generate writes a deterministic corpus to dir
+func Generate(dir string, opts Options) ([]File, error) {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	infected := int(float64(opts.Files)*opts.EICARRatio + 0.5)
+
+	corpus := make([]File, 0, opts.Files)
+	for i := 0; i < opts.Files; i++ {
+		fileType := opts.Types[i%len(opts.Types)]
+		size := opts.Sizes[i%len(opts.Sizes)]
+		isInfected := i < infected
+
+		data := make([]byte, size)
+		if fileType == "txt" {
+			const letters = "abcdefghijklmnopqrstuvwxyz \n"
+			for j := range data {
+				data[j] = letters[rng.Intn(len(letters))]
+			}
+		} else {
+			rng.Read(data)
+		}
+		copy(data, fileHeaders[fileType])
+		if isInfected {
+			// Engines only honor the EICAR pattern as the whole file content
+			data = []byte(drivers.EICARPattern())
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%04d.%s", i, fileType))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+		corpus = append(corpus, File{Path: path, Size: int64(len(data)), Infected: isInfected})
+	}
+
+	// Interleave infected files with clean ones
+	rng.Shuffle(len(corpus), func(i, j int) { corpus[i], corpus[j] = corpus[j], corpus[i] })
+	return corpus, nil
+}
+
+// Scan runs the corpus through one engine. The scan policy, throughput limit
+// and shadow engine are not applied so engines are compared directly.
+func Scan(engine config.EngineType, cfg *config.Config, logger *slog.Logger, corpus []File, concurrency int) (*Result, error) {
+	engineCfg := *cfg
+	engineCfg.ActiveEngine = engine
+	engineCfg.ThroughputLimit = 0
+	engineCfg.ShadowEngine = ""
+
+	s := scanner.New(&engineCfg, logger)
+	if err := s.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start engine: %w", err)
+	}
+	defer s.Stop()
+
+	result := &Result{Engine: engine, Files: len(corpus), Concurrency: concurrency}
+	var mu sync.Mutex
+	work := make(chan File)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range work {
+				scanStart := time.Now()
+				resp, err := bulkscan.ScanFile(s, f.Path)
+				latency := time.Since(scanStart)
+
+				mu.Lock()
+				result.Latencies = append(result.Latencies, latency)
+				result.Bytes += f.Size
+				switch {
+				case err != nil || resp.Status == drivers.StatusError:
+					result.Errors++
+				case f.Infected && resp.Status != drivers.StatusInfected:
+					result.Missed++
+				case !f.Infected && resp.Status == drivers.StatusInfected:
+					result.FalsePositives++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, f := range corpus {
+		work <- f
+	}
+	close(work)
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result, nil
+}
+
+// Percentile returns the p-th percentile (0-100) of the sorted latencies
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies)-1) * p / 100)
+	return r.Latencies[i]
+}
+
+// Print writes a comparison table
+func Print(w io.Writer, results []*Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENGINE\tFILES\tCONC\tFILES/S\tMB/S\tP50\tP95\tP99\tERRORS\tMISSED\tFALSE+")
+	for _, r := range results {
+		seconds := r.Elapsed.Seconds()
+		if seconds == 0 {
+			seconds = 1e-9
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.2f\t%s\t%s\t%s\t%d\t%d\t%d\n",
+			r.Engine,
+			r.Files,
+			r.Concurrency,
+			float64(r.Files)/seconds,
+			float64(r.Bytes)/(1<<20)/seconds,
+			r.Percentile(50).Round(time.Millisecond),
+			r.Percentile(95).Round(time.Millisecond),
+			r.Percentile(99).Round(time.Millisecond),
+			r.Errors,
+			r.Missed,
+			r.FalsePositives,
+		)
+	}
+	tw.Flush()
+}
+
+// ParseSize parses sizes such as "512", "64KB" or "1MB"
+func ParseSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			multiplier = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("must be a positive number of B, KB or MB")
+	}
+	return n * multiplier, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,116 @@
+package bench
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"512", 512},
+		{"512B", 512},
+		{"64KB", 64 * 1024},
+		{"1mb", 1024 * 1024},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if err != nil || got != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, %v; expected %d", tt.input, got, err, tt.expected)
+		}
+	}
+
+	for _, input := range []string{"", "KB", "-1KB", "1GB", "abc"} {
+		if _, err := ParseSize(input); err == nil {
+			t.Errorf("ParseSize(%q): expected error", input)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	opts := Options{Files: 20, Sizes: []int64{100, 200}, Types: []string{"txt", "pdf"}, EICARRatio: 0.25, Seed: 1}
+	corpus, err := Generate(t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(corpus) != 20 {
+		t.Fatalf("expected 20 files, got %d", len(corpus))
+	}
+
+	infected := 0
+	for _, f := range corpus {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			t.Fatalf("failed to read corpus file: %v", err)
+		}
+		if f.Infected {
+			infected++
+			if string(data) != drivers.EICARPattern() {
+				t.Errorf("expected %s to be the EICAR test file", f.Path)
+			}
+			continue
+		}
+		if int64(len(data)) != f.Size || (f.Size != 100 && f.Size != 200) {
+			t.Errorf("unexpected size %d for %s", len(data), f.Path)
+		}
+		if strings.HasSuffix(f.Path, ".pdf") && !bytes.HasPrefix(data, []byte("%PDF-")) {
+			t.Errorf("expected pdf header in %s", f.Path)
+		}
+	}
+	if infected != 5 {
+		t.Errorf("expected 5 infected files, got %d", infected)
+	}
+}
+
+func TestRun(t *testing.T) {
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		MaxFileSize:     10 * 1024 * 1024,
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"--files=10", "--sizes=1KB", "--eicar-ratio=0.3", "--concurrency=2"}, cfg, logger, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "mock") {
+		t.Fatalf("unexpected output:\n%s", stdout.String())
+	}
+	// Mock engine detects every EICAR file: no errors, misses or false positives
+	if fields := strings.Fields(lines[1]); fields[len(fields)-3] != "0" || fields[len(fields)-2] != "0" || fields[len(fields)-1] != "0" {
+		t.Errorf("unexpected accuracy columns: %s", lines[1])
+	}
+}
+
+func TestRun_InvalidUsage(t *testing.T) {
+	cfg := &config.Config{UploadDir: t.TempDir(), ActiveEngine: config.EngineMock}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, args := range [][]string{
+		{"--engines=unknown"},
+		{"--files=0"},
+		{"--sizes=huge"},
+		{"--types=exe"},
+		{"--eicar-ratio=2"},
+		{"--concurrency=0"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := Run(args, cfg, logger, &stdout, &stderr); code != 2 {
+			t.Errorf("%v: expected exit code 2, got %d", args, code)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+// Package bucketscan scans objects as S3 event notifications announce them,
+// the usual "bucket antivirus" deployment: each new object is downloaded,
+// scanned, and rewritten with its verdict in x-amz-meta-av-status, or moved
+// to a quarantine bucket when infected.
+package bucketscan
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/objectstore"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// Metadata written to scanned objects. av-mac authenticates the others and
+// the object's content, so an uploader can neither mark its own object as
+// already scanned nor reuse a verdict for other content.
+const (
+	metaStatus    = "X-Amz-Meta-Av-Status"
+	metaSignature = "X-Amz-Meta-Av-Signature"
+	metaSHA256    = "X-Amz-Meta-Av-Sha256"
+	metaMAC       = "X-Amz-Meta-Av-Mac"
+)
+
+// preservedHeaders survive the copy that replaces an object's metadata;
+// x-amz-meta-* headers are kept as well
+var preservedHeaders = []string{
+	"Content-Type",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Cache-Control",
+	"Expires",
+	"X-Amz-Storage-Class",
+	"X-Amz-Server-Side-Encryption",
+	"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id",
+}
+
+// job is one notification's objects; ack, if set, runs once all of them
+// were handled
+type job struct {
+	events []Event
+	ack    func()
+}
+
+// Worker scans the objects announced by notifications from an SQS queue or
+// the webhook
+type Worker struct {
+	store            *objectstore.S3
+	endpoint         string
+	quarantineBucket string
+	maxSize          int64
+	macKey           []byte
+	token            string // webhook bearer token; empty disables the webhook
+	queue            *sqsQueue
+	workers          int
+	scanner          *scanner.Scanner
+	logger           *slog.Logger
+
+	jobs   chan job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a worker for BUCKET_SCAN_*, or nil when bucket scanning is
+// disabled
+func New(cfg *config.Config, s *scanner.Scanner, logger *slog.Logger) (*Worker, error) {
+	if !cfg.BucketScanEnabled() {
+		return nil, nil
+	}
+	creds, err := objectstore.LoadCredentials(cfg.ObjectStoreCredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := cfg.ObjectStoreMaxSize
+	if maxSize == 0 {
+		maxSize = cfg.MaxFileSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Worker{
+		store:            objectstore.NewS3(cfg.ObjectStoreRegion, creds, time.Duration(cfg.ObjectStoreTimeout)*time.Millisecond),
+		endpoint:         cfg.ObjectStoreEndpoints[0],
+		quarantineBucket: cfg.BucketScanQuarantineBucket,
+		maxSize:          maxSize,
+		macKey:           hmacSHA256([]byte(creds.SecretAccessKey), "av-scanner bucket scan"),
+		workers:          cfg.BucketScanWorkers,
+		scanner:          s,
+		logger:           logger.With("component", "bucketscan"),
+		jobs:             make(chan job, 100),
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+	if cfg.BucketScanSQSQueueURL != "" {
+		w.queue = newSQSQueue(cfg.BucketScanSQSQueueURL, cfg.ObjectStoreRegion, creds)
+	}
+	if cfg.BucketScanWebhookTokenFile != "" {
+		data, err := os.ReadFile(cfg.BucketScanWebhookTokenFile)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to read bucket scan webhook token: %w", err)
+		}
+		if w.token = strings.TrimSpace(string(data)); w.token == "" {
+			cancel()
+			return nil, fmt.Errorf("bucket scan webhook token file %s is empty", cfg.BucketScanWebhookTokenFile)
+		}
+	}
+	return w, nil
+}
+
+// Start starts the scan workers and, with a queue URL, the SQS poller
+func (w *Worker) Start() {
+	for range w.workers {
+		w.wg.Add(1)
+		go w.work()
+	}
+	if w.queue != nil {
+		w.wg.Add(1)
+		go w.poll()
+	}
+	w.logger.Info("Bucket scanning started",
+		"endpoint", w.endpoint,
+		"sqs", w.queue != nil,
+		"webhook", w.token != "",
+		"quarantineBucket", w.quarantineBucket,
+	)
+}
+
+// Stop abandons queued notifications and waits for scans in progress. SQS
+// redelivers unacknowledged messages; webhook notifications are lost.
+func (w *Worker) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+// Authorized reports whether an Authorization header carries the webhook
+// token
+func (w *Worker) Authorized(authorization string) bool {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && w.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(w.token)) == 1
+}
+
+// Enqueue queues a notification's objects, returning false if the queue is
+// full
+func (w *Worker) Enqueue(events []Event) bool {
+	select {
+	case w.jobs <- job{events: events}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Worker) work() {
+	defer w.wg.Done()
+	for {
+		select {
+		case j := <-w.jobs:
+			ok := true
+			for _, event := range j.events {
+				if err := w.process(event); err != nil {
+					w.logger.Error("Bucket object scan failed", "bucket", event.Bucket, "key", event.Key, "error", err)
+					metrics.RecordBucketScan("failed")
+					ok = false
+				}
+			}
+			if ok && j.ack != nil {
+				j.ack()
+			}
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// poll feeds SQS messages to the workers. A message is deleted once all its
+// objects were scanned; one that fails becomes visible again after the
+// queue's visibility timeout and is retried.
+func (w *Worker) poll() {
+	defer w.wg.Done()
+	for w.ctx.Err() == nil {
+		messages, err := w.queue.receive(w.ctx)
+		if err != nil {
+			if w.ctx.Err() == nil {
+				w.logger.Warn("SQS receive failed", "error", err)
+				select {
+				case <-time.After(5 * time.Second):
+				case <-w.ctx.Done():
+				}
+			}
+			continue
+		}
+		for _, message := range messages {
+			receipt := message.ReceiptHandle
+			ack := func() {
+				if err := w.queue.delete(w.ctx, receipt); err != nil {
+					w.logger.Warn("SQS delete failed", "error", err)
+				}
+			}
+			events, err := ParseNotification([]byte(message.Body))
+			if err != nil {
+				// Redelivering it would fail the same way
+				w.logger.Warn("Discarding invalid SQS message", "error", err)
+				ack()
+				continue
+			}
+			select {
+			case w.jobs <- job{events: events, ack: ack}:
+			case <-w.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// process scans one object and records the verdict on it
+func (w *Worker) process(event Event) error {
+	obj, err := w.store.Get(w.ctx, w.endpoint, event.Bucket, event.Key)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		// Deleted or moved since the notification
+		metrics.RecordBucketScan("ignored")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { obj.Body.Close() }()
+
+	// Writing the verdict copies the object, which announces it again
+	if strings.HasPrefix(event.Name, "ObjectCreated:Copy") && obj.Header.Get(metaStatus) != "" {
+		verified, err := w.verified(event.Bucket, event.Key, obj)
+		if err != nil {
+			return err
+		}
+		if verified {
+			metrics.RecordBucketScan("ignored")
+			return nil
+		}
+		// Checking the verdict read the content; fetch it again to scan
+		obj.Body.Close()
+		if obj, err = w.store.Get(w.ctx, w.endpoint, event.Bucket, event.Key); err != nil {
+			if errors.Is(err, objectstore.ErrNotFound) {
+				metrics.RecordBucketScan("ignored")
+				return nil
+			}
+			return err
+		}
+	}
+
+	var status drivers.ScanStatus
+	var signature, sha string
+	if obj.Size > w.maxSize {
+		status = drivers.StatusSkipped
+		w.logger.Warn("Bucket object too large to scan", "bucket", event.Bucket, "key", event.Key, "size", obj.Size)
+	} else {
+		hasher := sha256.New()
+		result, err := bulkscan.ScanReader(w.scanner, io.TeeReader(obj.Body, hasher), path.Base(event.Key))
+		if err != nil {
+			return err
+		}
+		if result.Status == drivers.StatusError {
+			return errors.New("engine error")
+		}
+		status, signature, sha = result.Status, result.Signature, hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	bucket := event.Bucket
+	quarantine := w.quarantineBucket != "" && (status == drivers.StatusInfected || status == drivers.StatusBlocked)
+	if quarantine {
+		bucket = w.quarantineBucket
+	}
+	header := w.verdictHeader(obj, bucket, event.Key, sha, status, signature)
+	if err := w.store.Copy(w.ctx, w.endpoint, event.Bucket, event.Key, bucket, event.Key, header); err != nil {
+		return fmt.Errorf("failed to write verdict: %w", err)
+	}
+	if quarantine {
+		if err := w.store.Delete(w.ctx, w.endpoint, event.Bucket, event.Key); err != nil {
+			return fmt.Errorf("failed to remove quarantined object: %w", err)
+		}
+	}
+
+	metrics.RecordBucketScan(string(status))
+	w.logger.Info("Bucket object scanned",
+		"bucket", event.Bucket,
+		"key", event.Key,
+		"status", status,
+		"signature", signature,
+		"movedTo", bucket,
+	)
+	return nil
+}
+
+// verdictHeader is obj's metadata and system headers with the verdict for
+// content hashing to sha added. Objects too large to scan have no hash.
+func (w *Worker) verdictHeader(obj *objectstore.Object, bucket, key, sha string, status drivers.ScanStatus, signature string) http.Header {
+	header := http.Header{}
+	for _, name := range preservedHeaders {
+		if value := obj.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	for name, values := range obj.Header {
+		if strings.HasPrefix(name, "X-Amz-Meta-") && !strings.HasPrefix(name, "X-Amz-Meta-Av-") {
+			header[name] = values
+		}
+	}
+	header.Set(metaStatus, string(status))
+	if signature != "" {
+		header.Set(metaSignature, signature)
+	}
+	if sha != "" {
+		header.Set(metaSHA256, sha)
+	}
+	header.Set(metaMAC, w.mac(bucket, key, obj.Size, sha, string(status), signature))
+	return header
+}
+
+// verified reports whether obj carries a verdict this service wrote for its
+// current content. It reads the body to hash it.
+func (w *Worker) verified(bucket, key string, obj *objectstore.Object) (bool, error) {
+	status := obj.Header.Get(metaStatus)
+	if status == "" {
+		return false, nil
+	}
+	sha := obj.Header.Get(metaSHA256)
+	if sha != "" {
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, io.LimitReader(obj.Body, w.maxSize+1)); err != nil {
+			return false, err
+		}
+		if hex.EncodeToString(hasher.Sum(nil)) != sha {
+			return false, nil
+		}
+	}
+	want := w.mac(bucket, key, obj.Size, sha, status, obj.Header.Get(metaSignature))
+	return hmac.Equal([]byte(obj.Header.Get(metaMAC)), []byte(want)), nil
+}
+
+func (w *Worker) mac(bucket, key string, size int64, sha, status, signature string) string {
+	return hex.EncodeToString(hmacSHA256(w.macKey, strings.Join([]string{bucket, key, strconv.FormatInt(size, 10), sha, status, signature}, "\n")))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
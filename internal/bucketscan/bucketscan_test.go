@@ -0,0 +1,282 @@
+package bucketscan
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+type fakeObject struct {
+	data   string
+	header http.Header
+}
+
+// fakeS3 keeps objects in memory and answers path-style GET, copy and DELETE
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]*fakeObject // "bucket/key"
+	copies  int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		obj := f.objects[name]
+		if obj == nil {
+			http.NotFound(w, r)
+			return
+		}
+		for k, v := range obj.header {
+			w.Header()[k] = v
+		}
+		w.Write([]byte(obj.data))
+	case http.MethodPut:
+		source, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+		src := f.objects[source]
+		if src == nil || r.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" {
+			http.Error(w, "bad copy", http.StatusBadRequest)
+			return
+		}
+		header := http.Header{}
+		for k, v := range r.Header {
+			if k == "Content-Type" || strings.HasPrefix(k, "X-Amz-Meta-") {
+				header[k] = v
+			}
+		}
+		f.objects[name] = &fakeObject{data: src.data, header: header}
+		f.copies++
+		w.Write([]byte("<CopyObjectResult><ETag>\"x\"</ETag></CopyObjectResult>"))
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) get(name string) *fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[name]
+}
+
+// fakeSQS hands out its messages once and records deletions
+type fakeSQS struct {
+	mu       sync.Mutex
+	messages []string
+	deleted  []string
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Form.Get("Action") {
+	case "ReceiveMessage":
+		var b strings.Builder
+		b.WriteString("<ReceiveMessageResponse><ReceiveMessageResult>")
+		for i, body := range f.messages {
+			fmt.Fprintf(&b, "<Message><ReceiptHandle>r%d</ReceiptHandle><Body>%s</Body></Message>", i, html.EscapeString(body))
+		}
+		b.WriteString("</ReceiveMessageResult></ReceiveMessageResponse>")
+		f.messages = nil
+		w.Write([]byte(b.String()))
+	case "DeleteMessage":
+		f.deleted = append(f.deleted, r.Form.Get("ReceiptHandle"))
+		w.Write([]byte("<DeleteMessageResponse/>"))
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+	}
+}
+
+func notificationJSON(eventName, bucket, key string) string {
+	body, _ := json.Marshal(map[string]any{"Records": []any{map[string]any{
+		"eventName": eventName,
+		"s3": map[string]any{
+			"bucket": map[string]any{"name": bucket},
+			"object": map[string]any{"key": url.QueryEscape(key)},
+		},
+	}}})
+	return string(body)
+}
+
+func newTestWorker(t *testing.T, endpoint, queueURL string) *Worker {
+	t.Helper()
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials")
+	os.WriteFile(credentials, []byte("[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n"), 0600)
+	token := filepath.Join(dir, "token")
+	os.WriteFile(token, []byte("s3cret\n"), 0600)
+	cfg := &config.Config{
+		UploadDir:                  filepath.Join(dir, "uploads"),
+		MaxFileSize:                1024 * 1024,
+		ActiveEngine:               config.EngineMock,
+		MaxNestingDepth:            3,
+		ObjectStoreEndpoints:       []string{endpoint},
+		ObjectStoreRegion:          "us-east-1",
+		ObjectStoreCredentialsFile: credentials,
+		ObjectStoreTimeout:         5000,
+		BucketScanSQSQueueURL:      queueURL,
+		BucketScanWebhookTokenFile: token,
+		BucketScanQuarantineBucket: "quarantine",
+		BucketScanWorkers:          1,
+	}
+	os.MkdirAll(cfg.UploadDir, 0755)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	w, err := New(cfg, scanner.New(cfg, logger), logger)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return w
+}
+
+func TestWorker_SQS(t *testing.T) {
+	s3 := &fakeS3{objects: map[string]*fakeObject{
+		"uploads/docs/report 1.txt": {data: "hello", header: http.Header{
+			"Content-Type":         {"text/plain"},
+			"X-Amz-Meta-Owner":     {"alice"},
+			"X-Amz-Meta-Av-Status": {"infected"}, // stale, replaced
+		}},
+		"uploads/eicar.com": {data: drivers.EICARPattern(), header: http.Header{}},
+	}}
+	store := httptest.NewServer(s3)
+	defer store.Close()
+
+	snsWrapped, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": notificationJSON("ObjectCreated:Put", "uploads", "eicar.com")})
+	sqs := &fakeSQS{messages: []string{
+		notificationJSON("ObjectCreated:Put", "uploads", "docs/report 1.txt"),
+		string(snsWrapped),
+	}}
+	queue := httptest.NewServer(sqs)
+	defer queue.Close()
+
+	w := newTestWorker(t, store.URL, queue.URL+"/123456789012/uploads")
+	w.Start()
+	defer w.Stop()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		sqs.mu.Lock()
+		deleted := len(sqs.deleted)
+		sqs.mu.Unlock()
+		if deleted == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected both messages to be deleted, %d were", deleted)
+		}
+	}
+
+	clean := s3.get("uploads/docs/report 1.txt")
+	if clean == nil || clean.header.Get("X-Amz-Meta-Av-Status") != "clean" {
+		t.Fatalf("expected the clean object to be tagged, got %+v", clean)
+	}
+	if clean.header.Get("X-Amz-Meta-Owner") != "alice" || clean.header.Get("Content-Type") != "text/plain" {
+		t.Errorf("expected metadata to be preserved, got %v", clean.header)
+	}
+	if s3.get("uploads/eicar.com") != nil {
+		t.Error("expected the infected object to leave the bucket")
+	}
+	infected := s3.get("quarantine/eicar.com")
+	if infected == nil || infected.header.Get("X-Amz-Meta-Av-Status") != "infected" || infected.header.Get("X-Amz-Meta-Av-Signature") == "" {
+		t.Errorf("expected the infected object in quarantine with its verdict, got %+v", infected)
+	}
+}
+
+func TestWorker_CopyEvents(t *testing.T) {
+	s3 := &fakeS3{objects: map[string]*fakeObject{
+		"uploads/a.txt": {data: "hello", header: http.Header{}},
+		"uploads/forged.com": {data: drivers.EICARPattern(), header: http.Header{
+			"X-Amz-Meta-Av-Status": {"clean"},
+			"X-Amz-Meta-Av-Mac":    {"0000"},
+		}},
+	}}
+	store := httptest.NewServer(s3)
+	defer store.Close()
+	w := newTestWorker(t, store.URL, "")
+	w.quarantineBucket = ""
+	if !w.Authorized("Bearer s3cret") || w.Authorized("Bearer wrong") || w.Authorized("s3cret") {
+		t.Error("unexpected webhook token check")
+	}
+
+	if err := w.process(Event{Name: "ObjectCreated:Put", Bucket: "uploads", Key: "a.txt"}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	// The verdict copy announces the object again, which must not loop
+	if err := w.process(Event{Name: "ObjectCreated:Copy", Bucket: "uploads", Key: "a.txt"}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if s3.copies != 1 {
+		t.Errorf("expected one verdict copy, got %d", s3.copies)
+	}
+
+	// A verdict the uploader wrote itself is not trusted
+	if err := w.process(Event{Name: "ObjectCreated:Copy", Bucket: "uploads", Key: "forged.com"}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if got := s3.get("uploads/forged.com").header.Get("X-Amz-Meta-Av-Status"); got != "infected" {
+		t.Errorf("expected the forged object to be scanned, got status %q", got)
+	}
+
+	// A verdict copied onto other content of the same size is not trusted
+	s3.mu.Lock()
+	verdict := s3.objects["uploads/a.txt"].header.Clone()
+	s3.objects["uploads/a.txt"] = &fakeObject{data: "X5O!P", header: verdict}
+	s3.mu.Unlock()
+	if err := w.process(Event{Name: "ObjectCreated:Copy", Bucket: "uploads", Key: "a.txt"}); err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if s3.copies != 3 {
+		t.Errorf("expected the replaced content to be scanned and its verdict rewritten, got %d copies", s3.copies)
+	}
+	if got := s3.get("uploads/a.txt").header.Get("X-Amz-Meta-Av-Sha256"); got == verdict.Get("X-Amz-Meta-Av-Sha256") {
+		t.Errorf("expected a verdict for the new content, got hash %q", got)
+	}
+
+	// Objects deleted since the notification are ignored
+	if err := w.process(Event{Name: "ObjectCreated:Put", Bucket: "uploads", Key: "gone"}); err != nil {
+		t.Errorf("expected a missing object to be ignored, got %v", err)
+	}
+}
+
+func TestParseNotification(t *testing.T) {
+	body := `{"EventName":"s3:ObjectCreated:Put","Key":"uploads/a b.txt","Records":[
+		{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"uploads"},"object":{"key":"a+b.txt","size":5}}},
+		{"eventName":"ObjectRemoved:Delete","s3":{"bucket":{"name":"uploads"},"object":{"key":"old.txt"}}}
+	]}`
+	events, err := ParseNotification([]byte(body))
+	if err != nil {
+		t.Fatalf("ParseNotification failed: %v", err)
+	}
+	want := Event{Name: "ObjectCreated:Put", Bucket: "uploads", Key: "a b.txt", Size: 5}
+	if len(events) != 1 || events[0] != want {
+		t.Errorf("unexpected events: %+v", events)
+	}
+
+	// S3 sends a test event when the notification is configured
+	if events, err := ParseNotification([]byte(`{"Service":"Amazon S3","Event":"s3:TestEvent"}`)); err != nil || len(events) != 0 {
+		t.Errorf("expected no events for the test event, got %v (%v)", events, err)
+	}
+	if _, err := ParseNotification([]byte("not json")); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
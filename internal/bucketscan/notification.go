@@ -0,0 +1,73 @@
+package bucketscan
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Event is an object announced by an S3 event notification
+type Event struct {
+	Name   string // e.g. ObjectCreated:Put, without MinIO's "s3:" prefix
+	Bucket string
+	Key    string
+	Size   int64
+}
+
+// notification is the S3 event notification format, which MinIO webhooks
+// also send
+type notification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// snsEnvelope wraps a notification delivered to SQS through an SNS topic
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// ParseNotification returns the created objects in an S3 event
+// notification, unwrapping SNS. Other events, such as deletions and the test
+// event S3 sends when a notification is configured, are left out.
+func ParseNotification(body []byte) ([]Event, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Type == "Notification" {
+		body = []byte(envelope.Message)
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("invalid S3 event notification: %w", err)
+	}
+	var events []Event
+	for _, record := range n.Records {
+		name := strings.TrimPrefix(record.EventName, "s3:")
+		if !strings.HasPrefix(name, "ObjectCreated:") {
+			continue
+		}
+		// Keys are form-encoded, with "+" for spaces
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object key %q: %w", record.S3.Object.Key, err)
+		}
+		events = append(events, Event{
+			Name:   name,
+			Bucket: record.S3.Bucket.Name,
+			Key:    key,
+			Size:   record.S3.Object.Size,
+		})
+	}
+	return events, nil
+}
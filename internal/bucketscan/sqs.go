@@ -0,0 +1,89 @@
+package bucketscan
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/objectstore"
+)
+
+// sqsWaitSeconds is the long-poll wait; 20 is the most SQS allows
+const sqsWaitSeconds = 20
+
+type sqsMessage struct {
+	ReceiptHandle string `xml:"ReceiptHandle"`
+	Body          string `xml:"Body"`
+}
+
+// sqsQueue receives and deletes messages with the SQS query API
+type sqsQueue struct {
+	url    string
+	region string
+	creds  *objectstore.Credentials
+	client *http.Client
+}
+
+func newSQSQueue(queueURL, region string, creds *objectstore.Credentials) *sqsQueue {
+	return &sqsQueue{
+		url:    queueURL,
+		region: region,
+		creds:  creds,
+		client: &http.Client{Timeout: (sqsWaitSeconds + 10) * time.Second},
+	}
+}
+
+// receive long-polls for up to 10 messages
+func (q *sqsQueue) receive(ctx context.Context) ([]sqsMessage, error) {
+	var resp struct {
+		Messages []sqsMessage `xml:"ReceiveMessageResult>Message"`
+	}
+	err := q.call(ctx, url.Values{
+		"Action":              {"ReceiveMessage"},
+		"MaxNumberOfMessages": {"10"},
+		"WaitTimeSeconds":     {fmt.Sprint(sqsWaitSeconds)},
+	}, &resp)
+	return resp.Messages, err
+}
+
+// delete acknowledges a message so it is not delivered again
+func (q *sqsQueue) delete(ctx context.Context, receiptHandle string) error {
+	return q.call(ctx, url.Values{"Action": {"DeleteMessage"}, "ReceiptHandle": {receiptHandle}}, nil)
+}
+
+// call POSTs a signed query API action and decodes the XML response into out
+func (q *sqsQueue) call(ctx context.Context, params url.Values, out any) error {
+	params.Set("Version", "2012-11-05")
+	body := params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.url, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid SQS queue URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	objectstore.SignV4(req, q.creds, q.region, "sqs", objectstore.SHA256Hex(body), time.Now())
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SQS %s returned status %d: %s", params.Get("Action"), resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid SQS %s response: %w", params.Get("Action"), err)
+	}
+	return nil
+}
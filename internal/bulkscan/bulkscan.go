@@ -0,0 +1,310 @@
+package bulkscan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/policy"
+	"github.com/rophy/av-scanner/internal/scanner"
+	"github.com/rophy/av-scanner/internal/uploads"
+)
+
+// Exit codes are part of the CLI contract; scripts and CI gates depend on them
+const (
+	ExitClean    = 0 // every file passed
+	ExitInfected = 1 // at least one file matched --fail-on
+	ExitError    = 2 // a file could not be scanned, or invalid usage
+)
+
+// Run scans every file under the given paths with the active engine and
+// prints one line per file to stdout. Files are copied into the upload
+// directory first, so the originals are never deleted or quarantined.
+//
+// A failing verdict takes precedence over errors: if any file is infected
+// the exit code is ExitInfected even when other files failed to scan.
+func Run(args []string, cfg *config.Config, logger *slog.Logger, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("bulk-scan", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	failOn := flags.String("fail-on", "infected", "verdict that fails the run: infected|suspicious")
+	format := flags.String("format", "text", "output format: text|ndjson")
+	scanSparse := flags.Bool("scan-sparse", false, "scan extremely sparse files instead of skipping them")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: av-scanner bulk-scan [--fail-on=infected|suspicious] [--format=text|ndjson] [--scan-sparse] <path>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return ExitError
+	}
+	if *failOn != "infected" && *failOn != "suspicious" {
+		fmt.Fprintf(stderr, "invalid --fail-on value: %q\n", *failOn)
+		return ExitError
+	}
+	if *format != "text" && *format != "ndjson" {
+		fmt.Fprintf(stderr, "invalid --format value: %q\n", *format)
+		return ExitError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ExitError
+	}
+
+	if err := os.MkdirAll(cfg.EngineUploadDir(cfg.ActiveEngine), 0755); err != nil {
+		fmt.Fprintf(stderr, "failed to create upload directory: %v\n", err)
+		return ExitError
+	}
+
+	s := scanner.New(cfg, logger)
+	uploadStore, err := uploads.New(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to open upload store: %v\n", err)
+		return ExitError
+	}
+	s.SetUploadStore(uploadStore)
+	scanPolicy, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load scan policy: %v\n", err)
+		return ExitError
+	}
+	s.SetPolicy(scanPolicy)
+	if err := s.Start(); err != nil {
+		fmt.Fprintf(stderr, "failed to start scanner: %v\n", err)
+		return ExitError
+	}
+	defer s.Stop()
+
+	var failed, errored bool
+	enc := json.NewEncoder(stdout)
+	for _, root := range flags.Args() {
+		WalkWithOptions(s, root, WalkOptions{ScanSparse: *scanSparse}, func(path string, result *scanner.ScanResponse, err error) {
+			if *format == "ndjson" {
+				enc.Encode(newLine(path, result, err))
+			}
+			if err != nil {
+				if *format == "text" {
+					fmt.Fprintf(stdout, "%s\t%s\t%v\n", drivers.StatusError, path, err)
+				}
+				errored = true
+				return
+			}
+
+			if *format == "text" {
+				line := fmt.Sprintf("%s\t%s", result.Status, path)
+				if result.Signature != "" {
+					line += "\t" + result.Signature
+				} else if result.Status == drivers.StatusSkipped && len(result.Findings) > 0 {
+					line += "\t" + strings.Join(result.Findings, ",")
+				}
+				fmt.Fprintln(stdout, line)
+			}
+
+			switch result.Status {
+			case drivers.StatusInfected, drivers.StatusBlocked:
+				failed = true
+			case drivers.StatusSuspicious:
+				if *failOn == "suspicious" {
+					failed = true
+				}
+			case drivers.StatusError:
+				errored = true
+			}
+		})
+	}
+
+	switch {
+	case failed:
+		return ExitInfected
+	case errored:
+		return ExitError
+	default:
+		return ExitClean
+	}
+}
+
+// line is one file's outcome in --format=ndjson output
+type line struct {
+	Path      string             `json:"path"`
+	Status    drivers.ScanStatus `json:"status"`
+	Signature string             `json:"signature,omitempty"`
+	Findings  []string           `json:"findings,omitempty"`
+	Duration  int64              `json:"duration,omitempty"` // milliseconds
+	Error     string             `json:"error,omitempty"`
+}
+
+func newLine(path string, result *scanner.ScanResponse, err error) line {
+	if err != nil {
+		return line{Path: path, Status: drivers.StatusError, Error: err.Error()}
+	}
+	return line{
+		Path:      path,
+		Status:    result.Status,
+		Signature: result.Signature,
+		Findings:  result.Findings,
+		Duration:  result.TotalDuration,
+	}
+}
+
+// Extremely sparse files, e.g. a disk image or a crash dump with holes, read
+// back as their full apparent size; copying and scanning one can take the
+// engine hours for what is mostly zeros. A file is skipped as sparse when it
+// is at least sparseMinSize and under 1/sparseRatio of it is allocated.
+const (
+	sparseMinSize = 64 * 1024 * 1024
+	sparseRatio   = 100
+)
+
+// WalkOptions changes which files Walk scans
+type WalkOptions struct {
+	ScanSparse bool // scan extremely sparse files instead of skipping them
+}
+
+// Walk scans every regular file under root and reports each outcome to fn.
+// Files that cannot be read or scanned are reported with a non-nil error.
+func Walk(s *scanner.Scanner, root string, fn func(path string, result *scanner.ScanResponse, err error)) {
+	WalkWithOptions(s, root, WalkOptions{}, fn)
+}
+
+// WalkWithOptions is Walk with options. Device files, FIFOs, sockets and
+// extremely sparse files are not read, since opening or reading them can
+// block forever or take hours; they are reported with status skipped and a
+// "skipped:<reason>" finding. Directories and symlinks are not reported.
+func WalkWithOptions(s *scanner.Scanner, root string, opts WalkOptions, fn func(path string, result *scanner.ScanResponse, err error)) {
+	walkEntries(root, opts, func(e entry) bool {
+		result, err := scanEntry(s, e)
+		fn(e.path, result, err)
+		return true
+	})
+}
+
+// entry is a file found by walkEntries: one to scan, one to skip for reason,
+// or one that could not be listed
+type entry struct {
+	path   string
+	reason string
+	err    error
+}
+
+// walkEntries lists the files under root for Walk, until visit returns false
+func walkEntries(root string, opts WalkOptions, visit func(entry) bool) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		e := entry{path: path, err: err}
+		if err == nil {
+			if d.IsDir() || d.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+			e.reason, e.err = skipReason(d, opts)
+		}
+		if !visit(e) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+}
+
+// scanEntry scans a listed file, or reports why it was not scanned
+func scanEntry(s *scanner.Scanner, e entry) (*scanner.ScanResponse, error) {
+	switch {
+	case e.err != nil:
+		return nil, e.err
+	case e.reason != "":
+		return &scanner.ScanResponse{Status: drivers.StatusSkipped, Findings: []string{"skipped:" + e.reason}}, nil
+	default:
+		return ScanFile(s, e.path)
+	}
+}
+
+// SkipReason returns why Walk left a file unread, or "" if it was scanned.
+// Files skipped by policy were read and return "".
+func SkipReason(result *scanner.ScanResponse) string {
+	if result == nil || result.FileID != "" || result.Status != drivers.StatusSkipped || len(result.Findings) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(result.Findings[0], "skipped:")
+}
+
+// skipReason returns why an entry must not be read, or "" to scan it
+func skipReason(d fs.DirEntry, opts WalkOptions) (string, error) {
+	mode := d.Type()
+	switch {
+	case mode&fs.ModeCharDevice != 0:
+		return "char-device", nil
+	case mode&fs.ModeDevice != 0:
+		return "block-device", nil
+	case mode&fs.ModeNamedPipe != 0:
+		return "fifo", nil
+	case mode&fs.ModeSocket != 0:
+		return "socket", nil
+	case !mode.IsRegular():
+		return "irregular", nil
+	case opts.ScanSparse:
+		return "", nil
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return "", err
+	}
+	if allocated, ok := allocatedSize(info); ok && info.Size() >= sparseMinSize && allocated < info.Size()/sparseRatio {
+		return "sparse", nil
+	}
+	return "", nil
+}
+
+// ScanFile copies a file into the upload directory and scans the copy, leaving
+// the original in place. Anything but a regular file is refused.
+func ScanFile(s *scanner.Scanner, path string) (*scanner.ScanResponse, error) {
+	src, err := openRegular(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return ScanReader(s, src, filepath.Base(path))
+}
+
+// ScanReader copies src into the upload directory under name and scans it
+func ScanReader(s *scanner.Scanner, src io.Reader, name string) (*scanner.ScanResponse, error) {
+	fileID := s.GenerateFileID()
+	dst, uploadPath, err := s.CreateUpload(fileID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dst, hasher), src)
+	dst.Close()
+	if err != nil {
+		s.DiscardUpload(uploadPath, fileID)
+		return nil, fmt.Errorf("failed to copy file: %w", err)
+	}
+	uploadPath = s.FinalizeUploadPath(uploadPath, name, hex.EncodeToString(hasher.Sum(nil)))
+
+	return s.Scan(uploadPath, fileID, name, written)
+}
+
+// openRegular opens a file for reading without blocking on a FIFO that
+// replaced it after it was listed, and refuses anything but a regular file
+func openRegular(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|openNonBlock, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = fmt.Errorf("%s is not a regular file", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,121 @@
+package bulkscan
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func runBulkScan(t *testing.T, files map[string]string, args ...string) (int, string) {
+	t.Helper()
+
+	scanDir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(scanDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		MaxFileSize:     10 * 1024 * 1024,
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+		PolyglotCheck:   true,
+		Drivers: map[config.EngineType]config.DriverConfig{
+			config.EngineClamAV:     {Engine: config.EngineClamAV},
+			config.EngineTrendMicro: {Engine: config.EngineTrendMicro},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var stdout, stderr bytes.Buffer
+	code := Run(append(args, scanDir), cfg, logger, &stdout, &stderr)
+
+	// Originals must survive the scan
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(scanDir, name)); err != nil {
+			t.Errorf("expected %s to be left in place: %v", name, err)
+		}
+	}
+	return code, stdout.String()
+}
+
+func TestRun_Clean(t *testing.T) {
+	code, out := runBulkScan(t, map[string]string{"a.txt": "hello", "b.txt": "world"})
+	if code != ExitClean {
+		t.Errorf("expected exit code %d, got %d", ExitClean, code)
+	}
+	if strings.Count(out, "clean\t") != 2 {
+		t.Errorf("expected two clean lines, got %q", out)
+	}
+}
+
+func TestRun_Infected(t *testing.T) {
+	code, out := runBulkScan(t, map[string]string{"a.txt": "hello", "eicar.com": drivers.EICARPattern()})
+	if code != ExitInfected {
+		t.Errorf("expected exit code %d, got %d", ExitInfected, code)
+	}
+	if !strings.Contains(out, "eicar.com\t"+drivers.EICARSignature) {
+		t.Errorf("expected infected line with signature, got %q", out)
+	}
+}
+
+func TestRun_FailOnSuspicious(t *testing.T) {
+	polyglot := "\x89PNG\r\n\x1a\nimage data <script>alert(1)</script>"
+
+	code, _ := runBulkScan(t, map[string]string{"image.png": polyglot})
+	if code != ExitClean {
+		t.Errorf("expected suspicious to pass by default, got exit code %d", code)
+	}
+
+	code, _ = runBulkScan(t, map[string]string{"image.png": polyglot}, "--fail-on=suspicious")
+	if code != ExitInfected {
+		t.Errorf("expected exit code %d with --fail-on=suspicious, got %d", ExitInfected, code)
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	code, _ := runBulkScan(t, nil, "--fail-on=clean")
+	if code != ExitError {
+		t.Errorf("expected exit code %d for invalid --fail-on, got %d", ExitError, code)
+	}
+}
+
+func TestRun_MissingPath(t *testing.T) {
+	cfg := &config.Config{UploadDir: t.TempDir(), ActiveEngine: config.EngineMock}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{filepath.Join(t.TempDir(), "missing")}, cfg, logger, &stdout, &stderr)
+	if code != ExitError {
+		t.Errorf("expected exit code %d, got %d", ExitError, code)
+	}
+}
+
+func TestRun_NDJSON(t *testing.T) {
+	code, out := runBulkScan(t, map[string]string{"a.txt": "hello", "eicar.com": drivers.EICARPattern()}, "--format=ndjson")
+	if code != ExitInfected {
+		t.Errorf("expected exit code %d, got %d", ExitInfected, code)
+	}
+
+	statuses := map[string]string{}
+	for _, raw := range strings.Split(strings.TrimSpace(out), "\n") {
+		var l line
+		if err := json.Unmarshal([]byte(raw), &l); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", raw, err)
+		}
+		statuses[filepath.Base(l.Path)] = string(l.Status)
+	}
+	if statuses["a.txt"] != "clean" || statuses["eicar.com"] != "infected" {
+		t.Errorf("unexpected results: %v", statuses)
+	}
+}
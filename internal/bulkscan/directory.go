@@ -0,0 +1,55 @@
+package bulkscan
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// DirectoryOptions configures ScanDirectory
+type DirectoryOptions struct {
+	WalkOptions
+	Workers int               // files scanned at once; values below 1 mean 1
+	Listed  func(path string) // if set, called as each file is found, before it is scanned
+}
+
+// ScanDirectory is WalkWithOptions with up to opts.Workers files scanned at
+// once, for volumes where one scan at a time would take hours. fn is called
+// from the scanning goroutines and must be safe for concurrent use. Once ctx
+// is cancelled no more files are listed or scanned; scans in progress finish
+// and are reported, and ScanDirectory returns after them.
+func ScanDirectory(ctx context.Context, s *scanner.Scanner, root string, opts DirectoryOptions, fn func(path string, result *scanner.ScanResponse, err error)) {
+	entries := make(chan entry)
+	var wg sync.WaitGroup
+	for range max(opts.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range entries {
+				if ctx.Err() != nil {
+					continue
+				}
+				result, err := scanEntry(s, e)
+				fn(e.path, result, err)
+			}
+		}()
+	}
+
+	walkEntries(root, opts.WalkOptions, func(e entry) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if opts.Listed != nil {
+			opts.Listed(e.path)
+		}
+		select {
+		case entries <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(entries)
+	wg.Wait()
+}
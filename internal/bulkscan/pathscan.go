@@ -0,0 +1,296 @@
+package bulkscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+var (
+	// ErrPathNotAllowed is returned for a path outside SCAN_PATH_ROOTS
+	ErrPathNotAllowed = errors.New("path is outside the allowed scan roots")
+	// ErrNotDirectory is returned for a path that is not a directory
+	ErrNotDirectory = errors.New("path is not a directory")
+	// ErrTooManyScans is returned when SCAN_PATH_MAX_RUNS scans are running
+	ErrTooManyScans = errors.New("too many directory scans running")
+)
+
+const (
+	// pathScanTTL is how long a finished scan's progress stays available
+	pathScanTTL = 24 * time.Hour
+	// maxPathScanDetections caps the detections kept per scan
+	maxPathScanDetections = 1000
+)
+
+// Path scan statuses
+const (
+	PathScanRunning   = "running"
+	PathScanCompleted = "completed"
+	PathScanCancelled = "cancelled"
+)
+
+// Detection is a file in a directory scan that did not come back clean
+type Detection struct {
+	Path      string             `json:"path"`
+	Status    drivers.ScanStatus `json:"status"`
+	Signature string             `json:"signature,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// PathScan is the progress of one directory scan. Found grows while the
+// directory is still being listed, so it is only the total once the scan
+// has finished.
+type PathScan struct {
+	ID          string      `json:"scanId"`
+	Path        string      `json:"path"`
+	Status      string      `json:"status"`
+	RequestedBy string      `json:"requestedBy,omitempty"`
+	StartedAt   time.Time   `json:"startedAt"`
+	CompletedAt *time.Time  `json:"completedAt,omitempty"`
+	Found       int         `json:"found"`
+	Scanned     int         `json:"scanned"`
+	Infected    int         `json:"infected"`
+	Suspicious  int         `json:"suspicious"`
+	Errors      int         `json:"errors"`
+	Skipped     int         `json:"skipped"` // device files, FIFOs, sockets and sparse files
+	Detections  []Detection `json:"detections,omitempty"`
+	Truncated   bool        `json:"detectionsTruncated,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// PathScans runs directory scans of mounted volumes on request and keeps
+// their progress. Only directories under the configured roots are scanned;
+// files are copied into the upload directory first, so the originals are
+// never modified.
+type PathScans struct {
+	roots   []string
+	workers int
+	maxRuns int
+	scanner *scanner.Scanner
+	logger  *slog.Logger
+
+	mu    sync.Mutex
+	scans map[string]*PathScan
+	ctx   context.Context
+	stop  context.CancelFunc
+	wg    sync.WaitGroup
+}
+
+// NewPathScans returns the directory scans for SCAN_PATH_*, or nil when no
+// roots are configured
+func NewPathScans(cfg *config.Config, s *scanner.Scanner, logger *slog.Logger) *PathScans {
+	if len(cfg.ScanPathRoots) == 0 {
+		return nil
+	}
+	var roots []string
+	for _, root := range cfg.ScanPathRoots {
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+		roots = append(roots, filepath.Clean(root))
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &PathScans{
+		roots:   roots,
+		workers: cfg.ScanPathWorkers,
+		maxRuns: cfg.ScanPathMaxRuns,
+		scanner: s,
+		logger:  logger.With("component", "pathscan"),
+		scans:   make(map[string]*PathScan),
+		ctx:     ctx,
+		stop:    stop,
+	}
+}
+
+// Submit starts scanning the directory at path in the background and
+// returns its initial progress
+func (p *PathScans) Submit(path, requestedBy string) (PathScan, error) {
+	if !filepath.IsAbs(path) {
+		return PathScan{}, fmt.Errorf("path must be absolute: %s", path)
+	}
+	// Checked before and after resolving symlinks, so neither the path nor
+	// a symlink in it can reach outside the roots, and missing paths
+	// outside them are not told apart from existing ones
+	if !p.inRoots(filepath.Clean(path)) {
+		return PathScan{}, ErrPathNotAllowed
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return PathScan{}, err
+	}
+	if !p.inRoots(resolved) {
+		return PathScan{}, ErrPathNotAllowed
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return PathScan{}, err
+	}
+	if !info.IsDir() {
+		return PathScan{}, ErrNotDirectory
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx.Err() != nil {
+		return PathScan{}, errors.New("directory scans are shutting down")
+	}
+	running := 0
+	for id, scan := range p.scans {
+		switch {
+		case scan.Status == PathScanRunning:
+			running++
+		case time.Since(*scan.CompletedAt) > pathScanTTL:
+			delete(p.scans, id)
+		}
+	}
+	if running >= p.maxRuns {
+		return PathScan{}, ErrTooManyScans
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	scan := &PathScan{
+		ID:          uuid.New().String(),
+		Path:        resolved,
+		Status:      PathScanRunning,
+		RequestedBy: requestedBy,
+		StartedAt:   time.Now(),
+		cancel:      cancel,
+	}
+	p.scans[scan.ID] = scan
+	p.wg.Add(1)
+	go p.run(ctx, scan)
+	return scan.snapshot(), nil
+}
+
+// Get returns a scan's progress
+func (p *PathScans) Get(id string) (PathScan, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	scan, ok := p.scans[id]
+	if !ok {
+		return PathScan{}, false
+	}
+	return scan.snapshot(), true
+}
+
+// Cancel stops a running scan, returning false if there is no such scan.
+// Files being scanned are finished first.
+func (p *PathScans) Cancel(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	scan, ok := p.scans[id]
+	if ok {
+		scan.cancel()
+	}
+	return ok
+}
+
+// Stop cancels running scans and waits for the files in progress
+func (p *PathScans) Stop() {
+	p.stop()
+	p.wg.Wait()
+}
+
+func (p *PathScans) run(ctx context.Context, scan *PathScan) {
+	defer p.wg.Done()
+	defer scan.cancel()
+	p.logger.Info("Directory scan started", "scanId", scan.ID, "path", scan.Path, "requestedBy", scan.RequestedBy)
+
+	opts := DirectoryOptions{
+		Workers: p.workers,
+		Listed: func(string) {
+			p.mu.Lock()
+			scan.Found++
+			p.mu.Unlock()
+		},
+	}
+	ScanDirectory(ctx, p.scanner, scan.Path, opts, func(path string, result *scanner.ScanResponse, err error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		scan.record(path, result, err)
+	})
+
+	p.mu.Lock()
+	now := time.Now()
+	scan.CompletedAt = &now
+	scan.Status = PathScanCompleted
+	if ctx.Err() != nil {
+		scan.Status = PathScanCancelled
+	}
+	p.mu.Unlock()
+
+	p.logger.Info("Directory scan finished",
+		"scanId", scan.ID,
+		"path", scan.Path,
+		"status", scan.Status,
+		"scanned", scan.Scanned,
+		"infected", scan.Infected,
+		"suspicious", scan.Suspicious,
+		"errors", scan.Errors,
+		"skipped", scan.Skipped,
+		"duration", now.Sub(scan.StartedAt).Milliseconds(),
+	)
+}
+
+// record counts one file's outcome
+func (scan *PathScan) record(path string, result *scanner.ScanResponse, err error) {
+	if err == nil && SkipReason(result) != "" {
+		scan.Skipped++
+		return
+	}
+	scan.Scanned++
+	detection := Detection{Path: path}
+	switch {
+	case err != nil:
+		scan.Errors++
+		detection.Status, detection.Error = drivers.StatusError, err.Error()
+	case result.Status == drivers.StatusInfected || result.Status == drivers.StatusBlocked:
+		scan.Infected++
+		detection.Status, detection.Signature = result.Status, result.Signature
+	case result.Status == drivers.StatusSuspicious:
+		scan.Suspicious++
+		detection.Status, detection.Signature = result.Status, result.Signature
+	case result.Status == drivers.StatusError:
+		scan.Errors++
+		detection.Status = result.Status
+	default:
+		return
+	}
+	if len(scan.Detections) < maxPathScanDetections {
+		scan.Detections = append(scan.Detections, detection)
+	} else {
+		scan.Truncated = true
+	}
+}
+
+// snapshot copies the progress for callers outside the lock
+func (scan *PathScan) snapshot() PathScan {
+	c := *scan
+	c.Detections = append([]Detection(nil), scan.Detections...)
+	c.cancel = nil
+	return c
+}
+
+// inRoots reports whether the resolved path is one of the roots or below one
+func (p *PathScans) inRoots(resolved string) bool {
+	for _, root := range p.roots {
+		rel, err := filepath.Rel(root, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package bulkscan
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func newTestPathScans(t *testing.T, root string) *PathScans {
+	t.Helper()
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		MaxFileSize:     10 * 1024 * 1024,
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+		ScanPathRoots:   []string{root},
+		ScanPathWorkers: 3,
+		ScanPathMaxRuns: 1,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p := NewPathScans(cfg, scanner.New(cfg, logger), logger)
+	t.Cleanup(p.Stop)
+	return p
+}
+
+func TestPathScans_Submit(t *testing.T) {
+	root := t.TempDir()
+	volume := filepath.Join(root, "volume")
+	os.MkdirAll(filepath.Join(volume, "sub"), 0755)
+	for i, name := range []string{"a.txt", "b.txt", "sub/c.txt", "sub/d.txt"} {
+		os.WriteFile(filepath.Join(volume, name), []byte{byte('a' + i)}, 0644)
+	}
+	os.WriteFile(filepath.Join(volume, "sub", "eicar.com"), []byte(drivers.EICARPattern()), 0644)
+	outside := t.TempDir()
+	os.Symlink(outside, filepath.Join(root, "escape"))
+
+	p := newTestPathScans(t, root)
+
+	for path, want := range map[string]error{
+		outside:                          ErrPathNotAllowed,
+		filepath.Join(root, "escape"):    ErrPathNotAllowed,
+		filepath.Join(root, "..", "etc"): ErrPathNotAllowed,
+		filepath.Join(volume, "a.txt"):   ErrNotDirectory,
+		filepath.Join(root, "missing"):   os.ErrNotExist,
+	} {
+		if _, err := p.Submit(path, "test"); !errors.Is(err, want) {
+			t.Errorf("Submit(%s): expected %v, got %v", path, want, err)
+		}
+	}
+
+	scan, err := p.Submit(volume, "test")
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if _, err := p.Submit(volume, "test"); err != nil && !errors.Is(err, ErrTooManyScans) {
+		t.Errorf("expected ErrTooManyScans or an already finished scan, got %v", err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); scan.Status == PathScanRunning; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("directory scan did not finish")
+		}
+		scan, _ = p.Get(scan.ID)
+	}
+	if scan.Status != PathScanCompleted || scan.Found != 5 || scan.Scanned != 5 || scan.Infected != 1 || scan.CompletedAt == nil {
+		t.Errorf("unexpected progress: %+v", scan)
+	}
+	if len(scan.Detections) != 1 || scan.Detections[0].Path != filepath.Join(volume, "sub", "eicar.com") {
+		t.Errorf("expected the EICAR file as the only detection, got %+v", scan.Detections)
+	}
+	if _, err := os.Stat(filepath.Join(volume, "sub", "eicar.com")); err != nil {
+		t.Errorf("expected the original to be left in place: %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package bulkscan
+
+import "io/fs"
+
+const openNonBlock = 0
+
+// allocatedSize is unknown here, so no file is treated as sparse
+func allocatedSize(fs.FileInfo) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package bulkscan
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// openNonBlock keeps opening a FIFO from waiting for a writer. It has no
+// effect on regular files.
+const openNonBlock = syscall.O_NONBLOCK
+
+// allocatedSize returns the bytes a file occupies on disk
+func allocatedSize(info fs.FileInfo) (int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(stat.Blocks) * 512, true
+}
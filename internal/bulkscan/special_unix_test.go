@@ -0,0 +1,67 @@
+//go:build unix
+
+package bulkscan
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestRun_SkipsSpecialFiles(t *testing.T) {
+	scanDir := t.TempDir()
+	os.WriteFile(filepath.Join(scanDir, "a.txt"), []byte("hello"), 0644)
+	if err := syscall.Mkfifo(filepath.Join(scanDir, "pipe"), 0644); err != nil {
+		t.Fatalf("failed to create FIFO: %v", err)
+	}
+
+	cfg := &config.Config{UploadDir: t.TempDir(), ActiveEngine: config.EngineMock, MaxNestingDepth: 3}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{scanDir}, cfg, logger, &stdout, &stderr)
+	if code != ExitClean {
+		t.Errorf("expected exit code %d, got %d", ExitClean, code)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "skipped\t"+filepath.Join(scanDir, "pipe")+"\tskipped:fifo") || !strings.Contains(out, "clean\t") {
+		t.Errorf("expected the FIFO to be skipped and a.txt scanned, got %q", out)
+	}
+}
+
+func TestSkipReason_Sparse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	f, _ := os.Create(path)
+	f.Truncate(1 << 30)
+	f.Close()
+
+	info, _ := os.Stat(path)
+	if allocated, ok := allocatedSize(info); !ok || allocated >= info.Size()/sparseRatio {
+		t.Skip("filesystem does not keep holes")
+	}
+	d := fs.FileInfoToDirEntry(info)
+	if reason, err := skipReason(d, WalkOptions{}); reason != "sparse" || err != nil {
+		t.Errorf("expected sparse, got %q (%v)", reason, err)
+	}
+	if reason, _ := skipReason(d, WalkOptions{ScanSparse: true}); reason != "" {
+		t.Errorf("expected --scan-sparse to scan it, got %q", reason)
+	}
+}
+
+func TestOpenRegular_FIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipe")
+	syscall.Mkfifo(path, 0644)
+
+	// Without O_NONBLOCK this would wait for a writer forever
+	if f, err := openRegular(path); err == nil {
+		f.Close()
+		t.Error("expected a FIFO to be refused")
+	}
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -68,6 +69,55 @@ func (c *DetectionCache) Peek(absPath string) (*Detection, bool) {
 	return cached, found
 }
 
+// List returns a snapshot of all cached detections, sorted by path
+func (c *DetectionCache) List() []Detection {
+	c.mu.RLock()
+	entries := make([]Detection, 0, len(c.detections))
+	for path, detection := range c.detections {
+		entry := *detection
+		entry.FilePath = path
+		entries = append(entries, entry)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FilePath < entries[j].FilePath })
+	return entries
+}
+
+// Delete removes a detection, reporting whether it was present
+func (c *DetectionCache) Delete(absPath string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, found := c.detections[absPath]
+	delete(c.detections, absPath)
+	return found
+}
+
+// Clear removes all detections and returns how many were removed
+func (c *DetectionCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.detections)
+	c.detections = make(map[string]*Detection)
+	return n
+}
+
+// Size returns the number of cached detections. It does not wait for the
+// cache: ok is false while another goroutine holds it, so diagnostics of a
+// stuck scan cannot get stuck themselves.
+func (c *DetectionCache) Size() (n int, ok bool) {
+	if !c.mu.TryRLock() {
+		return 0, false
+	}
+	defer c.mu.RUnlock()
+	return len(c.detections), true
+}
+
+// TTL returns how long detections are kept
+func (c *DetectionCache) TTL() time.Duration {
+	return c.ttl
+}
+
 // Stop stops the cleanup goroutine
 func (c *DetectionCache) Stop() {
 	close(c.stopCh)
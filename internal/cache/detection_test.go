@@ -224,3 +224,77 @@ func TestDetectionCache_OverwriteExisting(t *testing.T) {
 		t.Errorf("expected overwritten detection, got status=%s signature=%s", cached.Status, cached.Signature)
 	}
 }
+
+func TestDetectionCache_List(t *testing.T) {
+	c := NewDetectionCache(time.Minute)
+	defer c.Stop()
+
+	c.Add("/tmp/b.txt", &Detection{Status: "infected", Signature: "Virus-B"})
+	c.Add("/tmp/a.txt", &Detection{Status: "clean"})
+
+	entries := c.List()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].FilePath != "/tmp/a.txt" || entries[1].FilePath != "/tmp/b.txt" {
+		t.Errorf("expected entries sorted by path, got %s, %s", entries[0].FilePath, entries[1].FilePath)
+	}
+	if entries[1].Signature != "Virus-B" || entries[1].Timestamp.IsZero() {
+		t.Errorf("unexpected entry: %+v", entries[1])
+	}
+
+	// Entries are copies; modifying them does not affect the cache
+	entries[1].Signature = "changed"
+	if cached, _ := c.Peek("/tmp/b.txt"); cached.Signature != "Virus-B" {
+		t.Error("expected cache to be unaffected by modifying the snapshot")
+	}
+}
+
+func TestDetectionCache_Delete(t *testing.T) {
+	c := NewDetectionCache(time.Minute)
+	defer c.Stop()
+
+	c.Add("/tmp/test.txt", &Detection{Status: "infected"})
+
+	if !c.Delete("/tmp/test.txt") {
+		t.Error("expected Delete to report existing entry")
+	}
+	if c.Delete("/tmp/test.txt") {
+		t.Error("expected Delete to report missing entry")
+	}
+	if _, found := c.Peek("/tmp/test.txt"); found {
+		t.Error("expected entry to be removed")
+	}
+}
+
+func TestDetectionCache_Clear(t *testing.T) {
+	c := NewDetectionCache(time.Minute)
+	defer c.Stop()
+
+	c.Add("/tmp/a.txt", &Detection{Status: "infected"})
+	c.Add("/tmp/b.txt", &Detection{Status: "infected"})
+
+	if n := c.Clear(); n != 2 {
+		t.Errorf("expected 2 entries cleared, got %d", n)
+	}
+	if len(c.List()) != 0 {
+		t.Error("expected cache to be empty")
+	}
+}
+
+func TestDetectionCache_Size(t *testing.T) {
+	c := NewDetectionCache(time.Minute)
+	defer c.Stop()
+
+	c.Add("/tmp/a.txt", &Detection{Status: "infected"})
+	if n, ok := c.Size(); !ok || n != 1 {
+		t.Errorf("expected size 1, got %d %v", n, ok)
+	}
+
+	// A held cache is reported instead of waited for
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.Size(); ok {
+		t.Error("expected Size to give up on a locked cache")
+	}
+}
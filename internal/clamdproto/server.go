@@ -0,0 +1,389 @@
+// Package clamdproto speaks the clamd wire protocol (PING, VERSION,
+// INSTREAM, SCAN), so existing clamd client libraries can use av-scanner
+// unchanged, whatever the active engine.
+package clamdproto
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+	"github.com/rophy/av-scanner/internal/version"
+)
+
+const (
+	// commandTimeout closes connections that send no command
+	commandTimeout = 60 * time.Second
+	// requestTimeout bounds reading, scanning and answering one command
+	requestTimeout = 5 * time.Minute
+	// maxCommandLength bounds a command line, which carries at most a path
+	maxCommandLength = 4096
+	// streamName is the name clamd reports for INSTREAM data
+	streamName = "stream"
+)
+
+// ErrServerClosed is returned by Serve after Shutdown
+var ErrServerClosed = errors.New("clamdproto: server closed")
+
+// errSizeLimit stops reading INSTREAM data over the size limit
+var errSizeLimit = errors.New("size limit exceeded")
+
+// Server answers clamd protocol commands, one per connection. INSTREAM data
+// is written to the upload directory like API uploads, so real-time scanning
+// sees it.
+type Server struct {
+	scanner     *scanner.Scanner
+	maxFileSize int64
+	scanRoots   []string
+	paused      func() error
+	logger      *slog.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{}
+	closing  atomic.Bool
+	wg       sync.WaitGroup
+}
+
+type conn struct {
+	net.Conn
+	busy atomic.Bool
+}
+
+// New creates a clamd protocol server. INSTREAM data over maxFileSize is
+// refused; SCAN only accepts paths under scanRoots and is disabled without
+// them. Both reply with an error while paused, if given, returns one, e.g.
+// in the API's maintenance mode.
+func New(s *scanner.Scanner, maxFileSize int64, scanRoots []string, paused func() error, logger *slog.Logger) *Server {
+	if paused == nil {
+		paused = func() error { return nil }
+	}
+	return &Server{
+		scanner:     s,
+		maxFileSize: maxFileSize,
+		scanRoots:   scanRoots,
+		paused:      paused,
+		logger:      logger,
+		conns:       make(map[*conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on addr and serves until Shutdown
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Shutdown
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closing.Load() {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if s.closing.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		c := &conn{Conn: nc}
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+// Shutdown stops accepting connections, closes those still waiting for a
+// command and waits for commands in progress to finish or ctx to expire
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closing.Store(true)
+	s.mu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.closeIdle()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) closeIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if !c.busy.Load() {
+			c.Close()
+		}
+	}
+}
+
+func (s *Server) serveConn(c *conn) {
+	defer func() {
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	br := bufio.NewReader(c)
+	c.SetReadDeadline(time.Now().Add(commandTimeout))
+	if _, err := br.Peek(1); err != nil {
+		return
+	}
+	c.busy.Store(true)
+	c.SetDeadline(time.Now().Add(requestTimeout))
+
+	start := time.Now()
+	command, delim, err := readCommand(br)
+	if err != nil {
+		s.logger.Warn("Invalid clamd command", "error", err)
+		return
+	}
+	name, arg, _ := strings.Cut(command, " ")
+
+	var reply string
+	var result *scanner.ScanResponse
+	switch name {
+	case "PING":
+		reply = "PONG"
+	case "VERSION":
+		reply = s.version()
+	case "INSTREAM":
+		reply, result = s.instream(br)
+	case "SCAN":
+		reply = s.scanPath(arg, delim)
+	default:
+		reply = "UNKNOWN COMMAND"
+	}
+	c.Write([]byte(reply + string(delim)))
+
+	attrs := []any{"command", name, "duration", time.Since(start).Milliseconds()}
+	if result != nil {
+		attrs = append(attrs, "fileId", result.FileID, "status", result.Status, "signature", result.Signature)
+	}
+	s.logger.Info("clamd request completed", attrs...)
+}
+
+// readCommand reads "zCOMMAND\0", "nCOMMAND\n" or a legacy "COMMAND\n",
+// returning the delimiter replies must end with
+func readCommand(br *bufio.Reader) (string, byte, error) {
+	delim := byte('\n')
+	switch prefix, _ := br.Peek(1); prefix[0] {
+	case 'z':
+		delim = 0
+		br.ReadByte()
+	case 'n':
+		br.ReadByte()
+	}
+
+	var line []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return "", delim, err
+		}
+		if b == delim {
+			break
+		}
+		if len(line) == maxCommandLength {
+			return "", delim, errors.New("command too long")
+		}
+		line = append(line, b)
+	}
+	return strings.TrimSuffix(string(line), "\r"), delim, nil
+}
+
+func (s *Server) version() string {
+	definitions := s.scanner.DefinitionsVersion()
+	if definitions == "" {
+		definitions = "unknown"
+	}
+	return fmt.Sprintf("av-scanner %s/%s/%s", version.Version, s.scanner.ActiveEngine(), definitions)
+}
+
+// instream stores length-prefixed chunks, terminated by an empty chunk, and
+// scans them
+func (s *Server) instream(br *bufio.Reader) (string, *scanner.ScanResponse) {
+	if err := s.paused(); err != nil {
+		// Read the stream first so the client sees the reply
+		readStream(br, io.Discard, s.maxFileSize)
+		return oneLine(err.Error()) + ". ERROR", nil
+	}
+
+	fileID := s.scanner.GenerateFileID()
+	dst, filePath, err := s.scanner.CreateUpload(fileID, streamName)
+	if err != nil {
+		s.logger.Error("Failed to create file", "error", err)
+		return "Failed to store stream. ERROR", nil
+	}
+
+	hasher := sha256.New()
+	size, err := readStream(br, io.MultiWriter(dst, hasher), s.maxFileSize)
+	dst.Close()
+	if err != nil {
+		s.scanner.DiscardUpload(filePath, fileID)
+		if err == errSizeLimit {
+			return "INSTREAM size limit exceeded. ERROR", nil
+		}
+		s.logger.Warn("Failed to read INSTREAM data", "error", err)
+		return "Failed to read stream. ERROR", nil
+	}
+	filePath = s.scanner.FinalizeUploadPath(filePath, streamName, hex.EncodeToString(hasher.Sum(nil)))
+
+	result, err := s.scanner.Scan(filePath, fileID, streamName, size)
+	return streamName + ": " + verdict(result, err), result
+}
+
+// readStream copies INSTREAM chunks to w until the zero-length chunk,
+// returning errSizeLimit past maxSize
+func readStream(br *bufio.Reader, w io.Writer, maxSize int64) (int64, error) {
+	var size int64
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return size, err
+		}
+		n := int64(binary.BigEndian.Uint32(header[:]))
+		if n == 0 {
+			return size, nil
+		}
+		if size+n > maxSize {
+			return size, errSizeLimit
+		}
+		if _, err := io.CopyN(w, br, n); err != nil {
+			return size, err
+		}
+		size += n
+	}
+}
+
+// scanPath scans a file or directory on this host, reporting every
+// detection and error, one per delim-terminated line; OK means nothing was
+// found
+func (s *Server) scanPath(path string, delim byte) string {
+	if len(s.scanRoots) == 0 {
+		return path + ": SCAN is disabled. ERROR"
+	}
+	if !filepath.IsAbs(path) || !s.inScanRoots(path) {
+		return path + ": Path is not allowed. ERROR"
+	}
+	if err := s.paused(); err != nil {
+		return path + ": " + oneLine(err.Error()) + ". ERROR"
+	}
+
+	var lines []string
+	bulkscan.Walk(s.scanner, path, func(file string, result *scanner.ScanResponse, err error) {
+		if err == nil && (result.Status == drivers.StatusClean || result.Status == drivers.StatusSkipped) {
+			return
+		}
+		lines = append(lines, file+": "+verdict(result, err))
+	})
+	if len(lines) == 0 {
+		return path + ": OK"
+	}
+	return strings.Join(lines, string(delim))
+}
+
+// inScanRoots reports whether path, with symlinks resolved, is one of the
+// scan roots or inside one
+func (s *Server) inScanRoots(path string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// Missing paths are reported by the walk
+		resolved = filepath.Clean(path)
+	}
+	for _, root := range s.scanRoots {
+		if r, err := filepath.EvalSymlinks(root); err == nil {
+			root = r
+		}
+		rel, err := filepath.Rel(filepath.Clean(root), resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// verdict formats a scan outcome the way clamd does: "OK",
+// "<signature> FOUND" or "<message> ERROR"
+func verdict(result *scanner.ScanResponse, err error) string {
+	var throttled *scanner.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		return "Scan throughput limit exceeded. ERROR"
+	case err != nil:
+		return oneLine(err.Error()) + " ERROR"
+	}
+
+	signature := oneLine(result.Signature)
+	switch result.Status {
+	case drivers.StatusClean, drivers.StatusSkipped:
+		return "OK"
+	case drivers.StatusInfected:
+		if signature == "" {
+			signature = "Unknown.Malware"
+		}
+	case drivers.StatusSuspicious:
+		if signature == "" {
+			signature = "Heuristics.Suspicious"
+		}
+	case drivers.StatusBlocked:
+		signature = "Policy.Blocked"
+	default:
+		return "Scan failed. ERROR"
+	}
+	return signature + " FOUND"
+}
+
+// oneLine keeps a reply on a single line
+func oneLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == 0 {
+			return ' '
+		}
+		return r
+	}, s)
+}
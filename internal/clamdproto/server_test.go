@@ -0,0 +1,156 @@
+package clamdproto
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func startServer(t *testing.T, scanRoots ...string) string {
+	t.Helper()
+	return startPausableServer(t, nil, scanRoots...)
+}
+
+// startPausableServer starts a server that is paused while paused returns
+// an error
+func startPausableServer(t *testing.T, paused func() error, scanRoots ...string) string {
+	t.Helper()
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		MaxFileSize:     1024,
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scanner.New(cfg, logger)
+	t.Cleanup(s.Stop)
+
+	srv := New(s, cfg.MaxFileSize, scanRoots, paused, logger)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return l.Addr().String()
+}
+
+// send writes raw to a new connection and returns everything the server
+// replies before closing it
+func send(t *testing.T, addr string, raw []byte) string {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Write(raw); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	reply, err := io.ReadAll(bufio.NewReader(c))
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	return string(reply)
+}
+
+func instream(chunks ...string) []byte {
+	b := []byte("zINSTREAM\x00")
+	for _, chunk := range append(chunks, "") {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(chunk)))
+		b = append(b, chunk...)
+	}
+	return b
+}
+
+func TestServer_Ping(t *testing.T) {
+	addr := startServer(t)
+	for command, want := range map[string]string{
+		"zPING\x00": "PONG\x00",
+		"nPING\n":   "PONG\n",
+		"PING\n":    "PONG\n",
+		"nSTATS\n":  "UNKNOWN COMMAND\n",
+	} {
+		if got := send(t, addr, []byte(command)); got != want {
+			t.Errorf("%q: expected %q, got %q", command, want, got)
+		}
+	}
+	if got := send(t, addr, []byte("nVERSION\n")); !strings.HasPrefix(got, "av-scanner ") {
+		t.Errorf("unexpected VERSION reply %q", got)
+	}
+}
+
+func TestServer_Instream(t *testing.T) {
+	addr := startServer(t)
+
+	eicar := drivers.EICARPattern()
+	if got := send(t, addr, instream(eicar[:20], eicar[20:])); !strings.HasPrefix(got, "stream: ") || !strings.HasSuffix(got, " FOUND\x00") {
+		t.Errorf("expected a detection, got %q", got)
+	}
+	if got := send(t, addr, instream("hello world")); got != "stream: OK\x00" {
+		t.Errorf("expected OK, got %q", got)
+	}
+	if got := send(t, addr, instream(strings.Repeat("a", 1000), strings.Repeat("a", 100))); got != "INSTREAM size limit exceeded. ERROR\x00" {
+		t.Errorf("expected size limit error, got %q", got)
+	}
+}
+
+func TestServer_Scan(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "clean.txt"), []byte("hello"), 0644)
+	addr := startServer(t, root)
+
+	if got := send(t, addr, []byte("nSCAN "+root+"\n")); got != root+": OK\n" {
+		t.Errorf("expected OK, got %q", got)
+	}
+
+	infected := filepath.Join(root, "eicar.com")
+	os.WriteFile(infected, []byte(drivers.EICARPattern()), 0644)
+	if got := send(t, addr, []byte("nSCAN "+root+"\n")); !strings.HasPrefix(got, infected+": ") || !strings.HasSuffix(got, " FOUND\n") {
+		t.Errorf("expected a detection, got %q", got)
+	}
+	// The original is left in place
+	if _, err := os.Stat(infected); err != nil {
+		t.Errorf("expected scanned file to remain: %v", err)
+	}
+
+	if got := send(t, addr, []byte("nSCAN /etc/passwd\n")); got != "/etc/passwd: Path is not allowed. ERROR\n" {
+		t.Errorf("expected path outside the roots to be refused, got %q", got)
+	}
+}
+
+func TestServer_ScanDisabled(t *testing.T) {
+	addr := startServer(t)
+	if got := send(t, addr, []byte("nSCAN /tmp\n")); got != "/tmp: SCAN is disabled. ERROR\n" {
+		t.Errorf("unexpected reply %q", got)
+	}
+}
+
+func TestServer_Paused(t *testing.T) {
+	root := t.TempDir()
+	addr := startPausableServer(t, func() error { return errors.New("Service is in maintenance mode") }, root)
+
+	if got := send(t, addr, instream("hello world")); got != "Service is in maintenance mode. ERROR\x00" {
+		t.Errorf("expected INSTREAM to be refused, got %q", got)
+	}
+	if got := send(t, addr, []byte("nSCAN "+root+"\n")); got != root+": Service is in maintenance mode. ERROR\n" {
+		t.Errorf("expected SCAN to be refused, got %q", got)
+	}
+	if got := send(t, addr, []byte("zPING\x00")); got != "PONG\x00" {
+		t.Errorf("expected PING to be answered, got %q", got)
+	}
+}
@@ -2,8 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 type EngineType string
@@ -11,16 +16,137 @@ type EngineType string
 const (
 	EngineClamAV     EngineType = "clamav"
 	EngineTrendMicro EngineType = "trendmicro"
+	EngineDefender   EngineType = "defender" // Microsoft Defender, on Windows nodes
+	EngineSophos     EngineType = "sophos"
 	EngineMock       EngineType = "mock"
 )
 
+type UploadNaming string
+
+const (
+	UploadNamingUUID     UploadNaming = "uuid"     // <fileId><ext>
+	UploadNamingHash     UploadNaming = "hash"     // <sha256><ext>
+	UploadNamingOriginal UploadNaming = "original" // <fileId>/<originalName>
+)
+
+// UploadStore is where uploads are kept while they are scanned
+type UploadStore string
+
+const (
+	UploadStoreDisk  UploadStore = "disk"  // files in UploadDir
+	UploadStoreTmpfs UploadStore = "tmpfs" // files in UploadDir, which must be on tmpfs
+)
+
+type ThroughputMode string
+
+const (
+	ThroughputQueue  ThroughputMode = "queue"  // wait for capacity, up to ThroughputMaxWait
+	ThroughputReject ThroughputMode = "reject" // reject scans that exceed the limit
+)
+
+// AbuseAction is what happens when a caller keeps submitting infected files
+type AbuseAction string
+
+const (
+	AbuseAlert AbuseAction = "alert" // log, count and notify AbuseAlertURL
+	AbuseBlock AbuseAction = "block" // also refuse the caller's scans for AbuseBlockDuration
+)
+
+// ScanProfile trades scan latency against thoroughness, per request
+type ScanProfile string
+
+const (
+	ProfileFast     ScanProfile = "fast"     // size-capped, no container extraction
+	ProfileStandard ScanProfile = "standard" // the configured defaults
+	ProfileThorough ScanProfile = "thorough" // every match, deeper container extraction
+)
+
+// CompatAPI is another scanning service's API the service also answers, so
+// clients written for it work unmodified
+type CompatAPI string
+
+const (
+	CompatClamAVRest CompatAPI = "clamav-rest" // POST /scan
+	CompatVirusTotal CompatAPI = "virustotal"  // POST /api/v3/files, GET /api/v3/analyses/{id}
+)
+
+// EngineAggregation combines the verdicts of several engines
+type EngineAggregation string
+
+const (
+	AggregateAnyInfected EngineAggregation = "any-infected" // infected if any engine detects
+	AggregateAllClean    EngineAggregation = "all-clean"    // clean only if every engine scanned clean
+	AggregateMajority    EngineAggregation = "majority"     // infected if most engines that scanned detect
+)
+
+// EncryptedArchivePolicy handles archives whose members the engine cannot see
+type EncryptedArchivePolicy string
+
+const (
+	EncryptedAllow   EncryptedArchivePolicy = "allow"   // report the engine's verdict
+	EncryptedWarn    EncryptedArchivePolicy = "warn"    // downgrade a clean verdict to suspicious
+	EncryptedReject  EncryptedArchivePolicy = "reject"  // block unless infected
+	EncryptedDecrypt EncryptedArchivePolicy = "decrypt" // scan members opened by request passwords; reject otherwise
+)
+
+// EventTransport is where scan results are published
+type EventTransport string
+
+const (
+	EventsKafka EventTransport = "kafka" // EventsTopic is a Kafka topic
+	EventsNATS  EventTransport = "nats"  // EventsTopic is a NATS subject
+)
+
+// SASLMechanism is how the events publisher authenticates to Kafka
+type SASLMechanism string
+
+const (
+	SASLPlain       SASLMechanism = "PLAIN"
+	SASLScramSHA256 SASLMechanism = "SCRAM-SHA-256"
+	SASLScramSHA512 SASLMechanism = "SCRAM-SHA-512"
+)
+
 type DriverConfig struct {
-	Engine            EngineType
-	RTSLogPath        string
-	ScanBinaryPath    string
-	Timeout           int // milliseconds
-	RTSCacheBaseDelay int // milliseconds - base delay when waiting for RTS cache
-	RTSCacheDelayPerMB int // milliseconds - additional delay per MB of file size
+	Engine             EngineType
+	RTSLogPath         string
+	ScanBinaryPath     string
+	Timeout            int    // milliseconds
+	RTSCacheBaseDelay  int    // milliseconds - base delay when waiting for RTS cache
+	RTSCacheDelayPerMB int    // milliseconds - additional delay per MB of file size
+	RTSReplayWindow    int    // milliseconds of RTS log history replayed into the cache at startup; 0 disables
+	FixtureRecordDir   string // if set, manual scan outputs are recorded as replay fixtures
+	QuarantineDir      string // where the engine moves detected files; checked against UploadDir at startup
+	LicenseQueryPath   string // agent status binary reporting license state; empty disables
+	LicenseWarnDays    int    // warn this many days before the license expires
+	UploadSubdir       string // uploads go to UploadDir/UploadSubdir while this engine is active
+	StatusQueryPath    string // agent status command for health checks; empty checks the scan binary only
+	WatchConfigPath    string // engine config listing on-access watch paths; checked at startup
+	SignatureMaxAge    int    // hours the loaded signatures may age before the engine is unhealthy; 0 disables
+
+	// clamd to scan with directly, tcp://host:port or unix:///path, instead
+	// of running ScanBinaryPath. With ClamdPathScan clamd opens uploads
+	// itself (SCAN) rather than receiving them (INSTREAM).
+	ClamdAddress  string
+	ClamdPathScan bool
+
+	// Extra scan binary arguments for the fast and thorough scan profiles
+	FastFlags     []string
+	ThoroughFlags []string
+
+	// Probed in order at startup to set ScanBinaryPath; may contain {arch}
+	// or {uname_arch}
+	ScanBinaryCandidates []string
+
+	// Command fetching new signatures on request, e.g. freshclam; empty
+	// disables engine updates. UpdateTimeout is in milliseconds.
+	UpdateCommand []string
+	UpdateTimeout int
+
+	// Blue/green definitions: DefinitionsLink is the symlink the engine
+	// loads signatures from (clamd's DatabaseDirectory) and points at one of
+	// DefinitionSets, directories named by their base name. Empty disables.
+	DefinitionsLink string
+	DefinitionSets  []string
 }
 
 type AuthConfig struct {
@@ -29,43 +155,485 @@ type AuthConfig struct {
 	ClusterName   string // cluster name for token validation
 	Timeout       int    // milliseconds
 	AllowlistFile string // path to allowlist YAML file
+	CacheTTL      int    // milliseconds successful validations are reused; 0 disables
+
+	// Sources with BanThreshold failures within BanWindow are refused for
+	// BanDuration; 0 threshold disables
+	BanThreshold    int
+	BanWindow       int    // milliseconds
+	BanDuration     int    // milliseconds
+	BanSourceHeader string // e.g. X-Forwarded-For; empty uses the peer address
+	// Proxies in front of the service that append to BanSourceHeader; the
+	// source is this many addresses from its right
+	BanTrustedProxies int
 }
 
 type Config struct {
-	Port         int
-	UploadDir    string
-	MaxFileSize  int64
-	ActiveEngine EngineType
-	LogLevel     string
-	Drivers      map[EngineType]DriverConfig
-	Auth         AuthConfig
+	Port            int
+	AdminPort       int // serves admin and metrics endpoints separately; 0 keeps them on Port
+	ICAPPort        int // RFC 3507 listener for proxies; 0 disables
+	GRPCPort        int // gRPC ScanService listener; 0 disables
+	ClamdPort       int // clamd protocol listener; 0 disables
+	UploadDir       string
+	UploadNaming    UploadNaming
+	UploadStore     UploadStore
+	MaxFileSize     int64
+	ActiveEngine    EngineType
+	LogLevel        string
+	PolicyFile      string
+	ScheduleFile    string
+	FeedbackFile    string // JSON lines file of false-negative reports; empty keeps them in memory
+	PolyglotCheck   bool
+	EntropyCheck    bool // report entropy for every upload, not only policy-flagged ones
+	MaxNestingDepth int
+	PayloadCheck    bool // scan URLs and base64 blobs found in text uploads as members
+	PayloadFetch    bool // download payload URLs from ScanURLAllowedHosts
+
+	EncryptedArchives EncryptedArchivePolicy
+
+	// Infected uploads are kept here, encrypted with the key in
+	// QuarantineKeyFile; empty deletes them
+	QuarantineDir     string
+	QuarantineKeyFile string
+
+	// Files dropped into DropzoneDir are scanned once unchanged for
+	// DropzoneQuietPeriod and moved to DropzoneCleanDir or DropzoneRejectDir;
+	// empty disables
+	DropzoneDir         string
+	DropzoneCleanDir    string
+	DropzoneRejectDir   string
+	DropzoneQuietPeriod int // milliseconds
+
+	// Every scan result is published to EventsTopic on EventsBrokers; an
+	// empty transport disables publishing
+	EventsTransport EventTransport
+	EventsBrokers   []string // host:port
+	EventsTopic     string
+	EventsQueueSize int // results waiting to be sent before new ones are dropped
+
+	// Broker connections use TLS when EventsTLS is set, verified against
+	// EventsTLSCAFile (system roots if empty), presenting the client
+	// certificate in EventsTLSCertFile and EventsTLSKeyFile if set
+	EventsTLS         bool
+	EventsTLSCAFile   string
+	EventsTLSCertFile string
+	EventsTLSKeyFile  string
+
+	// Kafka authenticates with EventsSASLMechanism; NATS with the user and
+	// password, or with the password alone as a token
+	EventsSASLMechanism SASLMechanism
+	EventsUsername      string
+	EventsPasswordFile  string
+
+	// Global scan throughput cap; 0 disables
+	ThroughputLimit   int64 // bytes per second
+	ThroughputBurst   int64 // bytes; defaults to MaxFileSize
+	ThroughputMode    ThroughputMode
+	ThroughputMaxWait int // milliseconds
+
+	// Scans running at once, so a burst of uploads cannot start an engine
+	// process each; 0 is unlimited. Up to ScanQueueDepth more wait for a
+	// slot, beyond that scans are rejected.
+	MaxConcurrentScans int
+	ScanQueueDepth     int
+
+	// Absolute limit on waiting for an RTS verdict after a failed manual
+	// scan, however long the RTS cache delays add up to; 0 disables the
+	// watchdog
+	RTSWaitCeiling int // milliseconds
+
+	// Background scans submitted via POST /api/v1/scan/async; 0 workers disables
+	AsyncWorkers   int
+	AsyncQueueSize int
+	AsyncJobTTL    int // milliseconds finished jobs stay pollable
+
+	// Successful responses carry X-AV-Warning once a limit is this
+	// percentage used; 0 disables
+	SoftLimitPercent int
+
+	// API uploads up to this many bytes are streamed to engines that support
+	// it instead of being written to UploadDir; 0 disables
+	MemoryScanMaxSize int64
+
+	// Directory of <language>.json catalogs that translate error and verdict
+	// messages for Accept-Language; empty disables localization
+	MessageCatalogDir string
+
+	// Recent scan results kept per caller for GET /api/v1/my/results; 0
+	// disables
+	ScanHistorySize int
+
+	// Callers submitting AbuseThreshold infected files within AbuseWindow
+	// are reported and, with AbuseBlock, refused for AbuseBlockDuration; 0
+	// threshold disables
+	AbuseThreshold     int
+	AbuseWindow        int // milliseconds
+	AbuseAction        AbuseAction
+	AbuseBlockDuration int    // milliseconds
+	AbuseAlertURL      string // webhook that receives alerts; empty only logs them
+
+	// Requests per second each caller (each client IP without
+	// authentication) may make, with bursts of RateLimitBurst; 0 disables
+	RateLimit      int
+	RateLimitBurst int // 0 is RateLimit
+
+	// Each caller's scans and bytes per calendar month, kept in UsageFile
+	// (in memory if empty), and the monthly quotas; 0 is unlimited
+	UsageFile         string
+	QuotaMonthlyScans int64
+	QuotaMonthlyBytes int64
+
+	// Verdicts are reused for identical content for VerdictCacheTTL, up to
+	// VerdictCacheSize of them; 0 TTL disables
+	VerdictCacheTTL  int // milliseconds
+	VerdictCacheSize int
+
+	// Scan a benign probe with every engine at startup, reporting not ready
+	// until done, so the first upload does not pay for loading definitions
+	WarmUpScan bool
+
+	// Profiles callers may select per request. Uploads over
+	// ScanProfileFastMaxSize are refused under fast (0 for no cap); thorough
+	// unpacks containers ScanProfileThoroughDepth levels deep.
+	ScanProfiles             []ScanProfile
+	ScanProfileFastMaxSize   int64
+	ScanProfileThoroughDepth int
+
+	// Engines that scan every upload concurrently, from AV_ENGINES. The first
+	// is ActiveEngine, which owns the upload directory. Empty means only
+	// ActiveEngine.
+	Engines           []EngineType
+	EngineAggregation EngineAggregation
+
+	// An engine with CrashLoopThreshold daemon restarts or failed scans
+	// within CrashLoopWindow is reported degraded; 0 threshold disables
+	CrashLoopThreshold int
+	CrashLoopWindow    int // milliseconds
+
+	// Canary engine that also scans a sample of uploads; verdicts are only compared
+	ShadowEngine  EngineType
+	ShadowPercent int // 0-100
+
+	// Directories whose files may be queried via POST /api/v1/rts/watch
+	RTSWatchRoots []string
+
+	// Directories the clamd SCAN command may read; empty disables SCAN
+	ClamdScanRoots []string
+
+	// Tag keys callers may attach to scans; empty disables tags
+	ScanTagKeys []string
+
+	// Remote content fetched by POST /api/v1/scan/url; no hosts disables it.
+	// Hosts may be "*.example.com" to include subdomains.
+	ScanURLAllowedHosts []string
+	ScanURLSchemes      []string
+	ScanURLMaxSize      int64 // bytes; 0 uses MaxFileSize
+	ScanURLTimeout      int   // milliseconds
+
+	// S3-compatible endpoints POST /api/v1/scan/object may download from;
+	// the first is the default and none disables it. Requests are signed
+	// with the credentials in ObjectStoreCredentialsFile, if set.
+	ObjectStoreEndpoints       []string
+	ObjectStoreRegion          string
+	ObjectStoreCredentialsFile string
+	ObjectStoreMaxSize         int64 // bytes; 0 uses MaxFileSize
+	ObjectStoreTimeout         int   // milliseconds
+
+	// New objects announced by S3 event notifications, polled from
+	// BucketScanSQSQueueURL or POSTed to /api/v1/bucket-events, are fetched
+	// from the first ObjectStoreEndpoints entry, scanned and tagged with the
+	// verdict. Infected objects move to BucketScanQuarantineBucket if set.
+	BucketScanSQSQueueURL      string
+	BucketScanWebhookTokenFile string
+	BucketScanQuarantineBucket string
+	BucketScanWorkers          int
+
+	// Directories under ScanPathRoots may be scanned in place through
+	// POST /api/v1/scan/path; no roots disables it
+	ScanPathRoots   []string
+	ScanPathWorkers int // files scanned at once per directory scan
+	ScanPathMaxRuns int // directory scans running at once
+
+	ScanBatchMaxFiles int // files per POST /api/v1/scan/batch; 0 disables
+
+	// Scan sessions group a workflow's uploads under one decision
+	SessionMaxFiles int // files per session; 0 disables sessions
+	SessionTTL      int // milliseconds a session stays usable after creation or finalizing
+
+	// Multipart fields uploads are read from, e.g. "files[]" for clients
+	// written for other scanning services
+	UploadFieldNames []string
+
+	// Other scanning services' APIs served alongside /api/v1
+	CompatAPIs []CompatAPI
+
+	// Uploads with these extensions, or whose content sniffs as one of these
+	// MIME types ("type/*" wildcards allowed), are blocked without scanning
+	BlockedExtensions []string
+	BlockedMimeTypes  []string
+
+	Drivers map[EngineType]DriverConfig
+	Auth    AuthConfig
 }
 
 func Load() (*Config, error) {
-	activeEngine := EngineType(getEnv("AV_ENGINE", "clamav"))
+	activeEngine := EngineType(getEnv("AV_ENGINE", ""))
+	var engines []EngineType
+	for _, engine := range getEnvList("AV_ENGINES", nil) {
+		engines = append(engines, EngineType(engine))
+	}
+	var profiles []ScanProfile
+	for _, profile := range getEnvList("SCAN_PROFILES", []string{"fast", "standard"}) {
+		profiles = append(profiles, ScanProfile(profile))
+	}
+	var compatAPIs []CompatAPI
+	for _, api := range getEnvList("COMPAT_APIS", nil) {
+		compatAPIs = append(compatAPIs, CompatAPI(api))
+	}
+	// AV_ENGINES names the active engine when AV_ENGINE is unset; Validate
+	// rejects an AV_ENGINE that disagrees with it
+	if activeEngine == "" {
+		activeEngine = EngineClamAV
+		if len(engines) > 0 {
+			activeEngine = engines[0]
+		}
+	}
 
 	cfg := &Config{
-		Port:         getEnvInt("PORT", 3000),
-		UploadDir:    getEnv("UPLOAD_DIR", "/tmp/av-scanner"),
-		MaxFileSize:  getEnvInt64("MAX_FILE_SIZE", 104857600), // 100MB
-		ActiveEngine: activeEngine,
-		LogLevel:     getEnv("LOG_LEVEL", "info"),
+		Port:            getEnvInt("PORT", 3000),
+		AdminPort:       getEnvInt("ADMIN_PORT", 0),
+		ICAPPort:        getEnvInt("ICAP_PORT", 0),
+		GRPCPort:        getEnvInt("GRPC_PORT", 0),
+		ClamdPort:       getEnvInt("CLAMD_PORT", 0),
+		UploadDir:       getEnv("UPLOAD_DIR", "/tmp/av-scanner"),
+		UploadNaming:    UploadNaming(getEnv("UPLOAD_NAMING", "uuid")),
+		UploadStore:     UploadStore(getEnv("UPLOAD_STORE", "disk")),
+		MaxFileSize:     getEnvInt64("MAX_FILE_SIZE", 104857600), // 100MB
+		ActiveEngine:    activeEngine,
+		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		PolicyFile:      getEnv("SCAN_POLICY_FILE", ""),
+		ScheduleFile:    getEnv("SCAN_SCHEDULE_FILE", ""),
+		FeedbackFile:    getEnv("FEEDBACK_FILE", ""),
+		PolyglotCheck:   getEnvBool("POLYGLOT_CHECK", false),
+		EntropyCheck:    getEnvBool("ENTROPY_CHECK", false),
+		MaxNestingDepth: getEnvInt("MAX_NESTING_DEPTH", 3),
+		PayloadCheck:    getEnvBool("PAYLOAD_CHECK", false),
+		PayloadFetch:    getEnvBool("PAYLOAD_FETCH", false),
+
+		EncryptedArchives: EncryptedArchivePolicy(getEnv("ENCRYPTED_ARCHIVES", "allow")),
+
+		QuarantineDir:     getEnv("QUARANTINE_DIR", ""),
+		QuarantineKeyFile: getEnv("QUARANTINE_KEY_FILE", ""),
+
+		DropzoneDir:         getEnv("DROPZONE_DIR", ""),
+		DropzoneCleanDir:    getEnv("DROPZONE_CLEAN_DIR", ""),
+		DropzoneRejectDir:   getEnv("DROPZONE_REJECT_DIR", ""),
+		DropzoneQuietPeriod: getEnvInt("DROPZONE_QUIET_PERIOD", 2000),
+
+		EventsTransport: EventTransport(getEnv("EVENTS_TRANSPORT", "")),
+		EventsBrokers:   getEnvList("EVENTS_BROKERS", nil),
+		EventsTopic:     getEnv("EVENTS_TOPIC", "av-scanner.scans"),
+		EventsQueueSize: getEnvInt("EVENTS_QUEUE_SIZE", 1000),
+
+		EventsTLS:         getEnvBool("EVENTS_TLS", false),
+		EventsTLSCAFile:   getEnv("EVENTS_TLS_CA_FILE", ""),
+		EventsTLSCertFile: getEnv("EVENTS_TLS_CERT_FILE", ""),
+		EventsTLSKeyFile:  getEnv("EVENTS_TLS_KEY_FILE", ""),
+
+		EventsSASLMechanism: SASLMechanism(getEnv("EVENTS_SASL_MECHANISM", "")),
+		EventsUsername:      getEnv("EVENTS_USERNAME", ""),
+		EventsPasswordFile:  getEnv("EVENTS_PASSWORD_FILE", ""),
+
+		ThroughputLimit:   getEnvInt64("THROUGHPUT_LIMIT", 0),
+		ThroughputBurst:   getEnvInt64("THROUGHPUT_BURST", 0),
+		ThroughputMode:    ThroughputMode(getEnv("THROUGHPUT_MODE", "queue")),
+		ThroughputMaxWait: getEnvInt("THROUGHPUT_MAX_WAIT", 30000),
+
+		MaxConcurrentScans: getEnvInt("MAX_CONCURRENT_SCANS", 8),
+		ScanQueueDepth:     getEnvInt("SCAN_QUEUE_DEPTH", 100),
+
+		RTSWaitCeiling: getEnvInt("RTS_WAIT_CEILING", 60000),
+
+		AsyncWorkers:   getEnvInt("ASYNC_WORKERS", 4),
+		AsyncQueueSize: getEnvInt("ASYNC_QUEUE_SIZE", 100),
+		AsyncJobTTL:    getEnvInt("ASYNC_JOB_TTL", 3600000),
+
+		SoftLimitPercent: getEnvInt("SOFT_LIMIT_PERCENT", 80),
+
+		MemoryScanMaxSize: getEnvInt64("MEMORY_SCAN_MAX_SIZE", 0),
+
+		MessageCatalogDir: getEnv("MESSAGE_CATALOG_DIR", ""),
+
+		ScanHistorySize: getEnvInt("SCAN_HISTORY_SIZE", 50),
+
+		AbuseThreshold:     getEnvInt("ABUSE_THRESHOLD", 0),
+		AbuseWindow:        getEnvInt("ABUSE_WINDOW", 600000),
+		AbuseAction:        AbuseAction(getEnv("ABUSE_ACTION", "alert")),
+		AbuseBlockDuration: getEnvInt("ABUSE_BLOCK_DURATION", 900000),
+		AbuseAlertURL:      getEnv("ABUSE_ALERT_URL", ""),
+
+		RateLimit:      getEnvInt("RATE_LIMIT", 0),
+		RateLimitBurst: getEnvInt("RATE_LIMIT_BURST", 0),
+
+		UsageFile:         getEnv("USAGE_FILE", ""),
+		QuotaMonthlyScans: getEnvInt64("QUOTA_MONTHLY_SCANS", 0),
+		QuotaMonthlyBytes: getEnvInt64("QUOTA_MONTHLY_BYTES", 0),
+
+		VerdictCacheTTL:  getEnvInt("VERDICT_CACHE_TTL", 0),
+		VerdictCacheSize: getEnvInt("VERDICT_CACHE_SIZE", 10000),
+
+		WarmUpScan: getEnvBool("WARMUP_SCAN", true),
+
+		ScanProfiles:             profiles,
+		ScanProfileFastMaxSize:   getEnvInt64("SCAN_PROFILE_FAST_MAX_SIZE", 10485760), // 10MB
+		ScanProfileThoroughDepth: getEnvInt("SCAN_PROFILE_THOROUGH_DEPTH", 10),
+
+		Engines:           engines,
+		EngineAggregation: EngineAggregation(getEnv("ENGINE_AGGREGATION", "any-infected")),
+
+		CrashLoopThreshold: getEnvInt("ENGINE_CRASH_LOOP_THRESHOLD", 3),
+		CrashLoopWindow:    getEnvInt("ENGINE_CRASH_LOOP_WINDOW", 600000),
+
+		ShadowEngine:  EngineType(getEnv("SHADOW_ENGINE", "")),
+		ShadowPercent: getEnvInt("SHADOW_PERCENT", 10),
+
+		ScanTagKeys: getEnvList("SCAN_TAG_KEYS", nil),
+
+		ScanURLAllowedHosts: getEnvList("SCAN_URL_ALLOWED_HOSTS", nil),
+		ScanURLSchemes:      getEnvList("SCAN_URL_SCHEMES", []string{"https"}),
+		ScanURLMaxSize:      getEnvInt64("SCAN_URL_MAX_SIZE", 0),
+		ScanURLTimeout:      getEnvInt("SCAN_URL_TIMEOUT", 30000),
+
+		ObjectStoreEndpoints:       getEnvList("OBJECT_STORE_ENDPOINTS", nil),
+		ObjectStoreRegion:          getEnv("OBJECT_STORE_REGION", "us-east-1"),
+		ObjectStoreCredentialsFile: getEnv("OBJECT_STORE_CREDENTIALS_FILE", ""),
+		ObjectStoreMaxSize:         getEnvInt64("OBJECT_STORE_MAX_SIZE", 0),
+		ObjectStoreTimeout:         getEnvInt("OBJECT_STORE_TIMEOUT", 600000),
+
+		BucketScanSQSQueueURL:      getEnv("BUCKET_SCAN_SQS_QUEUE_URL", ""),
+		BucketScanWebhookTokenFile: getEnv("BUCKET_SCAN_WEBHOOK_TOKEN_FILE", ""),
+		BucketScanQuarantineBucket: getEnv("BUCKET_SCAN_QUARANTINE_BUCKET", ""),
+		BucketScanWorkers:          getEnvInt("BUCKET_SCAN_WORKERS", 2),
+
+		ScanPathRoots:   getEnvList("SCAN_PATH_ROOTS", nil),
+		ScanPathWorkers: getEnvInt("SCAN_PATH_WORKERS", 4),
+		ScanPathMaxRuns: getEnvInt("SCAN_PATH_MAX_RUNS", 2),
+
+		ScanBatchMaxFiles: getEnvInt("SCAN_BATCH_MAX_FILES", 20),
+
+		SessionMaxFiles: getEnvInt("SESSION_MAX_FILES", 50),
+		SessionTTL:      getEnvInt("SESSION_TTL", 3600000),
+
+		UploadFieldNames: getEnvList("UPLOAD_FIELD_NAMES", []string{"file", "files", "files[]"}),
+
+		CompatAPIs: compatAPIs,
+
+		BlockedExtensions: getEnvList("BLOCKED_EXTENSIONS", nil),
+		BlockedMimeTypes:  getEnvList("BLOCKED_MIME_TYPES", nil),
+
+		RTSWatchRoots: getEnvList("RTS_WATCH_ROOTS", nil),
+
+		ClamdScanRoots: getEnvList("CLAMD_SCAN_ROOTS", nil),
+
 		Drivers: map[EngineType]DriverConfig{
 			EngineClamAV: {
 				Engine:             EngineClamAV,
 				RTSLogPath:         getEnv("CLAMAV_RTS_LOG_PATH", "/var/log/clamav/clamonacc.log"),
-				ScanBinaryPath:     getEnv("CLAMAV_SCAN_BINARY", "/usr/bin/clamdscan"),
 				Timeout:            getEnvInt("CLAMAV_TIMEOUT", 15000),
 				RTSCacheBaseDelay:  getEnvInt("CLAMAV_RTS_CACHE_BASE_DELAY", 500),
 				RTSCacheDelayPerMB: getEnvInt("CLAMAV_RTS_CACHE_DELAY_PER_MB", 10),
+				RTSReplayWindow:    getEnvInt("CLAMAV_RTS_REPLAY_WINDOW", 0),
+				FixtureRecordDir:   getEnv("CLAMAV_FIXTURE_RECORD_DIR", ""),
+				QuarantineDir:      getEnv("CLAMAV_QUARANTINE_DIR", ""),
+				UploadSubdir:       getEnv("CLAMAV_UPLOAD_SUBDIR", ""),
+				WatchConfigPath:    getEnv("CLAMAV_CONFIG_FILE", "/etc/clamav/clamd.conf"),
+				SignatureMaxAge:    getEnvInt("CLAMAV_SIGNATURE_MAX_AGE_HOURS", 0),
+
+				ClamdAddress:  getEnv("CLAMAV_CLAMD_ADDRESS", ""),
+				ClamdPathScan: getEnvBool("CLAMAV_CLAMD_PATH_SCAN", false),
+
+				FastFlags:     getEnvList("CLAMAV_FAST_FLAGS", nil),
+				ThoroughFlags: getEnvList("CLAMAV_THOROUGH_FLAGS", nil),
+
+				ScanBinaryCandidates: getEnvList("CLAMAV_SCAN_BINARY", []string{
+					"/usr/bin/clamdscan",
+					"/usr/local/bin/clamdscan",
+					"/usr/lib/{uname_arch}-linux-gnu/clamav/clamdscan",
+				}),
+
+				UpdateCommand: getEnvList("CLAMAV_UPDATE_COMMAND", []string{"/usr/bin/freshclam", "--stdout"}),
+				UpdateTimeout: getEnvInt("CLAMAV_UPDATE_TIMEOUT", 300000),
+
+				DefinitionsLink: getEnv("CLAMAV_DEFINITIONS_LINK", ""),
+				DefinitionSets:  getEnvList("CLAMAV_DEFINITION_SETS", nil),
 			},
 			EngineTrendMicro: {
 				Engine:             EngineTrendMicro,
 				RTSLogPath:         getEnv("TM_RTS_LOG_PATH", "/var/log/ds_agent/ds_agent.log"),
-				ScanBinaryPath:     getEnv("TM_SCAN_BINARY", "/opt/ds_agent/dsa_scan"),
 				Timeout:            getEnvInt("TM_TIMEOUT", 15000),
 				RTSCacheBaseDelay:  getEnvInt("TM_RTS_CACHE_BASE_DELAY", 500),
 				RTSCacheDelayPerMB: getEnvInt("TM_RTS_CACHE_DELAY_PER_MB", 10),
+				RTSReplayWindow:    getEnvInt("TM_RTS_REPLAY_WINDOW", 0),
+				FixtureRecordDir:   getEnv("TM_FIXTURE_RECORD_DIR", ""),
+				QuarantineDir:      getEnv("TM_QUARANTINE_DIR", ""),
+				LicenseQueryPath:   getEnv("TM_LICENSE_QUERY_BINARY", "/opt/ds_agent/dsa_query"),
+				LicenseWarnDays:    getEnvInt("TM_LICENSE_WARN_DAYS", 30),
+				UploadSubdir:       getEnv("TM_UPLOAD_SUBDIR", ""),
+
+				FastFlags:     getEnvList("TM_FAST_FLAGS", nil),
+				ThoroughFlags: getEnvList("TM_THOROUGH_FLAGS", nil),
+
+				ScanBinaryCandidates: getEnvList("TM_SCAN_BINARY", []string{
+					"/opt/ds_agent/dsa_scan",
+					"/opt/ds_agent/{uname_arch}/dsa_scan",
+				}),
+
+				// Asks the manager for a security update; the agent applies
+				// it asynchronously
+				UpdateCommand: getEnvList("TM_UPDATE_COMMAND", []string{"/opt/ds_agent/dsa_control", "-m", "UpdateComponent:true"}),
+				UpdateTimeout: getEnvInt("TM_UPDATE_TIMEOUT", 300000),
+			},
+			EngineSophos: {
+				Engine:             EngineSophos,
+				RTSLogPath:         getEnv("SOPHOS_RTS_LOG_PATH", "/opt/sophos-av/log/savd.log"),
+				Timeout:            getEnvInt("SOPHOS_TIMEOUT", 15000),
+				RTSCacheBaseDelay:  getEnvInt("SOPHOS_RTS_CACHE_BASE_DELAY", 500),
+				RTSCacheDelayPerMB: getEnvInt("SOPHOS_RTS_CACHE_DELAY_PER_MB", 10),
+				RTSReplayWindow:    getEnvInt("SOPHOS_RTS_REPLAY_WINDOW", 0),
+				FixtureRecordDir:   getEnv("SOPHOS_FIXTURE_RECORD_DIR", ""),
+				QuarantineDir:      getEnv("SOPHOS_QUARANTINE_DIR", ""),
+				UploadSubdir:       getEnv("SOPHOS_UPLOAD_SUBDIR", ""),
+
+				FastFlags:     getEnvList("SOPHOS_FAST_FLAGS", nil),
+				ThoroughFlags: getEnvList("SOPHOS_THOROUGH_FLAGS", nil),
+
+				ScanBinaryCandidates: getEnvList("SOPHOS_SCAN_BINARY", []string{
+					"/opt/sophos-av/bin/savscan",
+					"/usr/local/bin/savscan",
+				}),
+
+				UpdateCommand: getEnvList("SOPHOS_UPDATE_COMMAND", []string{"/opt/sophos-av/bin/savupdate"}),
+				UpdateTimeout: getEnvInt("SOPHOS_UPDATE_TIMEOUT", 300000),
+			},
+			EngineDefender: {
+				Engine:           EngineDefender,
+				Timeout:          getEnvInt("DEFENDER_TIMEOUT", 30000),
+				FixtureRecordDir: getEnv("DEFENDER_FIXTURE_RECORD_DIR", ""),
+				UploadSubdir:     getEnv("DEFENDER_UPLOAD_SUBDIR", ""),
+				StatusQueryPath:  getEnv("DEFENDER_STATUS_BINARY", "powershell.exe"),
+
+				FastFlags:     getEnvList("DEFENDER_FAST_FLAGS", nil),
+				ThoroughFlags: getEnvList("DEFENDER_THOROUGH_FLAGS", nil),
+
+				// The platform directory holds the current version; the
+				// Program Files copy may lag behind it
+				ScanBinaryCandidates: getEnvList("DEFENDER_SCAN_BINARY", []string{
+					`C:\ProgramData\Microsoft\Windows Defender\Platform\*\MpCmdRun.exe`,
+					`C:\Program Files\Windows Defender\MpCmdRun.exe`,
+				}),
+
+				UpdateCommand: getEnvList("DEFENDER_UPDATE_COMMAND", []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", "Update-MpSignature"}),
+				UpdateTimeout: getEnvInt("DEFENDER_UPDATE_TIMEOUT", 300000),
 			},
 		},
 		Auth: AuthConfig{
@@ -74,9 +642,34 @@ func Load() (*Config, error) {
 			ClusterName:   getEnv("AUTH_CLUSTER_NAME", "default"),
 			Timeout:       getEnvInt("AUTH_TIMEOUT", 5000),
 			AllowlistFile: getEnv("AUTH_ALLOWLIST_FILE", "/etc/av-scanner/allowlist.yaml"),
+			CacheTTL:      getEnvInt("AUTH_CACHE_TTL", 0),
+
+			BanThreshold:    getEnvInt("AUTH_BAN_THRESHOLD", 0),
+			BanWindow:       getEnvInt("AUTH_BAN_WINDOW", 60000),
+			BanDuration:     getEnvInt("AUTH_BAN_DURATION", 300000),
+			BanSourceHeader: getEnv("AUTH_BAN_SOURCE_HEADER", ""),
+
+			BanTrustedProxies: getEnvInt("AUTH_BAN_TRUSTED_PROXIES", 1),
 		},
 	}
 
+	// Until probed, use the first candidate of each engine in use
+	for _, engine := range cfg.configuredEngines() {
+		driverCfg, ok := cfg.Drivers[engine]
+		if !ok {
+			continue
+		}
+		if len(driverCfg.ScanBinaryCandidates) == 0 {
+			return nil, fmt.Errorf("no scan binary candidates for engine: %s", engine)
+		}
+		driverCfg.ScanBinaryPath = driverCfg.ScanBinaryCandidates[0]
+		cfg.Drivers[engine] = driverCfg
+	}
+
+	if len(cfg.RTSWatchRoots) == 0 {
+		cfg.RTSWatchRoots = []string{cfg.UploadDir}
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -85,15 +678,269 @@ func Load() (*Config, error) {
 }
 
 func (c *Config) Validate() error {
-	if c.ActiveEngine != EngineClamAV && c.ActiveEngine != EngineTrendMicro && c.ActiveEngine != EngineMock {
+	if c.ActiveEngine != EngineClamAV && c.ActiveEngine != EngineTrendMicro && c.ActiveEngine != EngineDefender && c.ActiveEngine != EngineSophos && c.ActiveEngine != EngineMock {
 		return fmt.Errorf("invalid active engine: %s", c.ActiveEngine)
 	}
 	if c.Port < 1 || c.Port > 65535 {
 		return fmt.Errorf("invalid port: %d", c.Port)
 	}
+	if c.AdminPort < 0 || c.AdminPort > 65535 || c.AdminPort == c.Port {
+		return fmt.Errorf("invalid admin port: %d", c.AdminPort)
+	}
+	if c.ICAPPort < 0 || c.ICAPPort > 65535 || (c.ICAPPort != 0 && (c.ICAPPort == c.Port || c.ICAPPort == c.AdminPort)) {
+		return fmt.Errorf("invalid ICAP port: %d", c.ICAPPort)
+	}
+	if c.GRPCPort < 0 || c.GRPCPort > 65535 || (c.GRPCPort != 0 && (c.GRPCPort == c.Port || c.GRPCPort == c.AdminPort || c.GRPCPort == c.ICAPPort)) {
+		return fmt.Errorf("invalid gRPC port: %d", c.GRPCPort)
+	}
+	if c.ClamdPort < 0 || c.ClamdPort > 65535 || (c.ClamdPort != 0 && (c.ClamdPort == c.Port || c.ClamdPort == c.AdminPort || c.ClamdPort == c.ICAPPort || c.ClamdPort == c.GRPCPort)) {
+		return fmt.Errorf("invalid clamd port: %d", c.ClamdPort)
+	}
 	if c.MaxFileSize < 1 {
 		return fmt.Errorf("invalid max file size: %d", c.MaxFileSize)
 	}
+	if c.MaxNestingDepth < 0 {
+		return fmt.Errorf("invalid max nesting depth: %d", c.MaxNestingDepth)
+	}
+	if c.ThroughputLimit < 0 || c.ThroughputBurst < 0 {
+		return fmt.Errorf("invalid throughput limit: %d (burst %d)", c.ThroughputLimit, c.ThroughputBurst)
+	}
+	switch c.ThroughputMode {
+	case "", ThroughputQueue, ThroughputReject:
+	default:
+		return fmt.Errorf("invalid throughput mode: %s", c.ThroughputMode)
+	}
+	if c.MaxConcurrentScans < 0 || c.ScanQueueDepth < 0 {
+		return fmt.Errorf("invalid scan concurrency: %d (queue depth %d)", c.MaxConcurrentScans, c.ScanQueueDepth)
+	}
+	seen := make(map[EngineType]bool)
+	for i, engine := range c.Engines {
+		switch {
+		case engine != EngineClamAV && engine != EngineTrendMicro && engine != EngineDefender && engine != EngineSophos && engine != EngineMock:
+			return fmt.Errorf("invalid engine: %s", engine)
+		case seen[engine]:
+			return fmt.Errorf("engine listed more than once: %s", engine)
+		case i == 0 && engine != c.ActiveEngine:
+			return fmt.Errorf("the first engine must be the active engine: %s", engine)
+		}
+		seen[engine] = true
+	}
+	switch c.EngineAggregation {
+	case "", AggregateAnyInfected, AggregateAllClean, AggregateMajority:
+	default:
+		return fmt.Errorf("invalid engine aggregation: %s", c.EngineAggregation)
+	}
+	switch c.ShadowEngine {
+	case "":
+	case c.ActiveEngine:
+		return fmt.Errorf("shadow engine must differ from the active engine: %s", c.ShadowEngine)
+	case EngineClamAV, EngineTrendMicro, EngineDefender, EngineSophos, EngineMock:
+		if seen[c.ShadowEngine] {
+			return fmt.Errorf("shadow engine must not be one of the active engines: %s", c.ShadowEngine)
+		}
+	default:
+		return fmt.Errorf("invalid shadow engine: %s", c.ShadowEngine)
+	}
+	if c.AsyncWorkers < 0 || c.AsyncQueueSize < 0 || c.AsyncJobTTL < 0 {
+		return fmt.Errorf("async workers, queue size and job TTL must not be negative")
+	}
+	if c.SoftLimitPercent < 0 || c.SoftLimitPercent > 100 {
+		return fmt.Errorf("invalid soft limit percent: %d", c.SoftLimitPercent)
+	}
+	if c.MemoryScanMaxSize < 0 {
+		return fmt.Errorf("invalid memory scan max size: %d", c.MemoryScanMaxSize)
+	}
+	if c.SessionMaxFiles < 0 || c.SessionTTL < 0 {
+		return fmt.Errorf("invalid session settings: max files %d, TTL %d", c.SessionMaxFiles, c.SessionTTL)
+	}
+	if c.ScanHistorySize < 0 {
+		return fmt.Errorf("invalid scan history size: %d", c.ScanHistorySize)
+	}
+	if c.AbuseThreshold < 0 || c.AbuseWindow < 0 || c.AbuseBlockDuration < 0 {
+		return fmt.Errorf("abuse threshold, window and block duration must not be negative")
+	}
+	if c.QuotaMonthlyScans < 0 || c.QuotaMonthlyBytes < 0 {
+		return fmt.Errorf("invalid monthly quota: %d scans, %d bytes", c.QuotaMonthlyScans, c.QuotaMonthlyBytes)
+	}
+	if c.VerdictCacheTTL < 0 || c.VerdictCacheSize < 0 {
+		return fmt.Errorf("invalid verdict cache: TTL %d, size %d", c.VerdictCacheTTL, c.VerdictCacheSize)
+	}
+	if c.RTSWaitCeiling < 0 {
+		return fmt.Errorf("invalid RTS wait ceiling: %d", c.RTSWaitCeiling)
+	}
+	if c.RateLimit < 0 || c.RateLimitBurst < 0 {
+		return fmt.Errorf("invalid rate limit: %d (burst %d)", c.RateLimit, c.RateLimitBurst)
+	}
+	switch c.AbuseAction {
+	case "", AbuseAlert, AbuseBlock:
+	default:
+		return fmt.Errorf("invalid abuse action: %s", c.AbuseAction)
+	}
+	if c.AbuseAlertURL != "" {
+		if u, err := url.Parse(c.AbuseAlertURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid abuse alert URL: %s", c.AbuseAlertURL)
+		}
+	}
+	for _, profile := range c.ScanProfiles {
+		switch profile {
+		case ProfileFast, ProfileStandard, ProfileThorough:
+		default:
+			return fmt.Errorf("invalid scan profile: %s", profile)
+		}
+	}
+	for _, api := range c.CompatAPIs {
+		switch api {
+		case CompatClamAVRest, CompatVirusTotal:
+		default:
+			return fmt.Errorf("invalid compatibility API: %s", api)
+		}
+	}
+	for _, mimeType := range c.BlockedMimeTypes {
+		if !strings.Contains(mimeType, "/") {
+			return fmt.Errorf("invalid blocked MIME type: %s", mimeType)
+		}
+	}
+	if c.ScanProfileFastMaxSize < 0 {
+		return fmt.Errorf("invalid fast profile max size: %d", c.ScanProfileFastMaxSize)
+	}
+	if c.ScanProfileThoroughDepth < 0 {
+		return fmt.Errorf("invalid thorough profile depth: %d", c.ScanProfileThoroughDepth)
+	}
+	if c.CrashLoopThreshold < 0 {
+		return fmt.Errorf("invalid crash loop threshold: %d", c.CrashLoopThreshold)
+	}
+	if c.CrashLoopThreshold > 0 && c.CrashLoopWindow <= 0 {
+		return fmt.Errorf("invalid crash loop window: %d", c.CrashLoopWindow)
+	}
+	if c.ShadowPercent < 0 || c.ShadowPercent > 100 {
+		return fmt.Errorf("invalid shadow percent: %d", c.ShadowPercent)
+	}
+	for engine, driverCfg := range c.Drivers {
+		subdir := driverCfg.UploadSubdir
+		if subdir != "" && !filepath.IsLocal(subdir) {
+			return fmt.Errorf("invalid upload subdirectory for %s: %s", engine, subdir)
+		}
+		if driverCfg.ClamdAddress != "" {
+			if _, _, err := ParseClamdAddress(driverCfg.ClamdAddress); err != nil {
+				return err
+			}
+		}
+		if err := validateDefinitionSets(engine, driverCfg); err != nil {
+			return err
+		}
+	}
+	for _, key := range c.ScanTagKeys {
+		if !validTagKey(key) {
+			return fmt.Errorf("invalid scan tag key: %q", key)
+		}
+	}
+	for _, scheme := range c.ScanURLSchemes {
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf("invalid scan URL scheme: %s", scheme)
+		}
+	}
+	if c.ScanURLMaxSize < 0 || c.ScanURLTimeout < 0 {
+		return fmt.Errorf("scan URL max size and timeout must not be negative")
+	}
+	for _, endpoint := range c.ObjectStoreEndpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			return fmt.Errorf("invalid object store endpoint: %s", endpoint)
+		}
+	}
+	if len(c.ObjectStoreEndpoints) > 0 && c.ObjectStoreRegion == "" {
+		return fmt.Errorf("object store endpoints require a region")
+	}
+	if c.ObjectStoreMaxSize < 0 || c.ObjectStoreTimeout < 0 {
+		return fmt.Errorf("object store max size and timeout must not be negative")
+	}
+	if c.BucketScanEnabled() {
+		if len(c.ObjectStoreEndpoints) == 0 || c.ObjectStoreCredentialsFile == "" {
+			return fmt.Errorf("bucket scanning requires object store endpoints and a credentials file")
+		}
+		if c.BucketScanWorkers < 1 {
+			return fmt.Errorf("invalid bucket scan workers: %d", c.BucketScanWorkers)
+		}
+	}
+	if len(c.ScanPathRoots) > 0 {
+		for _, root := range c.ScanPathRoots {
+			if !filepath.IsAbs(root) {
+				return fmt.Errorf("scan path root must be absolute: %s", root)
+			}
+		}
+		if c.ScanPathWorkers < 1 || c.ScanPathMaxRuns < 1 {
+			return fmt.Errorf("scan path workers and max runs must be at least 1")
+		}
+	}
+	if c.PayloadFetch && (!c.PayloadCheck || len(c.ScanURLAllowedHosts) == 0) {
+		return fmt.Errorf("payload fetch requires payload check and scan URL allowed hosts")
+	}
+	switch c.EncryptedArchives {
+	case "", EncryptedAllow, EncryptedWarn, EncryptedReject, EncryptedDecrypt:
+	default:
+		return fmt.Errorf("invalid encrypted archive policy: %s", c.EncryptedArchives)
+	}
+	if c.DropzoneDir != "" && (c.DropzoneCleanDir == "" || c.DropzoneRejectDir == "") {
+		return fmt.Errorf("drop zone dir requires clean and reject dirs")
+	}
+	if c.DropzoneQuietPeriod < 0 {
+		return fmt.Errorf("invalid drop zone quiet period: %d", c.DropzoneQuietPeriod)
+	}
+	switch c.EventsTransport {
+	case "":
+	case EventsKafka, EventsNATS:
+		if len(c.EventsBrokers) == 0 || c.EventsTopic == "" {
+			return fmt.Errorf("%s events require brokers and a topic", c.EventsTransport)
+		}
+		if c.EventsQueueSize < 1 {
+			return fmt.Errorf("invalid events queue size: %d", c.EventsQueueSize)
+		}
+	default:
+		return fmt.Errorf("invalid events transport: %s", c.EventsTransport)
+	}
+	if (c.EventsTLSCertFile == "") != (c.EventsTLSKeyFile == "") {
+		return fmt.Errorf("events TLS certificate and key files must be set together")
+	}
+	if !c.EventsTLS && (c.EventsTLSCAFile != "" || c.EventsTLSCertFile != "") {
+		return fmt.Errorf("events TLS files require EVENTS_TLS=true")
+	}
+	switch c.EventsSASLMechanism {
+	case "":
+		if c.EventsTransport == EventsKafka && c.EventsUsername != "" {
+			return fmt.Errorf("kafka events with a username require a SASL mechanism")
+		}
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		if c.EventsTransport != EventsKafka {
+			return fmt.Errorf("events SASL mechanism requires the kafka transport")
+		}
+		if c.EventsUsername == "" || c.EventsPasswordFile == "" {
+			return fmt.Errorf("events SASL mechanism %s requires a username and password file", c.EventsSASLMechanism)
+		}
+	default:
+		return fmt.Errorf("invalid events SASL mechanism: %s", c.EventsSASLMechanism)
+	}
+	if c.EventsUsername != "" && c.EventsPasswordFile == "" {
+		return fmt.Errorf("events username requires a password file")
+	}
+	if c.QuarantineDir != "" && c.QuarantineKeyFile == "" {
+		return fmt.Errorf("quarantine dir requires a quarantine key file")
+	}
+	if c.ScanBatchMaxFiles < 0 {
+		return fmt.Errorf("invalid scan batch max files: %d", c.ScanBatchMaxFiles)
+	}
+	switch c.UploadNaming {
+	case "", UploadNamingUUID, UploadNamingHash, UploadNamingOriginal:
+	default:
+		return fmt.Errorf("invalid upload naming strategy: %s", c.UploadNaming)
+	}
+	switch c.UploadStore {
+	case "", UploadStoreDisk, UploadStoreTmpfs:
+	default:
+		return fmt.Errorf("invalid upload store: %s", c.UploadStore)
+	}
+	if c.Auth.BanTrustedProxies < 0 {
+		return fmt.Errorf("invalid auth ban trusted proxies: %d", c.Auth.BanTrustedProxies)
+	}
 	if c.Auth.Enabled {
 		if c.Auth.ServiceURL == "" {
 			return fmt.Errorf("AUTH_SERVICE_URL is required when AUTH_ENABLED=true")
@@ -101,10 +948,90 @@ func (c *Config) Validate() error {
 		if c.Auth.Timeout < 1 {
 			return fmt.Errorf("invalid auth timeout: %d", c.Auth.Timeout)
 		}
+		if c.Auth.CacheTTL < 0 {
+			return fmt.Errorf("invalid auth cache TTL: %d", c.Auth.CacheTTL)
+		}
+		if c.Auth.BanThreshold < 0 || c.Auth.BanWindow < 0 || c.Auth.BanDuration < 0 {
+			return fmt.Errorf("auth ban threshold, window and duration must not be negative")
+		}
 	}
 	return nil
 }
 
+// validTagKey accepts short keys of letters, digits, '_', '.' and '-'
+func validTagKey(key string) bool {
+	if key == "" || len(key) > 32 {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseClamdAddress splits tcp://host:port or unix:///path into a network and
+// address for net.Dial
+func ParseClamdAddress(addr string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok && path != "" {
+		return "unix", path, nil
+	}
+	if hostPort, ok := strings.CutPrefix(addr, "tcp://"); ok {
+		if _, _, err := net.SplitHostPort(hostPort); err == nil {
+			return "tcp", hostPort, nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid clamd address %q: expected tcp://host:port or unix:///path", addr)
+}
+
+// validateDefinitionSets checks an engine's blue/green definitions: a link
+// and two absolute directories with distinct names, or neither
+func validateDefinitionSets(engine EngineType, driverCfg DriverConfig) error {
+	link, sets := driverCfg.DefinitionsLink, driverCfg.DefinitionSets
+	if link == "" && len(sets) == 0 {
+		return nil
+	}
+	if !filepath.IsAbs(link) || len(sets) != 2 {
+		return fmt.Errorf("definition sets for %s need an absolute link and two directories", engine)
+	}
+	for _, dir := range sets {
+		if !filepath.IsAbs(dir) || filepath.Clean(dir) == filepath.Clean(link) {
+			return fmt.Errorf("invalid definition set for %s: %s", engine, dir)
+		}
+	}
+	if filepath.Base(sets[0]) == filepath.Base(sets[1]) {
+		return fmt.Errorf("definition sets for %s must have distinct names: %s", engine, filepath.Base(sets[0]))
+	}
+	return nil
+}
+
+// configuredEngines lists the active, AV_ENGINES and shadow engines, which
+// get a driver at startup
+func (c *Config) configuredEngines() []EngineType {
+	engines := []EngineType{c.ActiveEngine}
+	for _, engine := range c.Engines {
+		if !slices.Contains(engines, engine) {
+			engines = append(engines, engine)
+		}
+	}
+	if c.ShadowEngine != "" && !slices.Contains(engines, c.ShadowEngine) {
+		engines = append(engines, c.ShadowEngine)
+	}
+	return engines
+}
+
+// EngineUploadDir is where uploads are written while engine is active, for
+// on-access scanners that only watch specific paths
+func (c *Config) EngineUploadDir(engine EngineType) string {
+	return filepath.Join(c.UploadDir, c.Drivers[engine].UploadSubdir)
+}
+
+// BucketScanEnabled reports whether S3 event notifications are consumed
+func (c *Config) BucketScanEnabled() bool {
+	return c.BucketScanSQSQueueURL != "" || c.BucketScanWebhookTokenFile != ""
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -130,6 +1057,21 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+// getEnvList parses a comma-separated list, ignoring empty items
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		return value == "true" || value == "1" || value == "yes"
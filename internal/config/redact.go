@@ -0,0 +1,60 @@
+package config
+
+import (
+	"maps"
+	"net/url"
+)
+
+// redactedValue replaces secrets in Redacted
+const redactedValue = "REDACTED"
+
+// Redacted returns a copy of the configuration that is safe to show, e.g.
+// to support: credentials and query strings are removed from URLs, and
+// webhook URLs, whose path is often the secret, keep only their scheme and
+// host. Keys, tokens and credentials are only ever read from files, whose
+// paths are kept.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.AbuseAlertURL = redactWebhookURL(c.AbuseAlertURL)
+	r.BucketScanSQSQueueURL = redactURL(c.BucketScanSQSQueueURL)
+	r.Auth.ServiceURL = redactURL(c.Auth.ServiceURL)
+	r.ObjectStoreEndpoints = make([]string, len(c.ObjectStoreEndpoints))
+	for i, endpoint := range c.ObjectStoreEndpoints {
+		r.ObjectStoreEndpoints[i] = redactURL(endpoint)
+	}
+	r.Drivers = maps.Clone(c.Drivers)
+	for engine, driver := range r.Drivers {
+		driver.ClamdAddress = redactURL(driver.ClamdAddress)
+		r.Drivers[engine] = driver
+	}
+	return &r
+}
+
+// redactURL removes a URL's password and query string
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redactedValue
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redactedValue
+	}
+	return u.String()
+}
+
+// redactWebhookURL keeps only a URL's scheme and host
+func redactWebhookURL(raw string) string {
+	u, err := url.Parse(raw)
+	switch {
+	case raw == "":
+		return ""
+	case err != nil || u.Host == "":
+		return redactedValue
+	case u.User == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == "":
+		return raw
+	}
+	return u.Scheme + "://" + u.Host + "/" + redactedValue
+}
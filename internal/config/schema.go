@@ -0,0 +1,355 @@
+package config
+
+import "strings"
+
+// Schema returns a JSON Schema (draft 2020-12) describing the environment
+// variables read by Load and the YAML files they point to, for validating
+// deployment values before they reach the service. Environment values may be
+// given as strings, as Kubernetes requires, or as the native JSON type.
+func Schema() map[string]any {
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "av-scanner configuration",
+		"type":        "object",
+		"description": "env holds environment variables; policy, schedule and allowlist are the contents of SCAN_POLICY_FILE, SCAN_SCHEDULE_FILE and AUTH_ALLOWLIST_FILE",
+		"properties": map[string]any{
+			"env": map[string]any{
+				"type":                 "object",
+				"properties":           envSchema(),
+				"additionalProperties": true,
+			},
+			"policy":    policySchema(),
+			"schedule":  scheduleSchema(),
+			"allowlist": allowlistSchema(),
+		},
+	}
+}
+
+func envSchema() map[string]any {
+	engines := []string{string(EngineClamAV), string(EngineTrendMicro), string(EngineDefender), string(EngineSophos), string(EngineMock)}
+
+	return map[string]any{
+		"PORT":                intVar("HTTP server port", 3000, 1, 65535),
+		"ADMIN_PORT":          intVar("Port for admin and metrics endpoints; 0 keeps them on PORT", 0, 0, 65535),
+		"ICAP_PORT":           intVar("ICAP (RFC 3507) listener port for proxies; 0 disables", 0, 0, 65535),
+		"GRPC_PORT":           intVar("gRPC ScanService listener port; 0 disables", 0, 0, 65535),
+		"CLAMD_PORT":          intVar("clamd protocol listener port; 0 disables", 0, 0, 65535),
+		"AV_ENGINE":           enumVar("Active engine", "clamav", engines...),
+		"UPLOAD_DIR":          stringVar("Shared scan directory", "/tmp/av-scanner"),
+		"UPLOAD_NAMING":       enumVar("Upload file naming strategy", "uuid", string(UploadNamingUUID), string(UploadNamingHash), string(UploadNamingOriginal)),
+		"UPLOAD_STORE":        enumVar("Where uploads are kept while scanned: disk, or tmpfs to refuse any other filesystem", "disk", string(UploadStoreDisk), string(UploadStoreTmpfs)),
+		"MAX_FILE_SIZE":       intVar("Max upload size in bytes", 104857600, 1, -1),
+		"LOG_LEVEL":           enumVar("Log level", "info", "debug", "info", "warn", "error"),
+		"SCAN_POLICY_FILE":    stringVar("Path to the scan policy YAML; empty disables", ""),
+		"SCAN_SCHEDULE_FILE":  stringVar("Path to the scheduled scan YAML; empty disables", ""),
+		"FEEDBACK_FILE":       stringVar("JSON lines file of false-negative reports; empty keeps them in memory", ""),
+		"POLYGLOT_CHECK":      boolVar("Flag images/PDFs that also parse as another format", false),
+		"ENTROPY_CHECK":       boolVar("Report the byte entropy of every upload", false),
+		"MAX_NESTING_DEPTH":   intVar("Maximum container nesting level that is unpacked", 3, 0, -1),
+		"PAYLOAD_CHECK":       boolVar("Scan base64 blobs (and, with PAYLOAD_FETCH, URLs) found in text uploads", false),
+		"PAYLOAD_FETCH":       boolVar("Download URLs found in text uploads from SCAN_URL_ALLOWED_HOSTS and scan them", false),
+		"ENCRYPTED_ARCHIVES":  enumVar("Handling of password-protected ZIP archives", "allow", string(EncryptedAllow), string(EncryptedWarn), string(EncryptedReject), string(EncryptedDecrypt)),
+		"THROUGHPUT_LIMIT":    intVar("Global scan throughput cap in bytes/second; 0 disables", 0, 0, -1),
+		"THROUGHPUT_BURST":    intVar("Bytes that may be scanned at once; 0 uses MAX_FILE_SIZE", 0, 0, -1),
+		"THROUGHPUT_MODE":     enumVar("Handling of scans over the throughput cap", "queue", string(ThroughputQueue), string(ThroughputReject)),
+		"THROUGHPUT_MAX_WAIT": intVar("Longest queueing delay in ms", 30000, 0, -1),
+		"ASYNC_WORKERS":       intVar("Concurrent async scans; 0 disables the endpoint", 4, 0, -1),
+		"ASYNC_QUEUE_SIZE":    intVar("Async scans that may wait for a worker", 100, 0, -1),
+		"ASYNC_JOB_TTL":       intVar("How long (ms) finished async jobs can be polled", 3600000, 0, -1),
+		"AV_ENGINES":          listVar("Comma-separated engines that scan every upload concurrently; the first is the active engine and must match AV_ENGINE if set", "", strings.Join(engines, "|")),
+		"ENGINE_AGGREGATION":  enumVar("How AV_ENGINES verdicts are combined", "any-infected", string(AggregateAnyInfected), string(AggregateAllClean), string(AggregateMajority)),
+		"SHADOW_ENGINE":       enumVar("Canary engine that also scans a sample of uploads; must differ from AV_ENGINE", "", append([]string{""}, engines...)...),
+		"SHADOW_PERCENT":      intVar("Percentage of uploads sent to SHADOW_ENGINE", 10, 0, 100),
+		"SCAN_TAG_KEYS":       listVar("Comma-separated tag keys callers may attach to scans", "", `[A-Za-z0-9_.-]{1,32}`),
+		"RTS_WATCH_ROOTS":     listVar("Comma-separated directories queryable via /api/v1/rts/watch; defaults to UPLOAD_DIR", "", ""),
+
+		"SCAN_URL_ALLOWED_HOSTS": listVar("Comma-separated hosts (or *.domain) POST /api/v1/scan/url may fetch from; empty disables", "", ""),
+		"SCAN_URL_SCHEMES":       listVar("Comma-separated URL schemes allowed for scan-by-URL", "https", "https?"),
+		"SCAN_URL_MAX_SIZE":      intVar("Largest download in bytes for scan-by-URL; 0 uses MAX_FILE_SIZE", 0, 0, -1),
+		"SCAN_URL_TIMEOUT":       intVar("Download timeout in ms for scan-by-URL", 30000, 0, -1),
+
+		"OBJECT_STORE_ENDPOINTS":        listVar("Comma-separated S3-compatible endpoint URLs POST /api/v1/scan/object may download from, the first being the default; empty disables", "", `https?://[^\s,]+`),
+		"OBJECT_STORE_REGION":           stringVar("Region object store requests are signed for", "us-east-1"),
+		"OBJECT_STORE_CREDENTIALS_FILE": stringVar("AWS shared credentials file with the object store access key; empty sends unsigned requests", ""),
+		"OBJECT_STORE_MAX_SIZE":         intVar("Largest object in bytes for scan-by-reference; 0 uses MAX_FILE_SIZE", 0, 0, -1),
+		"OBJECT_STORE_TIMEOUT":          intVar("Download timeout in ms for scan-by-reference", 600000, 0, -1),
+
+		"BUCKET_SCAN_SQS_QUEUE_URL":      stringVar("SQS queue URL to poll for S3 event notifications of objects to scan; empty disables", ""),
+		"BUCKET_SCAN_WEBHOOK_TOKEN_FILE": stringVar("File with the bearer token POST /api/v1/bucket-events requires; empty disables the webhook", ""),
+		"BUCKET_SCAN_QUARANTINE_BUCKET":  stringVar("Bucket infected objects are moved to; empty tags them in place", ""),
+		"BUCKET_SCAN_WORKERS":            intVar("Objects from bucket notifications scanned concurrently", 2, 1, -1),
+
+		"SCAN_PATH_ROOTS":    listVar("Comma-separated directories POST /api/v1/scan/path may scan; empty disables it", "", ""),
+		"SCAN_PATH_WORKERS":  intVar("Files scanned concurrently per directory scan", 4, 1, -1),
+		"SCAN_PATH_MAX_RUNS": intVar("Directory scans running at once", 2, 1, -1),
+
+		"CLAMD_SCAN_ROOTS":     listVar("Comma-separated directories the clamd SCAN command may read; empty disables SCAN", "", ""),
+		"SCAN_BATCH_MAX_FILES": intVar("Files accepted per POST /api/v1/scan/batch; 0 disables", 20, 0, -1),
+
+		"SESSION_MAX_FILES": intVar("Files accepted per scan session; 0 disables sessions", 50, 0, -1),
+		"SESSION_TTL":       intVar("How long (ms) a scan session stays usable after it is created or finalized", 3600000, 0, -1),
+
+		"UPLOAD_FIELD_NAMES": listVar("Comma-separated multipart fields uploads are read from", "file,files,files[]", `[^\s,]+`),
+
+		"MAX_CONCURRENT_SCANS": intVar("Scans running at once; 0 is unlimited", 8, 0, -1),
+		"SCAN_QUEUE_DEPTH":     intVar("Scans waiting for a MAX_CONCURRENT_SCANS slot before more are rejected", 100, 0, -1),
+
+		"RTS_WAIT_CEILING": intVar("Longest wait (ms) for an RTS verdict after a failed manual scan before the scan fails; 0 disables", 60000, 0, -1),
+
+		"BLOCKED_EXTENSIONS": listVar("Comma-separated file extensions rejected as blocked without scanning", "", `\.?[A-Za-z0-9_.+-]+`),
+		"BLOCKED_MIME_TYPES": listVar("Comma-separated MIME types, sniffed from the content, rejected as blocked without scanning; type/* wildcards allowed", "", `[A-Za-z0-9.+-]+/([A-Za-z0-9.+-]+|\*)`),
+		"COMPAT_APIS":        listVar("Comma-separated other scanning services' APIs to also serve, for clients written for them", "", "clamav-rest|virustotal"),
+
+		"MEMORY_SCAN_MAX_SIZE": intVar("Uploads up to this size in bytes are streamed to the engine without touching UPLOAD_DIR; 0 disables", 0, 0, -1),
+		"SOFT_LIMIT_PERCENT":   intVar("Percentage of a limit at which successful responses carry X-AV-Warning; 0 disables", 80, 0, 100),
+
+		"MESSAGE_CATALOG_DIR": stringVar("Directory of <language>.json catalogs that localize error and verdict messages; empty disables", ""),
+		"SCAN_HISTORY_SIZE":   intVar("Recent scan results kept per caller for GET /api/v1/my/results; 0 disables", 50, 0, -1),
+
+		"ABUSE_THRESHOLD":      intVar("Infected submissions within ABUSE_WINDOW that flag a caller; 0 disables", 0, 0, -1),
+		"ABUSE_WINDOW":         intVar("Window (ms) in which a caller's infected submissions are counted", 600000, 0, -1),
+		"ABUSE_ACTION":         enumVar("What flagging a caller does", "alert", string(AbuseAlert), string(AbuseBlock)),
+		"ABUSE_BLOCK_DURATION": intVar("How long (ms) a flagged caller's scans are refused with ABUSE_ACTION=block", 900000, 0, -1),
+		"ABUSE_ALERT_URL":      patternVar("Webhook that receives abuse alerts; empty only logs them", `https?://.+`),
+
+		"RATE_LIMIT":       intVar("Requests per second each caller, or client IP without authentication, may make; 0 disables", 0, 0, -1),
+		"RATE_LIMIT_BURST": intVar("Requests a caller may make at once before RATE_LIMIT applies; 0 is RATE_LIMIT", 0, 0, -1),
+
+		"USAGE_FILE":          stringVar("JSON file that persists per-caller monthly usage; empty keeps it in memory", ""),
+		"QUOTA_MONTHLY_SCANS": intVar("Scans each caller may make per calendar month; 0 is unlimited", 0, 0, -1),
+		"QUOTA_MONTHLY_BYTES": intVar("Bytes each caller may scan per calendar month; 0 is unlimited", 0, 0, -1),
+
+		"VERDICT_CACHE_TTL":  intVar("How long (ms) a verdict is reused for uploads with the same content; 0 disables", 0, 0, -1),
+		"VERDICT_CACHE_SIZE": intVar("Verdicts kept for reuse", 10000, 0, -1),
+
+		"WARMUP_SCAN": boolVar("Scan a benign probe with every engine at startup before reporting ready", true),
+
+		"SCAN_PROFILES":               listVar("Comma-separated scan profiles callers may select with ?profile=", "fast,standard", "fast|standard|thorough"),
+		"SCAN_PROFILE_FAST_MAX_SIZE":  intVar("Largest upload in bytes accepted under the fast profile; 0 for no cap", 10485760, 0, -1),
+		"SCAN_PROFILE_THOROUGH_DEPTH": intVar("Container nesting level unpacked under the thorough profile", 10, 0, -1),
+
+		"ENGINE_CRASH_LOOP_THRESHOLD": intVar("Engine daemon restarts or failed scans within ENGINE_CRASH_LOOP_WINDOW that mark it degraded; 0 disables", 3, 0, -1),
+		"ENGINE_CRASH_LOOP_WINDOW":    intVar("Crash loop detection window in ms", 600000, 1, -1),
+
+		"DROPZONE_DIR":          stringVar("Directory whose new files are scanned and moved by verdict; empty disables", ""),
+		"DROPZONE_CLEAN_DIR":    stringVar("Where clean drop zone files are moved; required with DROPZONE_DIR", ""),
+		"DROPZONE_REJECT_DIR":   stringVar("Where other drop zone files are moved; required with DROPZONE_DIR", ""),
+		"DROPZONE_QUIET_PERIOD": intVar("Milliseconds a drop zone file must stay unchanged before it is scanned", 2000, 0, -1),
+
+		"EVENTS_TRANSPORT":  enumVar("Publish every scan result to Kafka or NATS; empty disables", "", "", string(EventsKafka), string(EventsNATS)),
+		"EVENTS_BROKERS":    listVar("Comma-separated host:port of Kafka brokers or NATS servers", "", `[^\s:]+:\d+`),
+		"EVENTS_TOPIC":      stringVar("Kafka topic or NATS subject scan results are published to", "av-scanner.scans"),
+		"EVENTS_QUEUE_SIZE": intVar("Scan results waiting to be published before new ones are dropped", 1000, 1, -1),
+
+		"EVENTS_TLS":            boolVar("Connect to Kafka brokers or NATS servers with TLS", false),
+		"EVENTS_TLS_CA_FILE":    stringVar("PEM CA bundle that verifies the brokers; empty uses the system roots", ""),
+		"EVENTS_TLS_CERT_FILE":  stringVar("PEM client certificate presented to the brokers; requires EVENTS_TLS_KEY_FILE", ""),
+		"EVENTS_TLS_KEY_FILE":   stringVar("PEM private key of EVENTS_TLS_CERT_FILE", ""),
+		"EVENTS_SASL_MECHANISM": enumVar("Kafka SASL mechanism; empty disables SASL", "", "", string(SASLPlain), string(SASLScramSHA256), string(SASLScramSHA512)),
+		"EVENTS_USERNAME":       stringVar("Kafka SASL or NATS user", ""),
+		"EVENTS_PASSWORD_FILE":  stringVar("File with the Kafka SASL or NATS password; for NATS without EVENTS_USERNAME, the auth token", ""),
+
+		"QUARANTINE_DIR":      stringVar("Directory where infected uploads are kept encrypted; empty deletes them", ""),
+		"QUARANTINE_KEY_FILE": stringVar("File holding the base64-encoded 32-byte quarantine key; required with QUARANTINE_DIR", ""),
+
+		"AUTH_ENABLED":        boolVar("Require caller tokens", false),
+		"AUTH_SERVICE_URL":    stringVar("kube-federated-auth URL; required when AUTH_ENABLED is true", ""),
+		"AUTH_CLUSTER_NAME":   stringVar("Cluster name sent with token validation", "default"),
+		"AUTH_TIMEOUT":        intVar("Token validation timeout in ms", 5000, 1, -1),
+		"AUTH_ALLOWLIST_FILE": stringVar("Path to the allowlist YAML", "/etc/av-scanner/allowlist.yaml"),
+		"AUTH_CACHE_TTL":      intVar("How long (ms) successful token validations are reused; 0 disables", 0, 0, -1),
+
+		"AUTH_BAN_THRESHOLD":       intVar("Authentication failures within AUTH_BAN_WINDOW that ban a source; 0 disables", 0, 0, -1),
+		"AUTH_BAN_WINDOW":          intVar("Window (ms) in which failures are counted", 60000, 0, -1),
+		"AUTH_BAN_DURATION":        intVar("How long (ms) a banned source is refused", 300000, 0, -1),
+		"AUTH_BAN_SOURCE_HEADER":   stringVar("Header whose address AUTH_BAN_TRUSTED_PROXIES from the right identifies the source of bans, rate limits and upload origins, e.g. X-Forwarded-For; empty uses the peer address", ""),
+		"AUTH_BAN_TRUSTED_PROXIES": intVar("Proxies in front of the service that append to AUTH_BAN_SOURCE_HEADER; 0 counts as 1", 1, 0, -1),
+
+		"CLAMAV_RTS_LOG_PATH":           stringVar("ClamAV RTS log file", "/var/log/clamav/clamonacc.log"),
+		"CLAMAV_SCAN_BINARY":            listVar("ClamAV scan binary candidates; may contain {arch} or {uname_arch}", "/usr/bin/clamdscan,/usr/local/bin/clamdscan,/usr/lib/{uname_arch}-linux-gnu/clamav/clamdscan", ""),
+		"CLAMAV_TIMEOUT":                intVar("ClamAV scan timeout in ms", 15000, 0, -1),
+		"CLAMAV_RTS_CACHE_BASE_DELAY":   intVar("Base delay (ms) when waiting for RTS cache", 500, 0, -1),
+		"CLAMAV_RTS_CACHE_DELAY_PER_MB": intVar("Additional delay (ms) per MB of file size", 10, 0, -1),
+		"CLAMAV_RTS_REPLAY_WINDOW":      intVar("RTS log history (ms) replayed into the detection cache at startup; 0 disables", 0, 0, -1),
+		"CLAMAV_FIXTURE_RECORD_DIR":     stringVar("Record clamdscan output as replay fixtures into this directory", ""),
+		"CLAMAV_QUARANTINE_DIR":         stringVar("ClamAV quarantine directory", ""),
+		"CLAMAV_UPLOAD_SUBDIR":          subdirVar("Subdirectory of UPLOAD_DIR used while ClamAV is active"),
+		"CLAMAV_CONFIG_FILE":            stringVar("clamd.conf checked for on-access coverage of the upload directory", "/etc/clamav/clamd.conf"),
+
+		"CLAMAV_CLAMD_ADDRESS":   patternVar("clamd socket to scan with instead of clamdscan, tcp://host:port or unix:///path; empty runs clamdscan", `tcp://[^/]+:[0-9]+|unix:///.+`),
+		"CLAMAV_CLAMD_PATH_SCAN": boolVar("Let clamd open uploads itself (SCAN) instead of streaming them (INSTREAM); needs the same UPLOAD_DIR path", false),
+		"CLAMAV_FAST_FLAGS":      listVar("Comma-separated extra clamdscan arguments under the fast profile", "", ""),
+		"CLAMAV_THOROUGH_FLAGS":  listVar("Comma-separated extra clamdscan arguments under the thorough profile", "", ""),
+
+		"CLAMAV_SIGNATURE_MAX_AGE_HOURS": intVar("Hours the signatures clamd has loaded may age before ClamAV is unhealthy; 0 disables", 0, 0, -1),
+
+		"CLAMAV_UPDATE_COMMAND": listVar("Comma-separated command run by POST /api/v1/engines/clamav/update; empty disables", "/usr/bin/freshclam,--stdout", ""),
+		"CLAMAV_UPDATE_TIMEOUT": intVar("ClamAV signature update timeout in ms", 300000, 1, -1),
+
+		"CLAMAV_DEFINITIONS_LINK": patternVar("Symlink clamd loads signatures from (DatabaseDirectory), pointed at one of CLAMAV_DEFINITION_SETS; empty disables", `/.*`),
+		"CLAMAV_DEFINITION_SETS":  listVar("Comma-separated blue/green signature directories, named by base name, switched with PUT /api/v1/engines/clamav/definitions", "", `/[^,]*`),
+
+		"TM_RTS_LOG_PATH":           stringVar("DS Agent RTS log file", "/var/log/ds_agent/ds_agent.log"),
+		"TM_SCAN_BINARY":            listVar("DS Agent scan binary candidates; may contain {arch} or {uname_arch}", "/opt/ds_agent/dsa_scan,/opt/ds_agent/{uname_arch}/dsa_scan", ""),
+		"TM_TIMEOUT":                intVar("DS Agent scan timeout in ms", 15000, 0, -1),
+		"TM_RTS_CACHE_BASE_DELAY":   intVar("Base delay (ms) when waiting for RTS cache", 500, 0, -1),
+		"TM_RTS_CACHE_DELAY_PER_MB": intVar("Additional delay (ms) per MB of file size", 10, 0, -1),
+		"TM_RTS_REPLAY_WINDOW":      intVar("RTS log history (ms) replayed into the detection cache at startup; 0 disables", 0, 0, -1),
+		"TM_FIXTURE_RECORD_DIR":     stringVar("Record dsa_scan output as replay fixtures into this directory", ""),
+		"TM_QUARANTINE_DIR":         stringVar("DS Agent quarantine directory", ""),
+		"TM_LICENSE_QUERY_BINARY":   stringVar("Agent status command used to read license state; empty disables", "/opt/ds_agent/dsa_query"),
+		"TM_LICENSE_WARN_DAYS":      intVar("Warn this many days before the DS Agent license expires", 30, 0, -1),
+		"TM_UPLOAD_SUBDIR":          subdirVar("Subdirectory of UPLOAD_DIR used while DS Agent is active"),
+		"TM_FAST_FLAGS":             listVar("Comma-separated extra dsa_scan arguments under the fast profile", "", ""),
+		"TM_THOROUGH_FLAGS":         listVar("Comma-separated extra dsa_scan arguments under the thorough profile", "", ""),
+
+		"TM_UPDATE_COMMAND": listVar("Comma-separated command run by POST /api/v1/engines/trendmicro/update; empty disables", "/opt/ds_agent/dsa_control,-m,UpdateComponent:true", ""),
+		"TM_UPDATE_TIMEOUT": intVar("DS Agent update request timeout in ms", 300000, 1, -1),
+
+		"SOPHOS_RTS_LOG_PATH":           stringVar("Sophos on-access (savd) log file", "/opt/sophos-av/log/savd.log"),
+		"SOPHOS_SCAN_BINARY":            listVar("Sophos savscan binary candidates; may contain {arch} or {uname_arch}", "/opt/sophos-av/bin/savscan,/usr/local/bin/savscan", ""),
+		"SOPHOS_TIMEOUT":                intVar("Sophos scan timeout in ms", 15000, 0, -1),
+		"SOPHOS_RTS_CACHE_BASE_DELAY":   intVar("Base delay (ms) when waiting for RTS cache", 500, 0, -1),
+		"SOPHOS_RTS_CACHE_DELAY_PER_MB": intVar("Additional delay (ms) per MB of file size", 10, 0, -1),
+		"SOPHOS_RTS_REPLAY_WINDOW":      intVar("RTS log history (ms) replayed into the detection cache at startup; 0 disables", 0, 0, -1),
+		"SOPHOS_FIXTURE_RECORD_DIR":     stringVar("Record savscan output as replay fixtures into this directory", ""),
+		"SOPHOS_QUARANTINE_DIR":         stringVar("Sophos quarantine directory", ""),
+		"SOPHOS_UPLOAD_SUBDIR":          subdirVar("Subdirectory of UPLOAD_DIR used while Sophos is active"),
+		"SOPHOS_FAST_FLAGS":             listVar("Comma-separated extra savscan arguments under the fast profile", "", ""),
+		"SOPHOS_THOROUGH_FLAGS":         listVar("Comma-separated extra savscan arguments under the thorough profile", "", ""),
+
+		"SOPHOS_UPDATE_COMMAND": listVar("Comma-separated command run by POST /api/v1/engines/sophos/update; empty disables", "/opt/sophos-av/bin/savupdate", ""),
+		"SOPHOS_UPDATE_TIMEOUT": intVar("Sophos signature update timeout in ms", 300000, 1, -1),
+
+		"DEFENDER_SCAN_BINARY":        listVar("MpCmdRun.exe candidates; may contain * to pick the newest platform version", `C:\ProgramData\Microsoft\Windows Defender\Platform\*\MpCmdRun.exe,C:\Program Files\Windows Defender\MpCmdRun.exe`, ""),
+		"DEFENDER_TIMEOUT":            intVar("Defender scan timeout in ms", 30000, 0, -1),
+		"DEFENDER_STATUS_BINARY":      stringVar("PowerShell used to read Get-MpComputerStatus for health checks; empty only checks the scan binary", "powershell.exe"),
+		"DEFENDER_FIXTURE_RECORD_DIR": stringVar("Record MpCmdRun output as replay fixtures into this directory", ""),
+		"DEFENDER_UPLOAD_SUBDIR":      subdirVar("Subdirectory of UPLOAD_DIR used while Defender is active"),
+		"DEFENDER_FAST_FLAGS":         listVar("Comma-separated extra MpCmdRun arguments under the fast profile", "", ""),
+		"DEFENDER_THOROUGH_FLAGS":     listVar("Comma-separated extra MpCmdRun arguments under the thorough profile", "", ""),
+
+		"DEFENDER_UPDATE_COMMAND": listVar("Comma-separated command run by POST /api/v1/engines/defender/update; empty disables", "powershell.exe,-NoProfile,-NonInteractive,-Command,Update-MpSignature", ""),
+		"DEFENDER_UPDATE_TIMEOUT": intVar("Defender signature update timeout in ms", 300000, 1, -1),
+	}
+}
+
+// intVar accepts an integer or its decimal string; max < 0 means unbounded
+func intVar(description string, def, min, max int64) map[string]any {
+	number := map[string]any{"type": "integer", "minimum": min}
+	if max >= 0 {
+		number["maximum"] = max
+	}
+	return map[string]any{
+		"description": description,
+		"default":     def,
+		"oneOf": []any{
+			number,
+			map[string]any{"type": "string", "pattern": `^-?[0-9]+$`},
+		},
+	}
+}
+
+func boolVar(description string, def bool) map[string]any {
+	return map[string]any{
+		"description": description,
+		"default":     def,
+		"oneOf": []any{
+			map[string]any{"type": "boolean"},
+			map[string]any{"type": "string", "enum": []string{"true", "false", "1", "0", "yes", "no"}},
+		},
+	}
+}
+
+func stringVar(description, def string) map[string]any {
+	return map[string]any{"description": description, "type": "string", "default": def}
+}
+
+func enumVar(description, def string, values ...string) map[string]any {
+	v := stringVar(description, def)
+	v["enum"] = values
+	return v
+}
+
+// listVar is a comma-separated list; itemPattern, if set, constrains each item
+func listVar(description, def, itemPattern string) map[string]any {
+	v := stringVar(description, def)
+	if itemPattern != "" {
+		v["pattern"] = `^\s*(` + itemPattern + `)?(\s*,\s*(` + itemPattern + `)?)*\s*$`
+	}
+	return v
+}
+
+// patternVar is empty or matches pattern
+func patternVar(description, pattern string) map[string]any {
+	v := stringVar(description, "")
+	v["pattern"] = `^(` + pattern + `)?$`
+	return v
+}
+
+// subdirVar is a relative path that stays inside its parent
+func subdirVar(description string) map[string]any {
+	v := stringVar(description, "")
+	v["not"] = map[string]any{"pattern": `^/|(^|/)\.\.(/|$)`}
+	return v
+}
+
+func policySchema() map[string]any {
+	rule := map[string]any{
+		"type":     "object",
+		"required": []string{"action"},
+		"anyOf": []any{
+			map[string]any{"required": []string{"extensions"}, "properties": map[string]any{"extensions": map[string]any{"minItems": 1}}},
+			map[string]any{"required": []string{"mimeTypes"}, "properties": map[string]any{"mimeTypes": map[string]any{"minItems": 1}}},
+		},
+		"properties": map[string]any{
+			"name":             map[string]any{"type": "string"},
+			"extensions":       stringList(),
+			"mimeTypes":        stringList(),
+			"minSize":          map[string]any{"type": "integer", "minimum": 0},
+			"maxSize":          map[string]any{"type": "integer", "minimum": 0},
+			"action":           map[string]any{"enum": []string{"scan", "skip", "deep", "block"}},
+			"entropyThreshold": map[string]any{"type": "number", "minimum": 0, "maximum": 8},
+		},
+		"additionalProperties": false,
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{"rules": map[string]any{"type": "array", "items": rule}},
+		"additionalProperties": false,
+	}
+}
+
+func scheduleSchema() map[string]any {
+	job := map[string]any{
+		"type":     "object",
+		"required": []string{"cron", "path"},
+		"properties": map[string]any{
+			"name":   map[string]any{"type": "string", "description": "unique; defaults to job-<n>"},
+			"cron":   map[string]any{"type": "string", "pattern": `^\s*\S+(\s+\S+){4}\s*$`, "description": "five-field cron expression"},
+			"path":   map[string]any{"type": "string", "minLength": 1, "not": map[string]any{"pattern": "://"}},
+			"notify": map[string]any{"type": "string", "pattern": "^https?://"},
+		},
+		"additionalProperties": false,
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{"jobs": map[string]any{"type": "array", "items": job}},
+		"additionalProperties": false,
+	}
+}
+
+func allowlistSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"allowlist": stringList(),
+			"admins":    stringList(),
+		},
+		"additionalProperties": false,
+	}
+}
+
+func stringList() map[string]any {
+	return map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestSchema_CoversEnv(t *testing.T) {
+	source, err := os.ReadFile("config.go")
+	if err != nil {
+		t.Fatalf("failed to read config.go: %v", err)
+	}
+	env := Schema()["properties"].(map[string]any)["env"].(map[string]any)["properties"].(map[string]any)
+	for _, match := range regexp.MustCompile(`getEnv\w*\("(\w+)"`).FindAllSubmatch(source, -1) {
+		if _, ok := env[string(match[1])]; !ok {
+			t.Errorf("schema is missing %s", match[1])
+		}
+	}
+}
+
+func TestSchema_Patterns(t *testing.T) {
+	data, err := json.Marshal(Schema())
+	if err != nil {
+		t.Fatalf("failed to marshal schema: %v", err)
+	}
+	var schema any
+	json.Unmarshal(data, &schema)
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for key, child := range v {
+				if pattern, ok := child.(string); ok && key == "pattern" {
+					if _, err := regexp.Compile(pattern); err != nil {
+						t.Errorf("invalid pattern %q: %v", pattern, err)
+					}
+				}
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(schema)
+
+	tagKeys := regexp.MustCompile(listVar("", "", `[A-Za-z0-9_.-]{1,32}`)["pattern"].(string))
+	if !tagKeys.MatchString("app, team") || tagKeys.MatchString("app,bad key") {
+		t.Error("unexpected SCAN_TAG_KEYS pattern behaviour")
+	}
+}
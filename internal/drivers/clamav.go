@@ -3,6 +3,8 @@ package drivers
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -16,8 +18,17 @@ import (
 	"github.com/rophy/av-scanner/internal/config"
 )
 
-// Matches: /path/to/file: Signature FOUND
-var clamavFoundRegex = regexp.MustCompile(`(.+):\s+(.+)\s+FOUND$`)
+var (
+	// Matches: /path/to/file: Signature FOUND
+	clamavFoundRegex = regexp.MustCompile(`(.+):\s+(.+)\s+FOUND$`)
+	// Matches the prefix clamonacc writes with LogTime: Thu Oct 16 10:00:00 2026 ->
+	clamavLogTimeRegex = regexp.MustCompile(`^(\w{3} \w{3} [ \d]\d \d{2}:\d{2}:\d{2} \d{4}) -> `)
+	// clamonacc logs one of these per watched directory when it starts
+	clamavStartRegex = regexp.MustCompile(`^ClamInotif: watching '`)
+)
+
+// restartDebounce groups the start lines of one daemon start into one restart
+const restartDebounce = 10 * time.Second
 
 type ClamAVDriver struct {
 	config config.DriverConfig
@@ -25,6 +36,10 @@ type ClamAVDriver struct {
 	cache  *cache.DetectionCache
 	ctx    context.Context
 	cancel context.CancelFunc
+	logWatcher
+
+	onRestart   func(at time.Time)
+	lastRestart time.Time
 }
 
 func NewClamAVDriver(cfg config.DriverConfig, logger *slog.Logger, detectionCache *cache.DetectionCache) *ClamAVDriver {
@@ -45,6 +60,7 @@ func (d *ClamAVDriver) Start() error {
 		return nil
 	}
 
+	replayRTSLog(d.config, d.logger, clamavLineTime, d.processLogLine)
 	go d.watchLog()
 	d.logger.Info("Background log watcher started", "path", d.config.RTSLogPath)
 	return nil
@@ -67,6 +83,8 @@ func (d *ClamAVDriver) watchLog() {
 		return
 	}
 	defer t.Cleanup()
+	d.watching.Store(true)
+	defer d.watching.Store(false)
 
 	for {
 		select {
@@ -83,7 +101,15 @@ func (d *ClamAVDriver) watchLog() {
 }
 
 func (d *ClamAVDriver) processLogLine(line string) {
-	if matches := clamavFoundRegex.FindStringSubmatch(line); matches != nil {
+	detection := line
+	if prefix := clamavLogTimeRegex.FindString(line); prefix != "" {
+		detection = line[len(prefix):]
+	}
+	if clamavStartRegex.MatchString(detection) {
+		d.processStartLine(line)
+		return
+	}
+	if matches := clamavFoundRegex.FindStringSubmatch(detection); matches != nil {
 		absPath, err := filepath.Abs(matches[1])
 		if err != nil {
 			absPath = matches[1]
@@ -99,6 +125,37 @@ func (d *ClamAVDriver) processLogLine(line string) {
 	}
 }
 
+// processStartLine reports a clamonacc start, dated by the log line when it
+// has a timestamp
+func (d *ClamAVDriver) processStartLine(line string) {
+	at, ok := clamavLineTime(line)
+	if !ok {
+		at = time.Now()
+	}
+	if d.onRestart == nil || at.Sub(d.lastRestart).Abs() < restartDebounce {
+		return
+	}
+	d.lastRestart = at
+	d.logger.Info("On-access daemon started", "at", at)
+	d.onRestart(at)
+}
+
+// OnRestart sets the handler called when clamonacc starts
+func (d *ClamAVDriver) OnRestart(handler func(at time.Time)) {
+	d.onRestart = handler
+}
+
+// clamavLineTime returns when a clamonacc log line was written. Lines are
+// only dated when LogTime is enabled in clamd.conf.
+func clamavLineTime(line string) (time.Time, bool) {
+	matches := clamavLogTimeRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(time.ANSIC, matches[1], time.Local)
+	return t, err == nil
+}
+
 func (d *ClamAVDriver) Engine() config.EngineType {
 	return config.EngineClamAV
 }
@@ -158,16 +215,38 @@ func (d *ClamAVDriver) RTSWatch(filePath string, opts WatchOptions) (*ScanResult
 	}
 }
 
-func (d *ClamAVDriver) ManualScan(filePath string) (*ScanResult, error) {
-	startTime := time.Now()
-	fileID := filepath.Base(filePath)
+func (d *ClamAVDriver) ManualScan(filePath string, opts ScanOptions) (*ScanResult, error) {
+	// clamdscan --fdpass --stdout --no-summary [--allmatch] <file>
+	return d.clamdscan(filePath, filepath.Base(filePath), nil, opts)
+}
 
-	// clamdscan --fdpass --stdout --no-summary <file>
+// StreamScan scans content from r without a file: clamdscan reads it from
+// stdin and sends it to clamd with INSTREAM
+func (d *ClamAVDriver) StreamScan(r io.Reader, fileID string, opts ScanOptions) (*ScanResult, error) {
+	// clamdscan --stdout --no-summary [--allmatch] -
+	return d.clamdscan("-", fileID, r, opts)
+}
+
+// clamdscan scans target, a file path or "-" for stdin
+func (d *ClamAVDriver) clamdscan(target, fileID string, stdin io.Reader, opts ScanOptions) (*ScanResult, error) {
+	startTime := time.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, d.config.ScanBinaryPath, "--fdpass", "--stdout", "--no-summary", filePath)
+	var args []string
+	if stdin == nil {
+		args = append(args, "--fdpass")
+	}
+	args = append(args, "--stdout", "--no-summary")
+	if opts.Deep {
+		args = append(args, "--allmatch")
+	}
+	args = append(args, opts.Flags...)
+	args = append(args, target)
+
+	cmd := exec.CommandContext(ctx, d.config.ScanBinaryPath, args...)
 	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
@@ -186,42 +265,58 @@ func (d *ClamAVDriver) ManualScan(filePath string) (*ScanResult, error) {
 	output := strings.TrimSpace(stdout.String())
 	d.logger.Debug("Manual scan completed", "exitCode", exitCode, "output", output)
 
-	// Parse output for signature
-	var status ScanStatus
-	var signature string
-
-	if matches := clamavFoundRegex.FindStringSubmatch(output); matches != nil {
-		status = StatusInfected
-		signature = matches[2]
-	} else {
-		// Exit codes: 0 = clean, 1 = virus found, 2+ = error
-		switch exitCode {
-		case 0:
-			status = StatusClean
-		case 1:
-			status = StatusInfected
-		default:
-			status = StatusError
-		}
+	// Fixtures are replayed against files, so streamed scans are not recorded
+	if d.config.FixtureRecordDir != "" && stdin == nil {
+		d.recordFixture(target, output, stderr.String(), exitCode)
 	}
 
+	status, signature := d.parseManualScanOutput(output, exitCode)
+	usage := processUsage(cmd.ProcessState)
+
 	return &ScanResult{
 		Status:    status,
 		Engine:    d.Engine(),
 		Signature: signature,
 		Phase:     PhaseManual,
-		FilePath:  filePath,
+		FilePath:  target,
 		FileID:    fileID,
 		Timestamp: time.Now(),
 		Duration:  time.Since(startTime).Milliseconds(),
+		Usage:     usage,
 		Raw: map[string]interface{}{
 			"exitCode": exitCode,
 			"stdout":   output,
 			"stderr":   stderr.String(),
+			"usage":    usage,
 		},
+		ErrorCategory: errorCategory(status, output, stderr.String()),
 	}, nil
 }
 
+func (d *ClamAVDriver) parseManualScanOutput(output string, exitCode int) (ScanStatus, string) {
+	// Parse output for signature
+	if matches := clamavFoundRegex.FindStringSubmatch(output); matches != nil {
+		return StatusInfected, matches[2]
+	}
+
+	// Exit codes: 0 = clean, 1 = virus found, 2+ = error
+	switch exitCode {
+	case 0:
+		return StatusClean, ""
+	case 1:
+		return StatusInfected, ""
+	default:
+		return StatusError, ""
+	}
+}
+
+func (d *ClamAVDriver) recordFixture(filePath, stdout, stderr string, exitCode int) {
+	fixture := NewFixture(d.Engine(), filePath, stdout, stderr, exitCode)
+	if err := WriteFixture(d.config.FixtureRecordDir, fixture); err != nil {
+		d.logger.Warn("Failed to record fixture", "error", err)
+	}
+}
+
 func (d *ClamAVDriver) CheckHealth() (*EngineHealth, error) {
 	health := &EngineHealth{
 		Engine:    d.Engine(),
@@ -234,7 +329,14 @@ func (d *ClamAVDriver) CheckHealth() (*EngineHealth, error) {
 		return health, nil
 	}
 
+	version, err := d.queryVersion()
+	if err != nil {
+		health.Error = fmt.Sprintf("version query failed: %v", err)
+		return health, nil
+	}
+	health.Version = version
 	health.Healthy = true
+	checkSignatures(d.config, health)
 	return health, nil
 }
 
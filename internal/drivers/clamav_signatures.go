@@ -0,0 +1,79 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// Matches clamd's VERSION reply, which clamdscan --version prints too:
+// ClamAV 1.0.7/27470/Wed Oct 15 08:00:00 2026
+var clamavVersionRegex = regexp.MustCompile(`^ClamAV [^/\s]+/(\d+)/(.+)$`)
+
+// parseSignatures reads the signature database version and build date from a
+// clamd version string. Returns nil for a version without them, as clamdscan
+// prints when it cannot reach clamd.
+func parseSignatures(version string) *SignatureInfo {
+	matches := clamavVersionRegex.FindStringSubmatch(strings.TrimSpace(version))
+	if matches == nil {
+		return nil
+	}
+	info := &SignatureInfo{Version: matches[1]}
+	if t, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(matches[2]), time.Local); err == nil {
+		info.UpdatedAt = &t
+	}
+	return info
+}
+
+// checkSignatures adds the signatures clamd reports loaded to health.
+// Signatures older than SignatureMaxAge hours make the engine unhealthy: it
+// still scans, but misses everything found since, e.g. when freshclam has
+// stopped updating.
+func checkSignatures(cfg config.DriverConfig, health *EngineHealth) {
+	info := parseSignatures(health.Version)
+	if info == nil {
+		return
+	}
+	if info.UpdatedAt != nil {
+		age := int64(time.Since(*info.UpdatedAt).Seconds())
+		info.AgeSeconds = &age
+		if cfg.SignatureMaxAge > 0 && age > int64(cfg.SignatureMaxAge)*3600 && health.Healthy {
+			health.Healthy = false
+			health.Error = fmt.Sprintf("signatures are %d hours old", age/3600)
+		}
+	}
+	health.Signatures = info
+}
+
+// queryVersion runs "clamdscan --version", which asks clamd for its version
+// and loaded signatures
+func (d *ClamAVDriver) queryVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, d.config.ScanBinaryPath, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := bytes.Cut(output, []byte("\n"))
+	return strings.TrimSpace(string(line)), nil
+}
+
+// Reload runs "clamdscan --reload" so clamd loads the signatures freshclam
+// wrote, in case freshclam could not notify it
+func (d *ClamAVDriver) Reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, d.config.ScanBinaryPath, "--reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("clamdscan --reload: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestParseSignatures(t *testing.T) {
+	info := parseSignatures("ClamAV 1.0.7/27470/Wed Oct 14 08:00:00 2026")
+	if info == nil || info.Version != "27470" {
+		t.Fatalf("unexpected signatures: %+v", info)
+	}
+	if info.UpdatedAt == nil || !info.UpdatedAt.Equal(time.Date(2026, 10, 14, 8, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected signature date: %v", info.UpdatedAt)
+	}
+	if info := parseSignatures("ClamAV 1.0.7"); info != nil {
+		t.Errorf("expected no signatures without a database, got %+v", info)
+	}
+}
+
+func TestClamAVDriver_CheckHealth_SignatureAge(t *testing.T) {
+	dir := t.TempDir()
+	rtsLog := filepath.Join(dir, "clamonacc.log")
+	if err := os.WriteFile(rtsLog, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newDriver := func(updated time.Time, maxAge int) *ClamAVDriver {
+		clamdscan := filepath.Join(dir, "clamdscan-"+updated.Format("20060102150405"))
+		script := "#!/bin/sh\necho 'ClamAV 1.0.7/27470/" + updated.Format(time.ANSIC) + "'\n"
+		if err := os.WriteFile(clamdscan, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return NewClamAVDriver(config.DriverConfig{
+			Engine:          config.EngineClamAV,
+			RTSLogPath:      rtsLog,
+			ScanBinaryPath:  clamdscan,
+			Timeout:         5000,
+			SignatureMaxAge: maxAge,
+		}, testLogger(), nil)
+	}
+
+	health, _ := newDriver(time.Now().Add(-2*time.Hour), 24).CheckHealth()
+	if !health.Healthy || health.Signatures == nil || *health.Signatures.AgeSeconds < 7000 {
+		t.Errorf("expected fresh signatures to be healthy, got %+v (%+v)", health, health.Signatures)
+	}
+
+	health, _ = newDriver(time.Now().Add(-48*time.Hour), 24).CheckHealth()
+	if health.Healthy || health.Error != "signatures are 48 hours old" {
+		t.Errorf("expected stale signatures to be unhealthy, got %+v", health)
+	}
+
+	health, _ = newDriver(time.Now().Add(-72*time.Hour), 0).CheckHealth()
+	if !health.Healthy {
+		t.Errorf("expected no age limit without CLAMAV_SIGNATURE_MAX_AGE_HOURS, got %+v", health)
+	}
+
+	driver := NewClamAVDriver(config.DriverConfig{RTSLogPath: rtsLog, ScanBinaryPath: filepath.Join(dir, "missing")}, testLogger(), nil)
+	if health, _ := driver.CheckHealth(); health.Healthy {
+		t.Error("expected unhealthy when clamdscan cannot run")
+	}
+}
@@ -0,0 +1,41 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestClamAVDriver_StreamScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as scan binary")
+	}
+	// Streams are sent without --fdpass, and flagged when stdin has EICAR
+	scanBinary := filepath.Join(t.TempDir(), "clamdscan")
+	script := `#!/bin/sh
+[ "$*" = "--stdout --no-summary -" ] || { echo "unexpected args: $*" >&2; exit 2; }
+if grep -q EICAR-STANDARD; then echo "stream: Eicar-Signature FOUND"; exit 1; fi
+echo "stream: OK"
+`
+	if err := os.WriteFile(scanBinary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := NewClamAVDriver(config.DriverConfig{ScanBinaryPath: scanBinary, Timeout: 5000}, testLogger(), nil)
+
+	result, err := d.StreamScan(strings.NewReader(EICARPattern()), "upload-1", ScanOptions{})
+	if err != nil {
+		t.Fatalf("StreamScan failed: %v", err)
+	}
+	if result.Status != StatusInfected || result.Signature != "Eicar-Signature" || result.FileID != "upload-1" {
+		t.Errorf("expected an infected result, got %+v", result)
+	}
+
+	result, err = d.StreamScan(strings.NewReader("hello"), "upload-2", ScanOptions{})
+	if err != nil || result.Status != StatusClean {
+		t.Errorf("expected a clean result, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,37 @@
+package drivers
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// WatchPaths reads the OnAccessIncludePath and OnAccessExcludePath entries
+// of clamd.conf. Without a configured path nothing is reported.
+func (d *ClamAVDriver) WatchPaths() (include, exclude []string, err error) {
+	if d.config.WatchConfigPath == "" {
+		return nil, nil, nil
+	}
+	file, err := os.Open(d.config.WatchConfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch key {
+		case "OnAccessIncludePath":
+			include = append(include, value)
+		case "OnAccessExcludePath":
+			exclude = append(exclude, value)
+		}
+	}
+	return include, exclude, scanner.Err()
+}
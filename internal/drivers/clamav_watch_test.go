@@ -0,0 +1,37 @@
+package drivers
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestClamAVDriver_WatchPaths(t *testing.T) {
+	confPath := filepath.Join(t.TempDir(), "clamd.conf")
+	os.WriteFile(confPath, []byte(`# on-access
+LocalSocket /run/clamav/clamd.ctl
+OnAccessIncludePath /tmp/av-scanner
+OnAccessIncludePath "/srv/uploads"
+#OnAccessIncludePath /home
+OnAccessExcludePath /tmp/av-scanner/cache
+`), 0644)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	d := NewClamAVDriver(config.DriverConfig{Engine: config.EngineClamAV, WatchConfigPath: confPath}, logger, nil)
+
+	include, exclude, err := d.WatchPaths()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(include, []string{"/tmp/av-scanner", "/srv/uploads"}) {
+		t.Errorf("unexpected include paths: %v", include)
+	}
+	if !reflect.DeepEqual(exclude, []string{"/tmp/av-scanner/cache"}) {
+		t.Errorf("unexpected exclude paths: %v", exclude)
+	}
+}
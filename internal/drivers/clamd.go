@@ -0,0 +1,247 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// clamdChunkSize is the INSTREAM chunk size; clamd's default StreamMaxLength
+// is far larger, so it only bounds the copy buffer
+const clamdChunkSize = 64 * 1024
+
+// ClamdDriver scans by talking to clamd over its socket (CLAMAV_CLAMD_ADDRESS)
+// instead of running clamdscan, which saves a process per scan and reaches a
+// clamd on another host. Files are streamed with INSTREAM unless
+// CLAMAV_CLAMD_PATH_SCAN lets clamd open them itself with SCAN. The RTS log
+// watcher is the ClamAV driver's, for a local clamonacc.
+type ClamdDriver struct {
+	*ClamAVDriver
+	network string // "tcp" or "unix"
+	address string
+}
+
+// NewClamdDriver returns a driver for the clamd at cfg.ClamdAddress,
+// tcp://host:port or unix:///path/to/clamd.ctl
+func NewClamdDriver(cfg config.DriverConfig, logger *slog.Logger, detectionCache *cache.DetectionCache) *ClamdDriver {
+	network, address, _ := config.ParseClamdAddress(cfg.ClamdAddress)
+	d := &ClamdDriver{
+		ClamAVDriver: NewClamAVDriver(cfg, logger, detectionCache),
+		network:      network,
+		address:      address,
+	}
+	d.logger = logger.With("driver", "clamd")
+	return d
+}
+
+func (d *ClamdDriver) ManualScan(filePath string, opts ScanOptions) (*ScanResult, error) {
+	if d.config.ClamdPathScan {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return nil, err
+		}
+		// ALLMATCHSCAN reports every signature, like clamdscan --allmatch
+		command := "SCAN " + absPath
+		if opts.Deep {
+			command = "ALLMATCHSCAN " + absPath
+		}
+		return d.scan(command, nil, filePath, filepath.Base(filePath))
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return d.scan("INSTREAM", file, filePath, filepath.Base(filePath))
+}
+
+// StreamScan sends content from r to clamd with INSTREAM. clamd has no
+// all-match variant of INSTREAM, so Deep is ignored, as are Flags, which are
+// clamdscan arguments.
+func (d *ClamdDriver) StreamScan(r io.Reader, fileID string, opts ScanOptions) (*ScanResult, error) {
+	return d.scan("INSTREAM", r, "-", fileID)
+}
+
+// scan runs one scan command, streaming body for INSTREAM, and reads the
+// verdict. filePath names the scanned file in fixtures, "-" for streams.
+func (d *ClamdDriver) scan(command string, body io.Reader, filePath, fileID string) (*ScanResult, error) {
+	startTime := time.Now()
+	replies, err := d.command(command, body)
+	if err != nil {
+		return nil, err
+	}
+	d.logger.Debug("Manual scan completed", "command", strings.Fields(command)[0], "replies", replies)
+
+	status, signature := StatusClean, ""
+	for _, reply := range replies {
+		switch {
+		case strings.HasSuffix(reply, " FOUND"):
+			if status != StatusInfected {
+				if matches := clamavFoundRegex.FindStringSubmatch(reply); matches != nil {
+					signature = matches[2]
+				}
+			}
+			status = StatusInfected
+		case strings.HasSuffix(reply, " ERROR"):
+			if status == StatusClean {
+				status = StatusError
+			}
+		case !strings.HasSuffix(reply, " OK"):
+			return nil, fmt.Errorf("unexpected clamd reply: %q", reply)
+		}
+	}
+
+	if d.config.FixtureRecordDir != "" && filePath != "-" {
+		d.recordReplies(filePath, replies, status)
+	}
+
+	return &ScanResult{
+		Status:        status,
+		ErrorCategory: errorCategory(status, replies...),
+		Engine:        d.Engine(),
+		Signature:     signature,
+		Phase:         PhaseManual,
+		FilePath:      filePath,
+		FileID:        fileID,
+		Timestamp:     time.Now(),
+		Duration:      time.Since(startTime).Milliseconds(),
+		Raw:           map[string]interface{}{"replies": replies},
+	}, nil
+}
+
+// recordReplies records a scan as the fixture clamdscan would have produced:
+// the same lines, named after the file, and its exit code
+func (d *ClamdDriver) recordReplies(filePath string, replies []string, status ScanStatus) {
+	lines := make([]string, len(replies))
+	for i, reply := range replies {
+		if _, verdict, ok := strings.Cut(reply, ": "); ok {
+			reply = filePath + ": " + verdict
+		}
+		lines[i] = reply
+	}
+	exitCode := 0
+	switch status {
+	case StatusInfected:
+		exitCode = 1
+	case StatusError:
+		exitCode = 2
+	}
+	d.recordFixture(filePath, strings.Join(lines, "\n"), "", exitCode)
+}
+
+// command sends one null-terminated command ("zSCAN /path") and returns
+// clamd's replies. clamd answers and closes the connection; each reply is
+// null-terminated.
+func (d *ClamdDriver) command(command string, body io.Reader) ([]string, error) {
+	timeout := time.Duration(d.config.Timeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(d.ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, d.network, d.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, "z"+command+"\x00"); err != nil {
+		return nil, fmt.Errorf("failed to send clamd command: %w", err)
+	}
+	if body != nil {
+		if err := writeChunks(conn, body); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, context.DeadlineExceeded
+		}
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	var replies []string
+	for _, reply := range bytes.Split(data, []byte{0}) {
+		if reply := strings.TrimSpace(string(reply)); reply != "" {
+			replies = append(replies, reply)
+		}
+	}
+	if len(replies) == 0 {
+		return nil, errors.New("clamd closed the connection without a reply")
+	}
+	return replies, nil
+}
+
+// writeChunks sends r as INSTREAM chunks, each prefixed with its length as a
+// 4-byte big-endian integer, ending with an empty chunk
+func writeChunks(conn net.Conn, r io.Reader) error {
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd stops reading past StreamMaxLength; its reply says so
+				return nil
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			conn.Write([]byte{0, 0, 0, 0})
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read scan content: %w", err)
+		}
+	}
+}
+
+// CheckHealth pings clamd and reports its version
+// Reload asks clamd to load the signatures freshclam wrote
+func (d *ClamdDriver) Reload() error {
+	replies, err := d.command("RELOAD", nil)
+	if err != nil {
+		return err
+	}
+	if replies[0] != "RELOADING" {
+		return fmt.Errorf("unexpected RELOAD reply: %q", replies[0])
+	}
+	return nil
+}
+
+func (d *ClamdDriver) CheckHealth() (*EngineHealth, error) {
+	health := &EngineHealth{
+		Engine:    d.Engine(),
+		LastCheck: time.Now(),
+	}
+	replies, err := d.command("PING", nil)
+	if err == nil && replies[0] != "PONG" {
+		err = fmt.Errorf("unexpected PING reply: %q", replies[0])
+	}
+	if err != nil {
+		health.Error = err.Error()
+		return health, nil
+	}
+	if replies, err := d.command("VERSION", nil); err == nil {
+		health.Version = replies[0]
+	}
+	health.Healthy = true
+	checkSignatures(d.config, health)
+	return health, nil
+}
@@ -0,0 +1,140 @@
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// fakeClamd answers one null-terminated command per connection like clamd,
+// flagging content with the EICAR pattern
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	verdict := func(name string, content []byte) string {
+		if bytes.Contains(content, []byte("EICAR-STANDARD")) {
+			return name + ": Eicar-Signature FOUND\x00"
+		}
+		return name + ": OK\x00"
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				command = strings.TrimSuffix(strings.TrimPrefix(command, "z"), "\x00")
+				name, path, _ := strings.Cut(command, " ")
+				switch name {
+				case "PING":
+					io.WriteString(conn, "PONG\x00")
+				case "RELOAD":
+					io.WriteString(conn, "RELOADING\x00")
+				case "VERSION":
+					io.WriteString(conn, "ClamAV 1.4.1/27400/Thu Oct 15 08:00:00 2026\x00")
+				case "INSTREAM":
+					var content []byte
+					for {
+						var size uint32
+						if binary.Read(r, binary.BigEndian, &size) != nil {
+							return
+						}
+						if size == 0 {
+							break
+						}
+						chunk := make([]byte, size)
+						if _, err := io.ReadFull(r, chunk); err != nil {
+							return
+						}
+						content = append(content, chunk...)
+					}
+					io.WriteString(conn, verdict("stream", content))
+				case "SCAN", "ALLMATCHSCAN":
+					content, err := os.ReadFile(path)
+					if err != nil {
+						io.WriteString(conn, path+": lstat() failed: No such file or directory. ERROR\x00")
+						return
+					}
+					io.WriteString(conn, verdict(path, content))
+				default:
+					io.WriteString(conn, "UNKNOWN COMMAND\x00")
+				}
+			}()
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func TestClamdDriver(t *testing.T) {
+	dir := t.TempDir()
+	infected := filepath.Join(dir, "eicar.com")
+	os.WriteFile(infected, []byte(EICARPattern()), 0644)
+	clean := filepath.Join(dir, "clean.txt")
+	os.WriteFile(clean, bytes.Repeat([]byte("a"), 3*clamdChunkSize+1), 0644)
+
+	cfg := config.DriverConfig{Engine: config.EngineClamAV, ClamdAddress: fakeClamd(t), Timeout: 5000}
+	for _, pathScan := range []bool{false, true} {
+		cfg.ClamdPathScan = pathScan
+		d := NewClamdDriver(cfg, testLogger(), nil)
+
+		result, err := d.ManualScan(infected, ScanOptions{Deep: true})
+		if err != nil || result.Status != StatusInfected || result.Signature != "Eicar-Signature" {
+			t.Errorf("path scan %v: expected an infected result, got %+v (%v)", pathScan, result, err)
+		}
+		result, err = d.ManualScan(clean, ScanOptions{})
+		if err != nil || result.Status != StatusClean {
+			t.Errorf("path scan %v: expected a clean result, got %+v (%v)", pathScan, result, err)
+		}
+	}
+
+	// Without the file, SCAN reports a clamd error; INSTREAM fails to open it
+	missing := filepath.Join(dir, "missing")
+	if result, err := NewClamdDriver(cfg, testLogger(), nil).ManualScan(missing, ScanOptions{}); err != nil || result.Status != StatusError {
+		t.Errorf("expected an error verdict, got %+v (%v)", result, err)
+	}
+	cfg.ClamdPathScan = false
+	d := NewClamdDriver(cfg, testLogger(), nil)
+	if _, err := d.ManualScan(missing, ScanOptions{}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	result, err := d.StreamScan(strings.NewReader(EICARPattern()), "upload-1", ScanOptions{})
+	if err != nil || result.Status != StatusInfected || result.FileID != "upload-1" {
+		t.Errorf("expected an infected stream, got %+v (%v)", result, err)
+	}
+
+	health, _ := d.CheckHealth()
+	if !health.Healthy || !strings.HasPrefix(health.Version, "ClamAV 1.4.1/") {
+		t.Errorf("expected a healthy clamd with its version, got %+v", health)
+	}
+	if health.Signatures == nil || health.Signatures.Version != "27400" || health.Signatures.AgeSeconds == nil {
+		t.Errorf("expected the loaded signatures to be reported, got %+v", health.Signatures)
+	}
+	if err := d.Reload(); err != nil {
+		t.Errorf("expected clamd to reload, got %v", err)
+	}
+	cfg.ClamdAddress = "unix://" + filepath.Join(dir, "no-such.sock")
+	if health, _ := NewClamdDriver(cfg, testLogger(), nil).CheckHealth(); health.Healthy || health.Error == "" {
+		t.Errorf("expected an unreachable clamd to be unhealthy, got %+v", health)
+	}
+}
@@ -0,0 +1,224 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+var (
+	// MpCmdRun output patterns
+	// Sample: Scanning C:\av-scanner\eicar.com found 1 threats.
+	defenderFoundRegex = regexp.MustCompile(`(?m)^Scanning .* found (no|\d+) threats?\.`)
+	// Sample: Threat                  : Virus:DOS/EICAR_Test_File
+	defenderThreatRegex = regexp.MustCompile(`(?m)^Threat\s+:\s*(\S.*?)\s*$`)
+	// Sample: CmdTool: Failed with hr = 0x80508023. Check C:\...\MpCmdRun.log for more information
+	defenderFailedRegex = regexp.MustCompile(`(?m)^CmdTool: Failed with hr = (0x[0-9A-Fa-f]+)`)
+)
+
+// defenderStatusScript reads Defender's state for health checks
+const defenderStatusScript = "Get-MpComputerStatus | Select-Object AMServiceEnabled,AntivirusEnabled,AMProductVersion,AntivirusSignatureVersion | ConvertTo-Json"
+
+// DefenderDriver scans with Microsoft Defender's MpCmdRun.exe on Windows
+// nodes. Scans run with -DisableRemediation so the file is reported rather
+// than quarantined. Defender's real-time protection reports detections to the
+// Windows event log, which is not read, so there is no RTS phase: UPLOAD_DIR
+// should be excluded from real-time protection, or uploads are removed before
+// the manual scan sees them.
+type DefenderDriver struct {
+	config config.DriverConfig
+	logger *slog.Logger
+	cache  *cache.DetectionCache
+}
+
+func NewDefenderDriver(cfg config.DriverConfig, logger *slog.Logger, detectionCache *cache.DetectionCache) *DefenderDriver {
+	return &DefenderDriver{
+		config: cfg,
+		logger: logger.With("driver", "defender"),
+		cache:  detectionCache,
+	}
+}
+
+func (d *DefenderDriver) Engine() config.EngineType {
+	return config.EngineDefender
+}
+
+func (d *DefenderDriver) Config() config.DriverConfig {
+	return d.config
+}
+
+// Start does nothing; there is no RTS log to watch
+func (d *DefenderDriver) Start() error {
+	return nil
+}
+
+func (d *DefenderDriver) Stop() {
+}
+
+// RTSWatch is not supported: real-time detections are not reported
+func (d *DefenderDriver) RTSWatch(filePath string, opts WatchOptions) (*ScanResult, error) {
+	return nil, errors.New("defender does not report real-time detections")
+}
+
+func (d *DefenderDriver) ManualScan(filePath string, opts ScanOptions) (*ScanResult, error) {
+	startTime := time.Now()
+	fileID := filepath.Base(filePath)
+
+	// MpCmdRun needs an absolute path
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// MpCmdRun.exe -Scan -ScanType 3 -File <file> -DisableRemediation
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
+	defer cancel()
+
+	args := append([]string{"-Scan", "-ScanType", "3", "-File", absPath, "-DisableRemediation"}, opts.Flags...)
+	cmd := exec.CommandContext(ctx, d.config.ScanBinaryPath, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if ctx.Err() == context.DeadlineExceeded {
+			return nil, ctx.Err()
+		} else {
+			return nil, err
+		}
+	}
+
+	output := stdout.String()
+	d.logger.Debug("Manual scan completed", "exitCode", exitCode, "output", output)
+
+	if d.config.FixtureRecordDir != "" {
+		fixture := NewFixture(d.Engine(), absPath, output, stderr.String(), exitCode)
+		if err := WriteFixture(d.config.FixtureRecordDir, fixture); err != nil {
+			d.logger.Warn("Failed to record fixture", "error", err)
+		}
+	}
+
+	status, signature := d.parseManualScanOutput(output, exitCode)
+	usage := processUsage(cmd.ProcessState)
+
+	return &ScanResult{
+		Status:    status,
+		Engine:    d.Engine(),
+		Signature: signature,
+		Phase:     PhaseManual,
+		FilePath:  filePath,
+		FileID:    fileID,
+		Timestamp: time.Now(),
+		Duration:  time.Since(startTime).Milliseconds(),
+		Usage:     usage,
+		Raw: map[string]interface{}{
+			"exitCode": exitCode,
+			"stdout":   output,
+			"stderr":   stderr.String(),
+			"usage":    usage,
+		},
+		ErrorCategory: errorCategory(status, output, stderr.String()),
+	}, nil
+}
+
+// parseManualScanOutput reads MpCmdRun's summary line. Its exit code is 2
+// both for threats and for failures, so it only confirms a clean scan.
+func (d *DefenderDriver) parseManualScanOutput(output string, exitCode int) (ScanStatus, string) {
+	if matches := defenderFailedRegex.FindStringSubmatch(output); matches != nil {
+		d.logger.Warn("MpCmdRun failed", "hr", matches[1])
+		return StatusError, ""
+	}
+	matches := defenderFoundRegex.FindStringSubmatch(output)
+	switch {
+	case matches == nil:
+		return StatusError, ""
+	case matches[1] == "no":
+		if exitCode != 0 {
+			return StatusError, ""
+		}
+		return StatusClean, ""
+	}
+	signature := ""
+	if threat := defenderThreatRegex.FindStringSubmatch(output); threat != nil {
+		signature = threat[1]
+	}
+	return StatusInfected, signature
+}
+
+// processLogLine is a no-op: Defender has no RTS log. It lets recorded
+// fixtures be replayed.
+func (d *DefenderDriver) processLogLine(line string) {
+}
+
+// CheckHealth asks PowerShell's Get-MpComputerStatus whether the antimalware
+// service and antivirus are enabled, and reports the product and signature
+// versions. Without DEFENDER_STATUS_BINARY only the scan binary is checked.
+func (d *DefenderDriver) CheckHealth() (*EngineHealth, error) {
+	health := &EngineHealth{
+		Engine:    d.Engine(),
+		LastCheck: time.Now(),
+	}
+
+	if _, err := os.Stat(d.config.ScanBinaryPath); err != nil {
+		health.Error = "scan binary not accessible: " + d.config.ScanBinaryPath
+		return health, nil
+	}
+	if d.config.StatusQueryPath == "" {
+		health.Healthy = true
+		return health, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, d.config.StatusQueryPath, "-NoProfile", "-NonInteractive", "-Command", defenderStatusScript).Output()
+	if err != nil {
+		health.Error = fmt.Sprintf("status query failed: %v", err)
+		return health, nil
+	}
+	var status struct {
+		AMServiceEnabled          bool
+		AntivirusEnabled          bool
+		AMProductVersion          string
+		AntivirusSignatureVersion string
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(out), &status); err != nil {
+		health.Error = fmt.Sprintf("unexpected status output: %v", err)
+		return health, nil
+	}
+
+	health.Version = strings.Trim(status.AMProductVersion+"/"+status.AntivirusSignatureVersion, "/")
+	switch {
+	case !status.AMServiceEnabled:
+		health.Error = "antimalware service is disabled"
+	case !status.AntivirusEnabled:
+		health.Error = "antivirus is disabled"
+	default:
+		health.Healthy = true
+	}
+	return health, nil
+}
+
+func (d *DefenderDriver) GetInfo() EngineInfo {
+	return EngineInfo{
+		Engine:              d.Engine(),
+		Available:           true,
+		RTSEnabled:          false,
+		ManualScanAvailable: true,
+	}
+}
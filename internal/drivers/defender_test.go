@@ -0,0 +1,49 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestDefenderDriver_CheckHealth(t *testing.T) {
+	dir := t.TempDir()
+	scanBinary := filepath.Join(dir, "MpCmdRun.exe")
+	if err := os.WriteFile(scanBinary, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	newDriver := func(name, status string) *DefenderDriver {
+		query := filepath.Join(dir, name)
+		script := "#!/bin/sh\ncat <<'EOF'\n" + status + "\nEOF\n"
+		if err := os.WriteFile(query, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return NewDefenderDriver(config.DriverConfig{
+			Engine:          config.EngineDefender,
+			ScanBinaryPath:  scanBinary,
+			StatusQueryPath: query,
+			Timeout:         5000,
+		}, testLogger(), nil)
+	}
+
+	health, _ := newDriver("enabled", `{"AMServiceEnabled":true,"AntivirusEnabled":true,"AMProductVersion":"4.18.24090.11","AntivirusSignatureVersion":"1.419.123.0"}`).CheckHealth()
+	if !health.Healthy || health.Version != "4.18.24090.11/1.419.123.0" {
+		t.Errorf("expected healthy with versions, got %+v", health)
+	}
+
+	health, _ = newDriver("disabled", `{"AMServiceEnabled":true,"AntivirusEnabled":false}`).CheckHealth()
+	if health.Healthy || health.Error != "antivirus is disabled" {
+		t.Errorf("expected unhealthy with antivirus disabled, got %+v", health)
+	}
+
+	driver := NewDefenderDriver(config.DriverConfig{ScanBinaryPath: filepath.Join(dir, "missing")}, testLogger(), nil)
+	if health, _ := driver.CheckHealth(); health.Healthy {
+		t.Error("expected unhealthy without a scan binary")
+	}
+	if _, err := driver.RTSWatch(scanBinary, WatchOptions{}); err == nil {
+		t.Error("expected RTSWatch to be unsupported")
+	}
+}
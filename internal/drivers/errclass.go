@@ -0,0 +1,78 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// ErrorCategory says why an engine failed to scan a file, so dashboards can
+// tell a starved engine from an offline one
+type ErrorCategory string
+
+const (
+	ErrorOutOfMemory   ErrorCategory = "out_of_memory"
+	ErrorEngineOffline ErrorCategory = "engine_offline"
+	ErrorUnreachable   ErrorCategory = "unreachable"
+	ErrorTimeout       ErrorCategory = "timeout"
+	ErrorPermission    ErrorCategory = "permission_denied"
+	ErrorLimitExceeded ErrorCategory = "limit_exceeded"
+	ErrorDefinitions   ErrorCategory = "definitions"
+	ErrorSkipped       ErrorCategory = "skipped"
+	ErrorFileMissing   ErrorCategory = "file_missing"
+	ErrorUnknown       ErrorCategory = "unknown"
+)
+
+// errorPatterns match engine error output, most specific first: "Could not
+// connect to clamd ...: No such file or directory" is unreachable, not a
+// missing upload
+var errorPatterns = []struct {
+	category ErrorCategory
+	pattern  *regexp.Regexp
+}{
+	// clamd: "Can't allocate memory", MpCmdRun: hr = 0x8007000E
+	{ErrorOutOfMemory, regexp.MustCompile(`(?i)can't allocate memory|cannot allocate memory|out of memory|0x8007000e`)},
+	// dsa_scan: "scan engine offline", MpCmdRun: hr = 0x800106BA (service not running)
+	{ErrorEngineOffline, regexp.MustCompile(`(?i)scan engine (is )?offline|engine (is )?not (ready|running)|0x800106ba`)},
+	{ErrorUnreachable, regexp.MustCompile(`(?i)could not connect|failed to connect|connection refused|connection reset`)},
+	{ErrorTimeout, regexp.MustCompile(`(?i)timed? ?out|deadline exceeded`)},
+	{ErrorPermission, regexp.MustCompile(`(?i)permission denied|access (is )?denied|0x80070005`)},
+	// clamd: "INSTREAM size limit exceeded", "Heuristics.Limits.Exceeded"
+	{ErrorLimitExceeded, regexp.MustCompile(`(?i)size limit exceeded|limits\.exceeded`)},
+	{ErrorDefinitions, regexp.MustCompile(`(?i)no supported database|database (load|initiali[sz]ation) (error|failed)|malformed database|pattern file`)},
+	// dsa_scan --json reports a file it declined to scan
+	{ErrorSkipped, regexp.MustCompile(`"numOfFileSkipped":\s*[1-9]`)},
+	// clamdscan: "File path check failure", savscan: "Could not open",
+	// MpCmdRun: hr = 0x80508023
+	{ErrorFileMissing, regexp.MustCompile(`(?i)no such file or directory|file path check failure|could not open|0x80508023`)},
+}
+
+// ClassifyError maps engine error output to an ErrorCategory, ErrorUnknown
+// when no known message appears in it
+func ClassifyError(outputs ...string) ErrorCategory {
+	for _, p := range errorPatterns {
+		for _, output := range outputs {
+			if p.pattern.MatchString(output) {
+				return p.category
+			}
+		}
+	}
+	return ErrorUnknown
+}
+
+// ClassifyErr maps an error returned by a driver to an ErrorCategory
+func ClassifyErr(err error) ErrorCategory {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	return ClassifyError(err.Error())
+}
+
+// errorCategory classifies the output of a scan that ended with status, or
+// returns "" when it did not fail
+func errorCategory(status ScanStatus, outputs ...string) ErrorCategory {
+	if status != StatusError {
+		return ""
+	}
+	return ClassifyError(outputs...)
+}
@@ -0,0 +1,36 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected ErrorCategory
+	}{
+		{"/tmp/av-scanner/a.bin: Can't allocate memory ERROR", ErrorOutOfMemory},
+		{"dsa_scan: scan engine offline", ErrorEngineOffline},
+		{"ERROR: Could not connect to clamd on LocalSocket /var/run/clamav/clamd.ctl: No such file or directory", ErrorUnreachable},
+		{"stream: INSTREAM size limit exceeded. ERROR", ErrorLimitExceeded},
+		{"ERROR: Can't open file /tmp/a.bin: Permission denied", ErrorPermission},
+		{"LibClamAV Error: cli_loaddbdir(): No supported database files found in /var/lib/clamav", ErrorDefinitions},
+		{"CmdTool: Failed with hr = 0x800106BA. Check MpCmdRun.log", ErrorEngineOffline},
+		{"/tmp/a.bin: File path check failure: No such file or directory. ERROR", ErrorFileMissing},
+		{"something unexpected", ErrorUnknown},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.output); got != tt.expected {
+			t.Errorf("ClassifyError(%q) = %s, expected %s", tt.output, got, tt.expected)
+		}
+	}
+
+	if got := ClassifyErr(fmt.Errorf("scan: %w", context.DeadlineExceeded)); got != ErrorTimeout {
+		t.Errorf("expected a deadline to classify as timeout, got %s", got)
+	}
+	if got := errorCategory(StatusClean, "Can't allocate memory"); got != "" {
+		t.Errorf("expected no category for a clean scan, got %s", got)
+	}
+}
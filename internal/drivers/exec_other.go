@@ -0,0 +1,9 @@
+//go:build !windows
+
+package drivers
+
+import "os"
+
+func isExecutable(info os.FileInfo) bool {
+	return info.Mode()&0111 != 0
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isExecutable reports whether Windows would run the file, which it decides
+// by extension rather than permission bits
+func isExecutable(info os.FileInfo) bool {
+	switch strings.ToLower(filepath.Ext(info.Name())) {
+	case ".exe", ".com", ".bat", ".cmd":
+		return true
+	}
+	return false
+}
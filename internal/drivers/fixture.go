@@ -0,0 +1,112 @@
+package drivers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FixturePathPlaceholder stands in for the scanned file path in recorded
+// engine output, so fixtures can be replayed against any upload path.
+const FixturePathPlaceholder = "{{path}}"
+
+// Fixture captures the raw output of a single engine invocation together with
+// the RTS log lines it produced, so parsers can be regression-tested against
+// real-world output from different engine versions.
+type Fixture struct {
+	Name          string              `yaml:"name"`
+	Engine        config.EngineType   `yaml:"engine"`
+	EngineVersion string              `yaml:"engineVersion,omitempty"`
+	RecordedAt    time.Time           `yaml:"recordedAt,omitempty"`
+	Manual        FixtureOutput       `yaml:"manual"`
+	RTSLog        []string            `yaml:"rtsLog,omitempty"`
+	Expect        *FixtureExpectation `yaml:"expect,omitempty"`
+}
+
+// FixtureOutput is the captured output of an on-demand scan binary
+type FixtureOutput struct {
+	Stdout   string `yaml:"stdout"`
+	Stderr   string `yaml:"stderr,omitempty"`
+	ExitCode int    `yaml:"exitCode"`
+}
+
+// FixtureExpectation is the verdict a fixture is expected to parse into
+type FixtureExpectation struct {
+	Status       ScanStatus `yaml:"status"`
+	Signature    string     `yaml:"signature,omitempty"`
+	RTSSignature string     `yaml:"rtsSignature,omitempty"`
+
+	ErrorCategory ErrorCategory `yaml:"errorCategory,omitempty"`
+}
+
+// NewFixture builds a fixture from a manual scan, replacing the scanned path
+// with FixturePathPlaceholder.
+func NewFixture(engine config.EngineType, filePath, stdout, stderr string, exitCode int) *Fixture {
+	name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	return &Fixture{
+		Name:       name,
+		Engine:     engine,
+		RecordedAt: time.Now().UTC(),
+		Manual: FixtureOutput{
+			Stdout:   strings.ReplaceAll(stdout, filePath, FixturePathPlaceholder),
+			Stderr:   strings.ReplaceAll(stderr, filePath, FixturePathPlaceholder),
+			ExitCode: exitCode,
+		},
+	}
+}
+
+// WriteFixture writes a fixture to dir as <engine>-<name>.yaml
+func WriteFixture(dir string, fixture *Fixture) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(fixture)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.yaml", fixture.Engine, fixture.Name))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
+
+// LoadFixtures reads all *.yaml fixtures from dir, sorted by file name
+func LoadFixtures(dir string) ([]*Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	fixtures := make([]*Fixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %w", path, err)
+		}
+
+		var fixture Fixture
+		if err := yaml.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+		}
+		if fixture.Name == "" {
+			return nil, fmt.Errorf("fixture %s has no name", path)
+		}
+		fixtures = append(fixtures, &fixture)
+	}
+	return fixtures, nil
+}
+
+// expand substitutes the placeholder with the given path
+func (f *Fixture) expand(s, filePath string) string {
+	return strings.ReplaceAll(s, FixturePathPlaceholder, filePath)
+}
@@ -1,6 +1,7 @@
 package drivers
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -51,19 +52,30 @@ func (d *MockDriver) RTSWatch(filePath string, opts WatchOptions) (*ScanResult,
 	return d.scan(filePath, PhaseRTS)
 }
 
-func (d *MockDriver) ManualScan(filePath string) (*ScanResult, error) {
+func (d *MockDriver) ManualScan(filePath string, opts ScanOptions) (*ScanResult, error) {
 	return d.scan(filePath, PhaseManual)
 }
 
-func (d *MockDriver) scan(filePath string, phase ScanPhase) (*ScanResult, error) {
+// StreamScan scans content read from r
+func (d *MockDriver) StreamScan(r io.Reader, fileID string, opts ScanOptions) (*ScanResult, error) {
 	startTime := time.Now()
-	fileID := filepath.Base(filePath)
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.result(content, "", fileID, PhaseManual, startTime), nil
+}
 
+func (d *MockDriver) scan(filePath string, phase ScanPhase) (*ScanResult, error) {
+	startTime := time.Now()
 	content, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
+	return d.result(content, filePath, filepath.Base(filePath), phase, startTime), nil
+}
 
+func (d *MockDriver) result(content []byte, filePath, fileID string, phase ScanPhase, startTime time.Time) *ScanResult {
 	result := &ScanResult{
 		Status:    StatusClean,
 		Engine:    config.EngineMock,
@@ -78,8 +90,7 @@ func (d *MockDriver) scan(filePath string, phase ScanPhase) (*ScanResult, error)
 		result.Status = StatusInfected
 		result.Signature = EICARSignature
 	}
-
-	return result, nil
+	return result
 }
 
 func (d *MockDriver) CheckHealth() (*EngineHealth, error) {
@@ -0,0 +1,50 @@
+package drivers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// unameArch maps GOARCH to the machine names agents use in install paths
+var unameArch = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+// ExpandArch replaces {arch} (GOARCH, e.g. arm64) and {uname_arch} (e.g.
+// aarch64) in a candidate path with the running architecture
+func ExpandArch(path string) string {
+	uname := unameArch[runtime.GOARCH]
+	if uname == "" {
+		uname = runtime.GOARCH
+	}
+	return strings.NewReplacer("{arch}", runtime.GOARCH, "{uname_arch}", uname).Replace(path)
+}
+
+// ResolveBinary returns the first candidate that exists and is executable, so
+// one image works on hosts with differently located agent binaries. A
+// candidate containing * is globbed and its matches tried in reverse order,
+// so the newest of several versioned install directories wins.
+func ResolveBinary(candidates []string) (string, error) {
+	var tried []string
+	for _, candidate := range candidates {
+		path := ExpandArch(candidate)
+		paths := []string{path}
+		if strings.Contains(path, "*") {
+			paths, _ = filepath.Glob(path)
+			slices.Sort(paths)
+			slices.Reverse(paths)
+		}
+		for _, p := range paths {
+			if info, err := os.Stat(p); err == nil && !info.IsDir() && isExecutable(info) {
+				return p, nil
+			}
+		}
+		tried = append(tried, path)
+	}
+	return "", fmt.Errorf("no executable found at %s", strings.Join(tried, ", "))
+}
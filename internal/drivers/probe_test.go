@@ -0,0 +1,57 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestExpandArch(t *testing.T) {
+	if got := ExpandArch("/opt/agent/{arch}/scan"); got != "/opt/agent/"+runtime.GOARCH+"/scan" {
+		t.Errorf("unexpected expansion: %s", got)
+	}
+	if runtime.GOARCH == "amd64" {
+		if got := ExpandArch("/usr/lib/{uname_arch}-linux-gnu/scan"); got != "/usr/lib/x86_64-linux-gnu/scan" {
+			t.Errorf("unexpected expansion: %s", got)
+		}
+	}
+}
+
+func TestResolveBinary(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "plain")
+	executable := filepath.Join(dir, runtime.GOARCH, "scan")
+	if err := os.WriteFile(notExecutable, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(executable), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(executable, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ResolveBinary([]string{filepath.Join(dir, "missing"), notExecutable, dir, filepath.Join(dir, "{arch}", "scan")})
+	if err != nil || got != executable {
+		t.Errorf("ResolveBinary = %q, %v; expected %q", got, err, executable)
+	}
+
+	newest := filepath.Join(dir, "platform", "4.18.2", "scan")
+	for _, version := range []string{"4.18.1", "4.18.2"} {
+		path := filepath.Join(dir, "platform", version, "scan")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := ResolveBinary([]string{filepath.Join(dir, "platform", "*", "scan")}); err != nil || got != newest {
+		t.Errorf("ResolveBinary = %q, %v; expected the newest match %q", got, err, newest)
+	}
+
+	if _, err := ResolveBinary([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected error when no candidate exists")
+	}
+}
@@ -0,0 +1,179 @@
+package drivers
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// outputParser is implemented by drivers whose engine output can be replayed
+type outputParser interface {
+	parseManualScanOutput(output string, exitCode int) (ScanStatus, string)
+	processLogLine(line string)
+}
+
+// ReplayDriver implements Driver by serving recorded fixtures instead of
+// invoking an engine. Output is run through the real engine's parsers, so it
+// exercises the same code paths as production scans.
+//
+// A fixture is selected by matching its name against the scanned file's base
+// name without extension.
+type ReplayDriver struct {
+	engine   config.EngineType
+	fixtures map[string]*Fixture
+	parser   outputParser
+	cache    *cache.DetectionCache
+	logger   *slog.Logger
+}
+
+func NewReplayDriver(engine config.EngineType, fixtures []*Fixture, logger *slog.Logger, detectionCache *cache.DetectionCache) (*ReplayDriver, error) {
+	cfg := config.DriverConfig{Engine: engine}
+
+	var parser outputParser
+	switch engine {
+	case config.EngineClamAV:
+		parser = NewClamAVDriver(cfg, logger, detectionCache)
+	case config.EngineTrendMicro:
+		parser = NewTrendMicroDriver(cfg, logger, detectionCache)
+	case config.EngineSophos:
+		parser = NewSophosDriver(cfg, logger, detectionCache)
+	case config.EngineDefender:
+		parser = NewDefenderDriver(cfg, logger, detectionCache)
+	default:
+		return nil, fmt.Errorf("replay not supported for engine: %s", engine)
+	}
+
+	byName := make(map[string]*Fixture, len(fixtures))
+	for _, f := range fixtures {
+		if f.Engine != engine {
+			continue
+		}
+		byName[f.Name] = f
+	}
+
+	return &ReplayDriver{
+		engine:   engine,
+		fixtures: byName,
+		parser:   parser,
+		cache:    detectionCache,
+		logger:   logger.With("driver", "replay"),
+	}, nil
+}
+
+func (d *ReplayDriver) Engine() config.EngineType {
+	return d.engine
+}
+
+func (d *ReplayDriver) Config() config.DriverConfig {
+	return config.DriverConfig{Engine: d.engine}
+}
+
+func (d *ReplayDriver) Start() error {
+	return nil
+}
+
+func (d *ReplayDriver) Stop() {
+}
+
+func (d *ReplayDriver) lookup(filePath string) (*Fixture, string, error) {
+	name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	fixture, ok := d.fixtures[name]
+	if !ok {
+		return nil, "", fmt.Errorf("no fixture named %q for engine %s", name, d.engine)
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+
+	// Replay RTS log lines as if the background watcher had seen them
+	for _, line := range fixture.RTSLog {
+		d.parser.processLogLine(fixture.expand(line, absPath))
+	}
+	return fixture, absPath, nil
+}
+
+func (d *ReplayDriver) RTSWatch(filePath string, opts WatchOptions) (*ScanResult, error) {
+	startTime := time.Now()
+
+	_, absPath, err := d.lookup(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{
+		Status:    StatusClean,
+		Engine:    d.engine,
+		Phase:     PhaseRTS,
+		FilePath:  filePath,
+		FileID:    filepath.Base(filePath),
+		Timestamp: time.Now(),
+		Raw:       map[string]bool{"timeout": true},
+	}
+
+	if cached, found := d.cache.Get(absPath); found {
+		if cached.Status == "infected" {
+			result.Status = StatusInfected
+		}
+		result.Signature = cached.Signature
+		result.Raw = map[string]string{"logEntry": cached.Raw}
+	}
+
+	result.Duration = time.Since(startTime).Milliseconds()
+	return result, nil
+}
+
+func (d *ReplayDriver) ManualScan(filePath string, opts ScanOptions) (*ScanResult, error) {
+	startTime := time.Now()
+
+	fixture, absPath, err := d.lookup(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout := fixture.expand(fixture.Manual.Stdout, absPath)
+	stderr := fixture.expand(fixture.Manual.Stderr, absPath)
+	status, signature := d.parser.parseManualScanOutput(stdout, fixture.Manual.ExitCode)
+
+	return &ScanResult{
+		Status:    status,
+		Engine:    d.engine,
+		Signature: signature,
+		Phase:     PhaseManual,
+		FilePath:  filePath,
+		FileID:    filepath.Base(filePath),
+		Timestamp: time.Now(),
+		Duration:  time.Since(startTime).Milliseconds(),
+		Raw: map[string]interface{}{
+			"exitCode": fixture.Manual.ExitCode,
+			"stdout":   stdout,
+			"stderr":   stderr,
+			"fixture":  fixture.Name,
+		},
+		ErrorCategory: errorCategory(status, stdout, stderr),
+	}, nil
+}
+
+func (d *ReplayDriver) CheckHealth() (*EngineHealth, error) {
+	return &EngineHealth{
+		Engine:    d.engine,
+		Healthy:   true,
+		Version:   "replay",
+		LastCheck: time.Now(),
+	}, nil
+}
+
+func (d *ReplayDriver) GetInfo() EngineInfo {
+	return EngineInfo{
+		Engine:              d.engine,
+		Available:           true,
+		RTSEnabled:          true,
+		ManualScanAvailable: true,
+	}
+}
@@ -0,0 +1,145 @@
+package drivers
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+func TestReplayDriver_FixtureCorpus(t *testing.T) {
+	fixtures, err := LoadFixtures(filepath.Join("testdata", "fixtures"))
+	if err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("expected fixtures in testdata/fixtures")
+	}
+
+	for _, f := range fixtures {
+		t.Run(string(f.Engine)+"/"+f.Name, func(t *testing.T) {
+			if f.Expect == nil {
+				t.Skip("fixture has no expectation")
+			}
+
+			c := cache.NewDetectionCache(time.Minute)
+			defer c.Stop()
+
+			d, err := NewReplayDriver(f.Engine, fixtures, testLogger(), c)
+			if err != nil {
+				t.Fatalf("failed to create replay driver: %v", err)
+			}
+
+			filePath := filepath.Join(t.TempDir(), f.Name+".bin")
+			result, err := d.ManualScan(filePath, ScanOptions{})
+			if err != nil {
+				t.Fatalf("manual scan failed: %v", err)
+			}
+			if result.Status != f.Expect.Status {
+				t.Errorf("expected status %s, got %s", f.Expect.Status, result.Status)
+			}
+			if result.Signature != f.Expect.Signature {
+				t.Errorf("expected signature %q, got %q", f.Expect.Signature, result.Signature)
+			}
+			if result.ErrorCategory != f.Expect.ErrorCategory {
+				t.Errorf("expected error category %q, got %q", f.Expect.ErrorCategory, result.ErrorCategory)
+			}
+
+			if f.Expect.RTSSignature != "" {
+				cached, found := c.Peek(filePath)
+				if !found {
+					t.Fatal("expected RTS detection in cache")
+				}
+				if cached.Signature != f.Expect.RTSSignature {
+					t.Errorf("expected RTS signature %q, got %q", f.Expect.RTSSignature, cached.Signature)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayDriver_RTSWatch(t *testing.T) {
+	fixtures := []*Fixture{{
+		Name:   "quarantined",
+		Engine: config.EngineClamAV,
+		RTSLog: []string{FixturePathPlaceholder + ": Win.Test.EICAR_HDB-1 FOUND"},
+	}}
+
+	c := cache.NewDetectionCache(time.Minute)
+	defer c.Stop()
+
+	d, err := NewReplayDriver(config.EngineClamAV, fixtures, testLogger(), c)
+	if err != nil {
+		t.Fatalf("failed to create replay driver: %v", err)
+	}
+
+	result, err := d.RTSWatch("/tmp/av-scanner/quarantined.com", WatchOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("RTS watch failed: %v", err)
+	}
+	if result.Status != StatusInfected {
+		t.Errorf("expected status infected, got %s", result.Status)
+	}
+	if result.Signature != "Win.Test.EICAR_HDB-1" {
+		t.Errorf("expected signature Win.Test.EICAR_HDB-1, got %s", result.Signature)
+	}
+}
+
+func TestReplayDriver_UnknownFixture(t *testing.T) {
+	c := cache.NewDetectionCache(time.Minute)
+	defer c.Stop()
+
+	d, err := NewReplayDriver(config.EngineClamAV, nil, testLogger(), c)
+	if err != nil {
+		t.Fatalf("failed to create replay driver: %v", err)
+	}
+
+	if _, err := d.ManualScan("/tmp/av-scanner/missing.txt", ScanOptions{}); err == nil {
+		t.Error("expected error for missing fixture")
+	}
+}
+
+func TestReplayDriver_UnsupportedEngine(t *testing.T) {
+	c := cache.NewDetectionCache(time.Minute)
+	defer c.Stop()
+
+	if _, err := NewReplayDriver(config.EngineMock, nil, testLogger(), c); err == nil {
+		t.Error("expected error for mock engine")
+	}
+}
+
+func TestFixture_RecordAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	filePath := "/tmp/av-scanner/abc123.exe"
+
+	fixture := NewFixture(config.EngineClamAV, filePath, filePath+": Win.Test.EICAR_HDB-1 FOUND", "", 1)
+	if fixture.Name != "abc123" {
+		t.Errorf("expected name abc123, got %s", fixture.Name)
+	}
+	if fixture.Manual.Stdout != FixturePathPlaceholder+": Win.Test.EICAR_HDB-1 FOUND" {
+		t.Errorf("expected path to be replaced with placeholder, got %q", fixture.Manual.Stdout)
+	}
+
+	if err := WriteFixture(dir, fixture); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	loaded, err := LoadFixtures(dir)
+	if err != nil {
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("expected 1 fixture, got %d", len(loaded))
+	}
+	if loaded[0].Manual.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", loaded[0].Manual.ExitCode)
+	}
+}
@@ -0,0 +1,76 @@
+package drivers
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// maxReplayBytes bounds how much of the end of an RTS log is replayed
+const maxReplayBytes = 16 * 1024 * 1024
+
+// replayRTSLog feeds RTS log lines written within the configured replay
+// window to process, so detections made while the scanner was down (e.g. a
+// pod restart) are still in the detection cache. Lines without a timestamp
+// cannot be dated and are skipped.
+func replayRTSLog(cfg config.DriverConfig, logger *slog.Logger, lineTime func(string) (time.Time, bool), process func(string)) {
+	window := time.Duration(cfg.RTSReplayWindow) * time.Millisecond
+	if window <= 0 {
+		return
+	}
+
+	replayed, err := replayLog(cfg.RTSLogPath, time.Now().Add(-window), lineTime, process)
+	if err != nil {
+		logger.Warn("Failed to replay RTS log history", "path", cfg.RTSLogPath, "error", err)
+		return
+	}
+	logger.Info("Replayed RTS log history", "path", cfg.RTSLogPath, "window", window, "lines", replayed)
+}
+
+// replayLog passes the lines of a log dated at or after since to process, and
+// returns how many there were. Only the last maxReplayBytes are read.
+func replayLog(path string, since time.Time, lineTime func(string) (time.Time, bool), process func(string)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	partial := false
+	if offset := info.Size() - maxReplayBytes; offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		partial = true
+	}
+
+	reader := bufio.NewReader(f)
+	replayed := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return replayed, err
+		}
+		// The first line after a seek is usually cut
+		if partial {
+			partial = false
+		} else if line = strings.TrimRight(line, "\r\n"); line != "" {
+			if t, ok := lineTime(line); ok && !t.Before(since) {
+				process(line)
+				replayed++
+			}
+		}
+		if err == io.EOF {
+			return replayed, nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestReplayRTSLog_ClamAV(t *testing.T) {
+	now := time.Now()
+	stamp := func(ago time.Duration) string { return now.Add(-ago).Format(time.ANSIC) + " -> " }
+	log := strings.Join([]string{
+		stamp(time.Hour) + "/uploads/old.com: Win.Test.EICAR_HDB-1 FOUND",
+		"/uploads/undated.com: Win.Test.EICAR_HDB-1 FOUND",
+		stamp(2*time.Minute) + "/uploads/recent.com: Win.Test.EICAR_HDB-1 FOUND",
+		stamp(time.Minute) + "ClamInotif: watching '/uploads' (and all sub-directories)",
+	}, "\n") + "\n"
+	logPath := filepath.Join(t.TempDir(), "clamonacc.log")
+	if err := os.WriteFile(logPath, []byte(log), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	c := cache.NewDetectionCache(cache.DefaultTTL)
+	defer c.Stop()
+	d := NewClamAVDriver(config.DriverConfig{RTSLogPath: logPath, RTSReplayWindow: 5 * 60 * 1000}, testLogger(), c)
+	replayRTSLog(d.config, d.logger, clamavLineTime, d.processLogLine)
+
+	entries := c.List()
+	if len(entries) != 1 || entries[0].FilePath != "/uploads/recent.com" || entries[0].Signature != "Win.Test.EICAR_HDB-1" {
+		t.Errorf("expected only the recent detection, got %+v", entries)
+	}
+}
+
+func TestReplayRTSLog_TrendMicro(t *testing.T) {
+	now := time.Now()
+	line := func(ago time.Duration, path string) string {
+		return now.Add(-ago).Format("2006-01-02 15:04:05.000000") + ": [ds_am/4] | [SCTRL] (0000-0000-0000, " + path + ") virus found: 2"
+	}
+	log := line(time.Hour, "/uploads/old.com") + "\n" + line(time.Minute, "/uploads/recent.com") + "\n"
+	logPath := filepath.Join(t.TempDir(), "ds_agent.log")
+	if err := os.WriteFile(logPath, []byte(log), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	c := cache.NewDetectionCache(cache.DefaultTTL)
+	defer c.Stop()
+	d := NewTrendMicroDriver(config.DriverConfig{RTSLogPath: logPath, RTSReplayWindow: 5 * 60 * 1000}, testLogger(), c)
+	replayRTSLog(d.config, d.logger, tmLineTime, d.processLogLine)
+
+	if _, found := c.Peek("/uploads/recent.com"); !found || len(c.List()) != 1 {
+		t.Errorf("expected only the recent detection, got %+v", c.List())
+	}
+}
+
+func TestReplayLog_SkipsCutLine(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "rts.log")
+	content := strings.Repeat("x", maxReplayBytes) + "\nlast line\n"
+	if err := os.WriteFile(logPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	var lines []string
+	always := func(string) (time.Time, bool) { return time.Now(), true }
+	replayed, err := replayLog(logPath, time.Now().Add(-time.Minute), always, func(line string) { lines = append(lines, line) })
+	if err != nil || replayed != 1 || lines[0] != "last line" {
+		t.Errorf("expected only the last line, got %d %q (%v)", replayed, lines, err)
+	}
+}
+
+func TestReplayRTSLog_ClamAVRestarts(t *testing.T) {
+	now := time.Now()
+	stamp := func(ago time.Duration) string { return now.Add(-ago).Format(time.ANSIC) + " -> " }
+	log := strings.Join([]string{
+		stamp(4*time.Minute) + "ClamInotif: watching '/uploads' (and all sub-directories)",
+		stamp(4*time.Minute) + "ClamInotif: watching '/tmp/av-scanner' (and all sub-directories)",
+		stamp(time.Minute) + "ClamInotif: watching '/uploads' (and all sub-directories)",
+	}, "\n") + "\n"
+	logPath := filepath.Join(t.TempDir(), "clamonacc.log")
+	if err := os.WriteFile(logPath, []byte(log), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	c := cache.NewDetectionCache(cache.DefaultTTL)
+	defer c.Stop()
+	d := NewClamAVDriver(config.DriverConfig{RTSLogPath: logPath, RTSReplayWindow: 5 * 60 * 1000}, testLogger(), c)
+	var restarts []time.Time
+	d.OnRestart(func(at time.Time) { restarts = append(restarts, at) })
+	replayRTSLog(d.config, d.logger, clamavLineTime, d.processLogLine)
+
+	// One restart per start, however many directories it watches
+	if len(restarts) != 2 || now.Sub(restarts[1]) > 2*time.Minute {
+		t.Errorf("expected two restarts, got %v", restarts)
+	}
+	if len(c.List()) != 0 {
+		t.Errorf("start lines must not be cached as detections: %+v", c.List())
+	}
+}
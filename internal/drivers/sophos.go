@@ -0,0 +1,299 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nxadm/tail"
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+var (
+	// savscan output
+	// Sample: >>> Virus 'EICAR-AV-Test' found in file /tmp/av-scanner/eicar.com
+	sophosFoundRegex = regexp.MustCompile(`(?m)^>>> (?:Virus|Virus fragment|Application) '([^']+)' found in file (.+?)\s*$`)
+	// Sophos on-access (savd) log, as written by savlog
+	// Sample: 20261016 100000	On-access scanner: threat 'EICAR-AV-Test' detected in '/tmp/av-scanner/eicar.com'. Access denied.
+	sophosThreatRegex = regexp.MustCompile(`(?i)on-access.*'([^']+)'.* in (?:file )?'?(/[^']*?)'?(?:\.(?:\s.*)?)?$`)
+	// Matches the timestamp that starts every savd log line
+	sophosLogTimeRegex = regexp.MustCompile(`^(\d{8} \d{6})\s`)
+)
+
+// savscan exit codes; 1 (interrupted) and 2 (error) fail the scan
+const (
+	sophosExitClean    = 0
+	sophosExitInfected = 3
+)
+
+type SophosDriver struct {
+	config config.DriverConfig
+	logger *slog.Logger
+	cache  *cache.DetectionCache
+	ctx    context.Context
+	cancel context.CancelFunc
+	logWatcher
+}
+
+func NewSophosDriver(cfg config.DriverConfig, logger *slog.Logger, detectionCache *cache.DetectionCache) *SophosDriver {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SophosDriver{
+		config: cfg,
+		logger: logger.With("driver", "sophos"),
+		cache:  detectionCache,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start begins the background log watcher
+func (d *SophosDriver) Start() error {
+	if _, err := os.Stat(d.config.RTSLogPath); err != nil {
+		d.logger.Warn("RTS log file not accessible, background watcher not started", "path", d.config.RTSLogPath)
+		return nil
+	}
+
+	replayRTSLog(d.config, d.logger, sophosLineTime, d.processLogLine)
+	go d.watchLog()
+	d.logger.Info("Background log watcher started", "path", d.config.RTSLogPath)
+	return nil
+}
+
+// Stop stops the background log watcher
+func (d *SophosDriver) Stop() {
+	d.cancel()
+}
+
+func (d *SophosDriver) watchLog() {
+	t, err := tail.TailFile(d.config.RTSLogPath, tail.Config{
+		Follow:    true,
+		ReOpen:    true,
+		MustExist: true,
+		Location:  &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END},
+	})
+	if err != nil {
+		d.logger.Error("Failed to start log tailer", "error", err)
+		return
+	}
+	defer t.Cleanup()
+	d.watching.Store(true)
+	defer d.watching.Store(false)
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			t.Stop()
+			return
+		case line := <-t.Lines:
+			if line == nil || line.Err != nil {
+				continue
+			}
+			d.processLogLine(line.Text)
+		}
+	}
+}
+
+func (d *SophosDriver) processLogLine(line string) {
+	matches := sophosThreatRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return
+	}
+	filePath := matches[2]
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+
+	d.cache.Add(absPath, &cache.Detection{
+		FilePath:  filePath,
+		Status:    "infected",
+		Signature: matches[1],
+		Raw:       line,
+	})
+	d.logger.Debug("Cached detection", "path", absPath, "signature", matches[1])
+}
+
+// sophosLineTime returns when a savd log line was written
+func sophosLineTime(line string) (time.Time, bool) {
+	matches := sophosLogTimeRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("20060102 150405", matches[1], time.Local)
+	return t, err == nil
+}
+
+func (d *SophosDriver) Engine() config.EngineType {
+	return config.EngineSophos
+}
+
+func (d *SophosDriver) Config() config.DriverConfig {
+	return d.config
+}
+
+func (d *SophosDriver) RTSWatch(filePath string, opts WatchOptions) (*ScanResult, error) {
+	startTime := time.Now()
+	fileID := filepath.Base(filePath)
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+
+	timeout := time.After(opts.Timeout)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			d.logger.Warn("RTS watch timeout", "filePath", filePath)
+			return &ScanResult{
+				Status:    StatusClean,
+				Engine:    d.Engine(),
+				Phase:     PhaseRTS,
+				FilePath:  filePath,
+				FileID:    fileID,
+				Timestamp: time.Now(),
+				Duration:  time.Since(startTime).Milliseconds(),
+				Raw:       map[string]bool{"timeout": true},
+			}, nil
+
+		case <-ticker.C:
+			if cached, found := d.cache.Get(absPath); found {
+				status := StatusClean
+				if cached.Status == "infected" {
+					status = StatusInfected
+				}
+
+				return &ScanResult{
+					Status:    status,
+					Engine:    d.Engine(),
+					Signature: cached.Signature,
+					Phase:     PhaseRTS,
+					FilePath:  filePath,
+					FileID:    fileID,
+					Timestamp: time.Now(),
+					Duration:  time.Since(startTime).Milliseconds(),
+					Raw:       map[string]string{"logEntry": cached.Raw},
+				}, nil
+			}
+		}
+	}
+}
+
+func (d *SophosDriver) ManualScan(filePath string, opts ScanOptions) (*ScanResult, error) {
+	startTime := time.Now()
+	fileID := filepath.Base(filePath)
+
+	// savscan -ss -nc [-f] <file>: silent apart from threats and errors, and
+	// never prompting to disinfect
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
+	defer cancel()
+
+	args := []string{"-ss", "-nc"}
+	if opts.Deep {
+		args = append(args, "-f")
+	}
+	args = append(args, opts.Flags...)
+	args = append(args, filePath)
+
+	cmd := exec.CommandContext(ctx, d.config.ScanBinaryPath, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if ctx.Err() == context.DeadlineExceeded {
+			return nil, ctx.Err()
+		} else {
+			return nil, err
+		}
+	}
+
+	output := strings.TrimSpace(stdout.String())
+	d.logger.Debug("Manual scan completed", "exitCode", exitCode, "output", output)
+
+	if d.config.FixtureRecordDir != "" {
+		fixture := NewFixture(d.Engine(), filePath, output, stderr.String(), exitCode)
+		if err := WriteFixture(d.config.FixtureRecordDir, fixture); err != nil {
+			d.logger.Warn("Failed to record fixture", "error", err)
+		}
+	}
+
+	status, signature := d.parseManualScanOutput(output, exitCode)
+	usage := processUsage(cmd.ProcessState)
+
+	return &ScanResult{
+		Status:    status,
+		Engine:    d.Engine(),
+		Signature: signature,
+		Phase:     PhaseManual,
+		FilePath:  filePath,
+		FileID:    fileID,
+		Timestamp: time.Now(),
+		Duration:  time.Since(startTime).Milliseconds(),
+		Usage:     usage,
+		Raw: map[string]interface{}{
+			"exitCode": exitCode,
+			"stdout":   output,
+			"stderr":   stderr.String(),
+			"usage":    usage,
+		},
+		ErrorCategory: errorCategory(status, output, stderr.String()),
+	}, nil
+}
+
+// parseManualScanOutput maps savscan's exit code, taking the signature from
+// its first ">>> Virus" line. savscan exits 2 when a file could not be
+// scanned even if another threat was found, so a reported threat wins.
+func (d *SophosDriver) parseManualScanOutput(output string, exitCode int) (ScanStatus, string) {
+	if matches := sophosFoundRegex.FindStringSubmatch(output); matches != nil {
+		return StatusInfected, matches[1]
+	}
+
+	switch exitCode {
+	case sophosExitClean:
+		return StatusClean, ""
+	case sophosExitInfected:
+		return StatusInfected, ""
+	default:
+		return StatusError, ""
+	}
+}
+
+func (d *SophosDriver) CheckHealth() (*EngineHealth, error) {
+	health := &EngineHealth{
+		Engine:    d.Engine(),
+		LastCheck: time.Now(),
+	}
+
+	if _, err := os.Stat(d.config.RTSLogPath); err != nil {
+		health.Healthy = false
+		health.Error = "RTS log not accessible: " + d.config.RTSLogPath
+		return health, nil
+	}
+
+	health.Healthy = true
+	return health, nil
+}
+
+func (d *SophosDriver) GetInfo() EngineInfo {
+	return EngineInfo{
+		Engine:              d.Engine(),
+		Available:           true,
+		RTSEnabled:          true,
+		ManualScanAvailable: true,
+	}
+}
@@ -0,0 +1,60 @@
+package drivers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSophosThreatRegex(t *testing.T) {
+	tests := []struct {
+		name          string
+		line          string
+		wantPath      string
+		wantSignature string
+	}{
+		{
+			name:          "access denied",
+			line:          "20261016 100000\tOn-access scanner: threat 'EICAR-AV-Test' detected in '/tmp/av-scanner/eicar.com'. Access denied.",
+			wantPath:      "/tmp/av-scanner/eicar.com",
+			wantSignature: "EICAR-AV-Test",
+		},
+		{
+			name:          "unquoted path with spaces",
+			line:          "20261016 100000\tOn-access scanner found threat 'Troj/Agent-ABC' in file /tmp/av-scanner/test file.exe",
+			wantPath:      "/tmp/av-scanner/test file.exe",
+			wantSignature: "Troj/Agent-ABC",
+		},
+		{
+			name: "no threat",
+			line: "20261016 100000\tOn-access scanning enabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := sophosThreatRegex.FindStringSubmatch(tt.line)
+			if tt.wantPath == "" {
+				if matches != nil {
+					t.Errorf("expected no match, got %v", matches)
+				}
+				return
+			}
+			if matches == nil {
+				t.Fatal("expected match but got none")
+			}
+			if matches[1] != tt.wantSignature || matches[2] != tt.wantPath {
+				t.Errorf("got signature %q, path %q; expected %q, %q", matches[1], matches[2], tt.wantSignature, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestSophosLineTime(t *testing.T) {
+	got, ok := sophosLineTime("20261016 100000\tOn-access scanning enabled")
+	if !ok || !got.Equal(time.Date(2026, 10, 16, 10, 0, 0, 0, time.Local)) {
+		t.Errorf("sophosLineTime = %v, %v", got, ok)
+	}
+	if _, ok := sophosLineTime(">>> Virus 'EICAR-AV-Test' found in file /tmp/a"); ok {
+		t.Error("expected a line without a timestamp not to be dated")
+	}
+}
@@ -21,14 +21,18 @@ var (
 	// TrendMicro DS Agent log patterns
 	// Sample: 2025-11-21 13:53:06.726130: [ds_am/4] | [SCTRL] (0000-0000-0000, /home/ubuntu/xxxx.file) virus found: 2, act_1st=2, act_2nd=255, act_1st_error_code=0 | scanctrl_vmpd_module.cpp:1538:scanctrl_determine_send_dispatch_result | F7E01:1784DB:4451::
 	tmVirusFoundRegex = regexp.MustCompile(`\([^,]+,\s*([^)]+)\)\s*virus found:`)
+	// Matches the timestamp that starts every ds_agent log line
+	tmLogTimeRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?):`)
 )
 
 type TrendMicroDriver struct {
-	config config.DriverConfig
-	logger *slog.Logger
-	cache  *cache.DetectionCache
-	ctx    context.Context
-	cancel context.CancelFunc
+	config  config.DriverConfig
+	logger  *slog.Logger
+	cache   *cache.DetectionCache
+	ctx     context.Context
+	cancel  context.CancelFunc
+	license licenseCache
+	logWatcher
 }
 
 func NewTrendMicroDriver(cfg config.DriverConfig, logger *slog.Logger, detectionCache *cache.DetectionCache) *TrendMicroDriver {
@@ -49,6 +53,7 @@ func (d *TrendMicroDriver) Start() error {
 		return nil
 	}
 
+	replayRTSLog(d.config, d.logger, tmLineTime, d.processLogLine)
 	go d.watchLog()
 	d.logger.Info("Background log watcher started", "path", d.config.RTSLogPath)
 	return nil
@@ -72,6 +77,8 @@ func (d *TrendMicroDriver) watchLog() {
 		return
 	}
 	defer t.Cleanup()
+	d.watching.Store(true)
+	defer d.watching.Store(false)
 
 	for {
 		select {
@@ -106,6 +113,16 @@ func (d *TrendMicroDriver) processLogLine(line string) {
 	}
 }
 
+// tmLineTime returns when a ds_agent log line was written
+func tmLineTime(line string) (time.Time, bool) {
+	matches := tmLogTimeRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(time.DateTime, matches[1], time.Local)
+	return t, err == nil
+}
+
 func (d *TrendMicroDriver) Engine() config.EngineType {
 	return config.EngineTrendMicro
 }
@@ -165,7 +182,7 @@ func (d *TrendMicroDriver) RTSWatch(filePath string, opts WatchOptions) (*ScanRe
 	}
 }
 
-func (d *TrendMicroDriver) ManualScan(filePath string) (*ScanResult, error) {
+func (d *TrendMicroDriver) ManualScan(filePath string, opts ScanOptions) (*ScanResult, error) {
 	startTime := time.Now()
 	fileID := filepath.Base(filePath)
 
@@ -173,7 +190,8 @@ func (d *TrendMicroDriver) ManualScan(filePath string) (*ScanResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, d.config.ScanBinaryPath, "--target", filePath, "--json")
+	args := append([]string{"--target", filePath, "--json"}, opts.Flags...)
+	cmd := exec.CommandContext(ctx, d.config.ScanBinaryPath, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -193,7 +211,12 @@ func (d *TrendMicroDriver) ManualScan(filePath string) (*ScanResult, error) {
 	output := stdout.String()
 	d.logger.Debug("Manual scan completed", "exitCode", exitCode, "output", output)
 
+	if d.config.FixtureRecordDir != "" {
+		d.recordFixture(filePath, output, stderr.String(), exitCode)
+	}
+
 	status, signature := d.parseManualScanOutput(output, exitCode)
+	usage := processUsage(cmd.ProcessState)
 
 	return &ScanResult{
 		Status:    status,
@@ -204,11 +227,14 @@ func (d *TrendMicroDriver) ManualScan(filePath string) (*ScanResult, error) {
 		FileID:    fileID,
 		Timestamp: time.Now(),
 		Duration:  time.Since(startTime).Milliseconds(),
+		Usage:     usage,
 		Raw: map[string]interface{}{
 			"exitCode": exitCode,
 			"stdout":   output,
 			"stderr":   stderr.String(),
+			"usage":    usage,
 		},
+		ErrorCategory: errorCategory(status, output, stderr.String()),
 	}, nil
 }
 
@@ -266,6 +292,13 @@ func (d *TrendMicroDriver) parseManualScanOutput(output string, exitCode int) (S
 	return StatusError, ""
 }
 
+func (d *TrendMicroDriver) recordFixture(filePath, stdout, stderr string, exitCode int) {
+	fixture := NewFixture(d.Engine(), filePath, stdout, stderr, exitCode)
+	if err := WriteFixture(d.config.FixtureRecordDir, fixture); err != nil {
+		d.logger.Warn("Failed to record fixture", "error", err)
+	}
+}
+
 func (d *TrendMicroDriver) CheckHealth() (*EngineHealth, error) {
 	health := &EngineHealth{
 		Engine:    d.Engine(),
@@ -279,6 +312,7 @@ func (d *TrendMicroDriver) CheckHealth() (*EngineHealth, error) {
 	}
 
 	health.Healthy = true
+	d.checkLicense(health)
 	return health, nil
 }
 
@@ -0,0 +1,138 @@
+package drivers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// licenseRefreshInterval limits how often the agent is queried, since health
+// is checked on every probe
+const licenseRefreshInterval = 5 * time.Minute
+
+// licenseCache holds the last license query result
+type licenseCache struct {
+	mu        sync.Mutex
+	info      *LicenseInfo
+	err       error
+	checkedAt time.Time
+}
+
+// checkLicense adds the agent's license state to health. An expired or
+// deactivated license makes the engine unhealthy, since the agent then stops
+// scanning without failing.
+func (d *TrendMicroDriver) checkLicense(health *EngineHealth) {
+	if d.config.LicenseQueryPath == "" {
+		return
+	}
+
+	d.license.mu.Lock()
+	if d.license.checkedAt.IsZero() || time.Since(d.license.checkedAt) > licenseRefreshInterval {
+		d.license.info, d.license.err = d.queryLicense()
+		d.license.checkedAt = time.Now()
+	}
+	info, err := d.license.info, d.license.err
+	d.license.mu.Unlock()
+
+	if err != nil {
+		d.logger.Debug("License query failed", "error", err)
+		return
+	}
+	if info == nil {
+		return
+	}
+
+	license := *info
+	if license.ExpiresAt != nil {
+		days := int(time.Until(*license.ExpiresAt).Hours() / 24)
+		license.DaysRemaining = &days
+		switch {
+		case !license.ExpiresAt.After(time.Now()):
+			health.Healthy = false
+			health.Error = "license expired"
+		case days < d.config.LicenseWarnDays:
+			license.Warning = fmt.Sprintf("license expires in %d days", days)
+			d.logger.Warn("Engine license expires soon", "expiresAt", license.ExpiresAt, "daysRemaining", days)
+		}
+	}
+	if isInactiveLicense(license.Status) && health.Healthy {
+		health.Healthy = false
+		health.Error = "license not active: " + license.Status
+	}
+	health.License = &license
+}
+
+// queryLicense runs "dsa_query -c GetAgentStatus"
+func (d *TrendMicroDriver) queryLicense() (*LicenseInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.config.Timeout)*time.Millisecond)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, d.config.LicenseQueryPath, "-c", "GetAgentStatus").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseLicenseStatus(string(output)), nil
+}
+
+// parseLicenseStatus extracts license fields from "Key: Value" agent status
+// output. Field names differ between agent versions, so keys are matched by
+// the words they contain. Returns nil if no license fields are present.
+func parseLicenseStatus(output string) *LicenseInfo {
+	var info LicenseInfo
+	found := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if value == "" || !strings.Contains(key, "licens") && !strings.Contains(key, "activation") {
+			continue
+		}
+
+		switch {
+		case strings.Contains(key, "expir"):
+			if t, ok := parseLicenseTime(value); ok {
+				info.ExpiresAt = &t
+				found = true
+			}
+		case strings.Contains(key, "status") || strings.Contains(key, "state"):
+			info.Status = strings.ToLower(value)
+			found = true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return &info
+}
+
+func parseLicenseTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02", "01/02/2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	// Epoch seconds
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil && secs > 0 {
+		return time.Unix(secs, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+func isInactiveLicense(status string) bool {
+	switch status {
+	case "expired", "inactive", "deactivated", "not activated", "invalid":
+		return true
+	}
+	return false
+}
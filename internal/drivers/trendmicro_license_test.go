@@ -0,0 +1,98 @@
+package drivers
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestParseLicenseStatus(t *testing.T) {
+	output := `AgentStatus.agentState: green
+AgentStatus.dsmMode: 1
+AgentStatus.AntiMalware.licenseStatus: Activated
+AgentStatus.AntiMalware.licenseExpiry: 2027-03-31
+`
+	info := parseLicenseStatus(output)
+	if info == nil {
+		t.Fatal("expected license info")
+	}
+	if info.Status != "activated" {
+		t.Errorf("expected status activated, got %q", info.Status)
+	}
+	if info.ExpiresAt == nil || !info.ExpiresAt.Equal(time.Date(2027, 3, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry: %v", info.ExpiresAt)
+	}
+
+	if info := parseLicenseStatus("AgentStatus.agentState: green\n"); info != nil {
+		t.Errorf("expected nil without license fields, got %+v", info)
+	}
+}
+
+func TestParseLicenseTime(t *testing.T) {
+	for _, value := range []string{"2027-03-31T00:00:00Z", "2027-03-31 00:00:00", "2027-03-31", "03/31/2027", "1806451200"} {
+		got, ok := parseLicenseTime(value)
+		if !ok || !got.Equal(time.Date(2027, 3, 31, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("parseLicenseTime(%q) = %v, %v", value, got, ok)
+		}
+	}
+	if _, ok := parseLicenseTime("soon"); ok {
+		t.Error("expected invalid time to fail")
+	}
+}
+
+func TestTrendMicroDriver_CheckLicense(t *testing.T) {
+	dir := t.TempDir()
+	rtsLog := filepath.Join(dir, "ds_agent.log")
+	if err := os.WriteFile(rtsLog, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newDriver := func(expiry time.Time) *TrendMicroDriver {
+		query := filepath.Join(dir, "dsa_query-"+expiry.Format("20060102"))
+		script := "#!/bin/sh\necho 'AgentStatus.AntiMalware.licenseExpiry: " + expiry.Format("2006-01-02") + "'\n"
+		if err := os.WriteFile(query, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return NewTrendMicroDriver(config.DriverConfig{
+			Engine:           config.EngineTrendMicro,
+			RTSLogPath:       rtsLog,
+			Timeout:          5000,
+			LicenseQueryPath: query,
+			LicenseWarnDays:  30,
+		}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	}
+
+	tests := []struct {
+		name        string
+		expiry      time.Time
+		healthy     bool
+		wantWarning bool
+	}{
+		{"valid", time.Now().AddDate(1, 0, 0), true, false},
+		{"expiring soon", time.Now().AddDate(0, 0, 10), true, true},
+		{"expired", time.Now().AddDate(0, 0, -2), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health, err := newDriver(tt.expiry).CheckHealth()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if health.Healthy != tt.healthy {
+				t.Errorf("expected healthy=%v, got %v (%s)", tt.healthy, health.Healthy, health.Error)
+			}
+			if health.License == nil || health.License.DaysRemaining == nil {
+				t.Fatalf("expected license info, got %+v", health.License)
+			}
+			if (health.License.Warning != "") != tt.wantWarning {
+				t.Errorf("unexpected warning: %q", health.License.Warning)
+			}
+		})
+	}
+}
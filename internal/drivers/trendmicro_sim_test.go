@@ -0,0 +1,81 @@
+package drivers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/dsagentsim"
+)
+
+// TestTrendMicroDriver_SimulatedAgent runs the driver against a simulated DS
+// Agent: real-time detections come from ds_agent.log, manual scans from the
+// dsa_scan stub and license state from the dsa_query stub
+func TestTrendMicroDriver_SimulatedAgent(t *testing.T) {
+	agent, err := dsagentsim.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to install simulated agent: %v", err)
+	}
+	uploadDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go agent.Watch(ctx, uploadDir, 20*time.Millisecond)
+
+	d := NewTrendMicroDriver(agent.DriverConfig(), testLogger(), cache.NewDetectionCache(time.Minute))
+	if err := d.Start(); err != nil {
+		t.Fatalf("failed to start driver: %v", err)
+	}
+	defer d.Stop()
+
+	health, _ := d.CheckHealth()
+	if !health.Healthy || health.License == nil || health.License.Status != "activated" {
+		t.Errorf("expected a healthy, licensed agent, got %+v (%+v)", health, health.License)
+	}
+
+	infected := filepath.Join(uploadDir, "eicar.com")
+	os.WriteFile(infected, []byte(EICARPattern()), 0644)
+	result, err := d.RTSWatch(infected, WatchOptions{Timeout: 3 * time.Second})
+	if err != nil || result.Status != StatusInfected || result.Signature != "virus" {
+		t.Errorf("expected a real-time detection, got %+v (%v)", result, err)
+	}
+	if _, err := os.Stat(filepath.Join(agent.QuarantineDir, "eicar.com")); err != nil {
+		t.Errorf("expected the file to be quarantined: %v", err)
+	}
+	// The quarantined file is gone: dsa_scan reports nothing scanned
+	if result, err := d.ManualScan(infected, ScanOptions{}); err != nil || result.Status != StatusError {
+		t.Errorf("expected an error verdict for a quarantined file, got %+v (%v)", result, err)
+	}
+
+	// Outside the watched directory only the manual scan sees the file
+	outside := filepath.Join(t.TempDir(), "eicar.com")
+	os.WriteFile(outside, []byte(EICARPattern()), 0644)
+	result, err = d.ManualScan(outside, ScanOptions{})
+	if err != nil || result.Status != StatusInfected || result.Signature != dsagentsim.MalwareName {
+		t.Errorf("expected an infected manual scan, got %+v (%v)", result, err)
+	}
+
+	clean := filepath.Join(uploadDir, "clean.txt")
+	os.WriteFile(clean, []byte("clean content"), 0644)
+	if result, err := d.RTSWatch(clean, WatchOptions{Timeout: 200 * time.Millisecond}); err != nil || result.Status != StatusClean {
+		t.Errorf("expected no real-time detection, got %+v (%v)", result, err)
+	}
+	if result, err := d.ManualScan(clean, ScanOptions{}); err != nil || result.Status != StatusClean {
+		t.Errorf("expected a clean manual scan, got %+v (%v)", result, err)
+	}
+
+	agent.SetOffline(true)
+	result, err = d.ManualScan(clean, ScanOptions{})
+	if err != nil || result.Status != StatusError || result.ErrorCategory != ErrorEngineOffline {
+		t.Errorf("expected an engine_offline error, got %+v (%v)", result, err)
+	}
+	agent.SetOffline(false)
+
+	agent.SetLicense(time.Now().AddDate(0, 0, -1), "expired")
+	d = NewTrendMicroDriver(agent.DriverConfig(), testLogger(), cache.NewDetectionCache(time.Minute))
+	if health, _ := d.CheckHealth(); health.Healthy || health.Error != "license expired" {
+		t.Errorf("expected an expired license to fail health, got %+v", health)
+	}
+}
@@ -1,6 +1,8 @@
 package drivers
 
 import (
+	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/rophy/av-scanner/internal/config"
@@ -9,9 +11,12 @@ import (
 type ScanStatus string
 
 const (
-	StatusClean    ScanStatus = "clean"
-	StatusInfected ScanStatus = "infected"
-	StatusError    ScanStatus = "error"
+	StatusClean      ScanStatus = "clean"
+	StatusInfected   ScanStatus = "infected"
+	StatusError      ScanStatus = "error"
+	StatusSuspicious ScanStatus = "suspicious"
+	StatusSkipped    ScanStatus = "skipped"
+	StatusBlocked    ScanStatus = "blocked"
 )
 
 type ScanPhase string
@@ -30,7 +35,11 @@ type ScanResult struct {
 	FileID    string            `json:"fileId"`
 	Timestamp time.Time         `json:"timestamp"`
 	Duration  int64             `json:"duration"` // milliseconds
+	Usage     *ResourceUsage    `json:"-"`        // engine subprocess, nil without one
 	Raw       interface{}       `json:"-"`
+
+	// ErrorCategory says why the engine failed, set with StatusError
+	ErrorCategory ErrorCategory `json:"errorCategory,omitempty"`
 }
 
 type EngineHealth struct {
@@ -39,6 +48,24 @@ type EngineHealth struct {
 	Version   string            `json:"version,omitempty"`
 	LastCheck time.Time         `json:"lastCheck"`
 	Error     string            `json:"error,omitempty"`
+	License   *LicenseInfo      `json:"license,omitempty"` // commercial engines only
+
+	Signatures *SignatureInfo `json:"signatures,omitempty"`
+}
+
+// SignatureInfo is the signature database an engine has loaded
+type SignatureInfo struct {
+	Version    string     `json:"version,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+	AgeSeconds *int64     `json:"ageSeconds,omitempty"`
+}
+
+// LicenseInfo is the activation and license state reported by an engine
+type LicenseInfo struct {
+	Status        string     `json:"status,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	DaysRemaining *int       `json:"daysRemaining,omitempty"`
+	Warning       string     `json:"warning,omitempty"`
 }
 
 type EngineInfo struct {
@@ -53,6 +80,11 @@ type WatchOptions struct {
 	PollInterval time.Duration
 }
 
+type ScanOptions struct {
+	Deep  bool     // thorough scan, e.g. report all matches
+	Flags []string // extra scan binary arguments, from the scan profile
+}
+
 type LogEntry struct {
 	Timestamp time.Time
 	FilePath  string
@@ -67,7 +99,48 @@ type Driver interface {
 	Start() error
 	Stop()
 	RTSWatch(filePath string, opts WatchOptions) (*ScanResult, error)
-	ManualScan(filePath string) (*ScanResult, error)
+	ManualScan(filePath string, opts ScanOptions) (*ScanResult, error)
 	CheckHealth() (*EngineHealth, error)
 	GetInfo() EngineInfo
 }
+
+// StreamScanner is implemented by drivers that can scan content streamed to
+// the engine, so it never has to be written to disk
+type StreamScanner interface {
+	StreamScan(r io.Reader, fileID string, opts ScanOptions) (*ScanResult, error)
+}
+
+// WatchPathsReporter is implemented by drivers that can read which
+// directories their on-access scanner watches
+type WatchPathsReporter interface {
+	WatchPaths() (include, exclude []string, err error)
+}
+
+// RestartReporter is implemented by drivers that can tell from their RTS log
+// when the engine's on-access daemon started. Set the handler before Start so
+// restarts in the replayed log history are reported too.
+type RestartReporter interface {
+	OnRestart(handler func(at time.Time))
+}
+
+// WatcherReporter is implemented by drivers that tail an RTS log, to tell
+// whether their log watcher is running
+type WatcherReporter interface {
+	RTSWatcherRunning() bool
+}
+
+// logWatcher records whether a driver's RTS log watcher is running; drivers
+// embed it to implement WatcherReporter
+type logWatcher struct {
+	watching atomic.Bool
+}
+
+func (w *logWatcher) RTSWatcherRunning() bool {
+	return w.watching.Load()
+}
+
+// Reloader is implemented by drivers whose engine has to be told to load
+// signatures written by an update
+type Reloader interface {
+	Reload() error
+}
@@ -0,0 +1,24 @@
+package drivers
+
+import "os"
+
+// ResourceUsage is the CPU time and peak memory of an engine subprocess.
+// For client binaries such as clamdscan this is the client only; the scan
+// itself runs in the engine daemon.
+type ResourceUsage struct {
+	UserTime   int64 `json:"userTimeMs"`
+	SystemTime int64 `json:"systemTimeMs"`
+	MaxRSS     int64 `json:"maxRssBytes"` // 0 where the platform does not report it
+}
+
+// processUsage reads the rusage wait4 collected for an exited process
+func processUsage(state *os.ProcessState) *ResourceUsage {
+	if state == nil {
+		return nil
+	}
+	return &ResourceUsage{
+		UserTime:   state.UserTime().Milliseconds(),
+		SystemTime: state.SystemTime().Milliseconds(),
+		MaxRSS:     maxRSS(state),
+	}
+}
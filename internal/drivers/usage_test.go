@@ -0,0 +1,39 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestClamAVDriver_ManualScanUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as scan binary")
+	}
+	dir := t.TempDir()
+	scanBinary := filepath.Join(dir, "clamdscan")
+	script := "#!/bin/sh\necho \"$4: OK\"\n"
+	if err := os.WriteFile(scanBinary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "upload.txt")
+	os.WriteFile(target, []byte("hello"), 0644)
+
+	d := NewClamAVDriver(config.DriverConfig{ScanBinaryPath: scanBinary, Timeout: 5000}, testLogger(), nil)
+	result, err := d.ManualScan(target, ScanOptions{})
+	if err != nil {
+		t.Fatalf("ManualScan failed: %v", err)
+	}
+	if result.Status != StatusClean || result.Usage == nil {
+		t.Fatalf("expected a clean result with usage, got %+v", result)
+	}
+	if runtime.GOOS == "linux" && result.Usage.MaxRSS <= 0 {
+		t.Errorf("expected the peak RSS to be reported, got %+v", result.Usage)
+	}
+	if raw := result.Raw.(map[string]interface{}); raw["usage"] != result.Usage {
+		t.Errorf("expected usage in Raw, got %v", raw["usage"])
+	}
+}
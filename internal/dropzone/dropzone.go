@@ -0,0 +1,251 @@
+// Package dropzone scans files dropped into a directory, e.g. by SFTP or
+// rsync, and moves each one to a clean or rejected directory by verdict.
+package dropzone
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+// fileState is what a pending file looked like when its quiet period started
+type fileState struct {
+	timer   *time.Timer
+	size    int64
+	modTime time.Time
+}
+
+// Watcher scans a file once it has not changed for the quiet period, so a
+// file still being written is never scanned half-done. Successive writes
+// restart the period instead of queueing more scans.
+type Watcher struct {
+	dir       string
+	cleanDir  string
+	rejectDir string
+	quiet     time.Duration
+	scanner   *scanner.Scanner
+	logger    *slog.Logger
+	watcher   *fsnotify.Watcher
+
+	mu      sync.Mutex
+	pending map[string]*fileState
+	stopped bool
+
+	work chan string
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a watcher for DROPZONE_DIR, or nil when the drop zone is
+// disabled
+func New(cfg *config.Config, s *scanner.Scanner, logger *slog.Logger) *Watcher {
+	if cfg.DropzoneDir == "" {
+		return nil
+	}
+	return &Watcher{
+		dir:       cfg.DropzoneDir,
+		cleanDir:  cfg.DropzoneCleanDir,
+		rejectDir: cfg.DropzoneRejectDir,
+		quiet:     time.Duration(cfg.DropzoneQuietPeriod) * time.Millisecond,
+		scanner:   s,
+		logger:    logger.With("component", "dropzone"),
+		pending:   make(map[string]*fileState),
+		work:      make(chan string, 100),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start watches the drop zone. Files already there, e.g. from before a
+// restart, get a quiet period like new ones.
+func (w *Watcher) Start() error {
+	for _, dir := range []string{w.dir, w.cleanDir, w.rejectDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create drop zone directory: %w", err)
+		}
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create drop zone watcher: %w", err)
+	}
+	if err := watcher.Add(w.dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch drop zone: %w", err)
+	}
+	w.watcher = watcher
+
+	w.wg.Add(2)
+	go w.watch()
+	go w.scanLoop()
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		w.logger.Warn("Failed to list drop zone", "path", w.dir, "error", err)
+	}
+	for _, entry := range entries {
+		w.touch(filepath.Join(w.dir, entry.Name()))
+	}
+	w.logger.Info("Drop zone watcher started", "path", w.dir, "quietPeriod", w.quiet)
+	return nil
+}
+
+// Stop stops watching and waits for the scan in progress. Pending files are
+// picked up again at the next start.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	w.stopped = true
+	for path, state := range w.pending {
+		state.timer.Stop()
+		delete(w.pending, path)
+	}
+	w.mu.Unlock()
+
+	w.watcher.Close()
+	close(w.stop)
+	w.wg.Wait()
+}
+
+func (w *Watcher) watch() {
+	defer w.wg.Done()
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Chmod) != 0 {
+				w.touch(event.Name)
+			} else if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				w.forget(event.Name)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("Drop zone watcher error", "error", err)
+		}
+	}
+}
+
+// touch (re)starts a file's quiet period. Hidden files are skipped, since
+// rsync and most upload tools write to one and rename it when done.
+func (w *Watcher) touch(path string) {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	if state := w.pending[path]; state != nil {
+		state.timer.Stop()
+	}
+	w.pending[path] = &fileState{
+		timer:   time.AfterFunc(w.quiet, func() { w.settle(path) }),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+}
+
+func (w *Watcher) forget(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if state := w.pending[path]; state != nil {
+		state.timer.Stop()
+		delete(w.pending, path)
+	}
+}
+
+// settle queues a file for scanning once its quiet period ends. A file that
+// changed without an event (e.g. on a network filesystem) gets another period.
+func (w *Watcher) settle(path string) {
+	w.mu.Lock()
+	state := w.pending[path]
+	if state == nil {
+		w.mu.Unlock()
+		return
+	}
+	info, err := os.Stat(path)
+	if err == nil && (info.Size() != state.size || !info.ModTime().Equal(state.modTime)) {
+		w.mu.Unlock()
+		w.touch(path)
+		return
+	}
+	delete(w.pending, path)
+	w.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	select {
+	case w.work <- path:
+	case <-w.stop:
+	}
+}
+
+func (w *Watcher) scanLoop() {
+	defer w.wg.Done()
+	for {
+		select {
+		case path := <-w.work:
+			w.scan(path)
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// scan scans a settled file and moves it by verdict. A file that fails to
+// scan stays in the drop zone and is retried at the next start.
+func (w *Watcher) scan(path string) {
+	result, err := bulkscan.ScanFile(w.scanner, path)
+	if err == nil && result.Status == drivers.StatusError {
+		err = fmt.Errorf("engine error")
+	}
+	if err != nil {
+		w.logger.Error("Drop zone scan failed", "path", path, "error", err)
+		return
+	}
+
+	dest := w.rejectDir
+	if result.Status == drivers.StatusClean {
+		dest = w.cleanDir
+	}
+	target, err := moveFile(path, dest, result.FileID)
+	if err != nil {
+		w.logger.Error("Failed to move drop zone file", "path", path, "status", result.Status, "error", err)
+		return
+	}
+	w.logger.Info("Drop zone file scanned",
+		"path", path,
+		"fileId", result.FileID,
+		"status", result.Status,
+		"signature", result.Signature,
+		"movedTo", target,
+	)
+}
+
+// moveFile renames path into dir, suffixing the file ID if the name is taken
+func moveFile(path, dir, fileID string) (string, error) {
+	target := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Lstat(target); err == nil {
+		target += "." + fileID
+	}
+	return target, os.Rename(path, target)
+}
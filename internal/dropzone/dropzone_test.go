@@ -0,0 +1,122 @@
+package dropzone
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func newTestWatcher(t *testing.T, quiet time.Duration) (*Watcher, *config.Config) {
+	t.Helper()
+	root := t.TempDir()
+	cfg := &config.Config{
+		UploadDir:           filepath.Join(root, "uploads"),
+		ActiveEngine:        config.EngineMock,
+		MaxNestingDepth:     3,
+		DropzoneDir:         filepath.Join(root, "in"),
+		DropzoneCleanDir:    filepath.Join(root, "clean"),
+		DropzoneRejectDir:   filepath.Join(root, "rejected"),
+		DropzoneQuietPeriod: int(quiet.Milliseconds()),
+	}
+	os.MkdirAll(cfg.UploadDir, 0755)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scanner.New(cfg, logger)
+	t.Cleanup(s.Stop)
+
+	w := New(cfg, s, logger)
+	if err := w.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(w.Stop)
+	return w, cfg
+}
+
+func waitForFile(t *testing.T, path string) []byte {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if data, err := os.ReadFile(path); err == nil {
+			return data
+		}
+	}
+	t.Fatalf("%s did not appear", path)
+	return nil
+}
+
+func TestWatcher_WaitsForQuietPeriod(t *testing.T) {
+	_, cfg := newTestWatcher(t, 300*time.Millisecond)
+	path := filepath.Join(cfg.DropzoneDir, "transfer.txt")
+
+	// A slow writer keeps the file changing for longer than the quiet period
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 8 {
+		f.Write([]byte("chunk\n"))
+		time.Sleep(75 * time.Millisecond)
+	}
+	f.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file was taken while still being written: %v", err)
+	}
+
+	data := waitForFile(t, filepath.Join(cfg.DropzoneCleanDir, "transfer.txt"))
+	if len(data) != 8*len("chunk\n") {
+		t.Errorf("expected the complete file, got %d bytes", len(data))
+	}
+}
+
+func TestWatcher_RejectsInfected(t *testing.T) {
+	_, cfg := newTestWatcher(t, 50*time.Millisecond)
+
+	// Hidden files are in-progress transfers and left alone
+	hidden := filepath.Join(cfg.DropzoneDir, ".eicar.com.Xa1b2")
+	os.WriteFile(hidden, []byte(drivers.EICARPattern()), 0644)
+	os.Rename(hidden, filepath.Join(cfg.DropzoneDir, "eicar.com"))
+
+	waitForFile(t, filepath.Join(cfg.DropzoneRejectDir, "eicar.com"))
+	if entries, _ := os.ReadDir(cfg.DropzoneCleanDir); len(entries) != 0 {
+		t.Errorf("expected nothing in the clean dir, got %d entries", len(entries))
+	}
+}
+
+func TestWatcher_ScansExistingFiles(t *testing.T) {
+	root := t.TempDir()
+	in := filepath.Join(root, "in")
+	os.MkdirAll(in, 0755)
+	os.WriteFile(filepath.Join(in, "report.pdf"), []byte("%PDF-1.4"), 0644)
+
+	cfg := &config.Config{
+		UploadDir:           filepath.Join(root, "uploads"),
+		ActiveEngine:        config.EngineMock,
+		MaxNestingDepth:     3,
+		DropzoneDir:         in,
+		DropzoneCleanDir:    filepath.Join(root, "clean"),
+		DropzoneRejectDir:   filepath.Join(root, "rejected"),
+		DropzoneQuietPeriod: 50,
+	}
+	os.MkdirAll(cfg.UploadDir, 0755)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scanner.New(cfg, logger)
+	defer s.Stop()
+	w := New(cfg, s, logger)
+	if err := w.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer w.Stop()
+
+	waitForFile(t, filepath.Join(cfg.DropzoneCleanDir, "report.pdf"))
+}
+
+func TestNew_Disabled(t *testing.T) {
+	if w := New(&config.Config{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil))); w != nil {
+		t.Error("expected no watcher without DROPZONE_DIR")
+	}
+}
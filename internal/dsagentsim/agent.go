@@ -0,0 +1,221 @@
+// Package dsagentsim simulates a Trend Micro Deep Security Agent, so the
+// TrendMicro driver can be tested without a licensed agent. It writes a
+// dsa_scan stub answering with dsa_scan --json output, a dsa_query stub
+// reporting license state, and an on-access scanner that logs detections to
+// ds_agent.log the way the agent does and quarantines the file.
+//
+// Files containing the EICAR test file's "EICAR-STANDARD-ANTIVIRUS-TEST-FILE"
+// marker are infected; everything else is clean.
+package dsagentsim
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// Marker makes a file infected, for both the on-access and manual scans
+const Marker = "EICAR-STANDARD-ANTIVIRUS-TEST-FILE"
+
+// MalwareName is what dsa_scan reports for infected files
+const MalwareName = "Eicar_test_file"
+
+// logTime is the ds_agent.log timestamp layout
+const logTime = "2006-01-02 15:04:05.000000"
+
+// Agent is a simulated DS Agent installed under Dir
+type Agent struct {
+	Dir           string
+	ScanBinary    string // dsa_scan stub
+	QueryBinary   string // dsa_query stub
+	LogPath       string // ds_agent.log
+	QuarantineDir string // where the on-access scanner moves infected files
+
+	mu   sync.Mutex
+	seen map[string]fileState // files the on-access scanner has checked
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// New installs a simulated agent into dir: the dsa_scan and dsa_query stubs,
+// a license valid for a year and a ds_agent.log with the agent's startup lines
+func New(dir string) (*Agent, error) {
+	a := &Agent{
+		Dir:           dir,
+		ScanBinary:    filepath.Join(dir, "dsa_scan"),
+		QueryBinary:   filepath.Join(dir, "dsa_query"),
+		LogPath:       filepath.Join(dir, "ds_agent.log"),
+		QuarantineDir: filepath.Join(dir, "quarantine"),
+		seen:          make(map[string]fileState),
+	}
+	if err := os.MkdirAll(a.QuarantineDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(a.ScanBinary, []byte(scanScript(a.offlineFlag())), 0755); err != nil {
+		return nil, err
+	}
+	if err := a.SetLicense(time.Now().AddDate(1, 0, 0), "activated"); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(a.LogPath, nil, 0644); err != nil {
+		return nil, err
+	}
+	return a, a.appendLog(
+		"[ds_agent/5] | Deep Security Agent starting | dsa_main.cpp:212:main | 1A2B3:0:1::",
+		"[ds_am/5] | [SCTRL] real-time scan enabled | scanctrl_module.cpp:402:scanctrl_init | F7E01:0:1::",
+	)
+}
+
+// DriverConfig returns a TrendMicro driver configuration using the agent
+func (a *Agent) DriverConfig() config.DriverConfig {
+	return config.DriverConfig{
+		Engine:             config.EngineTrendMicro,
+		RTSLogPath:         a.LogPath,
+		ScanBinaryPath:     a.ScanBinary,
+		Timeout:            5000,
+		RTSCacheBaseDelay:  500,
+		RTSCacheDelayPerMB: 10,
+		QuarantineDir:      a.QuarantineDir,
+		LicenseQueryPath:   a.QueryBinary,
+		LicenseWarnDays:    30,
+	}
+}
+
+// SetLicense rewrites the dsa_query stub to report the license expiry and
+// status, e.g. "activated" or "expired"
+func (a *Agent) SetLicense(expiry time.Time, status string) error {
+	script := "#!/bin/sh\n" +
+		"# dsa_query stub written by dsagentsim\n" +
+		"cat <<'EOF'\n" +
+		"AgentStatus.agentState: green\n" +
+		"AgentStatus.AntiMalware.licenseStatus: " + status + "\n" +
+		"AgentStatus.AntiMalware.licenseExpiry: " + expiry.UTC().Format("2006-01-02") + "\n" +
+		"EOF\n"
+	return os.WriteFile(a.QueryBinary, []byte(script), 0755)
+}
+
+// SetOffline makes dsa_scan fail as it does while the scan engine is down
+func (a *Agent) SetOffline(offline bool) error {
+	if !offline {
+		err := os.Remove(a.offlineFlag())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(a.offlineFlag(), nil, 0644)
+}
+
+func (a *Agent) offlineFlag() string {
+	return filepath.Join(a.Dir, "engine-offline")
+}
+
+// Detect logs a real-time detection of path to ds_agent.log without touching
+// the file
+func (a *Agent) Detect(path string) error {
+	return a.appendLog(fmt.Sprintf(
+		"[ds_am/4] | [SCTRL] (0000-0000-0000, %s) virus found: 2, act_1st=2, act_2nd=255, act_1st_error_code=0 | scanctrl_vmpd_module.cpp:1538:scanctrl_determine_send_dispatch_result | F7E01:1784DB:4451::",
+		path,
+	))
+}
+
+// Watch runs the on-access scanner over root until ctx is done: new or
+// changed files containing Marker are logged as detections and moved to
+// QuarantineDir, as the agent does with act_1st=2
+func (a *Agent) Watch(ctx context.Context, root string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.scanTree(root)
+		}
+	}
+}
+
+func (a *Agent) scanTree(root string) {
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		a.mu.Lock()
+		unchanged := a.seen[path] == state
+		a.seen[path] = state
+		a.mu.Unlock()
+		if unchanged {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil || !strings.Contains(string(content), Marker) {
+			return nil
+		}
+		if err := a.Detect(path); err != nil {
+			return nil
+		}
+		os.Rename(path, filepath.Join(a.QuarantineDir, filepath.Base(path)))
+		return nil
+	})
+}
+
+func (a *Agent) appendLog(lines ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.OpenFile(a.LogPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(f, "%s: %s\n", time.Now().Format(logTime), line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanScript is the dsa_scan stub. It accepts "--target <file> --json" plus
+// any extra flags, and reports nothing scanned for a missing file, as the
+// agent does after real-time scan quarantined it.
+func scanScript(offlineFlag string) string {
+	return `#!/bin/sh
+# dsa_scan stub written by dsagentsim
+target=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--target) target="$2"; shift ;;
+	esac
+	shift
+done
+if [ -e '` + offlineFlag + `' ]; then
+	echo "scan engine offline" >&2
+	exit 1
+fi
+trace=$(printf '0f5e0f0a-0000-4000-8000-%012d' $$)
+if [ ! -e "$target" ]; then
+	printf '{"traceID":"%s","numOfFileScanned":0,"numOfFileSkipped":0,"numOfFileInfected":0,"timeElapse":0.01,"errorCode":0,"infectedFiles":[]}\n' "$trace"
+elif grep -q '` + Marker + `' "$target"; then
+	printf '{"traceID":"%s","numOfFileScanned":1,"numOfFileSkipped":0,"numOfFileInfected":1,"timeElapse":0.15,"errorCode":0,"infectedFiles":[{"fileName":"%s","malwareName":"` + MalwareName + `"}]}\n' "$trace" "$target"
+else
+	printf '{"traceID":"%s","numOfFileScanned":1,"numOfFileSkipped":0,"numOfFileInfected":0,"timeElapse":0.12,"errorCode":0,"infectedFiles":[]}\n' "$trace"
+fi
+`
+}
@@ -0,0 +1,205 @@
+// Package events publishes scan results to a message broker, so analytics and
+// SIEM pipelines get a stream of verdicts without parsing logs.
+package events
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// dialTimeout bounds connecting to and each exchange with a broker
+const dialTimeout = 5 * time.Second
+
+// sink delivers one message to the broker, with headers where the
+// transport has them. It reconnects as needed and is only used from the
+// publisher's sender goroutine.
+type sink interface {
+	send(key string, headers map[string]string, value []byte) error
+	close()
+}
+
+type message struct {
+	key     string
+	headers map[string]string
+	value   []byte
+}
+
+// Publisher sends events to the broker in the background. Publishing never
+// blocks a scan: when the queue is full the event is dropped and counted.
+type Publisher struct {
+	sink   sink
+	logger *slog.Logger
+	queue  chan message
+	done   chan struct{}
+
+	// closed is set under mu before queue is closed, so scans that outlive
+	// a shutdown timeout drop their events instead of sending on it
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New returns a publisher for EVENTS_TRANSPORT, or nil when publishing is
+// disabled. Brokers are connected to on the first event.
+func New(cfg *config.Config, logger *slog.Logger) (*Publisher, error) {
+	logger = logger.With("component", "events")
+	if cfg.EventsTransport == "" {
+		return nil, nil
+	}
+	d, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var s sink
+	switch cfg.EventsTransport {
+	case config.EventsKafka:
+		s = newKafkaSink(cfg.EventsBrokers, cfg.EventsTopic, d)
+	case config.EventsNATS:
+		s = newNATSSink(cfg.EventsBrokers, cfg.EventsTopic, d)
+	default:
+		return nil, fmt.Errorf("invalid events transport: %s", cfg.EventsTransport)
+	}
+	return newPublisher(s, cfg.EventsQueueSize, logger), nil
+}
+
+// dialer connects to brokers with the configured TLS settings and holds
+// the credentials the sinks authenticate with
+type dialer struct {
+	tls       *tls.Config // nil for plain TCP
+	mechanism config.SASLMechanism
+	username  string
+	password  string
+}
+
+func newDialer(cfg *config.Config) (*dialer, error) {
+	d := &dialer{mechanism: cfg.EventsSASLMechanism, username: cfg.EventsUsername}
+	if cfg.EventsPasswordFile != "" {
+		password, err := os.ReadFile(cfg.EventsPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read events password: %w", err)
+		}
+		d.password = strings.TrimSpace(string(password))
+	}
+	if !cfg.EventsTLS {
+		return d, nil
+	}
+
+	d.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.EventsTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.EventsTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read events CA file: %w", err)
+		}
+		d.tls.RootCAs = x509.NewCertPool()
+		if !d.tls.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in events CA file %s", cfg.EventsTLSCAFile)
+		}
+	}
+	if cfg.EventsTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.EventsTLSCertFile, cfg.EventsTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load events client certificate: %w", err)
+		}
+		d.tls.Certificates = []tls.Certificate{cert}
+	}
+	return d, nil
+}
+
+// dial opens a TCP connection to addr, over TLS if configured
+func (d *dialer) dial(addr string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil || d.tls == nil {
+		return conn, err
+	}
+	return d.upgrade(conn, addr)
+}
+
+// upgrade starts TLS on conn, verifying the server as host of addr
+func (d *dialer) upgrade(conn net.Conn, addr string) (net.Conn, error) {
+	config := d.tls.Clone()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+func newPublisher(s sink, queueSize int, logger *slog.Logger) *Publisher {
+	p := &Publisher{
+		sink:   s,
+		logger: logger,
+		queue:  make(chan message, queueSize),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish queues event, encoded as JSON, under key (e.g. the file ID), with
+// headers such as the trace context
+func (p *Publisher) Publish(key string, headers map[string]string, event any) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		p.logger.Error("Failed to encode event", "key", key, "error", err)
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		metrics.RecordEvent("dropped")
+		p.logger.Warn("Publisher closed, event dropped", "key", key)
+		return
+	}
+	select {
+	case p.queue <- message{key: key, headers: headers, value: value}:
+	default:
+		metrics.RecordEvent("dropped")
+		p.logger.Warn("Event queue full, event dropped", "key", key)
+	}
+}
+
+// Close sends the events already queued and disconnects. Events published
+// afterwards are dropped.
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+	defer p.sink.close()
+	for msg := range p.queue {
+		// One retry covers a broker connection that went stale while idle
+		err := p.sink.send(msg.key, msg.headers, msg.value)
+		if err != nil {
+			err = p.sink.send(msg.key, msg.headers, msg.value)
+		}
+		if err != nil {
+			metrics.RecordEvent("failed")
+			p.logger.Warn("Failed to publish event", "key", msg.key, "error", err)
+			continue
+		}
+		metrics.RecordEvent("published")
+	}
+}
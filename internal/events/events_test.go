@@ -0,0 +1,446 @@
+package events
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func receive(t *testing.T, received <-chan string) string {
+	t.Helper()
+	select {
+	case value := <-received:
+		return value
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+		return ""
+	}
+}
+
+// fakeNATS accepts one client and reports the payloads it publishes, with
+// the header block before them for HPUB. With a user, the client must
+// CONNECT as that user with password "secret".
+func fakeNATS(t *testing.T, ln net.Listener, user string, received chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(fmt.Sprintf(`INFO {"server_id":"test","max_payload":1048576,"auth_required":%t}`, user != "") + "\r\n"))
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch fields := strings.Fields(line); fields[0] {
+		case "CONNECT":
+			var connect natsConnect
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &connect)
+			if user != "" && (connect.User != user || connect.Pass != "secret") {
+				conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+				return
+			}
+		case "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case "PUB":
+			if fields[1] != "av-scanner.scans" {
+				t.Errorf("unexpected subject %s", fields[1])
+			}
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			received <- string(payload[:size])
+		case "HPUB":
+			size, _ := strconv.Atoi(fields[3])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			received <- string(payload[:size])
+		}
+	}
+}
+
+func TestPublisher_NATS(t *testing.T) {
+	ln := listen(t)
+	received := make(chan string, 1)
+	go fakeNATS(t, ln, "", received)
+
+	p, err := New(&config.Config{
+		EventsTransport: config.EventsNATS,
+		EventsBrokers:   []string{ln.Addr().String()},
+		EventsTopic:     "av-scanner.scans",
+		EventsQueueSize: 10,
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer p.Close()
+
+	p.Publish("file-1", nil, map[string]string{"status": "infected"})
+	if got := receive(t, received); got != `{"status":"infected"}` {
+		t.Errorf("unexpected payload %q", got)
+	}
+	p.Publish("file-2", map[string]string{"X-Request-ID": "req-1", "traceparent": "00-abc-def-01"}, map[string]string{"status": "clean"})
+	want := "NATS/1.0\r\nX-Request-ID: req-1\r\ntraceparent: 00-abc-def-01\r\n\r\n" + `{"status":"clean"}`
+	if got := receive(t, received); got != want {
+		t.Errorf("unexpected message %q", got)
+	}
+}
+
+// fakeKafka answers metadata and produce requests on one connection at a
+// time, reporting each record's key and value. With plain set, each
+// connection must first authenticate with SASL PLAIN sending it.
+func fakeKafka(t *testing.T, ln net.Listener, topic, plain string, received chan<- string) {
+	host, portText, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		authenticated := plain == ""
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				break
+			}
+			req := make([]byte, binary.BigEndian.Uint32(size[:]))
+			io.ReadFull(conn, req)
+			r := &kafkaReader{buf: req}
+			apiKey, version, correlationID := r.int16(), r.int16(), r.int32()
+			r.string() // client ID
+
+			resp := binary.BigEndian.AppendUint32(nil, uint32(correlationID))
+			switch {
+			case apiKey == kafkaSASLHandshake && version == 1:
+				if mechanism := r.string(); mechanism != "PLAIN" {
+					t.Errorf("unexpected mechanism %s", mechanism)
+				}
+				resp = binary.BigEndian.AppendUint16(resp, 0)
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = appendKafkaString(resp, "PLAIN")
+			case apiKey == kafkaSASLAuth && version == 0:
+				if authenticated = string(r.bytes()) == plain; authenticated {
+					resp = binary.BigEndian.AppendUint16(resp, 0)
+				} else {
+					resp = binary.BigEndian.AppendUint16(resp, 58) // SASL_AUTHENTICATION_FAILED
+				}
+				resp = binary.BigEndian.AppendUint16(resp, 0xffff) // message
+				resp = binary.BigEndian.AppendUint32(resp, 0)      // auth bytes
+			case !authenticated:
+				t.Errorf("request %d before authenticating", apiKey)
+				conn.Close()
+				continue
+			case apiKey == kafkaMetadata && version == kafkaMetadataVersion:
+				resp = binary.BigEndian.AppendUint32(resp, 0) // throttle
+				resp = binary.BigEndian.AppendUint32(resp, 1) // brokers
+				resp = binary.BigEndian.AppendUint32(resp, 7)
+				resp = appendKafkaString(resp, host)
+				resp = binary.BigEndian.AppendUint32(resp, uint32(port))
+				resp = binary.BigEndian.AppendUint16(resp, 0xffff) // rack
+				resp = binary.BigEndian.AppendUint16(resp, 0xffff) // cluster ID
+				resp = binary.BigEndian.AppendUint32(resp, 7)      // controller
+				resp = binary.BigEndian.AppendUint32(resp, 1)      // topics
+				resp = binary.BigEndian.AppendUint16(resp, 0)      // error
+				resp = appendKafkaString(resp, topic)
+				resp = append(resp, 0)                        // internal
+				resp = binary.BigEndian.AppendUint32(resp, 1) // partitions
+				resp = binary.BigEndian.AppendUint16(resp, 0) // error
+				resp = binary.BigEndian.AppendUint32(resp, 0) // index
+				resp = binary.BigEndian.AppendUint32(resp, 7) // leader
+				resp = binary.BigEndian.AppendUint32(resp, 0) // replicas
+				resp = binary.BigEndian.AppendUint32(resp, 0) // isr
+			case apiKey == kafkaProduce && version == kafkaProduceVersion:
+				r.string() // transactional ID
+				if acks := r.int16(); acks != -1 {
+					t.Errorf("expected acks=all, got %d", acks)
+				}
+				r.int32()    // timeout
+				r.arrayLen() // topics
+				r.string()
+				r.arrayLen() // partitions
+				r.int32()
+				batch := r.take(int(r.int32()))
+				received <- decodeRecord(t, batch)
+
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = appendKafkaString(resp, topic)
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = binary.BigEndian.AppendUint32(resp, 0)          // index
+				resp = binary.BigEndian.AppendUint16(resp, 0)          // error
+				resp = binary.BigEndian.AppendUint64(resp, 0)          // base offset
+				resp = binary.BigEndian.AppendUint64(resp, ^uint64(0)) // log append time
+				resp = binary.BigEndian.AppendUint32(resp, 0)          // throttle
+			default:
+				t.Errorf("unexpected request %d v%d", apiKey, version)
+			}
+			conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(resp))), resp...))
+		}
+		conn.Close()
+	}
+}
+
+// decodeRecord checks a record batch and returns "key=value" of its record,
+// followed by ";name=value" for each header
+func decodeRecord(t *testing.T, batch []byte) string {
+	r := &kafkaReader{buf: batch}
+	r.int64() // base offset
+	if length := r.int32(); int(length) != len(r.buf) {
+		t.Errorf("batch length %d, %d bytes follow", length, len(r.buf))
+	}
+	r.int32() // leader epoch
+	if magic := r.int8(); magic != 2 {
+		t.Errorf("unexpected magic %d", magic)
+	}
+	if crc := uint32(r.int32()); crc != crc32.Checksum(r.buf, castagnoli) {
+		t.Error("batch CRC mismatch")
+	}
+	r.take(2 + 4 + 8 + 8 + 8 + 2 + 4) // attributes through base sequence
+	if count := r.int32(); count != 1 {
+		t.Errorf("expected one record, got %d", count)
+	}
+
+	rec := r.buf
+	varint := func() int64 {
+		v, n := binary.Varint(rec)
+		rec = rec[n:]
+		return v
+	}
+	varint()      // length
+	rec = rec[1:] // attributes
+	varint()      // timestamp delta
+	varint()      // offset delta
+	key := string(rec[:varint()])
+	rec = rec[len(key):]
+	value := string(rec[:varint()])
+	rec = rec[len(value):]
+	result := key + "=" + value
+	for range varint() {
+		name := string(rec[:varint()])
+		rec = rec[len(name):]
+		headerValue := string(rec[:varint()])
+		rec = rec[len(headerValue):]
+		result += ";" + name + "=" + headerValue
+	}
+	return result
+}
+
+func TestPublisher_Kafka(t *testing.T) {
+	ln := listen(t)
+	received := make(chan string, 1)
+	go fakeKafka(t, ln, "scans", "", received)
+
+	p, err := New(&config.Config{
+		EventsTransport: config.EventsKafka,
+		EventsBrokers:   []string{ln.Addr().String()},
+		EventsTopic:     "scans",
+		EventsQueueSize: 10,
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer p.Close()
+
+	p.Publish("file-1", nil, map[string]string{"status": "clean"})
+	if got := receive(t, received); got != `file-1={"status":"clean"}` {
+		t.Errorf("unexpected record %q", got)
+	}
+	p.Publish("file-2", map[string]string{"traceparent": "00-abc-def-01", "X-Request-ID": "req-1"}, map[string]string{"status": "infected"})
+	if got := receive(t, received); got != `file-2={"status":"infected"};X-Request-ID=req-1;traceparent=00-abc-def-01` {
+		t.Errorf("unexpected record %q", got)
+	}
+}
+
+// blockingSink never finishes sending, so the queue fills up
+type blockingSink struct{ release chan struct{} }
+
+func (b *blockingSink) send(string, map[string]string, []byte) error { <-b.release; return nil }
+func (b *blockingSink) close()                                       {}
+
+func TestPublisher_DropsWhenFull(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	p := newPublisher(sink, 1, testLogger())
+
+	// The first event is being sent, the second waits, the third is dropped
+	for i := range 3 {
+		p.Publish(strconv.Itoa(i), nil, i)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(p.queue) != 1 {
+		t.Errorf("expected one queued event, got %d", len(p.queue))
+	}
+	close(sink.release)
+	p.Close()
+}
+
+func TestNew_Disabled(t *testing.T) {
+	if p, err := New(&config.Config{}, testLogger()); p != nil || err != nil {
+		t.Errorf("expected no publisher, got %v (%v)", p, err)
+	}
+}
+
+func TestPublisher_PublishAfterClose(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	close(sink.release)
+	p := newPublisher(sink, 1, testLogger())
+	p.Close()
+
+	// Scans still running after a shutdown timeout must not panic
+	p.Publish("late", nil, "event")
+	p.Close()
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1 and its PEM encoding
+func selfSignedCert(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPublisher_KafkaTLSAndSASL(t *testing.T) {
+	cert, caPEM := selfSignedCert(t)
+	ln := tls.NewListener(listen(t), &tls.Config{Certificates: []tls.Certificate{cert}})
+	received := make(chan string, 1)
+	go fakeKafka(t, ln, "scans", "\x00scanner\x00secret", received)
+
+	p, err := New(&config.Config{
+		EventsTransport:     config.EventsKafka,
+		EventsBrokers:       []string{ln.Addr().String()},
+		EventsTopic:         "scans",
+		EventsQueueSize:     10,
+		EventsTLS:           true,
+		EventsTLSCAFile:     writeFile(t, "ca.pem", string(caPEM)),
+		EventsSASLMechanism: config.SASLPlain,
+		EventsUsername:      "scanner",
+		EventsPasswordFile:  writeFile(t, "password", "secret\n"),
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer p.Close()
+
+	p.Publish("file-1", nil, map[string]string{"status": "clean"})
+	if got := receive(t, received); got != `file-1={"status":"clean"}` {
+		t.Errorf("unexpected record %q", got)
+	}
+}
+
+func TestPublisher_NATSAuth(t *testing.T) {
+	ln := listen(t)
+	received := make(chan string, 1)
+	go fakeNATS(t, ln, "scanner", received)
+
+	p, err := New(&config.Config{
+		EventsTransport:    config.EventsNATS,
+		EventsBrokers:      []string{ln.Addr().String()},
+		EventsTopic:        "av-scanner.scans",
+		EventsQueueSize:    10,
+		EventsUsername:     "scanner",
+		EventsPasswordFile: writeFile(t, "password", "secret"),
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer p.Close()
+
+	p.Publish("file-1", nil, map[string]string{"status": "clean"})
+	if got := receive(t, received); got != `{"status":"clean"}` {
+		t.Errorf("unexpected payload %q", got)
+	}
+}
+
+// TestScram runs the SCRAM-SHA-256 example exchange from RFC 7677
+func TestScram(t *testing.T) {
+	const serverFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	var sent []string
+	exchange := func(message []byte) ([]byte, error) {
+		sent = append(sent, string(message))
+		if len(sent) == 1 {
+			return []byte(serverFirst), nil
+		}
+		return []byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="), nil
+	}
+	if err := newScram(sha256.New, "user", "pencil", "rOprNGfwEbeRWgbNEkqO").run(exchange); err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	want := []string{
+		"n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+	}
+	if !slices.Equal(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+
+	if err := newScram(sha256.New, "user", "wrong", "rOprNGfwEbeRWgbNEkqO").run(func(message []byte) ([]byte, error) {
+		if strings.HasPrefix(string(message), "n,,") {
+			return []byte(serverFirst), nil
+		}
+		return []byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="), nil
+	}); err == nil {
+		t.Error("expected a server signature mismatch with the wrong password")
+	}
+}
@@ -0,0 +1,393 @@
+package events
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Kafka protocol API keys and the versions used. Produce v3 is the first
+// with record batches and the oldest Kafka 4 accepts.
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 4
+	kafkaSASLHandshake   = 17
+	kafkaSASLAuth        = 36
+	kafkaClientID        = "av-scanner"
+	kafkaProduceTimeout  = 5000 // milliseconds the leader waits for replicas
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type kafkaPartition struct {
+	id     int32
+	leader int32
+}
+
+// kafkaSink is a minimal producer: it looks up partition leaders, picks a
+// partition by key, and sends one record per request with acks=all
+type kafkaSink struct {
+	bootstrap []string
+	topic     string
+	dialer    *dialer
+
+	brokers       map[int32]string // node ID to host:port
+	partitions    []kafkaPartition
+	conns         map[int32]*kafkaConn
+	correlationID int32
+}
+
+type kafkaConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func newKafkaSink(bootstrap []string, topic string, d *dialer) *kafkaSink {
+	return &kafkaSink{bootstrap: bootstrap, topic: topic, dialer: d, conns: make(map[int32]*kafkaConn)}
+}
+
+func (k *kafkaSink) send(key string, headers map[string]string, value []byte) error {
+	if k.partitions == nil {
+		if err := k.refreshMetadata(); err != nil {
+			return err
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	partition := k.partitions[h.Sum32()%uint32(len(k.partitions))]
+
+	conn, err := k.brokerConn(partition.leader)
+	if err == nil {
+		err = k.produce(conn, partition.id, []byte(key), headers, value)
+	}
+	if err != nil {
+		// Leaders may have moved; look them up again on the next send
+		k.close()
+		return fmt.Errorf("kafka produce to %s/%d: %w", k.topic, partition.id, err)
+	}
+	return nil
+}
+
+func (k *kafkaSink) close() {
+	for id, conn := range k.conns {
+		conn.Close()
+		delete(k.conns, id)
+	}
+	k.partitions = nil
+}
+
+func (k *kafkaSink) brokerConn(node int32) (*kafkaConn, error) {
+	if conn := k.conns[node]; conn != nil {
+		return conn, nil
+	}
+	addr, ok := k.brokers[node]
+	if !ok {
+		return nil, fmt.Errorf("unknown broker %d", node)
+	}
+	conn, err := k.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	k.conns[node] = conn
+	return conn, nil
+}
+
+// dial connects to a broker and authenticates with SASL if configured
+func (k *kafkaSink) dial(addr string) (*kafkaConn, error) {
+	netConn, err := k.dialer.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &kafkaConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+	if k.dialer.mechanism != "" {
+		if err := k.authenticate(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("SASL %s: %w", k.dialer.mechanism, err)
+		}
+	}
+	return conn, nil
+}
+
+// refreshMetadata asks the bootstrap brokers, in turn, for the topic's
+// partition leaders
+func (k *kafkaSink) refreshMetadata() error {
+	var lastErr error
+	for _, addr := range k.bootstrap {
+		conn, err := k.dial(addr)
+		if err != nil {
+			lastErr = fmt.Errorf("kafka %s: %w", addr, err)
+			continue
+		}
+		err = k.metadata(conn)
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+		lastErr = fmt.Errorf("kafka %s: %w", addr, err)
+	}
+	return lastErr
+}
+
+func (k *kafkaSink) metadata(conn *kafkaConn) error {
+	req := binary.BigEndian.AppendUint32(nil, 1) // topics
+	req = appendKafkaString(req, k.topic)
+	req = append(req, 1) // allow auto topic creation, if the broker does
+	resp, err := k.roundTrip(conn, kafkaMetadata, kafkaMetadataVersion, req)
+	if err != nil {
+		return err
+	}
+
+	r := &kafkaReader{buf: resp}
+	r.int32() // throttle time
+	brokers := make(map[int32]string)
+	for range r.arrayLen() {
+		node := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.string() // rack
+		brokers[node] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.string() // cluster ID
+	r.int32()  // controller ID
+
+	var partitions []kafkaPartition
+	var topicErr int16
+	for range r.arrayLen() {
+		errorCode := r.int16()
+		name := r.string()
+		r.int8() // is internal
+		for range r.arrayLen() {
+			partitionErr := r.int16()
+			partition := kafkaPartition{id: r.int32(), leader: r.int32()}
+			r.int32Array() // replicas
+			r.int32Array() // in-sync replicas
+			if name == k.topic && partitionErr == 0 && partition.leader >= 0 {
+				partitions = append(partitions, partition)
+			}
+		}
+		if name == k.topic {
+			topicErr = errorCode
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("invalid metadata response: %w", r.err)
+	}
+	if topicErr != 0 {
+		return fmt.Errorf("topic %s: error code %d", k.topic, topicErr)
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s has no available partitions", k.topic)
+	}
+	k.brokers = brokers
+	k.partitions = partitions
+	return nil
+}
+
+func (k *kafkaSink) produce(conn *kafkaConn, partition int32, key []byte, headers map[string]string, value []byte) error {
+	batch := recordBatch(key, headers, value, time.Now())
+
+	req := binary.BigEndian.AppendUint16(nil, 0xffff) // no transactional ID
+	req = binary.BigEndian.AppendUint16(req, 0xffff)  // acks=all
+	req = binary.BigEndian.AppendUint32(req, kafkaProduceTimeout)
+	req = binary.BigEndian.AppendUint32(req, 1) // topics
+	req = appendKafkaString(req, k.topic)
+	req = binary.BigEndian.AppendUint32(req, 1) // partitions
+	req = binary.BigEndian.AppendUint32(req, uint32(partition))
+	req = binary.BigEndian.AppendUint32(req, uint32(len(batch)))
+	req = append(req, batch...)
+	resp, err := k.roundTrip(conn, kafkaProduce, kafkaProduceVersion, req)
+	if err != nil {
+		return err
+	}
+
+	r := &kafkaReader{buf: resp}
+	for range r.arrayLen() {
+		r.string() // topic
+		for range r.arrayLen() {
+			r.int32() // partition
+			if errorCode := r.int16(); errorCode != 0 && r.err == nil {
+				return fmt.Errorf("error code %d", errorCode)
+			}
+			r.int64() // base offset
+			r.int64() // log append time
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("invalid produce response: %w", r.err)
+	}
+	return nil
+}
+
+// roundTrip sends a request and returns the response body after the
+// correlation ID
+func (k *kafkaSink) roundTrip(conn *kafkaConn, apiKey, version int16, body []byte) ([]byte, error) {
+	k.correlationID++
+	header := binary.BigEndian.AppendUint16(nil, uint16(apiKey))
+	header = binary.BigEndian.AppendUint16(header, uint16(version))
+	header = binary.BigEndian.AppendUint32(header, uint32(k.correlationID))
+	header = appendKafkaString(header, kafkaClientID)
+
+	msg := binary.BigEndian.AppendUint32(nil, uint32(len(header)+len(body)))
+	msg = append(append(msg, header...), body...)
+
+	conn.SetDeadline(time.Now().Add(dialTimeout + kafkaProduceTimeout*time.Millisecond))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(conn.reader, size[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length < 4 || length > 16*1024*1024 {
+		return nil, fmt.Errorf("invalid response size %d", length)
+	}
+	resp := make([]byte, length)
+	if _, err := io.ReadFull(conn.reader, resp); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != k.correlationID {
+		return nil, fmt.Errorf("response for request %d, expected %d", id, k.correlationID)
+	}
+	return resp[4:], nil
+}
+
+// recordBatch encodes a single record as a magic v2 record batch
+func recordBatch(key []byte, headers map[string]string, value []byte, now time.Time) []byte {
+	var rec []byte
+	rec = append(rec, 0)              // attributes
+	rec = binary.AppendVarint(rec, 0) // timestamp delta
+	rec = binary.AppendVarint(rec, 0) // offset delta
+	rec = binary.AppendVarint(rec, int64(len(key)))
+	rec = append(rec, key...)
+	rec = binary.AppendVarint(rec, int64(len(value)))
+	rec = append(rec, value...)
+	rec = binary.AppendVarint(rec, int64(len(headers)))
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		rec = binary.AppendVarint(rec, int64(len(name)))
+		rec = append(rec, name...)
+		rec = binary.AppendVarint(rec, int64(len(headers[name])))
+		rec = append(rec, headers[name]...)
+	}
+	record := append(binary.AppendVarint(nil, int64(len(rec))), rec...)
+
+	// Everything after the CRC is covered by it
+	timestamp := uint64(now.UnixMilli())
+	body := binary.BigEndian.AppendUint16(nil, 0)          // attributes
+	body = binary.BigEndian.AppendUint32(body, 0)          // last offset delta
+	body = binary.BigEndian.AppendUint64(body, timestamp)  // base timestamp
+	body = binary.BigEndian.AppendUint64(body, timestamp)  // max timestamp
+	body = binary.BigEndian.AppendUint64(body, ^uint64(0)) // no producer ID
+	body = binary.BigEndian.AppendUint16(body, 0xffff)     // no producer epoch
+	body = binary.BigEndian.AppendUint32(body, 0xffffffff) // no base sequence
+	body = binary.BigEndian.AppendUint32(body, 1)          // records
+	body = append(body, record...)
+
+	batch := binary.BigEndian.AppendUint64(nil, 0)                    // base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(9+len(body))) // length after this field
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff)          // partition leader epoch
+	batch = append(batch, 2)                                          // magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, castagnoli))
+	return append(batch, body...)
+}
+
+func appendKafkaString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendKafkaBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+var errKafkaShort = errors.New("response too short")
+
+// kafkaReader decodes big-endian fields, recording the first error
+type kafkaReader struct {
+	buf []byte
+	err error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil || n < 0 || len(r.buf) < n {
+		r.err = errKafkaShort
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *kafkaReader) int8() int8 {
+	if b := r.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a nullable string; null reads as empty
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
+
+// arrayLen returns an array's length, 0 for null or after an error
+func (r *kafkaReader) arrayLen() int {
+	n := r.int32()
+	if n < 0 || r.err != nil || int(n) > len(r.buf) {
+		return 0
+	}
+	return int(n)
+}
+
+// bytes reads a nullable byte array; null reads as nil
+func (r *kafkaReader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	return r.take(int(n))
+}
+
+func (r *kafkaReader) int32Array() {
+	for range r.arrayLen() {
+		r.int32()
+	}
+}
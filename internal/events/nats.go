@@ -0,0 +1,206 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsSink publishes with the NATS client protocol. Core NATS has no
+// acknowledgements, so a message is sent once it is written to the server.
+type natsSink struct {
+	servers []string
+	subject string
+	dialer  *dialer
+	next    int // index of the server tried first on reconnect
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newNATSSink(servers []string, subject string, d *dialer) *natsSink {
+	return &natsSink{servers: servers, subject: subject, dialer: d}
+}
+
+// send publishes value to the subject, with HPUB when there are headers.
+// NATS messages have no key; the event itself carries the file ID.
+func (n *natsSink) send(_ string, headers map[string]string, value []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+	n.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	var err error
+	if len(headers) == 0 {
+		_, err = fmt.Fprintf(n.conn, "PUB %s %d\r\n%s\r\n", n.subject, len(value), value)
+	} else {
+		header := natsHeader(headers)
+		_, err = fmt.Fprintf(n.conn, "HPUB %s %d %d\r\n%s%s\r\n", n.subject, len(header), len(header)+len(value), header, value)
+	}
+	if err != nil {
+		n.disconnect(n.conn)
+		return err
+	}
+	return nil
+}
+
+// natsHeader encodes message headers in the NATS/1.0 format
+func natsHeader(headers map[string]string) string {
+	var b strings.Builder
+	b.WriteString("NATS/1.0\r\n")
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, headers[name])
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func (n *natsSink) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil {
+		n.disconnect(n.conn)
+	}
+}
+
+// connect tries each server in turn, starting after the last one that failed
+func (n *natsSink) connect() error {
+	var lastErr error
+	for i := range n.servers {
+		server := n.servers[(n.next+i)%len(n.servers)]
+		conn, reader, err := n.handshake(server)
+		if err != nil {
+			lastErr = fmt.Errorf("nats %s: %w", server, err)
+			continue
+		}
+		n.next = (n.next + i) % len(n.servers)
+		n.conn = conn
+		go n.readLoop(conn, reader)
+		return nil
+	}
+	n.next = (n.next + 1) % len(n.servers)
+	return lastErr
+}
+
+// disconnect closes conn if it is still the current connection; mu is held
+func (n *natsSink) disconnect(conn net.Conn) {
+	conn.Close()
+	if n.conn == conn {
+		n.conn = nil
+	}
+}
+
+// readLoop answers server keepalives. A server error or a closed connection
+// drops the connection so the next send reconnects.
+func (n *natsSink) readLoop(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err == nil && strings.HasPrefix(line, "PING") {
+			n.mu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+			_, err = conn.Write([]byte("PONG\r\n"))
+			n.mu.Unlock()
+		}
+		if err != nil || strings.HasPrefix(line, "-ERR") {
+			n.mu.Lock()
+			n.disconnect(conn)
+			n.mu.Unlock()
+			return
+		}
+	}
+}
+
+// natsConnect is the CONNECT message. With a user the password
+// authenticates it; without one the password is a token.
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Protocol    int    `json:"protocol"`
+	Headers     bool   `json:"headers"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// handshake connects, starts TLS after the server's INFO if configured,
+// and waits for the PONG that confirms the server accepted the CONNECT
+func (n *natsSink) handshake(server string) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", server, dialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	reader := bufio.NewReader(conn)
+
+	fail := func(err error) (net.Conn, *bufio.Reader, error) {
+		conn.Close()
+		return nil, nil, err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return fail(err)
+	}
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fail(fmt.Errorf("unexpected greeting: %q", strings.TrimSpace(line)))
+	}
+	var serverInfo struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(info), &serverInfo)
+
+	d := n.dialer
+	switch {
+	case d.tls != nil:
+		if conn, err = d.upgrade(conn, server); err != nil {
+			return nil, nil, err
+		}
+		conn.SetDeadline(time.Now().Add(dialTimeout))
+		reader = bufio.NewReader(conn)
+	case serverInfo.TLSRequired:
+		return fail(errors.New("server requires TLS"))
+	}
+
+	connect := natsConnect{
+		TLSRequired: d.tls != nil,
+		Name:        "av-scanner",
+		Lang:        "go",
+		Protocol:    1,
+		Headers:     true,
+	}
+	if d.username != "" {
+		connect.User, connect.Pass = d.username, d.password
+	} else {
+		connect.AuthToken = d.password
+	}
+	payload, _ := json.Marshal(connect)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", payload); err != nil {
+		return fail(err)
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fail(err)
+		}
+		switch {
+		case strings.HasPrefix(line, "PONG"):
+			conn.SetDeadline(time.Time{})
+			return conn, reader, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fail(errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))))
+		}
+	}
+}
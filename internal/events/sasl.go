@@ -0,0 +1,171 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// authenticate runs a SASL exchange on a new broker connection:
+// SaslHandshake v1 picks the mechanism, then each message is carried by
+// SaslAuthenticate v0
+func (k *kafkaSink) authenticate(conn *kafkaConn) error {
+	mechanism := string(k.dialer.mechanism)
+	resp, err := k.roundTrip(conn, kafkaSASLHandshake, 1, appendKafkaString(nil, mechanism))
+	if err != nil {
+		return err
+	}
+	r := &kafkaReader{buf: resp}
+	if errorCode := r.int16(); errorCode != 0 {
+		var enabled []string
+		for range r.arrayLen() {
+			enabled = append(enabled, r.string())
+		}
+		return fmt.Errorf("mechanism not enabled (broker offers %s)", strings.Join(enabled, ", "))
+	}
+
+	exchange := func(message []byte) ([]byte, error) {
+		resp, err := k.roundTrip(conn, kafkaSASLAuth, 0, appendKafkaBytes(nil, message))
+		if err != nil {
+			return nil, err
+		}
+		r := &kafkaReader{buf: resp}
+		errorCode := r.int16()
+		errorMessage := r.string()
+		reply := r.bytes()
+		if r.err != nil {
+			return nil, fmt.Errorf("invalid authenticate response: %w", r.err)
+		}
+		if errorCode != 0 {
+			return nil, fmt.Errorf("error code %d: %s", errorCode, errorMessage)
+		}
+		return reply, nil
+	}
+
+	switch k.dialer.mechanism {
+	case config.SASLPlain:
+		_, err = exchange([]byte("\x00" + k.dialer.username + "\x00" + k.dialer.password))
+		return err
+	case config.SASLScramSHA256:
+		return newScram(sha256.New, k.dialer.username, k.dialer.password, "").run(exchange)
+	case config.SASLScramSHA512:
+		return newScram(sha512.New, k.dialer.username, k.dialer.password, "").run(exchange)
+	}
+	return fmt.Errorf("unsupported mechanism")
+}
+
+// scram is the client side of SCRAM (RFC 5802) without channel binding
+type scram struct {
+	hash     func() hash.Hash
+	username string
+	password string
+	nonce    string
+}
+
+// newScram returns a SCRAM client; an empty nonce is generated
+func newScram(h func() hash.Hash, username, password, nonce string) *scram {
+	if nonce == "" {
+		random := make([]byte, 24)
+		rand.Read(random)
+		nonce = base64.RawStdEncoding.EncodeToString(random)
+	}
+	return &scram{hash: h, username: username, password: password, nonce: nonce}
+}
+
+// run performs the exchange, verifying the server's signature at the end
+func (s *scram) run(exchange func([]byte) ([]byte, error)) error {
+	username := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s.username)
+	clientFirstBare := "n=" + username + ",r=" + s.nonce
+	serverFirst, err := exchange([]byte("n,," + clientFirstBare))
+	if err != nil {
+		return err
+	}
+
+	fields := scramFields(string(serverFirst))
+	salt, err := base64.StdEncoding.DecodeString(fields["s"])
+	iterations, iterErr := strconv.Atoi(fields["i"])
+	switch {
+	case !strings.HasPrefix(fields["r"], s.nonce) || len(fields["r"]) == len(s.nonce):
+		return errors.New("server nonce does not extend ours")
+	case err != nil || len(salt) == 0:
+		return errors.New("invalid salt")
+	case iterErr != nil || iterations < 1:
+		return errors.New("invalid iteration count")
+	}
+
+	clientFinalBare := "c=biws,r=" + fields["r"]
+	authMessage := clientFirstBare + "," + string(serverFirst) + "," + clientFinalBare
+	salted := pbkdf2Key(s.hash, []byte(s.password), salt, iterations, s.hash().Size())
+	clientKey := s.hmac(salted, "Client Key")
+	h := s.hash()
+	h.Write(clientKey)
+	proof := s.hmac(h.Sum(nil), authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+
+	serverFinal, err := exchange([]byte(clientFinalBare + ",p=" + base64.StdEncoding.EncodeToString(proof)))
+	if err != nil {
+		return err
+	}
+	fields = scramFields(string(serverFinal))
+	if e := fields["e"]; e != "" {
+		return fmt.Errorf("server rejected authentication: %s", e)
+	}
+	signature, err := base64.StdEncoding.DecodeString(fields["v"])
+	if err != nil || !hmac.Equal(signature, s.hmac(s.hmac(salted, "Server Key"), authMessage)) {
+		return errors.New("invalid server signature")
+	}
+	return nil
+}
+
+func (s *scram) hmac(key []byte, message string) []byte {
+	mac := hmac.New(s.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// scramFields parses "r=...,s=...,i=..." attributes
+func scramFields(message string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(message, ",") {
+		if name, value, ok := strings.Cut(field, "="); ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// pbkdf2Key derives a key with PBKDF2 (RFC 8018) using HMAC over h
+func pbkdf2Key(h func() hash.Hash, password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(h, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLength; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := bytes.Clone(u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength]
+}
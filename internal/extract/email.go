@@ -0,0 +1,146 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MaxAttachments caps how many attachments are extracted from one message
+	MaxAttachments = 100
+)
+
+// ErrNotContainer is returned when a file is not a supported container format
+var ErrNotContainer = errors.New("not a supported container")
+
+// Attachment is a file extracted from a container such as an email
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// IsEmail reports whether a file looks like an email export (.eml or .msg)
+func IsEmail(fileName, mimeType string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".eml", ".msg":
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	return mediaType == "message/rfc822" || mediaType == "application/vnd.ms-outlook"
+}
+
+// EmailAttachments extracts attachments from an .eml (RFC 5322/MIME) or
+// Outlook .msg (OLE compound file) message. Returns ErrNotContainer if the
+// file is neither.
+func EmailAttachments(filePath, fileName, mimeType string) ([]Attachment, error) {
+	if !IsEmail(fileName, mimeType) {
+		return nil, ErrNotContainer
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, cfbSignature) {
+		return msgAttachments(data)
+	}
+	return emlAttachments(bytes.NewReader(data))
+}
+
+func emlAttachments(r io.Reader) ([]Attachment, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+
+	var attachments []Attachment
+	err = walkMIMEPart(textproto.MIMEHeader(msg.Header), msg.Body, &attachments)
+	return attachments, err
+}
+
+func walkMIMEPart(header textproto.MIMEHeader, body io.Reader, attachments *[]Attachment) error {
+	if len(*attachments) >= MaxAttachments {
+		return nil
+	}
+
+	contentType := header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read MIME part: %w", err)
+			}
+			if err := walkMIMEPart(part.Header, part, attachments); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if name != "" {
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+			name = decoded
+		}
+	}
+
+	// Inline text bodies are not attachments; embedded messages always are
+	if disposition != "attachment" && name == "" && mediaType != "message/rfc822" {
+		return nil
+	}
+	if name == "" {
+		name = "attachment"
+		if mediaType == "message/rfc822" {
+			name = "message.eml"
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("failed to decode attachment %q: %w", name, err)
+	}
+
+	*attachments = append(*attachments, Attachment{
+		Name:        name,
+		ContentType: mediaType,
+		Data:        data,
+	})
+	return nil
+}
+
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
@@ -0,0 +1,280 @@
+package extract
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const testEML = "From: sender@example.com\r\n" +
+	"To: recipient@example.com\r\n" +
+	"Subject: Quarterly report\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Please see attached.\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Please see attached.</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"report.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"JSVFT0YK\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain; name=\"=?utf-8?q?notes_=C3=A9t=C3=A9.txt?=\"\r\n" +
+	"Content-Disposition: attachment\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"caf=C3=A9\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"From: a@example.com\r\n" +
+	"Subject: forwarded\r\n" +
+	"\r\n" +
+	"body\r\n" +
+	"--outer--\r\n"
+
+func TestIsEmail(t *testing.T) {
+	tests := []struct {
+		fileName string
+		mimeType string
+		expected bool
+	}{
+		{"mail.eml", "", true},
+		{"MAIL.MSG", "", true},
+		{"export", "message/rfc822", true},
+		{"export", "application/vnd.ms-outlook", true},
+		{"report.pdf", "application/pdf", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsEmail(tt.fileName, tt.mimeType); got != tt.expected {
+			t.Errorf("IsEmail(%q, %q) = %v, expected %v", tt.fileName, tt.mimeType, got, tt.expected)
+		}
+	}
+}
+
+func TestEmailAttachments_EML(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "mail.eml")
+	if err := os.WriteFile(filePath, []byte(testEML), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	attachments, err := EmailAttachments(filePath, "mail.eml", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attachments) != 3 {
+		t.Fatalf("expected 3 attachments, got %d", len(attachments))
+	}
+
+	if attachments[0].Name != "report.pdf" || string(attachments[0].Data) != "%PDF-1.4\n%%EOF\n" {
+		t.Errorf("unexpected pdf attachment: %q %q", attachments[0].Name, attachments[0].Data)
+	}
+	if attachments[1].Name != "notes été.txt" || string(attachments[1].Data) != "café" {
+		t.Errorf("unexpected text attachment: %q %q", attachments[1].Name, attachments[1].Data)
+	}
+	if attachments[2].Name != "message.eml" || !strings.Contains(string(attachments[2].Data), "Subject: forwarded") {
+		t.Errorf("unexpected embedded message: %q %q", attachments[2].Name, attachments[2].Data)
+	}
+}
+
+func TestEmailAttachments_NotEmail(t *testing.T) {
+	if _, err := EmailAttachments("/nonexistent/report.pdf", "report.pdf", "application/pdf"); err != ErrNotContainer {
+		t.Errorf("expected ErrNotContainer, got %v", err)
+	}
+}
+
+func TestEmailAttachments_MSG(t *testing.T) {
+	large := []byte(strings.Repeat("A", 5000)) // above the mini stream cutoff
+
+	filePath := filepath.Join(t.TempDir(), "mail.msg")
+	data := buildTestMSG([]testMSGAttachment{
+		{name: "invoice.docx", data: []byte("small attachment")},
+		{name: "payload.bin", data: large},
+	})
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	attachments, err := EmailAttachments(filePath, "mail.msg", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(attachments))
+	}
+	if attachments[0].Name != "invoice.docx" || string(attachments[0].Data) != "small attachment" {
+		t.Errorf("unexpected first attachment: %q %q", attachments[0].Name, attachments[0].Data)
+	}
+	if attachments[1].Name != "payload.bin" || string(attachments[1].Data) != string(large) {
+		t.Errorf("unexpected second attachment: %q (%d bytes)", attachments[1].Name, len(attachments[1].Data))
+	}
+}
+
+func TestEmailAttachments_CorruptMSG(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "mail.msg")
+	data := append(append([]byte{}, cfbSignature...), make([]byte, 100)...)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	if _, err := EmailAttachments(filePath, "mail.msg", ""); err == nil {
+		t.Error("expected error for corrupt msg")
+	}
+}
+
+type testMSGAttachment struct {
+	name string
+	data []byte
+}
+
+type testCFBEntry struct {
+	name     string
+	kind     byte
+	data     []byte
+	children []int
+	start    uint32
+}
+
+// buildTestMSG writes a minimal version 3 compound file with the given
+// attachments. Streams below 4096 bytes go into the mini stream.
+func buildTestMSG(attachments []testMSGAttachment) []byte {
+	entries := []*testCFBEntry{{name: "Root Entry", kind: cfbTypeRoot}}
+	for i, a := range attachments {
+		storage := &testCFBEntry{name: msgAttachPrefix + strings.Repeat("0", 7) + string(rune('0'+i)), kind: cfbTypeStorage}
+		entries = append(entries, storage)
+		entries[0].children = append(entries[0].children, len(entries)-1)
+
+		nameUTF16 := utf16.Encode([]rune(a.name + "\x00"))
+		nameBytes := make([]byte, len(nameUTF16)*2)
+		for j, u := range nameUTF16 {
+			binary.LittleEndian.PutUint16(nameBytes[j*2:], u)
+		}
+		for _, s := range []*testCFBEntry{
+			{name: msgAttachData, kind: cfbTypeStream, data: a.data},
+			{name: msgAttachLongName, kind: cfbTypeStream, data: nameBytes},
+		} {
+			entries = append(entries, s)
+			storage.children = append(storage.children, len(entries)-1)
+		}
+	}
+
+	const ss = 512
+	var fat, miniFAT []uint32
+	var sectors [][]byte
+	alloc := func(data []byte) uint32 {
+		start := uint32(len(sectors))
+		for off := 0; off < len(data); off += ss {
+			sector := make([]byte, ss)
+			copy(sector, data[off:])
+			sectors = append(sectors, sector)
+			fat = append(fat, uint32(len(sectors)))
+		}
+		fat[len(fat)-1] = cfbEndOfChain
+		return start
+	}
+
+	// Sector 0 is reserved for the FAT
+	sectors = append(sectors, make([]byte, ss))
+	fat = append(fat, 0xFFFFFFFD)
+
+	var miniStream []byte
+	for _, e := range entries {
+		if e.kind != cfbTypeStream || len(e.data) >= 4096 {
+			continue
+		}
+		e.start = uint32(len(miniStream) / 64)
+		for off := 0; off < len(e.data); off += 64 {
+			chunk := make([]byte, 64)
+			copy(chunk, e.data[off:])
+			miniStream = append(miniStream, chunk...)
+			miniFAT = append(miniFAT, uint32(len(miniStream)/64))
+		}
+		miniFAT[len(miniFAT)-1] = cfbEndOfChain
+	}
+	for _, e := range entries {
+		if e.kind == cfbTypeStream && len(e.data) >= 4096 {
+			e.start = alloc(e.data)
+		}
+	}
+	entries[0].start = alloc(miniStream)
+	entries[0].data = miniStream
+
+	miniFATBytes := make([]byte, len(miniFAT)*4)
+	for i, v := range miniFAT {
+		binary.LittleEndian.PutUint32(miniFATBytes[i*4:], v)
+	}
+	miniFATStart := alloc(miniFATBytes)
+
+	dir := make([]byte, len(entries)*cfbDirEntrySize)
+	for i, e := range entries {
+		d := dir[i*cfbDirEntrySize:]
+		name := utf16.Encode([]rune(e.name + "\x00"))
+		for j, u := range name {
+			binary.LittleEndian.PutUint16(d[j*2:], u)
+		}
+		binary.LittleEndian.PutUint16(d[0x40:], uint16(len(name)*2))
+		d[0x42] = e.kind
+		binary.LittleEndian.PutUint32(d[0x44:], cfbNoStream)
+		binary.LittleEndian.PutUint32(d[0x48:], cfbNoStream)
+		binary.LittleEndian.PutUint32(d[0x4C:], cfbNoStream)
+		if len(e.children) > 0 {
+			binary.LittleEndian.PutUint32(d[0x4C:], uint32(e.children[0]))
+		}
+		binary.LittleEndian.PutUint32(d[0x74:], e.start)
+		binary.LittleEndian.PutUint64(d[0x78:], uint64(len(e.data)))
+	}
+	// Chain siblings through their right pointers
+	for _, e := range entries {
+		for j := 0; j+1 < len(e.children); j++ {
+			binary.LittleEndian.PutUint32(dir[e.children[j]*cfbDirEntrySize+0x48:], uint32(e.children[j+1]))
+		}
+	}
+	dirStart := alloc(dir)
+
+	for i, v := range fat {
+		binary.LittleEndian.PutUint32(sectors[0][i*4:], v)
+	}
+	for i := len(fat); i < ss/4; i++ {
+		binary.LittleEndian.PutUint32(sectors[0][i*4:], cfbFreeSect)
+	}
+
+	header := make([]byte, cfbHeaderSize)
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[0x1A:], 3)
+	binary.LittleEndian.PutUint16(header[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[0x1E:], 9)
+	binary.LittleEndian.PutUint16(header[0x20:], 6)
+	binary.LittleEndian.PutUint32(header[0x2C:], 1)
+	binary.LittleEndian.PutUint32(header[0x30:], dirStart)
+	binary.LittleEndian.PutUint32(header[0x38:], 4096)
+	binary.LittleEndian.PutUint32(header[0x3C:], miniFATStart)
+	binary.LittleEndian.PutUint32(header[0x40:], 1)
+	binary.LittleEndian.PutUint32(header[0x44:], cfbEndOfChain)
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(header[0x4C+i*4:], cfbFreeSect)
+	}
+	binary.LittleEndian.PutUint32(header[0x4C:], 0)
+
+	out := header
+	for _, s := range sectors {
+		out = append(out, s...)
+	}
+	return out
+}
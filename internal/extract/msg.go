@@ -0,0 +1,311 @@
+package extract
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Outlook .msg files are OLE compound files ([MS-CFB]) whose attachments live
+// in "__attach_version1.0_#XXXXXXXX" storages ([MS-OXMSG]).
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbHeaderSize   = 512
+	cfbDirEntrySize = 128
+	cfbNoStream     = 0xFFFFFFFF
+	cfbEndOfChain   = 0xFFFFFFFE
+	cfbFreeSect     = 0xFFFFFFFF
+
+	cfbTypeStorage = 1
+	cfbTypeStream  = 2
+	cfbTypeRoot    = 5
+
+	msgAttachPrefix      = "__attach_version1.0_#"
+	msgAttachData        = "__substg1.0_37010102" // PidTagAttachDataBinary
+	msgAttachLongName    = "__substg1.0_3707001F" // PidTagAttachLongFilename
+	msgAttachName        = "__substg1.0_3704001F" // PidTagAttachFilename
+	msgAttachLongNameA   = "__substg1.0_3707001E"
+	msgAttachNameA       = "__substg1.0_3704001E"
+	msgAttachMimeTag     = "__substg1.0_370E001F" // PidTagAttachMimeTag
+	msgAttachMimeTagA    = "__substg1.0_370E001E"
+	msgAttachEmbeddedMsg = "__substg1.0_3701000D" // embedded message object
+)
+
+var errCorruptCFB = errors.New("corrupt compound file")
+
+type cfbEntry struct {
+	name  string
+	kind  byte
+	left  uint32
+	right uint32
+	child uint32
+	start uint32
+	size  uint64
+}
+
+type cfbFile struct {
+	data       []byte
+	sectorSize int
+	miniSize   int
+	cutoff     uint64
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	entries    []cfbEntry
+}
+
+func parseCFB(data []byte) (*cfbFile, error) {
+	if len(data) < cfbHeaderSize {
+		return nil, errCorruptCFB
+	}
+	le := binary.LittleEndian
+
+	f := &cfbFile{
+		data:       data,
+		sectorSize: 1 << le.Uint16(data[0x1E:]),
+		miniSize:   1 << le.Uint16(data[0x20:]),
+		cutoff:     uint64(le.Uint32(data[0x38:])),
+	}
+	if f.sectorSize != 512 && f.sectorSize != 4096 {
+		return nil, fmt.Errorf("%w: unsupported sector size %d", errCorruptCFB, f.sectorSize)
+	}
+
+	// Collect FAT sector locations from the header DIFAT and any DIFAT sectors
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := le.Uint32(data[0x4C+i*4:]); s != cfbFreeSect {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	perDIFAT := f.sectorSize/4 - 1
+	difat := le.Uint32(data[0x44:])
+	for n := le.Uint32(data[0x48:]); n > 0 && difat < cfbEndOfChain; n-- {
+		sector, err := f.sector(difat)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perDIFAT; i++ {
+			if s := le.Uint32(sector[i*4:]); s != cfbFreeSect {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		difat = le.Uint32(sector[perDIFAT*4:])
+	}
+
+	for _, s := range fatSectors {
+		sector, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		f.fat = append(f.fat, toUint32s(sector)...)
+	}
+
+	dir, err := f.readChain(le.Uint32(data[0x30:]), -1)
+	if err != nil {
+		return nil, err
+	}
+	for off := 0; off+cfbDirEntrySize <= len(dir); off += cfbDirEntrySize {
+		e := dir[off : off+cfbDirEntrySize]
+		nameLen := int(le.Uint16(e[0x40:]))
+		if nameLen > 64 {
+			nameLen = 64
+		}
+		size := le.Uint64(e[0x78:])
+		if f.sectorSize == 512 {
+			size &= 0xFFFFFFFF
+		}
+		f.entries = append(f.entries, cfbEntry{
+			name:  decodeUTF16(e[:nameLen]),
+			kind:  e[0x42],
+			left:  le.Uint32(e[0x44:]),
+			right: le.Uint32(e[0x48:]),
+			child: le.Uint32(e[0x4C:]),
+			start: le.Uint32(e[0x74:]),
+			size:  size,
+		})
+	}
+	if len(f.entries) == 0 || f.entries[0].kind != cfbTypeRoot {
+		return nil, fmt.Errorf("%w: missing root entry", errCorruptCFB)
+	}
+
+	if miniFAT, err := f.readChain(le.Uint32(data[0x3C:]), -1); err == nil {
+		f.miniFAT = toUint32s(miniFAT)
+	}
+	root := f.entries[0]
+	if root.size > 0 {
+		if f.miniStream, err = f.readChain(root.start, int(root.size)); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (f *cfbFile) sector(n uint32) ([]byte, error) {
+	off := (int(n) + 1) * f.sectorSize
+	if n >= cfbEndOfChain || off < 0 || off+f.sectorSize > len(f.data) {
+		return nil, fmt.Errorf("%w: sector %d out of range", errCorruptCFB, n)
+	}
+	return f.data[off : off+f.sectorSize], nil
+}
+
+// readChain reads a FAT sector chain; size < 0 reads the whole chain
+func (f *cfbFile) readChain(start uint32, size int) ([]byte, error) {
+	var out []byte
+	for s, steps := start, 0; s < cfbEndOfChain; steps++ {
+		if steps > len(f.fat) || int(s) >= len(f.fat) {
+			return nil, fmt.Errorf("%w: invalid sector chain", errCorruptCFB)
+		}
+		sector, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sector...)
+		if size >= 0 && len(out) >= size {
+			break
+		}
+		s = f.fat[s]
+	}
+	if size >= 0 {
+		if len(out) < size {
+			return nil, fmt.Errorf("%w: stream truncated", errCorruptCFB)
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+func (f *cfbFile) readMiniChain(start uint32, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for s, steps := start, 0; s < cfbEndOfChain && len(out) < size; steps++ {
+		off := int(s) * f.miniSize
+		if steps > len(f.miniFAT) || int(s) >= len(f.miniFAT) || off+f.miniSize > len(f.miniStream) {
+			return nil, fmt.Errorf("%w: invalid mini sector chain", errCorruptCFB)
+		}
+		out = append(out, f.miniStream[off:off+f.miniSize]...)
+		s = f.miniFAT[s]
+	}
+	if len(out) < size {
+		return nil, fmt.Errorf("%w: mini stream truncated", errCorruptCFB)
+	}
+	return out[:size], nil
+}
+
+func (f *cfbFile) stream(e cfbEntry) ([]byte, error) {
+	if e.size < f.cutoff {
+		return f.readMiniChain(e.start, int(e.size))
+	}
+	return f.readChain(e.start, int(e.size))
+}
+
+// children returns the entries directly under a storage
+func (f *cfbFile) children(storage cfbEntry) []cfbEntry {
+	var out []cfbEntry
+	seen := make(map[uint32]bool)
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == cfbNoStream || int(id) >= len(f.entries) || seen[id] {
+			return
+		}
+		seen[id] = true
+		e := f.entries[id]
+		walk(e.left)
+		out = append(out, e)
+		walk(e.right)
+	}
+	walk(storage.child)
+	return out
+}
+
+func msgAttachments(data []byte) ([]Attachment, error) {
+	f, err := parseCFB(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse msg: %w", err)
+	}
+
+	var attachments []Attachment
+	for _, storage := range f.children(f.entries[0]) {
+		if storage.kind != cfbTypeStorage || !strings.HasPrefix(storage.name, msgAttachPrefix) {
+			continue
+		}
+		if len(attachments) >= MaxAttachments {
+			break
+		}
+
+		streams := make(map[string]cfbEntry)
+		for _, e := range f.children(storage) {
+			streams[e.name] = e
+		}
+
+		if _, ok := streams[msgAttachEmbeddedMsg]; ok {
+			// Embedded .msg objects are storages, not byte streams; scan them
+			// as part of the parent file only.
+			continue
+		}
+		dataEntry, ok := streams[msgAttachData]
+		if !ok || dataEntry.kind != cfbTypeStream {
+			continue
+		}
+		content, err := f.stream(dataEntry)
+		if err != nil {
+			return nil, err
+		}
+
+		name := f.stringProperty(streams, msgAttachLongName, msgAttachName, msgAttachLongNameA, msgAttachNameA)
+		if name == "" {
+			name = "attachment"
+		}
+
+		attachments = append(attachments, Attachment{
+			Name:        name,
+			ContentType: f.stringProperty(streams, msgAttachMimeTag, msgAttachMimeTagA),
+			Data:        content,
+		})
+	}
+	return attachments, nil
+}
+
+// stringProperty returns the first present string property; names ending in
+// 001F are UTF-16LE, 001E are 8-bit
+func (f *cfbFile) stringProperty(streams map[string]cfbEntry, names ...string) string {
+	for _, name := range names {
+		e, ok := streams[name]
+		if !ok {
+			continue
+		}
+		raw, err := f.stream(e)
+		if err != nil {
+			continue
+		}
+		var s string
+		if strings.HasSuffix(name, "001F") {
+			s = decodeUTF16(raw)
+		} else {
+			s = string(raw)
+		}
+		if s = strings.TrimRight(s, "\x00"); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, binary.LittleEndian.Uint16(b[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
+
+func toUint32s(b []byte) []uint32 {
+	out := make([]uint32, len(b)/4)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return out
+}
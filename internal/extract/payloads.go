@@ -0,0 +1,123 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxPayloads caps how many URLs, and how many base64 blobs, are taken
+	// from one text file
+	MaxPayloads = 20
+	// MaxTextSize bounds how much of a text file is searched for payloads
+	MaxTextSize = 10 * 1024 * 1024
+	// minBase64Length ignores short base64-looking runs such as hashes and
+	// tokens
+	minBase64Length = 128
+)
+
+var (
+	urlPattern = regexp.MustCompile("https?://[^\\s\"'<>()\\[\\]{}`]+")
+	// base64Line is a line of a wrapped base64 block, as in MIME or PEM
+	base64Line = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+	// base64Token is base64 inline in other text, such as a data: URI
+	base64Token = regexp.MustCompile(`[A-Za-z0-9+/]{` + strconv.Itoa(minBase64Length) + `,}={0,2}`)
+	// softLineBreak is a quoted-printable soft line break, which splits long
+	// URLs in email exports
+	softLineBreak = regexp.MustCompile(`=\r?\n`)
+)
+
+// Payloads are URLs and base64-encoded blobs found in a text file, such as
+// links and inline payloads in a phishing email export
+type Payloads struct {
+	URLs  []string
+	Blobs []Attachment
+}
+
+// TextPayloads extracts URLs and decoded base64 blobs from a text file, up
+// to MaxPayloads of each. Returns ErrNotContainer if the file is not text.
+func TextPayloads(filePath string) (*Payloads, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, MaxTextSize))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "text/") {
+		return nil, ErrNotContainer
+	}
+
+	payloads := &Payloads{}
+	seen := make(map[string]bool)
+	text := softLineBreak.ReplaceAll(data, nil)
+	for _, match := range urlPattern.FindAll(text, -1) {
+		u := strings.TrimRight(string(match), ".,;:!?")
+		if seen[u] {
+			continue
+		}
+		if len(payloads.URLs) == MaxPayloads {
+			break
+		}
+		seen[u] = true
+		payloads.URLs = append(payloads.URLs, u)
+	}
+
+	// URLs are blanked out so long paths are not mistaken for base64
+	text = urlPattern.ReplaceAllFunc(data, func(b []byte) []byte { return bytes.Repeat([]byte(" "), len(b)) })
+	for _, encoded := range base64Candidates(string(text)) {
+		if len(encoded) < minBase64Length {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		if len(payloads.Blobs) == MaxPayloads {
+			break
+		}
+		payloads.Blobs = append(payloads.Blobs, Attachment{
+			Name:        fmt.Sprintf("base64-%d.bin", len(payloads.Blobs)+1),
+			ContentType: http.DetectContentType(decoded),
+			Data:        decoded,
+		})
+	}
+	return payloads, nil
+}
+
+// base64Candidates returns wrapped base64 blocks, joined, and base64 tokens
+// found inline in other lines
+func base64Candidates(text string) []string {
+	var candidates []string
+	var block strings.Builder
+	flush := func() {
+		if block.Len() > 0 {
+			candidates = append(candidates, block.String())
+			block.Reset()
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if base64Line.MatchString(line) {
+			block.WriteString(line)
+			if strings.HasSuffix(line, "=") {
+				flush()
+			}
+			continue
+		}
+		flush()
+		candidates = append(candidates, base64Token.FindAllString(line, -1)...)
+	}
+	flush()
+	return candidates
+}
@@ -0,0 +1,55 @@
+package extract
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextPayloads(t *testing.T) {
+	blob := strings.Repeat("dropped payload ", 10)
+	encoded := base64.StdEncoding.EncodeToString([]byte(blob))
+	text := "Your invoice is ready: https://files.example.com/invoice.exe.\r\n" +
+		"Mirror: https://cdn.example.=\r\ncom/invoice.exe\r\n" +
+		"Again: https://files.example.com/invoice.exe\r\n" +
+		"Long link https://example.com/" + strings.Repeat("A", 200) + "\r\n" +
+		"Hash 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\r\n" +
+		encoded[:76] + "\r\n" + encoded[76:] + "\r\n"
+
+	filePath := filepath.Join(t.TempDir(), "message.txt")
+	if err := os.WriteFile(filePath, []byte(text), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	payloads, err := TextPayloads(filePath)
+	if err != nil {
+		t.Fatalf("TextPayloads failed: %v", err)
+	}
+
+	expectedURLs := []string{
+		"https://files.example.com/invoice.exe",
+		"https://cdn.example.com/invoice.exe",
+		"https://example.com/" + strings.Repeat("A", 200),
+	}
+	if strings.Join(payloads.URLs, " ") != strings.Join(expectedURLs, " ") {
+		t.Errorf("unexpected URLs: %q", payloads.URLs)
+	}
+	if len(payloads.Blobs) != 1 || string(payloads.Blobs[0].Data) != blob {
+		t.Fatalf("expected the wrapped blob only, got %d blobs", len(payloads.Blobs))
+	}
+	if payloads.Blobs[0].Name != "base64-1.bin" || payloads.Blobs[0].ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected blob: %s %s", payloads.Blobs[0].Name, payloads.Blobs[0].ContentType)
+	}
+}
+
+func TestTextPayloads_Binary(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "image.png")
+	if err := os.WriteFile(filePath, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR https://example.com/x"), 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	if _, err := TextPayloads(filePath); !errors.Is(err, ErrNotContainer) {
+		t.Errorf("expected ErrNotContainer, got %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+)
+
+const (
+	// MaxDecryptedSize bounds the total size of the members decrypted from
+	// one archive
+	MaxDecryptedSize = 256 * 1024 * 1024
+
+	// methodAES marks a WinZip AES-encrypted member; the real compression
+	// method is in its extra field
+	methodAES = 99
+	// aesExtraID is the WinZip AES extra field
+	aesExtraID = 0x9901
+	// aesIterations and aesMACLength are fixed by the WinZip AES format
+	aesIterations = 1000
+	aesMACLength  = 10
+	// zipCryptoHeaderLength is the encryption header of a ZipCrypto member
+	zipCryptoHeaderLength = 12
+)
+
+// ErrEncrypted is returned when an archive member cannot be decrypted with
+// any of the supplied passwords
+var ErrEncrypted = errors.New("encrypted archive member")
+
+// errTooLarge is returned when decrypted members outgrow MaxDecryptedSize
+var errTooLarge = fmt.Errorf("archive members exceed %d bytes", MaxDecryptedSize)
+
+// IsEncryptedZip reports whether a file is a ZIP archive with encrypted
+// members. Returns ErrNotContainer if the file is not a ZIP archive.
+func IsEncryptedZip(filePath string) (bool, error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return false, ErrNotContainer
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if isEncrypted(f) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DecryptZip decrypts the encrypted members of a ZIP archive, trying each
+// password in turn. Both ZipCrypto and WinZip AES are supported. Returns
+// ErrEncrypted (wrapped with the member name) if a member cannot be
+// decrypted, an error if there are more than MaxAttachments encrypted
+// members or they inflate past MaxDecryptedSize, and ErrNotContainer if the
+// file is not a ZIP archive.
+func DecryptZip(filePath string, passwords []string) ([]Attachment, error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, ErrNotContainer
+	}
+	defer r.Close()
+
+	// Sizes in the central directory are the uploader's claim; the budget
+	// is charged with what members actually inflate to
+	var members []Attachment
+	remaining := int64(MaxDecryptedSize)
+	for _, f := range r.File {
+		if !isEncrypted(f) || f.FileInfo().IsDir() {
+			continue
+		}
+		// Members past the limit would go unscanned
+		if len(members) == MaxAttachments {
+			return nil, fmt.Errorf("archive has more than %d encrypted members", MaxAttachments)
+		}
+
+		data, err := decryptMember(f, passwords, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		remaining -= int64(len(data))
+		members = append(members, Attachment{
+			Name:        path.Base(f.Name),
+			ContentType: http.DetectContentType(data),
+			Data:        data,
+		})
+	}
+	return members, nil
+}
+
+func isEncrypted(f *zip.File) bool {
+	return f.Flags&0x1 != 0
+}
+
+// decryptMember returns a member's content decrypted with the first
+// password that opens it, failing if it inflates past limit bytes
+func decryptMember(f *zip.File, passwords []string, limit int64) ([]byte, error) {
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(raw, MaxDecryptedSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, password := range passwords {
+		var content []byte
+		if f.Method == methodAES {
+			content, err = decryptAES(f, data, []byte(password), limit)
+		} else {
+			content, err = decryptZipCrypto(f, data, []byte(password), limit)
+		}
+		if err == nil {
+			return content, nil
+		}
+		if !errors.Is(err, ErrEncrypted) {
+			return nil, err
+		}
+	}
+	return nil, ErrEncrypted
+}
+
+// decryptZipCrypto decrypts traditional PKWARE encryption. The header check
+// byte rejects most wrong passwords; the CRC catches the rest.
+func decryptZipCrypto(f *zip.File, data, password []byte, limit int64) ([]byte, error) {
+	if len(data) < zipCryptoHeaderLength {
+		return nil, fmt.Errorf("truncated member")
+	}
+	keys := newZipCryptoKeys(password)
+	buf := slices.Clone(data)
+	keys.decrypt(buf)
+
+	// Streamed members check against the modification time instead
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if buf[zipCryptoHeaderLength-1] != check {
+		return nil, ErrEncrypted
+	}
+
+	content, err := decompress(f.Method, buf[zipCryptoHeaderLength:], limit)
+	if errors.Is(err, errTooLarge) {
+		return nil, err
+	}
+	if err != nil || crc32.ChecksumIEEE(content) != f.CRC32 {
+		return nil, ErrEncrypted
+	}
+	return content, nil
+}
+
+// zipCryptoKeys is the key state of traditional PKWARE encryption
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	keys := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, b := range password {
+		keys.update(b)
+	}
+	return keys
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) stream() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+func (k *zipCryptoKeys) decrypt(buf []byte) {
+	for i, c := range buf {
+		buf[i] = c ^ k.stream()
+		k.update(buf[i])
+	}
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+// decryptAES decrypts WinZip AES (AE-1 and AE-2): AES-CTR keyed by
+// PBKDF2-HMAC-SHA1, authenticated by a truncated HMAC-SHA1
+func decryptAES(f *zip.File, data, password []byte, limit int64) ([]byte, error) {
+	version, strength, method, ok := aesExtra(f.Extra)
+	if !ok || strength < 1 || strength > 3 {
+		return nil, fmt.Errorf("unsupported AES encryption")
+	}
+	keyLength := 8 + 8*int(strength)
+	saltLength := keyLength / 2
+	if len(data) < saltLength+2+aesMACLength {
+		return nil, fmt.Errorf("truncated member")
+	}
+	salt := data[:saltLength]
+	verifier := data[saltLength : saltLength+2]
+	ciphertext := data[saltLength+2 : len(data)-aesMACLength]
+	mac := data[len(data)-aesMACLength:]
+
+	derived := pbkdf2SHA1(password, salt, aesIterations, 2*keyLength+2)
+	if !bytes.Equal(derived[2*keyLength:], verifier) {
+		return nil, ErrEncrypted
+	}
+	authKey := derived[keyLength : 2*keyLength]
+	h := hmac.New(sha1.New, authKey)
+	h.Write(ciphertext)
+	if !hmac.Equal(h.Sum(nil)[:aesMACLength], mac) {
+		return nil, ErrEncrypted
+	}
+
+	buf := slices.Clone(ciphertext)
+	if err := aesCTR(derived[:keyLength], buf); err != nil {
+		return nil, err
+	}
+	content, err := decompress(method, buf, limit)
+	if err != nil {
+		return nil, err
+	}
+	// AE-2 leaves the CRC empty; the HMAC covers it
+	if version == 1 && crc32.ChecksumIEEE(content) != f.CRC32 {
+		return nil, ErrEncrypted
+	}
+	return content, nil
+}
+
+// aesExtra parses the WinZip AES extra field
+func aesExtra(extra []byte) (version uint16, strength byte, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[4 : 4+size]
+		if id == aesExtraID && size >= 7 {
+			return binary.LittleEndian.Uint16(field), field[4], binary.LittleEndian.Uint16(field[5:]), true
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, 0, false
+}
+
+// aesCTR applies WinZip's AES-CTR in place: a little-endian block counter
+// starting at 1
+func aesCTR(key, buf []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	var counter, stream [aes.BlockSize]byte
+	for offset := 0; offset < len(buf); offset += aes.BlockSize {
+		for i := range counter {
+			counter[i]++
+			if counter[i] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		for i := offset; i < len(buf) && i < offset+aes.BlockSize; i++ {
+			buf[i] ^= stream[i-offset]
+		}
+	}
+	return nil
+}
+
+func pbkdf2SHA1(password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLength; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := slices.Clone(u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLength]
+}
+
+// decompress inflates a member's data once decrypted, failing with
+// errTooLarge past limit bytes
+func decompress(method uint16, data []byte, limit int64) ([]byte, error) {
+	switch method {
+	case zip.Store:
+		if int64(len(data)) > limit {
+			return nil, errTooLarge
+		}
+		return data, nil
+	case zip.Deflate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		content, err := io.ReadAll(io.LimitReader(r, limit+1))
+		if err == nil && int64(len(content)) > limit {
+			return nil, errTooLarge
+		}
+		return content, err
+	default:
+		return nil, fmt.Errorf("unsupported compression method %d", method)
+	}
+}
@@ -0,0 +1,155 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeZip writes an archive with a plain member and the given raw members
+func writeZip(t *testing.T, raw map[*zip.FileHeader][]byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	plain, _ := w.Create("readme.txt")
+	plain.Write([]byte("not encrypted"))
+	for fh, data := range raw {
+		fw, err := w.CreateRaw(fh)
+		if err != nil {
+			t.Fatalf("failed to create member: %v", err)
+		}
+		fw.Write(data)
+	}
+	w.Close()
+
+	filePath := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	return filePath
+}
+
+func zipCryptoMember(name, password string, content []byte) (*zip.FileHeader, []byte) {
+	crc := crc32.ChecksumIEEE(content)
+	header := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, byte(crc >> 24)}
+	data := append(header, content...)
+	keys := newZipCryptoKeys([]byte(password))
+	for i, p := range data {
+		data[i] = p ^ keys.stream()
+		keys.update(p)
+	}
+	return &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		Flags:              0x1,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(content)),
+	}, data
+}
+
+func aesMember(name, password string, content []byte) (*zip.FileHeader, []byte) {
+	salt := bytes.Repeat([]byte{7}, 16)
+	derived := pbkdf2SHA1([]byte(password), salt, aesIterations, 66)
+	ciphertext := slices.Clone(content)
+	aesCTR(derived[:32], ciphertext)
+	h := hmac.New(sha1.New, derived[32:64])
+	h.Write(ciphertext)
+
+	data := append(append(append(salt, derived[64:]...), ciphertext...), h.Sum(nil)[:aesMACLength]...)
+	return &zip.FileHeader{
+		Name:               name,
+		Method:             methodAES,
+		Flags:              0x1,
+		Extra:              []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', 3, 0, 0},
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(content)),
+	}, data
+}
+
+func TestDecryptZip(t *testing.T) {
+	zipCryptoHeader, zipCryptoData := zipCryptoMember("dir/legacy.txt", "secret", []byte("legacy content"))
+	aesHeader, aesData := aesMember("modern.txt", "s3cret", []byte("modern content, longer than one AES block"))
+	filePath := writeZip(t, map[*zip.FileHeader][]byte{
+		zipCryptoHeader: zipCryptoData,
+		aesHeader:       aesData,
+	})
+
+	encrypted, err := IsEncryptedZip(filePath)
+	if err != nil || !encrypted {
+		t.Fatalf("expected an encrypted archive, got %v (%v)", encrypted, err)
+	}
+
+	members, err := DecryptZip(filePath, []string{"wrong", "secret", "s3cret"})
+	if err != nil {
+		t.Fatalf("DecryptZip failed: %v", err)
+	}
+	got := map[string]string{}
+	for _, m := range members {
+		got[m.Name] = string(m.Data)
+	}
+	if len(got) != 2 || got["legacy.txt"] != "legacy content" || got["modern.txt"] != "modern content, longer than one AES block" {
+		t.Errorf("unexpected members: %q", got)
+	}
+
+	// Every encrypted member must open
+	if _, err := DecryptZip(filePath, []string{"secret"}); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("expected ErrEncrypted, got %v", err)
+	}
+	if _, err := DecryptZip(filePath, nil); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("expected ErrEncrypted without passwords, got %v", err)
+	}
+}
+
+func TestDecryptZip_TooManyMembers(t *testing.T) {
+	raw := map[*zip.FileHeader][]byte{}
+	for i := 0; i <= MaxAttachments; i++ {
+		header, data := zipCryptoMember(fmt.Sprintf("member%d.txt", i), "secret", []byte("content"))
+		raw[header] = data
+	}
+	filePath := writeZip(t, raw)
+
+	// Members past the limit would otherwise go unscanned
+	if _, err := DecryptZip(filePath, []string{"secret"}); err == nil {
+		t.Error("expected an error for more than MaxAttachments encrypted members")
+	}
+}
+
+func TestDecompress_Limit(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(bytes.Repeat([]byte{0}, 4096))
+	w.Close()
+
+	if _, err := decompress(zip.Deflate, buf.Bytes(), 4095); !errors.Is(err, errTooLarge) {
+		t.Errorf("expected errTooLarge for deflate, got %v", err)
+	}
+	if content, err := decompress(zip.Deflate, buf.Bytes(), 4096); err != nil || len(content) != 4096 {
+		t.Errorf("expected 4096 bytes within the limit, got %d (%v)", len(content), err)
+	}
+	if _, err := decompress(zip.Store, make([]byte, 10), 9); !errors.Is(err, errTooLarge) {
+		t.Errorf("expected errTooLarge for stored data, got %v", err)
+	}
+}
+
+func TestIsEncryptedZip(t *testing.T) {
+	plain := writeZip(t, nil)
+	if encrypted, err := IsEncryptedZip(plain); err != nil || encrypted {
+		t.Errorf("expected a plain archive, got %v (%v)", encrypted, err)
+	}
+
+	text := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(text, []byte("hello"), 0644)
+	if _, err := IsEncryptedZip(text); !errors.Is(err, ErrNotContainer) {
+		t.Errorf("expected ErrNotContainer, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package feedback
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report is a caller's claim that a file scanned earlier is malicious
+type Report struct {
+	ID         string    `json:"id"`
+	SHA256     string    `json:"sha256"`
+	FileID     string    `json:"fileId,omitempty"`    // scan the file was uploaded in, if known
+	Signature  string    `json:"signature,omitempty"` // malware family, if known
+	Comment    string    `json:"comment,omitempty"`
+	ReportedBy string    `json:"reportedBy"`
+	ReportedAt time.Time `json:"reportedAt"`
+}
+
+// Store flags reported hashes so later uploads of the same file are treated
+// as infected. With a file path, reports are appended as JSON lines and
+// reloaded on startup; otherwise they last until restart.
+type Store struct {
+	mu     sync.RWMutex
+	byHash map[string]*Report
+	file   *os.File
+}
+
+// Open loads reports from path, creating it if needed. An empty path keeps
+// reports in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{byHash: make(map[string]*Report)}
+	if path == "" {
+		return s, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feedback file: %w", err)
+	}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var r Report
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to parse feedback file line %d: %w", line, err)
+		}
+		s.byHash[r.SHA256] = &r
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read feedback file: %w", err)
+	}
+	s.file = file
+	return s, nil
+}
+
+// Add records a report, replacing any earlier one for the same hash
+func (s *Store) Add(r Report) (*Report, error) {
+	r.ID = uuid.New().String()
+	r.ReportedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.file.Write(append(line, '\n')); err != nil {
+			return nil, fmt.Errorf("failed to write feedback file: %w", err)
+		}
+	}
+	s.byHash[r.SHA256] = &r
+	return &r, nil
+}
+
+// Lookup returns the report for a SHA-256 hash, or nil
+func (s *Store) Lookup(sha256 string) *Report {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.byHash[sha256]
+}
+
+// Len returns the number of flagged hashes
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.byHash)
+}
+
+// Close closes the backing file
+func (s *Store) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,55 @@
+package feedback
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const hash = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+
+func TestStore_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.Add(Report{SHA256: hash, Signature: "Trojan.Example", ReportedBy: "anonymous"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+	r := s.Lookup(hash)
+	if r == nil || r.Signature != "Trojan.Example" || r.ID == "" {
+		t.Errorf("unexpected report after reload: %+v", r)
+	}
+	if s.Lookup("0000") != nil {
+		t.Error("expected no report for an unknown hash")
+	}
+}
+
+func TestStore_InMemory(t *testing.T) {
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Add(Report{SHA256: hash})
+	s.Add(Report{SHA256: hash, Signature: "Trojan.Example"})
+	if s.Len() != 1 || s.Lookup(hash).Signature != "Trojan.Example" {
+		t.Errorf("expected the latest report to replace the first")
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	os.WriteFile(path, []byte("not json\n"), 0600)
+	if _, err := Open(path); err == nil {
+		t.Error("expected error for a corrupt feedback file")
+	}
+}
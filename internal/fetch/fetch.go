@@ -0,0 +1,73 @@
+// Package fetch restricts the downloads av-scanner makes on a caller's
+// behalf (scan-by-URL and payload URLs found in text uploads) to an
+// allowlist of hosts.
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxRedirects bounds redirects followed by a download; each hop must also
+// pass the policy
+const MaxRedirects = 5
+
+// Policy is the set of URLs that may be downloaded
+type Policy struct {
+	AllowedHosts []string // "host", "host:port" or "*.domain"
+	Schemes      []string // https when empty
+}
+
+// Check rejects schemes and hosts that are not allowed, and URLs carrying
+// credentials
+func (p Policy) Check(u *url.URL) error {
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"https"}
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		return fmt.Errorf("URL scheme %q is not allowed", u.Scheme)
+	}
+	if u.User != nil {
+		return errors.New("URL credentials are not allowed")
+	}
+	if !hostAllowed(u, p.AllowedHosts) {
+		return fmt.Errorf("URL host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// Client returns an HTTP client that follows redirects only to URLs the
+// policy allows
+func (p Policy) Client(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(next *http.Request, via []*http.Request) error {
+			if len(via) >= MaxRedirects {
+				return errors.New("too many redirects")
+			}
+			return p.Check(next.URL)
+		},
+	}
+}
+
+// hostAllowed matches a URL against "host", "host:port" and "*.domain"
+// entries
+func hostAllowed(u *url.URL, allowed []string) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		switch {
+		case entry == host, entry == strings.ToLower(u.Host):
+			return true
+		case strings.HasPrefix(entry, "*.") && strings.HasSuffix(host, entry[1:]):
+			return true
+		}
+	}
+	return false
+}
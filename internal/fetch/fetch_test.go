@@ -0,0 +1,39 @@
+package fetch
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"files.internal", "*.example.com", "cdn.local:8443"}
+	for raw, want := range map[string]bool{
+		"https://files.internal/a":      true,
+		"https://FILES.internal:9000/a": true,
+		"https://a.b.example.com/x":     true,
+		"https://example.com/x":         false,
+		"https://badexample.com/x":      false,
+		"https://cdn.local:8443/x":      true,
+		"https://cdn.local/x":           false,
+	} {
+		u, _ := url.Parse(raw)
+		if got := hostAllowed(u, allowed); got != want {
+			t.Errorf("%s: expected %v, got %v", raw, want, got)
+		}
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p := Policy{AllowedHosts: []string{"files.internal"}}
+	for raw, allowed := range map[string]bool{
+		"https://files.internal/a":       true,
+		"http://files.internal/a":        false,
+		"https://user:pw@files.internal": false,
+		"https://other.internal/a":       false,
+	} {
+		u, _ := url.Parse(raw)
+		if err := p.Check(u); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", raw, allowed, err)
+		}
+	}
+}
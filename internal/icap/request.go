@@ -0,0 +1,203 @@
+package icap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Encapsulated entity names (RFC 3507 section 4.4.1)
+const (
+	entityReqHdr   = "req-hdr"
+	entityResHdr   = "res-hdr"
+	entityReqBody  = "req-body"
+	entityResBody  = "res-body"
+	entityNullBody = "null-body"
+	entityOptBody  = "opt-body"
+)
+
+// errBadRequest marks requests that violate the protocol; the connection is
+// answered with 400 and closed
+var errBadRequest = errors.New("bad ICAP request")
+
+// maxHeaderBytes caps the encapsulated HTTP headers of a request, which are
+// buffered in memory at the sizes the client's Encapsulated offsets claim
+const maxHeaderBytes = 64 << 10
+
+// section is an encapsulated HTTP header block, kept verbatim so it can be
+// echoed back unmodified
+type section struct {
+	name string
+	data []byte
+}
+
+// request is an ICAP request up to, but not including, its body
+type request struct {
+	method   string
+	uri      *url.URL
+	header   textproto.MIMEHeader
+	sections []section
+	body     string // entity name of the body: req-body, res-body, opt-body or null-body
+}
+
+// service is the last path element of the request URI, e.g. "respmod"
+func (r *request) service() string {
+	return strings.Trim(r.uri.Path, "/")
+}
+
+// allows204 reports whether the client accepts 204 for unmodified messages
+func (r *request) allows204() bool {
+	for _, value := range strings.Split(r.header.Get("Allow"), ",") {
+		if strings.TrimSpace(value) == "204" {
+			return true
+		}
+	}
+	return false
+}
+
+// preview reports whether the body starts with a preview that ends without
+// ieof, after which the client waits for 100 Continue
+func (r *request) preview() bool {
+	return r.header.Get("Preview") != ""
+}
+
+// httpHeader parses an encapsulated header section: its start line and
+// fields. It returns nil if the section is absent or malformed.
+func (r *request) httpHeader(name string) (string, textproto.MIMEHeader) {
+	for _, s := range r.sections {
+		if s.name != name {
+			continue
+		}
+		tp := textproto.NewReader(bufio.NewReader(strings.NewReader(string(s.data))))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return "", nil
+		}
+		header, err := tp.ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return line, nil
+		}
+		return line, header
+	}
+	return "", nil
+}
+
+// readRequest reads an ICAP request line, its headers and the encapsulated
+// HTTP headers. It returns io.EOF when the client closed an idle connection.
+func readRequest(br *bufio.Reader) (*request, error) {
+	tp := textproto.NewReader(br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	method, rest, ok1 := strings.Cut(line, " ")
+	rawURI, proto, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 || proto != "ICAP/1.0" {
+		return nil, fmt.Errorf("%w: malformed request line %q", errBadRequest, line)
+	}
+	uri, err := url.Parse(rawURI)
+	if err != nil || uri.Scheme != "icap" {
+		return nil, fmt.Errorf("%w: invalid URI %q", errBadRequest, rawURI)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+
+	req := &request{method: method, uri: uri, header: header, body: entityNullBody}
+	entities, err := parseEncapsulated(header.Get("Encapsulated"))
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entities {
+		if i == len(entities)-1 {
+			if e.name != entityReqBody && e.name != entityResBody && e.name != entityOptBody && e.name != entityNullBody {
+				return nil, fmt.Errorf("%w: Encapsulated must end with a body entity", errBadRequest)
+			}
+			req.body = e.name
+			break
+		}
+		if e.name != entityReqHdr && e.name != entityResHdr {
+			return nil, fmt.Errorf("%w: unexpected entity %q", errBadRequest, e.name)
+		}
+		data := make([]byte, entities[i+1].offset-e.offset)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("%w: short %s: %v", errBadRequest, e.name, err)
+		}
+		req.sections = append(req.sections, section{name: e.name, data: data})
+	}
+	return req, nil
+}
+
+type entity struct {
+	name   string
+	offset int
+}
+
+// parseEncapsulated parses "req-hdr=0, res-hdr=137, res-body=296"
+func parseEncapsulated(value string) ([]entity, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var entities []entity
+	for _, field := range strings.Split(value, ",") {
+		name, rawOffset, ok := strings.Cut(strings.TrimSpace(field), "=")
+		offset, err := strconv.Atoi(rawOffset)
+		if !ok || err != nil || offset < 0 {
+			return nil, fmt.Errorf("%w: invalid Encapsulated header %q", errBadRequest, value)
+		}
+		if len(entities) > 0 && offset < entities[len(entities)-1].offset {
+			return nil, fmt.Errorf("%w: Encapsulated offsets must not decrease", errBadRequest)
+		}
+		if offset > maxHeaderBytes {
+			return nil, fmt.Errorf("%w: encapsulated headers exceed %d bytes", errBadRequest, maxHeaderBytes)
+		}
+		entities = append(entities, entity{name: name, offset: offset})
+	}
+	return entities, nil
+}
+
+// readChunked copies a chunked body into w. When the body starts with a
+// preview that ends without ieof, proceed is called once before reading the
+// remainder, so the server can send 100 Continue.
+func readChunked(br *bufio.Reader, w io.Writer, preview bool, proceed func() error) error {
+	tp := textproto.NewReader(br)
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		rawSize, extension, _ := strings.Cut(line, ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(rawSize), 16, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("%w: invalid chunk size %q", errBadRequest, line)
+		}
+
+		if size == 0 {
+			// Skip trailers up to the blank line
+			if _, err := tp.ReadMIMEHeader(); err != nil && err != io.EOF {
+				return err
+			}
+			if !preview || strings.TrimSpace(extension) == "ieof" {
+				return nil
+			}
+			preview = false
+			if err := proceed(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := io.CopyN(w, br, size); err != nil {
+			return err
+		}
+		if crlf, err := tp.ReadLine(); err != nil || crlf != "" {
+			return fmt.Errorf("%w: missing chunk terminator", errBadRequest)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+// Package icap serves RFC 3507 REQMOD and RESPMOD requests from proxies such
+// as squid, scanning the encapsulated HTTP body with the regular scan
+// pipeline.
+package icap
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+	"github.com/rophy/av-scanner/internal/version"
+)
+
+const (
+	// idleTimeout closes persistent connections with no new request
+	idleTimeout = 60 * time.Second
+	// requestTimeout bounds reading, scanning and answering one request
+	requestTimeout = 5 * time.Minute
+	// optionsTTL tells clients how long to cache the OPTIONS response
+	optionsTTL = 3600
+)
+
+// ErrServerClosed is returned by Serve after Shutdown
+var ErrServerClosed = errors.New("icap: server closed")
+
+// services maps ICAP service names to the method they accept
+var services = map[string]string{
+	"reqmod":  "REQMOD",
+	"respmod": "RESPMOD",
+}
+
+// Server answers ICAP requests. Like the API, it writes bodies to the upload
+// directory so real-time scanning sees them.
+type Server struct {
+	scanner     *scanner.Scanner
+	maxFileSize int64
+	paused      func() error
+	logger      *slog.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{}
+	closing  atomic.Bool
+	wg       sync.WaitGroup
+}
+
+type conn struct {
+	net.Conn
+	busy atomic.Bool
+}
+
+// New creates an ICAP server; bodies over maxFileSize are refused. Scans
+// are answered with 503 while paused, if given, returns an error, e.g. in
+// the API's maintenance mode.
+func New(s *scanner.Scanner, maxFileSize int64, paused func() error, logger *slog.Logger) *Server {
+	if paused == nil {
+		paused = func() error { return nil }
+	}
+	return &Server{
+		scanner:     s,
+		maxFileSize: maxFileSize,
+		paused:      paused,
+		logger:      logger,
+		conns:       make(map[*conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on addr and serves until Shutdown
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Shutdown
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closing.Load() {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if s.closing.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		c := &conn{Conn: nc}
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+// Shutdown stops accepting connections, closes idle ones and waits for
+// requests in progress to finish or ctx to expire
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closing.Store(true)
+	s.mu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.closeIdle()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) closeIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if !c.busy.Load() {
+			c.Close()
+		}
+	}
+}
+
+func (s *Server) serveConn(c *conn) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("ICAP connection panicked", "panic", r)
+		}
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	for !s.closing.Load() {
+		c.SetReadDeadline(time.Now().Add(idleTimeout))
+		if _, err := br.Peek(1); err != nil {
+			return
+		}
+		c.busy.Store(true)
+		c.SetDeadline(time.Now().Add(requestTimeout))
+
+		keepAlive := s.serveRequest(br, bw)
+		if err := bw.Flush(); err != nil || !keepAlive {
+			return
+		}
+		c.busy.Store(false)
+	}
+}
+
+// serveRequest handles one request and reports whether the connection can
+// be reused
+func (s *Server) serveRequest(br *bufio.Reader, bw *bufio.Writer) bool {
+	start := time.Now()
+	req, err := readRequest(br)
+	if err != nil {
+		if errors.Is(err, errBadRequest) {
+			s.logger.Warn("Invalid ICAP request", "error", err)
+			writeStatus(bw, 400, "Bad Request", nil)
+		}
+		return false
+	}
+
+	method, ok := services[req.service()]
+	switch {
+	case !ok:
+		writeStatus(bw, 404, "ICAP Service Not Found", nil)
+		return s.discardBody(br, req)
+	case req.method == "OPTIONS":
+		s.writeOptions(bw, method)
+		return s.discardBody(br, req)
+	case req.method != method:
+		writeStatus(bw, 405, "Method Not Allowed For Service", nil)
+		return s.discardBody(br, req)
+	}
+
+	keepAlive, status, result := s.scan(br, bw, req)
+	attrs := []any{
+		"method", req.method,
+		"service", req.service(),
+		"icapStatus", status,
+		"duration", time.Since(start).Milliseconds(),
+	}
+	if result != nil {
+		attrs = append(attrs, "fileId", result.FileID, "status", result.Status, "signature", result.Signature)
+	}
+	s.logger.Info("ICAP request completed", attrs...)
+	return keepAlive
+}
+
+// scan stores and scans the encapsulated body, then answers with 204, the
+// unmodified message or a block page
+func (s *Server) scan(br *bufio.Reader, bw *bufio.Writer, req *request) (bool, int, *scanner.ScanResponse) {
+	reqLine, reqHeader := req.httpHeader(entityReqHdr)
+	_, resHeader := req.httpHeader(entityResHdr)
+	fileName := fileNameFromRequestLine(reqLine)
+	mimeType := ""
+	if req.method == "RESPMOD" && resHeader != nil {
+		mimeType = resHeader.Get("Content-Type")
+	} else if reqHeader != nil {
+		mimeType = reqHeader.Get("Content-Type")
+	}
+
+	if err := s.paused(); err != nil {
+		s.logger.Warn("ICAP scan refused", "reason", err)
+		writeStatus(bw, 503, "Service Unavailable", nil)
+		return s.discardBody(br, req), 503, nil
+	}
+	if req.body == entityNullBody {
+		return true, s.writeUnmodified(bw, req, nil), nil
+	}
+
+	fileID := s.scanner.GenerateFileID()
+	dst, filePath, err := s.scanner.CreateUpload(fileID, fileName)
+	if err != nil {
+		s.logger.Error("Failed to create file", "error", err)
+		writeStatus(bw, 500, "Server Error", nil)
+		return false, 500, nil
+	}
+
+	hasher := sha256.New()
+	body := &cappedWriter{w: io.MultiWriter(dst, hasher), max: s.maxFileSize}
+	err = readChunked(br, body, req.preview(), func() error {
+		if _, err := bw.WriteString("ICAP/1.0 100 Continue\r\n\r\n"); err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+	dst.Close()
+	if err != nil || body.over {
+		s.scanner.DiscardUpload(filePath, fileID)
+		if err != nil {
+			s.logger.Warn("Failed to read ICAP body", "error", err)
+			writeStatus(bw, 400, "Bad Request", nil)
+			return false, 400, nil
+		}
+		writeStatus(bw, 413, "Request Entity Too Large", nil)
+		return true, 413, nil
+	}
+	filePath = s.scanner.FinalizeUploadPath(filePath, fileName, hex.EncodeToString(hasher.Sum(nil)))
+
+	// The scan removes the file; keep it open to echo it back if it is clean
+	var echo *os.File
+	if !req.allows204() {
+		if echo, err = os.Open(filePath); err != nil {
+			s.logger.Error("Failed to open upload", "error", err)
+		} else {
+			defer echo.Close()
+		}
+	}
+
+	result, err := s.scanner.ScanWithOptions(filePath, fileID, fileName, body.n, scanner.ScanOptions{MimeType: mimeType})
+	var throttled *scanner.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		writeStatus(bw, 503, "Service Unavailable", nil)
+		return true, 503, nil
+	case err != nil || result.Status == drivers.StatusError:
+		if err != nil {
+			s.logger.Error("ICAP scan failed", "error", err)
+		}
+		writeStatus(bw, 500, "Server Error", nil)
+		return true, 500, result
+	case result.Status == drivers.StatusInfected || result.Status == drivers.StatusBlocked:
+		s.writeBlocked(bw, result)
+		return true, 200, result
+	case req.allows204():
+		return true, s.writeUnmodified(bw, req, nil), result
+	case echo == nil:
+		writeStatus(bw, 500, "Server Error", nil)
+		return true, 500, result
+	}
+	return true, s.writeUnmodified(bw, req, echo), result
+}
+
+// discardBody skips a body the request should not have sent
+func (s *Server) discardBody(br *bufio.Reader, req *request) bool {
+	if req.body == entityNullBody {
+		return true
+	}
+	// Without a preview there is nothing to wait for; with one, the client
+	// already has its answer and will not send the remainder
+	return readChunked(br, io.Discard, false, nil) == nil
+}
+
+func (s *Server) writeOptions(bw *bufio.Writer, method string) {
+	writeStatus(bw, 200, "OK", map[string]string{
+		"Methods":      method,
+		"Service":      "av-scanner/" + version.Version,
+		"ISTag":        s.isTag(),
+		"Allow":        "204",
+		"Options-TTL":  fmt.Sprint(optionsTTL),
+		"Encapsulated": "null-body=0",
+	})
+}
+
+// writeUnmodified answers 204, or echoes the request's message when the
+// client does not accept 204. body is nil when the message had none.
+func (s *Server) writeUnmodified(bw *bufio.Writer, req *request, body io.Reader) int {
+	if req.allows204() {
+		writeStatus(bw, 204, "No Content", map[string]string{"ISTag": s.isTag()})
+		return 204
+	}
+
+	var encapsulated []string
+	offset := 0
+	for _, sec := range req.sections {
+		encapsulated = append(encapsulated, fmt.Sprintf("%s=%d", sec.name, offset))
+		offset += len(sec.data)
+	}
+	bodyEntity := req.body
+	if body == nil {
+		bodyEntity = entityNullBody
+	}
+	encapsulated = append(encapsulated, fmt.Sprintf("%s=%d", bodyEntity, offset))
+
+	writeStatus(bw, 200, "OK", map[string]string{
+		"ISTag":        s.isTag(),
+		"Encapsulated": strings.Join(encapsulated, ", "),
+	})
+	for _, sec := range req.sections {
+		bw.Write(sec.data)
+	}
+	if body != nil {
+		writeChunked(bw, body)
+	}
+	return 200
+}
+
+// writeBlocked replaces the message with a 403 block page
+func (s *Server) writeBlocked(bw *bufio.Writer, result *scanner.ScanResponse) {
+	threat := result.Signature
+	if threat == "" {
+		threat = string(result.Status)
+	}
+	page := fmt.Sprintf("Blocked by av-scanner: %s (scan %s)\n", threat, result.FileID)
+	resHeader := fmt.Sprintf("HTTP/1.1 403 Forbidden\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Length: %d\r\n"+
+		"Connection: close\r\n\r\n", len(page))
+
+	writeStatus(bw, 200, "OK", map[string]string{
+		"ISTag":             s.isTag(),
+		"X-Infection-Found": fmt.Sprintf("Type=0; Resolution=2; Threat=%s;", headerSafe(threat)),
+		"X-Virus-ID":        headerSafe(threat),
+		"Encapsulated":      fmt.Sprintf("res-hdr=0, res-body=%d", len(resHeader)),
+	})
+	bw.WriteString(resHeader)
+	writeChunked(bw, strings.NewReader(page))
+}
+
+// isTag identifies the signature set, so clients drop cached verdicts after
+// a definitions update. ISTag values are limited to 32 characters.
+func (s *Server) isTag() string {
+	tag := "avs-" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, s.scanner.DefinitionsVersion())
+	if len(tag) > 30 {
+		tag = tag[:30]
+	}
+	return `"` + tag + `"`
+}
+
+// writeStatus writes an ICAP status line and headers; Encapsulated defaults
+// to null-body for responses without a message
+func writeStatus(bw *bufio.Writer, code int, text string, headers map[string]string) {
+	fmt.Fprintf(bw, "ICAP/1.0 %d %s\r\n", code, text)
+	if _, ok := headers["Encapsulated"]; !ok && code != 100 && code != 204 {
+		fmt.Fprintf(bw, "Encapsulated: null-body=0\r\n")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(bw, "%s: %s\r\n", name, headers[name])
+	}
+	fmt.Fprintf(bw, "Date: %s\r\n\r\n", time.Now().UTC().Format(time.RFC1123))
+}
+
+func writeChunked(bw *bufio.Writer, r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%x\r\n", n)
+			bw.Write(buf[:n])
+			bw.WriteString("\r\n")
+		}
+		if err != nil {
+			break
+		}
+	}
+	bw.WriteString("0\r\n\r\n")
+}
+
+// fileNameFromRequestLine takes the last path segment of the encapsulated
+// HTTP request, e.g. "GET http://example.com/a/setup.exe HTTP/1.1"
+func fileNameFromRequestLine(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) >= 2 {
+		if target, err := url.Parse(fields[1]); err == nil {
+			if name := path.Base(target.Path); name != "" && name != "/" && name != "." {
+				return name
+			}
+		}
+	}
+	return "icap-body"
+}
+
+// headerSafe strips characters that would break an ICAP header line
+func headerSafe(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f || r == ';' {
+			return -1
+		}
+		return r
+	}, textproto.TrimString(value))
+}
+
+// cappedWriter writes up to max bytes and discards the rest, so an oversized
+// body can still be read to its end
+type cappedWriter struct {
+	w    io.Writer
+	n    int64
+	max  int64
+	over bool
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if c.over {
+		return len(p), nil
+	}
+	if c.n+int64(len(p)) > c.max {
+		c.over = true
+		return len(p), nil
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
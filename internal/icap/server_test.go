@@ -0,0 +1,225 @@
+package icap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+const (
+	reqHdr = "GET http://example.com/downloads/file.bin HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	resHdr = "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+)
+
+func startServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		MaxFileSize:     1024,
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scanner.New(cfg, logger)
+	t.Cleanup(s.Stop)
+
+	srv := New(s, cfg.MaxFileSize, nil, logger)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv, l.Addr().String()
+}
+
+// respmod builds a RESPMOD request carrying body in one chunk
+func respmod(body string, headers string) string {
+	return "RESPMOD icap://localhost/respmod ICAP/1.0\r\n" +
+		"Host: localhost\r\n" + headers +
+		fmt.Sprintf("Encapsulated: req-hdr=0, res-hdr=%d, res-body=%d\r\n\r\n", len(reqHdr), len(reqHdr)+len(resHdr)) +
+		reqHdr + resHdr +
+		fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(body), body)
+}
+
+type response struct {
+	status string
+	header textproto.MIMEHeader
+}
+
+func readResponse(t *testing.T, tp *textproto.Reader) response {
+	t.Helper()
+	status, err := tp.ReadLine()
+	if err != nil {
+		t.Fatalf("failed to read status: %v", err)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("failed to read headers: %v", err)
+	}
+	return response{status: status, header: header}
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *textproto.Reader) {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	return c, textproto.NewReader(bufio.NewReader(c))
+}
+
+func TestServer_Options(t *testing.T) {
+	_, addr := startServer(t)
+	c, tp := dial(t, addr)
+
+	fmt.Fprint(c, "OPTIONS icap://localhost/respmod ICAP/1.0\r\nHost: localhost\r\n\r\n")
+	resp := readResponse(t, tp)
+	if resp.status != "ICAP/1.0 200 OK" || resp.header.Get("Methods") != "RESPMOD" || resp.header.Get("ISTag") == "" {
+		t.Errorf("unexpected OPTIONS response: %s %v", resp.status, resp.header)
+	}
+
+	fmt.Fprint(c, "OPTIONS icap://localhost/unknown ICAP/1.0\r\nHost: localhost\r\n\r\n")
+	if resp := readResponse(t, tp); !strings.HasPrefix(resp.status, "ICAP/1.0 404") {
+		t.Errorf("expected 404 on the same connection, got %s", resp.status)
+	}
+}
+
+func TestServer_RespmodInfected(t *testing.T) {
+	_, addr := startServer(t)
+	c, tp := dial(t, addr)
+
+	fmt.Fprint(c, respmod(drivers.EICARPattern(), "Allow: 204\r\n"))
+	resp := readResponse(t, tp)
+	if resp.status != "ICAP/1.0 200 OK" {
+		t.Fatalf("unexpected status: %s", resp.status)
+	}
+	if !strings.Contains(resp.header.Get("X-Infection-Found"), "Threat=") {
+		t.Errorf("expected X-Infection-Found, got %v", resp.header)
+	}
+	if status, _ := tp.ReadLine(); status != "HTTP/1.1 403 Forbidden" {
+		t.Errorf("expected encapsulated 403, got %q", status)
+	}
+}
+
+func TestServer_RespmodClean(t *testing.T) {
+	_, addr := startServer(t)
+	c, tp := dial(t, addr)
+
+	fmt.Fprint(c, respmod("hello world", "Allow: 204\r\n"))
+	if resp := readResponse(t, tp); resp.status != "ICAP/1.0 204 No Content" {
+		t.Errorf("expected 204, got %s", resp.status)
+	}
+
+	// Without Allow: 204 the message is echoed unchanged
+	fmt.Fprint(c, respmod("hello world", ""))
+	resp := readResponse(t, tp)
+	want := fmt.Sprintf("req-hdr=0, res-hdr=%d, res-body=%d", len(reqHdr), len(reqHdr)+len(resHdr))
+	if resp.status != "ICAP/1.0 200 OK" || resp.header.Get("Encapsulated") != want {
+		t.Fatalf("unexpected echo response: %s %v", resp.status, resp.header)
+	}
+	echoed := make([]byte, len(reqHdr)+len(resHdr))
+	io.ReadFull(tp.R, echoed)
+	if string(echoed) != reqHdr+resHdr {
+		t.Errorf("unexpected echoed headers: %q", echoed)
+	}
+	var body strings.Builder
+	if err := readChunked(tp.R, &body, false, nil); err != nil || body.String() != "hello world" {
+		t.Errorf("unexpected echoed body %q: %v", body.String(), err)
+	}
+}
+
+func TestServer_Preview(t *testing.T) {
+	_, addr := startServer(t)
+	c, tp := dial(t, addr)
+
+	body := drivers.EICARPattern()
+	fmt.Fprintf(c, "REQMOD icap://localhost/reqmod ICAP/1.0\r\nHost: localhost\r\nAllow: 204\r\nPreview: 4\r\n"+
+		"Encapsulated: req-hdr=0, req-body=%d\r\n\r\n%s4\r\n%s\r\n0\r\n\r\n", len(reqHdr), reqHdr, body[:4])
+	if resp := readResponse(t, tp); resp.status != "ICAP/1.0 100 Continue" {
+		t.Fatalf("expected 100 Continue, got %s", resp.status)
+	}
+	fmt.Fprintf(c, "%x\r\n%s\r\n0\r\n\r\n", len(body)-4, body[4:])
+	if resp := readResponse(t, tp); resp.header.Get("X-Virus-ID") == "" {
+		t.Errorf("expected an infection verdict, got %s %v", resp.status, resp.header)
+	}
+}
+
+func TestServer_TooLarge(t *testing.T) {
+	_, addr := startServer(t)
+	c, tp := dial(t, addr)
+
+	fmt.Fprint(c, respmod(strings.Repeat("a", 2048), "Allow: 204\r\n"))
+	if resp := readResponse(t, tp); !strings.HasPrefix(resp.status, "ICAP/1.0 413") {
+		t.Errorf("expected 413, got %s", resp.status)
+	}
+}
+
+func TestServer_HugeEncapsulatedOffset(t *testing.T) {
+	_, addr := startServer(t)
+	c, tp := dial(t, addr)
+
+	fmt.Fprint(c, "RESPMOD icap://localhost/respmod ICAP/1.0\r\nHost: localhost\r\n"+
+		"Encapsulated: req-hdr=0, null-body=4611686018427387904\r\n\r\n")
+	if resp := readResponse(t, tp); !strings.HasPrefix(resp.status, "ICAP/1.0 400") {
+		t.Errorf("expected 400, got %s", resp.status)
+	}
+}
+
+func TestServer_Paused(t *testing.T) {
+	srv, addr := startServer(t)
+	srv.paused = func() error { return errors.New("Service is in maintenance mode") }
+	c, tp := dial(t, addr)
+
+	fmt.Fprint(c, respmod(drivers.EICARPattern(), "Allow: 204\r\n"))
+	if resp := readResponse(t, tp); resp.status != "ICAP/1.0 503 Service Unavailable" {
+		t.Errorf("expected 503 while paused, got %s", resp.status)
+	}
+	// OPTIONS still works, on the same connection
+	fmt.Fprint(c, "OPTIONS icap://localhost/respmod ICAP/1.0\r\nHost: localhost\r\n\r\n")
+	if resp := readResponse(t, tp); resp.status != "ICAP/1.0 200 OK" {
+		t.Errorf("expected OPTIONS to be answered, got %s", resp.status)
+	}
+}
+
+func TestParseEncapsulated(t *testing.T) {
+	entities, err := parseEncapsulated("req-hdr=0, res-hdr=137, res-body=296")
+	if err != nil || len(entities) != 3 || entities[1] != (entity{entityResHdr, 137}) {
+		t.Errorf("unexpected entities %v: %v", entities, err)
+	}
+	for _, invalid := range []string{
+		"req-hdr", "req-hdr=x", "req-hdr=10, res-body=5",
+		"req-hdr=0, null-body=4611686018427387904", "req-hdr=0, null-body=1073741824",
+	} {
+		if _, err := parseEncapsulated(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestFileNameFromRequestLine(t *testing.T) {
+	for line, want := range map[string]string{
+		"GET http://example.com/a/setup.exe?x=1 HTTP/1.1": "setup.exe",
+		"GET http://example.com/ HTTP/1.1":                "icap-body",
+		"CONNECT example.com:443 HTTP/1.1":                "icap-body",
+		"":                                                "icap-body",
+	} {
+		if got := fileNameFromRequestLine(line); got != want {
+			t.Errorf("%q: expected %q, got %q", line, want, got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package inspect
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+)
+
+// Packed executables and encrypted payloads look like random data, so their
+// byte entropy approaches 8 bits per byte. Compressed formats do too, which is
+// why they are reported separately and not flagged.
+
+// compressedMagic identifies formats whose content is expected to be high entropy
+var compressedMagic = [][]byte{
+	{0x1F, 0x8B},                       // gzip
+	{'B', 'Z', 'h'},                    // bzip2
+	{0xFD, '7', 'z', 'X', 'Z', 0x00},   // xz
+	{0x28, 0xB5, 0x2F, 0xFD},           // zstd
+	{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}, // 7z
+	[]byte("Rar!\x1a\x07"),             // rar
+}
+
+// Entropy returns the Shannon entropy of the file in bits per byte (0-8) and
+// whether its leading bytes identify a compressed format (archives and
+// compressed media), for which high entropy is normal
+func Entropy(path string) (entropy float64, compressed bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	return EntropyReader(f)
+}
+
+// EntropyReader is Entropy for content that is not in a file
+func EntropyReader(f io.Reader) (entropy float64, compressed bool, err error) {
+	var counts [256]int64
+	var total int64
+	var head []byte
+	buf := make([]byte, chunkSize)
+	for {
+		n, readErr := f.Read(buf)
+		if head == nil && n > 0 {
+			head = bytes.Clone(buf[:min(n, headWindow)])
+		}
+		for _, c := range buf[:n] {
+			counts[c]++
+		}
+		total += int64(n)
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return 0, false, readErr
+		}
+	}
+
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy, isCompressed(head), nil
+}
+
+func isCompressed(head []byte) bool {
+	switch Format(head) {
+	case "zip", "jpeg", "png", "gif", "pdf":
+		return true
+	}
+	// MP4 and other ISO media files start with a size and "ftyp"
+	if len(head) >= 8 && bytes.Equal(head[4:8], []byte("ftyp")) {
+		return true
+	}
+	for _, magic := range compressedMagic {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
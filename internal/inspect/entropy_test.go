@@ -0,0 +1,49 @@
+package inspect
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestEntropy(t *testing.T) {
+	random := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		min, max   float64
+		compressed bool
+	}{
+		{"empty", nil, 0, 0, false},
+		{"single byte value", bytes.Repeat([]byte{'a'}, 1000), 0, 0, false},
+		{"two byte values", bytes.Repeat([]byte("ab"), 1000), 1, 1, false},
+		{"text", bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 100), 3.5, 4.5, false},
+		{"random", random, 7.99, 8, false},
+		{"gzip", append([]byte{0x1F, 0x8B, 0x08}, random...), 7.99, 8, true},
+		{"mp4", append([]byte("\x00\x00\x00\x20ftypisom"), random...), 7.99, 8, true},
+		{"zip", zipBytes(t), 0, 8, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entropy, compressed, err := Entropy(writeTemp(t, tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if entropy < tt.min-1e-9 || entropy > tt.max+1e-9 {
+				t.Errorf("expected entropy in [%v, %v], got %v", tt.min, tt.max, entropy)
+			}
+			if compressed != tt.compressed {
+				t.Errorf("expected compressed=%v, got %v", tt.compressed, compressed)
+			}
+		})
+	}
+}
+
+func TestEntropy_MissingFile(t *testing.T) {
+	if _, _, err := Entropy("/nonexistent/file"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,129 @@
+package inspect
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// File type categories, for policies that treat whole classes of files alike
+const (
+	CategoryImage      = "image"
+	CategoryExecutable = "executable"
+	CategoryArchive    = "archive"
+	CategoryDocument   = "document"
+	CategoryAudio      = "audio"
+	CategoryVideo      = "video"
+	CategoryText       = "text"
+	CategoryOther      = "other"
+)
+
+// Categories lists every file type category
+var Categories = []string{
+	CategoryImage, CategoryExecutable, CategoryArchive, CategoryDocument,
+	CategoryAudio, CategoryVideo, CategoryText, CategoryOther,
+}
+
+// sniffWindow is how much of a file DetectType reads
+const sniffWindow = 3072
+
+// FileType is a file's format as identified by its leading bytes, whatever
+// its name or declared MIME type
+type FileType struct {
+	MimeType string `json:"mimeType"`
+	Category string `json:"category"`
+}
+
+// typeMagic identifies formats http.DetectContentType does not, executables
+// in particular, which it reports as application/octet-stream
+var typeMagic = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte{0xFE, 0xED, 0xFA, 0xCE}, "application/x-mach-binary"},
+	{[]byte{0xFE, 0xED, 0xFA, 0xCF}, "application/x-mach-binary"},
+	{[]byte{0xCE, 0xFA, 0xED, 0xFE}, "application/x-mach-binary"},
+	{[]byte{0xCF, 0xFA, 0xED, 0xFE}, "application/x-mach-binary"},
+	{[]byte{0xCA, 0xFE, 0xBA, 0xBE}, "application/x-mach-binary"}, // universal binary, or a Java class
+	{[]byte("#!"), "text/x-shellscript"},
+	{[]byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, "application/x-ole-storage"}, // .doc, .xls, .msi
+	{[]byte(`{\rtf`), "text/rtf"},
+	{[]byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}, "application/x-7z-compressed"},
+	{[]byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, "application/x-xz"},
+	{[]byte("BZh"), "application/x-bzip2"},
+	{[]byte{0x28, 0xB5, 0x2F, 0xFD}, "application/zstd"},
+	{[]byte("II*\x00"), "image/tiff"},
+	{[]byte("MM\x00*"), "image/tiff"},
+}
+
+// DetectType identifies the file's type from its leading bytes
+func DetectType(path string) (FileType, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileType{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffWindow)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FileType{}, err
+	}
+	return DetectTypeBytes(head[:n]), nil
+}
+
+// DetectTypeBytes is DetectType for content that is not in a file
+func DetectTypeBytes(head []byte) FileType {
+	head = head[:min(len(head), sniffWindow)]
+	mimeType := ""
+	for _, m := range typeMagic {
+		if bytes.HasPrefix(head, m.magic) {
+			mimeType = m.mimeType
+			break
+		}
+	}
+	if mimeType == "" {
+		mimeType, _, _ = strings.Cut(http.DetectContentType(head), ";")
+	}
+	if mimeType == "application/octet-stream" && len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) {
+		mimeType = isoMediaType(head[8:12])
+	}
+	return FileType{MimeType: mimeType, Category: category(mimeType)}
+}
+
+// isoMediaType maps the brand of ISO media files http.DetectContentType does
+// not recognize
+func isoMediaType(brand []byte) string {
+	switch string(brand) {
+	case "heic", "heix", "mif1", "msf1":
+		return "image/heic"
+	case "avif", "avis":
+		return "image/avif"
+	case "qt  ":
+		return "video/quicktime"
+	}
+	return "video/mp4"
+}
+
+func category(mimeType string) string {
+	switch mimeType {
+	case "application/vnd.microsoft.portable-executable", "application/x-executable",
+		"application/x-mach-binary", "text/x-shellscript", "application/wasm":
+		return CategoryExecutable
+	case "application/zip", "application/x-gzip", "application/x-rar-compressed",
+		"application/x-7z-compressed", "application/x-xz", "application/x-bzip2", "application/zstd":
+		return CategoryArchive
+	case "application/pdf", "application/postscript", "application/x-ole-storage", "text/rtf":
+		return CategoryDocument
+	}
+	kind, _, _ := strings.Cut(mimeType, "/")
+	switch kind {
+	case "image", "audio", "video", "text":
+		return kind
+	}
+	return CategoryOther
+}
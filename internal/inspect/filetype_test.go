@@ -0,0 +1,53 @@
+package inspect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectTypeBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		mimeType string
+		category string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F'}, "image/jpeg", CategoryImage},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png", CategoryImage},
+		{"tiff", []byte("II*\x00\x08\x00\x00\x00"), "image/tiff", CategoryImage},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic", CategoryImage},
+		{"mp4", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00"), "video/mp4", CategoryVideo},
+		{"pe", []byte("MZ\x90\x00\x03\x00\x00\x00"), "application/vnd.microsoft.portable-executable", CategoryExecutable},
+		{"elf", []byte("\x7fELF\x02\x01\x01\x00"), "application/x-executable", CategoryExecutable},
+		{"script", []byte("#!/bin/sh\necho hi\n"), "text/x-shellscript", CategoryExecutable},
+		{"zip", []byte("PK\x03\x04\x14\x00\x00\x00"), "application/zip", CategoryArchive},
+		{"7z", []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0x00, 0x04}, "application/x-7z-compressed", CategoryArchive},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf", CategoryDocument},
+		{"ole", []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, "application/x-ole-storage", CategoryDocument},
+		{"text", []byte("hello world\n"), "text/plain", CategoryText},
+		{"binary", []byte{0x00, 0x01, 0x02, 0x03}, "application/octet-stream", CategoryOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectTypeBytes(tt.head)
+			if got.MimeType != tt.mimeType || got.Category != tt.category {
+				t.Errorf("DetectTypeBytes() = %+v, want %s (%s)", got, tt.mimeType, tt.category)
+			}
+		})
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	// A renamed executable is still an executable
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	os.WriteFile(path, []byte("MZ\x90\x00\x03\x00\x00\x00"), 0644)
+	got, err := DetectType(path)
+	if err != nil || got.Category != CategoryExecutable {
+		t.Errorf("DetectType() = %+v, %v; want an executable", got, err)
+	}
+	if _, err := DetectType(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,222 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Polyglot files are valid in more than one format (e.g. a JPEG that is also
+// a ZIP or HTML document). They slip past content-type checks, and engines
+// often only parse them as their leading format.
+
+const (
+	headWindow = 64 * 1024
+	chunkSize  = 256 * 1024
+
+	// An end-of-central-directory record is 22 bytes plus a comment of up
+	// to 64KB, and ends the file
+	zipEndOfDirSize = 22
+	zipMaxComment   = 0xFFFF
+	zipCentralSize  = 46
+)
+
+var (
+	zipLocalHeader = []byte("PK\x03\x04")
+	zipCentralDir  = []byte("PK\x01\x02")
+	zipEndOfDir    = []byte("PK\x05\x06")
+	pdfHeader      = []byte("%PDF-")
+
+	// Markup that browsers will execute if the file is served as HTML
+	markupMarkers = [][]byte{
+		[]byte("<script"),
+		[]byte("<html"),
+		[]byte("<iframe"),
+		[]byte("<?php"),
+		[]byte("javascript:"),
+	}
+)
+
+// Format returns the file format identified by leading magic bytes, or "" if unknown
+func Format(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "gif"
+	case bytes.HasPrefix(head, []byte("BM")) && len(head) > 14:
+		return "bmp"
+	case bytes.HasPrefix(head, pdfHeader):
+		return "pdf"
+	case bytes.HasPrefix(head, zipLocalHeader), bytes.HasPrefix(head, zipEndOfDir):
+		return "zip"
+	}
+	return ""
+}
+
+func isImage(format string) bool {
+	switch format {
+	case "jpeg", "png", "gif", "bmp":
+		return true
+	}
+	return false
+}
+
+// Polyglot inspects a file and returns findings such as "jpeg+zip" when the
+// file also parses as a second format. Only image and PDF files are checked;
+// other formats legitimately embed archives and markup.
+func Polyglot(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return PolyglotReader(f)
+}
+
+// PolyglotReader is Polyglot for content that is not in a file
+func PolyglotReader(f io.ReadSeeker) ([]string, error) {
+	head := make([]byte, headWindow)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	primary := Format(head)
+	if !isImage(primary) && primary != "pdf" {
+		return nil, nil
+	}
+
+	var findings []string
+	add := func(secondary string) {
+		finding := fmt.Sprintf("polyglot:%s+%s", primary, secondary)
+		for _, existing := range findings {
+			if existing == finding {
+				return
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	// PDF readers accept a header anywhere in the first 1KB
+	if primary != "pdf" {
+		if i := bytes.Index(head, pdfHeader); i > 0 && i < 1024 {
+			add("pdf")
+		}
+	}
+
+	// Markers alone occur by chance in compressed image and PDF streams;
+	// only a complete archive counts
+	zipped, err := embeddedZip(f)
+	if err != nil {
+		return nil, err
+	}
+	if zipped {
+		add("zip")
+	}
+
+	if isImage(primary) {
+		html, err := containsMarkup(f)
+		if err != nil {
+			return nil, err
+		}
+		if html {
+			add("html")
+		}
+	}
+
+	return findings, nil
+}
+
+// embeddedZip reports whether the file ends with a ZIP archive that starts
+// past offset 0: an end-of-central-directory record whose central directory
+// points back at a local file header inside the file
+func embeddedZip(f io.ReadSeeker) (bool, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	tailSize := min(size, zipEndOfDirSize+zipMaxComment)
+	tail := make([]byte, tailSize)
+	if _, err := f.Seek(size-tailSize, io.SeekStart); err != nil {
+		return false, err
+	}
+	if _, err := io.ReadFull(f, tail); err != nil {
+		return false, err
+	}
+
+	for i := len(tail) - zipEndOfDirSize; i >= 0; i-- {
+		eocd := tail[i:]
+		if !bytes.HasPrefix(eocd, zipEndOfDir) || int(binary.LittleEndian.Uint16(eocd[20:])) != len(eocd)-zipEndOfDirSize {
+			continue
+		}
+		if binary.LittleEndian.Uint16(eocd[10:]) == 0 {
+			continue
+		}
+		dirSize := int64(binary.LittleEndian.Uint32(eocd[12:]))
+		dirOffset := int64(binary.LittleEndian.Uint32(eocd[16:]))
+
+		// Data prepended to the archive shifts it from the offsets it records
+		dirStart := size - tailSize + int64(i) - dirSize
+		base := dirStart - dirOffset
+		if dirStart < 0 || base < 0 {
+			continue
+		}
+		central := make([]byte, zipCentralSize)
+		if !readAt(f, dirStart, central) || !bytes.HasPrefix(central, zipCentralDir) {
+			continue
+		}
+		local := base + int64(binary.LittleEndian.Uint32(central[42:]))
+		header := make([]byte, len(zipLocalHeader))
+		if local > 0 && local < dirStart && readAt(f, local, header) && bytes.Equal(header, zipLocalHeader) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readAt fills buf from offset, reporting whether it could
+func readAt(f io.ReadSeeker, offset int64, buf []byte) bool {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+	_, err := io.ReadFull(f, buf)
+	return err == nil
+}
+
+// containsMarkup streams the whole file looking for markup, keeping an
+// overlap so markers spanning chunk boundaries are found
+func containsMarkup(f io.ReadSeeker) (bool, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	overlap := 16
+	buf := make([]byte, overlap+chunkSize)
+	carry := 0
+	for {
+		n, err := io.ReadFull(f, buf[carry:])
+		window := buf[:carry+n]
+
+		lower := bytes.ToLower(window)
+		for _, marker := range markupMarkers {
+			if bytes.Contains(lower, marker) {
+				return true, nil
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		carry = overlap
+		copy(buf, window[len(window)-overlap:])
+	}
+}
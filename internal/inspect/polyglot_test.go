@@ -0,0 +1,106 @@
+package inspect
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var jpegHeader = []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00}
+
+func writeTemp(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sample")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	return path
+}
+
+func zipBytes(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("payload.js")
+	w.Write([]byte("alert(1)"))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to build zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		head     []byte
+		expected string
+	}{
+		{jpegHeader, "jpeg"},
+		{[]byte("\x89PNG\r\n\x1a\n...."), "png"},
+		{[]byte("GIF89a"), "gif"},
+		{[]byte("%PDF-1.7"), "pdf"},
+		{[]byte("PK\x03\x04"), "zip"},
+		{[]byte("hello"), ""},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.head); got != tt.expected {
+			t.Errorf("Format(%q) = %q, expected %q", tt.head, got, tt.expected)
+		}
+	}
+}
+
+func TestPolyglot(t *testing.T) {
+	imageData := append(append([]byte{}, jpegHeader...), bytes.Repeat([]byte{0x42}, 1000)...)
+	imageData = append(imageData, 0xFF, 0xD9)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected []string
+	}{
+		{"plain jpeg", imageData, nil},
+		{"jpeg with appended zip", append(append([]byte{}, imageData...), zipBytes(t)...), []string{"polyglot:jpeg+zip"}},
+		{"jpeg with html", append(append([]byte{}, imageData...), []byte("<HTML><body>x</body>")...), []string{"polyglot:jpeg+html"}},
+		{"jpeg with pdf header", append(append(append([]byte{}, jpegHeader...), []byte("%PDF-1.4")...), imageData...), []string{"polyglot:jpeg+pdf"}},
+		{"pdf with appended zip", append([]byte("%PDF-1.4\n%%EOF\n"), zipBytes(t)...), []string{"polyglot:pdf+zip"}},
+		{"plain zip", zipBytes(t), nil},
+		{"jpeg with stray zip markers", append(append([]byte{}, imageData...), []byte("PK\x03\x04..PK\x05\x06")...), nil},
+		{"jpeg with truncated zip", append(append([]byte{}, imageData...), zipBytes(t)[:40]...), nil},
+		{"text with script", []byte("<script>alert(1)</script>"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := Polyglot(writeTemp(t, tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(findings, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected findings %v, got %v", tt.expected, findings)
+			}
+		})
+	}
+}
+
+func TestPolyglot_MarkerAcrossChunkBoundary(t *testing.T) {
+	data := append([]byte{}, jpegHeader...)
+	data = append(data, bytes.Repeat([]byte{0x00}, chunkSize-len(data)-3)...)
+	data = append(data, []byte("<script>")...)
+
+	findings, err := Polyglot(writeTemp(t, data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(findings) != 1 || findings[0] != "polyglot:jpeg+html" {
+		t.Errorf("expected html finding across chunk boundary, got %v", findings)
+	}
+}
+
+func TestPolyglot_FileNotFound(t *testing.T) {
+	if _, err := Polyglot("/nonexistent/file"); err == nil {
+		t.Error("expected error for nonexistent file")
+	}
+}
@@ -0,0 +1,154 @@
+// Package locale translates the human-readable messages in API responses.
+// Catalogs are operator-provided JSON files; machine-readable fields such as
+// "error" and "status" are never translated, only the "message" that
+// accompanies them.
+package locale
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// verdictKeyPrefix prefixes catalog keys that describe a scan status, e.g.
+// "verdict.infected"
+const verdictKeyPrefix = "verdict."
+
+// verdicts describe each scan status when a catalog has no translation
+var verdicts = map[string]string{
+	"clean":      "No threats found",
+	"infected":   "Malware detected",
+	"suspicious": "Suspicious content found",
+	"blocked":    "Blocked by scan policy",
+	"skipped":    "File was not scanned",
+	"error":      "Scan could not be completed",
+}
+
+var languageTag = regexp.MustCompile(`^[a-z]{2,8}(-[a-z0-9]{1,8})*$`)
+
+// Catalog maps English messages, and verdict.<status> keys, to one language
+type Catalog struct {
+	Language string
+	messages map[string]string
+}
+
+// Translate returns message in the catalog's language. A message without an
+// entry whose text before the first ": " has one, such as "Scan failed:
+// <engine error>", keeps its detail untranslated; anything else is returned
+// as is.
+func (c *Catalog) Translate(message string) string {
+	if t, ok := c.messages[message]; ok {
+		return t
+	}
+	if prefix, detail, ok := strings.Cut(message, ": "); ok {
+		if t, ok := c.messages[prefix]; ok {
+			return t + ": " + detail
+		}
+	}
+	return message
+}
+
+// Verdict describes a scan status in the catalog's language, falling back to
+// English
+func (c *Catalog) Verdict(status string) string {
+	if t, ok := c.messages[verdictKeyPrefix+status]; ok {
+		return t
+	}
+	if d, ok := verdicts[status]; ok {
+		return d
+	}
+	return status
+}
+
+// Catalogs holds the catalogs loaded from a directory, by lowercase language
+// tag
+type Catalogs struct {
+	byLanguage map[string]*Catalog
+}
+
+// Load reads every <language>.json file in dir, e.g. de.json or pt-br.json,
+// each a JSON object of message to translation
+func Load(dir string) (*Catalogs, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read message catalogs: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalogs{byLanguage: make(map[string]*Catalog)}
+	for _, path := range paths {
+		language := strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if !languageTag.MatchString(language) {
+			return nil, fmt.Errorf("message catalog %s: file name is not a language tag", path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message catalog: %w", err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("invalid message catalog %s: %w", path, err)
+		}
+		c.byLanguage[language] = &Catalog{Language: language, messages: messages}
+	}
+	return c, nil
+}
+
+// Languages returns the loaded language tags, sorted
+func (c *Catalogs) Languages() []string {
+	languages := make([]string, 0, len(c.byLanguage))
+	for language := range c.byLanguage {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Negotiate picks the catalog for an Accept-Language header: ranges are
+// tried by quality, each matching its own catalog or, failing that, the one
+// for its primary language ("de-AT" uses de.json). It returns nil when no
+// catalog matches, and the response stays in English.
+func (c *Catalogs) Negotiate(acceptLanguage string) *Catalog {
+	if c == nil || acceptLanguage == "" {
+		return nil
+	}
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 || tag == "" || tag == "*" {
+			continue
+		}
+		ranges = append(ranges, weighted{tag, q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		if catalog, ok := c.byLanguage[r.tag]; ok {
+			return catalog
+		}
+		primary, _, _ := strings.Cut(r.tag, "-")
+		if catalog, ok := c.byLanguage[primary]; ok {
+			return catalog
+		}
+	}
+	return nil
+}
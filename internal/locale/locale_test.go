@@ -0,0 +1,113 @@
+package locale
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCatalogs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeCatalogs(t, map[string]string{
+		"de.json":    `{"No file provided": "Keine Datei angegeben"}`,
+		"pt-BR.json": `{}`,
+		"README.md":  "not a catalog",
+	})
+	catalogs, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := catalogs.Languages(); len(got) != 2 || got[0] != "de" || got[1] != "pt-br" {
+		t.Errorf("unexpected languages: %v", got)
+	}
+
+	for name, files := range map[string]map[string]string{
+		"invalid json": {"de.json": "{"},
+		"not strings":  {"de.json": `{"a": 1}`},
+		"bad name":     {"german.v2.json": "{}"},
+	} {
+		if _, err := Load(writeCatalogs(t, files)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestCatalogs_Negotiate(t *testing.T) {
+	catalogs, err := Load(writeCatalogs(t, map[string]string{
+		"de.json":    "{}",
+		"fr.json":    "{}",
+		"pt-br.json": "{}",
+	}))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		header string
+		want   string
+	}{
+		{"de", "de"},
+		{"de-AT", "de"},
+		{"PT-br", "pt-br"},
+		{"pt", ""},
+		{"en-US, fr;q=0.8, de;q=0.9", "de"},
+		{"fr;q=0, de;q=0.1", "de"},
+		{"*", ""},
+		{"en", ""},
+		{"", ""},
+	} {
+		got := ""
+		if catalog := catalogs.Negotiate(tc.header); catalog != nil {
+			got = catalog.Language
+		}
+		if got != tc.want {
+			t.Errorf("Accept-Language %q: expected %q, got %q", tc.header, tc.want, got)
+		}
+	}
+
+	var none *Catalogs
+	if none.Negotiate("de") != nil {
+		t.Error("expected no catalog without catalogs")
+	}
+}
+
+func TestCatalog_Translate(t *testing.T) {
+	catalog := &Catalog{Language: "de", messages: map[string]string{
+		"No file provided": "Keine Datei angegeben",
+		"Scan failed":      "Scan fehlgeschlagen",
+		"verdict.infected": "Schadsoftware gefunden",
+	}}
+
+	for message, want := range map[string]string{
+		"No file provided":         "Keine Datei angegeben",
+		"Scan failed: engine down": "Scan fehlgeschlagen: engine down",
+		"Not found":                "Not found",
+	} {
+		if got := catalog.Translate(message); got != want {
+			t.Errorf("Translate(%q) = %q, want %q", message, got, want)
+		}
+	}
+
+	for status, want := range map[string]string{
+		"infected": "Schadsoftware gefunden",
+		"clean":    "No threats found",
+		"unknown":  "unknown",
+	} {
+		if got := catalog.Verdict(status); got != want {
+			t.Errorf("Verdict(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
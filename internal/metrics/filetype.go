@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// metricFileTypes are the extensions reported as their own file_type label;
+// others are "other" so callers cannot inflate metric cardinality
+var metricFileTypes = map[string]bool{
+	"pdf": true, "doc": true, "docx": true, "xls": true, "xlsx": true, "ppt": true, "pptx": true,
+	"txt": true, "csv": true, "json": true, "xml": true, "html": true, "htm": true,
+	"eml": true, "msg": true,
+	"zip": true, "gz": true, "tgz": true, "tar": true, "7z": true, "rar": true,
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "svg": true,
+	"exe": true, "dll": true, "js": true, "sh": true,
+}
+
+// FileType maps a file name to a bounded set of metric labels
+func FileType(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	switch {
+	case ext == "":
+		return "none"
+	case metricFileTypes[ext]:
+		return ext
+	}
+	return "other"
+}
@@ -0,0 +1,18 @@
+package metrics
+
+import "testing"
+
+func TestFileType(t *testing.T) {
+	tests := map[string]string{
+		"report.PDF":      "pdf",
+		"archive.tar.gz":  "gz",
+		"README":          "none",
+		"payload.xyz123":  "other",
+		"dir.d/notes.txt": "txt",
+	}
+	for name, want := range tests {
+		if got := FileType(name); got != want {
+			t.Errorf("%s: expected %s, got %s", name, want, got)
+		}
+	}
+}
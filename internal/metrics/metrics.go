@@ -34,12 +34,280 @@ var (
 		},
 		[]string{"engine", "result"},
 	)
+
+	scanFileSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "av_scan_file_size_bytes",
+			Help:    "Size of scanned uploads by result and file type",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 11), // 1KB to 1GB
+		},
+		[]string{"result", "file_type"},
+	)
+
+	engineCPUSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "av_engine_cpu_seconds",
+			Help:    "User plus system CPU time of engine scan subprocesses by engine and file type",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12), // 10ms to ~20s
+		},
+		[]string{"engine", "file_type"},
+	)
+
+	enginePeakRSS = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "av_engine_peak_rss_bytes",
+			Help:    "Peak resident memory of engine scan subprocesses by engine and file type",
+			Buckets: prometheus.ExponentialBuckets(1024*1024, 2, 12), // 1MB to 2GB
+		},
+		[]string{"engine", "file_type"},
+	)
+
+	largeUploadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_large_uploads_total",
+			Help: "Uploads of at least 90% of MAX_FILE_SIZE by caller",
+		},
+		[]string{"caller"},
+	)
+
+	shadowScansTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_shadow_scans_total",
+			Help: "Shadow scans by primary engine, shadow engine and outcome (agree, disagree, error)",
+		},
+		[]string{"engine", "shadow_engine", "outcome"},
+	)
+
+	feedbackReportsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "av_feedback_reports_total",
+			Help: "Files reported as malicious after scanning clean",
+		},
+	)
+
+	authFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "av_auth_failures_total",
+			Help: "Requests rejected because authentication failed",
+		},
+	)
+
+	authBansTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "av_auth_bans_total",
+			Help: "Sources banned after repeated authentication failures",
+		},
+	)
+
+	authBannedRequestsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "av_auth_banned_requests_total",
+			Help: "Requests refused because their source is banned",
+		},
+	)
+
+	abuseFlagsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_abuse_flags_total",
+			Help: "Callers flagged for repeatedly submitting infected files, by caller and action",
+		},
+		[]string{"caller", "action"},
+	)
+
+	abuseRefusedScansTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_abuse_refused_scans_total",
+			Help: "Scans refused because their caller is blocked for abuse",
+		},
+		[]string{"caller"},
+	)
+
+	engineRestartsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_engine_restarts_total",
+			Help: "Engine on-access daemon starts seen in its RTS log",
+		},
+		[]string{"engine"},
+	)
+
+	engineFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_engine_failures_total",
+			Help: "Scans the engine could not complete although the file was still there",
+		},
+		[]string{"engine"},
+	)
+
+	scanErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_scan_errors_total",
+			Help: "Scans an engine failed, by why its output says it failed",
+		},
+		[]string{"engine", "category"},
+	)
+
+	engineCrashLooping = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "av_engine_crash_looping",
+			Help: "1 while the engine has ENGINE_CRASH_LOOP_THRESHOLD restarts or failures within the window",
+		},
+		[]string{"engine"},
+	)
+
+	eventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_events_total",
+			Help: "Scan result events by outcome (published, failed, dropped)",
+		},
+		[]string{"result"},
+	)
+
+	verdictMismatchTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_verdict_mismatch_total",
+			Help: "Manual scans whose verdict differs from the RTS detection of the same file",
+		},
+		[]string{"engine", "manual", "rts"},
+	)
+
+	panicsRecoveredTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_panics_recovered_total",
+			Help: "Panics recovered instead of crashing the process, by component",
+		},
+		[]string{"component"},
+	)
+
+	bucketScansTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_bucket_scans_total",
+			Help: "Objects from bucket notifications by outcome (a scan status, ignored, failed)",
+		},
+		[]string{"result"},
+	)
+
+	signatureAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "av_signature_age_seconds",
+			Help: "Age of the signature database the engine has loaded, as of its last health check",
+		},
+		[]string{"engine"},
+	)
+
+	licenseExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "av_engine_license_expiry_timestamp_seconds",
+			Help: "Unix time at which the engine license expires",
+		},
+		[]string{"engine"},
+	)
+
+	engineUpdatesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_engine_updates_total",
+			Help: "Signature updates requested through the API, by outcome",
+		},
+		[]string{"engine", "status"},
+	)
+
+	definitionSetSwitchesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_definition_set_switches_total",
+			Help: "Blue/green definition set switches requested through the API, by outcome",
+		},
+		[]string{"engine", "status"},
+	)
+
+	scanQueueRejectionsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "av_scan_queue_rejections_total",
+			Help: "Scans rejected because MAX_CONCURRENT_SCANS slots and the SCAN_QUEUE_DEPTH queue were full",
+		},
+	)
+
+	callerScansTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_caller_scans_total",
+			Help: "Scans charged to each caller, for chargeback",
+		},
+		[]string{"caller"},
+	)
+
+	callerScannedBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_caller_scanned_bytes_total",
+			Help: "Bytes scanned for each caller, for chargeback",
+		},
+		[]string{"caller"},
+	)
+
+	quotaExceededTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_quota_exceeded_total",
+			Help: "Scans refused because the caller's monthly quota was used up, by caller and limit",
+		},
+		[]string{"caller", "limit"},
+	)
+
+	rtsWaitStuckTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_rts_wait_stuck_total",
+			Help: "Scans failed by the watchdog after waiting RTS_WAIT_CEILING for an RTS verdict",
+		},
+		[]string{"engine"},
+	)
+
+	rateLimitedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_rate_limited_requests_total",
+			Help: "Requests refused because the caller exceeded RATE_LIMIT",
+		},
+		[]string{"caller"},
+	)
+
+	verdictCacheTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "av_verdict_cache_total",
+			Help: "Verdict cache lookups by result (hit, miss, bypass)",
+		},
+		[]string{"result"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(httpRequestsTotal)
 	prometheus.MustRegister(httpRequestDuration)
 	prometheus.MustRegister(scansTotal)
+	prometheus.MustRegister(scanFileSize)
+	prometheus.MustRegister(engineCPUSeconds)
+	prometheus.MustRegister(enginePeakRSS)
+	prometheus.MustRegister(largeUploadsTotal)
+	prometheus.MustRegister(shadowScansTotal)
+	prometheus.MustRegister(feedbackReportsTotal)
+	prometheus.MustRegister(authFailuresTotal)
+	prometheus.MustRegister(authBansTotal)
+	prometheus.MustRegister(authBannedRequestsTotal)
+	prometheus.MustRegister(abuseFlagsTotal)
+	prometheus.MustRegister(abuseRefusedScansTotal)
+	prometheus.MustRegister(engineRestartsTotal)
+	prometheus.MustRegister(engineFailuresTotal)
+	prometheus.MustRegister(scanErrorsTotal)
+	prometheus.MustRegister(engineCrashLooping)
+	prometheus.MustRegister(eventsTotal)
+	prometheus.MustRegister(bucketScansTotal)
+	prometheus.MustRegister(verdictMismatchTotal)
+	prometheus.MustRegister(panicsRecoveredTotal)
+	prometheus.MustRegister(licenseExpiry)
+	prometheus.MustRegister(signatureAge)
+	prometheus.MustRegister(engineUpdatesTotal)
+	prometheus.MustRegister(definitionSetSwitchesTotal)
+	prometheus.MustRegister(scanQueueRejectionsTotal)
+	prometheus.MustRegister(rateLimitedRequestsTotal)
+	prometheus.MustRegister(rtsWaitStuckTotal)
+	prometheus.MustRegister(callerScansTotal)
+	prometheus.MustRegister(callerScannedBytesTotal)
+	prometheus.MustRegister(quotaExceededTotal)
+	prometheus.MustRegister(verdictCacheTotal)
 }
 
 // Handler returns the Prometheus metrics HTTP handler
@@ -52,6 +320,157 @@ func RecordScan(engine, result string) {
 	scansTotal.WithLabelValues(engine, result).Inc()
 }
 
+// RecordScanSize records the size of a scanned upload
+func RecordScanSize(result, fileType string, size int64) {
+	scanFileSize.WithLabelValues(result, fileType).Observe(float64(size))
+}
+
+// RecordEngineUsage records the resources an engine scan subprocess used
+func RecordEngineUsage(engine, fileType string, cpu time.Duration, maxRSS int64) {
+	engineCPUSeconds.WithLabelValues(engine, fileType).Observe(cpu.Seconds())
+	if maxRSS > 0 {
+		enginePeakRSS.WithLabelValues(engine, fileType).Observe(float64(maxRSS))
+	}
+}
+
+// RecordLargeUpload counts an upload close to the size limit
+func RecordLargeUpload(caller string) {
+	largeUploadsTotal.WithLabelValues(caller).Inc()
+}
+
+// RecordShadowScan records how a shadow engine verdict compared to the primary one
+func RecordShadowScan(engine, shadowEngine, outcome string) {
+	shadowScansTotal.WithLabelValues(engine, shadowEngine, outcome).Inc()
+}
+
+// RecordFeedbackReport records a false-negative report
+func RecordFeedbackReport() {
+	feedbackReportsTotal.Inc()
+}
+
+// RecordAuthFailure records a request that failed authentication
+func RecordAuthFailure() {
+	authFailuresTotal.Inc()
+}
+
+// RecordAuthBan records a source being banned
+func RecordAuthBan() {
+	authBansTotal.Inc()
+}
+
+// RecordBannedRequest records a request refused from a banned source
+func RecordBannedRequest() {
+	authBannedRequestsTotal.Inc()
+}
+
+// RecordAbuseFlag records a caller flagged for submitting infected files
+func RecordAbuseFlag(caller, action string) {
+	abuseFlagsTotal.WithLabelValues(caller, action).Inc()
+}
+
+// RecordAbuseRefusal records a scan refused from a caller blocked for abuse
+func RecordAbuseRefusal(caller string) {
+	abuseRefusedScansTotal.WithLabelValues(caller).Inc()
+}
+
+// RecordEngineRestart records an engine daemon start
+func RecordEngineRestart(engine string) {
+	engineRestartsTotal.WithLabelValues(engine).Inc()
+}
+
+// RecordEngineFailure records a scan the engine failed to complete
+func RecordEngineFailure(engine string) {
+	engineFailuresTotal.WithLabelValues(engine).Inc()
+}
+
+// RecordScanError records a failed engine scan and its error category
+func RecordScanError(engine, category string) {
+	scanErrorsTotal.WithLabelValues(engine, category).Inc()
+}
+
+// SetEngineCrashLooping records whether an engine is crash-looping
+func SetEngineCrashLooping(engine string, looping bool) {
+	value := 0.0
+	if looping {
+		value = 1
+	}
+	engineCrashLooping.WithLabelValues(engine).Set(value)
+}
+
+// RecordEvent records the outcome of publishing a scan result event
+func RecordEvent(result string) {
+	eventsTotal.WithLabelValues(result).Inc()
+}
+
+// RecordVerdictMismatch records a manual scan verdict that differs from
+// the RTS verdict
+func RecordVerdictMismatch(engine, manual, rts string) {
+	verdictMismatchTotal.WithLabelValues(engine, manual, rts).Inc()
+}
+
+// RecordPanic records a panic recovered in component (http, scan, engine,
+// shadow)
+func RecordPanic(component string) {
+	panicsRecoveredTotal.WithLabelValues(component).Inc()
+}
+
+// RecordBucketScan records the outcome of an object announced by a bucket
+// notification
+func RecordBucketScan(result string) {
+	bucketScansTotal.WithLabelValues(result).Inc()
+}
+
+// SetLicenseExpiry records when an engine license expires
+func SetLicenseExpiry(engine string, expiresAt time.Time) {
+	licenseExpiry.WithLabelValues(engine).Set(float64(expiresAt.Unix()))
+}
+
+// SetSignatureAge records the age of an engine's loaded signatures
+func SetSignatureAge(engine string, seconds int64) {
+	signatureAge.WithLabelValues(engine).Set(float64(seconds))
+}
+
+// RecordEngineUpdate records a finished signature update and its outcome
+func RecordEngineUpdate(engine, status string) {
+	engineUpdatesTotal.WithLabelValues(engine, status).Inc()
+}
+
+// RecordDefinitionSetSwitch records a definition set switch and its outcome
+func RecordDefinitionSetSwitch(engine, status string) {
+	definitionSetSwitchesTotal.WithLabelValues(engine, status).Inc()
+}
+
+// RecordScanQueueRejection records a scan rejected because the scan queue was full
+func RecordScanQueueRejection() {
+	scanQueueRejectionsTotal.Inc()
+}
+
+// RecordCallerUsage records a scan of size bytes charged to a caller
+func RecordCallerUsage(caller string, size int64) {
+	callerScansTotal.WithLabelValues(caller).Inc()
+	callerScannedBytesTotal.WithLabelValues(caller).Add(float64(size))
+}
+
+// RecordQuotaExceeded records a scan refused by a caller's monthly quota
+func RecordQuotaExceeded(caller, limit string) {
+	quotaExceededTotal.WithLabelValues(caller, limit).Inc()
+}
+
+// RecordRTSWaitStuck records a scan failed by the RTS wait watchdog
+func RecordRTSWaitStuck(engine string) {
+	rtsWaitStuckTotal.WithLabelValues(engine).Inc()
+}
+
+// RecordRateLimited records a request refused by the per-caller rate limit
+func RecordRateLimited(caller string) {
+	rateLimitedRequestsTotal.WithLabelValues(caller).Inc()
+}
+
+// RecordVerdictCache records a verdict cache lookup: hit, miss or bypass
+func RecordVerdictCache(result string) {
+	verdictCacheTotal.WithLabelValues(result).Inc()
+}
+
 // Middleware wraps an http.Handler and records request metrics
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -83,3 +502,15 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift the
+// write deadline for event streams
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,127 @@
+// Package objectstore reads objects from S3-compatible stores by reference,
+// for POST /api/v1/scan/object and bucket scanning, so callers need not fetch
+// and re-upload large objects themselves.
+package objectstore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+// ErrNotFound is returned when the bucket or object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Object is an object being downloaded; the caller closes Body
+type Object struct {
+	Body        io.ReadCloser
+	Size        int64 // -1 when unknown
+	ContentType string
+	Header      http.Header // response headers, including x-amz-meta-* metadata
+}
+
+// Client fetches objects from an object store. S3 is the built-in
+// implementation; other stores can be plugged into the API in its place.
+type Client interface {
+	Get(ctx context.Context, endpoint, bucket, key string) (*Object, error)
+}
+
+// Credentials sign object store requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// New returns an S3 client for OBJECT_STORE_*, or nil when scan-by-reference
+// is disabled
+func New(cfg *config.Config) (Client, error) {
+	if len(cfg.ObjectStoreEndpoints) == 0 {
+		return nil, nil
+	}
+	s3, err := NewS3FromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return s3, nil
+}
+
+// NewS3FromConfig returns an S3 client with the OBJECT_STORE_* region,
+// credentials and timeout
+func NewS3FromConfig(cfg *config.Config) (*S3, error) {
+	var creds *Credentials
+	if cfg.ObjectStoreCredentialsFile != "" {
+		var err error
+		if creds, err = LoadCredentials(cfg.ObjectStoreCredentialsFile); err != nil {
+			return nil, err
+		}
+	}
+	return NewS3(cfg.ObjectStoreRegion, creds, time.Duration(cfg.ObjectStoreTimeout)*time.Millisecond), nil
+}
+
+// LoadCredentials reads the default profile of an AWS shared credentials
+// file, the format mounted for most S3 clients
+func LoadCredentials(path string) (*Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object store credentials: %w", err)
+	}
+	defer f.Close()
+
+	creds := &Credentials{}
+	section := "default"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || section != "default" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read object store credentials: %w", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("object store credentials file %s has no default access key", path)
+	}
+	return creds, nil
+}
+
+// bucketPattern accepts S3 and GCS bucket names
+var bucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,220}[a-z0-9]$`)
+
+// CheckRef rejects bucket names no store accepts and empty or oversized keys
+func CheckRef(bucket, key string) error {
+	if !bucketPattern.MatchString(bucket) {
+		return fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	if key == "" || len(key) > 1024 {
+		return errors.New("key must be 1 to 1024 bytes")
+	}
+	return nil
+}
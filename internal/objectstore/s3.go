@@ -0,0 +1,277 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the payload hash of a request without a body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 downloads with path-style GetObject requests, which AWS S3, MinIO and
+// the GCS XML API (with HMAC keys) all accept
+type S3 struct {
+	region string
+	creds  *Credentials // nil sends unsigned requests, for public buckets
+	client *http.Client
+}
+
+// NewS3 returns an S3 client. Redirects are not followed, so a download
+// never leaves the endpoint it was allowed for.
+func NewS3(region string, creds *Credentials, timeout time.Duration) *S3 {
+	return &S3{
+		region: region,
+		creds:  creds,
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Get downloads an object; a 404 from the store is ErrNotFound
+func (s *S3) Get(ctx context.Context, endpoint, bucket, key string) (*Object, error) {
+	resp, err := s.do(ctx, http.MethodGet, endpoint, bucket, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		Body:        resp.Body,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		Header:      resp.Header,
+	}, nil
+}
+
+// Copy copies an object, replacing its metadata and system headers with
+// header (Content-Type, Cache-Control, x-amz-meta-* and so on). Copying an
+// object onto itself is how S3 changes metadata. Objects over 5 GB need a
+// multipart copy, which is not supported.
+func (s *S3) Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string, header http.Header) error {
+	header = header.Clone()
+	header.Set("X-Amz-Copy-Source", "/"+s3Escape(srcBucket)+"/"+s3Escape(srcKey))
+	header.Set("X-Amz-Metadata-Directive", "REPLACE")
+	resp, err := s.do(ctx, http.MethodPut, endpoint, dstBucket, dstKey, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// A copy can fail after S3 has sent 200, with the error in the body
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(body, []byte("<Error>")) {
+		return fmt.Errorf("object copy failed: %s", bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Delete removes an object; deleting a missing object succeeds
+func (s *S3) Delete(ctx context.Context, endpoint, bucket, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, endpoint, bucket, key, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ObjectInfo is an object listed by List
+type ObjectInfo struct {
+	Key  string
+	Size int64
+}
+
+// List calls fn for every object in bucket whose key starts with prefix, in
+// key order, following ListObjectsV2 pagination. It stops at the first error
+// fn returns and returns that error.
+func (s *S3) List(ctx context.Context, endpoint, bucket, prefix string, fn func(ObjectInfo) error) error {
+	query := url.Values{"list-type": {"2"}}
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, endpoint, bucket, "", query, nil)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(io.LimitReader(resp.Body, 16*1024*1024)).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("invalid object listing: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if err := fn(ObjectInfo{Key: obj.Key, Size: obj.Size}); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// do sends a body-less request for an object, or for the bucket itself when
+// key is empty, and checks its status
+func (s *S3) do(ctx context.Context, method, endpoint, bucket, key string, query url.Values, header http.Header) (*http.Response, error) {
+	target := strings.TrimSuffix(endpoint, "/") + "/" + s3Escape(bucket)
+	if key != "" {
+		target += "/" + s3Escape(key)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object URL: %w", err)
+	}
+	req.URL.RawQuery = canonicalQuery(query)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.creds != nil {
+		req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+		SignV4(req, s.creds, s.region, "s3", emptySHA256, time.Now())
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		resp.Body.Close()
+		return nil, fmt.Errorf("object store returned status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// s3Escape percent-encodes everything but unreserved characters and "/",
+// as both the request path and its signature require
+func s3Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// SignV4 adds an AWS Signature Version 4 Authorization header to a request
+// whose body hashes to payloadHash. Host, Range and x-amz-* headers are
+// signed, as is the query string.
+func SignV4(req *http.Request, creds *Credentials, region, service, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + SHA256Hex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes a query string the way SigV4 signs it: sorted,
+// with everything but unreserved characters percent-encoded
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := slices.Clone(query[key])
+		slices.Sort(values)
+		for _, value := range values {
+			pairs = append(pairs, queryEscape(key)+"="+queryEscape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// queryEscape is s3Escape for query strings, where "/" is encoded too
+func queryEscape(s string) string {
+	return strings.ReplaceAll(s3Escape(s), "/", "%2F")
+}
+
+// SHA256Hex is the hex SHA-256 of s, as payload hashes are given to SignV4
+func SHA256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,195 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/inspect"
+	"gopkg.in/yaml.v3"
+)
+
+type Action string
+
+const (
+	ActionScan  Action = "scan"  // normal scan (default)
+	ActionSkip  Action = "skip"  // accept without invoking the engine
+	ActionDeep  Action = "deep"  // force a thorough scan
+	ActionBlock Action = "block" // reject without invoking the engine
+)
+
+// Rule maps file extensions and/or MIME types to an action.
+// A rule matches when any of its extensions or MIME types match and the file
+// size is within the optional bounds. FileTypes narrows a rule to files whose
+// content is of one of those types, so a renamed executable does not pass as
+// an image; a rule with only FileTypes matches on content alone.
+type Rule struct {
+	Name       string   `yaml:"name,omitempty"`
+	Extensions []string `yaml:"extensions,omitempty"`
+	MimeTypes  []string `yaml:"mimeTypes,omitempty"` // supports "type/*" wildcards
+	MinSize    int64    `yaml:"minSize,omitempty"`   // bytes, inclusive
+	MaxSize    int64    `yaml:"maxSize,omitempty"`   // bytes, inclusive; 0 = unbounded
+	Action     Action   `yaml:"action"`
+
+	// Categories (image, executable, ...) or MIME types, with "type/*"
+	// wildcards, matched against the type detected from the file's content
+	FileTypes []string `yaml:"fileTypes,omitempty"`
+
+	// Files above this entropy (bits per byte, 0-8) that are not a known
+	// compressed format are flagged suspicious; 0 disables
+	EntropyThreshold float64 `yaml:"entropyThreshold,omitempty"`
+}
+
+// PolicyConfig represents the YAML structure of the policy file
+type PolicyConfig struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Policy evaluates scan rules in order; the first matching rule wins
+type Policy struct {
+	rules []Rule
+}
+
+// Decision is the outcome of evaluating a file against the policy
+type Decision struct {
+	Action           Action  `json:"action"`
+	Rule             string  `json:"rule,omitempty"`
+	EntropyThreshold float64 `json:"-"`
+}
+
+// Load reads a policy file. An empty path returns an empty policy that scans everything.
+func Load(filePath string) (*Policy, error) {
+	if filePath == "" {
+		return &Policy{}, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var config PolicyConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	return New(config.Rules)
+}
+
+// New creates a policy from rules, validating actions and normalizing matchers
+func New(rules []Rule) (*Policy, error) {
+	normalized := make([]Rule, 0, len(rules))
+	for i, rule := range rules {
+		switch rule.Action {
+		case ActionScan, ActionSkip, ActionDeep, ActionBlock:
+		default:
+			return nil, fmt.Errorf("rule %d: invalid action: %q", i, rule.Action)
+		}
+		if len(rule.Extensions) == 0 && len(rule.MimeTypes) == 0 && len(rule.FileTypes) == 0 {
+			return nil, fmt.Errorf("rule %d: at least one extension, MIME type or file type is required", i)
+		}
+		if rule.EntropyThreshold < 0 || rule.EntropyThreshold > 8 {
+			return nil, fmt.Errorf("rule %d: entropy threshold must be between 0 and 8 bits per byte", i)
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+
+		exts := make([]string, len(rule.Extensions))
+		for j, ext := range rule.Extensions {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			exts[j] = ext
+		}
+		rule.Extensions = exts
+
+		mimes := make([]string, len(rule.MimeTypes))
+		for j, m := range rule.MimeTypes {
+			mimes[j] = strings.ToLower(m)
+		}
+		rule.MimeTypes = mimes
+
+		fileTypes := make([]string, len(rule.FileTypes))
+		for j, ft := range rule.FileTypes {
+			ft = strings.ToLower(ft)
+			if !strings.Contains(ft, "/") && !slices.Contains(inspect.Categories, ft) {
+				return nil, fmt.Errorf("rule %d: unknown file type: %q", i, ft)
+			}
+			fileTypes[j] = ft
+		}
+		rule.FileTypes = fileTypes
+
+		normalized = append(normalized, rule)
+	}
+	return &Policy{rules: normalized}, nil
+}
+
+// Evaluate returns the action for a file, given its declared MIME type and
+// the type detected from its content. A nil policy always scans.
+func (p *Policy) Evaluate(fileName, mimeType string, size int64, fileType inspect.FileType) Decision {
+	if p == nil {
+		return Decision{Action: ActionScan}
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	mimeType = normalizeMimeType(mimeType)
+
+	for _, rule := range p.rules {
+		if size < rule.MinSize || (rule.MaxSize > 0 && size > rule.MaxSize) {
+			continue
+		}
+		if len(rule.FileTypes) > 0 && !matchFileType(rule.FileTypes, fileType) {
+			continue
+		}
+		byContent := len(rule.Extensions) == 0 && len(rule.MimeTypes) == 0
+		if byContent || matchExtension(rule.Extensions, ext) || matchMimeType(rule.MimeTypes, mimeType) {
+			return Decision{Action: rule.Action, Rule: rule.Name, EntropyThreshold: rule.EntropyThreshold}
+		}
+	}
+	return Decision{Action: ActionScan}
+}
+
+func matchExtension(exts []string, ext string) bool {
+	if ext == "" {
+		return false
+	}
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func matchMimeType(patterns []string, mimeType string) bool {
+	if mimeType == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFileType matches a category or MIME type pattern against the detected
+// type
+func matchFileType(patterns []string, fileType inspect.FileType) bool {
+	return slices.Contains(patterns, fileType.Category) || matchMimeType(patterns, fileType.MimeType)
+}
+
+// normalizeMimeType strips parameters (e.g. "; charset=utf-8") and lowercases
+func normalizeMimeType(mimeType string) string {
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
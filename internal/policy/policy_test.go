@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/inspect"
+)
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p, err := New([]Rule{
+		{Name: "small-text", Extensions: []string{".txt"}, MaxSize: 1024, Action: ActionSkip},
+		{Name: "executables", Extensions: []string{"exe", ".JS"}, Action: ActionDeep},
+		{Name: "screensavers", Extensions: []string{".scr"}, Action: ActionBlock},
+		{Name: "images", MimeTypes: []string{"image/*"}, MaxSize: 1024 * 1024, Action: ActionSkip},
+	})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	tests := []struct {
+		fileName string
+		mimeType string
+		size     int64
+		action   Action
+		rule     string
+	}{
+		{"notes.txt", "text/plain", 100, ActionSkip, "small-text"},
+		{"notes.TXT", "", 1024, ActionSkip, "small-text"},
+		{"big.txt", "text/plain", 2048, ActionScan, ""},
+		{"setup.exe", "application/octet-stream", 5000, ActionDeep, "executables"},
+		{"app.js", "", 10, ActionDeep, "executables"},
+		{"evil.scr", "", 10, ActionBlock, "screensavers"},
+		{"photo", "image/jpeg; charset=binary", 500, ActionSkip, "images"},
+		{"photo.jpg", "IMAGE/PNG", 2 * 1024 * 1024, ActionScan, ""},
+		{"report.pdf", "application/pdf", 500, ActionScan, ""},
+		{"noext", "", 10, ActionScan, ""},
+	}
+
+	for _, tt := range tests {
+		d := p.Evaluate(tt.fileName, tt.mimeType, tt.size, inspect.FileType{})
+		if d.Action != tt.action || d.Rule != tt.rule {
+			t.Errorf("Evaluate(%q, %q, %d) = %+v, expected action %s rule %q",
+				tt.fileName, tt.mimeType, tt.size, d, tt.action, tt.rule)
+		}
+	}
+}
+
+func TestPolicy_EvaluateFileTypes(t *testing.T) {
+	p, err := New([]Rule{
+		{Name: "executables", FileTypes: []string{"executable"}, Action: ActionBlock},
+		{Name: "small-images", Extensions: []string{".jpg", ".png"}, FileTypes: []string{"Image"}, MaxSize: 1024 * 1024, Action: ActionSkip},
+		{Name: "pdf", FileTypes: []string{"application/pdf"}, Action: ActionDeep},
+	})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	jpeg := inspect.FileType{MimeType: "image/jpeg", Category: inspect.CategoryImage}
+	pe := inspect.FileType{MimeType: "application/vnd.microsoft.portable-executable", Category: inspect.CategoryExecutable}
+	tests := []struct {
+		fileName string
+		size     int64
+		fileType inspect.FileType
+		action   Action
+		rule     string
+	}{
+		{"photo.jpg", 500, jpeg, ActionSkip, "small-images"},
+		{"photo.jpg", 2 * 1024 * 1024, jpeg, ActionScan, ""},
+		{"photo.gif", 500, jpeg, ActionScan, ""}, // extension not listed
+		{"photo.jpg", 500, pe, ActionBlock, "executables"},
+		{"setup", 500, pe, ActionBlock, "executables"},
+		{"report.bin", 500, inspect.FileType{MimeType: "application/pdf", Category: inspect.CategoryDocument}, ActionDeep, "pdf"},
+		{"photo.jpg", 500, inspect.FileType{}, ActionScan, ""}, // type not detected
+	}
+
+	for _, tt := range tests {
+		d := p.Evaluate(tt.fileName, "", tt.size, tt.fileType)
+		if d.Action != tt.action || d.Rule != tt.rule {
+			t.Errorf("Evaluate(%q, %d, %+v) = %+v, expected action %s rule %q",
+				tt.fileName, tt.size, tt.fileType, d, tt.action, tt.rule)
+		}
+	}
+}
+
+func TestPolicy_NilScansEverything(t *testing.T) {
+	var p *Policy
+	if d := p.Evaluate("evil.scr", "", 10, inspect.FileType{}); d.Action != ActionScan {
+		t.Errorf("expected scan action for nil policy, got %s", d.Action)
+	}
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"invalid action", Rule{Extensions: []string{".exe"}, Action: "quarantine"}},
+		{"no matchers", Rule{Action: ActionBlock}},
+		{"unknown file type", Rule{FileTypes: []string{"picture"}, Action: ActionSkip}},
+		{"entropy threshold out of range", Rule{Extensions: []string{".bin"}, Action: ActionScan, EntropyThreshold: 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]Rule{tt.rule}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("empty path", func(t *testing.T) {
+		p, err := Load("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if d := p.Evaluate("evil.scr", "", 10, inspect.FileType{}); d.Action != ActionScan {
+			t.Errorf("expected scan action, got %s", d.Action)
+		}
+	})
+
+	t.Run("from file", func(t *testing.T) {
+		tmpFile := filepath.Join(t.TempDir(), "policy.yaml")
+		content := `rules:
+  - name: block-scr
+    extensions: [".scr"]
+    action: block
+`
+		if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write temp file: %v", err)
+		}
+
+		p, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if d := p.Evaluate("evil.scr", "", 10, inspect.FileType{}); d.Action != ActionBlock {
+			t.Errorf("expected block action, got %s", d.Action)
+		}
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		if _, err := Load("/nonexistent/policy.yaml"); err == nil {
+			t.Error("expected error for nonexistent file")
+		}
+	})
+}
@@ -0,0 +1,238 @@
+// Package quarantine keeps infected uploads, encrypted at rest, with the
+// metadata needed to investigate them later.
+package quarantine
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned for an unknown entry ID
+var ErrNotFound = errors.New("quarantine entry not found")
+
+// Entry describes a quarantined file
+type Entry struct {
+	ID            string    `json:"id"`
+	FileID        string    `json:"fileId"`
+	FileName      string    `json:"fileName"`
+	SHA256        string    `json:"sha256,omitempty"`
+	Size          int64     `json:"size"`
+	Engine        string    `json:"engine"`
+	Signature     string    `json:"signature,omitempty"`
+	Caller        string    `json:"caller,omitempty"` // uploader identity
+	ScannedAt     time.Time `json:"scannedAt"`
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+	// HasContent is false when the file was gone before it could be kept,
+	// e.g. removed by the engine's own on-access quarantine
+	HasContent bool `json:"hasContent"`
+}
+
+// Store keeps each entry as <id>.json metadata and, when the file could be
+// read, <id>.bin content encrypted with AES-256-GCM
+type Store struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// Open creates the quarantine directory if needed and loads the key, a
+// base64-encoded 32-byte AES key. An empty dir disables quarantine and
+// returns a nil Store.
+func Open(dir, keyFile string) (*Store, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("quarantine key must be 32 bytes, base64-encoded")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	return &Store{dir: dir, aead: aead}, nil
+}
+
+// Add quarantines the file at filePath under a new ID. A missing file is
+// recorded with metadata only. The caller still removes the original.
+func (s *Store) Add(filePath string, entry Entry) (*Entry, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s.add(data, entry)
+}
+
+// AddData quarantines content that was never written to a file
+func (s *Store) AddData(data []byte, entry Entry) (*Entry, error) {
+	if data == nil {
+		data = []byte{}
+	}
+	return s.add(data, entry)
+}
+
+// add stores data under a new ID; nil data records metadata only
+func (s *Store) add(data []byte, entry Entry) (*Entry, error) {
+	entry.ID = uuid.New().String()
+	entry.QuarantinedAt = time.Now().UTC()
+
+	if data != nil {
+		sum := sha256.Sum256(data)
+		entry.SHA256 = hex.EncodeToString(sum[:])
+		entry.Size = int64(len(data))
+		entry.HasContent = true
+
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		sealed := s.aead.Seal(nonce, nonce, data, []byte(entry.ID))
+		if err := os.WriteFile(s.path(entry.ID, ".bin"), sealed, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write quarantined file: %w", err)
+		}
+	}
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.path(entry.ID, ".json"), meta, 0600); err != nil {
+		os.Remove(s.path(entry.ID, ".bin"))
+		return nil, fmt.Errorf("failed to write quarantine metadata: %w", err)
+	}
+	return &entry, nil
+}
+
+// List returns all entries, most recently quarantined first
+func (s *Store) List() ([]Entry, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(matches))
+	for _, match := range matches {
+		entry, err := s.Get(strings.TrimSuffix(filepath.Base(match), ".json"))
+		if errors.Is(err, ErrNotFound) {
+			continue // purged meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].QuarantinedAt.After(entries[j].QuarantinedAt) })
+	return entries, nil
+}
+
+// Get returns an entry's metadata
+func (s *Store) Get(id string) (*Entry, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	meta, err := os.ReadFile(s.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		return nil, fmt.Errorf("invalid quarantine metadata %s: %w", id, err)
+	}
+	return &entry, nil
+}
+
+// Content returns an entry's decrypted file. Returns ErrNotFound if the
+// entry has no content.
+func (s *Store) Content(id string) ([]byte, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	sealed, err := os.ReadFile(s.path(id, ".bin"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("quarantined file %s is truncated", id)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	data, err := s.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt quarantined file %s: %w", id, err)
+	}
+	return data, nil
+}
+
+// Delete removes an entry and its content
+func (s *Store) Delete(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	if err := os.Remove(s.path(id, ".json")); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id, ".bin")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Purge removes every entry and returns how many were removed
+func (s *Store) Purge() (int, error) {
+	entries, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, entry := range entries {
+		err := s.Delete(entry.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// validID accepts only IDs issued by Add, so an ID never escapes the directory
+func validID(id string) bool {
+	parsed, err := uuid.Parse(id)
+	return err == nil && parsed.String() == id
+}
+
+func (s *Store) path(id, ext string) string {
+	return filepath.Join(s.dir, id+ext)
+}
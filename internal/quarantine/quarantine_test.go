@@ -0,0 +1,119 @@
+package quarantine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	keyFile := filepath.Join(tmpDir, "key")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{42}, 32))
+	if err := os.WriteFile(keyFile, []byte(key+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	s, err := Open(filepath.Join(tmpDir, "quarantine"), keyFile)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return s, tmpDir
+}
+
+func TestStore_AddAndContent(t *testing.T) {
+	s, tmpDir := newTestStore(t)
+
+	filePath := filepath.Join(tmpDir, "upload.bin")
+	content := []byte("malicious content")
+	os.WriteFile(filePath, content, 0644)
+
+	entry, err := s.Add(filePath, Entry{FileID: "abc", FileName: "invoice.exe", Engine: "clamav", Signature: "Test.Sig", Caller: "prod/ns1/sa1"})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if !entry.HasContent || entry.Size != int64(len(content)) || entry.SHA256 == "" || entry.QuarantinedAt.IsZero() {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	// Content is encrypted at rest
+	sealed, _ := os.ReadFile(s.path(entry.ID, ".bin"))
+	if bytes.Contains(sealed, content) {
+		t.Error("expected quarantined content to be encrypted")
+	}
+	data, err := s.Content(entry.ID)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("unexpected content %q (%v)", data, err)
+	}
+
+	got, err := s.Get(entry.ID)
+	if err != nil || got.Caller != "prod/ns1/sa1" || got.Signature != "Test.Sig" {
+		t.Errorf("unexpected metadata: %+v (%v)", got, err)
+	}
+}
+
+func TestStore_MissingFile(t *testing.T) {
+	s, tmpDir := newTestStore(t)
+
+	entry, err := s.Add(filepath.Join(tmpDir, "gone.bin"), Entry{FileID: "abc", Size: 10})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if entry.HasContent || entry.Size != 10 {
+		t.Errorf("expected metadata only, got %+v", entry)
+	}
+	if _, err := s.Content(entry.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_DeleteAndPurge(t *testing.T) {
+	s, tmpDir := newTestStore(t)
+
+	filePath := filepath.Join(tmpDir, "upload.bin")
+	var ids []string
+	for i := 0; i < 3; i++ {
+		os.WriteFile(filePath, []byte("content"), 0644)
+		entry, err := s.Add(filePath, Entry{FileID: "abc"})
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+
+	if err := s.Delete(ids[0]); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Delete(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Get("../key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an invalid ID, got %v", err)
+	}
+
+	entries, _ := s.List()
+	if len(entries) != 2 || entries[0].ID != ids[2] {
+		t.Errorf("expected the remaining entries newest first, got %+v", entries)
+	}
+	if purged, err := s.Purge(); err != nil || purged != 2 {
+		t.Errorf("expected 2 purged, got %d (%v)", purged, err)
+	}
+	if remaining, _ := os.ReadDir(s.dir); len(remaining) != 0 {
+		t.Errorf("expected an empty directory, got %d files", len(remaining))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if s, err := Open("", ""); s != nil || err != nil {
+		t.Errorf("expected a disabled store, got %v (%v)", s, err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString([]byte("too short"))), 0600)
+	if _, err := Open(t.TempDir(), keyFile); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}
@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/extract"
+)
+
+// findingEncrypted marks an archive whose members stay hidden from the engine
+const findingEncrypted = "archive:encrypted"
+
+// encryptedArchive applies ENCRYPTED_ARCHIVES to an upload. It returns the
+// members decrypted with the scan's passwords, and whether the upload is an
+// archive that stays encrypted.
+func (s *Scanner) encryptedArchive(filePath, fileID string, opts ScanOptions) ([]extract.Attachment, bool) {
+	mode := s.config.EncryptedArchives
+	if mode == "" || mode == config.EncryptedAllow {
+		return nil, false
+	}
+	encrypted, err := extract.IsEncryptedZip(filePath)
+	if err != nil || !encrypted {
+		return nil, false
+	}
+
+	switch {
+	case mode != config.EncryptedDecrypt:
+	case len(opts.Passwords) == 0:
+		s.logger.Warn("Encrypted archive without passwords", "fileId", fileID)
+	case !extracts(opts.Profile):
+	case opts.depth >= s.nestingDepth(opts.Profile):
+		s.logger.Warn("Maximum container nesting depth reached", "fileId", fileID, "depth", opts.depth)
+	default:
+		members, err := extract.DecryptZip(filePath, opts.Passwords)
+		if err == nil {
+			return members, false
+		}
+		s.logger.Warn("Failed to decrypt archive", "fileId", fileID, "error", err)
+	}
+	s.logger.Info("Encrypted archive", "fileId", fileID, "policy", mode)
+	return nil, true
+}
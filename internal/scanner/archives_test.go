@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// writeEncryptedZip writes a stored ZipCrypto archive with one member
+func writeEncryptedZip(t *testing.T, filePath, password string, content []byte) {
+	t.Helper()
+	crc := crc32.ChecksumIEEE(content)
+	data := append([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, byte(crc >> 24)}, content...)
+	keys := [3]uint32{0x12345678, 0x23456789, 0x34567890}
+	update := func(b byte) {
+		keys[0] = crc32.IEEETable[byte(keys[0])^b] ^ keys[0]>>8
+		keys[1] = (keys[1]+keys[0]&0xff)*134775813 + 1
+		keys[2] = crc32.IEEETable[byte(keys[2])^byte(keys[1]>>24)] ^ keys[2]>>8
+	}
+	for _, b := range []byte(password) {
+		update(b)
+	}
+	for i, p := range data {
+		k := keys[2] | 2
+		data[i] = p ^ byte((k*(k^1))>>8)
+		update(p)
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	fw, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "payload.com",
+		Method:             zip.Store,
+		Flags:              0x1,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create member: %v", err)
+	}
+	fw.Write(data)
+	w.Close()
+	if err := os.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+}
+
+func TestScanner_EncryptedArchives(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	scan := func(policy config.EncryptedArchivePolicy, passwords ...string) *ScanResponse {
+		t.Helper()
+		s.config.EncryptedArchives = policy
+		filePath := filepath.Join(tmpDir, "archive.zip")
+		writeEncryptedZip(t, filePath, "infected", []byte(drivers.EICARPattern()))
+		result, err := s.ScanWithOptions(filePath, "test-id", "archive.zip", 0, ScanOptions{Passwords: passwords})
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		return result
+	}
+
+	// The engine cannot see into the archive
+	if result := scan(config.EncryptedAllow); result.Status != drivers.StatusClean {
+		t.Errorf("expected clean, got %s", result.Status)
+	}
+	if result := scan(config.EncryptedWarn); result.Status != drivers.StatusSuspicious || result.Findings[0] != findingEncrypted {
+		t.Errorf("expected suspicious, got %s %v", result.Status, result.Findings)
+	}
+	if result := scan(config.EncryptedReject); result.Status != drivers.StatusBlocked {
+		t.Errorf("expected blocked, got %s", result.Status)
+	}
+	if result := scan(config.EncryptedDecrypt, "wrong"); result.Status != drivers.StatusBlocked {
+		t.Errorf("expected blocked for a wrong password, got %s", result.Status)
+	}
+
+	result := scan(config.EncryptedDecrypt, "wrong", "infected")
+	if result.Status != drivers.StatusInfected || len(result.Children) != 1 || len(result.Findings) != 0 {
+		t.Fatalf("expected the decrypted member to be detected: %+v", result)
+	}
+	if child := result.Children[0]; child.FileName != "payload.com" || child.Status != drivers.StatusInfected {
+		t.Errorf("unexpected member: %+v", child)
+	}
+}
@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// capacityWindow is how far back completed scans count toward rates and latency
+	capacityWindow = 5 * time.Minute
+	// maxCapacitySamples bounds memory under very high scan rates
+	maxCapacitySamples = 10000
+)
+
+// Capacity is a snapshot of scan load, for autoscalers
+type Capacity struct {
+	InFlight       int64   `json:"inFlight"`       // scans in progress, including queued ones
+	Queued         int64   `json:"queued"`         // scans waiting for throughput or a scan slot
+	Scans          int     `json:"scans"`          // scans completed in the window
+	ScansPerSecond float64 `json:"scansPerSecond"` // over the window
+	P50Latency     int64   `json:"p50Latency"`     // milliseconds
+	P95Latency     int64   `json:"p95Latency"`     // milliseconds
+	WindowSeconds  int     `json:"windowSeconds"`
+}
+
+type latencySample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// capacityTracker counts in-flight scans and keeps recent scan latencies
+type capacityTracker struct {
+	inFlight atomic.Int64
+	queued   atomic.Int64
+
+	mu      sync.Mutex
+	samples []latencySample // oldest first
+}
+
+func (c *capacityTracker) record(duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = append(c.samples, latencySample{at: time.Now(), duration: duration})
+	if len(c.samples) > maxCapacitySamples {
+		c.samples = c.samples[len(c.samples)-maxCapacitySamples:]
+	}
+}
+
+func (c *capacityTracker) snapshot() *Capacity {
+	now := time.Now()
+
+	c.mu.Lock()
+	cutoff := sort.Search(len(c.samples), func(i int) bool { return now.Sub(c.samples[i].at) <= capacityWindow })
+	c.samples = c.samples[cutoff:]
+	latencies := make([]time.Duration, len(c.samples))
+	for i, sample := range c.samples {
+		latencies[i] = sample.duration
+	}
+	c.mu.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p int) int64 {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return latencies[(len(latencies)-1)*p/100].Milliseconds()
+	}
+
+	return &Capacity{
+		InFlight:       c.inFlight.Load(),
+		Queued:         c.queued.Load(),
+		Scans:          len(latencies),
+		ScansPerSecond: float64(len(latencies)) / capacityWindow.Seconds(),
+		P50Latency:     percentile(50),
+		P95Latency:     percentile(95),
+		WindowSeconds:  int(capacityWindow.Seconds()),
+	}
+}
+
+// Capacity reports current scan load
+func (s *Scanner) Capacity() *Capacity {
+	return s.capacity.snapshot()
+}
+
+// LimitUsage is how much of each scan limit is in use, as a fraction; limits
+// that are not configured report 0
+type LimitUsage struct {
+	Throughput float64 // of THROUGHPUT_BURST; above 1 while scans wait for it
+	AsyncQueue float64 // of ASYNC_QUEUE_SIZE
+	ScanQueue  float64 // of SCAN_QUEUE_DEPTH
+}
+
+// LimitUsage reports how close the scanner is to rejecting scans
+func (s *Scanner) LimitUsage() LimitUsage {
+	var usage LimitUsage
+	if s.throughput != nil {
+		usage.Throughput = s.throughput.Usage()
+	}
+	if s.jobs != nil && cap(s.jobs.work) > 0 {
+		usage.AsyncQueue = float64(len(s.jobs.work)) / float64(cap(s.jobs.work))
+	}
+	if s.slots != nil && s.slots.depth > 0 {
+		usage.ScanQueue = float64(s.slots.waiting.Load()) / float64(s.slots.depth)
+	}
+	return usage
+}
@@ -0,0 +1,29 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCapacityTracker(t *testing.T) {
+	var c capacityTracker
+	for i := 1; i <= 100; i++ {
+		c.record(time.Duration(i) * time.Millisecond)
+	}
+	// Samples older than the window are dropped
+	c.samples[0].at = time.Now().Add(-capacityWindow - time.Second)
+
+	c.inFlight.Add(2)
+	c.queued.Add(1)
+
+	snapshot := c.snapshot()
+	if snapshot.Scans != 99 {
+		t.Errorf("expected 99 scans in window, got %d", snapshot.Scans)
+	}
+	if snapshot.P50Latency != 51 || snapshot.P95Latency != 95 {
+		t.Errorf("unexpected latencies: p50=%d p95=%d", snapshot.P50Latency, snapshot.P95Latency)
+	}
+	if snapshot.InFlight != 2 || snapshot.Queued != 1 {
+		t.Errorf("unexpected load: inFlight=%d queued=%d", snapshot.InFlight, snapshot.Queued)
+	}
+}
@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// defaultSlotRetryAfter is the Retry-After hint for a full scan queue before
+// any scan latency has been measured
+const defaultSlotRetryAfter = 5 * time.Second
+
+// scanSlots bounds the scans running at once (MAX_CONCURRENT_SCANS), so an
+// influx of uploads waits instead of starting an engine process each and
+// exhausting the engine's memory. Scans beyond the slots queue up to
+// SCAN_QUEUE_DEPTH deep.
+type scanSlots struct {
+	slots   chan struct{}
+	depth   int64
+	waiting atomic.Int64
+}
+
+func newScanSlots(concurrency, depth int) *scanSlots {
+	if concurrency <= 0 {
+		return nil
+	}
+	return &scanSlots{slots: make(chan struct{}, concurrency), depth: int64(depth)}
+}
+
+// acquireScanSlot waits for a scan slot and returns the function releasing
+// it, or a ThrottledError if the queue is full. Container members run in
+// their container's slot.
+func (s *Scanner) acquireScanSlot(fileID string) (func(), error) {
+	if s.slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-s.slots.slots }
+
+	select {
+	case s.slots.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	waiting := s.slots.waiting.Add(1)
+	defer s.slots.waiting.Add(-1)
+	if waiting > s.slots.depth {
+		retryAfter := s.slotRetryAfter(waiting)
+		s.logger.Warn("Scan rejected, scan queue full", "fileId", fileID, "waiting", waiting-1, "retryAfter", retryAfter)
+		metrics.RecordScanQueueRejection()
+		return nil, &ThrottledError{RetryAfter: retryAfter, Reason: "scan queue full"}
+	}
+
+	s.logger.Debug("Scan queued for a scan slot", "fileId", fileID, "waiting", waiting)
+	s.capacity.queued.Add(1)
+	defer s.capacity.queued.Add(-1)
+	s.slots.slots <- struct{}{}
+	return release, nil
+}
+
+// slotRetryAfter estimates when a slot frees up for a scan behind waiting
+// others, from the median scan latency
+func (s *Scanner) slotRetryAfter(waiting int64) time.Duration {
+	p50 := time.Duration(s.capacity.snapshot().P50Latency) * time.Millisecond
+	if p50 <= 0 {
+		return defaultSlotRetryAfter
+	}
+	rounds := (waiting + int64(cap(s.slots.slots)) - 1) / int64(cap(s.slots.slots))
+	return max(time.Duration(rounds)*p50, time.Second)
+}
@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// WatchCoverageWarnings checks that the active engine's on-access scanner
+// watches the upload directory. Engines that cannot report their watch paths
+// are not checked.
+func (s *Scanner) WatchCoverageWarnings() []string {
+	driver, _ := s.activeDriver()
+	reporter, ok := driver.(drivers.WatchPathsReporter)
+	if !ok {
+		return nil
+	}
+	include, exclude, err := reporter.WatchPaths()
+	if err != nil {
+		return []string{"could not read on-access watch paths: " + err.Error()}
+	}
+	if include == nil && exclude == nil {
+		return nil
+	}
+
+	dir, err := filepath.Abs(s.uploadDir())
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for _, path := range exclude {
+		if isWithin(dir, path) {
+			return []string{"upload directory is excluded from on-access scanning by " + path}
+		}
+	}
+	for _, path := range include {
+		if isWithin(dir, path) {
+			return nil
+		}
+	}
+	if len(include) == 0 {
+		return []string{"on-access scanning watches no paths"}
+	}
+	return []string{"upload directory is not watched by on-access scanning; watched paths: " + strings.Join(include, ", ")}
+}
+
+// isWithin reports whether dir is root or inside it
+func isWithin(dir, root string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), dir)
+	return err == nil && filepath.IsLocal(rel)
+}
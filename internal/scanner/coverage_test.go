@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+)
+
+func TestScanner_WatchCoverageWarnings(t *testing.T) {
+	uploadDir := t.TempDir()
+	confPath := filepath.Join(t.TempDir(), "clamd.conf")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name   string
+		conf   string
+		subdir string
+		warn   string
+	}{
+		{"watched", "OnAccessIncludePath " + uploadDir + "\n", "", ""},
+		{"subdir watched", "OnAccessIncludePath " + uploadDir + "/clamav\n", "clamav", ""},
+		{"parent not watched", "OnAccessIncludePath " + uploadDir + "/clamav\n", "", "not watched"},
+		{"excluded", "OnAccessIncludePath " + uploadDir + "\nOnAccessExcludePath " + uploadDir + "/clamav\n", "clamav", "excluded"},
+		{"no include", "LocalSocket /run/clamav/clamd.ctl\nOnAccessExcludePath /proc\n", "", "watches no paths"},
+	}
+
+	for _, tt := range tests {
+		os.WriteFile(confPath, []byte(tt.conf), 0644)
+		cfg := &config.Config{
+			UploadDir:    uploadDir,
+			ActiveEngine: config.EngineClamAV,
+			Drivers: map[config.EngineType]config.DriverConfig{
+				config.EngineClamAV: {Engine: config.EngineClamAV, UploadSubdir: tt.subdir, WatchConfigPath: confPath},
+			},
+		}
+		warnings := New(cfg, logger).WatchCoverageWarnings()
+		switch {
+		case tt.warn == "" && len(warnings) > 0:
+			t.Errorf("%s: unexpected warnings %v", tt.name, warnings)
+		case tt.warn != "" && (len(warnings) != 1 || !strings.Contains(warnings[0], tt.warn)):
+			t.Errorf("%s: expected warning containing %q, got %v", tt.name, tt.warn, warnings)
+		}
+	}
+}
+
+func TestScanner_EngineUploadSubdir(t *testing.T) {
+	cfg := &config.Config{
+		UploadDir:    "/tmp/av-scanner",
+		ActiveEngine: config.EngineMock,
+		Drivers: map[config.EngineType]config.DriverConfig{
+			config.EngineMock: {Engine: config.EngineMock, UploadSubdir: "mock"},
+		},
+	}
+	s := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if got := s.GetUploadPath("id", "a.txt"); got != "/tmp/av-scanner/mock/id.txt" {
+		t.Errorf("unexpected upload path: %s", got)
+	}
+}
@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// DefinitionsUpdate records the service's reaction to new engine signatures
+type DefinitionsUpdate struct {
+	ReceivedAt    time.Time       `json:"receivedAt"`
+	Version       string          `json:"version,omitempty"`       // as reported by the update tooling
+	EngineVersion string          `json:"engineVersion,omitempty"` // as reported by the engine afterwards
+	EngineHealthy bool            `json:"engineHealthy"`
+	CacheCleared  int             `json:"cacheCleared"`
+	SelfTest      *SelfTestResult `json:"selfTest"`
+}
+
+// SelfTestResult is the outcome of scanning the EICAR test file
+type SelfTestResult struct {
+	Passed    bool               `json:"passed"`
+	Status    drivers.ScanStatus `json:"status"`
+	Signature string             `json:"signature,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Duration  int64              `json:"duration"` // milliseconds
+}
+
+type definitionsState struct {
+	mu     sync.RWMutex
+	latest *DefinitionsUpdate
+}
+
+// DefinitionsUpdated reacts to new signatures: cached RTS detections are
+// dropped, the engine's health and version are re-read and a self-test scan
+// verifies the engine still detects EICAR
+func (s *Scanner) DefinitionsUpdated(version string) *DefinitionsUpdate {
+	update := &DefinitionsUpdate{
+		ReceivedAt:   time.Now(),
+		Version:      version,
+		CacheCleared: s.DetectionCache().Clear(),
+	}
+
+	if health, err := s.GetActiveEngineHealth(); err == nil && health != nil {
+		update.EngineVersion = health.Version
+		update.EngineHealthy = health.Healthy
+	}
+
+	update.SelfTest = s.SelfTest()
+
+	s.definitions.mu.Lock()
+	s.definitions.latest = update
+	s.definitions.mu.Unlock()
+
+	s.logger.Info("Definitions updated",
+		"version", version,
+		"engineVersion", update.EngineVersion,
+		"cacheCleared", update.CacheCleared,
+		"selfTestPassed", update.SelfTest.Passed,
+	)
+	if !update.SelfTest.Passed {
+		s.logger.Error("Self-test scan failed after definitions update",
+			"status", update.SelfTest.Status,
+			"error", update.SelfTest.Error,
+		)
+	}
+
+	return update
+}
+
+// LastDefinitionsUpdate returns the most recent update, or nil if none
+func (s *Scanner) LastDefinitionsUpdate() *DefinitionsUpdate {
+	s.definitions.mu.RLock()
+	defer s.definitions.mu.RUnlock()
+	return s.definitions.latest
+}
+
+// DefinitionsVersion identifies the signatures in use, as last reported by
+// update tooling or the engine; "" until definitions have been updated
+func (s *Scanner) DefinitionsVersion() string {
+	latest := s.LastDefinitionsUpdate()
+	switch {
+	case latest == nil:
+		return ""
+	case latest.Version != "":
+		return latest.Version
+	}
+	return latest.EngineVersion
+}
+
+// SelfTest scans the EICAR test file with the active engine, bypassing the
+// scan policy and throughput limit. It passes if the file is reported infected
+// by the manual scan or, if RTS removed it first, by the detection cache.
+func (s *Scanner) SelfTest() *SelfTestResult {
+	start := time.Now()
+	driver, detectionCache := s.activeDriver()
+	fileID := s.GenerateFileID()
+	filePath := filepath.Join(s.uploadDir(), "selftest-"+fileID+".com")
+	result := &SelfTestResult{Status: drivers.StatusError}
+
+	if err := os.MkdirAll(s.uploadDir(), 0755); err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start).Milliseconds()
+		return result
+	}
+	if err := os.WriteFile(filePath, []byte(drivers.EICARPattern()), 0644); err != nil {
+		result.Error = err.Error()
+		result.Duration = time.Since(start).Milliseconds()
+		return result
+	}
+	defer s.deleteFile(filePath, fileID)
+
+	scanResult, err := driver.ManualScan(filePath, drivers.ScanOptions{})
+	if err == nil {
+		result.Status = scanResult.Status
+		result.Signature = scanResult.Signature
+	} else {
+		result.Error = err.Error()
+	}
+
+	if result.Status != drivers.StatusInfected {
+		absPath, _ := filepath.Abs(filePath)
+		deadline := time.Now().Add(time.Duration(driver.Config().RTSCacheBaseDelay) * time.Millisecond)
+		for {
+			if cached, found := detectionCache.Get(absPath); found && cached.Status == "infected" {
+				result.Status = drivers.StatusInfected
+				result.Signature = cached.Signature
+				result.Error = ""
+				break
+			}
+			if time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	result.Passed = result.Status == drivers.StatusInfected
+	result.Duration = time.Since(start).Milliseconds()
+	return result
+}
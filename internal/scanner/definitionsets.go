@@ -0,0 +1,240 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// standbyPlaceholder in an update command is replaced with the definition set
+// the engine is not loading, so updates land there until switched to
+const standbyPlaceholder = "{standby}"
+
+var (
+	ErrDefinitionSetsUnsupported = errors.New("engine has no definition sets")
+	ErrUnknownDefinitionSet      = errors.New("unknown definition set")
+	ErrDefinitionSetRolledBack   = errors.New("definition set switch rolled back")
+)
+
+// DefinitionSet is one of an engine's blue/green signature directories
+type DefinitionSet struct {
+	Name      string     `json:"name"`
+	Path      string     `json:"path"`
+	Active    bool       `json:"active"`
+	Files     int        `json:"files"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"` // newest file's modification time
+}
+
+// EngineDefinitionSets reports which definition set an engine loads
+type EngineDefinitionSets struct {
+	Engine      config.EngineType  `json:"engine"`
+	Link        string             `json:"link"`
+	Active      string             `json:"active"` // "" while the link points at neither set
+	Sets        []DefinitionSet    `json:"sets"`
+	Definitions *DefinitionsUpdate `json:"definitions,omitempty"` // set when the active engine switched
+}
+
+type definitionSetsState struct {
+	mu sync.Mutex // serializes switches, and updates of the standby set against them
+}
+
+// EngineDefinitionSets returns the engine's definition sets and which one
+// its definitions link points at
+func (s *Scanner) EngineDefinitionSets(engine config.EngineType) (*EngineDefinitionSets, error) {
+	driverCfg, _, err := s.engineConfig(engine)
+	if err != nil {
+		return nil, err
+	}
+	if driverCfg.DefinitionsLink == "" {
+		return nil, fmt.Errorf("%w: %s", ErrDefinitionSetsUnsupported, engine)
+	}
+	return definitionSets(driverCfg), nil
+}
+
+// SwitchDefinitionSet points the engine's definitions link at the named set
+// in one atomic rename and has the engine reload its signatures. If it is
+// the active engine the switch is then handled as DefinitionsUpdated does. A
+// failed reload or self-test points the link back and returns
+// ErrDefinitionSetRolledBack; switching back is the rollback for a set that
+// passed but misbehaves.
+func (s *Scanner) SwitchDefinitionSet(engine config.EngineType, name string) (*EngineDefinitionSets, error) {
+	driverCfg, reloader, err := s.engineConfig(engine)
+	if err != nil {
+		return nil, err
+	}
+	link := driverCfg.DefinitionsLink
+	if link == "" {
+		return nil, fmt.Errorf("%w: %s", ErrDefinitionSetsUnsupported, engine)
+	}
+	dir := ""
+	for _, set := range driverCfg.DefinitionSets {
+		if filepath.Base(set) == name {
+			dir = set
+		}
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDefinitionSet, name)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("definition set %s is not a directory: %s", name, dir)
+	}
+
+	s.definitionSets.mu.Lock()
+	defer s.definitionSets.mu.Unlock()
+	// The standby set may be half written while it updates
+	if update := s.EngineUpdateStatus(engine); update != nil && update.Status == UpdateRunning {
+		return nil, fmt.Errorf("%w since %s", ErrUpdateRunning, update.StartedAt.Format(time.RFC3339))
+	}
+	previous := definitionsTarget(link)
+	if previous == filepath.Clean(dir) {
+		return definitionSets(driverCfg), nil
+	}
+
+	if err := pointLink(link, dir); err != nil {
+		metrics.RecordDefinitionSetSwitch(string(engine), "failed")
+		return nil, fmt.Errorf("failed to switch definition set: %w", err)
+	}
+	s.logger.Info("Definition set switched", "engine", engine, "set", name, "previous", previous)
+
+	definitions, err := s.reloadDefinitions(engine, reloader)
+	if err != nil {
+		s.logger.Error("Definition set failed after switch", "engine", engine, "set", name, "error", err)
+		if previous == "" {
+			metrics.RecordDefinitionSetSwitch(string(engine), "failed")
+			return nil, err
+		}
+		if linkErr := pointLink(link, previous); linkErr != nil {
+			metrics.RecordDefinitionSetSwitch(string(engine), "failed")
+			return nil, fmt.Errorf("%w, and rolling back failed: %v", err, linkErr)
+		}
+		if _, reloadErr := s.reloadDefinitions(engine, reloader); reloadErr != nil {
+			s.logger.Error("Previous definition set failed after rollback", "engine", engine, "error", reloadErr)
+		}
+		metrics.RecordDefinitionSetSwitch(string(engine), "rolled_back")
+		return nil, fmt.Errorf("%w to %s: %v", ErrDefinitionSetRolledBack, filepath.Base(previous), err)
+	}
+
+	metrics.RecordDefinitionSetSwitch(string(engine), "succeeded")
+	result := definitionSets(driverCfg)
+	result.Definitions = definitions
+	return result, nil
+}
+
+// reloadDefinitions has the engine load the signatures its link points at
+// and, if it is the active engine, re-checks them as DefinitionsUpdated does
+func (s *Scanner) reloadDefinitions(engine config.EngineType, reloader drivers.Reloader) (*DefinitionsUpdate, error) {
+	if reloader != nil {
+		if err := reloader.Reload(); err != nil {
+			return nil, fmt.Errorf("signature reload failed: %w", err)
+		}
+	}
+	if engine != s.ActiveEngine() {
+		return nil, nil
+	}
+	definitions := s.DefinitionsUpdated("")
+	if !definitions.SelfTest.Passed {
+		return definitions, errors.New("self-test scan failed after switch")
+	}
+	return definitions, nil
+}
+
+// standbyDefinitionSet returns the set the engine's link does not point at
+func standbyDefinitionSet(driverCfg config.DriverConfig) (string, error) {
+	if driverCfg.DefinitionsLink == "" {
+		return "", fmt.Errorf("%w: %s", ErrDefinitionSetsUnsupported, driverCfg.Engine)
+	}
+	active := definitionsTarget(driverCfg.DefinitionsLink)
+	for i, set := range driverCfg.DefinitionSets {
+		if filepath.Clean(set) == active {
+			return driverCfg.DefinitionSets[1-i], nil
+		}
+	}
+	return "", fmt.Errorf("definitions link %s points at no definition set, switch to one first", driverCfg.DefinitionsLink)
+}
+
+// standbyCommand replaces standbyPlaceholder in command, reporting whether
+// it was there
+func standbyCommand(command []string, standby string) ([]string, bool) {
+	replaced := make([]string, len(command))
+	found := false
+	for i, arg := range command {
+		replaced[i] = strings.ReplaceAll(arg, standbyPlaceholder, standby)
+		found = found || replaced[i] != arg
+	}
+	return replaced, found
+}
+
+// definitionSets reads where the link points and what each set holds
+func definitionSets(driverCfg config.DriverConfig) *EngineDefinitionSets {
+	active := definitionsTarget(driverCfg.DefinitionsLink)
+	result := &EngineDefinitionSets{
+		Engine: driverCfg.Engine,
+		Link:   driverCfg.DefinitionsLink,
+		Sets:   make([]DefinitionSet, 0, len(driverCfg.DefinitionSets)),
+	}
+	for _, dir := range driverCfg.DefinitionSets {
+		set := DefinitionSet{Name: filepath.Base(dir), Path: dir, Active: filepath.Clean(dir) == active}
+		if set.Active {
+			result.Active = set.Name
+		}
+		set.Files, set.UpdatedAt = definitionFiles(dir)
+		result.Sets = append(result.Sets, set)
+	}
+	return result
+}
+
+// definitionsTarget returns the directory link points at, "" if it is not
+// a symlink
+func definitionsTarget(link string) string {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+	return filepath.Clean(target)
+}
+
+// definitionFiles counts the signature files in dir and finds the newest
+func definitionFiles(dir string) (int, *time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, nil
+	}
+	files := 0
+	var newest *time.Time
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files++
+		if modTime := info.ModTime(); newest == nil || modTime.After(*newest) {
+			newest = &modTime
+		}
+	}
+	return files, newest
+}
+
+// pointLink replaces link with a symlink to dir by renaming a new symlink
+// over it, so the engine never finds the link missing
+func pointLink(link, dir string) error {
+	tmp := fmt.Sprintf("%s.tmp-%d", link, time.Now().UnixNano())
+	if err := os.Symlink(dir, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
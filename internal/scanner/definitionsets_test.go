@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// reloadingDriver fails to reload a definition set holding a "broken" file,
+// as clamd does with a corrupt database
+type reloadingDriver struct {
+	drivers.Driver
+	reloads int
+}
+
+func (d *reloadingDriver) Reload() error {
+	d.reloads++
+	if _, err := os.Stat(filepath.Join(d.Config().DefinitionsLink, "broken")); err == nil {
+		return errors.New("database corrupt")
+	}
+	return nil
+}
+
+// useDefinitionSets gives the mock engine blue and green definition sets,
+// with its link pointing at blue
+func useDefinitionSets(t *testing.T, s *Scanner, tmpDir string, updateCommand ...string) *reloadingDriver {
+	t.Helper()
+	blue, green := filepath.Join(tmpDir, "defs", "blue"), filepath.Join(tmpDir, "defs", "green")
+	for _, dir := range []string{blue, green} {
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "main.cvd"), []byte("signatures"), 0644)
+	}
+	link := filepath.Join(tmpDir, "clamav")
+	if err := os.Symlink(blue, link); err != nil {
+		t.Fatalf("failed to create definitions link: %v", err)
+	}
+	driver := &reloadingDriver{Driver: drivers.NewMockDriver(config.DriverConfig{
+		Engine:          config.EngineMock,
+		DefinitionsLink: link,
+		DefinitionSets:  []string{blue, green},
+		UpdateCommand:   updateCommand,
+		UpdateTimeout:   5000,
+	})}
+	s.drivers[config.EngineMock] = driver
+	return driver
+}
+
+func TestScanner_SwitchDefinitionSet(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	driver := useDefinitionSets(t, s, tmpDir)
+
+	sets, err := s.EngineDefinitionSets(config.EngineMock)
+	if err != nil {
+		t.Fatalf("failed to read definition sets: %v", err)
+	}
+	if sets.Active != "blue" || len(sets.Sets) != 2 || !sets.Sets[0].Active || sets.Sets[1].Files != 1 {
+		t.Errorf("expected blue active with one file per set, got %+v", sets)
+	}
+
+	sets, err = s.SwitchDefinitionSet(config.EngineMock, "green")
+	if err != nil {
+		t.Fatalf("failed to switch: %v", err)
+	}
+	if sets.Active != "green" || driver.reloads != 1 {
+		t.Errorf("expected green active after one reload, got %+v after %d reloads", sets, driver.reloads)
+	}
+	if sets.Definitions == nil || !sets.Definitions.SelfTest.Passed {
+		t.Errorf("expected the active engine's definitions to be re-checked, got %+v", sets.Definitions)
+	}
+	if target, _ := os.Readlink(filepath.Join(tmpDir, "clamav")); target != filepath.Join(tmpDir, "defs", "green") {
+		t.Errorf("expected the link to point at green, got %q", target)
+	}
+
+	if _, err := s.SwitchDefinitionSet(config.EngineMock, "green"); err != nil || driver.reloads != 1 {
+		t.Errorf("expected switching to the active set to do nothing, got %v after %d reloads", err, driver.reloads)
+	}
+	if _, err := s.SwitchDefinitionSet(config.EngineMock, "red"); !errors.Is(err, ErrUnknownDefinitionSet) {
+		t.Errorf("expected ErrUnknownDefinitionSet, got %v", err)
+	}
+	if _, err := s.SwitchDefinitionSet(config.EngineTrendMicro, "green"); !errors.Is(err, ErrDefinitionSetsUnsupported) {
+		t.Errorf("expected ErrDefinitionSetsUnsupported, got %v", err)
+	}
+	if _, err := s.EngineDefinitionSets("bogus"); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("expected ErrUnknownEngine, got %v", err)
+	}
+}
+
+func TestScanner_SwitchDefinitionSetRollsBack(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	driver := useDefinitionSets(t, s, tmpDir)
+	os.WriteFile(filepath.Join(tmpDir, "defs", "green", "broken"), nil, 0644)
+
+	if _, err := s.SwitchDefinitionSet(config.EngineMock, "green"); !errors.Is(err, ErrDefinitionSetRolledBack) {
+		t.Fatalf("expected ErrDefinitionSetRolledBack, got %v", err)
+	}
+	if sets, _ := s.EngineDefinitionSets(config.EngineMock); sets.Active != "blue" {
+		t.Errorf("expected blue active again, got %q", sets.Active)
+	}
+	if driver.reloads != 2 {
+		t.Errorf("expected blue to be reloaded after the rollback, got %d reloads", driver.reloads)
+	}
+}
+
+func TestScanner_EngineUpdateStandby(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	updater := filepath.Join(tmpDir, "freshclam")
+	os.WriteFile(updater, []byte("#!/bin/sh\ntouch \"$1/daily.cvd\"\n"), 0755)
+	driver := useDefinitionSets(t, s, tmpDir, updater, "{standby}")
+
+	if _, err := s.StartEngineUpdate(config.EngineMock); err != nil {
+		t.Fatalf("failed to start update: %v", err)
+	}
+	update := waitForUpdate(t, s, config.EngineMock)
+	if update.Status != UpdateSucceeded || update.DefinitionSet != "green" {
+		t.Errorf("expected the update to write to green, got %+v", update)
+	}
+	if update.Definitions != nil || driver.reloads != 0 {
+		t.Errorf("expected the standby update not to be loaded, got %+v after %d reloads", update.Definitions, driver.reloads)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "defs", "green", "daily.cvd")); err != nil {
+		t.Errorf("expected the updater to write to green: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "defs", "blue", "daily.cvd")); err == nil {
+		t.Error("expected blue to be left alone")
+	}
+}
@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// Multi-engine scans (AV_ENGINES) send every upload to several engines at
+// once. Each engine scans its own copy, watched by its own on-access
+// scanner, and the verdicts are combined by ENGINE_AGGREGATION.
+
+// EngineVerdict is one engine's verdict in a multi-engine scan
+type EngineVerdict struct {
+	Engine    config.EngineType  `json:"engine"`
+	Status    drivers.ScanStatus `json:"status"`
+	Signature string             `json:"signature,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Duration  int64              `json:"duration"`
+
+	ErrorCategory drivers.ErrorCategory `json:"errorCategory,omitempty"`
+}
+
+func newEngineVerdict(engine config.EngineType, status drivers.ScanStatus, signature string, err error, start time.Time) *EngineVerdict {
+	v := &EngineVerdict{
+		Engine:    engine,
+		Status:    status,
+		Signature: signature,
+		Duration:  time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		v.Status = drivers.StatusError
+		v.Error = err.Error()
+		var engineErr *EngineError
+		if errors.As(err, &engineErr) {
+			v.ErrorCategory = engineErr.Category
+		}
+	}
+	return v
+}
+
+// otherEngines returns the engines that scan an upload besides the active
+// one: every AV_ENGINES engine, or those of them in requested when the scan
+// names its engines
+func (s *Scanner) otherEngines(requested []config.EngineType) []config.EngineType {
+	others := s.Engines()[1:]
+	if requested == nil {
+		return others
+	}
+	return slices.DeleteFunc(others, func(engine config.EngineType) bool {
+		return !slices.Contains(requested, engine)
+	})
+}
+
+// startEngineScans copies the upload for every engine other than the active
+// one and scans the copies concurrently. The channel yields their verdicts
+// in AV_ENGINES order once all have finished.
+func (s *Scanner) startEngineScans(others []config.EngineType, filePath, fileID string, size int64, profile config.ScanProfile, deep bool) <-chan []*EngineVerdict {
+	verdicts := make([]*EngineVerdict, len(others))
+	var wg sync.WaitGroup
+	for i, engine := range others {
+		start := time.Now()
+
+		// The active engine (or RTS) removes the original
+		engineDir := s.config.EngineUploadDir(engine)
+		enginePath := filepath.Join(engineDir, string(engine)+"-"+fileID+filepath.Ext(filePath))
+		if err := os.MkdirAll(engineDir, 0755); err != nil {
+			verdicts[i] = newEngineVerdict(engine, "", "", fmt.Errorf("failed to create upload directory: %w", err), start)
+			continue
+		}
+		if err := s.copyUpload(filePath, enginePath); err != nil {
+			verdicts[i] = newEngineVerdict(engine, "", "", fmt.Errorf("failed to copy file: %w", err), start)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.uploads.Remove(enginePath)
+			defer func() {
+				if r := recover(); r != nil {
+					verdicts[i] = newEngineVerdict(engine, "", "", s.recovered("engine", r, "fileId", fileID, "engine", engine), start)
+				}
+			}()
+			driver, detectionCache := s.engineDriver(engine)
+			_, status, signature, err := s.runEngine(driver, detectionCache, enginePath, fileID, size, profile, deep, nil)
+			verdicts[i] = newEngineVerdict(engine, status, signature, err, start)
+		}()
+	}
+
+	done := make(chan []*EngineVerdict, 1)
+	go func() {
+		wg.Wait()
+		done <- verdicts
+	}()
+	return done
+}
+
+// aggregateVerdicts combines engine verdicts into one status. The signature
+// is the first detecting engine's. An error is returned only when the
+// verdicts leave the upload undecided.
+func aggregateVerdicts(mode config.EngineAggregation, verdicts []*EngineVerdict) (drivers.ScanStatus, string, error) {
+	var infected, failed int
+	var signature string
+	for _, v := range verdicts {
+		switch v.Status {
+		case drivers.StatusInfected:
+			if infected == 0 {
+				signature = v.Signature
+			}
+			infected++
+		case drivers.StatusError:
+			failed++
+		}
+	}
+	completed := len(verdicts) - failed
+
+	if completed == 0 {
+		return "", "", fmt.Errorf("scan failed: every engine failed")
+	}
+	switch mode {
+	case config.AggregateAllClean:
+		if infected > 0 {
+			return drivers.StatusInfected, signature, nil
+		}
+		if failed > 0 {
+			return "", "", fmt.Errorf("scan failed: %d of %d engines failed", failed, len(verdicts))
+		}
+	case config.AggregateMajority:
+		if infected*2 > completed {
+			return drivers.StatusInfected, signature, nil
+		}
+	default:
+		if infected > 0 {
+			return drivers.StatusInfected, signature, nil
+		}
+	}
+	return drivers.StatusClean, "", nil
+}
+
+// Errors returned by SetActiveEngine for requests that cannot be honoured
+var (
+	ErrUnknownEngine       = errors.New("unknown engine")
+	ErrEngineSwitchRefused = errors.New("engine switch refused")
+)
+
+// SetActiveEngine switches the active engine without a restart. The new
+// engine's driver and log watcher start before it takes over, so a failed
+// start leaves the current engine active; the previous engine's watcher is
+// stopped afterwards. Scans already in progress finish on the previous
+// engine.
+func (s *Scanner) SetActiveEngine(engine config.EngineType) error {
+	s.switchMu.Lock()
+	defer s.switchMu.Unlock()
+
+	switch engine {
+	case config.EngineClamAV, config.EngineTrendMicro, config.EngineDefender, config.EngineSophos, config.EngineMock:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownEngine, engine)
+	}
+	current := s.ActiveEngine()
+	if engine == current {
+		return nil
+	}
+	if len(s.Engines()) > 1 {
+		return fmt.Errorf("%w: AV_ENGINES scans every upload with several engines", ErrEngineSwitchRefused)
+	}
+	if s.shadow != nil && s.shadow.Engine() == engine {
+		return fmt.Errorf("%w: %s is the shadow engine", ErrEngineSwitchRefused, engine)
+	}
+
+	if err := os.MkdirAll(s.config.EngineUploadDir(engine), 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	detectionCache := cache.NewDetectionCache(cache.DefaultTTL)
+	driver := newDriver(s.config, engine, s.logger, detectionCache)
+	s.watchRestarts(driver)
+	if err := driver.Start(); err != nil {
+		detectionCache.Stop()
+		return fmt.Errorf("failed to start %s: %w", engine, err)
+	}
+
+	s.engineMu.Lock()
+	previous, previousCache := s.drivers[current], s.detectionCache
+	s.drivers = map[config.EngineType]drivers.Driver{engine: driver}
+	s.engineCaches = map[config.EngineType]*cache.DetectionCache{engine: detectionCache}
+	s.activeEngine = engine
+	s.engines = []config.EngineType{engine}
+	s.detectionCache = detectionCache
+	s.engineMu.Unlock()
+
+	previous.Stop()
+	previousCache.Stop()
+	s.logger.Warn("Active engine switched", "from", current, "to", engine)
+	return nil
+}
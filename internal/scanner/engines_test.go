@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestAggregateVerdicts(t *testing.T) {
+	clean := &EngineVerdict{Status: drivers.StatusClean}
+	infected := &EngineVerdict{Status: drivers.StatusInfected, Signature: "Test.Sig"}
+	failed := &EngineVerdict{Status: drivers.StatusError}
+
+	tests := []struct {
+		mode     config.EngineAggregation
+		verdicts []*EngineVerdict
+		expected drivers.ScanStatus // empty when an error is expected
+	}{
+		{config.AggregateAnyInfected, []*EngineVerdict{clean, infected}, drivers.StatusInfected},
+		{config.AggregateAnyInfected, []*EngineVerdict{clean, failed}, drivers.StatusClean},
+		{config.AggregateAnyInfected, []*EngineVerdict{failed, failed}, ""},
+		{config.AggregateAllClean, []*EngineVerdict{clean, clean}, drivers.StatusClean},
+		{config.AggregateAllClean, []*EngineVerdict{clean, failed}, ""},
+		{config.AggregateAllClean, []*EngineVerdict{infected, failed}, drivers.StatusInfected},
+		{config.AggregateMajority, []*EngineVerdict{clean, infected}, drivers.StatusClean},
+		{config.AggregateMajority, []*EngineVerdict{infected, infected, clean}, drivers.StatusInfected},
+		{config.AggregateMajority, []*EngineVerdict{infected, failed, clean, failed}, drivers.StatusClean},
+		{config.AggregateMajority, []*EngineVerdict{infected, failed}, drivers.StatusInfected},
+	}
+
+	for i, tt := range tests {
+		status, signature, err := aggregateVerdicts(tt.mode, tt.verdicts)
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("case %d (%s): expected an error, got %s", i, tt.mode, status)
+			}
+			continue
+		}
+		if err != nil || status != tt.expected {
+			t.Errorf("case %d (%s): expected %s, got %s (%v)", i, tt.mode, tt.expected, status, err)
+		}
+		if status == drivers.StatusInfected && signature != "Test.Sig" {
+			t.Errorf("case %d (%s): expected the detecting engine's signature, got %q", i, tt.mode, signature)
+		}
+	}
+}
+
+func TestScanner_MultiEngine(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	// A second engine that detects like the mock, and a third that cannot scan
+	s.drivers[config.EngineClamAV] = drivers.NewMockDriver(config.DriverConfig{Engine: config.EngineClamAV})
+	s.drivers[config.EngineTrendMicro] = drivers.NewTrendMicroDriver(config.DriverConfig{Engine: config.EngineTrendMicro}, s.logger, nil)
+	for _, engine := range []config.EngineType{config.EngineClamAV, config.EngineTrendMicro} {
+		s.engineCaches[engine] = cache.NewDetectionCache(cache.DefaultTTL)
+		s.engines = append(s.engines, engine)
+	}
+
+	scan := func(name, content string) (*ScanResponse, error) {
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		return s.Scan(filePath, "test-id-"+name, name, int64(len(content)))
+	}
+
+	result, err := scan("eicar.com", drivers.EICARPattern())
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if result.Status != drivers.StatusInfected || len(result.Engines) != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if v := result.Engines[1]; v.Engine != config.EngineClamAV || v.Status != drivers.StatusInfected {
+		t.Errorf("unexpected second verdict: %+v", v)
+	}
+	if v := result.Engines[2]; v.Engine != config.EngineTrendMicro || v.Status != drivers.StatusError || v.Error == "" {
+		t.Errorf("expected the third engine to fail: %+v", v)
+	}
+
+	// A scan may name the engines it runs with besides the active one
+	filePath := filepath.Join(tmpDir, "selected.com")
+	if err := os.WriteFile(filePath, []byte(drivers.EICARPattern()), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	result, err = s.ScanWithOptions(filePath, "test-id-selected", "selected.com", int64(len(drivers.EICARPattern())), ScanOptions{
+		Engines: []config.EngineType{config.EngineClamAV},
+	})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(result.Engines) != 2 || result.Engines[1].Engine != config.EngineClamAV {
+		t.Errorf("expected the active engine and clamav, got %+v", result.Engines)
+	}
+
+	// Every engine must scan clean, so the failed engine fails the scan
+	s.config.EngineAggregation = config.AggregateAllClean
+	if _, err := scan("clean.txt", "hello"); err == nil {
+		t.Error("expected all-clean to fail when an engine errors")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "clean.txt")); !os.IsNotExist(err) {
+		t.Error("expected upload to be removed")
+	}
+}
+
+func TestScanner_SetActiveEngine(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	if err := s.SetActiveEngine("bogus"); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("expected ErrUnknownEngine, got %v", err)
+	}
+	if err := s.SetActiveEngine(config.EngineClamAV); err != nil {
+		t.Fatalf("SetActiveEngine failed: %v", err)
+	}
+	if s.ActiveEngine() != config.EngineClamAV || len(s.Engines()) != 1 {
+		t.Errorf("expected clamav alone to be active, got %v", s.Engines())
+	}
+	if infos := s.GetEngineInfo(); len(infos) != 1 || infos[0].Engine != config.EngineClamAV {
+		t.Errorf("unexpected engine info: %+v", infos)
+	}
+
+	// Several engines scan every upload, so none can be swapped out
+	s.engines = append(s.engines, config.EngineMock)
+	s.drivers[config.EngineMock] = drivers.NewMockDriver(config.DriverConfig{Engine: config.EngineMock})
+	s.engineCaches[config.EngineMock] = cache.NewDetectionCache(cache.DefaultTTL)
+	if err := s.SetActiveEngine(config.EngineTrendMicro); !errors.Is(err, ErrEngineSwitchRefused) {
+		t.Errorf("expected ErrEngineSwitchRefused, got %v", err)
+	}
+}
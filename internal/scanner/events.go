@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"time"
+)
+
+// ScanEvent is published for every scanned upload. Members of a container
+// are reported in the upload's result, not as events of their own.
+type ScanEvent struct {
+	Type      string        `json:"type"` // always "scan.completed"
+	Timestamp time.Time     `json:"timestamp"`
+	FileName  string        `json:"fileName"`
+	Size      int64         `json:"size"`
+	Caller    string        `json:"caller,omitempty"`
+	Result    *ScanResponse `json:"result"`
+
+	// The request that asked for the scan, also sent as message headers
+	RequestID   string `json:"requestId,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+// PublishResult publishes a verdict reached without scanning, such as a
+// blocklist hit or a verdict reused from the API's cache. Dry runs are not
+// published.
+func (s *Scanner) PublishResult(response *ScanResponse, originalName string, size int64, opts ScanOptions) {
+	if opts.DryRun {
+		return
+	}
+	s.publishScan(response, originalName, size, opts)
+}
+
+// publishScan queues the result of a top-level scan for EVENTS_TRANSPORT
+func (s *Scanner) publishScan(response *ScanResponse, originalName string, size int64, opts ScanOptions) {
+	if s.events == nil || opts.depth > 0 {
+		return
+	}
+	s.events.Publish(response.FileID, opts.Trace.Fields(), &ScanEvent{
+		Type:        "scan.completed",
+		Timestamp:   time.Now().UTC(),
+		FileName:    originalName,
+		Size:        size,
+		Caller:      opts.Caller,
+		Result:      response,
+		RequestID:   opts.Trace.RequestID,
+		TraceParent: opts.Trace.TraceParent,
+	})
+}
@@ -0,0 +1,235 @@
+package scanner
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultJobTTL is how long finished jobs stay pollable when AsyncJobTTL is unset
+const defaultJobTTL = time.Hour
+
+var (
+	// ErrAsyncDisabled is returned by SubmitJob when no async workers are configured
+	ErrAsyncDisabled = errors.New("async scans are disabled")
+	// ErrJobQueueFull is returned by SubmitJob when the job queue is at capacity
+	ErrJobQueueFull = errors.New("async scan queue is full")
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a scan running in the background. The job ID is the file ID.
+type Job struct {
+	ID          string        `json:"jobId"`
+	Status      JobStatus     `json:"status"`
+	FileName    string        `json:"fileName"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	StartedAt   *time.Time    `json:"startedAt,omitempty"`
+	CompletedAt *time.Time    `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time    `json:"expiresAt,omitempty"` // when a finished job is forgotten
+	Result      *ScanResponse `json:"-"`
+	Error       error         `json:"-"`
+
+	SHA256             string `json:"-"`
+	DefinitionsVersion string `json:"-"` // signatures the verdict was reached with
+	Caller             string `json:"-"` // who submitted the job; only they and admins may read it
+}
+
+// JobRequest describes an upload to scan in the background. Done, if set,
+// runs on the worker once the scan returns and before the job is marked
+// finished, so callers can amend the result. A request with Result already
+// has its verdict, e.g. from the API's blocklist, and completes without
+// being queued.
+type JobRequest struct {
+	FilePath     string
+	Data         []byte // upload held in memory, scanned with ScanInMemory instead of FilePath
+	FileID       string
+	OriginalName string
+	Size         int64
+	SHA256       string // content hash, identifies the verdict with DefinitionsVersion
+	Caller       string
+	Options      ScanOptions
+	Result       *ScanResponse
+	Done         func(*ScanResponse, error)
+}
+
+// jobQueue runs submitted scans on a fixed pool of workers and keeps
+// finished jobs until they expire
+type jobQueue struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	ttl  time.Duration
+
+	work chan JobRequest
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (s *Scanner) startJobWorkers() {
+	ttl := time.Duration(s.config.AsyncJobTTL) * time.Millisecond
+	if ttl <= 0 {
+		ttl = defaultJobTTL
+	}
+	s.jobs = &jobQueue{
+		jobs: make(map[string]*Job),
+		ttl:  ttl,
+		work: make(chan JobRequest, max(s.config.AsyncQueueSize, 0)),
+		stop: make(chan struct{}),
+	}
+	for i := 0; i < s.config.AsyncWorkers; i++ {
+		s.jobs.wg.Add(1)
+		go s.runJobs()
+	}
+}
+
+func (s *Scanner) stopJobWorkers() {
+	if s.jobs == nil {
+		return
+	}
+	close(s.jobs.stop)
+	s.jobs.wg.Wait()
+
+	// Queued uploads will never be scanned
+	for {
+		select {
+		case req := <-s.jobs.work:
+			s.deleteFile(req.FilePath, req.FileID)
+			s.jobs.finish(req.FileID, nil, errors.New("scanner stopped"), "")
+		default:
+			return
+		}
+	}
+}
+
+func (s *Scanner) runJobs() {
+	defer s.jobs.wg.Done()
+	for {
+		select {
+		case <-s.jobs.stop:
+			return
+		case req := <-s.jobs.work:
+			s.jobs.start(req.FileID)
+			var result *ScanResponse
+			var err error
+			if req.Data != nil {
+				result, err = s.ScanInMemory(req.Data, req.FileID, req.OriginalName, req.Options)
+			} else {
+				result, err = s.ScanWithOptions(req.FilePath, req.FileID, req.OriginalName, req.Size, req.Options)
+			}
+			if req.Done != nil {
+				req.Done(result, err)
+			}
+			s.jobs.finish(req.FileID, result, err, s.DefinitionsVersion())
+		}
+	}
+}
+
+// SubmitJob queues an upload for scanning and returns immediately. The file
+// is removed after the scan, as with ScanWithOptions, or right away if the
+// job is rejected.
+func (s *Scanner) SubmitJob(req JobRequest) (*Job, error) {
+	if s.config.AsyncWorkers <= 0 {
+		s.deleteFile(req.FilePath, req.FileID)
+		return nil, ErrAsyncDisabled
+	}
+
+	job := &Job{
+		ID:        req.FileID,
+		Status:    JobQueued,
+		FileName:  req.OriginalName,
+		CreatedAt: time.Now(),
+		SHA256:    req.SHA256,
+		Caller:    req.Caller,
+	}
+	// Workers update the job once it is queued
+	snapshot := *job
+
+	q := s.jobs
+	q.mu.Lock()
+	q.expire(job.CreatedAt)
+	q.jobs[job.ID] = job
+	q.mu.Unlock()
+
+	if req.Result != nil {
+		s.deleteFile(req.FilePath, req.FileID)
+		s.PublishResult(req.Result, req.OriginalName, req.Size, req.Options)
+		if req.Done != nil {
+			req.Done(req.Result, nil)
+		}
+		q.finish(job.ID, req.Result, nil, s.DefinitionsVersion())
+		finished, _ := s.GetJob(job.ID)
+		return finished, nil
+	}
+
+	select {
+	case q.work <- req:
+	default:
+		q.mu.Lock()
+		delete(q.jobs, job.ID)
+		q.mu.Unlock()
+		s.deleteFile(req.FilePath, req.FileID)
+		return nil, ErrJobQueueFull
+	}
+	return &snapshot, nil
+}
+
+// GetJob returns a snapshot of a job, or false if it is unknown or expired
+func (s *Scanner) GetJob(id string) (*Job, bool) {
+	if s.jobs == nil {
+		return nil, false
+	}
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	job, ok := s.jobs.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *job
+	return &copied, true
+}
+
+func (q *jobQueue) start(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		now := time.Now()
+		job.Status = JobRunning
+		job.StartedAt = &now
+	}
+}
+
+func (q *jobQueue) finish(id string, result *ScanResponse, err error, definitionsVersion string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	expiresAt := now.Add(q.ttl)
+	job.CompletedAt = &now
+	job.ExpiresAt = &expiresAt
+	job.DefinitionsVersion = definitionsVersion
+	job.Result = result
+	job.Error = err
+	job.Status = JobCompleted
+	if err != nil {
+		job.Status = JobFailed
+	}
+}
+
+// expire drops finished jobs older than the TTL; callers hold q.mu
+func (q *jobQueue) expire(now time.Time) {
+	for id, job := range q.jobs {
+		if job.ExpiresAt != nil && now.After(*job.ExpiresAt) {
+			delete(q.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func newJobScanner(t *testing.T, workers, queueSize int) *Scanner {
+	t.Helper()
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+		AsyncWorkers:    workers,
+		AsyncQueueSize:  queueSize,
+	}
+	return New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func waitForJob(t *testing.T, s *Scanner, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := s.GetJob(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.Status == JobCompleted || job.Status == JobFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestScanner_SubmitJob(t *testing.T) {
+	s := newJobScanner(t, 1, 10)
+	defer s.Stop()
+
+	filePath := filepath.Join(s.config.UploadDir, "eicar.com")
+	os.WriteFile(filePath, []byte(drivers.EICARPattern()), 0644)
+
+	var done bool
+	job, err := s.SubmitJob(JobRequest{
+		FilePath:     filePath,
+		FileID:       "job-1",
+		OriginalName: "eicar.com",
+		Size:         int64(len(drivers.EICARPattern())),
+		Done:         func(*ScanResponse, error) { done = true },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.ID != "job-1" || job.Status != JobQueued {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	job = waitForJob(t, s, "job-1")
+	if job.Status != JobCompleted || job.Result.Status != drivers.StatusInfected {
+		t.Errorf("unexpected finished job: %+v", job)
+	}
+	if !done {
+		t.Error("expected Done to run before the job finished")
+	}
+	if job.StartedAt == nil || job.CompletedAt == nil {
+		t.Error("expected start and completion times")
+	}
+}
+
+func TestScanner_SubmitJob_Rejected(t *testing.T) {
+	s := newJobScanner(t, 0, 0)
+	defer s.Stop()
+
+	filePath := filepath.Join(s.config.UploadDir, "clean.txt")
+	os.WriteFile(filePath, []byte("hello"), 0644)
+	if _, err := s.SubmitJob(JobRequest{FilePath: filePath, FileID: "job-1"}); !errors.Is(err, ErrAsyncDisabled) {
+		t.Errorf("expected ErrAsyncDisabled, got %v", err)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Error("expected rejected upload to be removed")
+	}
+	if _, ok := s.GetJob("job-1"); ok {
+		t.Error("expected no job for a rejected upload")
+	}
+}
+
+func TestJobQueue_Expire(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	q := &jobQueue{ttl: time.Hour, jobs: map[string]*Job{
+		"old":     {ID: "old", Status: JobCompleted, ExpiresAt: &expired},
+		"running": {ID: "running", Status: JobRunning},
+	}}
+	q.expire(time.Now())
+	if _, ok := q.jobs["old"]; ok {
+		t.Error("expected finished job past its TTL to expire")
+	}
+	if _, ok := q.jobs["running"]; !ok {
+		t.Error("expected running job to be kept")
+	}
+}
@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/extract"
+	"github.com/rophy/av-scanner/internal/inspect"
+	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/policy"
+)
+
+// Memory scans (MEMORY_SCAN_MAX_SIZE) stream small uploads to the engine
+// without writing them to the upload directory, saving the disk round trip
+// and keeping the content off storage. The engine's on-access scanner never
+// sees them, so the verdict is the manual scan's alone.
+
+// ErrMemoryScanUnsupported is returned by ScanInMemory when the active
+// engine cannot scan streamed content
+var ErrMemoryScanUnsupported = errors.New("active engine cannot scan from memory")
+
+// CanScanInMemory reports whether an upload of size bytes can be scanned with
+// ScanInMemory: it is within MEMORY_SCAN_MAX_SIZE, the active engine can scan
+// streamed content, and no part of the scan needs a file. Email extraction,
+// text payloads, encrypted archive checks, AV_ENGINES extras and shadow scans
+// all work on files, so uploads they apply to are written to disk as usual.
+func (s *Scanner) CanScanInMemory(size int64, originalName string, opts ScanOptions) bool {
+	if s.config.MemoryScanMaxSize == 0 || size > s.config.MemoryScanMaxSize {
+		return false
+	}
+	driver, _ := s.activeDriver()
+	if _, ok := driver.(drivers.StreamScanner); !ok {
+		return false
+	}
+	archives := s.config.EncryptedArchives
+	return !extract.IsEmail(originalName, opts.MimeType) &&
+		!s.config.PayloadCheck &&
+		(archives == "" || archives == config.EncryptedAllow) &&
+		len(s.otherEngines(opts.Engines)) == 0 &&
+		s.config.ShadowEngine == ""
+}
+
+// ScanInMemory scans an upload held in memory, for uploads CanScanInMemory
+// accepts. A panic during the scan is recovered and returned as ErrPanic.
+func (s *Scanner) ScanInMemory(data []byte, fileID, originalName string, opts ScanOptions) (response *ScanResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			response, err = nil, s.recovered("scan", r, "fileId", fileID, "originalName", originalName)
+		}
+	}()
+	return s.scanInMemory(data, fileID, originalName, opts)
+}
+
+func (s *Scanner) scanInMemory(data []byte, fileID, originalName string, opts ScanOptions) (*ScanResponse, error) {
+	startTime := time.Now()
+	driver, _ := s.activeDriver()
+	streamer, ok := driver.(drivers.StreamScanner)
+	if !ok {
+		return nil, ErrMemoryScanUnsupported
+	}
+	size := int64(len(data))
+
+	s.capacity.inFlight.Add(1)
+	defer s.capacity.inFlight.Add(-1)
+
+	s.logger.Info("Starting scan",
+		"fileId", fileID,
+		"engine", driver.Engine(),
+		"originalName", originalName,
+		"size", size,
+		"inMemory", true,
+	)
+
+	fileType := inspect.DetectTypeBytes(data)
+	decision, matchedPolicy, response := s.applyPolicy("", fileID, originalName, size, fileType, driver, opts, startTime)
+	if response != nil {
+		return response, nil
+	}
+
+	release, err := s.admitScan(fileID, size)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	findings, entropy := s.inspectContent("", data, fileID, decision)
+
+	scanStart := time.Now()
+	result, err := streamer.StreamScan(bytes.NewReader(data), fileID, engineOptions(driver.Config(), opts.Profile, decision.Action == policy.ActionDeep))
+	timings := &Timings{ManualScanMs: time.Since(scanStart).Milliseconds()}
+	if err == nil && result.Usage != nil {
+		cpu := time.Duration(result.Usage.UserTime+result.Usage.SystemTime) * time.Millisecond
+		metrics.RecordEngineUsage(string(driver.Engine()), metrics.FileType(originalName), cpu, result.Usage.MaxRSS)
+	}
+	if err != nil || (result.Status != drivers.StatusClean && result.Status != drivers.StatusInfected) {
+		s.recordEngineFailure(driver.Engine())
+		return nil, s.engineError(driver.Engine(), failureCategory(result, err), fileID)
+	}
+
+	if result.Status == drivers.StatusInfected {
+		s.quarantineFile("", data, fileID, originalName, size, driver.Engine(), result.Signature, opts.Caller, startTime)
+	}
+
+	response = &ScanResponse{
+		FileID:     fileID,
+		Status:     result.Status,
+		Engine:     driver.Engine(),
+		Signature:  result.Signature,
+		ScanResult: result,
+		Policy:     matchedPolicy,
+		Findings:   findings,
+		Entropy:    entropy,
+		FileType:   detectedFileType(fileType),
+		Profile:    opts.Profile,
+		Timings:    timings,
+	}
+	// Structural findings downgrade a clean verdict to suspicious
+	if len(findings) > 0 && response.Status == drivers.StatusClean {
+		response.Status = drivers.StatusSuspicious
+	}
+	s.completeScan(response, originalName, size, opts, startTime, true)
+	return response, nil
+}
@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/quarantine"
+)
+
+func TestScanner_CanScanInMemory(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	if s.CanScanInMemory(10, "a.txt", ScanOptions{}) {
+		t.Error("expected memory scans to be disabled by default")
+	}
+	s.config.MemoryScanMaxSize = 100
+	if !s.CanScanInMemory(100, "a.txt", ScanOptions{}) {
+		t.Error("expected an upload at the limit to be scanned in memory")
+	}
+	if s.CanScanInMemory(101, "a.txt", ScanOptions{}) {
+		t.Error("expected an upload over the limit to need a file")
+	}
+	if s.CanScanInMemory(10, "message.eml", ScanOptions{}) {
+		t.Error("expected an email to need a file for extraction")
+	}
+	s.config.EncryptedArchives = config.EncryptedReject
+	if s.CanScanInMemory(10, "a.txt", ScanOptions{}) {
+		t.Error("expected encrypted archive checks to need a file")
+	}
+}
+
+func TestScanner_ScanInMemory(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.MemoryScanMaxSize = 1024
+	keyFile := filepath.Join(t.TempDir(), "quarantine.key")
+	os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))), 0600)
+	store, err := quarantine.Open(t.TempDir(), keyFile)
+	if err != nil {
+		t.Fatalf("quarantine.Open failed: %v", err)
+	}
+	s.SetQuarantine(store)
+
+	result, err := s.ScanInMemory([]byte("hello"), "mem-1", "clean.txt", ScanOptions{})
+	if err != nil || result.Status != drivers.StatusClean {
+		t.Fatalf("expected a clean result, got %+v (%v)", result, err)
+	}
+
+	result, err = s.ScanInMemory([]byte(drivers.EICARPattern()), "mem-2", "eicar.com", ScanOptions{Caller: "test"})
+	if err != nil || result.Status != drivers.StatusInfected || result.Signature != drivers.EICARSignature {
+		t.Fatalf("expected an infected result, got %+v (%v)", result, err)
+	}
+	entries, _ := store.List()
+	if len(entries) != 1 || !entries[0].HasContent || entries[0].FileID != "mem-2" {
+		t.Errorf("expected the infected content in quarantine, got %+v", entries)
+	}
+
+	files, _ := os.ReadDir(tmpDir)
+	if len(files) != 0 {
+		t.Errorf("expected nothing written to the upload directory, got %d entries", len(files))
+	}
+}
+
+func TestScanner_ScanInMemoryMatchesDisk(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.MemoryScanMaxSize = 1024
+	s.config.EntropyCheck = true
+
+	// Binary content no signature identifies
+	data := []byte{0x00, 0x9c, 0x01, 0xfe, 0x7f, 0x00, 0x42, 0xff}
+	for _, opts := range []ScanOptions{{}, {DryRun: true}} {
+		fromMemory, err := s.ScanInMemory(data, "mem-1", "blob", opts)
+		if err != nil {
+			t.Fatalf("memory scan failed: %v", err)
+		}
+		filePath := filepath.Join(tmpDir, "blob")
+		os.WriteFile(filePath, data, 0644)
+		fromDisk, err := s.ScanWithOptions(filePath, "disk-1", "blob", int64(len(data)), opts)
+		if err != nil {
+			t.Fatalf("disk scan failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(fromMemory.FileType, fromDisk.FileType) {
+			t.Errorf("dry run %v: expected the same file type, got %+v from memory and %+v from disk", opts.DryRun, fromMemory.FileType, fromDisk.FileType)
+		}
+		if fromMemory.Status != fromDisk.Status || !reflect.DeepEqual(fromMemory.Findings, fromDisk.Findings) || !reflect.DeepEqual(fromMemory.Entropy, fromDisk.Entropy) {
+			t.Errorf("dry run %v: memory and disk responses differ: %+v and %+v", opts.DryRun, fromMemory, fromDisk)
+		}
+	}
+}
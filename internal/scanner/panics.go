@@ -0,0 +1,25 @@
+package scanner
+
+import (
+	"errors"
+	"runtime/debug"
+
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// ErrPanic is returned for a scan that panicked, e.g. on a driver or parser
+// bug triggered by one file. The panic is logged with its stack and the
+// process keeps serving other scans.
+var ErrPanic = errors.New("internal error during scan")
+
+// recovered logs and counts a panic recovered in component and returns
+// ErrPanic; the panic value is only logged, not returned to callers. It must
+// be called from the deferred function that recovered, so the stack still
+// shows where the panic happened.
+func (s *Scanner) recovered(component string, value any, args ...any) error {
+	metrics.RecordPanic(component)
+	s.logger.Error("Recovered from panic",
+		append([]any{"component", component, "panic", value, "stack", string(debug.Stack())}, args...)...,
+	)
+	return ErrPanic
+}
@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/extract"
+	"github.com/rophy/av-scanner/internal/fetch"
+)
+
+// Payload checks (PAYLOAD_CHECK) treat a text upload as a container of the
+// base64 blobs it carries and, with PAYLOAD_FETCH, of the files its URLs
+// point to. Each is scanned as a member, so a text file that smuggles or
+// links to malware is reported infected, down to MAX_NESTING_DEPTH.
+
+// textPayloads returns the payloads of a text upload to scan as members,
+// and whether any were found. Blobs in emails are skipped because their
+// attachments are already extracted. At the maximum nesting depth nothing
+// is downloaded or returned.
+func (s *Scanner) textPayloads(filePath, fileID string, email, atMaxDepth bool) ([]extract.Attachment, bool) {
+	payloads, err := extract.TextPayloads(filePath)
+	if errors.Is(err, extract.ErrNotContainer) {
+		return nil, false
+	}
+	if err != nil {
+		s.logger.Warn("Failed to extract text payloads", "fileId", fileID, "error", err)
+		return nil, false
+	}
+
+	var members []extract.Attachment
+	if !email {
+		members = payloads.Blobs
+	}
+	var urls []*url.URL
+	if s.config.PayloadFetch {
+		urls = s.fetchableURLs(fileID, payloads.URLs)
+	}
+	if len(members)+len(urls) == 0 {
+		return nil, false
+	}
+	if atMaxDepth {
+		return nil, true
+	}
+	return append(members, s.fetchPayloads(fileID, urls)...), true
+}
+
+// urlPolicy is the set of URLs payload checks may download
+func (s *Scanner) urlPolicy() fetch.Policy {
+	return fetch.Policy{AllowedHosts: s.config.ScanURLAllowedHosts, Schemes: s.config.ScanURLSchemes}
+}
+
+// fetchableURLs returns the URLs the policy allows downloading
+func (s *Scanner) fetchableURLs(fileID string, urls []string) []*url.URL {
+	var allowed []*url.URL
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		if err := s.urlPolicy().Check(u); err != nil {
+			s.logger.Debug("Payload URL not fetched", "fileId", fileID, "url", u.Redacted(), "reason", err)
+			continue
+		}
+		allowed = append(allowed, u)
+	}
+	return allowed
+}
+
+// fetchPayloads downloads payload URLs. Failed downloads are logged and
+// skipped.
+func (s *Scanner) fetchPayloads(fileID string, urls []*url.URL) []extract.Attachment {
+	client := s.urlPolicy().Client(time.Duration(s.config.ScanURLTimeout) * time.Millisecond)
+	maxSize := s.config.ScanURLMaxSize
+	if maxSize == 0 {
+		maxSize = s.config.MaxFileSize
+	}
+
+	var fetched []extract.Attachment
+	for _, u := range urls {
+		data, contentType, err := download(client, u, maxSize)
+		if err != nil {
+			s.logger.Warn("Payload URL download failed", "fileId", fileID, "url", u.Redacted(), "error", err)
+			continue
+		}
+		fetched = append(fetched, extract.Attachment{Name: u.String(), ContentType: contentType, Data: data})
+	}
+	return fetched
+}
+
+func download(client *http.Client, u *url.URL, maxSize int64) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, "", errors.New("file too large")
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
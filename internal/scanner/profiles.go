@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// Scan profiles (SCAN_PROFILES) let callers trade thoroughness for latency
+// per request. fast skips container extraction, thorough reports every match
+// and unpacks deeper, and each adds its engine flags (CLAMAV_FAST_FLAGS,
+// TM_THOROUGH_FLAGS, ...). The size cap of fast is applied by the front end,
+// which sees the upload first.
+
+// nestingDepth is the container nesting level unpacked under a profile
+func (s *Scanner) nestingDepth(profile config.ScanProfile) int {
+	switch profile {
+	case config.ProfileFast:
+		return 0
+	case config.ProfileThorough:
+		return s.config.ScanProfileThoroughDepth
+	}
+	return s.config.MaxNestingDepth
+}
+
+// extracts reports whether containers are unpacked under a profile; fast
+// scans a container as the engine sees it, without flagging it for depth
+func extracts(profile config.ScanProfile) bool {
+	return profile != config.ProfileFast
+}
+
+// engineOptions are the driver options for a scan under a profile. deep is
+// set by a policy deep action; thorough implies it.
+func engineOptions(driverCfg config.DriverConfig, profile config.ScanProfile, deep bool) drivers.ScanOptions {
+	opts := drivers.ScanOptions{Deep: deep || profile == config.ProfileThorough}
+	switch profile {
+	case config.ProfileFast:
+		opts.Flags = driverCfg.FastFlags
+	case config.ProfileThorough:
+		opts.Flags = driverCfg.ThoroughFlags
+	}
+	return opts
+}
@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/quarantine"
+)
+
+// quarantineFile keeps an infected upload in the quarantine store before it
+// is deleted. When RTS already removed the file, only its metadata is kept.
+// Uploads scanned in memory pass their content instead of a path.
+// Failures are logged; the scan result stands either way.
+func (s *Scanner) quarantineFile(filePath string, content []byte, fileID, originalName string, size int64, engine config.EngineType, signature, caller string, scannedAt time.Time) {
+	if s.quarantine == nil {
+		return
+	}
+	metadata := quarantine.Entry{
+		FileID:    fileID,
+		FileName:  originalName,
+		Size:      size,
+		Engine:    string(engine),
+		Signature: signature,
+		Caller:    caller,
+		ScannedAt: scannedAt.UTC(),
+	}
+	var entry *quarantine.Entry
+	var err error
+	if content != nil {
+		entry, err = s.quarantine.AddData(content, metadata)
+	} else {
+		entry, err = s.quarantine.Add(filePath, metadata)
+	}
+	if err != nil {
+		s.logger.Error("Failed to quarantine file", "fileId", fileID, "error", err)
+		return
+	}
+	s.logger.Warn("File quarantined",
+		"fileId", fileID,
+		"quarantineId", entry.ID,
+		"signature", signature,
+		"hasContent", entry.HasContent,
+	)
+}
@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// rtsPollInterval is how often the RTS cache is checked for a verdict
+const rtsPollInterval = 20 * time.Millisecond
+
+// RTSWaitError is returned when the watchdog fails a scan stuck waiting for
+// an RTS verdict beyond RTS_WAIT_CEILING. It unwraps to the scan's
+// EngineError, with category timeout.
+type RTSWaitError struct {
+	EngineError
+	Waited         time.Duration
+	CacheSize      int   // detections in the engine's RTS cache; -1 if the cache was locked
+	WatcherRunning *bool // whether the RTS log watcher runs; nil if the driver does not tell
+}
+
+func (e *RTSWaitError) Error() string {
+	return fmt.Sprintf("scan failed: %s engine gave no RTS verdict within %s (%s)", e.Engine, e.Waited.Round(time.Millisecond), e.Category)
+}
+
+func (e *RTSWaitError) Unwrap() error {
+	return &e.EngineError
+}
+
+// waitForRTS polls the detection cache for an RTS detection of absPath for
+// up to maxWait, returning nil if there is none. The wait runs under a
+// watchdog: past RTS_WAIT_CEILING, however large maxWait or whatever holds
+// the poll up, the scan is failed with an *RTSWaitError.
+func (s *Scanner) waitForRTS(driver drivers.Driver, detectionCache *cache.DetectionCache, absPath, fileID string, maxWait time.Duration) (*cache.Detection, time.Duration, error) {
+	type outcome struct {
+		detection *cache.Detection
+		waited    time.Duration
+	}
+	done := make(chan outcome, 1)
+	var abandoned atomic.Bool
+	go func() {
+		waited := time.Duration(0)
+		for waited < maxWait && !abandoned.Load() {
+			if cached, found := detectionCache.Get(absPath); found && cached.Status == "infected" {
+				done <- outcome{cached, waited}
+				return
+			}
+			time.Sleep(rtsPollInterval)
+			waited += rtsPollInterval
+		}
+		done <- outcome{nil, waited}
+	}()
+
+	if s.config.RTSWaitCeiling <= 0 {
+		o := <-done
+		return o.detection, o.waited, nil
+	}
+	ceiling := time.Duration(s.config.RTSWaitCeiling) * time.Millisecond
+	watchdog := time.NewTimer(ceiling)
+	defer watchdog.Stop()
+	select {
+	case o := <-done:
+		return o.detection, o.waited, nil
+	case <-watchdog.C:
+		abandoned.Store(true)
+		return nil, ceiling, s.rtsWaitStuck(driver, detectionCache, fileID, ceiling, maxWait)
+	}
+}
+
+// rtsWaitStuck reports a scan the watchdog gave up on, with what it could
+// find out about the RTS machinery without waiting on it
+func (s *Scanner) rtsWaitStuck(driver drivers.Driver, detectionCache *cache.DetectionCache, fileID string, waited, maxWait time.Duration) *RTSWaitError {
+	err := &RTSWaitError{Waited: waited, CacheSize: -1}
+	if n, ok := detectionCache.Size(); ok {
+		err.CacheSize = n
+	}
+	watcher := "unknown"
+	if reporter, ok := driver.(drivers.WatcherReporter); ok {
+		running := reporter.RTSWatcherRunning()
+		err.WatcherRunning = &running
+		watcher = strconv.FormatBool(running)
+	}
+
+	metrics.RecordRTSWaitStuck(string(driver.Engine()))
+	s.logger.Error("Scan stuck waiting for RTS verdict, failing it",
+		"fileId", fileID,
+		"engine", driver.Engine(),
+		"waitedMs", waited.Milliseconds(),
+		"maxWaitMs", maxWait.Milliseconds(),
+		"cacheSize", err.CacheSize,
+		"watcherRunning", watcher,
+	)
+	s.recordEngineFailure(driver.Engine())
+	err.EngineError = *s.engineError(driver.Engine(), drivers.ErrorTimeout, fileID)
+	return err
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// stuckRTSDriver fails every manual scan and would wait an hour for an RTS
+// verdict that its stopped log watcher never delivers
+type stuckRTSDriver struct {
+	drivers.Driver
+}
+
+func (d stuckRTSDriver) Config() config.DriverConfig {
+	cfg := d.Driver.Config()
+	cfg.RTSCacheBaseDelay = int(time.Hour / time.Millisecond)
+	return cfg
+}
+
+func (stuckRTSDriver) ManualScan(string, drivers.ScanOptions) (*drivers.ScanResult, error) {
+	return &drivers.ScanResult{Status: drivers.StatusError}, nil
+}
+
+func (stuckRTSDriver) RTSWatcherRunning() bool {
+	return false
+}
+
+func TestScanner_RTSWaitWatchdog(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.RTSWaitCeiling = 50
+	s.drivers[config.EngineMock] = stuckRTSDriver{s.drivers[config.EngineMock]}
+
+	filePath := filepath.Join(tmpDir, "clean.txt")
+	if err := os.WriteFile(filePath, []byte("This is a clean file"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	start := time.Now()
+	_, err := s.Scan(filePath, "test-id-1", "clean.txt", 21)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the watchdog to end the wait, took %v", elapsed)
+	}
+
+	var stuck *RTSWaitError
+	if !errors.As(err, &stuck) {
+		t.Fatalf("expected RTSWaitError, got %v", err)
+	}
+	if stuck.Waited != 50*time.Millisecond || stuck.CacheSize != 0 || stuck.WatcherRunning == nil || *stuck.WatcherRunning {
+		t.Errorf("unexpected diagnostics: %+v", stuck)
+	}
+	var engineErr *EngineError
+	if !errors.As(err, &engineErr) || engineErr.Category != drivers.ErrorTimeout {
+		t.Errorf("expected a timeout engine error, got %v", err)
+	}
+}
+
+// quarantiningDriver has RTS remove every file it is asked to scan, reporting
+// the detection after a delay
+type quarantiningDriver struct {
+	drivers.Driver
+	detections *cache.DetectionCache
+}
+
+func (d quarantiningDriver) Config() config.DriverConfig {
+	cfg := d.Driver.Config()
+	cfg.RTSCacheBaseDelay = 5000
+	return cfg
+}
+
+func (d quarantiningDriver) ManualScan(filePath string, _ drivers.ScanOptions) (*drivers.ScanResult, error) {
+	absPath, _ := filepath.Abs(filePath)
+	os.Remove(filePath)
+	time.AfterFunc(100*time.Millisecond, func() {
+		d.detections.Add(absPath, &cache.Detection{Status: "infected", Signature: "Test.RTS"})
+	})
+	return nil, os.ErrNotExist
+}
+
+func TestScanner_Timings(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.drivers[config.EngineMock] = quarantiningDriver{s.drivers[config.EngineMock], s.detectionCache}
+
+	filePath := filepath.Join(tmpDir, "dropper.exe")
+	if err := os.WriteFile(filePath, []byte("dropper"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	resp, err := s.Scan(filePath, "test-id-1", "dropper.exe", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Status != drivers.StatusInfected || resp.Timings == nil {
+		t.Fatalf("expected an RTS detection with timings, got %+v", resp)
+	}
+	if timings := resp.Timings; timings.RTSWaitMs < 100 || timings.TotalMs < timings.RTSWaitMs+timings.ManualScanMs || timings.SaveMs != 0 {
+		t.Errorf("unexpected timings: %+v", timings)
+	}
+}
@@ -1,34 +1,166 @@
 package scanner
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rophy/av-scanner/internal/cache"
 	"github.com/rophy/av-scanner/internal/config"
 	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/events"
+	"github.com/rophy/av-scanner/internal/extract"
+	"github.com/rophy/av-scanner/internal/inspect"
 	"github.com/rophy/av-scanner/internal/metrics"
+	"github.com/rophy/av-scanner/internal/policy"
+	"github.com/rophy/av-scanner/internal/quarantine"
+	"github.com/rophy/av-scanner/internal/throttle"
+	"github.com/rophy/av-scanner/internal/tracing"
+	"github.com/rophy/av-scanner/internal/uploads"
+	"github.com/rophy/av-scanner/internal/volume"
 )
 
+// ThrottledError is returned when a scan is rejected by the throughput limit
+// or a full scan queue
+type ThrottledError struct {
+	RetryAfter time.Duration // time until the scan would be admitted
+	Reason     string        // defaults to the throughput limit
+}
+
+func (e *ThrottledError) Error() string {
+	reason := e.Reason
+	if reason == "" {
+		reason = "scan throughput limit exceeded"
+	}
+	return fmt.Sprintf("%s, retry after %s", reason, e.RetryAfter.Round(time.Second))
+}
+
+// EngineError is returned when the engine could not scan an upload; Category
+// says why, as far as the engine's output tells
+type EngineError struct {
+	Engine   config.EngineType
+	Category drivers.ErrorCategory
+}
+
+func (e *EngineError) Error() string {
+	if e.Category == drivers.ErrorFileMissing {
+		return "scan failed: file not accessible and no RTS detection found"
+	}
+	return fmt.Sprintf("scan failed: %s engine error (%s)", e.Engine, e.Category)
+}
+
 type ScanResponse struct {
 	FileID        string              `json:"fileId"`
 	Status        drivers.ScanStatus  `json:"status"`
 	Engine        config.EngineType   `json:"engine"`
 	Signature     string              `json:"signature,omitempty"`
 	ScanResult    *drivers.ScanResult `json:"scanResult,omitempty"`
+	Engines       []*EngineVerdict    `json:"engines,omitempty"` // per-engine verdicts with AV_ENGINES
+	Policy        *policy.Decision    `json:"policy,omitempty"`
+	Children      []*MemberResult     `json:"children,omitempty"`
+	Findings      []string            `json:"findings,omitempty"`
+	Entropy       *float64            `json:"entropy,omitempty"` // bits per byte
+	FileType      *inspect.FileType   `json:"fileType,omitempty"`
+	DryRun        *DryRunResult       `json:"dryRun,omitempty"`
+	Profile       config.ScanProfile  `json:"profile,omitempty"`
 	TotalDuration int64               `json:"totalDuration"`
+	Timings       *Timings            `json:"timings,omitempty"`
+	Cached        bool                `json:"cached,omitempty"` // reused from an earlier scan of the same content
+	Hashes        *Hashes             `json:"hashes,omitempty"`
+}
+
+// Timings breaks a scan's latency down by stage, in milliseconds, so callers
+// can tell whether it comes from the upload, the engine or the RTS fallback
+type Timings struct {
+	SaveMs       int64 `json:"saveMs"`       // receiving and storing the upload
+	ManualScanMs int64 `json:"manualScanMs"` // the engine's manual scan
+	RTSWaitMs    int64 `json:"rtsWaitMs"`    // waiting for an RTS verdict after the manual scan failed
+	TotalMs      int64 `json:"totalMs"`      // the upload and the whole scan
+}
+
+// Hashes are hex digests of the uploaded content, so callers can match
+// verdicts to their own inventory without hashing the file again
+type Hashes struct {
+	MD5    string `json:"md5"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+}
+
+// DryRunResult describes what a scan would have done without invoking the engine
+type DryRunResult struct {
+	Action        policy.Action `json:"action"`
+	EngineHealthy bool          `json:"engineHealthy"`
+	EngineError   string        `json:"engineError,omitempty"`
+	SHA256        string        `json:"sha256,omitempty"`
+}
+
+// MemberResult is the verdict for a file extracted from a container (e.g. an
+// email attachment). Nested containers report their own members in Children,
+// forming a tree rooted at the uploaded file.
+type MemberResult struct {
+	FileName  string             `json:"fileName"`
+	Status    drivers.ScanStatus `json:"status"`
+	Signature string             `json:"signature,omitempty"`
+	Findings  []string           `json:"findings,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Children  []*MemberResult    `json:"children,omitempty"`
+}
+
+// ScanOptions carries per-request inputs to the scan pipeline
+type ScanOptions struct {
+	MimeType string // client-declared MIME type, used for policy evaluation
+	DryRun   bool   // evaluate policy and engine health, but do not scan
+	// Engines limits which AV_ENGINES engines scan besides the active one;
+	// nil means all of them
+	Engines []config.EngineType
+	// Passwords are tried on encrypted archives under ENCRYPTED_ARCHIVES=decrypt
+	Passwords []string
+	Caller    string // uploader identity, recorded when the file is quarantined
+	// Profile trades thoroughness for latency; empty is standard
+	Profile config.ScanProfile
+	// Trace identifies the request that asked for the scan, passed on to
+	// the published scan event
+	Trace tracing.Context
+
+	depth int // container nesting level, 0 for the uploaded file
 }
 
 type Scanner struct {
+	engineMu       sync.RWMutex // guards the engine fields below, see SetActiveEngine
+	switchMu       sync.Mutex   // serializes SetActiveEngine
 	drivers        map[config.EngineType]drivers.Driver
 	activeEngine   config.EngineType
+	engines        []config.EngineType // active engine first, then AV_ENGINES extras
+	engineCaches   map[config.EngineType]*cache.DetectionCache
+	detectionCache *cache.DetectionCache // the active engine's
 	config         *config.Config
 	logger         *slog.Logger
-	detectionCache *cache.DetectionCache
+	policy         *policy.Policy
+	throughput     *throttle.Bucket // nil when unlimited
+	slots          *scanSlots       // nil when unlimited
+	uploads        uploads.Store
+	uploadVolume   *volume.Report
+	shadow         drivers.Driver // canary engine, nil when disabled
+	shadowCache    *cache.DetectionCache
+	quarantine     *quarantine.Store // nil when infected files are deleted
+	events         *events.Publisher // nil when results are not published
+	definitions    definitionsState
+	updates        updatesState
+	definitionSets definitionSetsState
+	capacity       capacityTracker
+	stability      stabilityTracker
+	jobs           *jobQueue
+	warmedUp       atomic.Bool // startup warm-up scan finished, see WarmUp
 }
 
 func New(cfg *config.Config, logger *slog.Logger) *Scanner {
@@ -41,50 +173,200 @@ func New(cfg *config.Config, logger *slog.Logger) *Scanner {
 		config:         cfg,
 		logger:         logger,
 		detectionCache: detectionCache,
+		uploads:        uploads.NewDisk(cfg.UploadDir),
+	}
+	s.warmedUp.Store(!cfg.WarmUpScan)
+
+	if cfg.ThroughputLimit > 0 {
+		burst := cfg.ThroughputBurst
+		if burst <= 0 {
+			burst = cfg.MaxFileSize
+		}
+		s.throughput = throttle.NewBucket(cfg.ThroughputLimit, burst)
+	}
+	s.slots = newScanSlots(cfg.MaxConcurrentScans, cfg.ScanQueueDepth)
+
+	// Initialize the active driver, plus any other engines every upload is
+	// scanned with. Each engine reports RTS detections into its own cache.
+	s.drivers[cfg.ActiveEngine] = newDriver(cfg, cfg.ActiveEngine, logger, detectionCache)
+	s.engines = []config.EngineType{cfg.ActiveEngine}
+	s.engineCaches = map[config.EngineType]*cache.DetectionCache{cfg.ActiveEngine: detectionCache}
+	for _, engine := range cfg.Engines {
+		if engine == cfg.ActiveEngine {
+			continue
+		}
+		s.engineCaches[engine] = cache.NewDetectionCache(cache.DefaultTTL)
+		s.drivers[engine] = newDriver(cfg, engine, logger, s.engineCaches[engine])
+		s.engines = append(s.engines, engine)
+	}
+
+	// The shadow engine reports into its own cache so its RTS detections
+	// never leak into the primary verdict
+	if cfg.ShadowEngine != "" && cfg.ShadowPercent > 0 {
+		s.shadowCache = cache.NewDetectionCache(cache.DefaultTTL)
+		s.shadow = newDriver(cfg, cfg.ShadowEngine, logger, s.shadowCache)
 	}
 
-	// Initialize only the active driver
-	switch cfg.ActiveEngine {
+	s.startJobWorkers()
+
+	return s
+}
+
+func newDriver(cfg *config.Config, engine config.EngineType, logger *slog.Logger, detectionCache *cache.DetectionCache) drivers.Driver {
+	switch engine {
 	case config.EngineClamAV:
-		s.drivers[config.EngineClamAV] = drivers.NewClamAVDriver(
-			cfg.Drivers[config.EngineClamAV],
+		if driverCfg := cfg.Drivers[config.EngineClamAV]; driverCfg.ClamdAddress != "" {
+			return drivers.NewClamdDriver(driverCfg, logger, detectionCache)
+		}
+		return drivers.NewClamAVDriver(
+			resolveScanBinary(cfg.Drivers[config.EngineClamAV], logger),
 			logger,
 			detectionCache,
 		)
 	case config.EngineTrendMicro:
-		s.drivers[config.EngineTrendMicro] = drivers.NewTrendMicroDriver(
-			cfg.Drivers[config.EngineTrendMicro],
+		return drivers.NewTrendMicroDriver(
+			resolveScanBinary(cfg.Drivers[config.EngineTrendMicro], logger),
+			logger,
+			detectionCache,
+		)
+	case config.EngineSophos:
+		return drivers.NewSophosDriver(
+			resolveScanBinary(cfg.Drivers[config.EngineSophos], logger),
+			logger,
+			detectionCache,
+		)
+	case config.EngineDefender:
+		return drivers.NewDefenderDriver(
+			resolveScanBinary(cfg.Drivers[config.EngineDefender], logger),
 			logger,
 			detectionCache,
 		)
 	case config.EngineMock:
-		s.drivers[config.EngineMock] = drivers.NewMockDriver(
+		return drivers.NewMockDriver(
 			config.DriverConfig{Engine: config.EngineMock},
 		)
 	}
+	return nil
+}
 
-	return s
+// resolveScanBinary picks the first installed scan binary for this
+// architecture. If none is found the configured path is kept and the scan
+// error surfaces through health checks.
+func resolveScanBinary(driverCfg config.DriverConfig, logger *slog.Logger) config.DriverConfig {
+	if len(driverCfg.ScanBinaryCandidates) == 0 {
+		return driverCfg
+	}
+	path, err := drivers.ResolveBinary(driverCfg.ScanBinaryCandidates)
+	if err != nil {
+		logger.Warn("No scan binary found", "engine", driverCfg.Engine, "error", err)
+		// Engines switched to at runtime were not assigned a path at load
+		if driverCfg.ScanBinaryPath == "" {
+			driverCfg.ScanBinaryPath = driverCfg.ScanBinaryCandidates[0]
+		}
+		return driverCfg
+	}
+	if path != driverCfg.ScanBinaryPath {
+		logger.Info("Using probed scan binary", "engine", driverCfg.Engine, "path", path)
+	}
+	driverCfg.ScanBinaryPath = path
+	return driverCfg
 }
 
-// Start starts the active driver's background watcher
+// Start starts each engine driver's background watcher
 func (s *Scanner) Start() error {
-	driver := s.drivers[s.activeEngine]
-	if err := driver.Start(); err != nil {
-		s.logger.Error("Failed to start driver", "engine", s.activeEngine, "error", err)
-		return err
+	for _, engine := range s.engines {
+		s.watchRestarts(s.drivers[engine])
+		if err := s.drivers[engine].Start(); err != nil {
+			s.logger.Error("Failed to start driver", "engine", engine, "error", err)
+			return err
+		}
+	}
+	if s.shadow != nil {
+		// A broken canary must not take down the primary engine
+		if err := s.shadow.Start(); err != nil {
+			s.logger.Warn("Failed to start shadow driver, shadow scans disabled", "engine", s.shadow.Engine(), "error", err)
+			s.shadowCache.Stop()
+			s.shadow = nil
+		}
 	}
 	return nil
 }
 
-// Stop stops the active driver's background watcher
+// Stop stops each engine driver's background watcher
 func (s *Scanner) Stop() {
-	s.drivers[s.activeEngine].Stop()
-	s.detectionCache.Stop()
+	s.stopJobWorkers()
+	for _, engine := range s.engines {
+		s.drivers[engine].Stop()
+		s.engineCaches[engine].Stop()
+	}
+	if s.shadow != nil {
+		s.shadow.Stop()
+		s.shadowCache.Stop()
+	}
+}
+
+// SetPolicy sets the per-extension scan policy evaluated before engine invocation
+func (s *Scanner) SetPolicy(p *policy.Policy) {
+	s.policy = p
+}
+
+// SetUploadStore keeps uploads in store instead of plain files in
+// UPLOAD_DIR
+func (s *Scanner) SetUploadStore(store uploads.Store) {
+	s.uploads = store
+}
+
+// SetQuarantine keeps infected files in q instead of deleting them; nil
+// deletes them
+func (s *Scanner) SetQuarantine(q *quarantine.Store) {
+	s.quarantine = q
+}
+
+// SetEvents publishes every scan result with p; nil disables publishing
+func (s *Scanner) SetEvents(p *events.Publisher) {
+	s.events = p
+}
+
+// Quarantine returns the quarantine store, or nil when disabled
+func (s *Scanner) Quarantine() *quarantine.Store {
+	return s.quarantine
+}
+
+// SetUploadVolume records the startup inspection of the upload directory
+func (s *Scanner) SetUploadVolume(r *volume.Report) {
+	s.uploadVolume = r
+}
+
+// UploadVolume returns the upload directory inspection, or nil if not run
+func (s *Scanner) UploadVolume() *volume.Report {
+	return s.uploadVolume
 }
 
 func (s *Scanner) Scan(filePath, fileID, originalName string, size int64) (*ScanResponse, error) {
+	return s.ScanWithOptions(filePath, fileID, originalName, size, ScanOptions{})
+}
+
+// ScanWithOptions scans an upload and removes it. A panic during the scan
+// is recovered and returned as ErrPanic.
+func (s *Scanner) ScanWithOptions(filePath, fileID, originalName string, size int64, opts ScanOptions) (response *ScanResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			response, err = nil, s.recovered("scan", r, "fileId", fileID, "originalName", originalName)
+			s.deleteFile(filePath, fileID)
+		}
+	}()
+	return s.scan(filePath, fileID, originalName, size, opts)
+}
+
+func (s *Scanner) scan(filePath, fileID, originalName string, size int64, opts ScanOptions) (*ScanResponse, error) {
 	startTime := time.Now()
-	driver := s.drivers[s.activeEngine]
+	driver, detectionCache := s.activeDriver()
+
+	// Members are part of their container's scan
+	if opts.depth == 0 {
+		s.capacity.inFlight.Add(1)
+		defer s.capacity.inFlight.Add(-1)
+	}
 
 	s.logger.Info("Starting scan",
 		"fileId", fileID,
@@ -93,10 +375,158 @@ func (s *Scanner) Scan(filePath, fileID, originalName string, size int64) (*Scan
 		"size", size,
 	)
 
-	absPath, _ := filepath.Abs(filePath)
+	// 0. Identify the file by its content and evaluate scan policy before
+	// invoking the engine
+	fileType, err := inspect.DetectType(filePath)
+	if err != nil {
+		s.logger.Warn("Failed to detect file type", "fileId", fileID, "error", err)
+	}
+	decision, matchedPolicy, response := s.applyPolicy(filePath, fileID, originalName, size, fileType, driver, opts, startTime)
+	if response != nil {
+		return response, nil
+	}
+
+	// Members of a container were paid for by the container itself, and
+	// are scanned in its slot
+	if opts.depth == 0 {
+		release, err := s.admitScan(fileID, size)
+		if err != nil {
+			s.deleteFile(filePath, fileID)
+			return nil, err
+		}
+		defer release()
+	}
+
+	// Structural checks run before the engine (or RTS) can remove the file
+	findings, entropy := s.inspectContent(filePath, nil, fileID, decision)
+
+	// Extract container members for the same reason
+	var members []extract.Attachment
+	if extracts(opts.Profile) && extract.IsEmail(originalName, opts.MimeType) {
+		if opts.depth >= s.nestingDepth(opts.Profile) {
+			s.logger.Warn("Maximum container nesting depth reached", "fileId", fileID, "depth", opts.depth)
+			findings = append(findings, "nesting:max-depth-exceeded")
+		} else {
+			var extractErr error
+			members, extractErr = extract.EmailAttachments(filePath, originalName, opts.MimeType)
+			if extractErr != nil {
+				s.logger.Warn("Failed to extract email attachments", "fileId", fileID, "error", extractErr)
+			}
+		}
+	}
+	if s.config.PayloadCheck && extracts(opts.Profile) {
+		atMaxDepth := opts.depth >= s.nestingDepth(opts.Profile)
+		payloads, found := s.textPayloads(filePath, fileID, extract.IsEmail(originalName, opts.MimeType), atMaxDepth)
+		if found && atMaxDepth && !slices.Contains(findings, "nesting:max-depth-exceeded") {
+			s.logger.Warn("Maximum container nesting depth reached", "fileId", fileID, "depth", opts.depth)
+			findings = append(findings, "nesting:max-depth-exceeded")
+		}
+		members = append(members, payloads...)
+	}
+
+	// Encrypted archives hide their members from the engine
+	archiveMembers, locked := s.encryptedArchive(filePath, fileID, opts)
+	if locked {
+		findings = append(findings, findingEncrypted)
+	}
+	members = append(members, archiveMembers...)
+
+	// Sample top-level scans for the canary engine
+	var shadowResult <-chan *shadowScan
+	if opts.depth == 0 {
+		shadowResult = s.startShadowScan(filePath, fileID)
+	}
+
+	// Other engines scan copies concurrently with the primary
+	var engineScans <-chan []*EngineVerdict
+	if others := s.otherEngines(opts.Engines); len(others) > 0 {
+		engineScans = s.startEngineScans(others, filePath, fileID, size, opts.Profile, decision.Action == policy.ActionDeep)
+	}
 
 	// 1. Run manual scan
-	result, err := driver.ManualScan(filePath)
+	primaryStart := time.Now()
+	timings := &Timings{}
+	result, finalStatus, signature, err := s.runEngine(driver, detectionCache, filePath, fileID, size, opts.Profile, decision.Action == policy.ActionDeep, timings)
+
+	// 2. Combine engine verdicts
+	var verdicts []*EngineVerdict
+	if engineScans != nil {
+		primary := newEngineVerdict(driver.Engine(), finalStatus, signature, err, primaryStart)
+		verdicts = append([]*EngineVerdict{primary}, <-engineScans...)
+		finalStatus, signature, err = aggregateVerdicts(s.config.EngineAggregation, verdicts)
+	}
+	if err != nil {
+		s.deleteFile(filePath, fileID)
+		return nil, err
+	}
+
+	if shadowResult != nil {
+		go s.compareShadowScan(fileID, driver.Engine(), finalStatus, signature, shadowResult)
+	}
+
+	// 3. Keep infected files for investigation, then clean up (may already
+	// be removed by RTS)
+	if finalStatus == drivers.StatusInfected {
+		s.quarantineFile(filePath, nil, fileID, originalName, size, driver.Engine(), signature, opts.Caller, startTime)
+	}
+	s.deleteFile(filePath, fileID)
+
+	response = &ScanResponse{
+		FileID:     fileID,
+		Status:     finalStatus,
+		Engine:     driver.Engine(),
+		Signature:  signature,
+		ScanResult: result,
+		Engines:    verdicts,
+		Policy:     matchedPolicy,
+		Findings:   findings,
+		Entropy:    entropy,
+		FileType:   detectedFileType(fileType),
+		Profile:    opts.Profile,
+		Timings:    timings,
+	}
+
+	// Structural findings downgrade a clean verdict to suspicious
+	if len(findings) > 0 && response.Status == drivers.StatusClean {
+		response.Status = drivers.StatusSuspicious
+	}
+	// Only ENCRYPTED_ARCHIVES=warn lets an archive that stays encrypted through
+	if locked && s.config.EncryptedArchives != config.EncryptedWarn && response.Status != drivers.StatusInfected {
+		response.Status = drivers.StatusBlocked
+	}
+
+	// 4. Scan extracted members; an infected member taints the container
+	if len(members) > 0 {
+		response.Children = s.scanMembers(fileID, members, opts)
+		for _, child := range response.Children {
+			if child.Status == drivers.StatusInfected && response.Status != drivers.StatusInfected {
+				response.Status = drivers.StatusInfected
+				response.Signature = child.Signature
+			}
+			if child.Status == drivers.StatusSuspicious && response.Status == drivers.StatusClean {
+				response.Status = drivers.StatusSuspicious
+			}
+		}
+	}
+	s.completeScan(response, originalName, size, opts, startTime, false)
+	return response, nil
+}
+
+// runEngine runs one engine's manual scan, falling back to its RTS detection
+// cache when the file disappears (quarantined on access). The time spent in
+// each is added to timings, if not nil.
+func (s *Scanner) runEngine(driver drivers.Driver, detectionCache *cache.DetectionCache, filePath, fileID string, size int64, profile config.ScanProfile, deep bool, timings *Timings) (*drivers.ScanResult, drivers.ScanStatus, string, error) {
+	absPath, _ := filepath.Abs(filePath)
+	scanOpts := engineOptions(driver.Config(), profile, deep)
+	manualStart := time.Now()
+	result, err := driver.ManualScan(filePath, scanOpts)
+	if timings != nil {
+		timings.ManualScanMs = time.Since(manualStart).Milliseconds()
+	}
+	if err == nil && result.Usage != nil {
+		cpu := time.Duration(result.Usage.UserTime+result.Usage.SystemTime) * time.Millisecond
+		metrics.RecordEngineUsage(string(driver.Engine()), metrics.FileType(filePath), cpu, result.Usage.MaxRSS)
+	}
 
 	var finalStatus drivers.ScanStatus
 	var signature string
@@ -105,29 +535,41 @@ func (s *Scanner) Scan(filePath, fileID, originalName string, size int64) (*Scan
 		// Manual scan completed successfully - use its result
 		finalStatus = result.Status
 		signature = result.Signature
+		if cached, found := detectionCache.Peek(absPath); found {
+			s.compareRTSVerdict(driver.Engine(), fileID, result, cached)
+		}
+
+		// Deep scans also honour an RTS detection the manual scan missed
+		if scanOpts.Deep && finalStatus == drivers.StatusClean {
+			if cached, found := detectionCache.Get(absPath); found && cached.Status == "infected" {
+				finalStatus = drivers.StatusInfected
+				signature = cached.Signature
+			}
+		}
 	} else {
-		// 2. Manual scan failed (file missing = RTS quarantined it)
+		// Manual scan failed (file missing = RTS quarantined it)
 		// Wait for RTS cache with timeout proportional to file size
 		driverCfg := driver.Config()
 		s.logger.Debug("Manual scan failed, waiting for RTS cache", "error", err, "fileId", fileID)
-		retryDelay := 20 * time.Millisecond
 		baseDelay := time.Duration(driverCfg.RTSCacheBaseDelay) * time.Millisecond
 		delayPerMB := time.Duration(driverCfg.RTSCacheDelayPerMB) * time.Millisecond
 		maxWait := baseDelay + time.Duration(size/1024/1024)*delayPerMB
-		waited := time.Duration(0)
-		for waited < maxWait {
-			if cached, found := s.detectionCache.Get(absPath); found && cached.Status == "infected" {
-				s.logger.Info("File detected by RTS",
-					"fileId", fileID,
-					"signature", cached.Signature,
-					"waitedMs", waited.Milliseconds(),
-				)
-				finalStatus = drivers.StatusInfected
-				signature = cached.Signature
-				break
-			}
-			time.Sleep(retryDelay)
-			waited += retryDelay
+		cached, waited, stuckErr := s.waitForRTS(driver, detectionCache, absPath, fileID, maxWait)
+		if timings != nil {
+			timings.RTSWaitMs = waited.Milliseconds()
+		}
+		if stuckErr != nil {
+			return nil, "", "", stuckErr
+		}
+		if cached != nil {
+			s.logger.Info("File detected by RTS",
+				"fileId", fileID,
+				"engine", driver.Engine(),
+				"signature", cached.Signature,
+				"waitedMs", waited.Milliseconds(),
+			)
+			finalStatus = drivers.StatusInfected
+			signature = cached.Signature
 		}
 		// If still not found in cache, check why
 		if finalStatus == "" {
@@ -136,7 +578,12 @@ func (s *Scanner) Scan(filePath, fileID, originalName string, size int64) (*Scan
 				fileExists = false
 			}
 
-			if !fileExists {
+			category := drivers.ErrorFileMissing
+			if fileExists {
+				// The engine could not scan a file that is still there
+				category = failureCategory(result, err)
+				s.recordEngineFailure(driver.Engine())
+			} else {
 				// File disappeared but no RTS detection - likely log parsing issue
 				s.logger.Error("POTENTIAL LOG PARSING ISSUE: file disappeared but no RTS detection found",
 					"fileId", fileID,
@@ -146,36 +593,311 @@ func (s *Scanner) Scan(filePath, fileID, originalName string, size int64) (*Scan
 				)
 			}
 
-			return nil, fmt.Errorf("scan failed: file not accessible and no RTS detection found")
+			return nil, "", "", s.engineError(driver.Engine(), category, fileID)
 		}
 	}
 
-	// 3. Clean up file (may already be removed by RTS)
+	return result, finalStatus, signature, nil
+}
+
+// failureCategory says why a manual scan failed, from the driver's error or
+// the category it read from the engine's output
+func failureCategory(result *drivers.ScanResult, err error) drivers.ErrorCategory {
+	switch {
+	case err != nil:
+		return drivers.ClassifyErr(err)
+	case result.ErrorCategory != "":
+		return result.ErrorCategory
+	}
+	return drivers.ErrorUnknown
+}
+
+// engineError counts and logs a scan the engine failed, by category
+func (s *Scanner) engineError(engine config.EngineType, category drivers.ErrorCategory, fileID string) *EngineError {
+	metrics.RecordScanError(string(engine), string(category))
+	s.logger.Warn("Engine scan failed", "fileId", fileID, "engine", engine, "category", category)
+	return &EngineError{Engine: engine, Category: category}
+}
+
+// compareRTSVerdict reports a manual scan verdict that differs from the RTS
+// detection of the same file. The engine's on-access and on-demand scans
+// should agree, so a mismatch usually means their policies have drifted,
+// e.g. different signature sets or exclusions.
+func (s *Scanner) compareRTSVerdict(engine config.EngineType, fileID string, manual *drivers.ScanResult, rts *cache.Detection) {
+	if rts.Status == string(manual.Status) {
+		return
+	}
+	metrics.RecordVerdictMismatch(string(engine), string(manual.Status), rts.Status)
+	s.logger.Warn("RTS and manual scan verdicts differ",
+		"fileId", fileID,
+		"engine", engine,
+		"manualStatus", manual.Status,
+		"manualSignature", manual.Signature,
+		"rtsStatus", rts.Status,
+		"rtsSignature", rts.Signature,
+		"hint", "check that on-access and on-demand scan settings match",
+	)
+}
+
+// acquireThroughput waits for size bytes of scan throughput, or returns a
+// ThrottledError if the configured mode rejects excess or the wait is too long
+func (s *Scanner) acquireThroughput(fileID string, size int64) error {
+	if s.throughput == nil {
+		return nil
+	}
+
+	maxWait := time.Duration(s.config.ThroughputMaxWait) * time.Millisecond
+	if s.config.ThroughputMode == config.ThroughputReject {
+		maxWait = 0
+	}
+
+	wait, ok := s.throughput.Reserve(size, maxWait)
+	if !ok {
+		s.logger.Warn("Scan rejected by throughput limit", "fileId", fileID, "size", size, "retryAfter", wait)
+		return &ThrottledError{RetryAfter: wait}
+	}
+	if wait > 0 {
+		s.logger.Debug("Scan queued by throughput limit", "fileId", fileID, "size", size, "wait", wait)
+		s.capacity.queued.Add(1)
+		time.Sleep(wait)
+		s.capacity.queued.Add(-1)
+	}
+	return nil
+}
+
+// admitScan takes size bytes of throughput and then a scan slot, returning
+// the function releasing the slot. Throughput taken for a scan the full scan
+// queue then rejects is refunded, so the rejection does not count against
+// later scans.
+func (s *Scanner) admitScan(fileID string, size int64) (func(), error) {
+	if err := s.acquireThroughput(fileID, size); err != nil {
+		return nil, err
+	}
+	release, err := s.acquireScanSlot(fileID)
+	if err != nil {
+		if s.throughput != nil {
+			s.throughput.Refund(size)
+		}
+		return nil, err
+	}
+	return release, nil
+}
+
+// scanMembers writes each container member to the upload directory and runs
+// it through the scan pipeline, including policy evaluation and, for nested
+// containers, further extraction. Members inherit the container's engines,
+// archive passwords and profile.
+func (s *Scanner) scanMembers(parentID string, members []extract.Attachment, parent ScanOptions) []*MemberResult {
+	results := make([]*MemberResult, 0, len(members))
+	for i, att := range members {
+		childID := fmt.Sprintf("%s-%d", parentID, i+1)
+		result := &MemberResult{FileName: att.Name}
+		results = append(results, result)
+
+		dst, childPath, err := s.CreateUpload(childID, att.Name)
+		if err != nil {
+			result.Status, result.Error = drivers.StatusError, "failed to save attachment"
+			continue
+		}
+		_, err = dst.Write(att.Data)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			s.deleteFile(childPath, childID)
+			result.Status, result.Error = drivers.StatusError, "failed to save attachment"
+			continue
+		}
+
+		resp, err := s.ScanWithOptions(childPath, childID, att.Name, int64(len(att.Data)), ScanOptions{
+			MimeType:  att.ContentType,
+			Engines:   parent.Engines,
+			Passwords: parent.Passwords,
+			Caller:    parent.Caller,
+			Profile:   parent.Profile,
+			depth:     parent.depth + 1,
+		})
+		if err != nil {
+			s.deleteFile(childPath, childID)
+			result.Status, result.Error = drivers.StatusError, err.Error()
+			continue
+		}
+		result.Status = resp.Status
+		result.Signature = resp.Signature
+		result.Findings = resp.Findings
+		result.Children = resp.Children
+	}
+	return results
+}
+
+// detectedFileType returns the type to report, or nil if it was not detected
+func detectedFileType(fileType inspect.FileType) *inspect.FileType {
+	if fileType.MimeType == "" {
+		return nil
+	}
+	return &fileType
+}
+
+// applyPolicy evaluates scan policy for an upload before the engine sees it.
+// Dry runs and skip or block rules are finished here and their response
+// returned; otherwise the response is nil and the engine scans the upload.
+func (s *Scanner) applyPolicy(filePath, fileID, originalName string, size int64, fileType inspect.FileType, driver drivers.Driver, opts ScanOptions, startTime time.Time) (policy.Decision, *policy.Decision, *ScanResponse) {
+	decision := s.policy.Evaluate(originalName, opts.MimeType, size, fileType)
+	var matchedPolicy *policy.Decision
+	if decision.Rule != "" {
+		matchedPolicy = &decision
+	}
+	if opts.DryRun {
+		return decision, matchedPolicy, s.finishDryRun(filePath, fileID, driver, decision, matchedPolicy, detectedFileType(fileType), startTime)
+	}
+	if decision.Action == policy.ActionSkip || decision.Action == policy.ActionBlock {
+		response := s.finishWithoutScan(filePath, fileID, driver.Engine(), matchedPolicy, detectedFileType(fileType), startTime)
+		s.publishScan(response, originalName, size, opts)
+		return decision, matchedPolicy, response
+	}
+	return decision, matchedPolicy, nil
+}
+
+// inspectContent runs the structural checks on the upload at filePath, or
+// on content for uploads scanned in memory, returning their findings and the
+// entropy if it was measured
+func (s *Scanner) inspectContent(filePath string, content []byte, fileID string, decision policy.Decision) ([]string, *float64) {
+	var findings []string
+	if s.config.PolyglotCheck {
+		var err error
+		if content != nil {
+			findings, err = inspect.PolyglotReader(bytes.NewReader(content))
+		} else {
+			findings, err = inspect.Polyglot(filePath)
+		}
+		if err != nil {
+			s.logger.Warn("Failed to inspect file structure", "fileId", fileID, "error", err)
+		}
+	}
+
+	if !s.config.EntropyCheck && decision.EntropyThreshold == 0 {
+		return findings, nil
+	}
+	var value float64
+	var compressed bool
+	var err error
+	if content != nil {
+		value, compressed, err = inspect.EntropyReader(bytes.NewReader(content))
+	} else {
+		value, compressed, err = inspect.Entropy(filePath)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to compute file entropy", "fileId", fileID, "error", err)
+		return findings, nil
+	}
+	value = math.Round(value*1000) / 1000
+	// Likely a packed or encrypted payload the engine cannot see into
+	if decision.EntropyThreshold > 0 && value > decision.EntropyThreshold && !compressed {
+		findings = append(findings, "entropy:high")
+	}
+	return findings, &value
+}
+
+// completeScan records an engine scan's duration, logs and counts its
+// verdict and publishes it
+func (s *Scanner) completeScan(response *ScanResponse, originalName string, size int64, opts ScanOptions, startTime time.Time, inMemory bool) {
+	response.TotalDuration = time.Since(startTime).Milliseconds()
+	response.Timings.TotalMs = response.TotalDuration
+	if opts.depth == 0 {
+		s.capacity.record(time.Since(startTime))
+	}
+
+	attrs := []any{
+		"fileId", response.FileID,
+		"status", response.Status,
+		"duration", response.TotalDuration,
+	}
+	if inMemory {
+		attrs = append(attrs, "inMemory", true)
+	}
+	s.logger.Info("Scan completed", attrs...)
+
+	metrics.RecordScan(string(response.Engine), string(response.Status))
+	s.publishScan(response, originalName, size, opts)
+}
+
+// finishWithoutScan completes a scan that policy resolved without the engine
+func (s *Scanner) finishWithoutScan(filePath, fileID string, engine config.EngineType, decision *policy.Decision, fileType *inspect.FileType, startTime time.Time) *ScanResponse {
 	s.deleteFile(filePath, fileID)
 
+	status := drivers.StatusSkipped
+	if decision.Action == policy.ActionBlock {
+		status = drivers.StatusBlocked
+	}
+
 	response := &ScanResponse{
 		FileID:        fileID,
-		Status:        finalStatus,
-		Engine:        driver.Engine(),
-		Signature:     signature,
-		ScanResult:    result,
+		Status:        status,
+		Engine:        engine,
+		Policy:        decision,
+		FileType:      fileType,
 		TotalDuration: time.Since(startTime).Milliseconds(),
 	}
 
-	s.logger.Info("Scan completed",
+	s.logger.Info("Scan resolved by policy",
 		"fileId", fileID,
-		"status", response.Status,
-		"duration", response.TotalDuration,
+		"status", status,
+		"rule", decision.Rule,
 	)
 
-	// Record metrics
-	metrics.RecordScan(string(driver.Engine()), string(response.Status))
+	metrics.RecordScan(string(engine), string(status))
 
-	return response, nil
+	return response
+}
+
+// finishDryRun reports the policy decision and engine health for a file that
+// is not scanned. No throughput or metrics are consumed.
+func (s *Scanner) finishDryRun(filePath, fileID string, driver drivers.Driver, decision policy.Decision, matchedPolicy *policy.Decision, fileType *inspect.FileType, startTime time.Time) *ScanResponse {
+	s.deleteFile(filePath, fileID)
+
+	status := drivers.StatusSkipped
+	if decision.Action == policy.ActionBlock {
+		status = drivers.StatusBlocked
+	}
+
+	result := &DryRunResult{Action: decision.Action}
+	health, err := driver.CheckHealth()
+	switch {
+	case err != nil:
+		result.EngineError = err.Error()
+	case health != nil:
+		result.EngineHealthy = health.Healthy
+		result.EngineError = health.Error
+	}
+
+	s.logger.Info("Dry run completed",
+		"fileId", fileID,
+		"action", decision.Action,
+		"engineHealthy", result.EngineHealthy,
+	)
+
+	return &ScanResponse{
+		FileID:        fileID,
+		Status:        status,
+		Engine:        driver.Engine(),
+		Policy:        matchedPolicy,
+		DryRun:        result,
+		FileType:      fileType,
+		TotalDuration: time.Since(startTime).Milliseconds(),
+	}
 }
 
 func (s *Scanner) deleteFile(filePath, fileID string) error {
-	if err := os.Remove(filePath); err != nil {
+	if filePath == "" {
+		// Scanned in memory
+		return nil
+	}
+	// Per-upload subdirectory used by original-name naming
+	if dir := filepath.Dir(filePath); filepath.Base(dir) == fileID {
+		defer s.uploads.Remove(dir)
+	}
+
+	if err := s.uploads.Remove(filePath); err != nil {
 		if os.IsNotExist(err) {
 			s.logger.Debug("File already removed (likely by RTS quarantine)",
 				"fileId", fileID,
@@ -189,28 +911,171 @@ func (s *Scanner) deleteFile(filePath, fileID string) error {
 	return nil
 }
 
+// WatchRTS waits for the active engine's on-access verdict for a file written
+// by another process. The file itself is not read or deleted.
+func (s *Scanner) WatchRTS(filePath string, timeout time.Duration) (*drivers.ScanResult, error) {
+	driver, _ := s.activeDriver()
+	return driver.RTSWatch(filePath, drivers.WatchOptions{Timeout: timeout})
+}
+
+// DetectionCache exposes the shared RTS detection cache for inspection
+func (s *Scanner) DetectionCache() *cache.DetectionCache {
+	_, detectionCache := s.activeDriver()
+	return detectionCache
+}
+
 func (s *Scanner) CheckHealth() []*drivers.EngineHealth {
-	health, _ := s.drivers[s.activeEngine].CheckHealth()
-	return []*drivers.EngineHealth{health}
+	health, _ := s.GetActiveEngineHealth()
+	results := []*drivers.EngineHealth{health}
+	for _, engine := range s.Engines()[1:] {
+		health, _ := s.engineHealth(engine)
+		results = append(results, health)
+	}
+	return results
 }
 
 func (s *Scanner) GetActiveEngineHealth() (*drivers.EngineHealth, error) {
-	return s.drivers[s.activeEngine].CheckHealth()
+	return s.engineHealth(s.ActiveEngine())
+}
+
+func (s *Scanner) engineHealth(engine config.EngineType) (*drivers.EngineHealth, error) {
+	driver, _ := s.engineDriver(engine)
+	health, err := driver.CheckHealth()
+	if health != nil && health.License != nil && health.License.ExpiresAt != nil {
+		metrics.SetLicenseExpiry(string(health.Engine), *health.License.ExpiresAt)
+	}
+	if health != nil && health.Signatures != nil && health.Signatures.AgeSeconds != nil {
+		metrics.SetSignatureAge(string(health.Engine), *health.Signatures.AgeSeconds)
+	}
+	return health, err
 }
 
 func (s *Scanner) GetEngineInfo() []drivers.EngineInfo {
-	return []drivers.EngineInfo{s.drivers[s.activeEngine].GetInfo()}
+	engines := s.Engines()
+	infos := make([]drivers.EngineInfo, 0, len(engines))
+	for _, engine := range engines {
+		driver, _ := s.engineDriver(engine)
+		infos = append(infos, driver.GetInfo())
+	}
+	return infos
 }
 
 func (s *Scanner) ActiveEngine() config.EngineType {
+	s.engineMu.RLock()
+	defer s.engineMu.RUnlock()
 	return s.activeEngine
 }
 
+// Engines returns the engines every upload is scanned with, active engine
+// first
+func (s *Scanner) Engines() []config.EngineType {
+	s.engineMu.RLock()
+	defer s.engineMu.RUnlock()
+	return slices.Clone(s.engines)
+}
+
+// activeDriver returns the active engine's driver and RTS detection cache
+func (s *Scanner) activeDriver() (drivers.Driver, *cache.DetectionCache) {
+	s.engineMu.RLock()
+	defer s.engineMu.RUnlock()
+	return s.drivers[s.activeEngine], s.detectionCache
+}
+
+// engineDriver returns an engine's driver and RTS detection cache
+func (s *Scanner) engineDriver(engine config.EngineType) (drivers.Driver, *cache.DetectionCache) {
+	s.engineMu.RLock()
+	defer s.engineMu.RUnlock()
+	return s.drivers[engine], s.engineCaches[engine]
+}
+
+// DiscardUpload removes an upload that will not be scanned
+func (s *Scanner) DiscardUpload(filePath, fileID string) error {
+	return s.deleteFile(filePath, fileID)
+}
+
 func (s *Scanner) GenerateFileID() string {
 	return uuid.New().String()
 }
 
+// GetUploadPath returns where an upload should be written, according to the
+// configured naming strategy. With hash naming this is a temporary path that
+// FinalizeUploadPath renames once the content hash is known.
 func (s *Scanner) GetUploadPath(fileID, originalName string) string {
-	ext := filepath.Ext(originalName)
-	return filepath.Join(s.config.UploadDir, fileID+ext)
+	ext := uploadExt(originalName)
+	if s.config.UploadNaming == config.UploadNamingOriginal {
+		return filepath.Join(s.uploadDir(), fileID, sanitizeFileName(originalName))
+	}
+	return filepath.Join(s.uploadDir(), fileID+ext)
+}
+
+// CreateUpload creates the file an upload is written to and returns it with
+// its path. The file is created exclusively, so an existing file or symlink
+// at the path is never written through, and directories below UPLOAD_DIR
+// that are symlinks are refused.
+func (s *Scanner) CreateUpload(fileID, originalName string) (io.WriteCloser, string, error) {
+	filePath := s.GetUploadPath(fileID, originalName)
+	f, err := s.uploads.Create(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, filePath, nil
+}
+
+// FinalizeUploadPath renames a written upload to its content-addressed name
+// when hash naming is enabled. If another upload with the same content is
+// already on disk, the file keeps its original path so concurrent scans of
+// identical content don't remove each other's files.
+func (s *Scanner) FinalizeUploadPath(filePath, originalName, sha256Hex string) string {
+	if s.config.UploadNaming != config.UploadNamingHash || sha256Hex == "" {
+		return filePath
+	}
+
+	// Link rather than rename so an existing file at hashPath is never
+	// replaced
+	hashPath := filepath.Join(s.uploadDir(), sha256Hex+uploadExt(originalName))
+	if err := s.uploads.Link(filePath, hashPath); err != nil {
+		if os.IsExist(err) {
+			s.logger.Debug("Upload with identical content already on disk", "path", hashPath)
+		} else {
+			s.logger.Warn("Failed to rename upload to content hash", "error", err, "path", filePath)
+		}
+		return filePath
+	}
+	if err := s.uploads.Remove(filePath); err != nil {
+		s.logger.Warn("Failed to remove temporary upload", "error", err, "path", filePath)
+	}
+	return hashPath
+}
+
+// uploadDir is the active engine's upload directory
+func (s *Scanner) uploadDir() string {
+	return s.config.EngineUploadDir(s.ActiveEngine())
+}
+
+// maxUploadExtLength bounds the extension kept in stored upload names
+const maxUploadExtLength = 16
+
+// uploadExt returns the extension of an uploaded file name for use in stored
+// paths. Anything but a short alphanumeric extension is dropped, so a crafted
+// name cannot influence the stored path beyond it.
+func uploadExt(name string) string {
+	ext := filepath.Ext(sanitizeFileName(name))
+	if len(ext) < 2 || len(ext) > maxUploadExtLength+1 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// sanitizeFileName reduces an uploaded file name to a safe single path element
+func sanitizeFileName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + strings.ReplaceAll(name, "\\", "/")))
+	if name == "/" || name == "." || name == ".." || name == "" {
+		return "upload"
+	}
+	return name
 }
@@ -1,13 +1,25 @@
 package scanner
 
 import (
+	"encoding/base64"
+	"errors"
 	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/rophy/av-scanner/internal/cache"
 	"github.com/rophy/av-scanner/internal/config"
 	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/inspect"
+	"github.com/rophy/av-scanner/internal/policy"
+	"github.com/rophy/av-scanner/internal/throttle"
 )
 
 func newTestScanner(t *testing.T) (*Scanner, string) {
@@ -19,11 +31,12 @@ func newTestScanner(t *testing.T) (*Scanner, string) {
 	}
 
 	cfg := &config.Config{
-		Port:         3000,
-		UploadDir:    tmpDir,
-		MaxFileSize:  10 * 1024 * 1024,
-		ActiveEngine: config.EngineMock,
-		LogLevel:     "debug",
+		Port:            3000,
+		UploadDir:       tmpDir,
+		MaxFileSize:     10 * 1024 * 1024,
+		ActiveEngine:    config.EngineMock,
+		LogLevel:        "debug",
+		MaxNestingDepth: 3,
 		Drivers: map[config.EngineType]config.DriverConfig{
 			config.EngineClamAV:     {Engine: config.EngineClamAV},
 			config.EngineTrendMicro: {Engine: config.EngineTrendMicro},
@@ -210,3 +223,809 @@ func TestScanner_GetUploadPath(t *testing.T) {
 		t.Errorf("expected path %s, got %s", expected, path)
 	}
 }
+
+func TestScanner_GetUploadPath_OriginalNaming(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.UploadNaming = config.UploadNamingOriginal
+
+	tests := []struct {
+		originalName string
+		expected     string
+	}{
+		{"report.pdf", filepath.Join(tmpDir, "abc123", "report.pdf")},
+		{"../../etc/passwd", filepath.Join(tmpDir, "abc123", "passwd")},
+		{"..\\..\\boot.ini", filepath.Join(tmpDir, "abc123", "boot.ini")},
+		{"..", filepath.Join(tmpDir, "abc123", "upload")},
+		{"", filepath.Join(tmpDir, "abc123", "upload")},
+	}
+
+	for _, tt := range tests {
+		if path := s.GetUploadPath("abc123", tt.originalName); path != tt.expected {
+			t.Errorf("GetUploadPath(%q) = %s, expected %s", tt.originalName, path, tt.expected)
+		}
+	}
+}
+
+func TestScanner_FinalizeUploadPath_HashNaming(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.UploadNaming = config.UploadNamingHash
+
+	first := filepath.Join(tmpDir, "id1.exe")
+	second := filepath.Join(tmpDir, "id2.exe")
+	for _, p := range []string{first, second} {
+		if err := os.WriteFile(p, []byte("same content"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	path := s.FinalizeUploadPath(first, "setup.exe", "deadbeef")
+	if expected := filepath.Join(tmpDir, "deadbeef.exe"); path != expected {
+		t.Errorf("expected path %s, got %s", expected, path)
+	}
+
+	// Identical content already on disk keeps its own path
+	if path := s.FinalizeUploadPath(second, "setup.exe", "deadbeef"); path != second {
+		t.Errorf("expected path %s, got %s", second, path)
+	}
+}
+
+func TestScanner_GetUploadPath_Extension(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	tests := []struct {
+		originalName string
+		expected     string
+	}{
+		{"archive.tar.gz", "abc123.gz"},
+		{"a.b/../../../etc/cron.d", "abc123.d"},
+		{"x.\\..\\..\\evil", "abc123"},
+		{"payload.sh;rm", "abc123"},
+		{"noext.", "abc123"},
+		{"long." + strings.Repeat("a", 40), "abc123"},
+	}
+
+	for _, tt := range tests {
+		if path := s.GetUploadPath("abc123", tt.originalName); path != filepath.Join(tmpDir, tt.expected) {
+			t.Errorf("GetUploadPath(%q) = %s, expected %s", tt.originalName, path, tt.expected)
+		}
+	}
+}
+
+func TestScanner_CreateUpload(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	f, path, err := s.CreateUpload("abc123", "test.txt")
+	if err != nil {
+		t.Fatalf("CreateUpload failed: %v", err)
+	}
+	f.Close()
+	if path != filepath.Join(tmpDir, "abc123.txt") {
+		t.Errorf("unexpected path %s", path)
+	}
+
+	// An existing file is never reused
+	if _, _, err := s.CreateUpload("abc123", "other.txt"); err == nil {
+		t.Error("expected collision to be refused")
+	}
+
+	// Nor is a symlink planted at the upload path
+	target := filepath.Join(tmpDir, "target")
+	if err := os.Symlink(target, filepath.Join(tmpDir, "planted.txt")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if _, _, err := s.CreateUpload("planted", "a.txt"); err == nil {
+		t.Error("expected symlinked upload path to be refused")
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Error("expected symlink target to be left alone")
+	}
+}
+
+func TestScanner_CreateUpload_SymlinkedSubdir(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.UploadNaming = config.UploadNamingOriginal
+
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(tmpDir, "abc123")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if _, _, err := s.CreateUpload("abc123", "report.pdf"); err == nil {
+		t.Error("expected symlinked upload subdirectory to be refused")
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("expected nothing written outside the upload directory, got %d entries", len(entries))
+	}
+}
+
+func TestScanner_ScanDeletesUploadSubdir(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.UploadNaming = config.UploadNamingOriginal
+
+	filePath := s.GetUploadPath("test-id-4", "named.txt")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatalf("failed to create upload subdir: %v", err)
+	}
+	if err := os.WriteFile(filePath, []byte("named"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	if _, err := s.Scan(filePath, "test-id-4", "named.txt", 5); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Dir(filePath)); !os.IsNotExist(err) {
+		t.Error("expected upload subdirectory to be removed after scan")
+	}
+}
+
+func TestScanner_PolicyBlockAndSkip(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	p, err := policy.New([]policy.Rule{
+		{Name: "block-scr", Extensions: []string{".scr"}, Action: policy.ActionBlock},
+		{Name: "skip-small-text", Extensions: []string{".txt"}, MaxSize: 1024, Action: policy.ActionSkip},
+	})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	s.SetPolicy(p)
+
+	tests := []struct {
+		name   string
+		status drivers.ScanStatus
+	}{
+		{"evil.scr", drivers.StatusBlocked},
+		{"small.txt", drivers.StatusSkipped},
+	}
+
+	for _, tt := range tests {
+		filePath := filepath.Join(tmpDir, tt.name)
+		// EICAR content proves the engine was not invoked
+		if err := os.WriteFile(filePath, []byte(drivers.EICARPattern()), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+
+		result, err := s.Scan(filePath, "policy-"+tt.name, tt.name, 68)
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		if result.Status != tt.status {
+			t.Errorf("%s: expected status %s, got %s", tt.name, tt.status, result.Status)
+		}
+		if result.Policy == nil || result.Policy.Rule == "" {
+			t.Errorf("%s: expected matched policy in response", tt.name)
+		}
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			t.Errorf("%s: expected file to be deleted", tt.name)
+		}
+	}
+}
+
+func TestScanner_PolicyFileTypes(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	p, err := policy.New([]policy.Rule{
+		{Name: "block-executables", FileTypes: []string{inspect.CategoryExecutable}, Action: policy.ActionBlock},
+		{Name: "skip-small-images", FileTypes: []string{inspect.CategoryImage}, MaxSize: 1 << 20, Action: policy.ActionSkip},
+	})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	s.SetPolicy(p)
+
+	tests := []struct {
+		name     string
+		content  string
+		status   drivers.ScanStatus
+		mimeType string
+	}{
+		// An executable renamed to look like an image is still blocked
+		{"photo.jpg", "MZ\x90\x00\x03\x00\x00\x00", drivers.StatusBlocked, "application/vnd.microsoft.portable-executable"},
+		{"logo.bin", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", drivers.StatusSkipped, "image/png"},
+		{"notes.jpg", "hello world\n", drivers.StatusClean, "text/plain"},
+	}
+
+	for _, tt := range tests {
+		filePath := filepath.Join(tmpDir, tt.name)
+		if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+
+		result, err := s.Scan(filePath, "filetype-"+tt.name, tt.name, int64(len(tt.content)))
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		if result.Status != tt.status {
+			t.Errorf("%s: expected status %s, got %s", tt.name, tt.status, result.Status)
+		}
+		if result.FileType == nil || result.FileType.MimeType != tt.mimeType {
+			t.Errorf("%s: expected file type %s, got %+v", tt.name, tt.mimeType, result.FileType)
+		}
+	}
+}
+
+func TestScanner_ScanEmailAttachments(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	eml := "From: sender@example.com\r\n" +
+		"Subject: invoice\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"see attached\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; name=\"readme.txt\"\r\n" +
+		"Content-Disposition: attachment; filename=\"readme.txt\"\r\n" +
+		"\r\n" +
+		"harmless\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"invoice.com\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(drivers.EICARPattern())) + "\r\n" +
+		"--b--\r\n"
+
+	filePath := filepath.Join(tmpDir, "mail.eml")
+	if err := os.WriteFile(filePath, []byte(eml), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	result, err := s.Scan(filePath, "test-id-eml", "mail.eml", int64(len(eml)))
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	if result.Status != drivers.StatusInfected {
+		t.Errorf("expected status infected, got %s", result.Status)
+	}
+	if len(result.Children) != 2 {
+		t.Fatalf("expected 2 child results, got %d", len(result.Children))
+	}
+	if result.Children[0].FileName != "readme.txt" || result.Children[0].Status != drivers.StatusClean {
+		t.Errorf("unexpected first child result: %+v", result.Children[0])
+	}
+	if result.Children[1].FileName != "invoice.com" || result.Children[1].Status != drivers.StatusInfected {
+		t.Errorf("unexpected second child result: %+v", result.Children[1])
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 0 {
+		t.Errorf("expected upload dir to be empty after scan, got %d entries", len(entries))
+	}
+}
+
+func TestScanner_NestedMembers(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	inner := "From: a@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"i\"\r\n" +
+		"\r\n" +
+		"--i\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"payload.com\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(drivers.EICARPattern())) + "\r\n" +
+		"--i--\r\n"
+	eml := "From: sender@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"o\"\r\n" +
+		"\r\n" +
+		"--o\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		inner +
+		"--o--\r\n"
+
+	scan := func(fileID string) *ScanResponse {
+		filePath := filepath.Join(tmpDir, fileID+".eml")
+		if err := os.WriteFile(filePath, []byte(eml), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		result, err := s.Scan(filePath, fileID, "mail.eml", int64(len(eml)))
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		return result
+	}
+
+	result := scan("test-id-nested")
+	if result.Status != drivers.StatusInfected {
+		t.Errorf("expected status infected, got %s", result.Status)
+	}
+	if len(result.Children) != 1 || len(result.Children[0].Children) != 1 {
+		t.Fatalf("expected one nested member, got %+v", result.Children)
+	}
+	if leaf := result.Children[0].Children[0]; leaf.FileName != "payload.com" || leaf.Status != drivers.StatusInfected {
+		t.Errorf("unexpected nested member: %+v", leaf)
+	}
+
+	s.config.MaxNestingDepth = 1
+	result = scan("test-id-depth")
+	if result.Status != drivers.StatusSuspicious {
+		t.Errorf("expected status suspicious, got %s", result.Status)
+	}
+	if len(result.Children) != 1 || len(result.Children[0].Children) != 0 {
+		t.Fatalf("expected nested message not to be extracted, got %+v", result.Children)
+	}
+	if findings := result.Children[0].Findings; len(findings) != 1 || findings[0] != "nesting:max-depth-exceeded" {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+}
+
+func TestScanner_PolyglotSuspicious(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.PolyglotCheck = true
+
+	data := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, []byte("image data <script>alert(1)</script>")...)
+	filePath := filepath.Join(tmpDir, "photo.jpg")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	result, err := s.Scan(filePath, "test-id-polyglot", "photo.jpg", int64(len(data)))
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	if result.Status != drivers.StatusSuspicious {
+		t.Errorf("expected status suspicious, got %s", result.Status)
+	}
+	if len(result.Findings) != 1 || result.Findings[0] != "polyglot:jpeg+html" {
+		t.Errorf("expected polyglot finding, got %v", result.Findings)
+	}
+}
+
+func TestScanner_HighEntropy(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	p, err := policy.New([]policy.Rule{
+		{Extensions: []string{".bin", ".gz"}, Action: policy.ActionScan, EntropyThreshold: 7.5},
+	})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	s.SetPolicy(p)
+
+	random := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	scan := func(name string, data []byte) *ScanResponse {
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		result, err := s.Scan(filePath, "test-id-"+name, name, int64(len(data)))
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		return result
+	}
+
+	result := scan("payload.bin", random)
+	if result.Status != drivers.StatusSuspicious {
+		t.Errorf("expected status suspicious, got %s", result.Status)
+	}
+	if len(result.Findings) != 1 || result.Findings[0] != "entropy:high" {
+		t.Errorf("expected entropy finding, got %v", result.Findings)
+	}
+	if result.Entropy == nil || *result.Entropy < 7.9 {
+		t.Errorf("expected entropy near 8, got %v", result.Entropy)
+	}
+
+	// Compressed formats are expected to be high entropy
+	result = scan("archive.gz", append([]byte{0x1F, 0x8B, 0x08}, random...))
+	if result.Status != drivers.StatusClean || len(result.Findings) != 0 {
+		t.Errorf("expected clean gzip without findings, got %s %v", result.Status, result.Findings)
+	}
+
+	// Entropy is only computed when a rule or ENTROPY_CHECK asks for it
+	result = scan("notes.txt", []byte("plain text"))
+	if result.Entropy != nil {
+		t.Errorf("expected no entropy without ENTROPY_CHECK, got %v", *result.Entropy)
+	}
+	s.config.EntropyCheck = true
+	result = scan("notes2.txt", []byte("plain text"))
+	if result.Entropy == nil || result.Status != drivers.StatusClean {
+		t.Errorf("expected clean result with entropy, got %s %v", result.Status, result.Entropy)
+	}
+}
+
+func TestScanner_DryRun(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	p, err := policy.New([]policy.Rule{
+		{Name: "block-scr", Extensions: []string{".scr"}, Action: policy.ActionBlock},
+	})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	s.SetPolicy(p)
+
+	dryRun := func(name string) *ScanResponse {
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(filePath, []byte(drivers.EICARPattern()), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		result, err := s.ScanWithOptions(filePath, "test-id-"+name, name, 68, ScanOptions{DryRun: true})
+		if err != nil {
+			t.Fatalf("dry run failed: %v", err)
+		}
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be deleted", name)
+		}
+		return result
+	}
+
+	// The engine is never invoked, so even EICAR is not reported infected
+	result := dryRun("eicar.com")
+	if result.Status != drivers.StatusSkipped {
+		t.Errorf("expected status skipped, got %s", result.Status)
+	}
+	if result.DryRun == nil || result.DryRun.Action != policy.ActionScan || !result.DryRun.EngineHealthy {
+		t.Errorf("unexpected dry run result: %+v", result.DryRun)
+	}
+
+	result = dryRun("evil.scr")
+	if result.Status != drivers.StatusBlocked {
+		t.Errorf("expected status blocked, got %s", result.Status)
+	}
+	if result.DryRun == nil || result.DryRun.Action != policy.ActionBlock || result.Policy == nil {
+		t.Errorf("unexpected dry run result: %+v (policy %+v)", result.DryRun, result.Policy)
+	}
+}
+
+func TestScanner_ThroughputReject(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.ThroughputMode = config.ThroughputReject
+	s.throughput = throttle.NewBucket(10, 10)
+
+	scan := func(fileID string) error {
+		filePath := filepath.Join(tmpDir, fileID+".txt")
+		if err := os.WriteFile(filePath, []byte("clean file"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		_, err := s.Scan(filePath, fileID, "clean.txt", 10)
+		return err
+	}
+
+	if err := scan("test-id-first"); err != nil {
+		t.Fatalf("expected first scan to be admitted: %v", err)
+	}
+	err := scan("test-id-second")
+	throttled, ok := err.(*ThrottledError)
+	if !ok {
+		t.Fatalf("expected ThrottledError, got %v", err)
+	}
+	if throttled.RetryAfter <= 0 {
+		t.Errorf("expected positive retry-after, got %v", throttled.RetryAfter)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "test-id-second.txt")); !os.IsNotExist(err) {
+		t.Error("expected rejected upload to be deleted")
+	}
+}
+
+// blockingDriver holds every manual scan until release is closed
+type blockingDriver struct {
+	drivers.Driver
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d blockingDriver) ManualScan(filePath string, opts drivers.ScanOptions) (*drivers.ScanResult, error) {
+	d.started <- struct{}{}
+	<-d.release
+	return d.Driver.ManualScan(filePath, opts)
+}
+
+func TestScanner_ScanQueue(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.slots = newScanSlots(1, 1)
+	s.throughput = throttle.NewBucket(1, 1000)
+	driver := blockingDriver{s.drivers[config.EngineMock], make(chan struct{}, 2), make(chan struct{})}
+	s.drivers[config.EngineMock] = driver
+
+	scan := func(fileID string) error {
+		filePath := filepath.Join(tmpDir, fileID+".txt")
+		if err := os.WriteFile(filePath, []byte("clean file"), 0644); err != nil {
+			t.Errorf("failed to create test file: %v", err)
+			return nil
+		}
+		_, err := s.Scan(filePath, fileID, "clean.txt", 10)
+		return err
+	}
+
+	// The first scan takes the slot and the second waits in the queue
+	results := make(chan error, 2)
+	go func() { results <- scan("test-id-running") }()
+	<-driver.started
+	go func() { results <- scan("test-id-queued") }()
+	for s.slots.waiting.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	usage := s.LimitUsage()
+	if usage.ScanQueue != 1 {
+		t.Errorf("expected full scan queue usage, got %v", usage.ScanQueue)
+	}
+
+	err := scan("test-id-rejected")
+	throttled, ok := err.(*ThrottledError)
+	if !ok {
+		t.Fatalf("expected ThrottledError, got %v", err)
+	}
+	if throttled.RetryAfter <= 0 || !strings.Contains(err.Error(), "scan queue full") {
+		t.Errorf("unexpected throttled error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "test-id-rejected.txt")); !os.IsNotExist(err) {
+		t.Error("expected rejected upload to be deleted")
+	}
+	if throughput := s.LimitUsage().Throughput; throughput > usage.Throughput {
+		t.Errorf("expected the rejected scan's throughput to be refunded, usage went from %v to %v", usage.Throughput, throughput)
+	}
+
+	close(driver.release)
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Errorf("expected admitted scans to finish, got %v", err)
+		}
+	}
+}
+
+func TestScanner_ScanTextPayloads(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.PayloadCheck = true
+
+	// Padded with the trailing whitespace EICAR allows, to look like a blob
+	eicar := drivers.EICARPattern() + strings.Repeat(" ", 40)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(eicar))
+	}))
+	defer server.Close()
+
+	scan := func(name, text string) *ScanResponse {
+		t.Helper()
+		filePath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(filePath, []byte(text), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		result, err := s.Scan(filePath, "test-id-"+name, name, int64(len(text)))
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		return result
+	}
+
+	result := scan("inline.txt", "payload:\n"+base64.StdEncoding.EncodeToString([]byte(eicar))+"\n")
+	if result.Status != drivers.StatusInfected || len(result.Children) != 1 || result.Children[0].FileName != "base64-1.bin" {
+		t.Errorf("expected the decoded blob to be infected, got %s %+v", result.Status, result.Children)
+	}
+
+	// URLs are only followed with PAYLOAD_FETCH, to allowed hosts
+	link := "download it from " + server.URL + "/invoice.com today"
+	if result := scan("link.txt", link); result.Status != drivers.StatusClean || len(result.Children) != 0 {
+		t.Errorf("expected URL to be ignored, got %s %+v", result.Status, result.Children)
+	}
+	s.config.PayloadFetch = true
+	s.config.ScanURLSchemes = []string{"http"}
+	s.config.ScanURLAllowedHosts = []string{strings.TrimPrefix(server.URL, "http://")}
+	result = scan("link.txt", link)
+	if result.Status != drivers.StatusInfected || len(result.Children) != 1 || result.Children[0].FileName != server.URL+"/invoice.com" {
+		t.Errorf("expected the linked file to be infected, got %s %+v", result.Status, result.Children)
+	}
+
+	// Nothing is fetched at the maximum nesting depth
+	s.config.MaxNestingDepth = 0
+	result = scan("deep.txt", link)
+	if result.Status != drivers.StatusSuspicious || len(result.Children) != 0 {
+		t.Errorf("expected max depth finding, got %s %+v", result.Status, result.Children)
+	}
+}
+
+func TestScanner_VerdictMismatch(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	var logs strings.Builder
+	s.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	filePath := filepath.Join(tmpDir, "clean.txt")
+	if err := os.WriteFile(filePath, []byte("This is a clean file"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	absPath, _ := filepath.Abs(filePath)
+	s.detectionCache.Add(absPath, &cache.Detection{Status: "infected", Signature: "Test.RTS"})
+
+	result, err := s.Scan(filePath, "test-id-1", "clean.txt", 21)
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	// The manual verdict still wins; the disagreement is only reported
+	if result.Status != drivers.StatusClean {
+		t.Errorf("expected status clean, got %s", result.Status)
+	}
+	if !strings.Contains(logs.String(), "RTS and manual scan verdicts differ") || !strings.Contains(logs.String(), "rtsSignature=Test.RTS") {
+		t.Errorf("expected a verdict mismatch warning, got logs:\n%s", logs.String())
+	}
+}
+
+// panicDriver panics on every manual scan, like a driver with a parsing bug
+type panicDriver struct {
+	drivers.Driver
+}
+
+func (panicDriver) ManualScan(string, drivers.ScanOptions) (*drivers.ScanResult, error) {
+	panic("driver bug")
+}
+
+func TestScanner_RecoversPanic(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.drivers[config.EngineMock] = panicDriver{s.drivers[config.EngineMock]}
+
+	filePath := filepath.Join(tmpDir, "clean.txt")
+	if err := os.WriteFile(filePath, []byte("This is a clean file"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	if _, err := s.Scan(filePath, "test-id-1", "clean.txt", 21); !errors.Is(err, ErrPanic) {
+		t.Fatalf("expected ErrPanic, got %v", err)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("expected the upload to be removed after a panic, got %v", err)
+	}
+}
+
+// oomDriver fails every manual scan the way clamd does when it runs out of
+// memory
+type oomDriver struct {
+	drivers.Driver
+}
+
+func (oomDriver) ManualScan(filePath string, _ drivers.ScanOptions) (*drivers.ScanResult, error) {
+	return &drivers.ScanResult{
+		Status:        drivers.StatusError,
+		ErrorCategory: drivers.ClassifyError(filePath + ": Can't allocate memory ERROR"),
+	}, nil
+}
+
+func TestScanner_EngineErrorCategory(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.drivers[config.EngineMock] = oomDriver{s.drivers[config.EngineMock]}
+
+	filePath := filepath.Join(tmpDir, "clean.txt")
+	if err := os.WriteFile(filePath, []byte("This is a clean file"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	_, err := s.Scan(filePath, "test-id-1", "clean.txt", 21)
+	var engineErr *EngineError
+	if !errors.As(err, &engineErr) || engineErr.Category != drivers.ErrorOutOfMemory {
+		t.Fatalf("expected an out_of_memory engine error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "out_of_memory") {
+		t.Errorf("expected the category in the error message, got %q", err.Error())
+	}
+}
+
+func TestScanner_EngineErrorRemovesUpload(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.drivers[config.EngineMock] = oomDriver{s.drivers[config.EngineMock]}
+
+	filePath := filepath.Join(tmpDir, "clean.txt")
+	if err := os.WriteFile(filePath, []byte("This is a clean file"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+	if _, err := s.Scan(filePath, "test-id-1", "clean.txt", 21); err == nil {
+		t.Fatal("expected the scan to fail")
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("expected the upload directory to be empty after a failed scan, found %d entries", len(entries))
+	}
+}
+
+func TestScanner_WarmUp(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	if !s.WarmedUp() {
+		t.Error("expected no warm-up to wait for with WARMUP_SCAN=false")
+	}
+	s.warmedUp.Store(false)
+	s.WarmUp()
+	if !s.WarmedUp() {
+		t.Error("expected the scanner to be warmed up")
+	}
+	if entries, _ := os.ReadDir(s.uploadDir()); len(entries) != 0 {
+		t.Errorf("expected the probe file to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestScanner_Profiles(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	eml := "From: sender@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"invoice.com\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(drivers.EICARPattern())) + "\r\n" +
+		"--b--\r\n"
+	scan := func(profile config.ScanProfile) *ScanResponse {
+		filePath := filepath.Join(tmpDir, "mail.eml")
+		if err := os.WriteFile(filePath, []byte(eml), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		result, err := s.ScanWithOptions(filePath, "test-id-"+string(profile), "mail.eml", int64(len(eml)), ScanOptions{Profile: profile})
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		return result
+	}
+
+	// fast leaves the attachment to the engine, which cannot see it encoded
+	if result := scan(config.ProfileFast); result.Status != drivers.StatusClean || len(result.Children) != 0 || result.Profile != config.ProfileFast {
+		t.Errorf("expected a clean fast scan without members, got %+v", result)
+	}
+	if result := scan(config.ProfileStandard); result.Status != drivers.StatusInfected {
+		t.Errorf("expected the attachment to be scanned, got %s", result.Status)
+	}
+	s.config.ScanProfileThoroughDepth = 0
+	if result := scan(config.ProfileThorough); !slices.Contains(result.Findings, "nesting:max-depth-exceeded") {
+		t.Errorf("expected thorough to use its own nesting depth, got %+v", result)
+	}
+
+	driverCfg := config.DriverConfig{FastFlags: []string{"--fast"}, ThoroughFlags: []string{"--heuristics"}}
+	if opts := engineOptions(driverCfg, config.ProfileThorough, false); !opts.Deep || !slices.Equal(opts.Flags, driverCfg.ThoroughFlags) {
+		t.Errorf("expected a deep scan with the thorough flags, got %+v", opts)
+	}
+	if opts := engineOptions(driverCfg, config.ProfileFast, true); !opts.Deep || !slices.Equal(opts.Flags, driverCfg.FastFlags) {
+		t.Errorf("expected a policy deep scan to stay deep under fast, got %+v", opts)
+	}
+}
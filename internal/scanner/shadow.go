@@ -0,0 +1,128 @@
+package scanner
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// Shadow scans send a sample of uploads to a second (canary) engine to
+// evaluate it against production traffic. The canary's verdict is only
+// logged and counted; it never changes the response.
+
+// shadowScan is the canary engine's verdict for one upload
+type shadowScan struct {
+	status    drivers.ScanStatus
+	signature string
+	err       error
+}
+
+// startShadowScan copies a sampled upload and scans the copy with the shadow
+// engine in the background. It returns nil if the upload is not sampled.
+func (s *Scanner) startShadowScan(filePath, fileID string) <-chan *shadowScan {
+	if s.shadow == nil || rand.Intn(100) >= s.config.ShadowPercent {
+		return nil
+	}
+
+	// The primary engine (or RTS) removes the original, so scan a copy where
+	// the shadow engine's on-access scanner watches
+	shadowDir := s.config.EngineUploadDir(s.shadow.Engine())
+	shadowPath := filepath.Join(shadowDir, "shadow-"+fileID+filepath.Ext(filePath))
+	if err := os.MkdirAll(shadowDir, 0755); err != nil {
+		s.logger.Warn("Failed to create shadow upload directory", "fileId", fileID, "error", err)
+		return nil
+	}
+	if err := s.copyUpload(filePath, shadowPath); err != nil {
+		s.logger.Warn("Failed to copy file for shadow scan", "fileId", fileID, "error", err)
+		return nil
+	}
+
+	done := make(chan *shadowScan, 1)
+	go func() {
+		defer s.uploads.Remove(shadowPath)
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &shadowScan{status: drivers.StatusError, err: s.recovered("shadow", r, "fileId", fileID)}
+			}
+		}()
+		done <- s.runShadowScan(shadowPath)
+	}()
+	return done
+}
+
+func (s *Scanner) runShadowScan(shadowPath string) *shadowScan {
+	result, err := s.shadow.ManualScan(shadowPath, drivers.ScanOptions{})
+	if err == nil && (result.Status == drivers.StatusClean || result.Status == drivers.StatusInfected) {
+		return &shadowScan{status: result.Status, signature: result.Signature}
+	}
+
+	// The copy may have been quarantined by the shadow engine's RTS
+	absPath, _ := filepath.Abs(shadowPath)
+	if cached, found := s.shadowCache.Get(absPath); found && cached.Status == "infected" {
+		return &shadowScan{status: drivers.StatusInfected, signature: cached.Signature}
+	}
+	if err == nil {
+		err = os.ErrInvalid
+	}
+	return &shadowScan{status: drivers.StatusError, err: err}
+}
+
+// compareShadowScan waits for the shadow verdict and records whether it
+// agrees with the primary engine
+func (s *Scanner) compareShadowScan(fileID string, primary config.EngineType, status drivers.ScanStatus, signature string, shadowResult <-chan *shadowScan) {
+	shadow := <-shadowResult
+	outcome := shadowOutcome(status, shadow.status)
+	metrics.RecordShadowScan(string(primary), string(s.shadow.Engine()), outcome)
+
+	switch outcome {
+	case "disagree":
+		s.logger.Warn("Shadow engine verdict differs",
+			"fileId", fileID,
+			"engine", primary,
+			"status", status,
+			"signature", signature,
+			"shadowEngine", s.shadow.Engine(),
+			"shadowStatus", shadow.status,
+			"shadowSignature", shadow.signature,
+		)
+	case "error":
+		s.logger.Warn("Shadow scan failed", "fileId", fileID, "shadowEngine", s.shadow.Engine(), "error", shadow.err)
+	}
+}
+
+// shadowOutcome classifies a pair of verdicts as agree, disagree or error
+func shadowOutcome(primary, shadow drivers.ScanStatus) string {
+	switch {
+	case shadow == drivers.StatusError:
+		return "error"
+	case primary == shadow:
+		return "agree"
+	default:
+		return "disagree"
+	}
+}
+
+// copyUpload copies the upload at src to a new upload at dst
+func (s *Scanner) copyUpload(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := s.uploads.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		s.uploads.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
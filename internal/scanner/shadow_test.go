@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/cache"
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+func TestShadowOutcome(t *testing.T) {
+	tests := []struct {
+		primary, shadow drivers.ScanStatus
+		expected        string
+	}{
+		{drivers.StatusClean, drivers.StatusClean, "agree"},
+		{drivers.StatusInfected, drivers.StatusInfected, "agree"},
+		{drivers.StatusClean, drivers.StatusInfected, "disagree"},
+		{drivers.StatusInfected, drivers.StatusClean, "disagree"},
+		{drivers.StatusInfected, drivers.StatusError, "error"},
+	}
+
+	for _, tt := range tests {
+		if got := shadowOutcome(tt.primary, tt.shadow); got != tt.expected {
+			t.Errorf("shadowOutcome(%s, %s) = %s, expected %s", tt.primary, tt.shadow, got, tt.expected)
+		}
+	}
+}
+
+func TestScanner_ShadowScan(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	s.shadowCache = cache.NewDetectionCache(cache.DefaultTTL)
+	s.shadow = drivers.NewMockDriver(config.DriverConfig{Engine: config.EngineMock})
+	s.config.ShadowPercent = 100
+
+	filePath := filepath.Join(tmpDir, "eicar.com")
+	if err := os.WriteFile(filePath, []byte(drivers.EICARPattern()), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	shadowResult := s.startShadowScan(filePath, "test-id-shadow")
+	if shadowResult == nil {
+		t.Fatal("expected upload to be sampled")
+	}
+	shadow := <-shadowResult
+	if shadow.status != drivers.StatusInfected || shadow.signature != drivers.EICARSignature {
+		t.Errorf("unexpected shadow verdict: %+v", shadow)
+	}
+
+	// Only the copy is removed
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("expected original to remain: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "shadow-test-id-shadow.com")); !os.IsNotExist(err) {
+		t.Errorf("expected shadow copy to be removed")
+	}
+
+	s.config.ShadowPercent = 0
+	if s.startShadowScan(filePath, "test-id-unsampled") != nil {
+		t.Error("expected no shadow scan at 0%")
+	}
+}
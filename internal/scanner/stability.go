@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// EngineStability counts an engine's daemon restarts and failed scans within
+// the crash loop window, so a flaky engine can be told apart from a broken
+// scanner
+type EngineStability struct {
+	Restarts      int        `json:"restarts"`
+	Failures      int        `json:"failures"`
+	CrashLooping  bool       `json:"crashLooping"`
+	LastRestart   *time.Time `json:"lastRestart,omitempty"`
+	LastFailure   *time.Time `json:"lastFailure,omitempty"`
+	WindowSeconds int        `json:"windowSeconds"`
+}
+
+type engineEvents struct {
+	restarts []time.Time // oldest first
+	failures []time.Time
+	looping  bool
+}
+
+// stabilityTracker keeps recent restarts and failures per engine
+type stabilityTracker struct {
+	mu     sync.Mutex
+	events map[config.EngineType]*engineEvents
+}
+
+// watchRestarts reports the driver's daemon restarts, if it can detect them.
+// Call before the driver starts.
+func (s *Scanner) watchRestarts(driver drivers.Driver) {
+	reporter, ok := driver.(drivers.RestartReporter)
+	if !ok {
+		return
+	}
+	engine := driver.Engine()
+	reporter.OnRestart(func(at time.Time) {
+		metrics.RecordEngineRestart(string(engine))
+		s.recordStability(engine, func(e *engineEvents) { e.restarts = append(e.restarts, at) })
+	})
+}
+
+// recordEngineFailure counts a scan the engine could not complete although
+// the file was still there
+func (s *Scanner) recordEngineFailure(engine config.EngineType) {
+	metrics.RecordEngineFailure(string(engine))
+	now := time.Now()
+	s.recordStability(engine, func(e *engineEvents) { e.failures = append(e.failures, now) })
+}
+
+func (s *Scanner) recordStability(engine config.EngineType, record func(*engineEvents)) {
+	s.stability.mu.Lock()
+	if s.stability.events == nil {
+		s.stability.events = make(map[config.EngineType]*engineEvents)
+	}
+	events := s.stability.events[engine]
+	if events == nil {
+		events = &engineEvents{}
+		s.stability.events[engine] = events
+	}
+	record(events)
+	s.stability.mu.Unlock()
+
+	s.EngineStability(engine)
+}
+
+// EngineStability returns an engine's restarts and failures within
+// ENGINE_CRASH_LOOP_WINDOW. Entering or leaving a crash loop is logged.
+func (s *Scanner) EngineStability(engine config.EngineType) *EngineStability {
+	window := time.Duration(s.config.CrashLoopWindow) * time.Millisecond
+	stability := &EngineStability{WindowSeconds: int(window.Seconds())}
+
+	s.stability.mu.Lock()
+	defer s.stability.mu.Unlock()
+	events := s.stability.events[engine]
+	if events == nil {
+		return stability
+	}
+
+	cutoff := time.Now().Add(-window)
+	events.restarts = trimBefore(events.restarts, cutoff)
+	events.failures = trimBefore(events.failures, cutoff)
+	stability.Restarts = len(events.restarts)
+	stability.Failures = len(events.failures)
+	if n := len(events.restarts); n > 0 {
+		last := events.restarts[n-1]
+		stability.LastRestart = &last
+	}
+	if n := len(events.failures); n > 0 {
+		last := events.failures[n-1]
+		stability.LastFailure = &last
+	}
+
+	threshold := s.config.CrashLoopThreshold
+	stability.CrashLooping = threshold > 0 && (stability.Restarts >= threshold || stability.Failures >= threshold)
+	if stability.CrashLooping != events.looping {
+		events.looping = stability.CrashLooping
+		metrics.SetEngineCrashLooping(string(engine), stability.CrashLooping)
+		if stability.CrashLooping {
+			s.logger.Warn("Engine is crash-looping", "engine", engine, "restarts", stability.Restarts, "failures", stability.Failures, "window", window)
+		} else {
+			s.logger.Info("Engine recovered from crash loop", "engine", engine)
+		}
+	}
+	return stability
+}
+
+// trimBefore drops the times before cutoff, reusing the slice
+func trimBefore(times []time.Time, cutoff time.Time) []time.Time {
+	kept := times[:0]
+	for _, t := range times {
+		if !t.Before(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// restartingDriver reports restarts through the handler the scanner sets
+type restartingDriver struct {
+	drivers.Driver
+	onRestart func(at time.Time)
+}
+
+func (d *restartingDriver) Engine() config.EngineType { return config.EngineClamAV }
+
+func (d *restartingDriver) OnRestart(handler func(at time.Time)) { d.onRestart = handler }
+
+func TestScanner_EngineStability(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+	s.config.CrashLoopThreshold = 2
+	s.config.CrashLoopWindow = 60000
+
+	driver := &restartingDriver{}
+	s.watchRestarts(driver)
+
+	// A restart outside the window does not count
+	driver.onRestart(time.Now().Add(-2 * time.Minute))
+	driver.onRestart(time.Now())
+	stability := s.EngineStability(config.EngineClamAV)
+	if stability.Restarts != 1 || stability.CrashLooping || stability.LastRestart == nil {
+		t.Fatalf("expected one recent restart, got %+v", stability)
+	}
+
+	driver.onRestart(time.Now())
+	if stability := s.EngineStability(config.EngineClamAV); stability.Restarts != 2 || !stability.CrashLooping {
+		t.Errorf("expected a crash loop after two restarts, got %+v", stability)
+	}
+
+	s.recordEngineFailure(config.EngineMock)
+	stability = s.EngineStability(config.EngineMock)
+	if stability.Failures != 1 || stability.Restarts != 0 || stability.CrashLooping {
+		t.Errorf("expected one failure, got %+v", stability)
+	}
+
+	s.config.CrashLoopThreshold = 0
+	if s.EngineStability(config.EngineClamAV).CrashLooping {
+		t.Error("expected crash loop detection to be disabled")
+	}
+}
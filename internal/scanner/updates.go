@@ -0,0 +1,244 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/metrics"
+)
+
+// UpdateStatus is how far a requested signature update has got
+type UpdateStatus string
+
+const (
+	UpdateRunning   UpdateStatus = "running"
+	UpdateSucceeded UpdateStatus = "succeeded"
+	UpdateFailed    UpdateStatus = "failed"
+)
+
+// maxUpdateOutputLines bounds the update command output kept as progress
+const maxUpdateOutputLines = 50
+
+var (
+	ErrUpdateRunning     = errors.New("engine update already running")
+	ErrUpdateUnsupported = errors.New("engine has no update command")
+)
+
+// EngineUpdate is the progress and outcome of a signature update requested
+// through the API
+type EngineUpdate struct {
+	Engine      config.EngineType  `json:"engine"`
+	Status      UpdateStatus       `json:"status"`
+	StartedAt   time.Time          `json:"startedAt"`
+	CompletedAt *time.Time         `json:"completedAt,omitempty"`
+	Output      []string           `json:"output"` // last lines the update command printed
+	Error       string             `json:"error,omitempty"`
+	Definitions *DefinitionsUpdate `json:"definitions,omitempty"` // set when the active engine was updated
+
+	// The standby definition set the command wrote to; it is not reloaded
+	// until switched to
+	DefinitionSet string `json:"definitionSet,omitempty"`
+}
+
+type updatesState struct {
+	mu       sync.Mutex
+	byEngine map[config.EngineType]*EngineUpdate
+}
+
+// StartEngineUpdate runs the engine's update command, e.g. freshclam, in the
+// background and returns its initial state; poll EngineUpdateStatus for
+// progress. Once the command succeeds the engine reloads its signatures and,
+// if it is the active engine, the update is handled as DefinitionsUpdated
+// does. A command with {standby} instead writes to the definition set the
+// engine is not loading, which SwitchDefinitionSet then rolls out. One update
+// per engine runs at a time.
+func (s *Scanner) StartEngineUpdate(engine config.EngineType) (*EngineUpdate, error) {
+	// Engines that are configured but not loaded are updated too, so
+	// switching to them later uses current signatures
+	driverCfg, reloader, err := s.engineConfig(engine)
+	if err != nil {
+		return nil, err
+	}
+	if len(driverCfg.UpdateCommand) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUpdateUnsupported, engine)
+	}
+
+	standby := ""
+	if _, ok := standbyCommand(driverCfg.UpdateCommand, ""); ok {
+		s.definitionSets.mu.Lock()
+		defer s.definitionSets.mu.Unlock()
+		if standby, err = standbyDefinitionSet(driverCfg); err != nil {
+			return nil, err
+		}
+		driverCfg.UpdateCommand, _ = standbyCommand(driverCfg.UpdateCommand, standby)
+		reloader = nil
+	}
+
+	s.updates.mu.Lock()
+	defer s.updates.mu.Unlock()
+	if current := s.updates.byEngine[engine]; current != nil && current.Status == UpdateRunning {
+		return nil, fmt.Errorf("%w since %s", ErrUpdateRunning, current.StartedAt.Format(time.RFC3339))
+	}
+	if s.updates.byEngine == nil {
+		s.updates.byEngine = make(map[config.EngineType]*EngineUpdate)
+	}
+	update := &EngineUpdate{
+		Engine:    engine,
+		Status:    UpdateRunning,
+		StartedAt: time.Now(),
+		Output:    []string{},
+	}
+	if standby != "" {
+		update.DefinitionSet = filepath.Base(standby)
+	}
+	s.updates.byEngine[engine] = update
+
+	s.logger.Info("Engine update started", "engine", engine, "command", driverCfg.UpdateCommand)
+	go s.runEngineUpdate(driverCfg, reloader, update)
+	return update.snapshot(), nil
+}
+
+// engineConfig returns a configured engine's driver config and, if it is
+// loaded and implements drivers.Reloader, its driver
+func (s *Scanner) engineConfig(engine config.EngineType) (config.DriverConfig, drivers.Reloader, error) {
+	driverCfg, configured := s.config.Drivers[engine]
+	var reloader drivers.Reloader
+	if driver, _ := s.engineDriver(engine); driver != nil {
+		driverCfg, configured = driver.Config(), true
+		reloader, _ = driver.(drivers.Reloader)
+	}
+	if !configured {
+		return config.DriverConfig{}, nil, fmt.Errorf("%w: %s", ErrUnknownEngine, engine)
+	}
+	return driverCfg, reloader, nil
+}
+
+// EngineUpdateStatus returns the engine's latest requested update, or nil if
+// none
+func (s *Scanner) EngineUpdateStatus(engine config.EngineType) *EngineUpdate {
+	s.updates.mu.Lock()
+	defer s.updates.mu.Unlock()
+	if update := s.updates.byEngine[engine]; update != nil {
+		return update.snapshot()
+	}
+	return nil
+}
+
+// runEngineUpdate runs the update command, then has the engine reload its
+// signatures if it is loaded and implements drivers.Reloader
+func (s *Scanner) runEngineUpdate(driverCfg config.DriverConfig, reloader drivers.Reloader, update *EngineUpdate) {
+	ctx := context.Background()
+	if timeout := driverCfg.UpdateTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	// One writer for both streams, so exec interleaves them in order
+	output := &updateOutput{state: &s.updates, update: update}
+	command := driverCfg.UpdateCommand
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+	output.flush()
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("update command timed out after %dms", driverCfg.UpdateTimeout)
+	case err != nil:
+		err = fmt.Errorf("update command failed: %w", err)
+	}
+	if reloader != nil && err == nil {
+		if reloadErr := reloader.Reload(); reloadErr != nil {
+			err = fmt.Errorf("signature reload failed: %w", reloadErr)
+		}
+	}
+
+	var definitions *DefinitionsUpdate
+	if err == nil && update.Engine == s.ActiveEngine() && update.DefinitionSet == "" {
+		definitions = s.DefinitionsUpdated("")
+		if !definitions.SelfTest.Passed {
+			err = errors.New("self-test scan failed after update")
+		}
+	}
+
+	s.updates.mu.Lock()
+	now := time.Now()
+	update.CompletedAt = &now
+	update.Definitions = definitions
+	update.Status = UpdateSucceeded
+	if err != nil {
+		update.Status = UpdateFailed
+		update.Error = err.Error()
+	}
+	s.updates.mu.Unlock()
+
+	metrics.RecordEngineUpdate(string(update.Engine), string(update.Status))
+	if err != nil {
+		s.logger.Error("Engine update failed", "engine", update.Engine, "error", err)
+		return
+	}
+	s.logger.Info("Engine update finished", "engine", update.Engine, "duration", now.Sub(update.StartedAt))
+}
+
+// snapshot copies the update so it can be read without the lock; call with
+// the lock held
+func (u *EngineUpdate) snapshot() *EngineUpdate {
+	copied := *u
+	copied.Output = slices.Clone(u.Output)
+	return &copied
+}
+
+// updateOutput records an update command's output lines as its progress.
+// Carriage returns end lines too, as download progress bars use them.
+type updateOutput struct {
+	state   *updatesState
+	update  *EngineUpdate
+	partial []byte
+}
+
+func (o *updateOutput) Write(p []byte) (int, error) {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+
+	o.partial = append(o.partial, p...)
+	for {
+		i := bytes.IndexAny(o.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		o.addLine(string(o.partial[:i]))
+		o.partial = o.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush records output left without a final newline
+func (o *updateOutput) flush() {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+	o.addLine(string(o.partial))
+	o.partial = nil
+}
+
+func (o *updateOutput) addLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	o.update.Output = append(o.update.Output, line)
+	if excess := len(o.update.Output) - maxUpdateOutputLines; excess > 0 {
+		o.update.Output = slices.Delete(o.update.Output, 0, excess)
+	}
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// waitForUpdate polls until the engine's update is no longer running
+func waitForUpdate(t *testing.T, s *Scanner, engine config.EngineType) *EngineUpdate {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		update := s.EngineUpdateStatus(engine)
+		if update != nil && update.Status != UpdateRunning {
+			return update
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("update still running: %+v", update)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScanner_EngineUpdate(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	updater := filepath.Join(tmpDir, "freshclam")
+	os.WriteFile(updater, []byte("#!/bin/sh\necho 'daily.cvd updated'\nprintf 'Downloading 50%%\\rDownloading 100%%\\n' >&2\n[ \"$1\" = ok ]\n"), 0755)
+	useUpdater := func(args ...string) {
+		s.drivers[config.EngineMock] = drivers.NewMockDriver(config.DriverConfig{
+			Engine:        config.EngineMock,
+			UpdateCommand: append([]string{updater}, args...),
+			UpdateTimeout: 5000,
+		})
+	}
+
+	useUpdater("ok")
+	if _, err := s.StartEngineUpdate(config.EngineMock); err != nil {
+		t.Fatalf("failed to start update: %v", err)
+	}
+	update := waitForUpdate(t, s, config.EngineMock)
+	if update.Status != UpdateSucceeded || update.CompletedAt == nil {
+		t.Errorf("expected the update to succeed, got %+v", update)
+	}
+	if want := []string{"daily.cvd updated", "Downloading 50%", "Downloading 100%"}; len(update.Output) != len(want) || update.Output[2] != want[2] {
+		t.Errorf("expected output %q, got %q", want, update.Output)
+	}
+	if update.Definitions == nil || !update.Definitions.SelfTest.Passed {
+		t.Errorf("expected the active engine's definitions to be re-checked, got %+v", update.Definitions)
+	}
+
+	useUpdater("fail")
+	s.StartEngineUpdate(config.EngineMock)
+	if update := waitForUpdate(t, s, config.EngineMock); update.Status != UpdateFailed || update.Error == "" || update.Definitions != nil {
+		t.Errorf("expected a failed update, got %+v", update)
+	}
+
+	if _, err := s.StartEngineUpdate(config.EngineTrendMicro); !errors.Is(err, ErrUpdateUnsupported) {
+		t.Errorf("expected ErrUpdateUnsupported without an update command, got %v", err)
+	}
+	if _, err := s.StartEngineUpdate("bogus"); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("expected ErrUnknownEngine, got %v", err)
+	}
+}
+
+func TestScanner_EngineUpdateAlreadyRunning(t *testing.T) {
+	s, tmpDir := newTestScanner(t)
+	defer os.RemoveAll(tmpDir)
+	defer s.Stop()
+
+	s.drivers[config.EngineMock] = drivers.NewMockDriver(config.DriverConfig{
+		Engine:        config.EngineMock,
+		UpdateCommand: []string{"sleep", "5"},
+		UpdateTimeout: 200,
+	})
+	if _, err := s.StartEngineUpdate(config.EngineMock); err != nil {
+		t.Fatalf("failed to start update: %v", err)
+	}
+	if _, err := s.StartEngineUpdate(config.EngineMock); !errors.Is(err, ErrUpdateRunning) {
+		t.Errorf("expected ErrUpdateRunning, got %v", err)
+	}
+	if update := waitForUpdate(t, s, config.EngineMock); update.Status != UpdateFailed {
+		t.Errorf("expected the update to time out, got %+v", update)
+	}
+}
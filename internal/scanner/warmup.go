@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+)
+
+// warmUpProbe is the benign content scanned at startup
+const warmUpProbe = "av-scanner warm-up probe\n"
+
+// WarmUp scans a benign probe file with every engine, so daemons load their
+// definitions into memory before the first upload has to wait for it. Engines
+// are warmed concurrently; failures are logged and do not hold readiness
+// back, since health checks report broken engines.
+func (s *Scanner) WarmUp() {
+	defer s.warmedUp.Store(true)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for _, engine := range s.Engines() {
+		driver, _ := s.engineDriver(engine)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.warmUpEngine(engine, driver)
+		}()
+	}
+	wg.Wait()
+	s.logger.Info("Engines warmed up", "duration", time.Since(start).Milliseconds())
+}
+
+func (s *Scanner) warmUpEngine(engine config.EngineType, driver drivers.Driver) {
+	start := time.Now()
+	fileID := s.GenerateFileID()
+	dir := s.config.EngineUploadDir(engine)
+	filePath := filepath.Join(dir, "warmup-"+fileID+".txt")
+
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.WriteFile(filePath, []byte(warmUpProbe), 0644)
+	}
+	if err != nil {
+		s.logger.Warn("Engine warm-up failed", "engine", engine, "error", err)
+		return
+	}
+	defer s.deleteFile(filePath, fileID)
+
+	result, err := driver.ManualScan(filePath, drivers.ScanOptions{})
+	switch {
+	case err != nil:
+		s.logger.Warn("Engine warm-up failed", "engine", engine, "error", err)
+	case result.Status != drivers.StatusClean:
+		s.logger.Warn("Engine warm-up scan was not clean", "engine", engine, "status", result.Status)
+	default:
+		s.logger.Info("Engine warmed up", "engine", engine, "duration", time.Since(start).Milliseconds())
+	}
+}
+
+// WarmedUp reports whether the startup warm-up scan has finished, or was
+// disabled with WARMUP_SCAN=false
+func (s *Scanner) WarmedUp() bool {
+	return s.warmedUp.Load()
+}
@@ -0,0 +1,392 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/objectstore"
+	"github.com/rophy/av-scanner/internal/scanner"
+	"github.com/rophy/av-scanner/internal/tracing"
+)
+
+// Job is a recurring scan of a directory tree or of the objects in a bucket
+type Job struct {
+	Name   string `yaml:"name"`
+	Cron   string `yaml:"cron"`
+	Path   string `yaml:"path,omitempty"`   // local directory to scan
+	Bucket string `yaml:"bucket,omitempty"` // or bucket on the first OBJECT_STORE_ENDPOINTS entry
+	Prefix string `yaml:"prefix,omitempty"` // only objects whose keys start with it
+	Notify string `yaml:"notify,omitempty"` // webhook URL that receives the run report
+
+	cron *Cron
+}
+
+// target is where the job scans, as shown in reports
+func (j Job) target() string {
+	if j.Bucket != "" {
+		return "s3://" + j.Bucket + "/" + j.Prefix
+	}
+	return j.Path
+}
+
+// ScheduleConfig represents the YAML structure of the schedule file
+type ScheduleConfig struct {
+	Jobs []Job `yaml:"jobs"`
+}
+
+// Detection is a file in a run report that did not come back clean
+type Detection = bulkscan.Detection
+
+// Report summarizes one run of a job; it is logged and sent to the job's
+// notification target
+type Report struct {
+	RequestID  string      `json:"requestId"`
+	TraceID    string      `json:"traceId"`
+	Job        string      `json:"job"`
+	Path       string      `json:"path"`
+	StartedAt  time.Time   `json:"startedAt"`
+	Duration   int64       `json:"duration"` // milliseconds
+	Scanned    int         `json:"scanned"`
+	Infected   int         `json:"infected"`
+	Suspicious int         `json:"suspicious"`
+	Errors     int         `json:"errors"`
+	Skipped    int         `json:"skipped"` // device files, FIFOs, sockets, sparse and oversized files
+	Detections []Detection `json:"detections,omitempty"`
+	Error      string      `json:"error,omitempty"` // why the run ended early, e.g. a failed bucket listing
+}
+
+// record counts one file's outcome
+func (r *Report) record(path string, result *scanner.ScanResponse, err error) {
+	if err == nil && bulkscan.SkipReason(result) != "" {
+		r.Skipped++
+		return
+	}
+	r.Scanned++
+	if err != nil {
+		r.Errors++
+		r.Detections = append(r.Detections, Detection{Path: path, Status: drivers.StatusError, Error: err.Error()})
+		return
+	}
+	switch result.Status {
+	case drivers.StatusInfected:
+		r.Infected++
+	case drivers.StatusSuspicious:
+		r.Suspicious++
+	case drivers.StatusError:
+		r.Errors++
+	default:
+		return
+	}
+	r.Detections = append(r.Detections, Detection{Path: path, Status: result.Status, Signature: result.Signature})
+}
+
+// historySize is how many reports are kept per job
+const historySize = 10
+
+// JobStatus is a job's schedule and its most recent runs
+type JobStatus struct {
+	Name    string     `json:"name"`
+	Cron    string     `json:"cron"`
+	Path    string     `json:"path,omitempty"`
+	Bucket  string     `json:"bucket,omitempty"`
+	Prefix  string     `json:"prefix,omitempty"`
+	Notify  bool       `json:"notify"` // the URL may carry credentials, so it is not shown
+	NextRun *time.Time `json:"nextRun,omitempty"`
+	Running bool       `json:"running"`
+	Runs    []*Report  `json:"runs"` // newest first
+}
+
+// Load reads a schedule file. An empty path returns no jobs.
+func Load(filePath string) ([]Job, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule file: %w", err)
+	}
+
+	var config ScheduleConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule file: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Jobs {
+		job := &config.Jobs[i]
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("job-%d", i+1)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("job %q: duplicate name", job.Name)
+		}
+		names[job.Name] = true
+
+		if job.cron, err = ParseCron(job.Cron); err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		switch {
+		case (job.Path == "") == (job.Bucket == ""):
+			return nil, fmt.Errorf("job %q: exactly one of path and bucket is required", job.Name)
+		case strings.Contains(job.Path, "://"):
+			return nil, fmt.Errorf("job %q: path must be a local directory, got %q; use bucket for object stores", job.Name, job.Path)
+		case job.Bucket != "":
+			if err := objectstore.CheckRef(job.Bucket, "-"); err != nil {
+				return nil, fmt.Errorf("job %q: %w", job.Name, err)
+			}
+		case job.Prefix != "":
+			return nil, fmt.Errorf("job %q: prefix requires bucket", job.Name)
+		}
+		if job.Notify != "" {
+			u, err := url.Parse(job.Notify)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("job %q: notify must be an http(s) URL", job.Name)
+			}
+		}
+	}
+
+	return config.Jobs, nil
+}
+
+// Scheduler runs jobs on their cron schedules. A job that is still running
+// when it is next due skips that activation.
+type Scheduler struct {
+	jobs    []Job
+	scanner *scanner.Scanner
+	logger  *slog.Logger
+	client  *http.Client
+	now     func() time.Time
+
+	objects  *objectstore.S3 // nil when bucket jobs cannot run
+	endpoint string
+	maxSize  int64
+
+	mu      sync.Mutex
+	running map[string]bool
+	runs    map[string][]*Report // newest first, up to historySize
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a scheduler for jobs returned by Load
+func New(jobs []Job, s *scanner.Scanner, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		jobs:    jobs,
+		scanner: s,
+		logger:  logger,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+		running: make(map[string]bool),
+		runs:    make(map[string][]*Report),
+		stop:    make(chan struct{}),
+	}
+}
+
+// SetObjectStore lets bucket jobs download from endpoint. Objects larger
+// than maxSize are reported as skipped.
+func (s *Scheduler) SetObjectStore(store *objectstore.S3, endpoint string, maxSize int64) {
+	s.objects = store
+	s.endpoint = endpoint
+	s.maxSize = maxSize
+}
+
+// Status returns every job with its next activation and recent runs
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := JobStatus{
+			Name:    job.Name,
+			Cron:    job.Cron,
+			Path:    job.Path,
+			Bucket:  job.Bucket,
+			Prefix:  job.Prefix,
+			Notify:  job.Notify != "",
+			Running: s.running[job.Name],
+			Runs:    append([]*Report{}, s.runs[job.Name]...),
+		}
+		if next := job.cron.Next(s.now()); !next.IsZero() {
+			status.NextRun = &next
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Start launches one goroutine per job
+func (s *Scheduler) Start() {
+	for i := range s.jobs {
+		job := s.jobs[i]
+		s.logger.Info("Scheduled scan registered",
+			"job", job.Name,
+			"cron", job.Cron,
+			"target", job.target(),
+			"next", job.cron.Next(s.now()),
+		)
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+}
+
+// Stop cancels pending activations and waits for running jobs to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(job Job) {
+	defer s.wg.Done()
+	for {
+		next := job.cron.Next(s.now())
+		if next.IsZero() {
+			s.logger.Warn("Scheduled scan never fires", "job", job.Name, "cron", job.Cron)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.Run(job)
+		}
+	}
+}
+
+// Run executes a job once, logs the report, keeps it for Status and sends it
+// to the job's notification target
+func (s *Scheduler) Run(job Job) *Report {
+	// Each run starts a trace that the notification target can join on
+	trace := tracing.New()
+	report := &Report{
+		RequestID: trace.RequestID,
+		TraceID:   trace.TraceID(),
+		Job:       job.Name,
+		Path:      job.target(),
+		StartedAt: s.now(),
+	}
+	s.logger.Info("Scheduled scan started", "job", job.Name, "target", report.Path, "requestId", trace.RequestID)
+	s.mu.Lock()
+	s.running[job.Name] = true
+	s.mu.Unlock()
+
+	if job.Bucket != "" {
+		if err := s.walkBucket(job, report.record); err != nil {
+			report.Error = err.Error()
+		}
+	} else {
+		bulkscan.Walk(s.scanner, job.Path, report.record)
+	}
+	report.Duration = time.Since(report.StartedAt).Milliseconds()
+
+	s.logger.Info("Scheduled scan completed",
+		"job", job.Name,
+		"scanned", report.Scanned,
+		"infected", report.Infected,
+		"suspicious", report.Suspicious,
+		"errors", report.Errors,
+		"duration", report.Duration,
+		"error", report.Error,
+	)
+	s.mu.Lock()
+	s.running[job.Name] = false
+	runs := append([]*Report{report}, s.runs[job.Name]...)
+	if len(runs) > historySize {
+		runs = runs[:historySize]
+	}
+	s.runs[job.Name] = runs
+	s.mu.Unlock()
+
+	if job.Notify != "" {
+		if err := s.notify(job.Notify, trace, report); err != nil {
+			s.logger.Error("Failed to send scheduled scan report", "job", job.Name, "error", err)
+		}
+	}
+	return report
+}
+
+// walkBucket scans the objects of a bucket job, reporting each to fn like
+// bulkscan.Walk. Objects are streamed into the upload directory and never
+// modified in the bucket. Listing stops when the scheduler stops.
+func (s *Scheduler) walkBucket(job Job, fn func(path string, result *scanner.ScanResponse, err error)) error {
+	if s.objects == nil {
+		return errors.New("bucket jobs require OBJECT_STORE_ENDPOINTS")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return s.objects.List(ctx, s.endpoint, job.Bucket, job.Prefix, func(info objectstore.ObjectInfo) error {
+		name := "s3://" + job.Bucket + "/" + info.Key
+		if strings.HasSuffix(info.Key, "/") {
+			// Folder placeholder
+			return nil
+		}
+		if info.Size > s.maxSize {
+			fn(name, &scanner.ScanResponse{Status: drivers.StatusSkipped, Findings: []string{"skipped:too-large"}}, nil)
+			return nil
+		}
+		obj, err := s.objects.Get(ctx, s.endpoint, job.Bucket, info.Key)
+		if errors.Is(err, objectstore.ErrNotFound) {
+			// Deleted since it was listed
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fn(name, nil, err)
+			return nil
+		}
+		result, err := bulkscan.ScanReader(s.scanner, obj.Body, path.Base(info.Key))
+		obj.Body.Close()
+		fn(name, result, err)
+		return nil
+	})
+}
+
+func (s *Scheduler) notify(target string, trace tracing.Context, report *Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	trace.Inject(req.Header)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification target returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/drivers"
+	"github.com/rophy/av-scanner/internal/objectstore"
+	"github.com/rophy/av-scanner/internal/scanner"
+)
+
+func writeSchedule(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schedule.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write schedule file: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	jobs, err := Load(writeSchedule(t, `
+jobs:
+  - name: nightly
+    cron: "0 2 * * *"
+    path: /srv/data
+    notify: https://hooks.example.com/av
+  - cron: "@hourly"
+    path: /srv/inbox
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+	if jobs[0].Name != "nightly" || jobs[1].Name != "job-2" {
+		t.Errorf("unexpected job names: %q, %q", jobs[0].Name, jobs[1].Name)
+	}
+}
+
+func TestLoad_EmptyPath(t *testing.T) {
+	jobs, err := Load("")
+	if err != nil || jobs != nil {
+		t.Errorf("expected no jobs and no error, got %v, %v", jobs, err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"bad cron":        "jobs:\n  - cron: \"61 * * * *\"\n    path: /srv\n",
+		"missing path":    "jobs:\n  - cron: \"@daily\"\n",
+		"remote path":     "jobs:\n  - cron: \"@daily\"\n    path: s3://bucket/prefix\n",
+		"bad notify":      "jobs:\n  - cron: \"@daily\"\n    path: /srv\n    notify: ftp://example.com\n",
+		"path and bucket": "jobs:\n  - cron: \"@daily\"\n    path: /srv\n    bucket: uploads\n",
+		"bad bucket":      "jobs:\n  - cron: \"@daily\"\n    bucket: Uploads!\n",
+		"prefix only":     "jobs:\n  - cron: \"@daily\"\n    path: /srv\n    prefix: reports/\n",
+		"duplicate name":  "jobs:\n  - name: a\n    cron: \"@daily\"\n    path: /srv\n  - name: a\n    cron: \"@daily\"\n    path: /srv\n",
+	}
+	for name, content := range tests {
+		if _, err := Load(writeSchedule(t, content)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	scanDir := t.TempDir()
+	os.WriteFile(filepath.Join(scanDir, "clean.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(scanDir, "eicar.com"), []byte(drivers.EICARPattern()), 0644)
+
+	var received Report
+	var requestID string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get("X-Request-ID")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode report: %v", err)
+		}
+	}))
+	defer hook.Close()
+
+	jobs, err := Load(writeSchedule(t, "jobs:\n  - name: test\n    cron: \"@daily\"\n    path: "+scanDir+"\n    notify: "+hook.URL+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scanner.New(cfg, logger)
+	defer s.Stop()
+
+	report := New(jobs, s, logger).Run(jobs[0])
+	if report.Scanned != 2 || report.Infected != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(report.Detections) != 1 || filepath.Base(report.Detections[0].Path) != "eicar.com" {
+		t.Errorf("unexpected detections: %+v", report.Detections)
+	}
+	if received.Job != "test" || received.Infected != 1 {
+		t.Errorf("unexpected notification: %+v", received)
+	}
+	if requestID == "" || requestID != received.RequestID {
+		t.Errorf("expected X-Request-ID %q to match report, got %q", received.RequestID, requestID)
+	}
+}
+
+func TestScheduler_RunBucket(t *testing.T) {
+	objects := map[string]string{
+		"reports/a.txt":     "hello",
+		"reports/eicar.com": drivers.EICARPattern(),
+		"reports/large.bin": strings.Repeat("x", 2048),
+	}
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/uploads" {
+			var b strings.Builder
+			b.WriteString("<ListBucketResult>")
+			for _, key := range []string{"reports/", "reports/a.txt", "reports/eicar.com", "reports/large.bin"} {
+				fmt.Fprintf(&b, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(objects[key]))
+			}
+			b.WriteString("<IsTruncated>false</IsTruncated></ListBucketResult>")
+			w.Write([]byte(b.String()))
+			return
+		}
+		data, ok := objects[strings.TrimPrefix(r.URL.Path, "/uploads/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	defer store.Close()
+
+	jobs, err := Load(writeSchedule(t, "jobs:\n  - name: bucket\n    cron: \"@daily\"\n    bucket: uploads\n    prefix: reports/\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &config.Config{
+		UploadDir:       t.TempDir(),
+		ActiveEngine:    config.EngineMock,
+		MaxNestingDepth: 3,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scanner.New(cfg, logger)
+	defer s.Stop()
+
+	scheduler := New(jobs, s, logger)
+	if report := scheduler.Run(jobs[0]); report.Error == "" {
+		t.Errorf("expected an error without an object store, got %+v", report)
+	}
+	scheduler.SetObjectStore(objectstore.NewS3("us-east-1", nil, 5*time.Second), store.URL, 1024)
+	report := scheduler.Run(jobs[0])
+	if report.Scanned != 2 || report.Infected != 1 || report.Skipped != 1 || report.Error != "" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Path != "s3://uploads/reports/" || len(report.Detections) != 1 || report.Detections[0].Path != "s3://uploads/reports/eicar.com" {
+		t.Errorf("unexpected report target or detections: %+v", report)
+	}
+
+	status := scheduler.Status()
+	if len(status) != 1 || status[0].Bucket != "uploads" || status[0].NextRun == nil || status[0].Running {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if len(status[0].Runs) != 2 || status[0].Runs[0] != report {
+		t.Errorf("expected both runs, newest first, got %+v", status[0].Runs)
+	}
+}
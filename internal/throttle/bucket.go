@@ -0,0 +1,80 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket measured in bytes. It refills at a fixed rate up
+// to its burst size. A reservation larger than the available tokens puts the
+// bucket into debt, so a file bigger than the burst is still admitted once
+// the caller has waited for its share of the rate.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewBucket creates a full bucket refilling at rate bytes per second
+func NewBucket(rate, burst int64) *Bucket {
+	if burst < rate {
+		burst = rate
+	}
+	b := &Bucket{
+		rate:  float64(rate),
+		burst: float64(burst),
+		now:   time.Now,
+	}
+	b.tokens = b.burst
+	b.last = b.now()
+	return b
+}
+
+// Reserve takes n bytes from the bucket and returns how long the caller must
+// wait before proceeding. If that wait would exceed maxWait, nothing is taken
+// and ok is false; the returned wait is then the time until n bytes would be
+// admitted.
+func (b *Bucket) Reserve(n int64, maxWait time.Duration) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if deficit := float64(n) - b.tokens; deficit > 0 {
+		wait = time.Duration(deficit / b.rate * float64(time.Second))
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens -= float64(n)
+	return wait, true
+}
+
+// Refund gives back n bytes reserved for work that did not go ahead
+func (b *Bucket) Refund(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens = min(b.tokens+float64(n), b.burst)
+}
+
+// Usage is the fraction of the burst currently reserved. It exceeds 1 while
+// the bucket is in debt.
+func (b *Bucket) Usage() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return 1 - b.tokens/b.burst
+}
+
+// refill adds the tokens accrued since the last call; b.mu must be held
+func (b *Bucket) refill() {
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
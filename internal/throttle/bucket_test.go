@@ -0,0 +1,89 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestBucket(rate, burst int64) (*Bucket, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBucket(rate, burst)
+	b.now = func() time.Time { return now }
+	b.last = now
+	return b, &now
+}
+
+func TestBucket_Burst(t *testing.T) {
+	b, _ := newTestBucket(100, 1000)
+
+	if wait, ok := b.Reserve(1000, 0); !ok || wait != 0 {
+		t.Errorf("expected full burst to be admitted immediately, got %v %v", wait, ok)
+	}
+	if wait, ok := b.Reserve(100, 0); ok || wait != time.Second {
+		t.Errorf("expected rejection with 1s wait, got %v %v", wait, ok)
+	}
+}
+
+func TestBucket_Refill(t *testing.T) {
+	b, now := newTestBucket(100, 1000)
+	b.Reserve(1000, 0)
+
+	*now = now.Add(500 * time.Millisecond)
+	if wait, ok := b.Reserve(50, 0); !ok || wait != 0 {
+		t.Errorf("expected refilled tokens to be admitted, got %v %v", wait, ok)
+	}
+
+	// Refill is capped at the burst size
+	*now = now.Add(time.Hour)
+	if _, ok := b.Reserve(1001, 0); ok {
+		t.Error("expected reservation above burst to wait")
+	}
+}
+
+func TestBucket_Queue(t *testing.T) {
+	b, _ := newTestBucket(100, 100)
+	b.Reserve(100, 0)
+
+	wait, ok := b.Reserve(200, 5*time.Second)
+	if !ok || wait != 2*time.Second {
+		t.Errorf("expected 2s wait, got %v %v", wait, ok)
+	}
+	// The queued reservation left the bucket in debt
+	if wait, _ := b.Reserve(100, 0); wait != 3*time.Second {
+		t.Errorf("expected 3s wait behind queued reservation, got %v", wait)
+	}
+}
+
+func TestBucket_Refund(t *testing.T) {
+	b, _ := newTestBucket(100, 1000)
+	b.Reserve(1000, 0)
+
+	b.Refund(400)
+	if wait, ok := b.Reserve(400, 0); !ok || wait != 0 {
+		t.Errorf("expected refunded tokens to be admitted, got %v %v", wait, ok)
+	}
+	// Refunds are capped at the burst size
+	b.Refund(5000)
+	if usage := b.Usage(); usage != 0 {
+		t.Errorf("expected a full bucket, got usage %v", usage)
+	}
+}
+
+func TestBucket_Usage(t *testing.T) {
+	b, now := newTestBucket(100, 1000)
+	if usage := b.Usage(); usage != 0 {
+		t.Errorf("expected a full bucket to be unused, got %v", usage)
+	}
+	b.Reserve(800, 0)
+	if usage := b.Usage(); usage != 0.8 {
+		t.Errorf("expected usage 0.8, got %v", usage)
+	}
+	b.Reserve(400, time.Minute)
+	if usage := b.Usage(); usage != 1.2 {
+		t.Errorf("expected usage above 1 while in debt, got %v", usage)
+	}
+	*now = now.Add(5 * time.Second)
+	if usage := b.Usage(); usage != 0.7 {
+		t.Errorf("expected refill to lower usage to 0.7, got %v", usage)
+	}
+}
@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Headers carrying the request ID and W3C trace context
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// maxRequestIDLength bounds caller-supplied request IDs, which end up in logs
+const maxRequestIDLength = 128
+
+// Context identifies the request that caused some work, so downstream
+// consumers of notifications can join their processing back to it
+type Context struct {
+	RequestID   string
+	TraceParent string // empty if the caller sent none
+	TraceState  string
+}
+
+type contextKey struct{}
+
+// FromRequest reads the request ID and trace context from incoming headers,
+// generating a request ID if none (or an invalid one) was sent. Malformed
+// trace context is dropped rather than passed on.
+func FromRequest(r *http.Request) Context {
+	return FromHeader(r.Header.Get)
+}
+
+// FromHeader is FromRequest for other transports, e.g. gRPC metadata, given
+// a lookup of header values by name
+func FromHeader(header func(name string) string) Context {
+	c := Context{RequestID: header(HeaderRequestID)}
+	if !validRequestID(c.RequestID) {
+		c.RequestID = randomHex(16)
+	}
+	if traceParent := strings.TrimSpace(header(HeaderTraceParent)); validTraceParent(traceParent) {
+		c.TraceParent = traceParent
+		c.TraceState = strings.TrimSpace(header(HeaderTraceState))
+	}
+	return c
+}
+
+// New starts a trace for work that no request caused, such as scheduled scans
+func New() Context {
+	return Context{
+		RequestID:   randomHex(16),
+		TraceParent: "00-" + randomHex(16) + "-" + randomHex(8) + "-00",
+	}
+}
+
+// TraceID returns the trace ID part of the trace context, or ""
+func (c Context) TraceID() string {
+	if c.TraceParent == "" {
+		return ""
+	}
+	return c.TraceParent[3:35]
+}
+
+// Inject sets the request ID and trace context on outgoing headers
+func (c Context) Inject(h http.Header) {
+	if c.RequestID != "" {
+		h.Set(HeaderRequestID, c.RequestID)
+	}
+	if c.TraceParent != "" {
+		h.Set(HeaderTraceParent, c.TraceParent)
+		if c.TraceState != "" {
+			h.Set(HeaderTraceState, c.TraceState)
+		}
+	}
+}
+
+// Fields returns the request ID and trace context by header name, for the
+// message headers of transports other than HTTP
+func (c Context) Fields() map[string]string {
+	fields := make(map[string]string)
+	if c.RequestID != "" {
+		fields[HeaderRequestID] = c.RequestID
+	}
+	if c.TraceParent != "" {
+		fields[HeaderTraceParent] = c.TraceParent
+		if c.TraceState != "" {
+			fields[HeaderTraceState] = c.TraceState
+		}
+	}
+	return fields
+}
+
+// NewContext returns ctx carrying c
+func NewContext(ctx context.Context, c Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the trace context stored by NewContext
+func FromContext(ctx context.Context) (Context, bool) {
+	c, ok := ctx.Value(contextKey{}).(Context)
+	return c, ok
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// validTraceParent checks the version-00 layout: version-traceid-parentid-flags
+func validTraceParent(s string) bool {
+	if len(s) != 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return false
+	}
+	version, traceID, parentID, flags := s[0:2], s[3:35], s[36:52], s[53:55]
+	for _, part := range []string{version, traceID, parentID, flags} {
+		if !isLowerHex(part) {
+			return false
+		}
+	}
+	return version != "ff" &&
+		traceID != strings.Repeat("0", 32) &&
+		parentID != strings.Repeat("0", 16)
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
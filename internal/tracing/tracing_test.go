@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/scan", nil)
+	r.Header.Set(HeaderRequestID, "req-123")
+	r.Header.Set(HeaderTraceParent, traceParent)
+	r.Header.Set(HeaderTraceState, "vendor=abc")
+
+	c := FromRequest(r)
+	if c.RequestID != "req-123" || c.TraceParent != traceParent || c.TraceState != "vendor=abc" {
+		t.Errorf("unexpected context: %+v", c)
+	}
+	if c.TraceID() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected trace ID: %s", c.TraceID())
+	}
+}
+
+func TestFromRequest_Invalid(t *testing.T) {
+	for name, header := range map[string]string{
+		"uppercase":   strings.ToUpper(traceParent),
+		"zero trace":  "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"zero parent": "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"version ff":  "ff" + traceParent[2:],
+		"short":       traceParent[:54],
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/scan", nil)
+		r.Header.Set(HeaderRequestID, "has space")
+		r.Header.Set(HeaderTraceParent, header)
+		r.Header.Set(HeaderTraceState, "vendor=abc")
+
+		c := FromRequest(r)
+		if c.TraceParent != "" || c.TraceState != "" {
+			t.Errorf("%s: expected trace context to be dropped, got %+v", name, c)
+		}
+		if c.RequestID == "" || c.RequestID == "has space" {
+			t.Errorf("%s: expected a generated request ID, got %q", name, c.RequestID)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	c := New()
+	if !validTraceParent(c.TraceParent) {
+		t.Errorf("invalid generated traceparent: %s", c.TraceParent)
+	}
+	if c.RequestID == New().RequestID {
+		t.Error("expected unique request IDs")
+	}
+}
+
+func TestInject(t *testing.T) {
+	h := http.Header{}
+	Context{RequestID: "req-123", TraceParent: traceParent}.Inject(h)
+	if h.Get(HeaderRequestID) != "req-123" || h.Get(HeaderTraceParent) != traceParent {
+		t.Errorf("unexpected headers: %v", h)
+	}
+	if _, ok := h[HeaderTraceState]; ok {
+		t.Error("expected no tracestate header")
+	}
+}
+
+func TestFromHeader(t *testing.T) {
+	metadata := map[string]string{HeaderRequestID: "req-123", HeaderTraceParent: traceParent}
+	c := FromHeader(func(name string) string { return metadata[name] })
+	if c.RequestID != "req-123" || c.TraceParent != traceParent {
+		t.Errorf("unexpected context: %+v", c)
+	}
+	fields := c.Fields()
+	if len(fields) != 2 || fields[HeaderRequestID] != "req-123" || fields[HeaderTraceParent] != traceParent {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+	if fields := (Context{}).Fields(); len(fields) != 0 {
+		t.Errorf("expected no fields, got %v", fields)
+	}
+}
@@ -0,0 +1,120 @@
+// Package uploads stores uploaded files while they are scanned. Engines
+// (and their on-access scanners) open uploads by path, so every store keeps
+// them as local files; stores differ in where those files may live and in
+// how they are written.
+package uploads
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/volume"
+)
+
+// Store creates and removes upload files below the upload directory
+type Store interface {
+	// Create creates the upload file at path, failing if anything exists
+	// there. Missing directories below the upload directory are created.
+	Create(path string) (io.WriteCloser, error)
+	// Link gives the upload at oldPath the additional name newPath, failing
+	// if newPath exists
+	Link(oldPath, newPath string) error
+	// Remove removes an upload file or an empty upload subdirectory
+	Remove(path string) error
+}
+
+// New returns the store selected by UPLOAD_STORE
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.UploadStore {
+	case config.UploadStoreTmpfs:
+		return NewTmpfs(cfg.UploadDir)
+	default:
+		return NewDisk(cfg.UploadDir), nil
+	}
+}
+
+// Disk keeps uploads as plain files below root
+type Disk struct {
+	root       string
+	filesystem string // if set, the only filesystem uploads may be created on
+}
+
+// NewDisk returns a store for uploads below root
+func NewDisk(root string) *Disk {
+	return &Disk{root: root}
+}
+
+// Create creates path exclusively, so an existing file or symlink there is
+// never written through, and refuses directories below root that are
+// symlinks
+func (d *Disk) Create(path string) (io.WriteCloser, error) {
+	dir := filepath.Dir(path)
+	if err := d.makeDirs(dir); err != nil {
+		return nil, err
+	}
+	// Checked per upload, since engine upload subdirectories may be
+	// separate mounts
+	if d.filesystem != "" {
+		if fs := volume.Inspect(dir, "").Filesystem; fs != d.filesystem {
+			return nil, fmt.Errorf("upload directory %s is on %s, not %s", dir, fs, d.filesystem)
+		}
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// Link hard-links oldPath to newPath
+func (d *Disk) Link(oldPath, newPath string) error {
+	return os.Link(oldPath, newPath)
+}
+
+// Remove removes path
+func (d *Disk) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// makeDirs creates dir and its missing parents below root, checking that
+// each one is a real directory rather than a symlink
+func (d *Disk) makeDirs(dir string) error {
+	rel, err := filepath.Rel(d.root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("upload path outside upload directory: %s", dir)
+	}
+	if err := os.MkdirAll(d.root, 0755); err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	current := d.root
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, elem)
+		if err := os.Mkdir(current, 0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+		info, err := os.Lstat(current)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("upload directory is a symlink or not a directory: %s", current)
+		}
+	}
+	return nil
+}
+
+// NewTmpfs returns a store for uploads below root that refuses to create
+// them anywhere but on tmpfs, so uploads never reach persistent storage
+func NewTmpfs(root string) (*Disk, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	if fs := volume.Inspect(root, "").Filesystem; fs != "tmpfs" {
+		return nil, fmt.Errorf("upload directory %s is on %s, not tmpfs", root, fs)
+	}
+	return &Disk{root: root, filesystem: "tmpfs"}, nil
+}
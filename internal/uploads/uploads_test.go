@@ -0,0 +1,58 @@
+package uploads
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rophy/av-scanner/internal/volume"
+)
+
+func TestDisk(t *testing.T) {
+	root := t.TempDir()
+	d := NewDisk(root)
+
+	path := filepath.Join(root, "id", "report.pdf")
+	f, err := d.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f.Write([]byte("hello"))
+	f.Close()
+	if _, err := d.Create(path); !os.IsExist(err) {
+		t.Errorf("expected an existing upload not to be recreated, got %v", err)
+	}
+	if _, err := d.Create(filepath.Join(root, "..", "escape")); err == nil {
+		t.Error("expected a path outside the root to be refused")
+	}
+
+	linked := filepath.Join(root, "hash.pdf")
+	if err := d.Link(path, linked); err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	if err := d.Link(path, linked); !os.IsExist(err) {
+		t.Errorf("expected Link not to replace an existing file, got %v", err)
+	}
+	for _, p := range []string{path, filepath.Dir(path), linked} {
+		if err := d.Remove(p); err != nil {
+			t.Errorf("Remove(%s) failed: %v", p, err)
+		}
+	}
+}
+
+func TestNewTmpfs(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewTmpfs(root)
+	if volume.Inspect(root, "").Filesystem == "tmpfs" {
+		if err != nil {
+			t.Fatalf("NewTmpfs failed on tmpfs: %v", err)
+		}
+		f, err := store.Create(filepath.Join(root, "a.txt"))
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		f.Close()
+	} else if err == nil {
+		t.Error("expected a directory on another filesystem to be refused")
+	}
+}
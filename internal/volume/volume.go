@@ -0,0 +1,60 @@
+package volume
+
+import "fmt"
+
+// Report describes the filesystem holding the upload directory. Real-time
+// scanning only sees uploads if the engine's on-access watch covers that
+// filesystem, and quarantining is a rename only within one filesystem.
+type Report struct {
+	UploadDir      string   `json:"uploadDir"`
+	Filesystem     string   `json:"filesystem"`
+	WatchSupported bool     `json:"watchSupported"`
+	QuarantineDir  string   `json:"quarantineDir,omitempty"`
+	SameFilesystem *bool    `json:"sameFilesystem,omitempty"` // nil if not checked
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// unwatchable filesystems do not deliver fanotify events for writes made
+// through them (network and FUSE mounts)
+var unwatchable = map[string]bool{
+	"nfs":  true,
+	"cifs": true,
+	"smb2": true,
+	"9p":   true,
+	"fuse": true,
+}
+
+// Inspect checks uploadDir and, if set, whether quarantineDir is on the same
+// filesystem. Problems are reported as warnings rather than errors so the
+// service still starts with manual scanning.
+func Inspect(uploadDir, quarantineDir string) *Report {
+	r := &Report{UploadDir: uploadDir, QuarantineDir: quarantineDir}
+
+	fsType, err := filesystemType(uploadDir)
+	if err != nil {
+		r.Filesystem = "unknown"
+		r.Warnings = append(r.Warnings, fmt.Sprintf("cannot inspect upload directory: %v", err))
+	} else {
+		r.Filesystem = fsType
+		r.WatchSupported = !unwatchable[fsType]
+		if !r.WatchSupported {
+			r.Warnings = append(r.Warnings, fmt.Sprintf(
+				"upload directory is on %s, which on-access scanning cannot watch; only manual scans will detect threats", fsType))
+		}
+	}
+
+	if quarantineDir != "" {
+		same, err := sameFilesystem(uploadDir, quarantineDir)
+		if err != nil {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("cannot inspect quarantine directory: %v", err))
+		} else {
+			r.SameFilesystem = &same
+			if !same {
+				r.Warnings = append(r.Warnings,
+					"upload directory and quarantine directory are on different filesystems; the engine must copy detected files to quarantine")
+			}
+		}
+	}
+
+	return r
+}
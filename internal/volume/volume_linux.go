@@ -0,0 +1,55 @@
+//go:build linux
+
+package volume
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Filesystem magic numbers from statfs(2)
+var filesystemNames = map[int64]string{
+	0x6969:     "nfs",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x01021997: "9p",
+	0x65735546: "fuse",
+	0xEF53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x01021994: "tmpfs",
+	0x794C7630: "overlay",
+	0x2FC12FC1: "zfs",
+}
+
+func filesystemType(path string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", err
+	}
+	if name, ok := filesystemNames[int64(st.Type)]; ok {
+		return name, nil
+	}
+	return fmt.Sprintf("0x%x", st.Type), nil
+}
+
+func sameFilesystem(a, b string) (bool, error) {
+	devA, err := device(a)
+	if err != nil {
+		return false, err
+	}
+	devB, err := device(b)
+	if err != nil {
+		return false, err
+	}
+	return devA == devB, nil
+}
+
+func device(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(info.Sys().(*syscall.Stat_t).Dev), nil
+}
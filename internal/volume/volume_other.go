@@ -0,0 +1,15 @@
+//go:build !linux
+
+package volume
+
+import "errors"
+
+var errUnsupported = errors.New("filesystem inspection is only supported on Linux")
+
+func filesystemType(path string) (string, error) {
+	return "", errUnsupported
+}
+
+func sameFilesystem(a, b string) (bool, error) {
+	return false, errUnsupported
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package volume
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspect_SameFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	quarantine := filepath.Join(dir, "quarantine")
+	if err := os.Mkdir(quarantine, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Inspect(dir, quarantine)
+	if r.Filesystem == "" || r.Filesystem == "unknown" {
+		t.Errorf("expected filesystem type, got %q", r.Filesystem)
+	}
+	if r.SameFilesystem == nil || !*r.SameFilesystem {
+		t.Errorf("expected same filesystem, got %v", r.SameFilesystem)
+	}
+}
+
+func TestInspect_NoQuarantineDir(t *testing.T) {
+	r := Inspect(t.TempDir(), "")
+	if r.SameFilesystem != nil {
+		t.Errorf("expected quarantine check to be skipped")
+	}
+}
+
+func TestInspect_MissingDirectories(t *testing.T) {
+	dir := t.TempDir()
+	r := Inspect(filepath.Join(dir, "missing"), filepath.Join(dir, "also-missing"))
+	if r.Filesystem != "unknown" || r.WatchSupported {
+		t.Errorf("expected unknown unwatched filesystem, got %q (watch %v)", r.Filesystem, r.WatchSupported)
+	}
+	if len(r.Warnings) != 2 {
+		t.Errorf("expected 2 warnings, got %v", r.Warnings)
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,9 +13,23 @@ import (
 	"time"
 
 	"github.com/rophy/av-scanner/internal/api"
+	"github.com/rophy/av-scanner/internal/bench"
+	"github.com/rophy/av-scanner/internal/bucketscan"
+	"github.com/rophy/av-scanner/internal/bulkscan"
+	"github.com/rophy/av-scanner/internal/clamdproto"
 	"github.com/rophy/av-scanner/internal/config"
+	"github.com/rophy/av-scanner/internal/dropzone"
+	"github.com/rophy/av-scanner/internal/events"
+	"github.com/rophy/av-scanner/internal/icap"
+	"github.com/rophy/av-scanner/internal/objectstore"
+	"github.com/rophy/av-scanner/internal/policy"
+	"github.com/rophy/av-scanner/internal/quarantine"
 	"github.com/rophy/av-scanner/internal/scanner"
+	"github.com/rophy/av-scanner/internal/schedule"
+	"github.com/rophy/av-scanner/internal/uploads"
 	"github.com/rophy/av-scanner/internal/version"
+	"github.com/rophy/av-scanner/internal/volume"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -21,12 +37,32 @@ func main() {
 		fmt.Printf("av-scanner %s (commit: %s, built: %s)\n", version.Version, version.Commit, version.BuildTime)
 		os.Exit(0)
 	}
-	// Setup logger
+	if len(os.Args) > 1 && os.Args[1] == "config-schema" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(config.Schema()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	// Subcommands run once and exit instead of serving the API
+	command := ""
+	if len(os.Args) > 1 && (os.Args[1] == "bulk-scan" || os.Args[1] == "bench") {
+		command = os.Args[1]
+	}
+
+	// Setup logger; subcommands keep stdout for results
 	logLevel := slog.LevelInfo
+	logOutput := os.Stdout
+	if command != "" {
+		logLevel = slog.LevelWarn
+		logOutput = os.Stderr
+	}
 	if os.Getenv("LOG_LEVEL") == "debug" {
 		logLevel = slog.LevelDebug
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	logger := slog.New(slog.NewJSONHandler(logOutput, &slog.HandlerOptions{
 		Level: logLevel,
 	}))
 	logger = logger.With("service", "av-scanner")
@@ -35,18 +71,74 @@ func main() {
 	cfg, err := config.Load()
 	if err != nil {
 		logger.Error("Failed to load configuration", "error", err)
+		if command == "bulk-scan" {
+			os.Exit(bulkscan.ExitError)
+		}
 		os.Exit(1)
 	}
 
+	switch command {
+	case "bulk-scan":
+		os.Exit(bulkscan.Run(os.Args[2:], cfg, logger, os.Stdout, os.Stderr))
+	case "bench":
+		os.Exit(bench.Run(os.Args[2:], cfg, logger, os.Stdout, os.Stderr))
+	}
+
 	// Ensure upload directory exists
-	if err := os.MkdirAll(cfg.UploadDir, 0755); err != nil {
-		logger.Error("Failed to create upload directory", "error", err, "path", cfg.UploadDir)
+	uploadDir := cfg.EngineUploadDir(cfg.ActiveEngine)
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		logger.Error("Failed to create upload directory", "error", err, "path", uploadDir)
 		os.Exit(1)
 	}
-	logger.Info("Upload directory ready", "path", cfg.UploadDir)
+	logger.Info("Upload directory ready", "path", uploadDir)
 
 	// Initialize scanner
 	s := scanner.New(cfg, logger)
+	uploadStore, err := uploads.New(cfg)
+	if err != nil {
+		logger.Error("Failed to open upload store", "error", err, "store", cfg.UploadStore)
+		os.Exit(1)
+	}
+	s.SetUploadStore(uploadStore)
+
+	// Check the upload directory is visible to real-time scanning
+	uploadVolume := volume.Inspect(uploadDir, cfg.Drivers[cfg.ActiveEngine].QuarantineDir)
+	uploadVolume.Warnings = append(uploadVolume.Warnings, s.WatchCoverageWarnings()...)
+	for _, warning := range uploadVolume.Warnings {
+		logger.Warn("Upload directory misconfigured", "path", uploadDir, "filesystem", uploadVolume.Filesystem, "warning", warning)
+	}
+	s.SetUploadVolume(uploadVolume)
+
+	// Load scan policy
+	scanPolicy, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		logger.Error("Failed to load scan policy", "error", err, "path", cfg.PolicyFile)
+		os.Exit(1)
+	}
+	s.SetPolicy(scanPolicy)
+
+	// Open the quarantine store
+	quarantineStore, err := quarantine.Open(cfg.QuarantineDir, cfg.QuarantineKeyFile)
+	if err != nil {
+		logger.Error("Failed to open quarantine", "error", err, "path", cfg.QuarantineDir)
+		os.Exit(1)
+	}
+	s.SetQuarantine(quarantineStore)
+
+	// Publish scan results
+	publisher, err := events.New(cfg, logger)
+	if err != nil {
+		logger.Error("Failed to create event publisher", "error", err, "transport", cfg.EventsTransport)
+		os.Exit(1)
+	}
+	s.SetEvents(publisher)
+
+	// Load scheduled scans
+	jobs, err := schedule.Load(cfg.ScheduleFile)
+	if err != nil {
+		logger.Error("Failed to load scan schedule", "error", err, "path", cfg.ScheduleFile)
+		os.Exit(1)
+	}
 
 	// Start background log watchers
 	if err := s.Start(); err != nil {
@@ -54,6 +146,49 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Start scheduled scans
+	scheduler := schedule.New(jobs, s, logger)
+	if len(cfg.ObjectStoreEndpoints) > 0 {
+		store, err := objectstore.NewS3FromConfig(cfg)
+		if err != nil {
+			logger.Error("Failed to create object store client", "error", err)
+			os.Exit(1)
+		}
+		maxSize := cfg.ObjectStoreMaxSize
+		if maxSize == 0 {
+			maxSize = cfg.MaxFileSize
+		}
+		scheduler.SetObjectStore(store, cfg.ObjectStoreEndpoints[0], maxSize)
+	} else {
+		for _, job := range jobs {
+			if job.Bucket != "" {
+				logger.Error("Scheduled bucket scans require OBJECT_STORE_ENDPOINTS", "job", job.Name)
+				os.Exit(1)
+			}
+		}
+	}
+	scheduler.Start()
+
+	// Watch the drop zone
+	dropzoneWatcher := dropzone.New(cfg, s, logger)
+	if dropzoneWatcher != nil {
+		if err := dropzoneWatcher.Start(); err != nil {
+			logger.Error("Failed to start drop zone watcher", "error", err, "path", cfg.DropzoneDir)
+			os.Exit(1)
+		}
+	}
+
+	// Scan objects announced by bucket notifications
+	bucketScanner, err := bucketscan.New(cfg, s, logger)
+	if err != nil {
+		logger.Error("Failed to start bucket scanning", "error", err)
+		os.Exit(1)
+	}
+	if bucketScanner != nil {
+		bucketScanner.Start()
+	}
+	pathScans := bulkscan.NewPathScans(cfg, s, logger)
+
 	// Check health of all engines
 	for _, health := range s.CheckHealth() {
 		if health.Healthy {
@@ -63,12 +198,20 @@ func main() {
 		}
 	}
 
+	// Load definitions into memory before reporting ready
+	if cfg.WarmUpScan {
+		go s.WarmUp()
+	}
+
 	// Initialize API
 	apiHandler, err := api.New(s, cfg, logger)
 	if err != nil {
 		logger.Error("Failed to initialize API", "error", err)
 		os.Exit(1)
 	}
+	apiHandler.SetBucketScan(bucketScanner)
+	apiHandler.SetPathScans(pathScans)
+	apiHandler.SetScheduler(scheduler)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -91,6 +234,69 @@ func main() {
 		}
 	}()
 
+	// Start the admin listener, if separate
+	var adminServer *http.Server
+	if cfg.AdminPort != 0 {
+		adminServer = &http.Server{
+			Addr:         fmt.Sprintf(":%d", cfg.AdminPort),
+			Handler:      apiHandler.AdminRoutes(),
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		go func() {
+			logger.Info("Admin listener started", "port", cfg.AdminPort)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Admin server error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Start the ICAP listener for proxies
+	var icapServer *icap.Server
+	if cfg.ICAPPort != 0 {
+		icapServer = icap.New(s, cfg.MaxFileSize, apiHandler.Paused, logger)
+		go func() {
+			logger.Info("ICAP listener started", "port", cfg.ICAPPort)
+			if err := icapServer.ListenAndServe(fmt.Sprintf(":%d", cfg.ICAPPort)); err != nil && err != icap.ErrServerClosed {
+				logger.Error("ICAP server error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Start the clamd protocol listener
+	var clamdServer *clamdproto.Server
+	if cfg.ClamdPort != 0 {
+		clamdServer = clamdproto.New(s, cfg.MaxFileSize, cfg.ClamdScanRoots, apiHandler.Paused, logger)
+		go func() {
+			logger.Info("clamd listener started", "port", cfg.ClamdPort)
+			if err := clamdServer.ListenAndServe(fmt.Sprintf(":%d", cfg.ClamdPort)); err != nil && err != clamdproto.ErrServerClosed {
+				logger.Error("clamd server error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Start the gRPC listener
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != 0 {
+		grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			logger.Error("Failed to start gRPC listener", "error", err)
+			os.Exit(1)
+		}
+		grpcServer = apiHandler.GRPCServer()
+		go func() {
+			logger.Info("gRPC listener started", "port", cfg.GRPCPort)
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				logger.Error("gRPC server error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -105,9 +311,51 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Server forced to shutdown", "error", err)
 	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logger.Error("Admin server forced to shutdown", "error", err)
+		}
+	}
+	if icapServer != nil {
+		if err := icapServer.Shutdown(ctx); err != nil {
+			logger.Error("ICAP server forced to shutdown", "error", err)
+		}
+	}
+	if clamdServer != nil {
+		if err := clamdServer.Shutdown(ctx); err != nil {
+			logger.Error("clamd server forced to shutdown", "error", err)
+		}
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			logger.Error("gRPC server forced to shutdown")
+			grpcServer.Stop()
+		}
+	}
 
-	// Stop scanner background watchers
+	// Stop scheduled, drop zone, bucket and directory scans, then scanner
+	// background watchers
+	scheduler.Stop()
+	if dropzoneWatcher != nil {
+		dropzoneWatcher.Stop()
+	}
+	if bucketScanner != nil {
+		bucketScanner.Stop()
+	}
+	if pathScans != nil {
+		pathScans.Stop()
+	}
 	s.Stop()
+	if publisher != nil {
+		publisher.Close()
+	}
 
 	// Close API resources
 	apiHandler.Close()